@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"idm/inner/audit"
+	"idm/inner/common"
+	"idm/inner/database"
+	"idm/inner/employee"
+	"idm/inner/importer"
+	"idm/inner/recorders"
+	"idm/inner/role"
+	"idm/inner/validator"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// утилита импорта сотрудников и ролей из файла в обход HTTP API:
+//
+//	go run ./cmd/import -file employees.csv [-format csv|jsonl] [-partial] [-dry-run]
+//
+// печатает отчёт в JSON и завершается с кодом 1, если есть ошибочные строки
+func main() {
+	file := flag.String("file", "", "путь к файлу CSV или JSON lines")
+	format := flag.String("format", "", "формат файла: csv или jsonl, по умолчанию по расширению")
+	partial := flag.Bool("partial", false, "сохранить корректные строки, даже если в других есть ошибки")
+	dryRun := flag.Bool("dry-run", false, "проверить импорт и откатить изменения")
+	envFile := flag.String("env", ".env", "файл с настройками подключения к базе данных")
+	flag.Parse()
+	if *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	input, err := os.Open(*file)
+	if err != nil {
+		fail(err)
+	}
+	defer func() { _ = input.Close() }()
+
+	request := importer.Request{Format: *format, Mode: importer.ModeAtomic, DryRun: *dryRun}
+	if request.Format == "" {
+		request.Format = strings.TrimPrefix(filepath.Ext(*file), ".")
+	}
+	if *partial {
+		request.Mode = importer.ModePartial
+	}
+
+	cfg := common.GetConfig(*envFile)
+	db := database.ConnectDbWithCfg(cfg)
+	defer func() { _ = db.Close() }()
+	validate := validator.New()
+	// импортированные сотрудники только ставятся в очереди синхронизации, веб-хуков и outbox, доставит их сервис
+	changes, err := recorders.NewServices(db, cfg, validate)
+	if err != nil {
+		fail(err)
+	}
+	auditor := changes.Recorders()
+	roleRepo := role.NewRoleRepository(db)
+	employeeService := employee.NewService(employee.NewEmployeeRepository(db), roleRepo, validate, auditor, cfg.PurgeRetention)
+	roleService := role.NewService(roleRepo, validate, auditor, cfg.PurgeRetention)
+	importService := importer.NewService(importer.NewImportRepository(db), employeeService, roleService, validate)
+
+	report, err := importService.Import(audit.Actor{Subject: "import-cli"}, request, input)
+	if err != nil {
+		fail(err)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(report); err != nil {
+		fail(err)
+	}
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func fail(err error) {
+	_, _ = fmt.Fprintf(os.Stderr, "import error: %v\n", err)
+	os.Exit(1)
+}
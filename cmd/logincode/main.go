@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"idm/inner/common"
+	"idm/inner/database"
+	"idm/inner/employee"
+	"idm/inner/role"
+	"idm/inner/token"
+	"idm/inner/validator"
+	"os"
+)
+
+// утилита выпуска одноразового кода входа сотрудника в обход HTTP API, например для первого
+// входа администратора, у которого ещё нет токена:
+//
+//	go run ./cmd/logincode -employee 1
+//
+// код обменивается на токен через POST /oauth/token с grant_type=one_time_code
+func main() {
+	employeeId := flag.Int64("employee", 0, "идентификатор сотрудника")
+	envFile := flag.String("env", ".env", "файл с настройками подключения к базе данных")
+	flag.Parse()
+	if *employeeId <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg := common.GetConfig(*envFile)
+	db := database.ConnectDbWithCfg(cfg)
+	defer func() { _ = db.Close() }()
+	tokenRepo := token.NewTokenRepository(db)
+	keyStore := token.NewKeyStore(tokenRepo, cfg.JwtTokenTtl, cfg.JwtKeyRotation)
+	tokenService := token.NewService(tokenRepo, employee.NewEmployeeRepository(db), role.NewRoleRepository(db), keyStore, validator.New(), cfg)
+
+	code, err := tokenService.CreateLoginCode(nil, *employeeId)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "login code error: %v\n", err)
+		os.Exit(1)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(code); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "login code error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,111 @@
+package apikey
+
+import (
+	"errors"
+	"github.com/gofiber/fiber"
+	"idm/inner/common"
+	"idm/inner/web"
+)
+
+type Controller struct {
+	server        *web.Server
+	apiKeyService Svc
+}
+
+// интерфейс сервиса apikey.Service
+type Svc interface {
+	Create(caller common.Caller, request CreateRequest) (CreatedResponse, error)
+	FindAll() ([]Response, error)
+	Revoke(id int64) error
+}
+
+func NewController(server *web.Server, apiKeyService Svc) *Controller {
+	return &Controller{
+		server:        server,
+		apiKeyService: apiKeyService,
+	}
+}
+
+// функция для регистрации маршрутов
+func (c *Controller) RegisterRoutes() {
+	read := c.server.Require("api_keys:read")
+	write := c.server.Require("api_keys:write")
+
+	// полный путь будет "/api/v1/api-keys"
+	c.server.GroupApiV1.Post("/api-keys", write, c.Create)
+	c.server.GroupApiV1.Get("/api-keys", read, c.FindAll)
+	c.server.GroupApiV1.Delete("/api-keys/:id", write, c.Revoke)
+}
+
+// функция-хендлер для POST запроса по маршруту "/api/v1/api-keys"
+func (c *Controller) Create(ctx *fiber.Ctx) {
+	var request CreateRequest
+	if err := ctx.BodyParser(&request); err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	created, err := c.apiKeyService.Create(c.server.Caller(ctx), request)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+	err = common.OkResponse(ctx, created)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning created api key")
+		return
+	}
+}
+
+// функция-хендлер для GET запроса по маршруту "/api/v1/api-keys"
+func (c *Controller) FindAll(ctx *fiber.Ctx) {
+	keys, err := c.apiKeyService.FindAll()
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, keys)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning api keys")
+		return
+	}
+}
+
+// функция-хендлер для DELETE запроса по маршруту "/api/v1/api-keys/:id"
+func (c *Controller) Revoke(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = c.apiKeyService.Revoke(id); err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, id)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning revoked api key id")
+		return
+	}
+}
+
+// errResponse сопоставляет ошибку сервиса с кодом ответа:
+// 400 — ошибки валидации, 403 — выдача прав, которых нет у вызывающего, 404 — ключ или право не найдены,
+// 500 — всё остальное
+func errResponse(ctx *fiber.Ctx, err error) {
+	switch {
+	case errors.As(err, &common.RequestValidationError{}):
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+	case errors.As(err, &common.NotFoundError{}):
+		_ = common.ErrResponse(ctx, fiber.StatusNotFound, err.Error())
+	case errors.As(err, &common.PermissionDeniedError{}):
+		_ = common.ErrResponse(ctx, fiber.StatusForbidden, err.Error())
+	default:
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,85 @@
+package apikey
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gofiber/fiber"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/common"
+	"idm/inner/web"
+	"net/http/httptest"
+	"testing"
+)
+
+type MockService struct {
+	mock.Mock
+}
+
+func (m *MockService) Create(caller common.Caller, request CreateRequest) (CreatedResponse, error) {
+	args := m.Called(caller, request)
+	return args.Get(0).(CreatedResponse), args.Error(1)
+}
+
+func (m *MockService) FindAll() ([]Response, error) {
+	args := m.Called()
+	return args.Get(0).([]Response), args.Error(1)
+}
+
+func (m *MockService) Revoke(id int64) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func TestController(t *testing.T) {
+	mockService := new(MockService)
+	server := web.NewServer()
+	controller := NewController(server, mockService)
+	controller.RegisterRoutes()
+
+	t.Run("CreateSuccess", func(t *testing.T) {
+		body, _ := json.Marshal(request)
+		req := httptest.NewRequest(fiber.MethodPost, "/api/v1/api-keys", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		created := CreatedResponse{Response: Response{Id: 7, KeyId: "abc"}, Key: "idm_abc_secret"}
+		mockService.On("Create", mock.Anything, request).Return(created, nil)
+
+		resp, err := server.App.Test(req)
+		assert.NoError(t, err)
+
+		var response common.Response[CreatedResponse]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, "no-store", resp.Header.Get(fiber.HeaderCacheControl))
+		assert.Equal(t, "idm_abc_secret", response.Data.Key)
+	})
+
+	t.Run("CreateForbidden", func(t *testing.T) {
+		body, _ := json.Marshal(request)
+		req := httptest.NewRequest(fiber.MethodPost, "/api/v1/api-keys", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		mockService.ExpectedCalls = nil
+		mockService.On("Create", mock.Anything, request).
+			Return(CreatedResponse{}, common.PermissionDeniedError{Permissions: []string{"employees:write"}})
+
+		resp, err := server.App.Test(req)
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("RevokeNotFound", func(t *testing.T) {
+		mockService.On("Revoke", int64(9)).Return(common.NotFoundError{Resource: "api key", ID: 9})
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodDelete, "/api/v1/api-keys/9", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("RevokeInvalidId", func(t *testing.T) {
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodDelete, "/api/v1/api-keys/abc", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	})
+}
@@ -0,0 +1,73 @@
+package apikey
+
+import (
+	"github.com/lib/pq"
+	"idm/inner/auth"
+	"time"
+)
+
+type Entity struct {
+	Id             int64          `db:"id"`
+	KeyId          string         `db:"key_id"`
+	Name           string         `db:"name"`
+	ServiceAccount string         `db:"service_account"`
+	Salt           string         `db:"salt"`
+	SecretHash     string         `db:"secret_hash"`
+	Permissions    pq.StringArray `db:"permissions"`
+	CreatedAt      time.Time      `db:"created_at"`
+	LastUsedAt     *time.Time     `db:"last_used_at"`
+	RevokedAt      *time.Time     `db:"revoked_at"`
+}
+
+func (e *Entity) toResponse() Response {
+	return Response{
+		Id:             e.Id,
+		KeyId:          e.KeyId,
+		Name:           e.Name,
+		ServiceAccount: e.ServiceAccount,
+		Permissions:    e.Permissions,
+		CreatedAt:      e.CreatedAt,
+		LastUsedAt:     e.LastUsedAt,
+		RevokedAt:      e.RevokedAt,
+	}
+}
+
+func (e *Entity) toPrincipal() auth.ApiKeyPrincipal {
+	return auth.ApiKeyPrincipal{
+		KeyId:          e.KeyId,
+		ServiceAccount: e.ServiceAccount,
+		Permissions:    e.Permissions,
+	}
+}
+
+func toSliceResponse(e []Entity) []Response {
+	responses := make([]Response, len(e))
+	for i := range e {
+		responses[i] = e[i].toResponse()
+	}
+	return responses
+}
+
+type Response struct {
+	Id             int64      `json:"id"`
+	KeyId          string     `json:"key_id"`
+	Name           string     `json:"name"`
+	ServiceAccount string     `json:"service_account"`
+	Permissions    []string   `json:"permissions"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastUsedAt     *time.Time `json:"last_used_at"`
+	RevokedAt      *time.Time `json:"revoked_at"`
+}
+
+// CreatedResponse сам ключ возвращается только один раз — при создании
+type CreatedResponse struct {
+	Response
+	Key string `json:"key"`
+}
+
+// CreateRequest права ключа перечисляются в виде "resource:action" и должны существовать
+type CreateRequest struct {
+	Name           string   `json:"name" validate:"required,min=2,max=155"`
+	ServiceAccount string   `json:"service_account" validate:"required,min=3,max=100,excludesall=: "`
+	Permissions    []string `json:"permissions" validate:"required,min=1,max=50,unique,dive,min=3,max=201,contains=:"`
+}
@@ -0,0 +1,94 @@
+package apikey
+
+import (
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type Repository struct {
+	db *sqlx.DB
+}
+
+func NewApiKeyRepository(dataBase *sqlx.DB) *Repository {
+	return &Repository{db: dataBase}
+}
+
+// selectWithPermissions ключи вместе с именами их прав
+const selectWithPermissions = `select k.*,
+		coalesce(array_agg(p.resource || ':' || p.action order by p.resource, p.action)
+			filter (where p.id is not null), '{}') as permissions
+	from api_key k
+		left join api_key_permission kp on kp.api_key_id = k.id
+		left join permission p on p.id = kp.permission_id`
+
+func (repo *Repository) FindAll() (listEntity []Entity, err error) {
+	listEntity = []Entity{}
+	err = repo.db.Select(&listEntity, selectWithPermissions+" group by k.id order by k.id")
+	return listEntity, err
+}
+
+func (repo *Repository) FindByKeyId(keyId string) (entity Entity, err error) {
+	err = repo.db.Get(&entity, selectWithPermissions+" where k.key_id = $1 group by k.id", keyId)
+	return entity, err
+}
+
+// Revoke отзыв ключа; повторный отзыв сохраняет исходное время
+func (repo *Repository) Revoke(id int64) error {
+	result, err := repo.db.Exec("update api_key set revoked_at = coalesce(revoked_at, now()) where id = $1", id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// TouchLastUsed отмечает использование ключа; чаще раза в минуту строка не обновляется,
+// чтобы частые запросы сервиса не превращались в такие же частые записи
+func (repo *Repository) TouchLastUsed(id int64) error {
+	_, err := repo.db.Exec(
+		`update api_key set last_used_at = now()
+		where id = $1 and (last_used_at is null or last_used_at < now() - interval '1 minute')`,
+		id,
+	)
+	return err
+}
+
+func (repo *Repository) BeginTransaction() (tx *sqlx.Tx, err error) {
+	return repo.db.Beginx()
+}
+
+// FindPermissionIdsByNamesTx идентификаторы прав по именам "resource:action"; несуществующие имена пропускаются
+func (repo *Repository) FindPermissionIdsByNamesTx(tx *sqlx.Tx, names []string) (ids []int64, err error) {
+	ids = []int64{}
+	err = tx.Select(
+		&ids,
+		"select id from permission where resource || ':' || action = any($1) order by id",
+		pq.Array(names),
+	)
+	return ids, err
+}
+
+func (repo *Repository) SaveTx(tx *sqlx.Tx, entity Entity) (saved Entity, err error) {
+	err = tx.Get(
+		&saved,
+		`insert into api_key (key_id, name, service_account, salt, secret_hash) values ($1, $2, $3, $4, $5)
+		returning *, '{}'::text[] as permissions`,
+		entity.KeyId, entity.Name, entity.ServiceAccount, entity.Salt, entity.SecretHash,
+	)
+	return saved, err
+}
+
+func (repo *Repository) GrantPermissionsTx(tx *sqlx.Tx, id int64, permissionIds []int64) error {
+	_, err := tx.Exec(
+		"insert into api_key_permission (api_key_id, permission_id) select $1, unnest($2::bigint[])",
+		id, pq.Array(permissionIds),
+	)
+	return err
+}
@@ -0,0 +1,152 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"idm/inner/auth"
+	"idm/inner/common"
+	"slices"
+	"strings"
+)
+
+// keyPrefix начало каждого ключа: по нему ключ легко найти в логах и конфигурации.
+// Полный ключ — "idm_<key_id>_<secret>"; key_id открыт и служит для поиска ключа в базе
+const keyPrefix = "idm_"
+
+type Service struct {
+	repo      Repo
+	validator Validator
+}
+
+func NewService(repo Repo, validator Validator) *Service {
+	return &Service{
+		repo:      repo,
+		validator: validator,
+	}
+}
+
+type Validator interface {
+	Validate(request any) error
+}
+
+type Repo interface {
+	FindAll() (listEntity []Entity, err error)
+	FindByKeyId(keyId string) (entity Entity, err error)
+	Revoke(id int64) error
+	TouchLastUsed(id int64) error
+	BeginTransaction() (tx *sqlx.Tx, err error)
+	FindPermissionIdsByNamesTx(tx *sqlx.Tx, names []string) (ids []int64, err error)
+	SaveTx(tx *sqlx.Tx, entity Entity) (saved Entity, err error)
+	GrantPermissionsTx(tx *sqlx.Tx, id int64, permissionIds []int64) error
+}
+
+// Create ключ получает только права, которые есть у самого вызывающего
+func (service *Service) Create(caller common.Caller, request CreateRequest) (response CreatedResponse, err error) {
+	if err = service.validator.Validate(request); err != nil {
+		return CreatedResponse{}, err
+	}
+	if err = common.RequireGrantable(caller, request.Permissions); err != nil {
+		return CreatedResponse{}, err
+	}
+	keyId := hex.EncodeToString(randomBytes(8))
+	secret := base64.RawURLEncoding.EncodeToString(randomBytes(32))
+	salt := hex.EncodeToString(randomBytes(16))
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return CreatedResponse{}, fmt.Errorf("error create api key: error creating transaction: %w", err)
+	}
+	permissionIds, err := service.repo.FindPermissionIdsByNamesTx(tx, request.Permissions)
+	if err != nil {
+		return CreatedResponse{}, fmt.Errorf("error finding permissions %s: %w", request.Permissions, err)
+	}
+	if len(permissionIds) != len(request.Permissions) {
+		return CreatedResponse{}, common.NotFoundError{Resource: "permission", ID: request.Permissions}
+	}
+	saved, err := service.repo.SaveTx(tx, Entity{
+		KeyId:          keyId,
+		Name:           request.Name,
+		ServiceAccount: request.ServiceAccount,
+		Salt:           salt,
+		SecretHash:     hashSecret(salt, secret),
+	})
+	if err != nil {
+		return CreatedResponse{}, fmt.Errorf("error saving api key for %s: %w", request.ServiceAccount, err)
+	}
+	if err = service.repo.GrantPermissionsTx(tx, saved.Id, permissionIds); err != nil {
+		return CreatedResponse{}, fmt.Errorf("error granting permissions to api key %s: %w", keyId, err)
+	}
+	saved.Permissions = slices.Sorted(slices.Values(request.Permissions))
+	return CreatedResponse{Response: saved.toResponse(), Key: keyPrefix + keyId + "_" + secret}, nil
+}
+
+func (service *Service) FindAll() ([]Response, error) {
+	keys, err := service.repo.FindAll()
+	if err != nil {
+		return []Response{}, fmt.Errorf("error finding api keys: %w", err)
+	}
+	return toSliceResponse(keys), nil
+}
+
+// Revoke отозванный ключ остаётся в списке, чтобы было видно, кто и когда им пользовался
+func (service *Service) Revoke(id int64) error {
+	err := service.repo.Revoke(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return common.NotFoundError{Resource: "api key", ID: id}
+	}
+	if err != nil {
+		return fmt.Errorf("error revoke api key by id: %d: %w", id, err)
+	}
+	return nil
+}
+
+// VerifyApiKey проверка ключа из заголовка Authorization: ApiKey
+func (service *Service) VerifyApiKey(key string) (auth.ApiKeyPrincipal, error) {
+	keyId, secret, ok := strings.Cut(strings.TrimPrefix(key, keyPrefix), "_")
+	if !ok || !strings.HasPrefix(key, keyPrefix) {
+		return auth.ApiKeyPrincipal{}, auth.ErrInvalidApiKey
+	}
+	entity, err := service.repo.FindByKeyId(keyId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return auth.ApiKeyPrincipal{}, auth.ErrInvalidApiKey
+	}
+	if err != nil {
+		return auth.ApiKeyPrincipal{}, fmt.Errorf("error finding api key %s: %w", keyId, err)
+	}
+	hash := hashSecret(entity.Salt, secret)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(entity.SecretHash)) != 1 || entity.RevokedAt != nil {
+		return auth.ApiKeyPrincipal{}, auth.ErrInvalidApiKey
+	}
+	if err = service.repo.TouchLastUsed(entity.Id); err != nil {
+		return auth.ApiKeyPrincipal{}, fmt.Errorf("error touching api key %s: %w", keyId, err)
+	}
+	return entity.toPrincipal(), nil
+}
+
+// hashSecret у ключа высокая энтропия, поэтому медленный хеш не нужен: хватает соли и SHA-256,
+// а проверка остаётся дешёвой на каждом запросе
+func hashSecret(salt string, secret string) string {
+	sum := sha256.Sum256([]byte(salt + secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomBytes(size int) []byte {
+	buf := make([]byte, size)
+	_, _ = rand.Read(buf)
+	return buf
+}
@@ -0,0 +1,218 @@
+package apikey
+
+import (
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/auth"
+	"idm/inner/common"
+	"idm/inner/validator"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+type MockRepo struct {
+	mock.Mock
+}
+
+func (m *MockRepo) FindAll() ([]Entity, error) {
+	args := m.Called()
+	return args.Get(0).([]Entity), args.Error(1)
+}
+
+func (m *MockRepo) FindByKeyId(keyId string) (Entity, error) {
+	args := m.Called(keyId)
+	return args.Get(0).(Entity), args.Error(1)
+}
+
+func (m *MockRepo) Revoke(id int64) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockRepo) TouchLastUsed(id int64) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockRepo) BeginTransaction() (*sqlx.Tx, error) {
+	args := m.Called()
+	return args.Get(0).(*sqlx.Tx), args.Error(1)
+}
+
+func (m *MockRepo) FindPermissionIdsByNamesTx(tx *sqlx.Tx, names []string) ([]int64, error) {
+	args := m.Called(tx, names)
+	return args.Get(0).([]int64), args.Error(1)
+}
+
+func (m *MockRepo) SaveTx(tx *sqlx.Tx, entity Entity) (Entity, error) {
+	args := m.Called(tx, entity)
+	return args.Get(0).(Entity), args.Error(1)
+}
+
+func (m *MockRepo) GrantPermissionsTx(tx *sqlx.Tx, id int64, permissionIds []int64) error {
+	args := m.Called(tx, id, permissionIds)
+	return args.Error(0)
+}
+
+var noTx *sqlx.Tx
+
+// grantedPermissions права вызывающего в тестах
+type grantedPermissions []string
+
+func (p grantedPermissions) HasPermission(permission string) (bool, error) {
+	return p == nil || slices.Contains(p, permission), nil
+}
+
+// allowAll вызывающий со всеми правами
+var allowAll grantedPermissions
+
+var request = CreateRequest{Name: "Синхронизация HR", ServiceAccount: "hr-sync", Permissions: []string{"employees:write", "employees:read"}}
+
+// created создаёт ключ через сервис и возвращает его вместе с сохранённой сущностью
+func created(t *testing.T) (string, Entity) {
+	var repo = new(MockRepo)
+	var svc = NewService(repo, validator.New())
+	var saved Entity
+	repo.On("BeginTransaction").Return(noTx, nil)
+	repo.On("FindPermissionIdsByNamesTx", noTx, request.Permissions).Return([]int64{1, 2}, nil)
+	repo.On("SaveTx", noTx, mock.Anything).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(Entity)
+		saved.Id = 7
+	}).Return(Entity{Id: 7, Name: request.Name, ServiceAccount: request.ServiceAccount}, nil)
+	repo.On("GrantPermissionsTx", noTx, int64(7), []int64{1, 2}).Return(nil)
+
+	response, err := svc.Create(allowAll, request)
+	assert.NoError(t, err)
+	return response.Key, saved
+}
+
+func TestServiceCreate(t *testing.T) {
+	var a = assert.New(t)
+
+	t.Run("should store only salted hash", func(t *testing.T) {
+		key, saved := created(t)
+
+		a.True(strings.HasPrefix(key, keyPrefix+saved.KeyId+"_"))
+		a.NotEmpty(saved.Salt)
+		a.NotContains(saved.SecretHash, strings.TrimPrefix(key, keyPrefix+saved.KeyId+"_"))
+		a.Equal(hashSecret(saved.Salt, strings.TrimPrefix(key, keyPrefix+saved.KeyId+"_")), saved.SecretHash)
+	})
+
+	t.Run("should return sorted permissions", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, validator.New())
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindPermissionIdsByNamesTx", noTx, request.Permissions).Return([]int64{1, 2}, nil)
+		repo.On("SaveTx", noTx, mock.Anything).Return(Entity{Id: 7}, nil)
+		repo.On("GrantPermissionsTx", noTx, int64(7), []int64{1, 2}).Return(nil)
+
+		response, err := svc.Create(allowAll, request)
+
+		a.Nil(err)
+		a.Equal([]string{"employees:read", "employees:write"}, response.Permissions)
+	})
+
+	t.Run("should return not found for unknown permission", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, validator.New())
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindPermissionIdsByNamesTx", noTx, request.Permissions).Return([]int64{1}, nil)
+
+		_, err := svc.Create(allowAll, request)
+
+		a.ErrorAs(err, &common.NotFoundError{})
+		a.True(repo.AssertNotCalled(t, "SaveTx", noTx, mock.Anything))
+	})
+
+	t.Run("should reject permissions the caller does not have", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, validator.New())
+
+		_, err := svc.Create(grantedPermissions{"employees:read", "api_keys:write"}, request)
+
+		var denied common.PermissionDeniedError
+		a.ErrorAs(err, &denied)
+		a.Equal([]string{"employees:write"}, denied.Permissions)
+		a.True(repo.AssertNotCalled(t, "BeginTransaction"))
+	})
+
+	t.Run("should return validation error", func(t *testing.T) {
+		var svc = NewService(new(MockRepo), validator.New())
+
+		_, err := svc.Create(allowAll, CreateRequest{Name: "Ключ", ServiceAccount: "hr sync", Permissions: []string{"employees"}})
+
+		a.ErrorAs(err, &common.RequestValidationError{})
+	})
+}
+
+func TestServiceVerify(t *testing.T) {
+	var a = assert.New(t)
+	key, saved := created(t)
+	saved.Permissions = []string{"employees:read"}
+
+	t.Run("should accept valid key", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, validator.New())
+		repo.On("FindByKeyId", saved.KeyId).Return(saved, nil)
+		repo.On("TouchLastUsed", int64(7)).Return(nil)
+
+		principal, err := svc.VerifyApiKey(key)
+
+		a.Nil(err)
+		a.Equal(auth.ApiKeyPrincipal{KeyId: saved.KeyId, ServiceAccount: "hr-sync", Permissions: []string{"employees:read"}}, principal)
+		a.True(repo.AssertCalled(t, "TouchLastUsed", int64(7)))
+	})
+
+	t.Run("should reject wrong secret", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, validator.New())
+		repo.On("FindByKeyId", saved.KeyId).Return(saved, nil)
+
+		_, err := svc.VerifyApiKey(keyPrefix + saved.KeyId + "_wrong")
+
+		a.ErrorIs(err, auth.ErrInvalidApiKey)
+		a.True(repo.AssertNotCalled(t, "TouchLastUsed", int64(7)))
+	})
+
+	t.Run("should reject revoked key", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, validator.New())
+		revoked := saved
+		revokedAt := time.Now()
+		revoked.RevokedAt = &revokedAt
+		repo.On("FindByKeyId", saved.KeyId).Return(revoked, nil)
+
+		_, err := svc.VerifyApiKey(key)
+
+		a.ErrorIs(err, auth.ErrInvalidApiKey)
+	})
+
+	t.Run("should reject unknown or malformed key", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, validator.New())
+		repo.On("FindByKeyId", "0000").Return(Entity{}, sql.ErrNoRows)
+
+		_, err := svc.VerifyApiKey(keyPrefix + "0000_secret")
+		a.ErrorIs(err, auth.ErrInvalidApiKey)
+		_, err = svc.VerifyApiKey("not-a-key")
+		a.ErrorIs(err, auth.ErrInvalidApiKey)
+	})
+}
+
+func TestServiceRevoke(t *testing.T) {
+	var a = assert.New(t)
+
+	t.Run("should return not found", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, validator.New())
+		repo.On("Revoke", int64(9)).Return(sql.ErrNoRows)
+
+		err := svc.Revoke(9)
+
+		a.ErrorAs(err, &common.NotFoundError{})
+	})
+}
@@ -0,0 +1,62 @@
+package audit
+
+import (
+	"errors"
+	"github.com/gofiber/fiber"
+	"idm/inner/common"
+	"idm/inner/web"
+)
+
+type Controller struct {
+	server       *web.Server
+	auditService Svc
+}
+
+// интерфейс сервиса audit.Service
+type Svc interface {
+	Find(request FindRequest) ([]Response, error)
+}
+
+func NewController(server *web.Server, auditService Svc) *Controller {
+	return &Controller{
+		server:       server,
+		auditService: auditService,
+	}
+}
+
+// функция для регистрации маршрутов
+func (c *Controller) RegisterRoutes() {
+	// полный путь будет "/api/v1/audit"
+	c.server.GroupApiV1.Get("/audit", c.server.Require("audit:read"), c.Find)
+}
+
+// функция-хендлер для GET запроса по маршруту "/api/v1/audit"
+func (c *Controller) Find(ctx *fiber.Ctx) {
+	var request FindRequest
+	if err := ctx.QueryParser(&request); err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	records, err := c.auditService.Find(request)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, records)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning audit records")
+		return
+	}
+}
+
+// errResponse сопоставляет ошибку сервиса с кодом ответа: 400 — ошибки валидации, 500 — всё остальное
+func errResponse(ctx *fiber.Ctx, err error) {
+	switch {
+	case errors.As(err, &common.RequestValidationError{}):
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+	default:
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,68 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gofiber/fiber"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/common"
+	"idm/inner/web"
+	"net/http/httptest"
+	"testing"
+)
+
+type MockService struct {
+	mock.Mock
+}
+
+func (m *MockService) Find(request FindRequest) ([]Response, error) {
+	args := m.Called(request)
+	return args.Get(0).([]Response), args.Error(1)
+}
+
+func TestController(t *testing.T) {
+	mockService := new(MockService)
+	server := web.NewServer()
+	controller := NewController(server, mockService)
+	controller.RegisterRoutes()
+
+	t.Run("FindSuccess", func(t *testing.T) {
+		records := []Response{{Id: 1, Actor: "42", Action: ActionUpdate, EntityType: EntityRole, EntityId: 3}}
+		mockService.On("Find", FindRequest{EntityType: EntityRole, EntityId: 3, Limit: 10}).Return(records, nil)
+
+		req := httptest.NewRequest(fiber.MethodGet, "/api/v1/audit?entity_type=role&entity_id=3&limit=10", nil)
+		resp, err := server.App.Test(req)
+		assert.NoError(t, err)
+
+		var response common.Response[[]Response]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, records, response.Data)
+	})
+
+	t.Run("FindValidationError", func(t *testing.T) {
+		mockService.On("Find", FindRequest{EntityType: "client"}).
+			Return([]Response{}, common.RequestValidationError{FieldErrors: map[string]string{"EntityType": "oneof"}})
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/audit?entity_type=client", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("FindInvalidQuery", func(t *testing.T) {
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/audit?entity_id=abc", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("FindServiceError", func(t *testing.T) {
+		mockService.On("Find", FindRequest{Actor: "broken"}).Return([]Response{}, errors.New("database is down"))
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/audit?actor=broken", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusInternalServerError, resp.StatusCode)
+	})
+}
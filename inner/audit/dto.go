@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"encoding/json"
+	"idm/inner/common"
+	"time"
+)
+
+// типы сущностей, изменения которых попадают в журнал
+const (
+	EntityEmployee   = "employee"
+	EntityRole       = "role"
+	EntityPermission = "permission"
+)
+
+// действия над сущностями
+const (
+	ActionCreate     = "create"
+	ActionUpdate     = "update"
+	ActionDelete     = "delete"
+	ActionRestore    = "restore"
+	ActionPurge      = "purge"
+	ActionAddRole    = "add_role"
+	ActionRemoveRole = "remove_role"
+	ActionSetParents = "set_parents"
+	// ActionChangeStatus переход сотрудника в другое состояние жизненного цикла
+	ActionChangeStatus = "change_status"
+	// ActionGrantToRole и ActionRevokeFromRole выдача права роли и его отзыв
+	ActionGrantToRole    = "grant_to_role"
+	ActionRevokeFromRole = "revoke_from_role"
+)
+
+// Actor кто и в рамках какого запроса выполняет изменение. Caller — права вызывающего для сервисов,
+// которые выдают права другим; nil у изменений от имени самого сервиса (синхронизация, командная строка)
+type Actor struct {
+	Subject   string
+	RequestId string
+	Caller    common.Caller
+}
+
+// Record изменение одной сущности; Before и After сериализуются в JSON,
+// nil — состояния нет (до создания или после удаления)
+type Record struct {
+	Action     string
+	EntityType string
+	EntityId   int64
+	Before     any
+	After      any
+}
+
+type Entity struct {
+	Id         int64            `db:"id"`
+	Actor      string           `db:"actor"`
+	Action     string           `db:"action"`
+	EntityType string           `db:"entity_type"`
+	EntityId   int64            `db:"entity_id"`
+	Before     *json.RawMessage `db:"before"`
+	After      *json.RawMessage `db:"after"`
+	RequestId  string           `db:"request_id"`
+	CreatedAt  time.Time        `db:"created_at"`
+}
+
+func (e *Entity) toResponse() Response {
+	return Response{
+		Id:         e.Id,
+		Actor:      e.Actor,
+		Action:     e.Action,
+		EntityType: e.EntityType,
+		EntityId:   e.EntityId,
+		Before:     e.Before,
+		After:      e.After,
+		RequestId:  e.RequestId,
+		CreatedAt:  e.CreatedAt,
+	}
+}
+
+func toSliceResponse(e []Entity) []Response {
+	responses := make([]Response, len(e))
+	for i := range e {
+		responses[i] = e[i].toResponse()
+	}
+	return responses
+}
+
+type Response struct {
+	Id         int64            `json:"id"`
+	Actor      string           `json:"actor"`
+	Action     string           `json:"action"`
+	EntityType string           `json:"entity_type"`
+	EntityId   int64            `json:"entity_id"`
+	Before     *json.RawMessage `json:"before"`
+	After      *json.RawMessage `json:"after"`
+	RequestId  string           `json:"request_id"`
+	CreatedAt  time.Time        `json:"created_at"`
+}
+
+// FindRequest фильтр журнала из query-параметров; время в формате RFC 3339, границы включительно
+type FindRequest struct {
+	EntityType string `query:"entity_type" validate:"omitempty,oneof=employee role permission"`
+	EntityId   int64  `query:"entity_id" validate:"omitempty,min=1"`
+	Actor      string `query:"actor" validate:"omitempty,max=255"`
+	From       string `query:"from" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	To         string `query:"to" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	Limit      int    `query:"limit" validate:"omitempty,min=1,max=1000"`
+}
+
+// Filter разобранный FindRequest для репозитория; пустые поля не ограничивают выборку
+type Filter struct {
+	EntityType string
+	EntityId   int64
+	Actor      string
+	From       *time.Time
+	To         *time.Time
+	Limit      int
+}
@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"strings"
+)
+
+type Repository struct {
+	db *sqlx.DB
+}
+
+func NewAuditRepository(dataBase *sqlx.DB) *Repository {
+	return &Repository{db: dataBase}
+}
+
+// SaveTx запись в журнал в транзакции изменения: откат изменения откатывает и запись
+func (repo *Repository) SaveTx(tx *sqlx.Tx, entity Entity) error {
+	_, err := tx.Exec(
+		`insert into audit_log (actor, action, entity_type, entity_id, before, after, request_id)
+		values ($1, $2, $3, $4, $5, $6, $7)`,
+		entity.Actor, entity.Action, entity.EntityType, entity.EntityId,
+		jsonb(entity.Before), jsonb(entity.After), entity.RequestId,
+	)
+	return err
+}
+
+// Find записи журнала по фильтру, новые — первыми
+func (repo *Repository) Find(filter Filter) (listEntity []Entity, err error) {
+	var conditions []string
+	var args []any
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.EntityType != "" {
+		add("entity_type = $%d", filter.EntityType)
+	}
+	if filter.EntityId > 0 {
+		add("entity_id = $%d", filter.EntityId)
+	}
+	if filter.Actor != "" {
+		add("actor = $%d", filter.Actor)
+	}
+	if filter.From != nil {
+		add("created_at >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		add("created_at <= $%d", *filter.To)
+	}
+	query := "select * from audit_log"
+	if len(conditions) > 0 {
+		query += " where " + strings.Join(conditions, " and ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(" order by created_at desc, id desc limit $%d", len(args))
+
+	listEntity = []Entity{}
+	err = repo.db.Select(&listEntity, query, args...)
+	return listEntity, err
+}
+
+// jsonb JSON передаётся строкой: []byte драйвер отправил бы как bytea
+func jsonb(raw *json.RawMessage) sql.NullString {
+	if raw == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(*raw), Valid: true}
+}
@@ -0,0 +1,125 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber"
+	"github.com/jmoiron/sqlx"
+	"idm/inner/auth"
+	"idm/inner/common"
+	"idm/inner/web"
+)
+
+// DefaultLimit количество записей журнала в ответе, если limit не задан
+const DefaultLimit = 100
+
+// anonymous субъект изменений, сделанных без аутентификации
+const anonymous = "anonymous"
+
+type Service struct {
+	repo      Repo
+	validator Validator
+}
+
+func NewService(repo Repo, validator Validator) *Service {
+	return &Service{
+		repo:      repo,
+		validator: validator,
+	}
+}
+
+type Validator interface {
+	Validate(request any) error
+}
+
+type Repo interface {
+	SaveTx(tx *sqlx.Tx, entity Entity) error
+	Find(filter Filter) (listEntity []Entity, err error)
+}
+
+// ActorFrom автор изменения из аутентифицированного запроса вместе с его правами
+func ActorFrom(server *web.Server, ctx *fiber.Ctx) Actor {
+	subject := auth.Subject(ctx)
+	if subject == "" {
+		subject = anonymous
+	}
+	return Actor{Subject: subject, RequestId: web.RequestId(ctx), Caller: server.Caller(ctx)}
+}
+
+// RecordTx записывает изменение в журнал; вызывается сервисами в транзакции самого изменения
+func (service *Service) RecordTx(tx *sqlx.Tx, actor Actor, record Record) error {
+	before, err := marshal(record.Before)
+	if err != nil {
+		return fmt.Errorf("error serializing %s %d before %s: %w", record.EntityType, record.EntityId, record.Action, err)
+	}
+	after, err := marshal(record.After)
+	if err != nil {
+		return fmt.Errorf("error serializing %s %d after %s: %w", record.EntityType, record.EntityId, record.Action, err)
+	}
+	entity := Entity{
+		Actor:      actor.Subject,
+		Action:     record.Action,
+		EntityType: record.EntityType,
+		EntityId:   record.EntityId,
+		Before:     before,
+		After:      after,
+		RequestId:  actor.RequestId,
+	}
+	if err = service.repo.SaveTx(tx, entity); err != nil {
+		return fmt.Errorf("error saving audit record of %s %d: %w", record.EntityType, record.EntityId, err)
+	}
+	return nil
+}
+
+// Recorder получатель изменений в транзакции самого изменения; реализуется Service
+type Recorder interface {
+	RecordTx(tx *sqlx.Tx, actor Actor, record Record) error
+}
+
+// Recorders передаёт изменение всем получателям по очереди: журналу аудита и тем, кому изменения
+// нужны в той же транзакции, например очереди исходящей синхронизации. Ошибка любого получателя
+// откатывает изменение целиком
+type Recorders []Recorder
+
+func (recorders Recorders) RecordTx(tx *sqlx.Tx, actor Actor, record Record) error {
+	for _, recorder := range recorders {
+		if err := recorder.RecordTx(tx, actor, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (service *Service) Find(request FindRequest) ([]Response, error) {
+	if err := service.validator.Validate(request); err != nil {
+		return []Response{}, err
+	}
+	filter := Filter{
+		EntityType: request.EntityType,
+		EntityId:   request.EntityId,
+		Actor:      request.Actor,
+		From:       common.ParseTime(request.From),
+		To:         common.ParseTime(request.To),
+		Limit:      request.Limit,
+	}
+	if filter.Limit == 0 {
+		filter.Limit = DefaultLimit
+	}
+	entities, err := service.repo.Find(filter)
+	if err != nil {
+		return []Response{}, fmt.Errorf("error finding audit records: %w", err)
+	}
+	return toSliceResponse(entities), nil
+}
+
+func marshal(state any) (*json.RawMessage, error) {
+	if state == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	raw := json.RawMessage(data)
+	return &raw, nil
+}
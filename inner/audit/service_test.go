@@ -0,0 +1,155 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/common"
+	"idm/inner/validator"
+	"testing"
+	"time"
+)
+
+type MockRepo struct {
+	mock.Mock
+}
+
+func (m *MockRepo) SaveTx(tx *sqlx.Tx, entity Entity) error {
+	args := m.Called(tx, entity)
+	return args.Error(0)
+}
+
+func (m *MockRepo) Find(filter Filter) ([]Entity, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]Entity), args.Error(1)
+}
+
+var noTx *sqlx.Tx
+
+func rawJson(value string) *json.RawMessage {
+	raw := json.RawMessage(value)
+	return &raw
+}
+
+func TestServiceRecordTx(t *testing.T) {
+	var a = assert.New(t)
+	var actor = Actor{Subject: "42", RequestId: "request-1"}
+
+	t.Run("should serialize states", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, validator.New())
+		var before = struct {
+			Name string `json:"name"`
+		}{Name: "John Doe"}
+
+		repo.On("SaveTx", noTx, Entity{
+			Actor:      "42",
+			Action:     ActionDelete,
+			EntityType: EntityEmployee,
+			EntityId:   1,
+			Before:     rawJson(`{"name":"John Doe"}`),
+			RequestId:  "request-1",
+		}).Return(nil)
+		var err = svc.RecordTx(noTx, actor, Record{
+			Action:     ActionDelete,
+			EntityType: EntityEmployee,
+			EntityId:   1,
+			Before:     before,
+		})
+
+		a.Nil(err)
+		a.True(repo.AssertNumberOfCalls(t, "SaveTx", 1))
+	})
+
+	t.Run("should return error when record is not saved", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, validator.New())
+
+		repo.On("SaveTx", noTx, mock.Anything).Return(errors.New("connection lost"))
+		var err = svc.RecordTx(noTx, actor, Record{Action: ActionCreate, EntityType: EntityRole, EntityId: 3})
+
+		a.Error(err)
+		a.Contains(err.Error(), "error saving audit record of role 3")
+	})
+
+	t.Run("should return error on unserializable state", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, validator.New())
+
+		var err = svc.RecordTx(noTx, actor, Record{Action: ActionUpdate, EntityType: EntityRole, After: func() {}})
+
+		a.Error(err)
+		a.True(repo.AssertNotCalled(t, "SaveTx", noTx, mock.Anything))
+	})
+}
+
+func TestServiceFind(t *testing.T) {
+	var a = assert.New(t)
+
+	t.Run("should apply filter and default limit", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, validator.New())
+		var from = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		var entities = []Entity{{Id: 1, Actor: "42", Action: ActionCreate, EntityType: EntityEmployee, EntityId: 5}}
+
+		repo.On("Find", Filter{EntityType: EntityEmployee, EntityId: 5, From: &from, Limit: DefaultLimit}).
+			Return(entities, nil)
+		var got, err = svc.Find(FindRequest{EntityType: EntityEmployee, EntityId: 5, From: "2025-01-01T00:00:00Z"})
+
+		a.Nil(err)
+		a.Equal(toSliceResponse(entities), got)
+	})
+
+	t.Run("should return validation error on unknown entity type", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, validator.New())
+
+		var _, err = svc.Find(FindRequest{EntityType: "client"})
+
+		a.ErrorAs(err, &common.RequestValidationError{})
+		a.True(repo.AssertNotCalled(t, "Find", mock.Anything))
+	})
+
+	t.Run("should return validation error on malformed time", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, validator.New())
+
+		var _, err = svc.Find(FindRequest{To: "yesterday"})
+
+		a.ErrorAs(err, &common.RequestValidationError{})
+	})
+}
+
+type recorderFunc func(tx *sqlx.Tx, actor Actor, record Record) error
+
+func (f recorderFunc) RecordTx(tx *sqlx.Tx, actor Actor, record Record) error {
+	return f(tx, actor, record)
+}
+
+func TestRecorders(t *testing.T) {
+	var a = assert.New(t)
+	var record = Record{Action: ActionCreate, EntityType: EntityEmployee, EntityId: 1}
+
+	t.Run("should pass record to every recorder", func(t *testing.T) {
+		var calls int
+		var recorder = recorderFunc(func(tx *sqlx.Tx, actor Actor, got Record) error {
+			calls++
+			a.Equal(record, got)
+			return nil
+		})
+
+		a.Nil(Recorders{recorder, recorder}.RecordTx(nil, Actor{}, record))
+		a.Equal(2, calls)
+	})
+
+	t.Run("should stop at first error", func(t *testing.T) {
+		var calls int
+		var failing = recorderFunc(func(*sqlx.Tx, Actor, Record) error { return errors.New("queue is down") })
+		var counting = recorderFunc(func(*sqlx.Tx, Actor, Record) error { calls++; return nil })
+
+		a.EqualError(Recorders{failing, counting}.RecordTx(nil, Actor{}, record), "queue is down")
+		a.Equal(0, calls)
+	})
+}
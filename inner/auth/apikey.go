@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"errors"
+	"github.com/gofiber/fiber"
+	"idm/inner/common"
+	"strings"
+)
+
+// ApiKeySubjectPrefix префикс субъекта запросов с API-ключом; за ним следует идентификатор ключа
+const ApiKeySubjectPrefix = "apikey:"
+
+// ApiKeyPermissionsKey ключ, под которым права API-ключа сохраняются в fiber.Ctx
+const ApiKeyPermissionsKey = "auth.apikey.permissions"
+
+// ErrInvalidApiKey ключ не найден, отозван или секрет не совпал
+var ErrInvalidApiKey = errors.New("api key is invalid")
+
+// ApiKeyPrincipal владелец проверенного API-ключа
+type ApiKeyPrincipal struct {
+	KeyId          string
+	ServiceAccount string
+	Permissions    []string
+}
+
+// ApiKeyVerifier проверка API-ключей, реализуется apikey.Service
+type ApiKeyVerifier interface {
+	VerifyApiKey(key string) (ApiKeyPrincipal, error)
+}
+
+// ApiKeyPermissions права API-ключа аутентифицированного запроса; nil для запросов с токеном
+func ApiKeyPermissions(ctx *fiber.Ctx) []string {
+	permissions, _ := ctx.Locals(ApiKeyPermissionsKey).([]string)
+	return permissions
+}
+
+// authenticateApiKey аналог проверки токена для заголовка Authorization: ApiKey
+func (a *Authenticator) authenticateApiKey(ctx *fiber.Ctx, key string) {
+	principal, err := a.apiKeys.VerifyApiKey(key)
+	if errors.Is(err, ErrInvalidApiKey) {
+		ctx.Set(fiber.HeaderWWWAuthenticate, `ApiKey realm="idm"`)
+		_ = common.ErrResponse(ctx, fiber.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error checking api key")
+		return
+	}
+	ctx.Locals(SubjectKey, ApiKeySubjectPrefix+principal.KeyId)
+	ctx.Locals(ApiKeyPermissionsKey, principal.Permissions)
+	ctx.Next()
+}
+
+func apiKey(header string) (string, bool) {
+	scheme, key, found := strings.Cut(strings.TrimSpace(header), " ")
+	if !found || !strings.EqualFold(scheme, "ApiKey") {
+		return "", false
+	}
+	key = strings.TrimSpace(key)
+	return key, key != ""
+}
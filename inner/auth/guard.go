@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"github.com/gofiber/fiber"
+	"idm/inner/common"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ClientSubjectPrefix префикс субъекта токенов сервисных клиентов; субъект токена сотрудника — его id
+const ClientSubjectPrefix = "client:"
+
+// PermissionChecker проверка прав по ролям вызывающего, реализуется authz.Service
+type PermissionChecker interface {
+	EmployeeHasPermission(employeeId int64, permission string) (bool, error)
+	ClientHasPermission(clientId string, permission string) (bool, error)
+	RolesHavePermission(roleNames []string, permission string) (bool, error)
+}
+
+// Guard проверяет права вызывающего на маршрутах, объявленных через web.Server.Require.
+// Работает после Authenticator: субъект берётся из токена
+type Guard struct {
+	checker PermissionChecker
+}
+
+func NewGuard(checker PermissionChecker) *Guard {
+	return &Guard{checker: checker}
+}
+
+// Authorize пропускает запрос дальше, если у вызывающего есть право, иначе отвечает 403
+func (g *Guard) Authorize(ctx *fiber.Ctx, permission string) {
+	if Subject(ctx) == "" {
+		unauthorized(ctx, "missing bearer token")
+		return
+	}
+	allowed, err := g.HasPermission(ctx, permission)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error checking permissions")
+		return
+	}
+	if !allowed {
+		_ = common.ErrResponse(ctx, fiber.StatusForbidden, "permission "+permission+" is required")
+		return
+	}
+	ctx.Next()
+}
+
+// HasPermission есть ли право у вызывающего; без ответа на запрос, поэтому подходит и для проверок
+// внутри обработчика, например прав, которые вызывающий выдаёт API-ключу
+func (g *Guard) HasPermission(ctx *fiber.Ctx, permission string) (bool, error) {
+	subject := Subject(ctx)
+	if strings.HasPrefix(subject, ApiKeySubjectPrefix) {
+		// права API-ключа заданы при его создании и проверены при аутентификации
+		return slices.Contains(ApiKeyPermissions(ctx), permission), nil
+	}
+	if subject == "" {
+		return false, nil
+	}
+	if !Issued(ctx) {
+		// субъект внешнего провайдера с сотрудниками и клиентами idm не связан, даже если совпадает
+		// с их идентификатором: права берутся только из названий ролей в claim roles
+		return g.checker.RolesHavePermission(claimRoles(ctx), permission)
+	}
+	if clientId, ok := strings.CutPrefix(subject, ClientSubjectPrefix); ok {
+		return g.checker.ClientHasPermission(clientId, permission)
+	}
+	if employeeId, err := strconv.ParseInt(subject, 10, 64); err == nil && employeeId > 0 {
+		return g.checker.EmployeeHasPermission(employeeId, permission)
+	}
+	return false, nil
+}
+
+// claimRoles названия ролей из claim roles: массив строк или одна строка
+func claimRoles(ctx *fiber.Ctx) []string {
+	switch value := Claims(ctx)["roles"].(type) {
+	case string:
+		return []string{value}
+	case []any:
+		roles := make([]string, 0, len(value))
+		for _, item := range value {
+			if name, ok := item.(string); ok && name != "" {
+				roles = append(roles, name)
+			}
+		}
+		return roles
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"github.com/gofiber/fiber"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/common"
+	"idm/inner/web"
+	"testing"
+)
+
+type MockChecker struct {
+	mock.Mock
+}
+
+func (m *MockChecker) EmployeeHasPermission(employeeId int64, permission string) (bool, error) {
+	args := m.Called(employeeId, permission)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockChecker) ClientHasPermission(clientId string, permission string) (bool, error) {
+	args := m.Called(clientId, permission)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockChecker) RolesHavePermission(roleNames []string, permission string) (bool, error) {
+	args := m.Called(roleNames, permission)
+	return args.Bool(0), args.Error(1)
+}
+
+func TestGuard(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	provider := staticProvider{"issued-1": &privateKey.PublicKey}
+	var newServer = func(checker PermissionChecker) *web.Server {
+		server := newTestServer(t, hsConfig, provider, nil)
+		server.Authorizer = NewGuard(checker)
+		server.GroupApiV1.Get("/guarded", server.Require("employees:read"), func(ctx *fiber.Ctx) {
+			_ = common.OkResponse(ctx, "ok")
+		})
+		return server
+	}
+	// newGuardedServer запросы с токеном, выданным самим сервисом
+	var newGuardedServer = func(checker PermissionChecker) func(string) (int, common.Response[string]) {
+		server := newServer(checker)
+		return func(subject string) (int, common.Response[string]) {
+			claims := validClaims()
+			claims["sub"] = subject
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+			token.Header["kid"] = "issued-1"
+			signed, err := token.SignedString(privateKey)
+			assert.NoError(t, err)
+			return doRequestTo(t, server, "/api/v1/guarded", signed)
+		}
+	}
+	// newExternalServer запросы с токеном внешнего провайдера
+	var newExternalServer = func(checker PermissionChecker) func(jwt.MapClaims) (int, common.Response[string]) {
+		server := newServer(checker)
+		return func(claims jwt.MapClaims) (int, common.Response[string]) {
+			return doRequestTo(t, server, "/api/v1/guarded", signHs(t, claims, testSecret))
+		}
+	}
+
+	t.Run("AllowEmployee", func(t *testing.T) {
+		checker := new(MockChecker)
+		checker.On("EmployeeHasPermission", int64(42), "employees:read").Return(true, nil)
+
+		code, response := newGuardedServer(checker)("42")
+
+		assert.Equal(t, fiber.StatusOK, code)
+		assert.Equal(t, "ok", response.Data)
+	})
+
+	t.Run("DenyEmployee", func(t *testing.T) {
+		checker := new(MockChecker)
+		checker.On("EmployeeHasPermission", int64(42), "employees:read").Return(false, nil)
+
+		code, response := newGuardedServer(checker)("42")
+
+		assert.Equal(t, fiber.StatusForbidden, code)
+		assert.False(t, response.Success)
+		assert.Equal(t, "permission employees:read is required", response.Message)
+	})
+
+	t.Run("CheckClient", func(t *testing.T) {
+		checker := new(MockChecker)
+		checker.On("ClientHasPermission", "billing", "employees:read").Return(true, nil)
+
+		code, _ := newGuardedServer(checker)(ClientSubjectPrefix + "billing")
+
+		assert.Equal(t, fiber.StatusOK, code)
+	})
+
+	t.Run("ExternalTokenUsesRolesClaim", func(t *testing.T) {
+		checker := new(MockChecker)
+		checker.On("RolesHavePermission", []string{"Разработчик"}, "employees:read").Return(true, nil)
+		claims := validClaims()
+		claims["roles"] = []string{"Разработчик"}
+
+		code, _ := newExternalServer(checker)(claims)
+
+		assert.Equal(t, fiber.StatusOK, code)
+	})
+
+	t.Run("ExternalTokenDoesNotImpersonateEmployee", func(t *testing.T) {
+		checker := new(MockChecker)
+		checker.On("RolesHavePermission", []string(nil), "employees:read").Return(false, nil)
+
+		code, _ := newExternalServer(checker)(validClaims())
+
+		assert.Equal(t, fiber.StatusForbidden, code)
+		checker.AssertNotCalled(t, "EmployeeHasPermission", mock.Anything, mock.Anything)
+	})
+
+	t.Run("ExternalTokenDoesNotImpersonateClient", func(t *testing.T) {
+		checker := new(MockChecker)
+		checker.On("RolesHavePermission", []string(nil), "employees:read").Return(false, nil)
+		claims := validClaims()
+		claims["sub"] = ClientSubjectPrefix + "billing"
+
+		code, _ := newExternalServer(checker)(claims)
+
+		assert.Equal(t, fiber.StatusForbidden, code)
+		checker.AssertNotCalled(t, "ClientHasPermission", mock.Anything, mock.Anything)
+	})
+
+	t.Run("DenyUnknownSubject", func(t *testing.T) {
+		checker := new(MockChecker)
+
+		code, _ := newGuardedServer(checker)("alice@example.com")
+
+		assert.Equal(t, fiber.StatusForbidden, code)
+		checker.AssertNotCalled(t, "EmployeeHasPermission", mock.Anything, mock.Anything)
+	})
+
+	t.Run("CheckerError", func(t *testing.T) {
+		checker := new(MockChecker)
+		checker.On("EmployeeHasPermission", int64(42), "employees:read").Return(false, errors.New("db down"))
+
+		code, _ := newGuardedServer(checker)("42")
+
+		assert.Equal(t, fiber.StatusInternalServerError, code)
+	})
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"idm/inner/common"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// KeySet ключи проверки подписи токенов.
+// Для HS256 это общий секрет, для RS256 — открытые ключи из PEM- или JWKS-файла.
+// Дополнительно принимаются RS256-токены, выданные самим сервисом (см. KeyProvider)
+type KeySet struct {
+	algorithm string
+	secret    []byte
+	// ключи из JWKS по kid; ключ из PEM-файла хранится под пустым kid
+	keys     map[string]*rsa.PublicKey
+	provider KeyProvider
+}
+
+// KeyProvider источник открытых ключей токенов, выданных самим сервисом
+type KeyProvider interface {
+	PublicKey(kid string) (*rsa.PublicKey, bool)
+}
+
+// LoadKeys загружает ключи согласно конфигурации
+func LoadKeys(cfg common.Config) (*KeySet, error) {
+	switch cfg.JwtAlgorithm {
+	case jwt.SigningMethodHS256.Alg():
+		return &KeySet{algorithm: cfg.JwtAlgorithm, secret: []byte(cfg.JwtSecret)}, nil
+	case jwt.SigningMethodRS256.Alg():
+		if cfg.JwtKeyFile == "" {
+			return &KeySet{algorithm: cfg.JwtAlgorithm, keys: map[string]*rsa.PublicKey{}}, nil
+		}
+		data, err := os.ReadFile(cfg.JwtKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading key file %s: %w", cfg.JwtKeyFile, err)
+		}
+		keys, err := parseKeys(data)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing key file %s: %w", cfg.JwtKeyFile, err)
+		}
+		return &KeySet{algorithm: cfg.JwtAlgorithm, keys: keys}, nil
+	default:
+		return nil, fmt.Errorf("unsupported jwt algorithm: %s", cfg.JwtAlgorithm)
+	}
+}
+
+// keyFunc выбирает ключ проверки подписи по алгоритму и kid из заголовка токена
+func (k *KeySet) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if token.Method.Alg() == jwt.SigningMethodHS256.Alg() {
+		if k.secret == nil {
+			return nil, errors.New("HS256 tokens are not accepted")
+		}
+		return k.secret, nil
+	}
+	// токены самого сервиса узнаются по kid; PEM-ключ без kid иначе перехватил бы и их
+	if k.provider != nil {
+		if key, ok := k.provider.PublicKey(kid); ok {
+			return key, nil
+		}
+	}
+	if key, ok := k.keys[kid]; ok {
+		return key, nil
+	}
+	// PEM-файл содержит единственный ключ без kid — подходит для любого другого токена
+	if key, ok := k.keys[""]; ok && len(k.keys) == 1 {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// issued токен подписан ключом самого сервиса: keyFunc ищет такие ключи первыми,
+// поэтому известный провайдеру kid означает, что подпись проверена его ключом
+func (k *KeySet) issued(token *jwt.Token) bool {
+	if k.provider == nil || token.Method.Alg() != jwt.SigningMethodRS256.Alg() {
+		return false
+	}
+	kid, _ := token.Header["kid"].(string)
+	_, ok := k.provider.PublicKey(kid)
+	return ok
+}
+
+// parseKeys разбирает содержимое файла ключей: JWKS (JSON) или PEM
+func parseKeys(data []byte) (map[string]*rsa.PublicKey, error) {
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		return parseJwks(data)
+	}
+	key, err := parsePem(data)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]*rsa.PublicKey{"": key}, nil
+}
+
+// parsePem открытый ключ RSA из PEM: PUBLIC KEY, RSA PUBLIC KEY или CERTIFICATE
+func parsePem(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("public key is not an RSA key")
+		}
+		return rsaKey, nil
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		rsaKey, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("certificate key is not an RSA key")
+		}
+		return rsaKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// parseJwks RSA-ключи из JWKS; ключи других типов и ключи шифрования пропускаются
+func parseJwks(data []byte) (map[string]*rsa.PublicKey, error) {
+	var set jwks
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, key := range set.Keys {
+		if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: invalid modulus: %w", key.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: invalid exponent: %w", key.Kid, err)
+		}
+		keys[key.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no RSA signing keys in JWKS")
+	}
+	return keys, nil
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"idm/inner/common"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeJwks сохраняет открытые ключи во временный JWKS-файл и возвращает путь к нему
+func writeJwks(t *testing.T, keys map[string]*rsa.PublicKey) string {
+	set := jwks{}
+	for kid, key := range keys {
+		set.Keys = append(set.Keys, jwk{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	data, err := json.Marshal(set)
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(path, data, 0600))
+	return path
+}
+
+func writePem(t *testing.T, blockType string, der []byte) string {
+	path := filepath.Join(t.TempDir(), "key.pem")
+	assert.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600))
+	return path
+}
+
+func TestLoadKeys(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	publicKey := &privateKey.PublicKey
+	pkix, err := x509.MarshalPKIXPublicKey(publicKey)
+	assert.NoError(t, err)
+	token := &jwt.Token{Method: jwt.SigningMethodRS256, Header: map[string]any{"kid": "any"}}
+
+	t.Run("PKIX PEM", func(t *testing.T) {
+		keys, err := LoadKeys(common.Config{JwtAlgorithm: "RS256", JwtKeyFile: writePem(t, "PUBLIC KEY", pkix)})
+
+		assert.NoError(t, err)
+		key, err := keys.keyFunc(token)
+		assert.NoError(t, err)
+		assert.Equal(t, publicKey, key)
+	})
+
+	t.Run("PKCS1 PEM", func(t *testing.T) {
+		der := x509.MarshalPKCS1PublicKey(publicKey)
+		keys, err := LoadKeys(common.Config{JwtAlgorithm: "RS256", JwtKeyFile: writePem(t, "RSA PUBLIC KEY", der)})
+
+		assert.NoError(t, err)
+		key, err := keys.keyFunc(token)
+		assert.NoError(t, err)
+		assert.Equal(t, publicKey, key)
+	})
+
+	t.Run("JWKS selects key by kid", func(t *testing.T) {
+		otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		assert.NoError(t, err)
+		path := writeJwks(t, map[string]*rsa.PublicKey{"old": &otherKey.PublicKey, "new": publicKey})
+
+		keys, err := LoadKeys(common.Config{JwtAlgorithm: "RS256", JwtKeyFile: path})
+
+		assert.NoError(t, err)
+		key, err := keys.keyFunc(&jwt.Token{Method: jwt.SigningMethodRS256, Header: map[string]any{"kid": "new"}})
+		assert.NoError(t, err)
+		assert.Equal(t, publicKey, key)
+		_, err = keys.keyFunc(token)
+		assert.Error(t, err)
+	})
+
+	t.Run("JWKS without RSA keys", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "jwks.json")
+		assert.NoError(t, os.WriteFile(path, []byte(`{"keys":[{"kty":"EC","kid":"ec"}]}`), 0600))
+
+		_, err := LoadKeys(common.Config{JwtAlgorithm: "RS256", JwtKeyFile: path})
+
+		assert.Error(t, err)
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		_, err := LoadKeys(common.Config{JwtAlgorithm: "RS256", JwtKeyFile: filepath.Join(t.TempDir(), "none.pem")})
+
+		assert.Error(t, err)
+	})
+
+	t.Run("Not a PEM", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "key.pem")
+		assert.NoError(t, os.WriteFile(path, []byte("garbage"), 0600))
+
+		_, err := LoadKeys(common.Config{JwtAlgorithm: "RS256", JwtKeyFile: path})
+
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"errors"
+	"github.com/gofiber/fiber"
+	"github.com/golang-jwt/jwt/v5"
+	"idm/inner/common"
+	"strings"
+)
+
+// ключи, под которыми данные токена сохраняются в fiber.Ctx
+const (
+	SubjectKey = "auth.subject"
+	ClaimsKey  = "auth.claims"
+	IssuedKey  = "auth.issued"
+)
+
+// Authenticator проверяет bearer-токены и API-ключи входящих запросов
+type Authenticator struct {
+	keys    *KeySet
+	parser  *jwt.Parser
+	apiKeys ApiKeyVerifier
+}
+
+// NewAuthenticator provider — ключи токенов, выданных самим сервисом; nil, если сервис токены не выдаёт.
+// apiKeys — проверка заголовка Authorization: ApiKey; nil, если API-ключи не принимаются
+func NewAuthenticator(cfg common.Config, provider KeyProvider, apiKeys ApiKeyVerifier) (*Authenticator, error) {
+	keys, err := LoadKeys(cfg)
+	if err != nil {
+		return nil, err
+	}
+	methods := []string{cfg.JwtAlgorithm}
+	if provider != nil {
+		keys.provider = provider
+		if cfg.JwtAlgorithm != jwt.SigningMethodRS256.Alg() {
+			methods = append(methods, jwt.SigningMethodRS256.Alg())
+		}
+	}
+	return &Authenticator{
+		keys:    keys,
+		apiKeys: apiKeys,
+		parser: jwt.NewParser(
+			jwt.WithValidMethods(methods),
+			jwt.WithIssuer(cfg.JwtIssuer),
+			jwt.WithAudience(cfg.JwtAudience),
+			jwt.WithLeeway(cfg.JwtClockSkew),
+			jwt.WithExpirationRequired(),
+			jwt.WithIssuedAt(),
+		),
+	}, nil
+}
+
+// Middleware пропускает запрос дальше только с валидным токеном или API-ключом;
+// субъект и claims токена доступны обработчикам через Subject и Claims
+func (a *Authenticator) Middleware() fiber.Handler {
+	return func(ctx *fiber.Ctx) {
+		header := ctx.Get(fiber.HeaderAuthorization)
+		if key, ok := apiKey(header); ok && a.apiKeys != nil {
+			a.authenticateApiKey(ctx, key)
+			return
+		}
+		raw, ok := bearerToken(header)
+		if !ok {
+			unauthorized(ctx, "missing bearer token")
+			return
+		}
+		claims := jwt.MapClaims{}
+		token, err := a.parser.ParseWithClaims(raw, claims, a.keys.keyFunc)
+		if err != nil {
+			unauthorized(ctx, describe(err))
+			return
+		}
+		subject, err := claims.GetSubject()
+		if err != nil || subject == "" {
+			unauthorized(ctx, "token has no subject")
+			return
+		}
+		ctx.Locals(SubjectKey, subject)
+		ctx.Locals(ClaimsKey, claims)
+		ctx.Locals(IssuedKey, a.keys.issued(token))
+		ctx.Next()
+	}
+}
+
+// Subject субъект (claim sub) аутентифицированного запроса
+func Subject(ctx *fiber.Ctx) string {
+	subject, _ := ctx.Locals(SubjectKey).(string)
+	return subject
+}
+
+// Issued токен выдан самим сервисом; только у таких токенов субъект — сотрудник или клиент idm
+func Issued(ctx *fiber.Ctx) bool {
+	issued, _ := ctx.Locals(IssuedKey).(bool)
+	return issued
+}
+
+// Claims все claims токена аутентифицированного запроса
+func Claims(ctx *fiber.Ctx) jwt.MapClaims {
+	claims, _ := ctx.Locals(ClaimsKey).(jwt.MapClaims)
+	return claims
+}
+
+func bearerToken(header string) (string, bool) {
+	scheme, token, found := strings.Cut(strings.TrimSpace(header), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// describe короткое описание причины отказа без подробностей разбора токена
+func describe(err error) string {
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return "token is expired"
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return "token is not valid yet"
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return "token has invalid issuer"
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return "token has invalid audience"
+	case errors.Is(err, jwt.ErrTokenRequiredClaimMissing):
+		return "token is missing required claims"
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable):
+		return "token signature is invalid"
+	default:
+		return "token is invalid"
+	}
+}
+
+func unauthorized(ctx *fiber.Ctx, message string) {
+	ctx.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+	_ = common.ErrResponse(ctx, fiber.StatusUnauthorized, message)
+}
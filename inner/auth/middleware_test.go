@@ -0,0 +1,358 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"github.com/gofiber/fiber"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"idm/inner/common"
+	"idm/inner/web"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testSecret = "middleware-test-secret-0123456789"
+
+var hsConfig = common.Config{
+	JwtAlgorithm: "HS256",
+	JwtSecret:    testSecret,
+	JwtIssuer:    "idm",
+	JwtAudience:  "idm-api",
+	JwtClockSkew: 30 * time.Second,
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub": "42",
+		"iss": "idm",
+		"aud": "idm-api",
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}
+}
+
+func signHs(t *testing.T, claims jwt.MapClaims, secret string) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	assert.NoError(t, err)
+	return token
+}
+
+// newTestServer сервер с middleware на группе /api/v1 и маршрутом, возвращающим субъект токена
+func newTestServer(t *testing.T, cfg common.Config, provider KeyProvider, apiKeys ApiKeyVerifier) *web.Server {
+	authenticator, err := NewAuthenticator(cfg, provider, apiKeys)
+	assert.NoError(t, err)
+	server := web.NewServer()
+	server.GroupApiV1.Use(authenticator.Middleware())
+	server.GroupApiV1.Get("/whoami", func(ctx *fiber.Ctx) {
+		_ = common.OkResponse(ctx, Subject(ctx)+":"+Claims(ctx)["iss"].(string))
+	})
+	return server
+}
+
+func doRequest(t *testing.T, server *web.Server, token string) (int, common.Response[string]) {
+	return doRequestTo(t, server, "/api/v1/whoami", token)
+}
+
+func doRequestTo(t *testing.T, server *web.Server, path string, token string) (int, common.Response[string]) {
+	request := httptest.NewRequest(fiber.MethodGet, path, nil)
+	if token != "" {
+		request.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+	resp, err := server.App.Test(request)
+	assert.NoError(t, err)
+	var response common.Response[string]
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+	return resp.StatusCode, response
+}
+
+func TestMiddlewareHs256(t *testing.T) {
+	server := newTestServer(t, hsConfig, nil, nil)
+
+	t.Run("ValidToken", func(t *testing.T) {
+		code, response := doRequest(t, server, signHs(t, validClaims(), testSecret))
+
+		assert.Equal(t, fiber.StatusOK, code)
+		assert.Equal(t, "42:idm", response.Data)
+	})
+
+	t.Run("MissingToken", func(t *testing.T) {
+		code, response := doRequest(t, server, "")
+
+		assert.Equal(t, fiber.StatusUnauthorized, code)
+		assert.False(t, response.Success)
+		assert.Equal(t, "missing bearer token", response.Message)
+	})
+
+	t.Run("WrongSecret", func(t *testing.T) {
+		code, response := doRequest(t, server, signHs(t, validClaims(), "another-secret-another-secret-00"))
+
+		assert.Equal(t, fiber.StatusUnauthorized, code)
+		assert.Equal(t, "token signature is invalid", response.Message)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		claims := validClaims()
+		claims["exp"] = time.Now().Add(-time.Minute).Unix()
+
+		code, response := doRequest(t, server, signHs(t, claims, testSecret))
+
+		assert.Equal(t, fiber.StatusUnauthorized, code)
+		assert.Equal(t, "token is expired", response.Message)
+	})
+
+	t.Run("ExpiredWithinClockSkew", func(t *testing.T) {
+		claims := validClaims()
+		claims["exp"] = time.Now().Add(-10 * time.Second).Unix()
+
+		code, _ := doRequest(t, server, signHs(t, claims, testSecret))
+
+		assert.Equal(t, fiber.StatusOK, code)
+	})
+
+	t.Run("MissingExpiry", func(t *testing.T) {
+		claims := validClaims()
+		delete(claims, "exp")
+
+		code, _ := doRequest(t, server, signHs(t, claims, testSecret))
+
+		assert.Equal(t, fiber.StatusUnauthorized, code)
+	})
+
+	t.Run("WrongIssuer", func(t *testing.T) {
+		claims := validClaims()
+		claims["iss"] = "someone-else"
+
+		code, response := doRequest(t, server, signHs(t, claims, testSecret))
+
+		assert.Equal(t, fiber.StatusUnauthorized, code)
+		assert.Equal(t, "token has invalid issuer", response.Message)
+	})
+
+	t.Run("WrongAudience", func(t *testing.T) {
+		claims := validClaims()
+		claims["aud"] = []string{"other-api"}
+
+		code, response := doRequest(t, server, signHs(t, claims, testSecret))
+
+		assert.Equal(t, fiber.StatusUnauthorized, code)
+		assert.Equal(t, "token has invalid audience", response.Message)
+	})
+
+	t.Run("MissingSubject", func(t *testing.T) {
+		claims := validClaims()
+		delete(claims, "sub")
+
+		code, response := doRequest(t, server, signHs(t, claims, testSecret))
+
+		assert.Equal(t, fiber.StatusUnauthorized, code)
+		assert.Equal(t, "token has no subject", response.Message)
+	})
+
+	t.Run("AlgorithmNotAllowed", func(t *testing.T) {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS384, validClaims()).SignedString([]byte(testSecret))
+		assert.NoError(t, err)
+
+		code, _ := doRequest(t, server, token)
+
+		assert.Equal(t, fiber.StatusUnauthorized, code)
+	})
+
+	t.Run("InternalRoutesAreNotAffected", func(t *testing.T) {
+		server.GroupInternal.Get("/ping", func(ctx *fiber.Ctx) { ctx.SendStatus(fiber.StatusOK) })
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/internal/ping", nil))
+
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestMiddlewareRs256(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	cfg := hsConfig
+	cfg.JwtAlgorithm = "RS256"
+	cfg.JwtSecret = ""
+	cfg.JwtKeyFile = writeJwks(t, map[string]*rsa.PublicKey{"key-1": &privateKey.PublicKey})
+	server := newTestServer(t, cfg, nil, nil)
+
+	signRs := func(kid string, key *rsa.PrivateKey) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims())
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		assert.NoError(t, err)
+		return signed
+	}
+
+	t.Run("ValidToken", func(t *testing.T) {
+		code, response := doRequest(t, server, signRs("key-1", privateKey))
+
+		assert.Equal(t, fiber.StatusOK, code)
+		assert.Equal(t, "42:idm", response.Data)
+	})
+
+	t.Run("UnknownKid", func(t *testing.T) {
+		code, _ := doRequest(t, server, signRs("key-2", privateKey))
+
+		assert.Equal(t, fiber.StatusUnauthorized, code)
+	})
+
+	t.Run("HsTokenSignedWithPublicKeyIsRejected", func(t *testing.T) {
+		code, _ := doRequest(t, server, signHs(t, validClaims(), testSecret))
+
+		assert.Equal(t, fiber.StatusUnauthorized, code)
+	})
+}
+
+// staticProvider ключи токенов, выданных самим сервисом
+type staticProvider map[string]*rsa.PublicKey
+
+func (p staticProvider) PublicKey(kid string) (*rsa.PublicKey, bool) {
+	key, ok := p[kid]
+	return key, ok
+}
+
+func TestMiddlewareIssuedTokens(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	server := newTestServer(t, hsConfig, staticProvider{"issued-1": &privateKey.PublicKey}, nil)
+
+	t.Run("IssuedTokenAcceptedAlongsideHs256", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims())
+		token.Header["kid"] = "issued-1"
+		signed, err := token.SignedString(privateKey)
+		assert.NoError(t, err)
+
+		code, _ := doRequest(t, server, signed)
+
+		assert.Equal(t, fiber.StatusOK, code)
+	})
+
+	t.Run("ExternalHs256StillAccepted", func(t *testing.T) {
+		code, _ := doRequest(t, server, signHs(t, validClaims(), testSecret))
+
+		assert.Equal(t, fiber.StatusOK, code)
+	})
+
+	t.Run("UnknownIssuedKid", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims())
+		token.Header["kid"] = "issued-2"
+		signed, err := token.SignedString(privateKey)
+		assert.NoError(t, err)
+
+		code, _ := doRequest(t, server, signed)
+
+		assert.Equal(t, fiber.StatusUnauthorized, code)
+	})
+}
+
+func TestMiddlewareIssuedTokensWithPem(t *testing.T) {
+	externalKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	issuedKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	pkix, err := x509.MarshalPKIXPublicKey(&externalKey.PublicKey)
+	assert.NoError(t, err)
+	cfg := hsConfig
+	cfg.JwtAlgorithm = "RS256"
+	cfg.JwtSecret = ""
+	cfg.JwtKeyFile = writePem(t, "PUBLIC KEY", pkix)
+	server := newTestServer(t, cfg, staticProvider{"issued-1": &issuedKey.PublicKey}, nil)
+
+	signRs := func(kid string, key *rsa.PrivateKey) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims())
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		assert.NoError(t, err)
+		return signed
+	}
+
+	t.Run("IssuedTokenAccepted", func(t *testing.T) {
+		code, _ := doRequest(t, server, signRs("issued-1", issuedKey))
+
+		assert.Equal(t, fiber.StatusOK, code)
+	})
+
+	t.Run("ExternalTokenAccepted", func(t *testing.T) {
+		code, _ := doRequest(t, server, signRs("", externalKey))
+
+		assert.Equal(t, fiber.StatusOK, code)
+	})
+
+	t.Run("IssuedKidSignedWithExternalKeyIsRejected", func(t *testing.T) {
+		code, _ := doRequest(t, server, signRs("issued-1", externalKey))
+
+		assert.Equal(t, fiber.StatusUnauthorized, code)
+	})
+}
+
+// staticApiKeys проверка API-ключей по фиксированному набору
+type staticApiKeys map[string]ApiKeyPrincipal
+
+func (k staticApiKeys) VerifyApiKey(key string) (ApiKeyPrincipal, error) {
+	principal, ok := k[key]
+	if !ok {
+		return ApiKeyPrincipal{}, ErrInvalidApiKey
+	}
+	return principal, nil
+}
+
+func TestMiddlewareApiKey(t *testing.T) {
+	server := newTestServer(t, hsConfig, nil, staticApiKeys{
+		"idm_abc_secret": {KeyId: "abc", ServiceAccount: "hr-sync", Permissions: []string{"employees:read"}},
+	})
+	server.Authorizer = NewGuard(new(MockChecker))
+	server.GroupApiV1.Get("/employees", server.Require("employees:read"), func(ctx *fiber.Ctx) {
+		_ = common.OkResponse(ctx, Subject(ctx))
+	})
+	server.GroupApiV1.Post("/employees", server.Require("employees:write"), func(ctx *fiber.Ctx) {
+		_ = common.OkResponse(ctx, Subject(ctx))
+	})
+	doApiKeyRequest := func(method string, header string) (int, common.Response[string]) {
+		request := httptest.NewRequest(method, "/api/v1/employees", nil)
+		request.Header.Set(fiber.HeaderAuthorization, header)
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+		var response common.Response[string]
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+		return resp.StatusCode, response
+	}
+
+	t.Run("ValidKeyWithPermission", func(t *testing.T) {
+		code, response := doApiKeyRequest(fiber.MethodGet, "ApiKey idm_abc_secret")
+
+		assert.Equal(t, fiber.StatusOK, code)
+		assert.Equal(t, ApiKeySubjectPrefix+"abc", response.Data)
+	})
+
+	t.Run("ValidKeyWithoutPermission", func(t *testing.T) {
+		code, response := doApiKeyRequest(fiber.MethodPost, "ApiKey idm_abc_secret")
+
+		assert.Equal(t, fiber.StatusForbidden, code)
+		assert.Equal(t, "permission employees:write is required", response.Message)
+	})
+
+	t.Run("InvalidKey", func(t *testing.T) {
+		code, response := doApiKeyRequest(fiber.MethodGet, "ApiKey idm_abc_wrong")
+
+		assert.Equal(t, fiber.StatusUnauthorized, code)
+		assert.Equal(t, "api key is invalid", response.Message)
+	})
+
+	t.Run("ApiKeyNotAcceptedWithoutVerifier", func(t *testing.T) {
+		server := newTestServer(t, hsConfig, nil, nil)
+		request := httptest.NewRequest(fiber.MethodGet, "/api/v1/whoami", nil)
+		request.Header.Set(fiber.HeaderAuthorization, "ApiKey idm_abc_secret")
+
+		resp, err := server.App.Test(request)
+
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+	})
+}
@@ -0,0 +1,92 @@
+package authz
+
+import (
+	"errors"
+	"github.com/gofiber/fiber"
+	"idm/inner/common"
+	"idm/inner/web"
+)
+
+type Controller struct {
+	server       *web.Server
+	authzService Svc
+}
+
+// интерфейс сервиса authz.Service
+type Svc interface {
+	Check(request CheckRequest) (CheckResponse, error)
+	CheckBatch(request BatchCheckRequest) ([]CheckResponse, error)
+}
+
+func NewController(server *web.Server, authzService Svc) *Controller {
+	return &Controller{
+		server:       server,
+		authzService: authzService,
+	}
+}
+
+// функция для регистрации маршрутов
+func (c *Controller) RegisterRoutes() {
+
+	check := c.server.Require("authz:check")
+
+	// полный маршрут получится "/api/v1/authz/check"
+	c.server.GroupApiV1.Post("/authz/check", check, c.Check)
+	c.server.GroupApiV1.Post("/authz/check/batch", check, c.CheckBatch)
+}
+
+// функция-хендлер для POST запроса по маршруту "/api/v1/authz/check"
+func (c *Controller) Check(ctx *fiber.Ctx) {
+	var request CheckRequest
+	if err := ctx.BodyParser(&request); err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	decision, err := c.authzService.Check(request)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	// отказ — это штатный результат проверки, поэтому ответ всегда 200
+	err = common.OkResponse(ctx, decision)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning authorization decision")
+		return
+	}
+}
+
+// функция-хендлер для POST запроса по маршруту "/api/v1/authz/check/batch"
+func (c *Controller) CheckBatch(ctx *fiber.Ctx) {
+	var request BatchCheckRequest
+	if err := ctx.BodyParser(&request); err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	decisions, err := c.authzService.CheckBatch(request)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, decisions)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning authorization decisions")
+		return
+	}
+}
+
+// errResponse сопоставляет ошибку сервиса с кодом ответа:
+// 400 — ошибки валидации, 404 — сотрудник не найден, 500 — всё остальное
+func errResponse(ctx *fiber.Ctx, err error) {
+	switch {
+	case errors.As(err, &common.RequestValidationError{}):
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+	case errors.As(err, &common.NotFoundError{}):
+		_ = common.ErrResponse(ctx, fiber.StatusNotFound, err.Error())
+	default:
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,123 @@
+package authz
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gofiber/fiber"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/common"
+	"idm/inner/web"
+	"net/http/httptest"
+	"testing"
+)
+
+// Объявляем структуру мока сервиса authz.Service
+type MockService struct {
+	mock.Mock
+}
+
+func (svc *MockService) Check(request CheckRequest) (CheckResponse, error) {
+	args := svc.Called(request)
+	return args.Get(0).(CheckResponse), args.Error(1)
+}
+
+func (svc *MockService) CheckBatch(request BatchCheckRequest) ([]CheckResponse, error) {
+	args := svc.Called(request)
+	return args.Get(0).([]CheckResponse), args.Error(1)
+}
+
+func getTestRequestBody(req any) *bytes.Buffer {
+	body, _ := json.Marshal(req)
+	return bytes.NewBuffer(body)
+}
+
+func TestController(t *testing.T) {
+	mockService := new(MockService)
+	server := web.NewServer()
+	controller := NewController(server, mockService)
+	controller.RegisterRoutes()
+
+	t.Run("CheckAllowed", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		req := CheckRequest{EmployeeId: 42, Permission: "invoice:approve"}
+		want := CheckResponse{EmployeeId: 42, Permission: "invoice:approve", Allowed: true, Role: &MatchedRole{Id: 2, Name: "Менеджер"}}
+		request := httptest.NewRequest(fiber.MethodPost, "/api/v1/authz/check", getTestRequestBody(req))
+		request.Header.Set("Content-Type", "application/json")
+		mockService.On("Check", req).Return(want, nil)
+
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+
+		var response common.Response[CheckResponse]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, want, response.Data)
+	})
+
+	t.Run("CheckDeniedIsOk", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		req := CheckRequest{EmployeeId: 42, Permission: "invoice:delete"}
+		request := httptest.NewRequest(fiber.MethodPost, "/api/v1/authz/check", getTestRequestBody(req))
+		request.Header.Set("Content-Type", "application/json")
+		mockService.On("Check", req).Return(CheckResponse{EmployeeId: 42, Permission: req.Permission}, nil)
+
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+
+		var response common.Response[CheckResponse]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.False(t, response.Data.Allowed)
+	})
+
+	t.Run("CheckEmployeeNotFound", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		req := CheckRequest{EmployeeId: 9, Permission: "invoice:approve"}
+		request := httptest.NewRequest(fiber.MethodPost, "/api/v1/authz/check", getTestRequestBody(req))
+		request.Header.Set("Content-Type", "application/json")
+		mockService.On("Check", req).Return(CheckResponse{}, common.NotFoundError{Resource: "employee", ID: 9})
+
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("CheckBatchSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		req := BatchCheckRequest{Checks: []CheckRequest{
+			{EmployeeId: 42, Permission: "invoice:approve"},
+			{EmployeeId: 42, Permission: "invoice:delete"},
+		}}
+		request := httptest.NewRequest(fiber.MethodPost, "/api/v1/authz/check/batch", getTestRequestBody(req))
+		request.Header.Set("Content-Type", "application/json")
+		mockService.On("CheckBatch", req).Return([]CheckResponse{{Allowed: true}, {Allowed: false}}, nil)
+
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+
+		var response common.Response[[]CheckResponse]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Len(t, response.Data, 2)
+	})
+
+	t.Run("CheckBatchValidationFailed", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		req := BatchCheckRequest{}
+		request := httptest.NewRequest(fiber.MethodPost, "/api/v1/authz/check/batch", getTestRequestBody(req))
+		request.Header.Set("Content-Type", "application/json")
+		mockService.On("CheckBatch", req).
+			Return([]CheckResponse{}, common.RequestValidationError{FieldErrors: map[string]string{"Checks": "is required"}})
+
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	})
+}
@@ -0,0 +1,31 @@
+package authz
+
+import "strings"
+
+type CheckRequest struct {
+	EmployeeId int64  `json:"employeeId" validate:"required,min=1"`
+	Permission string `json:"permission" validate:"required,min=3,max=201,contains=:"`
+}
+
+// split разбирает право вида "resource:action"
+func (req *CheckRequest) split() (resource string, action string) {
+	resource, action, _ = strings.Cut(req.Permission, ":")
+	return resource, action
+}
+
+type BatchCheckRequest struct {
+	Checks []CheckRequest `json:"checks" validate:"required,min=1,max=100,dive"`
+}
+
+// MatchedRole роль, через которую сотруднику выдано проверяемое право
+type MatchedRole struct {
+	Id   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type CheckResponse struct {
+	EmployeeId int64        `json:"employee_id"`
+	Permission string       `json:"permission"`
+	Allowed    bool         `json:"allowed"`
+	Role       *MatchedRole `json:"role"`
+}
@@ -0,0 +1,58 @@
+package authz
+
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCheckRequestValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  any
+		wantErr  bool
+		errField string
+	}{
+		{
+			name:    "valid request",
+			request: CheckRequest{EmployeeId: 42, Permission: "invoice:approve"},
+			wantErr: false,
+		},
+		{
+			name:     "missing employee",
+			request:  CheckRequest{Permission: "invoice:approve"},
+			wantErr:  true,
+			errField: "EmployeeId",
+		},
+		{
+			name:     "permission without action",
+			request:  CheckRequest{EmployeeId: 42, Permission: "invoice"},
+			wantErr:  true,
+			errField: "Permission",
+		},
+		{
+			name:     "empty batch",
+			request:  BatchCheckRequest{},
+			wantErr:  true,
+			errField: "Checks",
+		},
+		{
+			name:     "batch with invalid check",
+			request:  BatchCheckRequest{Checks: []CheckRequest{{EmployeeId: 42, Permission: "invoice"}}},
+			wantErr:  true,
+			errField: "Permission",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validator.New().Struct(tt.request)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errField)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
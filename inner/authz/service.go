@@ -0,0 +1,169 @@
+package authz
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"idm/inner/common"
+	"idm/inner/employee"
+	"idm/inner/role"
+)
+
+type Service struct {
+	employeeRepo EmployeeRepo
+	roleRepo     RoleRepo
+	clientRepo   ClientRepo
+	validator    Validator
+}
+
+func NewService(employeeRepo EmployeeRepo, roleRepo RoleRepo, clientRepo ClientRepo, validator Validator) *Service {
+	return &Service{
+		employeeRepo: employeeRepo,
+		roleRepo:     roleRepo,
+		clientRepo:   clientRepo,
+		validator:    validator,
+	}
+}
+
+type Validator interface {
+	Validate(request any) error
+}
+
+type EmployeeRepo interface {
+	FindById(id int64) (employee.Entity, error)
+	FindEffectiveRolesByEmployeeId(id int64) (roles []employee.RoleEntity, err error)
+}
+
+type RoleRepo interface {
+	FindPermissionsByRoleIds(ids []int64) (permissions []role.PermissionEntity, err error)
+	FindIdsByNames(names []string) (ids []int64, err error)
+}
+
+type ClientRepo interface {
+	FindRoleIdsByClientId(clientId string) (ids []int64, err error)
+}
+
+// Check отвечает на вопрос "может ли сотрудник выполнить действие".
+// На проверку уходит два запроса: роли сотрудника и права этих ролей
+func (service *Service) Check(request CheckRequest) (CheckResponse, error) {
+	if err := service.validator.Validate(request); err != nil {
+		return CheckResponse{}, err
+	}
+	grants, err := service.resolve(request.EmployeeId)
+	if err != nil {
+		return CheckResponse{}, err
+	}
+	return decide(request, grants), nil
+}
+
+// CheckBatch проверяет несколько прав за раз; роли каждого сотрудника разрешаются один раз
+func (service *Service) CheckBatch(request BatchCheckRequest) ([]CheckResponse, error) {
+	if err := service.validator.Validate(request); err != nil {
+		return []CheckResponse{}, err
+	}
+	resolved := make(map[int64][]role.PermissionEntity)
+	responses := make([]CheckResponse, len(request.Checks))
+	for i, check := range request.Checks {
+		grants, ok := resolved[check.EmployeeId]
+		if !ok {
+			var err error
+			grants, err = service.resolve(check.EmployeeId)
+			if err != nil {
+				return []CheckResponse{}, err
+			}
+			resolved[check.EmployeeId] = grants
+		}
+		responses[i] = decide(check, grants)
+	}
+	return responses, nil
+}
+
+// EmployeeHasPermission проверка права сотрудника для защиты маршрутов;
+// несуществующий сотрудник прав не имеет
+func (service *Service) EmployeeHasPermission(employeeId int64, permission string) (bool, error) {
+	grants, err := service.resolve(employeeId)
+	if errors.As(err, &common.NotFoundError{}) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return decide(CheckRequest{EmployeeId: employeeId, Permission: permission}, grants).Allowed, nil
+}
+
+// ClientHasPermission проверка права сервисного клиента по выданным ему ролям
+func (service *Service) ClientHasPermission(clientId string, permission string) (bool, error) {
+	roleIds, err := service.clientRepo.FindRoleIdsByClientId(clientId)
+	if err != nil {
+		return false, fmt.Errorf("error finding roles of client %s: %w", clientId, err)
+	}
+	if len(roleIds) == 0 {
+		return false, nil
+	}
+	grants, err := service.roleRepo.FindPermissionsByRoleIds(roleIds)
+	if err != nil {
+		return false, fmt.Errorf("error finding permissions of roles %d: %w", roleIds, err)
+	}
+	return decide(CheckRequest{Permission: permission}, grants).Allowed, nil
+}
+
+// RolesHavePermission проверка права по названиям ролей, например из claim roles токена внешнего
+// провайдера; неизвестные роли прав не дают
+func (service *Service) RolesHavePermission(roleNames []string, permission string) (bool, error) {
+	roleIds, err := service.roleRepo.FindIdsByNames(roleNames)
+	if err != nil {
+		return false, fmt.Errorf("error finding roles %q: %w", roleNames, err)
+	}
+	if len(roleIds) == 0 {
+		return false, nil
+	}
+	grants, err := service.roleRepo.FindPermissionsByRoleIds(roleIds)
+	if err != nil {
+		return false, fmt.Errorf("error finding permissions of roles %d: %w", roleIds, err)
+	}
+	return decide(CheckRequest{Permission: permission}, grants).Allowed, nil
+}
+
+// resolve все права сотрудника вместе с ролями, через которые они выданы
+func (service *Service) resolve(employeeId int64) ([]role.PermissionEntity, error) {
+	roles, err := service.employeeRepo.FindEffectiveRolesByEmployeeId(employeeId)
+	if err != nil {
+		return nil, fmt.Errorf("error finding roles of employee with id %d: %w", employeeId, err)
+	}
+	if len(roles) == 0 {
+		// без ролей прав нет, но нужно отличить сотрудника без ролей от несуществующего
+		_, err = service.employeeRepo.FindById(employeeId)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, common.NotFoundError{Resource: "employee", ID: employeeId}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error finding employee with id %d: %w", employeeId, err)
+		}
+		return []role.PermissionEntity{}, nil
+	}
+	roleIds := make([]int64, len(roles))
+	for i := range roles {
+		roleIds[i] = roles[i].Id
+	}
+	grants, err := service.roleRepo.FindPermissionsByRoleIds(roleIds)
+	if err != nil {
+		return nil, fmt.Errorf("error finding permissions of roles %d: %w", roleIds, err)
+	}
+	return grants, nil
+}
+
+func decide(request CheckRequest, grants []role.PermissionEntity) CheckResponse {
+	response := CheckResponse{
+		EmployeeId: request.EmployeeId,
+		Permission: request.Permission,
+	}
+	resource, action := request.split()
+	for _, grant := range grants {
+		if grant.Resource == resource && grant.Action == action {
+			response.Allowed = true
+			response.Role = &MatchedRole{Id: grant.RoleId, Name: grant.RoleName}
+			break
+		}
+	}
+	return response
+}
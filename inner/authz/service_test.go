@@ -0,0 +1,234 @@
+package authz
+
+import (
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/common"
+	"idm/inner/employee"
+	"idm/inner/role"
+	"idm/inner/validator"
+	"testing"
+)
+
+type MockEmployeeRepo struct {
+	mock.Mock
+}
+
+func (m *MockEmployeeRepo) FindById(id int64) (employee.Entity, error) {
+	args := m.Called(id)
+	return args.Get(0).(employee.Entity), args.Error(1)
+}
+
+func (m *MockEmployeeRepo) FindEffectiveRolesByEmployeeId(id int64) ([]employee.RoleEntity, error) {
+	args := m.Called(id)
+	return args.Get(0).([]employee.RoleEntity), args.Error(1)
+}
+
+type MockRoleRepo struct {
+	mock.Mock
+}
+
+func (m *MockRoleRepo) FindPermissionsByRoleIds(ids []int64) ([]role.PermissionEntity, error) {
+	args := m.Called(ids)
+	return args.Get(0).([]role.PermissionEntity), args.Error(1)
+}
+
+func (m *MockRoleRepo) FindIdsByNames(names []string) ([]int64, error) {
+	args := m.Called(names)
+	return args.Get(0).([]int64), args.Error(1)
+}
+
+type MockClientRepo struct {
+	mock.Mock
+}
+
+func (m *MockClientRepo) FindRoleIdsByClientId(clientId string) ([]int64, error) {
+	args := m.Called(clientId)
+	return args.Get(0).([]int64), args.Error(1)
+}
+
+var val = validator.New()
+
+func TestServiceCheck(t *testing.T) {
+	var a = assert.New(t)
+	var roles = []employee.RoleEntity{{Id: 2, Name: "Менеджер"}, {Id: 3, Name: "Разработчик"}}
+	var grants = []role.PermissionEntity{
+		{RoleId: 2, RoleName: "Менеджер", Resource: "invoice", Action: "approve"},
+		{RoleId: 3, RoleName: "Разработчик", Resource: "employees", Action: "read"},
+	}
+
+	t.Run("should allow with matching role", func(t *testing.T) {
+		var employeeRepo = new(MockEmployeeRepo)
+		var roleRepo = new(MockRoleRepo)
+		var svc = NewService(employeeRepo, roleRepo, new(MockClientRepo), val)
+
+		employeeRepo.On("FindEffectiveRolesByEmployeeId", int64(42)).Return(roles, nil)
+		roleRepo.On("FindPermissionsByRoleIds", []int64{2, 3}).Return(grants, nil)
+		var got, err = svc.Check(CheckRequest{EmployeeId: 42, Permission: "invoice:approve"})
+
+		a.Nil(err)
+		a.True(got.Allowed)
+		a.Equal(&MatchedRole{Id: 2, Name: "Менеджер"}, got.Role)
+		a.True(employeeRepo.AssertNotCalled(t, "FindById", int64(42)))
+	})
+
+	t.Run("should deny without matching permission", func(t *testing.T) {
+		var employeeRepo = new(MockEmployeeRepo)
+		var roleRepo = new(MockRoleRepo)
+		var svc = NewService(employeeRepo, roleRepo, new(MockClientRepo), val)
+
+		employeeRepo.On("FindEffectiveRolesByEmployeeId", int64(42)).Return(roles, nil)
+		roleRepo.On("FindPermissionsByRoleIds", []int64{2, 3}).Return(grants, nil)
+		var got, err = svc.Check(CheckRequest{EmployeeId: 42, Permission: "invoice:delete"})
+
+		a.Nil(err)
+		a.False(got.Allowed)
+		a.Nil(got.Role)
+	})
+
+	t.Run("should deny employee without roles", func(t *testing.T) {
+		var employeeRepo = new(MockEmployeeRepo)
+		var roleRepo = new(MockRoleRepo)
+		var svc = NewService(employeeRepo, roleRepo, new(MockClientRepo), val)
+
+		employeeRepo.On("FindEffectiveRolesByEmployeeId", int64(42)).Return([]employee.RoleEntity{}, nil)
+		employeeRepo.On("FindById", int64(42)).Return(employee.Entity{Id: 42}, nil)
+		var got, err = svc.Check(CheckRequest{EmployeeId: 42, Permission: "invoice:approve"})
+
+		a.Nil(err)
+		a.False(got.Allowed)
+		a.True(roleRepo.AssertNotCalled(t, "FindPermissionsByRoleIds", mock.Anything))
+	})
+
+	t.Run("should return not found for missing employee", func(t *testing.T) {
+		var employeeRepo = new(MockEmployeeRepo)
+		var roleRepo = new(MockRoleRepo)
+		var svc = NewService(employeeRepo, roleRepo, new(MockClientRepo), val)
+
+		employeeRepo.On("FindEffectiveRolesByEmployeeId", int64(9)).Return([]employee.RoleEntity{}, nil)
+		employeeRepo.On("FindById", int64(9)).Return(employee.Entity{}, sql.ErrNoRows)
+		var _, err = svc.Check(CheckRequest{EmployeeId: 9, Permission: "invoice:approve"})
+
+		a.ErrorAs(err, &common.NotFoundError{})
+	})
+
+	t.Run("should return validation error", func(t *testing.T) {
+		var svc = NewService(new(MockEmployeeRepo), new(MockRoleRepo), new(MockClientRepo), val)
+
+		var _, err = svc.Check(CheckRequest{EmployeeId: 42, Permission: "invoice"})
+
+		a.ErrorAs(err, &common.RequestValidationError{})
+	})
+
+	t.Run("should resolve roles once per employee in batch", func(t *testing.T) {
+		var employeeRepo = new(MockEmployeeRepo)
+		var roleRepo = new(MockRoleRepo)
+		var svc = NewService(employeeRepo, roleRepo, new(MockClientRepo), val)
+
+		employeeRepo.On("FindEffectiveRolesByEmployeeId", int64(42)).Return(roles, nil)
+		roleRepo.On("FindPermissionsByRoleIds", []int64{2, 3}).Return(grants, nil)
+		var got, err = svc.CheckBatch(BatchCheckRequest{Checks: []CheckRequest{
+			{EmployeeId: 42, Permission: "invoice:approve"},
+			{EmployeeId: 42, Permission: "employees:read"},
+			{EmployeeId: 42, Permission: "employees:write"},
+		}})
+
+		a.Nil(err)
+		a.Len(got, 3)
+		a.True(got[0].Allowed)
+		a.True(got[1].Allowed)
+		a.Equal(int64(3), got[1].Role.Id)
+		a.False(got[2].Allowed)
+		a.True(employeeRepo.AssertNumberOfCalls(t, "FindEffectiveRolesByEmployeeId", 1))
+		a.True(roleRepo.AssertNumberOfCalls(t, "FindPermissionsByRoleIds", 1))
+	})
+}
+
+func TestServiceHasPermission(t *testing.T) {
+	var a = assert.New(t)
+	var grants = []role.PermissionEntity{{RoleId: 2, RoleName: "Менеджер", Resource: "employees", Action: "read"}}
+
+	t.Run("should check employee permission", func(t *testing.T) {
+		var employeeRepo = new(MockEmployeeRepo)
+		var roleRepo = new(MockRoleRepo)
+		var svc = NewService(employeeRepo, roleRepo, new(MockClientRepo), val)
+
+		employeeRepo.On("FindEffectiveRolesByEmployeeId", int64(42)).Return([]employee.RoleEntity{{Id: 2}}, nil)
+		roleRepo.On("FindPermissionsByRoleIds", []int64{2}).Return(grants, nil)
+
+		allowed, err := svc.EmployeeHasPermission(42, "employees:read")
+		a.Nil(err)
+		a.True(allowed)
+		allowed, err = svc.EmployeeHasPermission(42, "employees:write")
+		a.Nil(err)
+		a.False(allowed)
+	})
+
+	t.Run("should deny missing employee", func(t *testing.T) {
+		var employeeRepo = new(MockEmployeeRepo)
+		var svc = NewService(employeeRepo, new(MockRoleRepo), new(MockClientRepo), val)
+
+		employeeRepo.On("FindEffectiveRolesByEmployeeId", int64(9)).Return([]employee.RoleEntity{}, nil)
+		employeeRepo.On("FindById", int64(9)).Return(employee.Entity{}, sql.ErrNoRows)
+		allowed, err := svc.EmployeeHasPermission(9, "employees:read")
+
+		a.Nil(err)
+		a.False(allowed)
+	})
+
+	t.Run("should check client permission", func(t *testing.T) {
+		var roleRepo = new(MockRoleRepo)
+		var clientRepo = new(MockClientRepo)
+		var svc = NewService(new(MockEmployeeRepo), roleRepo, clientRepo, val)
+
+		clientRepo.On("FindRoleIdsByClientId", "billing").Return([]int64{2}, nil)
+		roleRepo.On("FindPermissionsByRoleIds", []int64{2}).Return(grants, nil)
+		allowed, err := svc.ClientHasPermission("billing", "employees:read")
+
+		a.Nil(err)
+		a.True(allowed)
+	})
+
+	t.Run("should deny client without roles", func(t *testing.T) {
+		var roleRepo = new(MockRoleRepo)
+		var clientRepo = new(MockClientRepo)
+		var svc = NewService(new(MockEmployeeRepo), roleRepo, clientRepo, val)
+
+		clientRepo.On("FindRoleIdsByClientId", "unknown").Return([]int64{}, nil)
+		allowed, err := svc.ClientHasPermission("unknown", "employees:read")
+
+		a.Nil(err)
+		a.False(allowed)
+		a.True(roleRepo.AssertNotCalled(t, "FindPermissionsByRoleIds", mock.Anything))
+	})
+}
+
+func TestServiceRolesHavePermission(t *testing.T) {
+	var a = assert.New(t)
+
+	t.Run("should allow by role names", func(t *testing.T) {
+		var roleRepo = new(MockRoleRepo)
+		var svc = NewService(new(MockEmployeeRepo), roleRepo, new(MockClientRepo), val)
+		var grants = []role.PermissionEntity{{RoleId: 3, RoleName: "Разработчик", Resource: "employees", Action: "read"}}
+
+		roleRepo.On("FindIdsByNames", []string{"Разработчик", "unknown"}).Return([]int64{3}, nil)
+		roleRepo.On("FindPermissionsByRoleIds", []int64{3}).Return(grants, nil)
+		allowed, err := svc.RolesHavePermission([]string{"Разработчик", "unknown"}, "employees:read")
+
+		a.Nil(err)
+		a.True(allowed)
+	})
+
+	t.Run("should deny unknown roles", func(t *testing.T) {
+		var roleRepo = new(MockRoleRepo)
+		var svc = NewService(new(MockEmployeeRepo), roleRepo, new(MockClientRepo), val)
+
+		roleRepo.On("FindIdsByNames", []string{"unknown"}).Return([]int64{}, nil)
+		allowed, err := svc.RolesHavePermission([]string{"unknown"}, "employees:read")
+
+		a.Nil(err)
+		a.False(allowed)
+		a.True(roleRepo.AssertNotCalled(t, "FindPermissionsByRoleIds", mock.Anything))
+	})
+}
@@ -0,0 +1,27 @@
+package common
+
+import "fmt"
+
+// Caller права вызывающего текущего запроса, реализуется web.Server.Caller
+type Caller interface {
+	HasPermission(permission string) (bool, error)
+}
+
+// RequireGrantable выдать API-ключу или клиенту можно только права, которые есть у самого вызывающего,
+// иначе право на выдачу стало бы правом на любое действие
+func RequireGrantable(caller Caller, permissions []string) error {
+	var missing []string
+	for _, permission := range permissions {
+		allowed, err := caller.HasPermission(permission)
+		if err != nil {
+			return fmt.Errorf("error checking permission %s of caller: %w", permission, err)
+		}
+		if !allowed {
+			missing = append(missing, permission)
+		}
+	}
+	if len(missing) > 0 {
+		return PermissionDeniedError{Permissions: missing}
+	}
+	return nil
+}
@@ -6,6 +6,8 @@ import (
 	"github.com/go-playground/validator/v10"
 	"github.com/joho/godotenv"
 	"os"
+	"strings"
+	"time"
 )
 
 // Config общая конфигурация всего приложения
@@ -14,8 +16,65 @@ type Config struct {
 	Dsn          string `validate:"required"`
 	AppName      string `validate:"required"`
 	AppVersion   string `validate:"required"`
+	// JwtAlgorithm алгоритм подписи токенов доступа: HS256 (общий секрет) или RS256 (открытый ключ)
+	JwtAlgorithm string `validate:"required,oneof=HS256 RS256"`
+	// JwtSecret общий секрет для HS256
+	JwtSecret string `validate:"required_if=JwtAlgorithm HS256,omitempty,min=32"`
+	// JwtKeyFile путь к PEM-файлу с открытым ключом или к JWKS-файлу для RS256;
+	// без него принимаются только токены, выданные самим сервисом
+	JwtKeyFile  string
+	JwtIssuer   string `validate:"required"`
+	JwtAudience string `validate:"required"`
+	// JwtClockSkew допустимое расхождение часов при проверке exp/nbf/iat
+	JwtClockSkew time.Duration `validate:"min=0"`
+	// JwtTokenTtl время жизни выдаваемых сервисом токенов
+	JwtTokenTtl time.Duration `validate:"min=0"`
+	// JwtKeyRotation период автоматической ротации ключа подписи; 0 — только ручная ротация
+	JwtKeyRotation time.Duration `validate:"min=0"`
+	// InternalAddress отдельный адрес для маршрутов /internal, например "127.0.0.1:8081";
+	// пусто — /internal обслуживается вместе с публичным API, если задан InternalSecret или InternalAllowedIps,
+	// а без них слушает только 127.0.0.1:8081
+	InternalAddress string
+	// InternalSecret общий секрет, который вызывающий передаёт в заголовке X-Internal-Secret
+	InternalSecret string `validate:"omitempty,min=32"`
+	// InternalAllowedIps адреса и подсети, которым разрешён доступ к /internal; пусто — без ограничения
+	InternalAllowedIps []string `validate:"dive,cidr|ip"`
+	// PurgeRetention сколько мягко удалённые сотрудники и роли хранятся до окончательного удаления;
+	// 0 — DefaultPurgeRetention
+	PurgeRetention time.Duration `validate:"min=0"`
+	// ProvisioningTargetsFile путь к JSON-файлу с внешними SCIM-системами, в которые передаются
+	// сотрудники; пусто — исходящая синхронизация выключена
+	ProvisioningTargetsFile string
+	// ProvisioningInterval период доставки очереди синхронизации внутри сервиса;
+	// 0 — только через /internal/provisioning/deliver
+	ProvisioningInterval time.Duration `validate:"min=0"`
+	// LdapSyncFile путь к JSON-файлу с настройками синхронизации из каталога LDAP; пусто — выключена
+	LdapSyncFile string
+	// LdapSyncInterval период синхронизации внутри сервиса; 0 — только через /internal/ldap/sync
+	LdapSyncInterval time.Duration `validate:"min=0"`
+	// WebhookInterval период отправки событий получателям веб-хуков внутри сервиса;
+	// 0 — только через /internal/webhooks/deliver
+	WebhookInterval time.Duration `validate:"min=0"`
+	// OutboxSinksFile путь к JSON-файлу с приёмниками событий транзакционного outbox;
+	// пусто — события в outbox не записываются
+	OutboxSinksFile string
+	// OutboxInterval период публикации outbox внутри сервиса; 0 — только через /internal/outbox/relay
+	OutboxInterval time.Duration `validate:"min=0"`
+	// OutboxRetention сколько опубликованные события хранятся; 0 — outbox.DefaultRetention
+	OutboxRetention time.Duration `validate:"min=0"`
+	// LdapAddress адрес LDAP-сервера только для чтения поверх сотрудников и ролей, например ":389";
+	// пусто — сервер выключен
+	LdapAddress string
+	// LdapBaseDn базовый DN публикуемого каталога, например "dc=example,dc=com"
+	LdapBaseDn string `validate:"required_with=LdapAddress"`
+	// LdapTlsCertFile и LdapTlsKeyFile сертификат и ключ в PEM; заданы — сервер принимает только ldaps
+	LdapTlsCertFile string `validate:"required_with=LdapTlsKeyFile"`
+	LdapTlsKeyFile  string `validate:"required_with=LdapTlsCertFile"`
 }
 
+// DefaultPurgeRetention срок хранения мягко удалённых сотрудников и ролей, если PurgeRetention не задан
+const DefaultPurgeRetention = 30 * 24 * time.Hour
+
 // GetConfig получение конфигурации из .env файла или переменных окружения
 func GetConfig(envFile string) Config {
 	var err = godotenv.Load(envFile)
@@ -28,7 +87,34 @@ func GetConfig(envFile string) Config {
 		Dsn:          os.Getenv("DB_DSN"),
 		AppName:      os.Getenv("APP_NAME"),
 		AppVersion:   os.Getenv("APP_VERSION"),
+		JwtAlgorithm: os.Getenv("JWT_ALGORITHM"),
+		JwtSecret:    os.Getenv("JWT_SECRET"),
+		JwtKeyFile:   os.Getenv("JWT_KEY_FILE"),
+		JwtIssuer:    os.Getenv("JWT_ISSUER"),
+		JwtAudience:  os.Getenv("JWT_AUDIENCE"),
+
+		InternalAddress:    os.Getenv("INTERNAL_ADDRESS"),
+		InternalSecret:     os.Getenv("INTERNAL_SECRET"),
+		InternalAllowedIps: getList("INTERNAL_ALLOWED_IPS"),
+
+		ProvisioningTargetsFile: os.Getenv("PROVISIONING_TARGETS_FILE"),
+		LdapSyncFile:            os.Getenv("LDAP_SYNC_FILE"),
+		OutboxSinksFile:         os.Getenv("OUTBOX_SINKS_FILE"),
+
+		LdapAddress:     os.Getenv("LDAP_ADDRESS"),
+		LdapBaseDn:      os.Getenv("LDAP_BASE_DN"),
+		LdapTlsCertFile: os.Getenv("LDAP_TLS_CERT_FILE"),
+		LdapTlsKeyFile:  os.Getenv("LDAP_TLS_KEY_FILE"),
 	}
+	cfg.JwtClockSkew = getDuration("JWT_CLOCK_SKEW")
+	cfg.JwtTokenTtl = getDuration("JWT_TOKEN_TTL")
+	cfg.JwtKeyRotation = getDuration("JWT_KEY_ROTATION")
+	cfg.PurgeRetention = getDuration("PURGE_RETENTION")
+	cfg.ProvisioningInterval = getDuration("PROVISIONING_INTERVAL")
+	cfg.LdapSyncInterval = getDuration("LDAP_SYNC_INTERVAL")
+	cfg.WebhookInterval = getDuration("WEBHOOK_INTERVAL")
+	cfg.OutboxInterval = getDuration("OUTBOX_INTERVAL")
+	cfg.OutboxRetention = getDuration("OUTBOX_RETENTION")
 	err = validator.New().Struct(cfg)
 	if err != nil {
 		var validateErrs validator.ValidationErrors
@@ -39,3 +125,28 @@ func GetConfig(envFile string) Config {
 	}
 	return cfg
 }
+
+// getDuration длительность из переменной окружения в формате time.ParseDuration, например "30s";
+// пустая переменная — нулевая длительность
+func getDuration(name string) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		panic(fmt.Sprintf("config validation error: %s: %v", name, err))
+	}
+	return duration
+}
+
+// getList список из переменной окружения через запятую, например "10.0.0.0/8, 127.0.0.1"
+func getList(name string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -40,6 +40,15 @@ func (e NotFoundError) Error() string {
 	return fmt.Sprintf("%s with ID '%v' not found", e.Resource, e.ID)
 }
 
+// PermissionDeniedError — у вызывающего нет прав, которые он пытается выдать
+type PermissionDeniedError struct {
+	Permissions []string
+}
+
+func (e PermissionDeniedError) Error() string {
+	return fmt.Sprintf("caller does not have permissions %v", e.Permissions)
+}
+
 // InternalServerError — внутренняя ошибка сервера
 type InternalServerError struct {
 	Message string
@@ -0,0 +1,96 @@
+package common
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DefaultPageLimit количество записей на странице списка, если limit не задан
+const DefaultPageLimit = 100
+
+// PageRequest общие параметры постраничной выдачи списков.
+// Sort — поле сортировки, "-" перед ним означает по убыванию; Cursor — next_cursor предыдущей страницы
+type PageRequest struct {
+	Limit  int    `query:"limit" validate:"omitempty,min=1,max=1000"`
+	Cursor string `query:"cursor" validate:"omitempty,max=1000"`
+	Sort   string `query:"sort" validate:"omitempty,max=50"`
+}
+
+// Page сведения о странице в ответе: сколько всего записей подходит под фильтр и курсор следующей страницы;
+// на последней странице курсора нет
+type Page struct {
+	Total      int64  `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Sort разобранный параметр sort; без него списки упорядочены по id
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// ParseSort разбирает параметр sort, допуская только перечисленные поля и id
+func ParseSort(value string, fields ...string) (Sort, error) {
+	if value == "" {
+		return Sort{Field: "id"}, nil
+	}
+	sort := Sort{Field: strings.TrimPrefix(value, "-"), Desc: strings.HasPrefix(value, "-")}
+	if sort.Field == "id" {
+		return sort, nil
+	}
+	for _, field := range fields {
+		if sort.Field == field {
+			return sort, nil
+		}
+	}
+	return Sort{}, RequestValidationError{FieldErrors: map[string]string{
+		"sort": fmt.Sprintf("must be one of id, %s, optionally prefixed with '-'", strings.Join(fields, ", ")),
+	}}
+}
+
+func (s Sort) String() string {
+	if s.Desc {
+		return "-" + s.Field
+	}
+	return s.Field
+}
+
+// Cursor позиция после последней записи страницы: значение поля сортировки и id как разрешение равенства.
+// Курсор действителен только для той сортировки, с которой он получен
+type Cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	Id    int64  `json:"id"`
+}
+
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor разбирает параметр cursor; пустой курсор — первая страница
+func DecodeCursor(value string, sort Sort) (*Cursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+	invalid := RequestValidationError{FieldErrors: map[string]string{"cursor": "is invalid"}}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, invalid
+	}
+	var cursor Cursor
+	if err = json.Unmarshal(data, &cursor); err != nil || cursor.Id < 1 {
+		return nil, invalid
+	}
+	if cursor.Sort != sort.String() {
+		return nil, RequestValidationError{FieldErrors: map[string]string{"cursor": "was issued for another sort"}}
+	}
+	return &cursor, nil
+}
+
+// LikePrefix шаблон LIKE для поиска по началу строки; спецсимволы LIKE в префиксе экранируются
+func LikePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+}
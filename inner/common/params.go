@@ -0,0 +1,53 @@
+package common
+
+import (
+	"github.com/gofiber/fiber"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseId — разбирает идентификатор из параметра маршрута
+func ParseId(raw string) (int64, error) {
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id < 1 {
+		return 0, RequestValidationError{FieldErrors: map[string]string{"id": "must be a positive integer"}}
+	}
+	return id, nil
+}
+
+// ParseIds — разбирает список идентификаторов вида "1,2,3" из query-параметра
+func ParseIds(raw string) ([]int64, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, RequestValidationError{FieldErrors: map[string]string{"ids": "is required"}}
+	}
+	parts := strings.Split(raw, ",")
+	ids := make([]int64, 0, len(parts))
+	for _, part := range parts {
+		id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil || id < 1 {
+			return nil, RequestValidationError{FieldErrors: map[string]string{"ids": "must be a comma-separated list of positive integers"}}
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// IncludeDeleted — признак ?include_deleted=true: вместе с действующими записями вернуть мягко удалённые
+func IncludeDeleted(ctx *fiber.Ctx) bool {
+	include, err := strconv.ParseBool(ctx.Query("include_deleted"))
+	return err == nil && include
+}
+
+// ParseTime время в формате RFC 3339 из query-параметра, формат которого уже проверен валидатором;
+// пустое значение — nil
+func ParseTime(value string) *time.Time {
+	if value == "" {
+		return nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil
+	}
+	return &parsed
+}
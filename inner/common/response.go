@@ -6,6 +6,8 @@ type Response[T any] struct {
 	Success bool   `json:"success"`
 	Message string `json:"error"`
 	Data    T      `json:"data"`
+	// Page заполняется только у постраничных списков
+	Page *Page `json:"page,omitempty"`
 }
 
 func ErrResponse(
@@ -29,3 +31,16 @@ func OkResponse[T any](
 		Data:    data,
 	})
 }
+
+// PageResponse ответ со страницей списка и сведениями о ней
+func PageResponse[T any](
+	c *fiber.Ctx,
+	data T,
+	page Page,
+) error {
+	return c.JSON(&Response[T]{
+		Success: true,
+		Data:    data,
+		Page:    &page,
+	})
+}
@@ -1,11 +1,14 @@
 package employee
 
 import (
+	"bufio"
 	"errors"
 	"github.com/gofiber/fiber"
+	"idm/inner/audit"
 	"idm/inner/common"
 	"idm/inner/validator"
 	"idm/inner/web"
+	"io"
 )
 
 type Controller struct {
@@ -17,8 +20,25 @@ type Controller struct {
 // интерфейс сервиса employee.Service
 type Svc interface {
 	FindById(id int64) (Response, error)
-	CreateEmployee(request CreateRequest) (int64, error)
-	FindAll() ([]Response, error)
+	CreateEmployee(actor audit.Actor, request CreateRequest) (int64, error)
+	FindPage(request FindRequest) ([]Response, common.Page, error)
+	FindByIdIncludingDeleted(id int64) (Response, error)
+	Search(request SearchRequest) ([]SearchResponse, error)
+	Export(request ExportRequest) (func(w io.Writer) error, error)
+	FindAllByIds(ids []int64) ([]Response, error)
+	UpdateEmployee(actor audit.Actor, id int64, request UpdateRequest) (Response, error)
+	PatchEmployee(actor audit.Actor, id int64, request PatchRequest) (Response, error)
+	Delete(actor audit.Actor, id int64) error
+	DeleteAllByIds(actor audit.Actor, ids []int64) error
+	Restore(actor audit.Actor, id int64) (Response, error)
+	Purge(actor audit.Actor) ([]int64, error)
+	AssignRole(actor audit.Actor, id int64, request RoleRequest) (Response, error)
+	RevokeRole(actor audit.Actor, id int64) (Response, error)
+	FindRoles(id int64) ([]RoleResponse, error)
+	AddRole(actor audit.Actor, id int64, roleId int64) error
+	RemoveRole(actor audit.Actor, id int64, roleId int64) error
+	ChangeStatus(actor audit.Actor, id int64, request StatusRequest) (Response, error)
+	FindStatusHistory(id int64) ([]StatusHistoryResponse, error)
 }
 
 func NewController(server *web.Server, employeeService Svc) *Controller {
@@ -32,9 +52,43 @@ func NewController(server *web.Server, employeeService Svc) *Controller {
 // функция для регистрации маршрутов
 func (c *Controller) RegisterRoutes() {
 
+	read := c.server.Require("employees:read")
+	write := c.server.Require("employees:write")
+	// выдача ролей расширяет права сотрудника, поэтому требует права на роли, а не на сотрудников
+	grant := c.server.Require("roles:write")
+	// удалённых сотрудников видят только те, кто может их восстановить
+	restore := c.server.Require("employees:restore")
+	withDeleted := c.server.RequireIf(common.IncludeDeleted, "employees:restore")
+
 	// полный маршрут получится "/api/v1/employees"
-	c.server.GroupApiV1.Post("/employees", c.CreateEmployee)
-	c.server.GroupApiV1.Get("/employees", c.FindAll)
+	c.server.GroupApiV1.Post("/employees", write, c.CreateEmployee)
+	c.server.GroupApiV1.Get("/employees", read, withDeleted, c.FindAll)
+	// "/employees/batch", "/employees/search" и "/employees/export" регистрируются раньше "/employees/:id",
+	// иначе "batch", "search" и "export" будут разобраны как id
+	c.server.GroupApiV1.Get("/employees/batch", read, c.FindAllByIds)
+	c.server.GroupApiV1.Get("/employees/search", read, c.Search)
+	c.server.GroupApiV1.Get("/employees/export", read, withDeleted, c.Export)
+	c.server.GroupApiV1.Delete("/employees/batch", write, c.DeleteAllByIds)
+	// окончательное удаление тех, чей срок хранения после мягкого удаления истёк
+	c.server.GroupApiV1.Post("/employees/purge", c.server.Require("employees:purge"), c.Purge)
+	c.server.GroupApiV1.Get("/employees/:id", read, withDeleted, c.FindById)
+	c.server.GroupApiV1.Put("/employees/:id", write, c.UpdateEmployee)
+	c.server.GroupApiV1.Patch("/employees/:id", write, c.PatchEmployee)
+	c.server.GroupApiV1.Delete("/employees/:id", write, c.DeleteEmployee)
+	c.server.GroupApiV1.Post("/employees/:id/restore", restore, c.Restore)
+	// назначение, смена и снятие роли сотрудника
+	c.server.GroupApiV1.Put("/employees/:id/role", grant, c.AssignRole)
+	c.server.GroupApiV1.Delete("/employees/:id/role", grant, c.RevokeRole)
+	// все выданные сотруднику роли (связь многие-ко-многим через employee_role)
+	c.server.GroupApiV1.Get("/employees/:id/roles", read, c.FindRoles)
+	c.server.GroupApiV1.Put("/employees/:id/roles/:roleId", grant, c.AddRole)
+	c.server.GroupApiV1.Delete("/employees/:id/roles/:roleId", grant, c.RemoveRole)
+	// жизненный цикл: выход на работу, приостановка, увольнение — и история переходов
+	c.server.GroupApiV1.Post("/employees/:id/status", write, c.ChangeStatus)
+	c.server.GroupApiV1.Get("/employees/:id/status-history", read, c.FindStatusHistory)
+
+	// полный путь будет "/internal/employees/purge" — для запуска очистки по расписанию
+	c.server.GroupInternal.Post("/employees/purge", c.Purge)
 }
 
 // функция-хендлер, которая будет вызываться при POST запросе по маршруту "/api/v1/employees"
@@ -60,14 +114,9 @@ func (c *Controller) CreateEmployee(ctx *fiber.Ctx) {
 	}
 
 	// вызываем метод CreateEmployee сервиса employee.Service
-	var newEmployeeId, err = c.employeeService.CreateEmployee(request)
+	var newEmployeeId, err = c.employeeService.CreateEmployee(audit.ActorFrom(c.server, ctx), request)
 	if err != nil {
-		switch {
-		case errors.As(err, &common.RequestValidationError{}) || errors.As(err, &common.AlreadyExistsError{}):
-			_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
-		default:
-			_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
-		}
+		errResponse(ctx, err)
 		return
 	}
 
@@ -79,22 +128,436 @@ func (c *Controller) CreateEmployee(ctx *fiber.Ctx) {
 	}
 }
 
+// функция-хендлер для GET запроса по маршруту
+// "/api/v1/employees?limit=&cursor=&sort=&name=&role_id=&created_from=&created_to=&include_deleted="
 func (c *Controller) FindAll(ctx *fiber.Ctx) {
-	_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "internal validation error")
+	var request FindRequest
+	if err := ctx.QueryParser(&request); err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+	request.IncludeDeleted = common.IncludeDeleted(ctx)
 
-	all, err := c.employeeService.FindAll()
+	employees, page, err := c.employeeService.FindPage(request)
 	if err != nil {
-		switch {
-		case errors.As(err, &common.RequestValidationError{}) || errors.As(err, &common.AlreadyExistsError{}):
-			_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
-		default:
-			_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
-		}
+		errResponse(ctx, err)
 		return
 	}
-	err = common.OkResponse(ctx, all)
+	err = common.PageResponse(ctx, employees, page)
 	if err != nil {
-		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning created employee id")
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning employees")
+		return
+	}
+}
+
+// функция-хендлер для GET запроса по маршруту "/api/v1/employees/export?format=csv|json|xlsx&<фильтры списка>".
+// Файл пишется по мере чтения сотрудников из базы: статус 200 уже отправлен, поэтому ошибка
+// посреди выгрузки только обрывает файл
+func (c *Controller) Export(ctx *fiber.Ctx) {
+	var request ExportRequest
+	if err := ctx.QueryParser(&request); err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+	request.IncludeDeleted = common.IncludeDeleted(ctx)
+
+	export, err := c.employeeService.Export(request)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	ctx.Attachment("employees." + request.Format)
+	ctx.Set(fiber.HeaderContentType, ExportContentTypes[request.Format])
+	ctx.Fasthttp.SetBodyStreamWriter(func(w *bufio.Writer) {
+		_ = export(w)
+	})
+}
+
+// функция-хендлер для GET запроса по маршруту "/api/v1/employees/:id[?include_deleted=true]"
+func (c *Controller) FindById(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	find := c.employeeService.FindById
+	if common.IncludeDeleted(ctx) {
+		find = c.employeeService.FindByIdIncludingDeleted
+	}
+	employee, err := find(id)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, employee)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning employee")
+		return
+	}
+}
+
+// функция-хендлер для GET запроса по маршруту "/api/v1/employees/batch?ids=1,2,3"
+func (c *Controller) FindAllByIds(ctx *fiber.Ctx) {
+	ids, err := common.ParseIds(ctx.Query("ids"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	employees, err := c.employeeService.FindAllByIds(ids)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, employees)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning employees")
+		return
+	}
+}
+
+// функция-хендлер для GET запроса по маршруту "/api/v1/employees/search?q=&limit="
+func (c *Controller) Search(ctx *fiber.Ctx) {
+	var request SearchRequest
+	if err := ctx.QueryParser(&request); err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	employees, err := c.employeeService.Search(request)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, employees)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning found employees")
+		return
+	}
+}
+
+// функция-хендлер для PUT запроса по маршруту "/api/v1/employees/:id"
+func (c *Controller) UpdateEmployee(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	var request UpdateRequest
+	if err := ctx.BodyParser(&request); err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	employee, err := c.employeeService.UpdateEmployee(audit.ActorFrom(c.server, ctx), id, request)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, employee)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning updated employee")
+		return
+	}
+}
+
+// функция-хендлер для PATCH запроса по маршруту "/api/v1/employees/:id"
+func (c *Controller) PatchEmployee(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	var request PatchRequest
+	if err := ctx.BodyParser(&request); err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	employee, err := c.employeeService.PatchEmployee(audit.ActorFrom(c.server, ctx), id, request)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, employee)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning updated employee")
+		return
+	}
+}
+
+// функция-хендлер для DELETE запроса по маршруту "/api/v1/employees/:id"
+func (c *Controller) DeleteEmployee(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = c.employeeService.Delete(audit.ActorFrom(c.server, ctx), id); err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, id)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning deleted employee id")
+		return
+	}
+}
+
+// функция-хендлер для DELETE запроса по маршруту "/api/v1/employees/batch?ids=1,2,3"
+func (c *Controller) DeleteAllByIds(ctx *fiber.Ctx) {
+	ids, err := common.ParseIds(ctx.Query("ids"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = c.employeeService.DeleteAllByIds(audit.ActorFrom(c.server, ctx), ids); err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, ids)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning deleted employee ids")
+		return
+	}
+}
+
+// функция-хендлер для POST запроса по маршруту "/api/v1/employees/:id/restore"
+func (c *Controller) Restore(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	employee, err := c.employeeService.Restore(audit.ActorFrom(c.server, ctx), id)
+	if err != nil {
+		errResponse(ctx, err)
 		return
 	}
+
+	err = common.OkResponse(ctx, employee)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning restored employee")
+		return
+	}
+}
+
+// функция-хендлер для POST запроса по маршрутам "/api/v1/employees/purge" и "/internal/employees/purge"
+func (c *Controller) Purge(ctx *fiber.Ctx) {
+	ids, err := c.employeeService.Purge(audit.ActorFrom(c.server, ctx))
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, ids)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning purged employee ids")
+		return
+	}
+}
+
+// функция-хендлер для PUT запроса по маршруту "/api/v1/employees/:id/role"
+func (c *Controller) AssignRole(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	var request RoleRequest
+	if err := ctx.BodyParser(&request); err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	employee, err := c.employeeService.AssignRole(audit.ActorFrom(c.server, ctx), id, request)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, employee)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning updated employee")
+		return
+	}
+}
+
+// функция-хендлер для DELETE запроса по маршруту "/api/v1/employees/:id/role"
+func (c *Controller) RevokeRole(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	employee, err := c.employeeService.RevokeRole(audit.ActorFrom(c.server, ctx), id)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, employee)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning updated employee")
+		return
+	}
+}
+
+// функция-хендлер для GET запроса по маршруту "/api/v1/employees/:id/roles"
+func (c *Controller) FindRoles(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	roles, err := c.employeeService.FindRoles(id)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, roles)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning employee roles")
+		return
+	}
+}
+
+// функция-хендлер для PUT запроса по маршруту "/api/v1/employees/:id/roles/:roleId"
+func (c *Controller) AddRole(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+	roleId, err := common.ParseId(ctx.Params("roleId"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = c.employeeService.AddRole(audit.ActorFrom(c.server, ctx), id, roleId); err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	// в ответ отдаём актуальный список ролей сотрудника
+	roles, err := c.employeeService.FindRoles(id)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, roles)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning employee roles")
+		return
+	}
+}
+
+// функция-хендлер для DELETE запроса по маршруту "/api/v1/employees/:id/roles/:roleId"
+func (c *Controller) RemoveRole(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+	roleId, err := common.ParseId(ctx.Params("roleId"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = c.employeeService.RemoveRole(audit.ActorFrom(c.server, ctx), id, roleId); err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, roleId)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning revoked role id")
+		return
+	}
+}
+
+// функция-хендлер для POST запроса по маршруту "/api/v1/employees/:id/status"
+func (c *Controller) ChangeStatus(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	var request StatusRequest
+	if err := ctx.BodyParser(&request); err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	employee, err := c.employeeService.ChangeStatus(audit.ActorFrom(c.server, ctx), id, request)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, employee)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning updated employee")
+		return
+	}
+}
+
+// функция-хендлер для GET запроса по маршруту "/api/v1/employees/:id/status-history"
+func (c *Controller) FindStatusHistory(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	history, err := c.employeeService.FindStatusHistory(id)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, history)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning employee status history")
+		return
+	}
+}
+
+// errResponse сопоставляет ошибку сервиса с кодом ответа:
+// 400 — ошибки валидации, 403 — недостаточно прав, 404 — ресурс не найден, 409 — дубликаты, 500 — всё остальное
+func errResponse(ctx *fiber.Ctx, err error) {
+	switch {
+	case errors.As(err, &common.RequestValidationError{}):
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+	case errors.As(err, &common.NotFoundError{}):
+		_ = common.ErrResponse(ctx, fiber.StatusNotFound, err.Error())
+	case errors.As(err, &common.AlreadyExistsError{}):
+		_ = common.ErrResponse(ctx, fiber.StatusConflict, err.Error())
+	case errors.As(err, &common.PermissionDeniedError{}):
+		_ = common.ErrResponse(ctx, fiber.StatusForbidden, err.Error())
+	default:
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+	}
 }
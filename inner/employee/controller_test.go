@@ -6,8 +6,10 @@ import (
 	"github.com/gofiber/fiber"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"idm/inner/audit"
 	"idm/inner/common"
 	"idm/inner/web"
+	"io"
 	"net/http/httptest"
 	"testing"
 )
@@ -23,14 +25,100 @@ func (svc *MockService) FindById(id int64) (Response, error) {
 	return args.Get(0).(Response), args.Error(1)
 }
 
-func (svc *MockService) FindAll() ([]Response, error) {
-	args := svc.Called()
+func (svc *MockService) FindPage(request FindRequest) ([]Response, common.Page, error) {
+	args := svc.Called(request)
+	return args.Get(0).([]Response), args.Get(1).(common.Page), args.Error(2)
+}
+
+func (svc *MockService) CreateEmployee(actor audit.Actor, request CreateRequest) (int64, error) {
+	args := svc.Called(actor, request)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (svc *MockService) FindAllByIds(ids []int64) ([]Response, error) {
+	args := svc.Called(ids)
 	return args.Get(0).([]Response), args.Error(1)
 }
 
-func (svc *MockService) CreateEmployee(request CreateRequest) (int64, error) {
+func (svc *MockService) UpdateEmployee(actor audit.Actor, id int64, request UpdateRequest) (Response, error) {
+	args := svc.Called(actor, id, request)
+	return args.Get(0).(Response), args.Error(1)
+}
+
+func (svc *MockService) PatchEmployee(actor audit.Actor, id int64, request PatchRequest) (Response, error) {
+	args := svc.Called(actor, id, request)
+	return args.Get(0).(Response), args.Error(1)
+}
+
+func (svc *MockService) Delete(actor audit.Actor, id int64) error {
+	args := svc.Called(actor, id)
+	return args.Error(0)
+}
+
+func (svc *MockService) DeleteAllByIds(actor audit.Actor, ids []int64) error {
+	args := svc.Called(actor, ids)
+	return args.Error(0)
+}
+
+func (svc *MockService) AssignRole(actor audit.Actor, id int64, request RoleRequest) (Response, error) {
+	args := svc.Called(actor, id, request)
+	return args.Get(0).(Response), args.Error(1)
+}
+
+func (svc *MockService) RevokeRole(actor audit.Actor, id int64) (Response, error) {
+	args := svc.Called(actor, id)
+	return args.Get(0).(Response), args.Error(1)
+}
+
+func (svc *MockService) FindRoles(id int64) ([]RoleResponse, error) {
+	args := svc.Called(id)
+	return args.Get(0).([]RoleResponse), args.Error(1)
+}
+
+func (svc *MockService) AddRole(actor audit.Actor, id int64, roleId int64) error {
+	args := svc.Called(actor, id, roleId)
+	return args.Error(0)
+}
+
+func (svc *MockService) RemoveRole(actor audit.Actor, id int64, roleId int64) error {
+	args := svc.Called(actor, id, roleId)
+	return args.Error(0)
+}
+
+func (svc *MockService) FindByIdIncludingDeleted(id int64) (Response, error) {
+	args := svc.Called(id)
+	return args.Get(0).(Response), args.Error(1)
+}
+
+func (svc *MockService) Restore(actor audit.Actor, id int64) (Response, error) {
+	args := svc.Called(actor, id)
+	return args.Get(0).(Response), args.Error(1)
+}
+
+func (svc *MockService) Purge(actor audit.Actor) ([]int64, error) {
+	args := svc.Called(actor)
+	return args.Get(0).([]int64), args.Error(1)
+}
+
+func (svc *MockService) ChangeStatus(actor audit.Actor, id int64, request StatusRequest) (Response, error) {
+	args := svc.Called(actor, id, request)
+	return args.Get(0).(Response), args.Error(1)
+}
+
+func (svc *MockService) FindStatusHistory(id int64) ([]StatusHistoryResponse, error) {
+	args := svc.Called(id)
+	return args.Get(0).([]StatusHistoryResponse), args.Error(1)
+}
+
+func (svc *MockService) Search(request SearchRequest) ([]SearchResponse, error) {
 	args := svc.Called(request)
-	return args.Get(0).(int64), args.Error(1)
+	return args.Get(0).([]SearchResponse), args.Error(1)
+}
+
+func (svc *MockService) Export(request ExportRequest) (func(w io.Writer) error, error) {
+	args := svc.Called(request)
+	export, _ := args.Get(0).(func(w io.Writer) error)
+	return export, args.Error(1)
 }
 
 func getTestRequestBody(req CreateRequest) *bytes.Buffer {
@@ -54,7 +142,7 @@ func TestController(t *testing.T) {
 		request := httptest.NewRequest(fiber.MethodPost, "/api/v1/employees", body)
 		request.Header.Set("Content-Type", "application/json")
 
-		mockService.On("CreateEmployee", req).Return(int64(123), nil)
+		mockService.On("CreateEmployee", mock.Anything, req).Return(int64(123), nil)
 		actualResp, err := server.App.Test(request)
 		assert.NoError(t, err)
 
@@ -68,6 +156,23 @@ func TestController(t *testing.T) {
 		mockService.AssertExpectations(t)
 	})
 
+	t.Run("CreateWithLargeRoleId", func(t *testing.T) {
+		largeRoleId := int64(1000)
+		req := CreateRequest{
+			Name:   "John Doe",
+			RoleId: &largeRoleId,
+		}
+		body := getTestRequestBody(req)
+		request := httptest.NewRequest(fiber.MethodPost, "/api/v1/employees", body)
+		request.Header.Set("Content-Type", "application/json")
+
+		mockService.On("CreateEmployee", mock.Anything, req).Return(int64(124), nil)
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	})
+
 	t.Run("ValidationFailed", func(t *testing.T) {
 		req := CreateRequest{
 			Name: "John Doe",
@@ -77,7 +182,7 @@ func TestController(t *testing.T) {
 		request := httptest.NewRequest(fiber.MethodPost, "/api/v1/employees", body)
 		request.Header.Set("Content-Type", "application/json")
 
-		mockService.On("CreateEmployee", req).Return(int64(123), nil)
+		mockService.On("CreateEmployee", mock.Anything, req).Return(int64(123), nil)
 		resp, err := server.App.Test(request)
 		assert.NoError(t, err)
 
@@ -101,7 +206,7 @@ func TestController(t *testing.T) {
 		request := httptest.NewRequest(fiber.MethodPost, "/api/v1/employees", body)
 		request.Header.Set("Content-Type", "application/json")
 
-		mockService.On("CreateEmployee", req).Return(int64(2), common.AlreadyExistsError{})
+		mockService.On("CreateEmployee", mock.Anything, req).Return(int64(2), common.AlreadyExistsError{})
 		resp, err := server.App.Test(request)
 
 		assert.NoError(t, err)
@@ -110,7 +215,7 @@ func TestController(t *testing.T) {
 		err = json.NewDecoder(resp.Body).Decode(&response)
 		assert.NoError(t, err)
 
-		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, fiber.StatusConflict, resp.StatusCode)
 		assert.False(t, response.Success)
 		assert.Contains(t, response.Message, "already exists")
 
@@ -127,7 +232,7 @@ func TestController(t *testing.T) {
 		request := httptest.NewRequest(fiber.MethodPost, "/api/v1/employees", body)
 		request.Header.Set("Content-Type", "application/json")
 
-		mockService.On("CreateEmployee", req).Return(int64(1), &common.InternalServerError{})
+		mockService.On("CreateEmployee", mock.Anything, req).Return(int64(1), &common.InternalServerError{})
 
 		resp, err := server.App.Test(request)
 		assert.NoError(t, err)
@@ -141,3 +246,538 @@ func TestController(t *testing.T) {
 		assert.Contains(t, response.Message, "Internal server error")
 	})
 }
+
+func TestControllerCrud(t *testing.T) {
+	roleId := int64(2)
+	mockService := new(MockService)
+	server := web.NewServer()
+	controller := NewController(server, mockService)
+	controller.RegisterRoutes()
+
+	t.Run("FindByIdSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		want := Response{Id: 1, Name: "John Doe"}
+		mockService.On("FindById", int64(1)).Return(want, nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/employees/1", nil))
+		assert.NoError(t, err)
+
+		var response common.Response[Response]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.True(t, response.Success)
+		assert.Equal(t, "John Doe", response.Data.Name)
+	})
+
+	t.Run("FindByIdNotFound", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("FindById", int64(5)).Return(Response{}, common.NotFoundError{Resource: "employee", ID: 5})
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/employees/5", nil))
+		assert.NoError(t, err)
+
+		var response common.Response[any]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+		assert.False(t, response.Success)
+		assert.Contains(t, response.Message, "not found")
+	})
+
+	t.Run("FindByIdInvalidId", func(t *testing.T) {
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/employees/abc", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("FindAllByIdsSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		want := []Response{{Id: 1}, {Id: 2}}
+		mockService.On("FindAllByIds", []int64{1, 2}).Return(want, nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/employees/batch?ids=1,2", nil))
+		assert.NoError(t, err)
+
+		var response common.Response[[]Response]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Len(t, response.Data, 2)
+	})
+
+	t.Run("UpdateSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		req := UpdateRequest{Name: "Jane Doe", RoleId: &roleId}
+		body, _ := json.Marshal(req)
+		request := httptest.NewRequest(fiber.MethodPut, "/api/v1/employees/1", bytes.NewBuffer(body))
+		request.Header.Set("Content-Type", "application/json")
+		mockService.On("UpdateEmployee", mock.Anything, int64(1), req).Return(Response{Id: 1, Name: "Jane Doe"}, nil)
+
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("UpdateValidationFailed", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		req := UpdateRequest{Name: "J", RoleId: &roleId}
+		body, _ := json.Marshal(req)
+		request := httptest.NewRequest(fiber.MethodPut, "/api/v1/employees/1", bytes.NewBuffer(body))
+		request.Header.Set("Content-Type", "application/json")
+		mockService.On("UpdateEmployee", mock.Anything, int64(1), req).
+			Return(Response{}, common.RequestValidationError{FieldErrors: map[string]string{"Name": "must be at least 2 characters"}})
+
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("PatchNotFound", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		name := "Jane Doe"
+		req := PatchRequest{Name: &name}
+		body, _ := json.Marshal(req)
+		request := httptest.NewRequest(fiber.MethodPatch, "/api/v1/employees/7", bytes.NewBuffer(body))
+		request.Header.Set("Content-Type", "application/json")
+		mockService.On("PatchEmployee", mock.Anything, int64(7), req).Return(Response{}, common.NotFoundError{Resource: "employee", ID: 7})
+
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("DeleteSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("Delete", mock.Anything, int64(1)).Return(nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodDelete, "/api/v1/employees/1", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("DeleteNotFound", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("Delete", mock.Anything, int64(9)).Return(common.NotFoundError{Resource: "employee", ID: 9})
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodDelete, "/api/v1/employees/9", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("DeleteAllByIdsSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("DeleteAllByIds", mock.Anything, []int64{1, 2}).Return(nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodDelete, "/api/v1/employees/batch?ids=1,2", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("DeleteAllByIdsWithoutIds", func(t *testing.T) {
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodDelete, "/api/v1/employees/batch", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("AssignRoleSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		roleName := "Менеджер"
+		req := RoleRequest{RoleId: roleId}
+		body, _ := json.Marshal(req)
+		request := httptest.NewRequest(fiber.MethodPut, "/api/v1/employees/1/role", bytes.NewBuffer(body))
+		request.Header.Set("Content-Type", "application/json")
+		mockService.On("AssignRole", mock.Anything, int64(1), req).Return(Response{Id: 1, RoleId: &roleId, RoleName: &roleName}, nil)
+
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+
+		var response common.Response[map[string]any]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, float64(roleId), response.Data["role_id"])
+		assert.Equal(t, roleName, response.Data["role_name"])
+	})
+
+	t.Run("AssignMissingRole", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		req := RoleRequest{RoleId: 42}
+		body, _ := json.Marshal(req)
+		request := httptest.NewRequest(fiber.MethodPut, "/api/v1/employees/1/role", bytes.NewBuffer(body))
+		request.Header.Set("Content-Type", "application/json")
+		mockService.On("AssignRole", mock.Anything, int64(1), req).Return(Response{}, common.NotFoundError{Resource: "role", ID: 42})
+
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("RevokeRoleSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("RevokeRole", mock.Anything, int64(1)).Return(Response{Id: 1}, nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodDelete, "/api/v1/employees/1/role", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("FindRolesSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		roles := []RoleResponse{{Id: 1, Name: "Администратор"}, {Id: 3, Name: "Разработчик"}}
+		mockService.On("FindRoles", int64(1)).Return(roles, nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/employees/1/roles", nil))
+		assert.NoError(t, err)
+
+		var response common.Response[[]RoleResponse]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, roles, response.Data)
+	})
+
+	t.Run("AddRoleSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("AddRole", mock.Anything, int64(1), int64(3)).Return(nil)
+		mockService.On("FindRoles", int64(1)).Return([]RoleResponse{{Id: 3, Name: "Разработчик"}}, nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodPut, "/api/v1/employees/1/roles/3", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("AddMissingRole", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("AddRole", mock.Anything, int64(1), int64(42)).Return(common.NotFoundError{Resource: "role", ID: 42})
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodPut, "/api/v1/employees/1/roles/42", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("RemoveRoleSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("RemoveRole", mock.Anything, int64(1), int64(3)).Return(nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodDelete, "/api/v1/employees/1/roles/3", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		mockService.AssertExpectations(t)
+	})
+}
+
+// denyAuthorizer отказывает во всех правах, кроме перечисленных
+type denyAuthorizer struct {
+	allowed map[string]bool
+}
+
+func (a denyAuthorizer) Authorize(ctx *fiber.Ctx, permission string) {
+	if !a.allowed[permission] {
+		_ = common.ErrResponse(ctx, fiber.StatusForbidden, "permission "+permission+" is required")
+		return
+	}
+	ctx.Next()
+}
+
+func (a denyAuthorizer) HasPermission(_ *fiber.Ctx, permission string) (bool, error) {
+	return a.allowed[permission], nil
+}
+
+func TestControllerSoftDelete(t *testing.T) {
+	mockService := new(MockService)
+	server := web.NewServer()
+	controller := NewController(server, mockService)
+	controller.RegisterRoutes()
+
+	t.Run("FindAllIncludingDeleted", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("FindPage", FindRequest{IncludeDeleted: true}).Return([]Response{{Id: 1}, {Id: 2}}, common.Page{Total: 2}, nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/employees?include_deleted=true", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("FindDeletedById", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("FindByIdIncludingDeleted", int64(5)).Return(Response{Id: 5}, nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/employees/5?include_deleted=1", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("RestoreSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("Restore", mock.Anything, int64(5)).Return(Response{Id: 5, Name: "John Doe"}, nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodPost, "/api/v1/employees/5/restore", nil))
+		assert.NoError(t, err)
+
+		var response common.Response[Response]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, "John Doe", response.Data.Name)
+	})
+
+	t.Run("RestoreNotDeleted", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("Restore", mock.Anything, int64(1)).Return(Response{}, common.NotFoundError{Resource: "deleted employee", ID: 1})
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodPost, "/api/v1/employees/1/restore", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("Purge", mock.Anything).Return([]int64{3, 4}, nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodPost, "/internal/employees/purge", nil))
+		assert.NoError(t, err)
+
+		var response common.Response[[]int64]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, []int64{3, 4}, response.Data)
+	})
+}
+
+func TestControllerIncludeDeletedPermission(t *testing.T) {
+	mockService := new(MockService)
+	server := web.NewServer()
+	server.Authorizer = denyAuthorizer{allowed: map[string]bool{"employees:read": true}}
+	controller := NewController(server, mockService)
+	controller.RegisterRoutes()
+
+	t.Run("ActiveEmployeesAllowed", func(t *testing.T) {
+		mockService.On("FindPage", FindRequest{}).Return([]Response{}, common.Page{}, nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/employees", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("DeletedEmployeesForbidden", func(t *testing.T) {
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/employees?include_deleted=true", nil))
+		assert.NoError(t, err)
+
+		var response common.Response[any]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+		assert.Equal(t, "permission employees:restore is required", response.Message)
+		assert.True(t, mockService.AssertNotCalled(t, "FindPage", FindRequest{IncludeDeleted: true}))
+	})
+
+	t.Run("PurgeForbidden", func(t *testing.T) {
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodPost, "/api/v1/employees/purge", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+		assert.True(t, mockService.AssertNotCalled(t, "Purge", mock.Anything))
+	})
+}
+
+func TestControllerLifecycle(t *testing.T) {
+	mockService := new(MockService)
+	server := web.NewServer()
+	controller := NewController(server, mockService)
+	controller.RegisterRoutes()
+
+	t.Run("ChangeStatusSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		request := StatusRequest{Status: StatusSuspended, Reason: "on leave"}
+		mockService.On("ChangeStatus", mock.Anything, int64(1), request).Return(Response{Id: 1, Status: StatusSuspended}, nil)
+
+		body, _ := json.Marshal(request)
+		req := httptest.NewRequest(fiber.MethodPost, "/api/v1/employees/1/status", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := server.App.Test(req)
+		assert.NoError(t, err)
+
+		var response common.Response[Response]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, StatusSuspended, response.Data.Status)
+	})
+
+	t.Run("ChangeStatusNotAllowed", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("ChangeStatus", mock.Anything, int64(1), mock.Anything).
+			Return(Response{}, common.RequestValidationError{FieldErrors: map[string]string{"status": "employee cannot change status from terminated to active"}})
+
+		req := httptest.NewRequest(fiber.MethodPost, "/api/v1/employees/1/status", bytes.NewBufferString(`{"status":"active","reason":"rehired"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := server.App.Test(req)
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("FindStatusHistory", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		active := StatusActive
+		mockService.On("FindStatusHistory", int64(1)).Return([]StatusHistoryResponse{
+			{Id: 1, ToStatus: StatusActive},
+			{Id: 2, FromStatus: &active, ToStatus: StatusSuspended, Reason: "on leave"},
+		}, nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/employees/1/status-history", nil))
+		assert.NoError(t, err)
+
+		var response common.Response[[]StatusHistoryResponse]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, 2, len(response.Data))
+		assert.Nil(t, response.Data[0].FromStatus)
+		assert.Equal(t, "on leave", response.Data[1].Reason)
+	})
+}
+
+func TestControllerFindPage(t *testing.T) {
+	mockService := new(MockService)
+	server := web.NewServer()
+	controller := NewController(server, mockService)
+	controller.RegisterRoutes()
+
+	t.Run("PageWithFilters", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		request := FindRequest{
+			PageRequest: common.PageRequest{Limit: 2, Cursor: "abc", Sort: "-created_at"},
+			Name:        "Ив",
+			RoleId:      3,
+			CreatedFrom: "2024-01-01T00:00:00Z",
+		}
+		mockService.On("FindPage", request).
+			Return([]Response{{Id: 4}, {Id: 2}}, common.Page{Total: 5, NextCursor: "next"}, nil)
+
+		url := "/api/v1/employees?limit=2&cursor=abc&sort=-created_at&name=%D0%98%D0%B2&role_id=3&created_from=2024-01-01T00:00:00Z"
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, url, nil))
+		assert.NoError(t, err)
+
+		var response common.Response[[]Response]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, 2, len(response.Data))
+		assert.Equal(t, int64(5), response.Page.Total)
+		assert.Equal(t, "next", response.Page.NextCursor)
+	})
+
+	t.Run("InvalidSort", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("FindPage", mock.Anything).
+			Return([]Response{}, common.Page{}, common.RequestValidationError{FieldErrors: map[string]string{"sort": "is invalid"}})
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/employees?sort=salary", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("InvalidLimit", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/employees?limit=many", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestControllerSearch(t *testing.T) {
+	mockService := new(MockService)
+	server := web.NewServer()
+	controller := NewController(server, mockService)
+	controller.RegisterRoutes()
+
+	t.Run("SearchSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		roleName := "Менеджер"
+		mockService.On("Search", SearchRequest{Q: "сидорова", Limit: 5}).Return([]SearchResponse{
+			{Response: Response{Id: 2, Name: "Сидорова Анна", RoleName: &roleName}, Rank: 1},
+		}, nil)
+
+		url := "/api/v1/employees/search?q=%D1%81%D0%B8%D0%B4%D0%BE%D1%80%D0%BE%D0%B2%D0%B0&limit=5"
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, url, nil))
+		assert.NoError(t, err)
+
+		var response common.Response[[]SearchResponse]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, "Сидорова Анна", response.Data[0].Name)
+		assert.Equal(t, "Менеджер", *response.Data[0].RoleName)
+		assert.Equal(t, float64(1), response.Data[0].Rank)
+		assert.True(t, mockService.AssertNotCalled(t, "FindById", mock.Anything))
+	})
+
+	t.Run("SearchWithoutQuery", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("Search", SearchRequest{}).
+			Return([]SearchResponse{}, common.RequestValidationError{FieldErrors: map[string]string{"Q": "is required"}})
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/employees/search", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestControllerExport(t *testing.T) {
+	mockService := new(MockService)
+	server := web.NewServer()
+	controller := NewController(server, mockService)
+	controller.RegisterRoutes()
+
+	t.Run("ExportSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		request := ExportRequest{FindRequest: FindRequest{RoleId: 2}, Format: ExportCsv}
+		export := func(w io.Writer) error {
+			_, err := io.WriteString(w, "id,name\n2,Сидорова Анна\n")
+			return err
+		}
+		mockService.On("Export", request).Return(export, nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/employees/export?format=csv&role_id=2", nil))
+		assert.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, ExportContentTypes[ExportCsv], resp.Header.Get(fiber.HeaderContentType))
+		assert.Contains(t, resp.Header.Get(fiber.HeaderContentDisposition), `filename="employees.csv"`)
+		assert.Equal(t, "id,name\n2,Сидорова Анна\n", string(body))
+		assert.True(t, mockService.AssertNotCalled(t, "FindById", mock.Anything))
+	})
+
+	t.Run("ExportInvalidFormat", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("Export", ExportRequest{Format: "pdf"}).
+			Return(nil, common.RequestValidationError{FieldErrors: map[string]string{"format": "must be one of csv json xlsx"}})
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/employees/export?format=pdf", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	})
+}
@@ -1,21 +1,32 @@
 package employee
 
-import "time"
+import (
+	"github.com/lib/pq"
+	"idm/inner/common"
+	"time"
+)
 
 type Entity struct {
-	Id        int64     `db:"id"`
-	Name      string    `db:"name"`
-	RoleID    *int64    `db:"role_id"`
-	CreatedAt time.Time `db:"created_at"`
-	UpdatedAt time.Time `db:"updated_at"`
+	Id        int64      `db:"id"`
+	Name      string     `db:"name"`
+	RoleID    *int64     `db:"role_id"`
+	RoleName  *string    `db:"role_name"`
+	Status    string     `db:"status"`
+	CreatedAt time.Time  `db:"created_at"`
+	UpdatedAt time.Time  `db:"updated_at"`
+	DeletedAt *time.Time `db:"deleted_at"`
 }
 
 func (e *Entity) toResponse() Response {
 	return Response{
 		Id:        e.Id,
 		Name:      e.Name,
+		RoleId:    e.RoleID,
+		RoleName:  e.RoleName,
+		Status:    e.Status,
 		CreatedAt: e.CreatedAt,
 		UpdatedAt: e.UpdatedAt,
+		DeletedAt: e.DeletedAt,
 	}
 }
 
@@ -27,20 +38,228 @@ func toSliceResponse(e []Entity) []Response {
 	return responses
 }
 
+// состояния жизненного цикла сотрудника
+const (
+	StatusPending    = "pending"
+	StatusActive     = "active"
+	StatusSuspended  = "suspended"
+	StatusTerminated = "terminated"
+)
+
 type Response struct {
-	Id        int64     `*json:"id"`
-	Name      string    `*json:"name"`
-	RoleId    *int64    `*json:"role_id"`
+	Id        int64     `json:"id"`
+	Name      string    `json:"name"`
+	RoleId    *int64    `json:"role_id"`
+	RoleName  *string   `json:"role_name"`
+	Status    string    `json:"status"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// DeletedAt заполнено только у мягко удалённых сотрудников, которые видны с include_deleted=true
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// FindRequest постраничный список сотрудников с фильтрами из query-параметров;
+// sort — name, created_at или updated_at, время в формате RFC 3339, границы включительно
+type FindRequest struct {
+	common.PageRequest
+	Name        string `query:"name" validate:"omitempty,max=155"`
+	RoleId      int64  `query:"role_id" validate:"omitempty,min=1"`
+	CreatedFrom string `query:"created_from" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	CreatedTo   string `query:"created_to" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	// IncludeDeleted задаётся контроллером по include_deleted после проверки права на удалённых
+	IncludeDeleted bool `query:"-"`
+}
+
+// Filter разобранный FindRequest для репозитория; пустые поля не ограничивают выборку,
+// RoleId — сотрудники, которым выдана роль, основная она или дополнительная
+type Filter struct {
+	NamePrefix     string
+	RoleId         int64
+	CreatedFrom    *time.Time
+	CreatedTo      *time.Time
+	IncludeDeleted bool
+	Sort           common.Sort
+	After          *common.Cursor
+	Limit          int
+}
+
+// SearchRequest поиск сотрудников по имени; регистр и ё/е не различаются, опечатки допускаются
+type SearchRequest struct {
+	Q     string `query:"q" validate:"required,min=2,max=155"`
+	Limit int    `query:"limit" validate:"omitempty,min=1,max=100"`
+}
+
+// SearchEntity найденный сотрудник и релевантность совпадения
+type SearchEntity struct {
+	Entity
+	Rank float64 `db:"rank"`
+}
+
+func toSliceSearchResponse(e []SearchEntity) []SearchResponse {
+	responses := make([]SearchResponse, len(e))
+	for i := range e {
+		responses[i] = SearchResponse{Response: e[i].toResponse(), Rank: e[i].Rank}
+	}
+	return responses
+}
+
+// SearchResponse сотрудник с его ролью и релевантностью от 0 до 1; результаты упорядочены по убыванию Rank
+type SearchResponse struct {
+	Response
+	Rank float64 `json:"rank"`
 }
 
 type CreateRequest struct {
 	Name   string `json:"name" validate:"required,min=2,max=155"`
-	RoleId *int64 `json:"roleId" validate:"required,min=1,max=155"`
+	RoleId *int64 `json:"roleId" validate:"required,min=1"`
+	// Status начальное состояние: pending для принятых, но ещё не вышедших (по умолчанию) или active
+	Status string `json:"status" validate:"omitempty,oneof=pending active"`
 }
 
 func (req *CreateRequest) ToEntity() Entity {
 	return Entity{Name: req.Name,
-		RoleID: req.RoleId}
+		RoleID: req.RoleId,
+		Status: req.Status}
+}
+
+type UpdateRequest struct {
+	Name   string `json:"name" validate:"required,min=2,max=155"`
+	RoleId *int64 `json:"roleId" validate:"required,min=1"`
+}
+
+func (req *UpdateRequest) ToEntity(id int64) Entity {
+	return Entity{
+		Id:     id,
+		Name:   req.Name,
+		RoleID: req.RoleId,
+	}
+}
+
+// PatchRequest частичное обновление сотрудника: применяются только переданные поля
+type PatchRequest struct {
+	Name   *string `json:"name" validate:"omitempty,min=2,max=155"`
+	RoleId *int64  `json:"roleId" validate:"omitempty,min=1"`
+}
+
+func (req *PatchRequest) apply(entity Entity) Entity {
+	if req.Name != nil {
+		entity.Name = *req.Name
+	}
+	if req.RoleId != nil {
+		entity.RoleID = req.RoleId
+	}
+	return entity
+}
+
+// RoleRequest назначение или смена роли сотрудника
+type RoleRequest struct {
+	RoleId int64 `json:"roleId" validate:"required,min=1"`
+}
+
+// RoleEntity роль, выданная сотруднику
+type RoleEntity struct {
+	Id        int64     `db:"id"`
+	Name      string    `db:"name"`
+	GrantedAt time.Time `db:"granted_at"`
+}
+
+func (e *RoleEntity) toResponse() RoleResponse {
+	return RoleResponse{
+		Id:        e.Id,
+		Name:      e.Name,
+		GrantedAt: e.GrantedAt,
+	}
+}
+
+func toSliceRoleResponse(e []RoleEntity) []RoleResponse {
+	responses := make([]RoleResponse, len(e))
+	for i := range e {
+		responses[i] = e[i].toResponse()
+	}
+	return responses
+}
+
+type RoleResponse struct {
+	Id        int64     `json:"id"`
+	Name      string    `json:"name"`
+	GrantedAt time.Time `json:"granted_at"`
+}
+
+// StatusRequest перевод сотрудника в другое состояние жизненного цикла
+type StatusRequest struct {
+	Status string `json:"status" validate:"required,oneof=pending active suspended terminated"`
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// StatusHistoryEntity переход сотрудника между состояниями; FromStatus пуст у записи о создании
+type StatusHistoryEntity struct {
+	Id         int64     `db:"id"`
+	EmployeeId int64     `db:"employee_id"`
+	FromStatus *string   `db:"from_status"`
+	ToStatus   string    `db:"to_status"`
+	Reason     string    `db:"reason"`
+	Actor      string    `db:"actor"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+func (e *StatusHistoryEntity) toResponse() StatusHistoryResponse {
+	return StatusHistoryResponse{
+		Id:         e.Id,
+		FromStatus: e.FromStatus,
+		ToStatus:   e.ToStatus,
+		Reason:     e.Reason,
+		Actor:      e.Actor,
+		CreatedAt:  e.CreatedAt,
+	}
+}
+
+func toSliceStatusHistoryResponse(e []StatusHistoryEntity) []StatusHistoryResponse {
+	responses := make([]StatusHistoryResponse, len(e))
+	for i := range e {
+		responses[i] = e[i].toResponse()
+	}
+	return responses
+}
+
+type StatusHistoryResponse struct {
+	Id         int64     `json:"id"`
+	FromStatus *string   `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Reason     string    `json:"reason"`
+	Actor      string    `json:"actor"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// форматы выгрузки сотрудников
+const (
+	ExportCsv  = "csv"
+	ExportJson = "json"
+	ExportXlsx = "xlsx"
+)
+
+// ExportRequest выгрузка сотрудников с фильтрами и сортировкой списка; limit и cursor не учитываются —
+// выгружаются все подходящие сотрудники
+type ExportRequest struct {
+	FindRequest
+	Format string `query:"format" validate:"required,oneof=csv json xlsx"`
+}
+
+// ExportEntity сотрудник для выгрузки вместе с названиями всех выданных ему ролей
+type ExportEntity struct {
+	Entity
+	Roles pq.StringArray `db:"roles"`
+}
+
+func (e *ExportEntity) toExportResponse() ExportResponse {
+	roles := []string(e.Roles)
+	if roles == nil {
+		roles = []string{}
+	}
+	return ExportResponse{Response: e.toResponse(), Roles: roles}
+}
+
+// ExportResponse строка выгрузки: Roles — все выданные роли, RoleName — только основная
+type ExportResponse struct {
+	Response
+	Roles []string `json:"roles"`
 }
@@ -0,0 +1,191 @@
+package employee
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportContentTypes MIME-типы файлов выгрузки по формату
+var ExportContentTypes = map[string]string{
+	ExportCsv:  "text/csv; charset=utf-8",
+	ExportJson: "application/json",
+	ExportXlsx: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// exportColumns колонки табличных выгрузок; roles — все выданные роли через запятую
+var exportColumns = []string{"id", "name", "status", "role_id", "role_name", "roles", "created_at", "updated_at", "deleted_at"}
+
+// exportWriter запись выгрузки построчно; Close дописывает окончание файла
+type exportWriter interface {
+	Write(row ExportResponse) error
+	Close() error
+}
+
+var exportWriters = map[string]func(w io.Writer) (exportWriter, error){
+	ExportCsv:  newCsvExportWriter,
+	ExportJson: newJsonExportWriter,
+	ExportXlsx: newXlsxExportWriter,
+}
+
+// record строка табличной выгрузки в порядке exportColumns; пустые значения — пустые строки
+func (r ExportResponse) record() []string {
+	record := []string{strconv.FormatInt(r.Id, 10), r.Name, r.Status, "", "", strings.Join(r.Roles, ", "),
+		r.CreatedAt.Format(time.RFC3339), r.UpdatedAt.Format(time.RFC3339), ""}
+	if r.RoleId != nil {
+		record[3] = strconv.FormatInt(*r.RoleId, 10)
+	}
+	if r.RoleName != nil {
+		record[4] = *r.RoleName
+	}
+	if r.DeletedAt != nil {
+		record[8] = r.DeletedAt.Format(time.RFC3339)
+	}
+	return record
+}
+
+type csvExportWriter struct {
+	writer *csv.Writer
+}
+
+func newCsvExportWriter(w io.Writer) (exportWriter, error) {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportColumns); err != nil {
+		return nil, err
+	}
+	return &csvExportWriter{writer: writer}, nil
+}
+
+func (e *csvExportWriter) Write(row ExportResponse) error {
+	record := row.record()
+	for i := range record {
+		record[i] = escapeFormula(record[i])
+	}
+	return e.writer.Write(record)
+}
+
+// escapeFormula табличные редакторы выполняют ячейку CSV, которая начинается с =, +, -, @ (а также
+// с табуляции или перевода строки), как формулу; апостроф в начале оставляет значение текстом
+func escapeFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func (e *csvExportWriter) Close() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// jsonExportWriter пишет JSON-массив по одному элементу, не собирая его целиком
+type jsonExportWriter struct {
+	w     io.Writer
+	empty bool
+}
+
+func newJsonExportWriter(w io.Writer) (exportWriter, error) {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return nil, err
+	}
+	return &jsonExportWriter{w: w, empty: true}, nil
+}
+
+func (e *jsonExportWriter) Write(row ExportResponse) error {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	if !e.empty {
+		if _, err = io.WriteString(e.w, ",\n"); err != nil {
+			return err
+		}
+	}
+	e.empty = false
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonExportWriter) Close() error {
+	_, err := io.WriteString(e.w, "]\n")
+	return err
+}
+
+// xlsxParts минимальный набор частей книги Office Open XML с одним листом; лист пишется последним,
+// по мере поступления строк. Все ячейки — встроенные строки, поэтому таблица общих строк не нужна
+var xlsxParts = []struct{ name, content string }{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="employees" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+type xlsxExportWriter struct {
+	archive *zip.Writer
+	sheet   *bufio.Writer
+}
+
+func newXlsxExportWriter(w io.Writer) (exportWriter, error) {
+	archive := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		file, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = io.WriteString(file, part.content); err != nil {
+			return nil, err
+		}
+	}
+	file, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	e := &xlsxExportWriter{archive: archive, sheet: bufio.NewWriter(file)}
+	_, _ = e.sheet.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	if err = e.writeRow(exportColumns); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *xlsxExportWriter) Write(row ExportResponse) error {
+	return e.writeRow(row.record())
+}
+
+func (e *xlsxExportWriter) writeRow(values []string) error {
+	_, _ = e.sheet.WriteString("<row>")
+	for _, value := range values {
+		_, _ = e.sheet.WriteString(`<c t="inlineStr"><is><t>`)
+		if err := xml.EscapeText(e.sheet, []byte(value)); err != nil {
+			return err
+		}
+		_, _ = e.sheet.WriteString("</t></is></c>")
+	}
+	_, err := e.sheet.WriteString("</row>")
+	return err
+}
+
+func (e *xlsxExportWriter) Close() error {
+	_, _ = e.sheet.WriteString("</sheetData></worksheet>")
+	if err := e.sheet.Flush(); err != nil {
+		return err
+	}
+	return e.archive.Close()
+}
@@ -0,0 +1,86 @@
+package employee
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeExport(t *testing.T, format string, rows ...ExportResponse) []byte {
+	var out bytes.Buffer
+	writer, err := exportWriters[format](&out)
+	assert.NoError(t, err)
+	for _, row := range rows {
+		assert.NoError(t, writer.Write(row))
+	}
+	assert.NoError(t, writer.Close())
+	return out.Bytes()
+}
+
+func TestExportWriters(t *testing.T) {
+	var a = assert.New(t)
+	var deleted = time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	var minusName = "-1+2"
+	var rows = []ExportResponse{
+		{Response: Response{Id: 1, Name: "Иванов Петр", Status: StatusActive}, Roles: []string{}},
+		{Response: Response{Id: 2, Name: "<Сидорова & Анна>", Status: StatusTerminated, DeletedAt: &deleted},
+			Roles: []string{"Менеджер"}},
+	}
+
+	t.Run("json is a valid array even without rows", func(t *testing.T) {
+		var got []ExportResponse
+		a.NoError(json.Unmarshal(writeExport(t, ExportJson, rows...), &got))
+		a.Len(got, 2)
+		a.Equal([]string{"Менеджер"}, got[1].Roles)
+
+		a.NoError(json.Unmarshal(writeExport(t, ExportJson), &got))
+		a.Empty(got)
+	})
+
+	t.Run("csv escapes cells that look like formulas", func(t *testing.T) {
+		var formulas = []ExportResponse{
+			{Response: Response{Id: 3, Name: "=HYPERLINK(\"http://evil\")", Status: StatusActive},
+				Roles: []string{"+Админ", "Менеджер"}},
+			{Response: Response{Id: 4, Name: "@SUM(A1)", Status: StatusActive, RoleName: &minusName}, Roles: []string{}},
+		}
+		records, err := csv.NewReader(bytes.NewReader(writeExport(t, ExportCsv, formulas...))).ReadAll()
+		a.NoError(err)
+		a.Len(records, 3)
+		a.Equal(exportColumns, records[0])
+		a.Equal("'=HYPERLINK(\"http://evil\")", records[1][1])
+		a.Equal("'+Админ, Менеджер", records[1][5])
+		a.Equal("'@SUM(A1)", records[2][1])
+		a.Equal("'-1+2", records[2][4])
+		a.Equal("4", records[2][0])
+	})
+
+	t.Run("xlsx is a zip workbook with escaped inline strings", func(t *testing.T) {
+		var data = writeExport(t, ExportXlsx, rows...)
+		archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		a.NoError(err)
+
+		var names []string
+		var sheet string
+		for _, file := range archive.File {
+			names = append(names, file.Name)
+			if file.Name == "xl/worksheets/sheet1.xml" {
+				reader, err := file.Open()
+				a.NoError(err)
+				content, err := io.ReadAll(reader)
+				a.NoError(err)
+				sheet = string(content)
+			}
+		}
+		a.Contains(names, "[Content_Types].xml")
+		a.Contains(names, "xl/workbook.xml")
+		a.Equal(3, strings.Count(sheet, "<row>"))
+		a.Contains(sheet, "&lt;Сидорова &amp; Анна&gt;")
+		a.Contains(sheet, "2024-05-06T07:08:09Z")
+	})
+}
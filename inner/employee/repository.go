@@ -1,8 +1,13 @@
 package employee
 
 import (
+	"database/sql"
 	"fmt"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"idm/inner/common"
+	"strings"
+	"time"
 )
 
 type Repository struct {
@@ -13,14 +18,34 @@ func NewEmployeeRepository(dataBase *sqlx.DB) *Repository {
 	return &Repository{db: dataBase}
 }
 
+// selectEmployee выборка сотрудника вместе с названием его роли
+const selectEmployee = "SELECT e.*, r.name AS role_name FROM employee e LEFT JOIN role r ON r.id = e.role_id"
+
+// notDeleted условие, скрывающее мягко удалённых сотрудников; его добавляют все выборки, кроме *IncludingDeleted
+const notDeleted = " AND e.deleted_at IS NULL"
+
 func (repo *Repository) FindById(id int64) (entity Entity, err error) {
-	err = repo.db.Get(&entity, "SELECT * FROM employee WHERE id=$1", id)
+	err = repo.db.Get(&entity, selectEmployee+" WHERE e.id=$1"+notDeleted, id)
+	return entity, err
+}
+
+// FindByIdIncludingDeleted сотрудник по идентификатору, даже если он мягко удалён
+func (repo *Repository) FindByIdIncludingDeleted(id int64) (entity Entity, err error) {
+	err = repo.db.Get(&entity, selectEmployee+" WHERE e.id=$1", id)
 	return entity, err
 }
 
+// saveWithRoleName создание сотрудника с ролью, заданной названием
+const saveWithRoleName = `with inserted as (
+			insert into employee (name, role_id)
+			values ($1, (select id from role where name = $2 and deleted_at is null)) returning id, role_id
+		), granted as (
+			insert into employee_role (employee_id, role_id) select id, role_id from inserted where role_id is not null
+		)
+		select id from inserted`
+
 func (repo *Repository) Save(entity Entity, roleName string) (id int64, err error) {
-	query := "insert into employee (name, role_id) values ($1,(select id from role where name = $2)) returning id"
-	err = repo.db.Get(&id, query, entity.Name, roleName)
+	err = repo.db.Get(&id, saveWithRoleName, entity.Name, roleName)
 	return id, err
 }
 
@@ -28,7 +53,7 @@ func (repo *Repository) FindAllByIds(ids []int64) (listEntity []Entity, err erro
 	if len(ids) == 0 {
 		return []Entity{}, nil
 	}
-	query, args, err := sqlx.In("SELECT * FROM employee WHERE id IN (?)", ids)
+	query, args, err := sqlx.In(selectEmployee+" WHERE e.id IN (?)"+notDeleted, ids)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build IN query: %w", err)
 	}
@@ -38,20 +63,149 @@ func (repo *Repository) FindAllByIds(ids []int64) (listEntity []Entity, err erro
 }
 
 func (repo *Repository) FindAll() (listEntity []Entity, err error) {
-	err = repo.db.Select(&listEntity, "SELECT * FROM employee")
+	err = repo.db.Select(&listEntity, selectEmployee+" WHERE e.deleted_at IS NULL")
+	return listEntity, err
+}
+
+// FindAllIncludingDeleted все сотрудники вместе с мягко удалёнными
+func (repo *Repository) FindAllIncludingDeleted() (listEntity []Entity, err error) {
+	err = repo.db.Select(&listEntity, selectEmployee)
+	return listEntity, err
+}
+
+// sortColumns поля сортировки списка и их тип для сравнения со значением из курсора
+var sortColumns = map[string]string{
+	"name":       "text",
+	"created_at": "timestamptz",
+	"updated_at": "timestamptz",
+}
+
+// FindPage страница сотрудников по фильтру; записи после курсора в порядке сортировки, не больше Limit
+func (repo *Repository) FindPage(filter Filter) (listEntity []Entity, err error) {
+	conditions, args := filterConditions(filter)
+	compare := ">"
+	if filter.Sort.Desc {
+		compare = "<"
+	}
+	if filter.After != nil {
+		if filter.Sort.Field == "id" {
+			args = append(args, filter.After.Id)
+			conditions = append(conditions, fmt.Sprintf("e.id %s $%d", compare, len(args)))
+		} else {
+			args = append(args, filter.After.Value, filter.After.Id)
+			conditions = append(conditions, fmt.Sprintf("(e.%s, e.id) %s ($%d::%s, $%d)",
+				filter.Sort.Field, compare, len(args)-1, sortColumns[filter.Sort.Field], len(args)))
+		}
+	}
+	query := selectEmployee + where(conditions) + orderBy(filter.Sort)
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(" LIMIT $%d", len(args))
+
+	listEntity = []Entity{}
+	err = repo.db.Select(&listEntity, query, args...)
 	return listEntity, err
 }
 
+// Count количество сотрудников по фильтру без учёта курсора и размера страницы
+func (repo *Repository) Count(filter Filter) (count int64, err error) {
+	conditions, args := filterConditions(filter)
+	err = repo.db.Get(&count, "SELECT count(*) FROM employee e"+where(conditions), args...)
+	return count, err
+}
+
+func filterConditions(filter Filter) (conditions []string, args []any) {
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if !filter.IncludeDeleted {
+		conditions = append(conditions, "e.deleted_at IS NULL")
+	}
+	if filter.NamePrefix != "" {
+		add("e.name ILIKE $%d", common.LikePrefix(filter.NamePrefix))
+	}
+	if filter.RoleId > 0 {
+		// по всем выданным ролям, а не только по основной
+		add("EXISTS (SELECT 1 FROM employee_role er WHERE er.employee_id = e.id AND er.role_id = $%d)", filter.RoleId)
+	}
+	if filter.CreatedFrom != nil {
+		add("e.created_at >= $%d", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		add("e.created_at <= $%d", *filter.CreatedTo)
+	}
+	return conditions, args
+}
+
+// selectExport выборка сотрудника для выгрузки: кроме основной роли — названия всех выданных ролей
+const selectExport = `SELECT e.*, r.name AS role_name,
+		array(SELECT gr.name FROM employee_role er JOIN role gr ON gr.id = er.role_id
+			WHERE er.employee_id = e.id AND gr.deleted_at IS NULL ORDER BY gr.name) AS roles
+	FROM employee e LEFT JOIN role r ON r.id = e.role_id`
+
+// Export обходит сотрудников по фильтру без ограничения количества, передавая их в each по одному:
+// строки читаются из результата запроса по мере обработки и не собираются в память
+func (repo *Repository) Export(filter Filter, each func(entity ExportEntity) error) error {
+	conditions, args := filterConditions(filter)
+	rows, err := repo.db.Queryx(selectExport+where(conditions)+orderBy(filter.Sort), args...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		var entity ExportEntity
+		if err = rows.StructScan(&entity); err != nil {
+			return err
+		}
+		if err = each(entity); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func where(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// orderBy порядок выборки; при сортировке не по id он дополняется id, чтобы порядок был однозначным
+func orderBy(sort common.Sort) string {
+	direction := "asc"
+	if sort.Desc {
+		direction = "desc"
+	}
+	if sort.Field == "id" {
+		return fmt.Sprintf(" ORDER BY e.id %s", direction)
+	}
+	return fmt.Sprintf(" ORDER BY e.%s %s, e.id %s", sort.Field, direction, direction)
+}
+
+// Delete мягко удаляет сотрудника; уже удалённый считается отсутствующим
 func (repo *Repository) Delete(id int64) error {
-	_, err := repo.db.Exec("delete from employee where id=$1", id)
-	return err
+	result, err := repo.db.Exec("update employee set deleted_at = now() where id = $1 and deleted_at is null", id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
 func (repo *Repository) DeleteAllByIds(ids []int64) error {
 	if len(ids) == 0 {
 		return nil
 	}
-	query, args, err := sqlx.In("DELETE FROM employee WHERE ID IN (?)", ids)
+	query, args, err := sqlx.In("UPDATE employee SET deleted_at = now() WHERE id IN (?) AND deleted_at IS NULL", ids)
 	if err != nil {
 		return fmt.Errorf("failed to build IN query: %w", err)
 	}
@@ -60,8 +214,41 @@ func (repo *Repository) DeleteAllByIds(ids []int64) error {
 	return err
 }
 
+// Search сотрудники, имя которых совпадает с запросом по словам (полнотекстовый поиск, слово запроса
+// может быть началом слова имени) или похоже на него по триграммам. Имя и запрос сравниваются в виде
+// employee_search_name: без учёта регистра и с ё, заменённой на е.
+// Rank — большее из ts_rank и word_similarity, равные по рангу упорядочены по имени
+func (repo *Repository) Search(query string, limit int) (found []SearchEntity, err error) {
+	found = []SearchEntity{}
+	err = repo.db.Select(
+		&found,
+		`with q as (
+			select employee_search_name($1) as text,
+				(select to_tsquery('simple', string_agg(quote_literal(word) || ':*', ' & '))
+				from regexp_split_to_table(employee_search_name($1), '[[:space:][:punct:]]+') as word
+				where word <> '') as ts
+		)
+		select e.*, r.name as role_name,
+			greatest(
+				ts_rank(to_tsvector('simple', employee_search_name(e.name)), q.ts),
+				word_similarity(q.text, employee_search_name(e.name))
+			)::float8 as rank
+		from employee e
+		left join role r on r.id = e.role_id
+		cross join q
+		where e.deleted_at is null
+			and (to_tsvector('simple', employee_search_name(e.name)) @@ q.ts
+				or q.text <% employee_search_name(e.name))
+		order by rank desc, e.name, e.id
+		limit $2`,
+		query,
+		limit,
+	)
+	return found, err
+}
+
 func (repo *Repository) FindByName(name string) (entity Entity, err error) {
-	err = repo.db.Get(&entity, "SELECT * FROM employee WHERE name=$1", name)
+	err = repo.db.Get(&entity, selectEmployee+" WHERE e.name=$1"+notDeleted, name)
 	return entity, err
 }
 
@@ -72,7 +259,7 @@ func (repo *Repository) BeginTransaction() (tx *sqlx.Tx, err error) {
 func (repo *Repository) FindByNameTx(tx *sqlx.Tx, name string) (isExists bool, err error) {
 	err = tx.Get(
 		&isExists,
-		"select exists(select 1 from employee where name = $1)",
+		"select exists(select 1 from employee where name = $1 and deleted_at is null)",
 		name,
 	)
 	return isExists, err
@@ -81,8 +268,235 @@ func (repo *Repository) FindByNameTx(tx *sqlx.Tx, name string) (isExists bool, e
 func (repo *Repository) SaveTx(tx *sqlx.Tx, employee Entity) (employeeId int64, err error) {
 	err = tx.Get(
 		&employeeId,
-		"insert into employee (name) values ($1) returning id",
+		"insert into employee (name, role_id, status) values ($1, $2, $3) returning id",
 		employee.Name,
+		employee.RoleID,
+		employee.Status,
 	)
 	return employeeId, err
 }
+
+func (repo *Repository) SaveWithRoleNameTx(tx *sqlx.Tx, entity Entity, roleName string) (id int64, err error) {
+	err = tx.Get(&id, saveWithRoleName, entity.Name, roleName)
+	return id, err
+}
+
+// DeleteTx мягко удаляет сотрудника и возвращает его последнее состояние
+func (repo *Repository) DeleteTx(tx *sqlx.Tx, id int64) (deleted Entity, err error) {
+	err = tx.Get(
+		&deleted,
+		`with deleted as (
+			update employee set deleted_at = now() where id = $1 and deleted_at is null returning *
+		)
+		select d.*, r.name as role_name from deleted d left join role r on r.id = d.role_id`,
+		id,
+	)
+	return deleted, err
+}
+
+// DeleteAllByIdsTx мягко удаляет сотрудников и возвращает удалённых; несуществующие и уже
+// удалённые идентификаторы пропускаются
+func (repo *Repository) DeleteAllByIdsTx(tx *sqlx.Tx, ids []int64) (deleted []Entity, err error) {
+	deleted = []Entity{}
+	err = tx.Select(
+		&deleted,
+		`with deleted as (
+			update employee set deleted_at = now() where id = any($1) and deleted_at is null returning *
+		)
+		select d.*, r.name as role_name from deleted d left join role r on r.id = d.role_id order by d.id`,
+		pq.Array(ids),
+	)
+	return deleted, err
+}
+
+// RestoreTx снимает отметку об удалении; для неудалённого сотрудника возвращает sql.ErrNoRows
+func (repo *Repository) RestoreTx(tx *sqlx.Tx, id int64) (restored Entity, err error) {
+	err = tx.Get(
+		&restored,
+		`with restored as (
+			update employee set deleted_at = null, updated_at = now() where id = $1 and deleted_at is not null returning *
+		)
+		select u.*, r.name as role_name from restored u left join role r on r.id = u.role_id`,
+		id,
+	)
+	return restored, err
+}
+
+// PurgeTx окончательно удаляет сотрудников, мягко удалённых раньше deletedBefore, и возвращает их
+func (repo *Repository) PurgeTx(tx *sqlx.Tx, deletedBefore time.Time) (purged []Entity, err error) {
+	purged = []Entity{}
+	err = tx.Select(
+		&purged,
+		`with purged as (
+			delete from employee where deleted_at < $1 returning *
+		)
+		select d.*, r.name as role_name from purged d left join role r on r.id = d.role_id order by d.id`,
+		deletedBefore,
+	)
+	return purged, err
+}
+
+func (repo *Repository) FindByNameAndNotIdTx(tx *sqlx.Tx, name string, id int64) (isExists bool, err error) {
+	err = tx.Get(
+		&isExists,
+		"select exists(select 1 from employee where name = $1 and id <> $2 and deleted_at is null)",
+		name,
+		id,
+	)
+	return isExists, err
+}
+
+func (repo *Repository) UpdateTx(tx *sqlx.Tx, employee Entity) (updated Entity, err error) {
+	err = tx.Get(
+		&updated,
+		`with updated as (
+			update employee set name = $1, role_id = $2, updated_at = now() where id = $3 and deleted_at is null returning *
+		)
+		select u.*, r.name as role_name from updated u left join role r on r.id = u.role_id`,
+		employee.Name,
+		employee.RoleID,
+		employee.Id,
+	)
+	return updated, err
+}
+
+func (repo *Repository) ExistsRoleByIdTx(tx *sqlx.Tx, roleId int64) (isExists bool, err error) {
+	err = tx.Get(
+		&isExists,
+		"select exists(select 1 from role where id = $1 and deleted_at is null)",
+		roleId,
+	)
+	return isExists, err
+}
+
+func (repo *Repository) UpdateRoleTx(tx *sqlx.Tx, id int64, roleId *int64) (updated Entity, err error) {
+	err = tx.Get(
+		&updated,
+		`with updated as (
+			update employee set role_id = $1, updated_at = now() where id = $2 and deleted_at is null returning *
+		)
+		select u.*, r.name as role_name from updated u left join role r on r.id = u.role_id`,
+		roleId,
+		id,
+	)
+	return updated, err
+}
+
+func (repo *Repository) FindByIdTx(tx *sqlx.Tx, id int64) (entity Entity, err error) {
+	err = tx.Get(&entity, selectEmployee+" WHERE e.id=$1"+notDeleted, id)
+	return entity, err
+}
+
+// FindRolesByEmployeeId все роли, выданные сотруднику, из таблицы employee_role, в любом его состоянии.
+// Выдачи удалённой роли или удалённому сотруднику сохраняются для восстановления, но не показываются
+func (repo *Repository) FindRolesByEmployeeId(id int64) (roles []RoleEntity, err error) {
+	roles = []RoleEntity{}
+	err = repo.db.Select(
+		&roles,
+		`select r.id, r.name, er.created_at as granted_at
+		from employee_role er
+		join role r on r.id = er.role_id and r.deleted_at is null
+		join employee e on e.id = er.employee_id and e.deleted_at is null
+		where er.employee_id = $1
+		order by r.id`,
+		id,
+	)
+	return roles, err
+}
+
+// FindEffectiveRolesByEmployeeId действующие роли сотрудника — по ним проверяются права и выпускаются токены.
+// Роли действуют только у активного сотрудника: у принятого, но ещё не вышедшего, и у приостановленного их нет
+func (repo *Repository) FindEffectiveRolesByEmployeeId(id int64) (roles []RoleEntity, err error) {
+	roles = []RoleEntity{}
+	err = repo.db.Select(
+		&roles,
+		`select r.id, r.name, er.created_at as granted_at
+		from employee_role er
+		join role r on r.id = er.role_id and r.deleted_at is null
+		join employee e on e.id = er.employee_id and e.deleted_at is null and e.status = 'active'
+		where er.employee_id = $1
+		order by r.id`,
+		id,
+	)
+	return roles, err
+}
+
+// GrantRoleTx выдаёт сотруднику роль; false — роль уже была выдана
+func (repo *Repository) GrantRoleTx(tx *sqlx.Tx, id int64, roleId int64) (isGranted bool, err error) {
+	result, err := tx.Exec(
+		"insert into employee_role (employee_id, role_id) values ($1, $2) on conflict do nothing",
+		id,
+		roleId,
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// RevokeRoleTx забирает у сотрудника роль; если она была основной, то employee.role_id очищается
+func (repo *Repository) RevokeRoleTx(tx *sqlx.Tx, id int64, roleId int64) (isRevoked bool, err error) {
+	result, err := tx.Exec("delete from employee_role where employee_id = $1 and role_id = $2", id, roleId)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(
+		"update employee set role_id = null, updated_at = now() where id = $1 and role_id = $2",
+		id,
+		roleId,
+	)
+	return affected > 0, err
+}
+
+// UpdateStatusTx меняет состояние жизненного цикла сотрудника
+func (repo *Repository) UpdateStatusTx(tx *sqlx.Tx, id int64, status string) (updated Entity, err error) {
+	err = tx.Get(
+		&updated,
+		`with updated as (
+			update employee set status = $1, updated_at = now() where id = $2 and deleted_at is null returning *
+		)
+		select u.*, r.name as role_name from updated u left join role r on r.id = u.role_id`,
+		status,
+		id,
+	)
+	return updated, err
+}
+
+// RevokeAllRolesTx забирает у сотрудника все роли, включая основную, и возвращает идентификаторы снятых ролей
+func (repo *Repository) RevokeAllRolesTx(tx *sqlx.Tx, id int64) (roleIds []int64, err error) {
+	roleIds = []int64{}
+	err = tx.Select(&roleIds, "delete from employee_role where employee_id = $1 returning role_id", id)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec("update employee set role_id = null, updated_at = now() where id = $1 and role_id is not null", id)
+	return roleIds, err
+}
+
+func (repo *Repository) SaveStatusHistoryTx(tx *sqlx.Tx, entry StatusHistoryEntity) error {
+	_, err := tx.Exec(
+		"insert into employee_status_history (employee_id, from_status, to_status, reason, actor) values ($1, $2, $3, $4, $5)",
+		entry.EmployeeId,
+		entry.FromStatus,
+		entry.ToStatus,
+		entry.Reason,
+		entry.Actor,
+	)
+	return err
+}
+
+// FindStatusHistory переходы сотрудника между состояниями от первого к последнему
+func (repo *Repository) FindStatusHistory(id int64) (history []StatusHistoryEntity, err error) {
+	history = []StatusHistoryEntity{}
+	err = repo.db.Select(
+		&history,
+		"select * from employee_status_history where employee_id = $1 order by created_at, id",
+		id,
+	)
+	return history, err
+}
@@ -23,6 +23,25 @@ func TestCreateRequestValidation(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "pending joiner",
+			request: CreateRequest{
+				Name:   "Valid name",
+				RoleId: &roleId,
+				Status: StatusPending,
+			},
+			wantErr: false,
+		},
+		{
+			name: "created terminated",
+			request: CreateRequest{
+				Name:   "Valid name",
+				RoleId: &roleId,
+				Status: StatusTerminated,
+			},
+			wantErr:  true,
+			errField: "Status",
+		},
 		{
 			name: "empty name",
 			request: CreateRequest{
@@ -77,3 +96,50 @@ func TestCreateRequestValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateRequestValidation(t *testing.T) {
+	roleId := int64(1)
+	shortName := "J"
+	validName := "Valid name"
+	tests := []struct {
+		name     string
+		request  any
+		wantErr  bool
+		errField string
+	}{
+		{
+			name:    "valid update request",
+			request: UpdateRequest{Name: validName, RoleId: &roleId},
+			wantErr: false,
+		},
+		{
+			name:     "update request without role",
+			request:  UpdateRequest{Name: validName},
+			wantErr:  true,
+			errField: "RoleId",
+		},
+		{
+			name:    "empty patch request",
+			request: PatchRequest{},
+			wantErr: false,
+		},
+		{
+			name:     "patch request with short name",
+			request:  PatchRequest{Name: &shortName},
+			wantErr:  true,
+			errField: "Name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validator.New().Struct(tt.request)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errField)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
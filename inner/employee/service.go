@@ -1,25 +1,44 @@
 package employee
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
-	"github.com/go-playground/validator/v10"
 	"github.com/jmoiron/sqlx"
+	"idm/inner/audit"
 	"idm/inner/common"
+	"idm/inner/role"
+	"io"
+	"strings"
+	"time"
 )
 
+// DefaultSearchLimit количество найденных сотрудников в ответе, если limit не задан
+const DefaultSearchLimit = 20
+
 type Service struct {
 	repo      Repo
+	roleRepo  RoleRepo
 	validator Validator
+	auditor   Auditor
+	retention time.Duration
 }
 
 type ServiceStub struct {
 	repo StubRepo
 }
 
-func NewService(repo Repo, validator Validator) *Service {
+// NewService retention — срок хранения мягко удалённых сотрудников до окончательного удаления
+func NewService(repo Repo, roleRepo RoleRepo, validator Validator, auditor Auditor, retention time.Duration) *Service {
+	if retention <= 0 {
+		retention = common.DefaultPurgeRetention
+	}
 	return &Service{
 		repo:      repo,
+		roleRepo:  roleRepo,
 		validator: validator,
+		auditor:   auditor,
+		retention: retention,
 	}
 }
 
@@ -27,24 +46,64 @@ type Validator interface {
 	Validate(request any) error
 }
 
+// Auditor журнал изменений, реализуется audit.Service; запись делается в транзакции изменения
+type Auditor interface {
+	RecordTx(tx *sqlx.Tx, actor audit.Actor, record audit.Record) error
+}
+
 type StubRepo interface {
 	FindAllByIds(ids []int64) ([]Entity, error)
 }
 
+// RoleRepo права ролей вместе с унаследованными, реализуется role.Repository
+type RoleRepo interface {
+	FindPermissionsByRoleIds(ids []int64) (permissions []role.PermissionEntity, err error)
+}
+
 type Repo interface {
 	FindAll() (listEntity []Entity, err error)
 	FindById(id int64) (Entity, error)
+	FindAllIncludingDeleted() (listEntity []Entity, err error)
+	FindByIdIncludingDeleted(id int64) (Entity, error)
+	FindPage(filter Filter) (listEntity []Entity, err error)
+	Search(query string, limit int) (found []SearchEntity, err error)
+	Count(filter Filter) (count int64, err error)
+	Export(filter Filter, each func(entity ExportEntity) error) error
 	FindAllByIds(ids []int64) (listEntity []Entity, err error)
-	Save(entity Entity, roleName string) (id int64, err error)
-	Delete(id int64) error
-	DeleteAllByIds(ids []int64) error
 	BeginTransaction() (tx *sqlx.Tx, err error)
+	SaveWithRoleNameTx(tx *sqlx.Tx, entity Entity, roleName string) (id int64, err error)
+	DeleteTx(tx *sqlx.Tx, id int64) (deleted Entity, err error)
+	DeleteAllByIdsTx(tx *sqlx.Tx, ids []int64) (deleted []Entity, err error)
+	RestoreTx(tx *sqlx.Tx, id int64) (restored Entity, err error)
+	PurgeTx(tx *sqlx.Tx, deletedBefore time.Time) (purged []Entity, err error)
 	FindByNameTx(tx *sqlx.Tx, name string) (isExists bool, err error)
 	SaveTx(tx *sqlx.Tx, employee Entity) (employeeId int64, err error)
+	FindByNameAndNotIdTx(tx *sqlx.Tx, name string, id int64) (isExists bool, err error)
+	UpdateTx(tx *sqlx.Tx, employee Entity) (updated Entity, err error)
+	ExistsRoleByIdTx(tx *sqlx.Tx, roleId int64) (isExists bool, err error)
+	UpdateRoleTx(tx *sqlx.Tx, id int64, roleId *int64) (updated Entity, err error)
+	FindByIdTx(tx *sqlx.Tx, id int64) (entity Entity, err error)
+	FindRolesByEmployeeId(id int64) (roles []RoleEntity, err error)
+	GrantRoleTx(tx *sqlx.Tx, id int64, roleId int64) (isGranted bool, err error)
+	RevokeRoleTx(tx *sqlx.Tx, id int64, roleId int64) (isRevoked bool, err error)
+	UpdateStatusTx(tx *sqlx.Tx, id int64, status string) (updated Entity, err error)
+	RevokeAllRolesTx(tx *sqlx.Tx, id int64) (roleIds []int64, err error)
+	SaveStatusHistoryTx(tx *sqlx.Tx, entry StatusHistoryEntity) error
+	FindStatusHistory(id int64) (history []StatusHistoryEntity, err error)
+}
+
+// transitions допустимые переходы жизненного цикла; увольнение окончательно
+var transitions = map[string][]string{
+	StatusPending:   {StatusActive, StatusTerminated},
+	StatusActive:    {StatusSuspended, StatusTerminated},
+	StatusSuspended: {StatusActive, StatusTerminated},
 }
 
 func (service *Service) FindById(id int64) (Response, error) {
 	var entity, err = service.repo.FindById(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Response{}, common.NotFoundError{Resource: "employee", ID: id}
+	}
 	if err != nil {
 		return Response{}, fmt.Errorf("error finding employee with id %d: %w", id, err)
 	}
@@ -61,6 +120,136 @@ func (service *Service) FindAll() ([]Response, error) {
 	return toSliceResponse(entity), nil
 }
 
+// FindByIdIncludingDeleted сотрудник по идентификатору, в том числе мягко удалённый
+func (service *Service) FindByIdIncludingDeleted(id int64) (Response, error) {
+	var entity, err = service.repo.FindByIdIncludingDeleted(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Response{}, common.NotFoundError{Resource: "employee", ID: id}
+	}
+	if err != nil {
+		return Response{}, fmt.Errorf("error finding employee with id %d: %w", id, err)
+	}
+
+	return entity.toResponse(), nil
+}
+
+// FindAllIncludingDeleted все сотрудники вместе с мягко удалёнными
+func (service *Service) FindAllIncludingDeleted() ([]Response, error) {
+	var entity, err = service.repo.FindAllIncludingDeleted()
+	if err != nil {
+		return []Response{}, fmt.Errorf("error finding employees: %w", err)
+	}
+
+	return toSliceResponse(entity), nil
+}
+
+// FindPage страница сотрудников по фильтру, сортировке и курсору вместе с общим количеством по фильтру
+func (service *Service) FindPage(request FindRequest) ([]Response, common.Page, error) {
+	if err := service.validator.Validate(request); err != nil {
+		return []Response{}, common.Page{}, err
+	}
+	filter, err := filterOf(request)
+	if err != nil {
+		return []Response{}, common.Page{}, err
+	}
+	if filter.After, err = common.DecodeCursor(request.Cursor, filter.Sort); err != nil {
+		return []Response{}, common.Page{}, err
+	}
+	filter.Limit = request.Limit
+	if filter.Limit == 0 {
+		filter.Limit = common.DefaultPageLimit
+	}
+	total, err := service.repo.Count(filter)
+	if err != nil {
+		return []Response{}, common.Page{}, fmt.Errorf("error counting employees: %w", err)
+	}
+	// на одну запись больше страницы: по ней видно, есть ли следующая
+	limit := filter.Limit
+	filter.Limit++
+	entities, err := service.repo.FindPage(filter)
+	if err != nil {
+		return []Response{}, common.Page{}, fmt.Errorf("error finding employees: %w", err)
+	}
+	page := common.Page{Total: total}
+	if len(entities) > limit {
+		entities = entities[:limit]
+		page.NextCursor = cursorAfter(entities[limit-1], filter.Sort).Encode()
+	}
+	return toSliceResponse(entities), page, nil
+}
+
+// filterOf фильтр и сортировка списка из запроса, без курсора и размера страницы
+func filterOf(request FindRequest) (Filter, error) {
+	sort, err := common.ParseSort(request.Sort, "name", "created_at", "updated_at")
+	if err != nil {
+		return Filter{}, err
+	}
+	return Filter{
+		NamePrefix:     request.Name,
+		RoleId:         request.RoleId,
+		CreatedFrom:    common.ParseTime(request.CreatedFrom),
+		CreatedTo:      common.ParseTime(request.CreatedTo),
+		IncludeDeleted: request.IncludeDeleted,
+		Sort:           sort,
+	}, nil
+}
+
+// Export проверяет запрос и возвращает функцию, которая пишет выгрузку сотрудников в w.
+// Ошибки запроса возвращаются сразу, до начала ответа; сотрудники читаются из базы по одному
+func (service *Service) Export(request ExportRequest) (func(w io.Writer) error, error) {
+	if err := service.validator.Validate(request); err != nil {
+		return nil, err
+	}
+	filter, err := filterOf(request.FindRequest)
+	if err != nil {
+		return nil, err
+	}
+	newWriter := exportWriters[request.Format]
+	return func(w io.Writer) error {
+		writer, err := newWriter(w)
+		if err != nil {
+			return fmt.Errorf("error exporting employees: %w", err)
+		}
+		err = service.repo.Export(filter, func(entity ExportEntity) error {
+			return writer.Write(entity.toExportResponse())
+		})
+		if err != nil {
+			return fmt.Errorf("error exporting employees: %w", err)
+		}
+		return writer.Close()
+	}, nil
+}
+
+// Search сотрудники, подходящие под поисковый запрос, от наиболее релевантных
+func (service *Service) Search(request SearchRequest) ([]SearchResponse, error) {
+	if err := service.validator.Validate(request); err != nil {
+		return []SearchResponse{}, err
+	}
+	limit := request.Limit
+	if limit == 0 {
+		limit = DefaultSearchLimit
+	}
+	found, err := service.repo.Search(strings.TrimSpace(request.Q), limit)
+	if err != nil {
+		return []SearchResponse{}, fmt.Errorf("error searching employees by %q: %w", request.Q, err)
+	}
+	return toSliceSearchResponse(found), nil
+}
+
+// cursorAfter курсор, указывающий на позицию сразу после сотрудника
+func cursorAfter(entity Entity, sort common.Sort) common.Cursor {
+	cursor := common.Cursor{Sort: sort.String(), Id: entity.Id}
+	switch sort.Field {
+	case "name":
+		cursor.Value = entity.Name
+	case "created_at":
+		cursor.Value = entity.CreatedAt.Format(time.RFC3339Nano)
+	case "updated_at":
+		cursor.Value = entity.UpdatedAt.Format(time.RFC3339Nano)
+	}
+	return cursor
+}
+
 func (service *Service) FindAllByIds(ids []int64) ([]Response, error) {
 	entity, err := service.repo.FindAllByIds(ids)
 	if err != nil {
@@ -70,34 +259,148 @@ func (service *Service) FindAllByIds(ids []int64) ([]Response, error) {
 	return toSliceResponse(entity), nil
 }
 
-func (service *Service) Save(entity Entity, roleName string) (int64, error) {
-	var id, err = service.repo.Save(entity, roleName)
+func (service *Service) Save(actor audit.Actor, entity Entity, roleName string) (id int64, err error) {
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return 0, fmt.Errorf("error save employee: error creating transaction: %w", err)
+	}
+	id, err = service.repo.SaveWithRoleNameTx(tx, entity, roleName)
 	if err != nil {
 		return 0, fmt.Errorf("error saving employee name: %s: %w", entity.Name, err)
 	}
-
+	if err = service.recordCreatedTx(tx, actor, id); err != nil {
+		return 0, err
+	}
 	return id, nil
 }
 
-func (service *Service) Delete(id int64) error {
-	err := service.repo.Delete(id)
+func (service *Service) Delete(actor audit.Actor, id int64) (err error) {
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return fmt.Errorf("error delete employee: error creating transaction: %w", err)
+	}
+	deleted, err := service.repo.DeleteTx(tx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = common.NotFoundError{Resource: "employee", ID: id}
+		return err
+	}
 	if err != nil {
 		return fmt.Errorf("error delete employee by id: %d: %w", id, err)
 	}
+	return service.recordTx(tx, actor, audit.ActionDelete, id, deleted.toResponse(), nil)
+}
 
+func (service *Service) DeleteAllByIds(actor audit.Actor, ids []int64) (err error) {
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return fmt.Errorf("error delete employees: error creating transaction: %w", err)
+	}
+	deleted, err := service.repo.DeleteAllByIdsTx(tx, ids)
+	if err != nil {
+		return fmt.Errorf("error delete employees by ids: %d: %w", ids, err)
+	}
+	for i := range deleted {
+		if err = service.recordTx(tx, actor, audit.ActionDelete, deleted[i].Id, deleted[i].toResponse(), nil); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (service *Service) DeleteAllByIds(ids []int64) error {
-	err := service.repo.DeleteAllByIds(ids)
+// Restore возвращает мягко удалённого сотрудника; если его имя уже занято, восстановление отклоняется
+func (service *Service) Restore(actor audit.Actor, id int64) (response Response, err error) {
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
 	if err != nil {
-		return fmt.Errorf("error delete employees by ids: %d: %w", ids, err)
+		return Response{}, fmt.Errorf("error restore employee: error creating transaction: %w", err)
+	}
+	restored, err := service.repo.RestoreTx(tx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = common.NotFoundError{Resource: "deleted employee", ID: id}
+		return Response{}, err
+	}
+	if err != nil {
+		return Response{}, fmt.Errorf("error restoring employee with id %d: %w", id, err)
+	}
+	isExist, err := service.repo.FindByNameAndNotIdTx(tx, restored.Name, id)
+	if err != nil {
+		return Response{}, fmt.Errorf("error finding employee by name: %s, %w", restored.Name, err)
+	}
+	if isExist {
+		err = common.AlreadyExistsError{Resource: "employee", ID: restored.Name}
+		return Response{}, err
+	}
+	if err = service.recordTx(tx, actor, audit.ActionRestore, id, nil, restored.toResponse()); err != nil {
+		return Response{}, err
 	}
+	return restored.toResponse(), nil
+}
 
-	return nil
+// Purge окончательно удаляет сотрудников, мягко удалённых дольше срока хранения, и возвращает их идентификаторы
+func (service *Service) Purge(actor audit.Actor) (ids []int64, err error) {
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return []int64{}, fmt.Errorf("error purge employees: error creating transaction: %w", err)
+	}
+	purged, err := service.repo.PurgeTx(tx, time.Now().Add(-service.retention))
+	if err != nil {
+		return []int64{}, fmt.Errorf("error purging deleted employees: %w", err)
+	}
+	ids = make([]int64, len(purged))
+	for i := range purged {
+		ids[i] = purged[i].Id
+		if err = service.recordTx(tx, actor, audit.ActionPurge, purged[i].Id, purged[i].toResponse(), nil); err != nil {
+			return []int64{}, err
+		}
+	}
+	return ids, nil
 }
 
-func (service *Service) SaveTx(name string) (int64, error) {
+func (service *Service) SaveTx(actor audit.Actor, entity Entity) (newEmployeeId int64, err error) {
 	tx, err := service.repo.BeginTransaction()
 	defer func() {
 		if tx != nil {
@@ -111,30 +414,472 @@ func (service *Service) SaveTx(name string) (int64, error) {
 	if err != nil {
 		return 0, fmt.Errorf("error save employee: error creating transaction: %w", err)
 	}
-	isExist, err := service.repo.FindByNameTx(tx, name)
+	return service.CreateTx(tx, actor, entity)
+}
+
+// CreateTx создаёт сотрудника в транзакции вызывающего, например массового импорта;
+// фиксацию и откат транзакции выполняет вызывающий
+func (service *Service) CreateTx(tx *sqlx.Tx, actor audit.Actor, entity Entity) (int64, error) {
+	isExist, err := service.repo.FindByNameTx(tx, entity.Name)
 	if err != nil {
-		return 0, fmt.Errorf("error finding employee by name: %s, %w", name, err)
+		return 0, fmt.Errorf("error finding employee by name: %s, %w", entity.Name, err)
 	}
 	if isExist {
-		return 0, fmt.Errorf("employee with name %s already exists", name)
+		return 0, common.AlreadyExistsError{Resource: "employee", ID: entity.Name}
 	}
-	entity := Entity{
-		Name: name,
+	if err = service.checkRoleTx(tx, entity.RoleID); err != nil {
+		return 0, err
+	}
+	if entity.Status == "" {
+		entity.Status = StatusPending
 	}
 
 	newEmployeeId, err := service.repo.SaveTx(tx, entity)
 	if err != nil {
-		err = fmt.Errorf("error creating employee with name: %s %v", name, err)
+		return 0, fmt.Errorf("error creating employee with name: %s %w", entity.Name, err)
+	}
+	// создание записывается раньше выдачи роли, чтобы получатели событий узнали о сотруднике первыми
+	if err = service.recordCreatedTx(tx, actor, newEmployeeId); err != nil {
+		return 0, err
 	}
-	return newEmployeeId, err
+	if err = service.syncPrimaryRoleTx(tx, actor, newEmployeeId, nil, entity.RoleID); err != nil {
+		return 0, err
+	}
+	return newEmployeeId, nil
+}
+
+func (service *Service) CreateEmployee(actor audit.Actor, request CreateRequest) (int64, error) {
+	if err := service.validator.Validate(request); err != nil {
+		return 0, err
+	}
+	return service.SaveTx(actor, request.ToEntity())
 }
 
-func (service *Service) CreateEmployee(request CreateRequest) (int64, error) {
+// UpdateEmployee полностью заменяет данные сотрудника
+func (service *Service) UpdateEmployee(actor audit.Actor, id int64, request UpdateRequest) (Response, error) {
 	if err := service.validator.Validate(request); err != nil {
-		return 0, &common.RequestValidationError{
-			FieldErrors: common.MapValidationErrors(err.(validator.ValidationErrors)).FieldErrors,
+		return Response{}, err
+	}
+	return service.UpdateTx(actor, request.ToEntity(id))
+}
+
+// PatchEmployee обновляет только переданные в запросе поля сотрудника
+func (service *Service) PatchEmployee(actor audit.Actor, id int64, request PatchRequest) (response Response, err error) {
+	if err = service.validator.Validate(request); err != nil {
+		return Response{}, err
+	}
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
 		}
+	}()
+	if err != nil {
+		return Response{}, fmt.Errorf("error patch employee: error creating transaction: %w", err)
+	}
+	return service.PatchTx(tx, actor, id, request)
+}
+
+// PatchTx обновляет переданные поля сотрудника в транзакции вызывающего, например SCIM, который применяет
+// несколько изменений сразу; запрос проверяет, а транзакцию фиксирует и откатывает вызывающий
+func (service *Service) PatchTx(tx *sqlx.Tx, actor audit.Actor, id int64, request PatchRequest) (Response, error) {
+	current, err := service.findByIdTx(tx, id)
+	if err != nil {
+		return Response{}, err
 	}
-	entity := request.ToEntity()
-	return service.SaveTx(entity.Name)
+	return service.replaceTx(tx, actor, current, request.apply(current))
+}
+
+func (service *Service) UpdateTx(actor audit.Actor, entity Entity) (response Response, err error) {
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return Response{}, fmt.Errorf("error update employee: error creating transaction: %w", err)
+	}
+	current, err := service.findByIdTx(tx, entity.Id)
+	if err != nil {
+		return Response{}, err
+	}
+	return service.replaceTx(tx, actor, current, entity)
+}
+
+// replaceTx заменяет данные сотрудника current на entity
+func (service *Service) replaceTx(tx *sqlx.Tx, actor audit.Actor, current Entity, entity Entity) (Response, error) {
+	isExist, err := service.repo.FindByNameAndNotIdTx(tx, entity.Name, entity.Id)
+	if err != nil {
+		return Response{}, fmt.Errorf("error finding employee by name: %s, %w", entity.Name, err)
+	}
+	if isExist {
+		return Response{}, common.AlreadyExistsError{Resource: "employee", ID: entity.Name}
+	}
+	if err = checkGrantable(current, entity.RoleID); err != nil {
+		return Response{}, err
+	}
+	if err = service.checkRoleTx(tx, entity.RoleID); err != nil {
+		return Response{}, err
+	}
+	updated, err := service.repo.UpdateTx(tx, entity)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Response{}, common.NotFoundError{Resource: "employee", ID: entity.Id}
+	}
+	if err != nil {
+		return Response{}, fmt.Errorf("error updating employee with id: %d %w", entity.Id, err)
+	}
+	if err = service.recordTx(tx, actor, audit.ActionUpdate, entity.Id, current.toResponse(), updated.toResponse()); err != nil {
+		return Response{}, err
+	}
+	if err = service.syncPrimaryRoleTx(tx, actor, entity.Id, current.RoleID, entity.RoleID); err != nil {
+		return Response{}, err
+	}
+	return updated.toResponse(), nil
+}
+
+// AssignRole назначает сотруднику роль или меняет текущую
+func (service *Service) AssignRole(actor audit.Actor, id int64, request RoleRequest) (Response, error) {
+	if err := service.validator.Validate(request); err != nil {
+		return Response{}, err
+	}
+	return service.updateRoleTx(actor, id, &request.RoleId)
+}
+
+// RevokeRole снимает с сотрудника роль
+func (service *Service) RevokeRole(actor audit.Actor, id int64) (Response, error) {
+	return service.updateRoleTx(actor, id, nil)
+}
+
+func (service *Service) updateRoleTx(actor audit.Actor, id int64, roleId *int64) (response Response, err error) {
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return Response{}, fmt.Errorf("error update employee role: error creating transaction: %w", err)
+	}
+	current, err := service.findByIdTx(tx, id)
+	if err != nil {
+		return Response{}, err
+	}
+	if err = checkGrantable(current, roleId); err != nil {
+		return Response{}, err
+	}
+	if err = service.checkRoleTx(tx, roleId); err != nil {
+		return Response{}, err
+	}
+	updated, err := service.repo.UpdateRoleTx(tx, id, roleId)
+	if err != nil {
+		return Response{}, fmt.Errorf("error updating role of employee with id: %d %w", id, err)
+	}
+	if err = service.recordTx(tx, actor, audit.ActionUpdate, id, current.toResponse(), updated.toResponse()); err != nil {
+		return Response{}, err
+	}
+	if err = service.syncPrimaryRoleTx(tx, actor, id, current.RoleID, roleId); err != nil {
+		return Response{}, err
+	}
+	return updated.toResponse(), nil
+}
+
+// FindRoles все роли, выданные сотруднику
+func (service *Service) FindRoles(id int64) ([]RoleResponse, error) {
+	if _, err := service.FindById(id); err != nil {
+		return []RoleResponse{}, err
+	}
+	roles, err := service.repo.FindRolesByEmployeeId(id)
+	if err != nil {
+		return []RoleResponse{}, fmt.Errorf("error finding roles of employee with id %d: %w", id, err)
+	}
+	return toSliceRoleResponse(roles), nil
+}
+
+// AddRole выдаёт сотруднику ещё одну роль, не затрагивая уже выданные
+func (service *Service) AddRole(actor audit.Actor, id int64, roleId int64) (err error) {
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return fmt.Errorf("error grant role: error creating transaction: %w", err)
+	}
+	return service.AddRoleTx(tx, actor, id, roleId)
+}
+
+// AddRoleTx выдаёт сотруднику роль в транзакции вызывающего; фиксацию и откат выполняет вызывающий
+func (service *Service) AddRoleTx(tx *sqlx.Tx, actor audit.Actor, id int64, roleId int64) error {
+	current, err := service.findByIdTx(tx, id)
+	if err != nil {
+		return err
+	}
+	if err = checkGrantable(current, &roleId); err != nil {
+		return err
+	}
+	if err = service.checkRoleTx(tx, &roleId); err != nil {
+		return err
+	}
+	if err = service.requireGrantable(actor, roleId); err != nil {
+		return err
+	}
+	if _, err = service.repo.GrantRoleTx(tx, id, roleId); err != nil {
+		return fmt.Errorf("error granting role %d to employee %d: %w", roleId, id, err)
+	}
+	return service.recordTx(tx, actor, audit.ActionAddRole, id, nil, roleGrant{RoleId: roleId})
+}
+
+// RemoveRole забирает у сотрудника одну из выданных ролей
+func (service *Service) RemoveRole(actor audit.Actor, id int64, roleId int64) (err error) {
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return fmt.Errorf("error revoke role: error creating transaction: %w", err)
+	}
+	return service.RemoveRoleTx(tx, actor, id, roleId)
+}
+
+// RemoveRoleTx забирает у сотрудника роль в транзакции вызывающего; фиксацию и откат выполняет вызывающий
+func (service *Service) RemoveRoleTx(tx *sqlx.Tx, actor audit.Actor, id int64, roleId int64) error {
+	isRevoked, err := service.repo.RevokeRoleTx(tx, id, roleId)
+	if err != nil {
+		return fmt.Errorf("error revoking role %d from employee %d: %w", roleId, id, err)
+	}
+	if !isRevoked {
+		return common.NotFoundError{Resource: fmt.Sprintf("role of employee %d", id), ID: roleId}
+	}
+	return service.recordTx(tx, actor, audit.ActionRemoveRole, id, roleGrant{RoleId: roleId}, nil)
+}
+
+// ChangeStatus переводит сотрудника в другое состояние жизненного цикла с указанием причины.
+// При увольнении у сотрудника снимаются все роли
+func (service *Service) ChangeStatus(actor audit.Actor, id int64, request StatusRequest) (response Response, err error) {
+	if err = service.validator.Validate(request); err != nil {
+		return Response{}, err
+	}
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return Response{}, fmt.Errorf("error change employee status: error creating transaction: %w", err)
+	}
+	return service.ChangeStatusTx(tx, actor, id, request)
+}
+
+// ChangeStatusTx меняет состояние сотрудника в транзакции вызывающего; запрос проверяет, а транзакцию
+// фиксирует и откатывает вызывающий
+func (service *Service) ChangeStatusTx(tx *sqlx.Tx, actor audit.Actor, id int64, request StatusRequest) (Response, error) {
+	current, err := service.findByIdTx(tx, id)
+	if err != nil {
+		return Response{}, err
+	}
+	if !canTransition(current.Status, request.Status) {
+		return Response{}, common.RequestValidationError{FieldErrors: map[string]string{
+			"status": fmt.Sprintf("employee cannot change status from %s to %s", current.Status, request.Status),
+		}}
+	}
+	if request.Status == StatusTerminated {
+		if err = service.revokeAllRolesTx(tx, actor, id); err != nil {
+			return Response{}, err
+		}
+	}
+	updated, err := service.repo.UpdateStatusTx(tx, id, request.Status)
+	if err != nil {
+		return Response{}, fmt.Errorf("error updating status of employee with id: %d %w", id, err)
+	}
+	err = service.repo.SaveStatusHistoryTx(tx, StatusHistoryEntity{
+		EmployeeId: id,
+		FromStatus: &current.Status,
+		ToStatus:   request.Status,
+		Reason:     request.Reason,
+		Actor:      actor.Subject,
+	})
+	if err != nil {
+		return Response{}, fmt.Errorf("error saving status history of employee with id: %d %w", id, err)
+	}
+	if err = service.recordTx(tx, actor, audit.ActionChangeStatus, id, current.toResponse(), updated.toResponse()); err != nil {
+		return Response{}, err
+	}
+	return updated.toResponse(), nil
+}
+
+// FindStatusHistory история переходов сотрудника между состояниями жизненного цикла
+func (service *Service) FindStatusHistory(id int64) ([]StatusHistoryResponse, error) {
+	if _, err := service.FindById(id); err != nil {
+		return []StatusHistoryResponse{}, err
+	}
+	history, err := service.repo.FindStatusHistory(id)
+	if err != nil {
+		return []StatusHistoryResponse{}, fmt.Errorf("error finding status history of employee with id %d: %w", id, err)
+	}
+	return toSliceStatusHistoryResponse(history), nil
+}
+
+// revokeAllRolesTx снимает с увольняемого сотрудника все роли; каждая снятая роль попадает в журнал
+func (service *Service) revokeAllRolesTx(tx *sqlx.Tx, actor audit.Actor, id int64) error {
+	roleIds, err := service.repo.RevokeAllRolesTx(tx, id)
+	if err != nil {
+		return fmt.Errorf("error revoking roles from employee %d: %w", id, err)
+	}
+	for _, roleId := range roleIds {
+		if err = service.recordTx(tx, actor, audit.ActionRemoveRole, id, roleGrant{RoleId: roleId}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func canTransition(from string, to string) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGrantable уволенному сотруднику роли не выдаются; снять роль можно всегда
+func checkGrantable(employee Entity, roleId *int64) error {
+	if roleId != nil && employee.Status == StatusTerminated {
+		return common.RequestValidationError{FieldErrors: map[string]string{
+			"roleId": fmt.Sprintf("employee %d is terminated and cannot be granted roles", employee.Id),
+		}}
+	}
+	return nil
+}
+
+func (service *Service) findByIdTx(tx *sqlx.Tx, id int64) (Entity, error) {
+	entity, err := service.repo.FindByIdTx(tx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Entity{}, common.NotFoundError{Resource: "employee", ID: id}
+	}
+	if err != nil {
+		return Entity{}, fmt.Errorf("error finding employee with id %d: %w", id, err)
+	}
+	return entity, nil
+}
+
+// syncPrimaryRoleTx поддерживает инвариант: основная роль сотрудника всегда есть среди выданных ему ролей.
+// При смене основной роли прежняя забирается, новая — выдаётся; фактические выдача и отзыв записываются
+// так же, как AddRole и RemoveRole, чтобы получатели событий о ролях видели и смену основной роли
+func (service *Service) syncPrimaryRoleTx(tx *sqlx.Tx, actor audit.Actor, id int64, previous *int64, current *int64) error {
+	if previous != nil && (current == nil || *previous != *current) {
+		isRevoked, err := service.repo.RevokeRoleTx(tx, id, *previous)
+		if err != nil {
+			return fmt.Errorf("error revoking role %d from employee %d: %w", *previous, id, err)
+		}
+		if isRevoked {
+			if err = service.recordTx(tx, actor, audit.ActionRemoveRole, id, roleGrant{RoleId: *previous}, nil); err != nil {
+				return err
+			}
+		}
+	}
+	if current != nil {
+		if previous == nil || *previous != *current {
+			if err := service.requireGrantable(actor, *current); err != nil {
+				return err
+			}
+		}
+		isGranted, err := service.repo.GrantRoleTx(tx, id, *current)
+		if err != nil {
+			return fmt.Errorf("error granting role %d to employee %d: %w", *current, id, err)
+		}
+		// роль уже была выдана раньше, например как дополнительная
+		if isGranted {
+			if err = service.recordTx(tx, actor, audit.ActionAddRole, id, nil, roleGrant{RoleId: *current}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// requireGrantable выдать роль может только тот, у кого есть все её права; изменения от имени самого
+// сервиса, без Caller, не проверяются
+func (service *Service) requireGrantable(actor audit.Actor, roleId int64) error {
+	if actor.Caller == nil {
+		return nil
+	}
+	return role.RequireGrantable(service.roleRepo, actor.Caller, []int64{roleId})
+}
+
+// checkRoleTx проверяет, что назначаемая роль существует; пустая роль допустима
+func (service *Service) checkRoleTx(tx *sqlx.Tx, roleId *int64) error {
+	if roleId == nil {
+		return nil
+	}
+	isExist, err := service.repo.ExistsRoleByIdTx(tx, *roleId)
+	if err != nil {
+		return fmt.Errorf("error finding role with id %d: %w", *roleId, err)
+	}
+	if !isExist {
+		return common.NotFoundError{Resource: "role", ID: *roleId}
+	}
+	return nil
+}
+
+// roleGrant состояние выдачи роли в журнале аудита
+type roleGrant struct {
+	RoleId int64 `json:"role_id"`
+}
+
+// recordCreatedTx записывает создание сотрудника с его состоянием после всех изменений транзакции;
+// начальное состояние жизненного цикла становится первой записью его истории
+func (service *Service) recordCreatedTx(tx *sqlx.Tx, actor audit.Actor, id int64) error {
+	created, err := service.findByIdTx(tx, id)
+	if err != nil {
+		return err
+	}
+	err = service.repo.SaveStatusHistoryTx(tx, StatusHistoryEntity{
+		EmployeeId: id,
+		ToStatus:   created.Status,
+		Actor:      actor.Subject,
+	})
+	if err != nil {
+		return fmt.Errorf("error saving status history of employee with id: %d %w", id, err)
+	}
+	return service.recordTx(tx, actor, audit.ActionCreate, id, nil, created.toResponse())
+}
+
+func (service *Service) recordTx(tx *sqlx.Tx, actor audit.Actor, action string, id int64, before any, after any) error {
+	return service.auditor.RecordTx(tx, actor, audit.Record{
+		Action:     action,
+		EntityType: audit.EntityEmployee,
+		EntityId:   id,
+		Before:     before,
+		After:      after,
+	})
 }
@@ -1,13 +1,20 @@
 package employee
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/78bits/go-sqlmock-sqlx"
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"idm/inner/audit"
+	"idm/inner/common"
+	"idm/inner/role"
 	"idm/inner/validator"
+	"io"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 )
@@ -27,6 +34,28 @@ type MockRepo struct {
 	mock.Mock
 }
 
+type MockRoleRepo struct {
+	mock.Mock
+}
+
+func (m *MockRoleRepo) FindPermissionsByRoleIds(ids []int64) ([]role.PermissionEntity, error) {
+	args := m.Called(ids)
+	return args.Get(0).([]role.PermissionEntity), args.Error(1)
+}
+
+// grantedPermissions права вызывающего в тестах
+type grantedPermissions []string
+
+func (p grantedPermissions) HasPermission(permission string) (bool, error) {
+	return slices.Contains(p, permission), nil
+}
+
+// adminRole права роли 2 в тестах выдачи ролей
+var adminRole = []role.PermissionEntity{
+	{RoleId: 2, Resource: "employees", Action: "write"},
+	{RoleId: 2, Resource: "roles", Action: "write"},
+}
+
 func (m *MockRepo) FindById(id int64) (employee Entity, err error) {
 	args := m.Called(id)
 	return args.Get(0).(Entity), args.Error(1)
@@ -72,6 +101,141 @@ func (m *MockRepo) SaveTx(tx *sqlx.Tx, entity Entity) (int64, error) {
 	return args.Get(0).(int64), args.Error(1)
 }
 
+func (m *MockRepo) FindByNameAndNotIdTx(tx *sqlx.Tx, name string, id int64) (bool, error) {
+	args := m.Called(tx, name, id)
+	return args.Get(0).(bool), args.Error(1)
+}
+
+func (m *MockRepo) UpdateTx(tx *sqlx.Tx, entity Entity) (Entity, error) {
+	args := m.Called(tx, entity)
+	return args.Get(0).(Entity), args.Error(1)
+}
+
+func (m *MockRepo) ExistsRoleByIdTx(tx *sqlx.Tx, roleId int64) (bool, error) {
+	args := m.Called(tx, roleId)
+	return args.Get(0).(bool), args.Error(1)
+}
+
+func (m *MockRepo) UpdateRoleTx(tx *sqlx.Tx, id int64, roleId *int64) (Entity, error) {
+	args := m.Called(tx, id, roleId)
+	return args.Get(0).(Entity), args.Error(1)
+}
+
+func (m *MockRepo) FindByIdTx(tx *sqlx.Tx, id int64) (Entity, error) {
+	args := m.Called(tx, id)
+	return args.Get(0).(Entity), args.Error(1)
+}
+
+func (m *MockRepo) FindRolesByEmployeeId(id int64) ([]RoleEntity, error) {
+	args := m.Called(id)
+	return args.Get(0).([]RoleEntity), args.Error(1)
+}
+
+func (m *MockRepo) GrantRoleTx(tx *sqlx.Tx, id int64, roleId int64) (bool, error) {
+	args := m.Called(tx, id, roleId)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepo) RevokeRoleTx(tx *sqlx.Tx, id int64, roleId int64) (bool, error) {
+	args := m.Called(tx, id, roleId)
+	return args.Get(0).(bool), args.Error(1)
+}
+
+func (m *MockRepo) SaveWithRoleNameTx(tx *sqlx.Tx, entity Entity, roleName string) (int64, error) {
+	args := m.Called(tx, entity, roleName)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepo) DeleteTx(tx *sqlx.Tx, id int64) (Entity, error) {
+	args := m.Called(tx, id)
+	return args.Get(0).(Entity), args.Error(1)
+}
+
+func (m *MockRepo) DeleteAllByIdsTx(tx *sqlx.Tx, ids []int64) ([]Entity, error) {
+	args := m.Called(tx, ids)
+	return args.Get(0).([]Entity), args.Error(1)
+}
+
+func (m *MockRepo) FindAllIncludingDeleted() ([]Entity, error) {
+	args := m.Called()
+	return args.Get(0).([]Entity), args.Error(1)
+}
+
+func (m *MockRepo) FindByIdIncludingDeleted(id int64) (Entity, error) {
+	args := m.Called(id)
+	return args.Get(0).(Entity), args.Error(1)
+}
+
+func (m *MockRepo) RestoreTx(tx *sqlx.Tx, id int64) (Entity, error) {
+	args := m.Called(tx, id)
+	return args.Get(0).(Entity), args.Error(1)
+}
+
+func (m *MockRepo) PurgeTx(tx *sqlx.Tx, deletedBefore time.Time) ([]Entity, error) {
+	args := m.Called(tx, deletedBefore)
+	return args.Get(0).([]Entity), args.Error(1)
+}
+
+func (m *MockRepo) UpdateStatusTx(tx *sqlx.Tx, id int64, status string) (Entity, error) {
+	args := m.Called(tx, id, status)
+	return args.Get(0).(Entity), args.Error(1)
+}
+
+func (m *MockRepo) RevokeAllRolesTx(tx *sqlx.Tx, id int64) ([]int64, error) {
+	args := m.Called(tx, id)
+	return args.Get(0).([]int64), args.Error(1)
+}
+
+func (m *MockRepo) SaveStatusHistoryTx(tx *sqlx.Tx, entry StatusHistoryEntity) error {
+	args := m.Called(tx, entry)
+	return args.Error(0)
+}
+
+func (m *MockRepo) FindStatusHistory(id int64) ([]StatusHistoryEntity, error) {
+	args := m.Called(id)
+	return args.Get(0).([]StatusHistoryEntity), args.Error(1)
+}
+
+func (m *MockRepo) FindPage(filter Filter) ([]Entity, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]Entity), args.Error(1)
+}
+
+func (m *MockRepo) Count(filter Filter) (int64, error) {
+	args := m.Called(filter)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepo) Search(query string, limit int) ([]SearchEntity, error) {
+	args := m.Called(query, limit)
+	return args.Get(0).([]SearchEntity), args.Error(1)
+}
+
+// Export передаёт в each заданных сотрудников, затем возвращает заданную ошибку
+func (m *MockRepo) Export(filter Filter, each func(entity ExportEntity) error) error {
+	args := m.Called(filter)
+	for _, entity := range args.Get(0).([]ExportEntity) {
+		if err := each(entity); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+// auditRecorder запоминает записи журнала аудита вместо записи в базу
+type auditRecorder struct {
+	actors  []audit.Actor
+	records []audit.Record
+}
+
+func (r *auditRecorder) RecordTx(_ *sqlx.Tx, actor audit.Actor, record audit.Record) error {
+	r.actors = append(r.actors, actor)
+	r.records = append(r.records, record)
+	return nil
+}
+
+var actor = audit.Actor{Subject: "42", RequestId: "request-1"}
+
 func TestServiceSaveTxSuccess(t *testing.T) {
 	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	if err != nil {
@@ -87,20 +251,29 @@ func TestServiceSaveTxSuccess(t *testing.T) {
 	mock.ExpectBegin()
 
 	rows := sqlmock.NewRows([]string{"exists"}).AddRow(false)
-	mock.ExpectQuery("select exists(select 1 from employee where name = $1)").
+	mock.ExpectQuery("select exists(select 1 from employee where name = $1 and deleted_at is null)").
 		WithArgs("test").
 		WillReturnRows(rows)
 
 	insertRows := sqlmock.NewRows([]string{"id"}).AddRow(1)
-	mock.ExpectQuery("insert into employee (name) values ($1) returning id").
-		WithArgs("test").
+	mock.ExpectQuery("insert into employee (name, role_id, status) values ($1, $2, $3) returning id").
+		WithArgs("test", nil, StatusPending).
 		WillReturnRows(insertRows)
 
+	createdRows := sqlmock.NewRows([]string{"id", "name", "role_id", "role_name", "status"}).AddRow(1, "test", nil, nil, StatusPending)
+	mock.ExpectQuery("SELECT e.*, r.name AS role_name FROM employee e LEFT JOIN role r ON r.id = e.role_id WHERE e.id=$1 AND e.deleted_at IS NULL").
+		WithArgs(1).
+		WillReturnRows(createdRows)
+
+	mock.ExpectExec("insert into employee_status_history (employee_id, from_status, to_status, reason, actor) values ($1, $2, $3, $4, $5)").
+		WithArgs(1, nil, StatusPending, "", "42").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
 	repo := &Repository{db: sqlxDB}
 	v := validator.New()
-	service := NewService(repo, v)
+	service := NewService(repo, nil, v, new(auditRecorder), 0)
 
-	id, err := service.SaveTx("test")
+	id, err := service.SaveTx(actor, Entity{Name: "test"})
 	mock.ExpectCommit()
 
 	assert.NoError(t, err)
@@ -117,11 +290,11 @@ func TestServiceSaveTxBeginTxError(t *testing.T) {
 
 	repo := &Repository{db: sqlxDB}
 	v := validator.New()
-	service := NewService(repo, v)
+	service := NewService(repo, nil, v, new(auditRecorder), 0)
 
 	mock.ExpectBegin().WillReturnError(fmt.Errorf("tx begin error"))
 
-	id, err := service.SaveTx("test")
+	id, err := service.SaveTx(actor, Entity{Name: "test"})
 	assert.Error(t, err)
 	assert.Zero(t, id)
 	assert.Contains(t, err.Error(), "error creating transaction")
@@ -137,17 +310,17 @@ func TestServiceSaveTxFindByNameError(t *testing.T) {
 
 	repo := &Repository{db: sqlxDB}
 	v := validator.New()
-	service := NewService(repo, v)
+	service := NewService(repo, nil, v, new(auditRecorder), 0)
 
 	mock.ExpectBegin()
 
-	mock.ExpectQuery("select exists(select 1 from employee where name = $1)").
+	mock.ExpectQuery("select exists(select 1 from employee where name = $1 and deleted_at is null)").
 		WithArgs("test").
 		WillReturnError(fmt.Errorf("find by name error"))
 
 	mock.ExpectRollback()
 
-	id, err := service.SaveTx("test")
+	id, err := service.SaveTx(actor, Entity{Name: "test"})
 	assert.Error(t, err)
 	assert.Zero(t, id)
 	assert.Contains(t, err.Error(), "error finding employee by name")
@@ -163,17 +336,17 @@ func TestServiceSaveTxEmployeeAlreadyExists(t *testing.T) {
 
 	repo := &Repository{db: sqlxDB}
 	v := validator.New()
-	service := NewService(repo, v)
+	service := NewService(repo, nil, v, new(auditRecorder), 0)
 
 	mock.ExpectBegin()
 
-	mock.ExpectQuery("select exists(select 1 from employee where name = $1)").
+	mock.ExpectQuery("select exists(select 1 from employee where name = $1 and deleted_at is null)").
 		WithArgs("test").
 		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
 
 	mock.ExpectRollback()
 
-	id, err := service.SaveTx("test")
+	id, err := service.SaveTx(actor, Entity{Name: "test"})
 	assert.Error(t, err)
 	assert.Zero(t, id)
 	assert.Contains(t, err.Error(), "already exists")
@@ -189,21 +362,21 @@ func TestServiceSaveTxSaveError(t *testing.T) {
 
 	repo := &Repository{db: sqlxDB}
 	v := validator.New()
-	service := NewService(repo, v)
+	service := NewService(repo, nil, v, new(auditRecorder), 0)
 
 	mock.ExpectBegin()
 
-	mock.ExpectQuery("select exists(select 1 from employee where name = $1)").
+	mock.ExpectQuery("select exists(select 1 from employee where name = $1 and deleted_at is null)").
 		WithArgs("test").
 		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
 
-	mock.ExpectQuery("insert into employee (name) values ($1) returning id").
-		WithArgs("test").
+	mock.ExpectQuery("insert into employee (name, role_id, status) values ($1, $2, $3) returning id").
+		WithArgs("test", nil, StatusPending).
 		WillReturnError(fmt.Errorf("save error"))
 
 	mock.ExpectRollback()
 
-	id, err := service.SaveTx("test")
+	id, err := service.SaveTx(actor, Entity{Name: "test"})
 	assert.Error(t, err)
 	assert.Zero(t, id)
 	assert.Contains(t, err.Error(), "error creating employee")
@@ -255,10 +428,11 @@ func TestServices(t *testing.T) {
 
 	var a = assert.New(t)
 	var val = validator.New()
+	var noTx *sqlx.Tx
 
 	t.Run("should return found employee by id", func(t *testing.T) {
 		var repo = new(MockRepo)
-		var svc = NewService(repo, val)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
 		var entity = Entity{
 			Id:        1,
 			Name:      "John Doe",
@@ -277,7 +451,7 @@ func TestServices(t *testing.T) {
 
 	t.Run("should return an error when not found by id", func(t *testing.T) {
 		var repo = new(MockRepo)
-		var svc = NewService(repo, val)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
 		var entity = Entity{}
 		var err = errors.New("user not found")
 		var want = fmt.Errorf("error finding employee with id 1: %w", err)
@@ -293,7 +467,7 @@ func TestServices(t *testing.T) {
 
 	t.Run("should return all found employees by ids", func(t *testing.T) {
 		var repo = new(MockRepo)
-		var svc = NewService(repo, val)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
 		var entityes = []Entity{
 			{
 				Id:        1,
@@ -320,7 +494,7 @@ func TestServices(t *testing.T) {
 
 	t.Run("should return all employees", func(t *testing.T) {
 		var repo = new(MockRepo)
-		var svc = NewService(repo, val)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
 		var entityes = []Entity{
 			{
 				Id:        1,
@@ -347,18 +521,24 @@ func TestServices(t *testing.T) {
 
 	t.Run("should delete all employees by ids", func(t *testing.T) {
 		var repo = new(MockRepo)
-		var svc = NewService(repo, val)
+		var auditor = new(auditRecorder)
+		var svc = NewService(repo, nil, val, auditor, 0)
+		var deleted = []Entity{{Id: 1, Name: "John Doe"}, {Id: 2, Name: "Doe John"}}
 
-		repo.On("DeleteAllByIds", []int64{1, 2}).Return(nil)
-		err := svc.DeleteAllByIds([]int64{1, 2})
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("DeleteAllByIdsTx", noTx, []int64{1, 2}).Return(deleted, nil)
+		err := svc.DeleteAllByIds(actor, []int64{1, 2})
 
 		a.Nil(err)
-		a.True(repo.AssertNumberOfCalls(t, "DeleteAllByIds", 1))
+		a.True(repo.AssertNumberOfCalls(t, "DeleteAllByIdsTx", 1))
+		a.Len(auditor.records, 2)
+		a.Equal(audit.ActionDelete, auditor.records[1].Action)
+		a.Equal(int64(2), auditor.records[1].EntityId)
 	})
 
 	t.Run("should return an error when not found by ids", func(t *testing.T) {
 		var repo = new(MockRepo)
-		var svc = NewService(repo, val)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
 		var entity = []Entity{{
 			Id:        1,
 			Name:      "User",
@@ -379,18 +559,19 @@ func TestServices(t *testing.T) {
 
 	t.Run("should delete by id", func(t *testing.T) {
 		var repo = new(MockRepo)
-		var svc = NewService(repo, val)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
 
-		repo.On("Delete", valueId).Return(nil)
-		err := svc.Delete(1)
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("DeleteTx", noTx, valueId).Return(Entity{Id: 1, Name: "John Doe"}, nil)
+		err := svc.Delete(actor, 1)
 
 		a.Nil(err)
-		a.True(repo.AssertNumberOfCalls(t, "Delete", 1))
+		a.True(repo.AssertNumberOfCalls(t, "DeleteTx", 1))
 	})
 
 	t.Run("should return saved employee", func(t *testing.T) {
 		var repo = new(MockRepo)
-		var svc = NewService(repo, val)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
 		roleName := "Разработчик"
 		var entity = Entity{
 			Name:      "User",
@@ -398,17 +579,21 @@ func TestServices(t *testing.T) {
 			UpdatedAt: time.Now(),
 		}
 
-		repo.On("Save", entity, roleName).Return(valueId, nil)
-		var got, err = svc.Save(entity, roleName)
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("SaveWithRoleNameTx", noTx, entity, roleName).Return(valueId, nil)
+		repo.On("FindByIdTx", noTx, valueId).Return(Entity{Id: 1, Name: "User", Status: StatusActive}, nil)
+		repo.On("SaveStatusHistoryTx", noTx, StatusHistoryEntity{EmployeeId: 1, ToStatus: StatusActive, Actor: "42"}).Return(nil)
+		var got, err = svc.Save(actor, entity, roleName)
 
 		a.Nil(err)
 		a.Equal(valueId, got)
-		a.True(repo.AssertNumberOfCalls(t, "Save", 1))
+		a.True(repo.AssertNumberOfCalls(t, "SaveWithRoleNameTx", 1))
+		a.True(repo.AssertNumberOfCalls(t, "SaveStatusHistoryTx", 1))
 	})
 
 	t.Run("should return error while save employee", func(t *testing.T) {
 		var repo = new(MockRepo)
-		var svc = NewService(repo, val)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
 		var entity = Entity{
 			Name: "",
 		}
@@ -416,12 +601,877 @@ func TestServices(t *testing.T) {
 		var want = fmt.Errorf("error saving employee name: %s: %w", entity.Name, err)
 		roleName := "Разработчик"
 
-		repo.On("Save", entity, roleName).Return(int64(0), err)
-		var result, got = svc.Save(entity, roleName)
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("SaveWithRoleNameTx", noTx, entity, roleName).Return(int64(0), err)
+		var result, got = svc.Save(actor, entity, roleName)
 
 		a.Equal(int64(0), result)
 		a.NotNil(got)
 		a.Equal(want, got)
-		a.True(repo.AssertNumberOfCalls(t, "Save", 1))
+		a.True(repo.AssertNumberOfCalls(t, "SaveWithRoleNameTx", 1))
+	})
+}
+
+func TestServiceUpdate(t *testing.T) {
+	var a = assert.New(t)
+	var val = validator.New()
+	var noTx *sqlx.Tx
+	roleId := int64(2)
+
+	t.Run("should return not found when employee is missing", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
+
+		repo.On("FindById", int64(5)).Return(Entity{}, sql.ErrNoRows)
+		var _, err = svc.FindById(5)
+
+		a.ErrorAs(err, &common.NotFoundError{})
+	})
+
+	t.Run("should update employee", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
+		var request = UpdateRequest{Name: "Jane Doe", RoleId: &roleId}
+		var entity = request.ToEntity(1)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(1)).Return(Entity{Id: 1, Name: "John Doe"}, nil)
+		repo.On("FindByNameAndNotIdTx", noTx, "Jane Doe", int64(1)).Return(false, nil)
+		repo.On("ExistsRoleByIdTx", noTx, roleId).Return(true, nil)
+		repo.On("UpdateTx", noTx, entity).Return(entity, nil)
+		repo.On("GrantRoleTx", noTx, int64(1), roleId).Return(true, nil)
+		var got, err = svc.UpdateEmployee(actor, 1, request)
+
+		a.Nil(err)
+		a.Equal(entity.toResponse(), got)
+		a.True(repo.AssertNumberOfCalls(t, "UpdateTx", 1))
+	})
+
+	t.Run("should return validation error on invalid update", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
+
+		var _, err = svc.UpdateEmployee(actor, 1, UpdateRequest{Name: "J", RoleId: &roleId})
+
+		a.ErrorAs(err, &common.RequestValidationError{})
+		a.True(repo.AssertNotCalled(t, "BeginTransaction"))
+	})
+
+	t.Run("should return already exists when name is taken", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(1)).Return(Entity{Id: 1, Name: "John Doe"}, nil)
+		repo.On("FindByNameAndNotIdTx", noTx, "Jane Doe", int64(1)).Return(true, nil)
+		var _, err = svc.UpdateEmployee(actor, 1, UpdateRequest{Name: "Jane Doe", RoleId: &roleId})
+
+		a.ErrorAs(err, &common.AlreadyExistsError{})
+		a.True(repo.AssertNotCalled(t, "UpdateTx"))
+	})
+
+	t.Run("should return not found when updating missing employee", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
+		var request = UpdateRequest{Name: "Jane Doe", RoleId: &roleId}
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(9)).Return(Entity{}, sql.ErrNoRows)
+		var _, err = svc.UpdateEmployee(actor, 9, request)
+
+		a.ErrorAs(err, &common.NotFoundError{})
+		a.True(repo.AssertNotCalled(t, "UpdateTx"))
+	})
+
+	t.Run("should patch only passed fields", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
+		var name = "Jane Doe"
+		var current = Entity{Id: 1, Name: "John Doe", RoleID: &roleId}
+		var patched = Entity{Id: 1, Name: name, RoleID: &roleId}
+
+		repo.On("FindById", int64(1)).Return(current, nil)
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(1)).Return(current, nil)
+		repo.On("FindByNameAndNotIdTx", noTx, name, int64(1)).Return(false, nil)
+		repo.On("ExistsRoleByIdTx", noTx, roleId).Return(true, nil)
+		repo.On("UpdateTx", noTx, patched).Return(patched, nil)
+		repo.On("GrantRoleTx", noTx, int64(1), roleId).Return(true, nil)
+		var got, err = svc.PatchEmployee(actor, 1, PatchRequest{Name: &name})
+
+		a.Nil(err)
+		a.Equal(name, got.Name)
+		a.True(repo.AssertNotCalled(t, "RevokeRoleTx"))
+	})
+
+	t.Run("should return not found when deleting missing employee", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("DeleteTx", noTx, int64(9)).Return(Entity{}, sql.ErrNoRows)
+		err := svc.Delete(actor, 9)
+
+		a.ErrorAs(err, &common.NotFoundError{})
+	})
+}
+
+func TestServiceRoleAssignment(t *testing.T) {
+	var a = assert.New(t)
+	var val = validator.New()
+	var noTx *sqlx.Tx
+	roleId := int64(3)
+	roleName := "Разработчик"
+
+	t.Run("should save employee with role", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
+		var entity = Entity{Name: "John Doe", RoleID: &roleId, Status: StatusPending}
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByNameTx", noTx, "John Doe").Return(false, nil)
+		repo.On("ExistsRoleByIdTx", noTx, roleId).Return(true, nil)
+		repo.On("SaveTx", noTx, entity).Return(int64(10), nil)
+		repo.On("GrantRoleTx", noTx, int64(10), roleId).Return(true, nil)
+		repo.On("FindByIdTx", noTx, int64(10)).Return(Entity{Id: 10, Name: "John Doe", RoleID: &roleId, Status: StatusActive}, nil)
+		repo.On("SaveStatusHistoryTx", noTx, mock.Anything).Return(nil)
+		var got, err = svc.CreateEmployee(actor, CreateRequest{Name: "John Doe", RoleId: &roleId})
+
+		a.Nil(err)
+		a.Equal(int64(10), got)
+		a.True(repo.AssertNumberOfCalls(t, "SaveTx", 1))
+		a.True(repo.AssertNumberOfCalls(t, "GrantRoleTx", 1))
+	})
+
+	t.Run("should not save employee with missing role", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByNameTx", noTx, "John Doe").Return(false, nil)
+		repo.On("ExistsRoleByIdTx", noTx, roleId).Return(false, nil)
+		var _, err = svc.CreateEmployee(actor, CreateRequest{Name: "John Doe", RoleId: &roleId})
+
+		a.ErrorAs(err, &common.NotFoundError{})
+		a.Contains(err.Error(), "role")
+		a.True(repo.AssertNotCalled(t, "SaveTx"))
+	})
+
+	t.Run("should change role and revoke previous one", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
+		var previous = int64(1)
+		var updated = Entity{Id: 1, Name: "John Doe", RoleID: &roleId, RoleName: &roleName}
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(1)).Return(Entity{Id: 1, Name: "John Doe", RoleID: &previous}, nil)
+		repo.On("ExistsRoleByIdTx", noTx, roleId).Return(true, nil)
+		repo.On("UpdateRoleTx", noTx, int64(1), &roleId).Return(updated, nil)
+		repo.On("RevokeRoleTx", noTx, int64(1), previous).Return(true, nil)
+		repo.On("GrantRoleTx", noTx, int64(1), roleId).Return(true, nil)
+		var got, err = svc.AssignRole(actor, 1, RoleRequest{RoleId: roleId})
+
+		a.Nil(err)
+		a.Equal(&roleId, got.RoleId)
+		a.Equal(&roleName, got.RoleName)
+		a.True(repo.AssertNumberOfCalls(t, "RevokeRoleTx", 1))
+		a.True(repo.AssertNumberOfCalls(t, "GrantRoleTx", 1))
+	})
+
+	t.Run("should return not found when assigning missing role", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(1)).Return(Entity{Id: 1, Name: "John Doe"}, nil)
+		repo.On("ExistsRoleByIdTx", noTx, roleId).Return(false, nil)
+		var _, err = svc.AssignRole(actor, 1, RoleRequest{RoleId: roleId})
+
+		a.ErrorAs(err, &common.NotFoundError{})
+		a.True(repo.AssertNotCalled(t, "UpdateRoleTx"))
+	})
+
+	t.Run("should revoke role", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
+		var noRole *int64
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(1)).Return(Entity{Id: 1, Name: "John Doe", RoleID: &roleId}, nil)
+		repo.On("UpdateRoleTx", noTx, int64(1), noRole).Return(Entity{Id: 1, Name: "John Doe"}, nil)
+		repo.On("RevokeRoleTx", noTx, int64(1), roleId).Return(true, nil)
+		var got, err = svc.RevokeRole(actor, 1)
+
+		a.Nil(err)
+		a.Nil(got.RoleId)
+		a.True(repo.AssertNotCalled(t, "ExistsRoleByIdTx"))
+		a.True(repo.AssertNotCalled(t, "GrantRoleTx"))
+	})
+
+	t.Run("should return not found when employee is missing", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
+		var noRole *int64
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(9)).Return(Entity{}, sql.ErrNoRows)
+		var _, err = svc.RevokeRole(actor, 9)
+
+		a.ErrorAs(err, &common.NotFoundError{})
+		a.True(repo.AssertNotCalled(t, "UpdateRoleTx", noTx, int64(9), noRole))
+	})
+}
+
+func TestServiceRoleGrants(t *testing.T) {
+	var a = assert.New(t)
+	var val = validator.New()
+	var noTx *sqlx.Tx
+
+	t.Run("should return all granted roles", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
+		var roles = []RoleEntity{{Id: 1, Name: "Администратор"}, {Id: 3, Name: "Разработчик"}}
+
+		repo.On("FindById", int64(1)).Return(Entity{Id: 1}, nil)
+		repo.On("FindRolesByEmployeeId", int64(1)).Return(roles, nil)
+		var got, err = svc.FindRoles(1)
+
+		a.Nil(err)
+		a.Equal(toSliceRoleResponse(roles), got)
+	})
+
+	t.Run("should return not found for roles of missing employee", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
+
+		repo.On("FindById", int64(9)).Return(Entity{}, sql.ErrNoRows)
+		var _, err = svc.FindRoles(9)
+
+		a.ErrorAs(err, &common.NotFoundError{})
+		a.True(repo.AssertNotCalled(t, "FindRolesByEmployeeId", int64(9)))
+	})
+
+	t.Run("should grant additional role", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(1)).Return(Entity{Id: 1}, nil)
+		repo.On("ExistsRoleByIdTx", noTx, int64(2)).Return(true, nil)
+		repo.On("GrantRoleTx", noTx, int64(1), int64(2)).Return(true, nil)
+		var err = svc.AddRole(actor, 1, 2)
+
+		a.Nil(err)
+		a.True(repo.AssertNumberOfCalls(t, "GrantRoleTx", 1))
+	})
+
+	t.Run("should not grant missing role", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(1)).Return(Entity{Id: 1}, nil)
+		repo.On("ExistsRoleByIdTx", noTx, int64(42)).Return(false, nil)
+		var err = svc.AddRole(actor, 1, 42)
+
+		a.ErrorAs(err, &common.NotFoundError{})
+		a.True(repo.AssertNotCalled(t, "GrantRoleTx", noTx, int64(1), int64(42)))
+	})
+
+	t.Run("should grant role whose permissions the caller holds", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var roleRepo = new(MockRoleRepo)
+		var svc = NewService(repo, roleRepo, val, new(auditRecorder), 0)
+		var caller = audit.Actor{Subject: "7", Caller: grantedPermissions{"employees:write", "roles:write"}}
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(1)).Return(Entity{Id: 1}, nil)
+		repo.On("ExistsRoleByIdTx", noTx, int64(2)).Return(true, nil)
+		roleRepo.On("FindPermissionsByRoleIds", []int64{2}).Return(adminRole, nil)
+		repo.On("GrantRoleTx", noTx, int64(1), int64(2)).Return(true, nil)
+		var err = svc.AddRole(caller, 1, 2)
+
+		a.Nil(err)
 	})
+
+	t.Run("should not grant role with permissions the caller does not hold", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var roleRepo = new(MockRoleRepo)
+		var svc = NewService(repo, roleRepo, val, new(auditRecorder), 0)
+		var caller = audit.Actor{Subject: "7", Caller: grantedPermissions{"roles:write"}}
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(1)).Return(Entity{Id: 1}, nil)
+		repo.On("ExistsRoleByIdTx", noTx, int64(2)).Return(true, nil)
+		roleRepo.On("FindPermissionsByRoleIds", []int64{2}).Return(adminRole, nil)
+		var err = svc.AddRole(caller, 1, 2)
+
+		var denied common.PermissionDeniedError
+		a.ErrorAs(err, &denied)
+		a.Equal([]string{"employees:write"}, denied.Permissions)
+		a.True(repo.AssertNotCalled(t, "GrantRoleTx", noTx, int64(1), int64(2)))
+	})
+
+	t.Run("should not assign primary role with permissions the caller does not hold", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var roleRepo = new(MockRoleRepo)
+		var svc = NewService(repo, roleRepo, val, new(auditRecorder), 0)
+		var caller = audit.Actor{Subject: "7", Caller: grantedPermissions{"roles:write"}}
+		var roleId = int64(2)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(1)).Return(Entity{Id: 1}, nil)
+		repo.On("ExistsRoleByIdTx", noTx, roleId).Return(true, nil)
+		repo.On("UpdateRoleTx", noTx, int64(1), &roleId).Return(Entity{Id: 1, RoleID: &roleId}, nil)
+		roleRepo.On("FindPermissionsByRoleIds", []int64{2}).Return(adminRole, nil)
+		var _, err = svc.AssignRole(caller, 1, RoleRequest{RoleId: roleId})
+
+		a.ErrorAs(err, &common.PermissionDeniedError{})
+		a.True(repo.AssertNotCalled(t, "GrantRoleTx", noTx, int64(1), roleId))
+	})
+
+	t.Run("should revoke granted role", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("RevokeRoleTx", noTx, int64(1), int64(2)).Return(true, nil)
+		var err = svc.RemoveRole(actor, 1, 2)
+
+		a.Nil(err)
+	})
+
+	t.Run("should return not found when role was not granted", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, val, new(auditRecorder), 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("RevokeRoleTx", noTx, int64(1), int64(2)).Return(false, nil)
+		var err = svc.RemoveRole(actor, 1, 2)
+
+		a.ErrorAs(err, &common.NotFoundError{})
+	})
+}
+
+func TestServiceAudit(t *testing.T) {
+	var a = assert.New(t)
+	var val = validator.New()
+	var noTx *sqlx.Tx
+	roleId := int64(2)
+
+	t.Run("should record state before and after update", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var auditor = new(auditRecorder)
+		var svc = NewService(repo, nil, val, auditor, 0)
+		var current = Entity{Id: 1, Name: "John Doe", RoleID: &roleId}
+		var updated = Entity{Id: 1, Name: "Jane Doe", RoleID: &roleId}
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(1)).Return(current, nil)
+		repo.On("FindByNameAndNotIdTx", noTx, "Jane Doe", int64(1)).Return(false, nil)
+		repo.On("ExistsRoleByIdTx", noTx, roleId).Return(true, nil)
+		repo.On("UpdateTx", noTx, updated).Return(updated, nil)
+		// основная роль не менялась и уже выдана
+		repo.On("GrantRoleTx", noTx, int64(1), roleId).Return(false, nil)
+		var _, err = svc.UpdateEmployee(actor, 1, UpdateRequest{Name: "Jane Doe", RoleId: &roleId})
+
+		a.Nil(err)
+		a.Equal([]audit.Actor{actor}, auditor.actors)
+		a.Equal([]audit.Record{{
+			Action:     audit.ActionUpdate,
+			EntityType: audit.EntityEmployee,
+			EntityId:   1,
+			Before:     current.toResponse(),
+			After:      updated.toResponse(),
+		}}, auditor.records)
+	})
+
+	t.Run("should record granted role", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var auditor = new(auditRecorder)
+		var svc = NewService(repo, nil, val, auditor, 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(1)).Return(Entity{Id: 1}, nil)
+		repo.On("ExistsRoleByIdTx", noTx, int64(2)).Return(true, nil)
+		repo.On("GrantRoleTx", noTx, int64(1), int64(2)).Return(true, nil)
+		var err = svc.AddRole(actor, 1, 2)
+
+		a.Nil(err)
+		a.Len(auditor.records, 1)
+		a.Equal(audit.ActionAddRole, auditor.records[0].Action)
+		a.Equal(roleGrant{RoleId: 2}, auditor.records[0].After)
+	})
+
+	t.Run("should record primary role change as revoke and grant", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var auditor = new(auditRecorder)
+		var svc = NewService(repo, nil, val, auditor, 0)
+		var previousRoleId, newRoleId = int64(1), int64(2)
+		var current = Entity{Id: 1, Name: "John Doe", RoleID: &previousRoleId}
+		var updated = Entity{Id: 1, Name: "John Doe", RoleID: &newRoleId}
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(1)).Return(current, nil)
+		repo.On("ExistsRoleByIdTx", noTx, newRoleId).Return(true, nil)
+		repo.On("UpdateRoleTx", noTx, int64(1), &newRoleId).Return(updated, nil)
+		repo.On("RevokeRoleTx", noTx, int64(1), previousRoleId).Return(true, nil)
+		repo.On("GrantRoleTx", noTx, int64(1), newRoleId).Return(true, nil)
+		var _, err = svc.AssignRole(actor, 1, RoleRequest{RoleId: newRoleId})
+
+		a.Nil(err)
+		a.Equal([]audit.Record{
+			{Action: audit.ActionUpdate, EntityType: audit.EntityEmployee, EntityId: 1,
+				Before: current.toResponse(), After: updated.toResponse()},
+			{Action: audit.ActionRemoveRole, EntityType: audit.EntityEmployee, EntityId: 1,
+				Before: roleGrant{RoleId: previousRoleId}},
+			{Action: audit.ActionAddRole, EntityType: audit.EntityEmployee, EntityId: 1,
+				After: roleGrant{RoleId: newRoleId}},
+		}, auditor.records)
+	})
+
+	t.Run("should not record failed update", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var auditor = new(auditRecorder)
+		var svc = NewService(repo, nil, val, auditor, 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(9)).Return(Entity{}, sql.ErrNoRows)
+		var _, err = svc.UpdateEmployee(actor, 9, UpdateRequest{Name: "Jane Doe", RoleId: &roleId})
+
+		a.ErrorAs(err, &common.NotFoundError{})
+		a.Empty(auditor.records)
+	})
+}
+
+func TestServiceSoftDelete(t *testing.T) {
+	var a = assert.New(t)
+	var noTx *sqlx.Tx
+
+	t.Run("should restore deleted employee", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var auditor = new(auditRecorder)
+		var svc = NewService(repo, nil, validator.New(), auditor, 0)
+		var restored = Entity{Id: 5, Name: "Иванов Петр"}
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("RestoreTx", noTx, int64(5)).Return(restored, nil)
+		repo.On("FindByNameAndNotIdTx", noTx, restored.Name, int64(5)).Return(false, nil)
+		var got, err = svc.Restore(actor, 5)
+
+		a.Nil(err)
+		a.Equal(restored.toResponse(), got)
+		a.Len(auditor.records, 1)
+		a.Equal(audit.ActionRestore, auditor.records[0].Action)
+	})
+
+	t.Run("should return not found when employee is not deleted", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, validator.New(), new(auditRecorder), 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("RestoreTx", noTx, int64(1)).Return(Entity{}, sql.ErrNoRows)
+		var _, err = svc.Restore(actor, 1)
+
+		a.ErrorAs(err, &common.NotFoundError{})
+	})
+
+	t.Run("should not restore employee when name is taken", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var auditor = new(auditRecorder)
+		var svc = NewService(repo, nil, validator.New(), auditor, 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("RestoreTx", noTx, int64(5)).Return(Entity{Id: 5, Name: "Иванов Петр"}, nil)
+		repo.On("FindByNameAndNotIdTx", noTx, "Иванов Петр", int64(5)).Return(true, nil)
+		var _, err = svc.Restore(actor, 5)
+
+		a.ErrorAs(err, &common.AlreadyExistsError{})
+		a.Empty(auditor.records)
+	})
+
+	t.Run("should purge employees deleted before retention period", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var auditor = new(auditRecorder)
+		var retention = 7 * 24 * time.Hour
+		var svc = NewService(repo, nil, validator.New(), auditor, retention)
+		var purged = []Entity{{Id: 3}, {Id: 4}}
+		var deletedBefore = mock.MatchedBy(func(deletedBefore time.Time) bool {
+			return time.Since(deletedBefore) >= retention && time.Since(deletedBefore) < retention+time.Minute
+		})
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("PurgeTx", noTx, deletedBefore).Return(purged, nil)
+		var ids, err = svc.Purge(actor)
+
+		a.Nil(err)
+		a.Equal([]int64{3, 4}, ids)
+		a.Len(auditor.records, 2)
+		a.Equal(audit.ActionPurge, auditor.records[1].Action)
+		a.Nil(auditor.records[1].After)
+	})
+
+	t.Run("should use default retention", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, validator.New(), new(auditRecorder), 0)
+		var deletedBefore = mock.MatchedBy(func(deletedBefore time.Time) bool {
+			return time.Since(deletedBefore) >= common.DefaultPurgeRetention
+		})
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("PurgeTx", noTx, deletedBefore).Return([]Entity{}, nil)
+		var ids, err = svc.Purge(actor)
+
+		a.Nil(err)
+		a.Empty(ids)
+	})
+}
+
+func TestServiceLifecycle(t *testing.T) {
+	var a = assert.New(t)
+	var noTx *sqlx.Tx
+	var roleId = int64(3)
+
+	t.Run("should activate pending employee", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var auditor = new(auditRecorder)
+		var svc = NewService(repo, nil, validator.New(), auditor, 0)
+		var current = Entity{Id: 1, Name: "John Doe", Status: StatusPending}
+		var updated = Entity{Id: 1, Name: "John Doe", Status: StatusActive}
+		var pending = StatusPending
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(1)).Return(current, nil)
+		repo.On("UpdateStatusTx", noTx, int64(1), StatusActive).Return(updated, nil)
+		repo.On("SaveStatusHistoryTx", noTx, StatusHistoryEntity{
+			EmployeeId: 1,
+			FromStatus: &pending,
+			ToStatus:   StatusActive,
+			Reason:     "first day",
+			Actor:      "42",
+		}).Return(nil)
+		var got, err = svc.ChangeStatus(actor, 1, StatusRequest{Status: StatusActive, Reason: "first day"})
+
+		a.Nil(err)
+		a.Equal(StatusActive, got.Status)
+		a.True(repo.AssertNotCalled(t, "RevokeAllRolesTx", noTx, int64(1)))
+		a.Len(auditor.records, 1)
+		a.Equal(audit.ActionChangeStatus, auditor.records[0].Action)
+		a.Equal(current.toResponse(), auditor.records[0].Before)
+	})
+
+	t.Run("should revoke all roles on termination", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var auditor = new(auditRecorder)
+		var svc = NewService(repo, nil, validator.New(), auditor, 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(1)).Return(Entity{Id: 1, RoleID: &roleId, Status: StatusSuspended}, nil)
+		repo.On("RevokeAllRolesTx", noTx, int64(1)).Return([]int64{3, 5}, nil)
+		repo.On("UpdateStatusTx", noTx, int64(1), StatusTerminated).Return(Entity{Id: 1, Status: StatusTerminated}, nil)
+		repo.On("SaveStatusHistoryTx", noTx, mock.Anything).Return(nil)
+		var got, err = svc.ChangeStatus(actor, 1, StatusRequest{Status: StatusTerminated, Reason: "contract ended"})
+
+		a.Nil(err)
+		a.Nil(got.RoleId)
+		a.Len(auditor.records, 3)
+		a.Equal(audit.ActionRemoveRole, auditor.records[0].Action)
+		a.Equal(roleGrant{RoleId: 5}, auditor.records[1].Before)
+		a.Equal(audit.ActionChangeStatus, auditor.records[2].Action)
+	})
+
+	t.Run("should reject transition out of terminated", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var auditor = new(auditRecorder)
+		var svc = NewService(repo, nil, validator.New(), auditor, 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(1)).Return(Entity{Id: 1, Status: StatusTerminated}, nil)
+		var _, err = svc.ChangeStatus(actor, 1, StatusRequest{Status: StatusActive, Reason: "rehired"})
+
+		var validationErr common.RequestValidationError
+		a.ErrorAs(err, &validationErr)
+		a.Contains(validationErr.FieldErrors["status"], "from terminated to active")
+		a.True(repo.AssertNotCalled(t, "UpdateStatusTx", noTx, int64(1), StatusActive))
+		a.Empty(auditor.records)
+	})
+
+	t.Run("should reject transition to the same status", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, validator.New(), new(auditRecorder), 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(1)).Return(Entity{Id: 1, Status: StatusActive}, nil)
+		var _, err = svc.ChangeStatus(actor, 1, StatusRequest{Status: StatusActive, Reason: "again"})
+
+		a.ErrorAs(err, &common.RequestValidationError{})
+	})
+
+	t.Run("should require reason", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, validator.New(), new(auditRecorder), 0)
+
+		var _, err = svc.ChangeStatus(actor, 1, StatusRequest{Status: StatusSuspended})
+
+		a.ErrorAs(err, &common.RequestValidationError{})
+		a.True(repo.AssertNotCalled(t, "BeginTransaction"))
+	})
+
+	t.Run("should not grant roles to terminated employee", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, validator.New(), new(auditRecorder), 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(1)).Return(Entity{Id: 1, Status: StatusTerminated}, nil)
+		var err = svc.AddRole(actor, 1, roleId)
+
+		a.ErrorAs(err, &common.RequestValidationError{})
+		a.True(repo.AssertNotCalled(t, "GrantRoleTx", noTx, int64(1), roleId))
+	})
+
+	t.Run("should return status history", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, validator.New(), new(auditRecorder), 0)
+		var active = StatusActive
+
+		repo.On("FindById", int64(1)).Return(Entity{Id: 1}, nil)
+		repo.On("FindStatusHistory", int64(1)).Return([]StatusHistoryEntity{
+			{Id: 1, EmployeeId: 1, ToStatus: StatusActive},
+			{Id: 2, EmployeeId: 1, FromStatus: &active, ToStatus: StatusSuspended, Reason: "on leave"},
+		}, nil)
+		var got, err = svc.FindStatusHistory(1)
+
+		a.Nil(err)
+		a.Len(got, 2)
+		a.Equal(StatusSuspended, got[1].ToStatus)
+	})
+}
+
+func TestServiceFindPage(t *testing.T) {
+	var a = assert.New(t)
+	var anyFilter = mock.AnythingOfType("employee.Filter")
+
+	t.Run("should return first page with next cursor", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, validator.New(), new(auditRecorder), 0)
+		var created = time.Date(2024, 3, 1, 10, 0, 0, 123000, time.UTC)
+		var pageFilter = mock.MatchedBy(func(filter Filter) bool {
+			return filter.Limit == 3 && filter.NamePrefix == "Ив" && filter.RoleId == 3 &&
+				filter.Sort == common.Sort{Field: "created_at", Desc: true} && filter.After == nil &&
+				filter.CreatedFrom.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		})
+
+		repo.On("Count", anyFilter).Return(int64(5), nil)
+		repo.On("FindPage", pageFilter).Return([]Entity{{Id: 4}, {Id: 2, CreatedAt: created}, {Id: 1}}, nil)
+		var got, page, err = svc.FindPage(FindRequest{
+			PageRequest: common.PageRequest{Limit: 2, Sort: "-created_at"},
+			Name:        "Ив",
+			RoleId:      3,
+			CreatedFrom: "2024-01-01T00:00:00Z",
+		})
+
+		a.Nil(err)
+		a.Len(got, 2)
+		a.Equal(int64(5), page.Total)
+		after, err := common.DecodeCursor(page.NextCursor, common.Sort{Field: "created_at", Desc: true})
+		a.Nil(err)
+		a.Equal(int64(2), after.Id)
+		a.Equal(created.Format(time.RFC3339Nano), after.Value)
+	})
+
+	t.Run("should continue after cursor without next cursor on last page", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, validator.New(), new(auditRecorder), 0)
+		var cursor = common.Cursor{Sort: "name", Value: "Петров Алексей", Id: 3}
+		var pageFilter = mock.MatchedBy(func(filter Filter) bool {
+			return filter.Limit == common.DefaultPageLimit+1 && *filter.After == cursor
+		})
+
+		repo.On("Count", anyFilter).Return(int64(4), nil)
+		repo.On("FindPage", pageFilter).Return([]Entity{{Id: 2, Name: "Сидорова Анна"}}, nil)
+		var got, page, err = svc.FindPage(FindRequest{PageRequest: common.PageRequest{Sort: "name", Cursor: cursor.Encode()}})
+
+		a.Nil(err)
+		a.Len(got, 1)
+		a.Empty(page.NextCursor)
+	})
+
+	t.Run("should reject unknown sort field", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, validator.New(), new(auditRecorder), 0)
+
+		var _, _, err = svc.FindPage(FindRequest{PageRequest: common.PageRequest{Sort: "-salary"}})
+
+		a.ErrorAs(err, &common.RequestValidationError{})
+		a.True(repo.AssertNotCalled(t, "FindPage", anyFilter))
+	})
+
+	t.Run("should reject cursor issued for another sort", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, validator.New(), new(auditRecorder), 0)
+		var cursor = common.Cursor{Sort: "name", Value: "Петров Алексей", Id: 3}.Encode()
+
+		var _, _, err = svc.FindPage(FindRequest{PageRequest: common.PageRequest{Sort: "-name", Cursor: cursor}})
+
+		var validationErr common.RequestValidationError
+		a.ErrorAs(err, &validationErr)
+		a.Contains(validationErr.FieldErrors, "cursor")
+	})
+
+	t.Run("should reject malformed cursor and limit", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, validator.New(), new(auditRecorder), 0)
+
+		var _, _, err = svc.FindPage(FindRequest{PageRequest: common.PageRequest{Cursor: "not a cursor"}})
+		a.ErrorAs(err, &common.RequestValidationError{})
+		_, _, err = svc.FindPage(FindRequest{PageRequest: common.PageRequest{Limit: 5000}})
+		a.ErrorAs(err, &common.RequestValidationError{})
+	})
+}
+
+func TestRepositoryFindPage(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("failed to create mock database")
+	}
+	defer func() { _ = db.Close() }()
+	repo := &Repository{db: sqlx.NewDb(db, "postgres")}
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	sqlMock.ExpectQuery("SELECT e.*, r.name AS role_name FROM employee e LEFT JOIN role r ON r.id = e.role_id"+
+		" WHERE e.deleted_at IS NULL AND e.name ILIKE $1 AND e.created_at >= $2 AND (e.name, e.id) < ($3::text, $4)"+
+		" ORDER BY e.name desc, e.id desc LIMIT $5").
+		WithArgs(`100\%%`, from, "Петров", 3, 11).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "100% Сидорова"))
+	sqlMock.ExpectQuery("SELECT count(*) FROM employee e WHERE EXISTS (SELECT 1 FROM employee_role er WHERE er.employee_id = e.id AND er.role_id = $1)").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+
+	listEntity, err := repo.FindPage(Filter{
+		NamePrefix:  "100%",
+		CreatedFrom: &from,
+		Sort:        common.Sort{Field: "name", Desc: true},
+		After:       &common.Cursor{Sort: "-name", Value: "Петров", Id: 3},
+		Limit:       11,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, listEntity, 1)
+
+	count, err := repo.Count(Filter{RoleId: 3, IncludeDeleted: true})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	assert.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestServiceSearch(t *testing.T) {
+	var a = assert.New(t)
+
+	t.Run("should return ranked employees with role", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, validator.New(), new(auditRecorder), 0)
+		var roleName = "Разработчик"
+
+		repo.On("Search", "петров", DefaultSearchLimit).Return([]SearchEntity{
+			{Entity: Entity{Id: 3, Name: "Петров Алексей", RoleName: &roleName}, Rank: 1},
+			{Entity: Entity{Id: 1, Name: "Иванов Петр"}, Rank: 0.6},
+		}, nil)
+		var got, err = svc.Search(SearchRequest{Q: " петров "})
+
+		a.Nil(err)
+		a.Len(got, 2)
+		a.Equal("Петров Алексей", got[0].Name)
+		a.Equal(&roleName, got[0].RoleName)
+		a.Equal(0.6, got[1].Rank)
+	})
+
+	t.Run("should require query", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, validator.New(), new(auditRecorder), 0)
+
+		var _, err = svc.Search(SearchRequest{Q: "п", Limit: 5})
+
+		a.ErrorAs(err, &common.RequestValidationError{})
+		a.True(repo.AssertNotCalled(t, "Search", mock.Anything, mock.Anything))
+	})
+
+	t.Run("should wrap repository error", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, validator.New(), new(auditRecorder), 0)
+
+		repo.On("Search", "анна", 5).Return([]SearchEntity{}, errors.New("database error"))
+		var got, err = svc.Search(SearchRequest{Q: "анна", Limit: 5})
+
+		a.Empty(got)
+		a.ErrorContains(err, "error searching employees")
+	})
+}
+
+func TestServiceExport(t *testing.T) {
+	var a = assert.New(t)
+	var roleId = int64(2)
+	var roleName = "Менеджер"
+	var created = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("should stream filtered employees in requested format", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, validator.New(), new(auditRecorder), 0)
+		repo.On("Export", Filter{RoleId: 2, Sort: common.Sort{Field: "name"}}).Return([]ExportEntity{
+			{Entity: Entity{Id: 2, Name: "Сидорова Анна", RoleID: &roleId, RoleName: &roleName, Status: StatusActive,
+				CreatedAt: created, UpdatedAt: created}, Roles: []string{"Администратор", "Менеджер"}},
+		}, nil)
+
+		var export, err = svc.Export(ExportRequest{FindRequest: FindRequest{RoleId: 2,
+			PageRequest: common.PageRequest{Sort: "name", Limit: 5}}, Format: ExportCsv})
+		a.Nil(err)
+		var out strings.Builder
+		a.Nil(export(&out))
+
+		a.Equal("id,name,status,role_id,role_name,roles,created_at,updated_at,deleted_at\n"+
+			"2,Сидорова Анна,active,2,Менеджер,\"Администратор, Менеджер\",2024-01-02T03:04:05Z,2024-01-02T03:04:05Z,\n", out.String())
+	})
+
+	t.Run("should reject unknown format before streaming", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, validator.New(), new(auditRecorder), 0)
+
+		var export, err = svc.Export(ExportRequest{Format: "pdf"})
+
+		a.Nil(export)
+		a.ErrorAs(err, &common.RequestValidationError{})
+	})
+
+	t.Run("should return repository error from stream", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, nil, validator.New(), new(auditRecorder), 0)
+		repo.On("Export", mock.Anything).Return([]ExportEntity{}, errors.New("connection lost"))
+
+		var export, err = svc.Export(ExportRequest{Format: ExportJson})
+		a.Nil(err)
+
+		a.ErrorContains(export(io.Discard), "error exporting employees")
+	})
+}
+
+func TestRepositoryExport(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("failed to create mock database")
+	}
+	defer func() { _ = db.Close() }()
+	repo := &Repository{db: sqlx.NewDb(db, "postgres")}
+
+	sqlMock.ExpectQuery(selectExport + " WHERE e.deleted_at IS NULL AND EXISTS (SELECT 1 FROM employee_role er WHERE er.employee_id = e.id AND er.role_id = $1) ORDER BY e.created_at desc, e.id desc").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "roles"}).
+			AddRow(4, "Козлова Елена", "{Разработчик}").
+			AddRow(3, "Петров Алексей", "{}"))
+
+	var names []string
+	err = repo.Export(Filter{RoleId: 3, Sort: common.Sort{Field: "created_at", Desc: true}}, func(entity ExportEntity) error {
+		names = append(names, entity.Name)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Козлова Елена", "Петров Алексей"}, names)
+	assert.NoError(t, sqlMock.ExpectationsWereMet())
 }
@@ -0,0 +1,73 @@
+package importer
+
+import (
+	"bytes"
+	"errors"
+	"github.com/gofiber/fiber"
+	"idm/inner/audit"
+	"idm/inner/common"
+	"idm/inner/web"
+	"io"
+)
+
+type Controller struct {
+	server        *web.Server
+	importService Svc
+}
+
+// интерфейс сервиса importer.Service
+type Svc interface {
+	Import(actor audit.Actor, request Request, input io.Reader) (Report, error)
+}
+
+func NewController(server *web.Server, importService Svc) *Controller {
+	return &Controller{
+		server:        server,
+		importService: importService,
+	}
+}
+
+// функция для регистрации маршрутов
+func (c *Controller) RegisterRoutes() {
+	// импорт создаёт и сотрудников, и роли, поэтому требует права на запись обоих
+	c.server.GroupApiV1.Post("/import", c.server.Require("employees:write"), c.server.Require("roles:write"), c.Import)
+}
+
+// функция-хендлер для POST запроса по маршруту "/api/v1/import?format=csv|jsonl&mode=atomic|partial&dry_run=true";
+// тело запроса — CSV с заголовком kind,name,role,status или JSON lines с теми же полями
+func (c *Controller) Import(ctx *fiber.Ctx) {
+	var request Request
+	if err := ctx.QueryParser(&request); err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+	if request.Format == "" {
+		request.Format = FormatOf(ctx.Get(fiber.HeaderContentType))
+	}
+
+	report, err := c.importService.Import(audit.ActorFrom(c.server, ctx), request, bytes.NewReader(ctx.Fasthttp.Request.Body()))
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	// отчёт возвращается и при ошибочных строках: 422, если из-за них ничего не сохранено
+	if report.Failed > 0 && !report.Committed && !report.DryRun {
+		ctx.Status(fiber.StatusUnprocessableEntity)
+	}
+	err = common.OkResponse(ctx, report)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning import report")
+		return
+	}
+}
+
+// errResponse сопоставляет ошибку сервиса с кодом ответа: 400 — ошибки формата и валидации, 500 — всё остальное
+func errResponse(ctx *fiber.Ctx, err error) {
+	switch {
+	case errors.As(err, &common.RequestValidationError{}):
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+	default:
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+	}
+}
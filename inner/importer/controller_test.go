@@ -0,0 +1,77 @@
+package importer
+
+import (
+	"encoding/json"
+	"github.com/gofiber/fiber"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/audit"
+	"idm/inner/common"
+	"idm/inner/web"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type MockService struct {
+	mock.Mock
+}
+
+func (m *MockService) Import(actor audit.Actor, request Request, input io.Reader) (Report, error) {
+	body, _ := io.ReadAll(input)
+	args := m.Called(request, string(body))
+	return args.Get(0).(Report), args.Error(1)
+}
+
+func TestController(t *testing.T) {
+	var a = assert.New(t)
+	var body = "kind,name\nrole,Admins\n"
+
+	t.Run("should import with format from content type", func(t *testing.T) {
+		var svc = new(MockService)
+		var server = web.NewServer()
+		NewController(server, svc).RegisterRoutes()
+		svc.On("Import", Request{Format: FormatCsv, Mode: ModePartial, DryRun: true}, body).
+			Return(Report{Mode: ModePartial, DryRun: true, Created: 1}, nil)
+
+		var req = httptest.NewRequest(fiber.MethodPost, "/api/v1/import?mode=partial&dry_run=true", strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, "text/csv")
+		var resp, err = server.App.Test(req)
+		a.Nil(err)
+
+		var response common.Response[Report]
+		a.Nil(json.NewDecoder(resp.Body).Decode(&response))
+		a.Equal(fiber.StatusOK, resp.StatusCode)
+		a.Equal(1, response.Data.Created)
+	})
+
+	t.Run("should return 422 when atomic import rolled back", func(t *testing.T) {
+		var svc = new(MockService)
+		var server = web.NewServer()
+		NewController(server, svc).RegisterRoutes()
+		svc.On("Import", Request{Format: FormatJsonl}, body).
+			Return(Report{Mode: ModeAtomic, Failed: 1, Rows: []RowResult{{Line: 2, Result: RowFailed}}}, nil)
+
+		var req = httptest.NewRequest(fiber.MethodPost, "/api/v1/import?format=jsonl", strings.NewReader(body))
+		var resp, err = server.App.Test(req)
+		a.Nil(err)
+
+		var response common.Response[Report]
+		a.Nil(json.NewDecoder(resp.Body).Decode(&response))
+		a.Equal(fiber.StatusUnprocessableEntity, resp.StatusCode)
+		a.Len(response.Data.Rows, 1)
+	})
+
+	t.Run("should return 400 on invalid input", func(t *testing.T) {
+		var svc = new(MockService)
+		var server = web.NewServer()
+		NewController(server, svc).RegisterRoutes()
+		svc.On("Import", Request{}, body).
+			Return(Report{}, common.RequestValidationError{FieldErrors: map[string]string{"format": "must be csv or jsonl"}})
+
+		var resp, err = server.App.Test(httptest.NewRequest(fiber.MethodPost, "/api/v1/import", strings.NewReader(body)))
+		a.Nil(err)
+		a.Equal(fiber.StatusBadRequest, resp.StatusCode)
+	})
+}
@@ -0,0 +1,69 @@
+package importer
+
+// форматы входных данных
+const (
+	FormatCsv   = "csv"
+	FormatJsonl = "jsonl"
+)
+
+// виды импортируемых записей
+const (
+	KindEmployee = "employee"
+	KindRole     = "role"
+)
+
+// режимы импорта: atomic — любая ошибка откатывает весь импорт,
+// partial — ошибочные строки пропускаются, остальные сохраняются
+const (
+	ModeAtomic  = "atomic"
+	ModePartial = "partial"
+)
+
+// итог обработки строки
+const (
+	RowCreated = "created"
+	RowSkipped = "skipped"
+	RowFailed  = "failed"
+)
+
+// MaxRows ограничение количества строк в одном импорте
+const MaxRows = 10000
+
+// Request параметры импорта из query-параметров; формат без format определяется по Content-Type
+type Request struct {
+	Format string `query:"format" validate:"omitempty,oneof=csv jsonl"`
+	Mode   string `query:"mode" validate:"omitempty,oneof=atomic partial"`
+	DryRun bool   `query:"dry_run"`
+}
+
+// Row строка импорта. Роль сотрудника задаётся названием; роль, созданная выше в том же импорте,
+// уже доступна. Status сотрудника — pending или active, по умолчанию active
+type Row struct {
+	Line   int    `json:"-"`
+	Kind   string `json:"kind" validate:"required,oneof=employee role"`
+	Name   string `json:"name" validate:"required,min=2,max=155"`
+	Role   string `json:"role" validate:"required_if=Kind employee,excluded_if=Kind role,max=155"`
+	Status string `json:"status" validate:"excluded_if=Kind role,omitempty,oneof=pending active"`
+}
+
+// RowResult итог обработки строки: Id созданной записи или причина пропуска либо ошибки
+type RowResult struct {
+	Line   int    `json:"line"`
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Result string `json:"result"`
+	Id     int64  `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report отчёт об импорте. Committed — изменения сохранены: при dry_run и при ошибке
+// в режиме atomic они откатываются, хотя строки и отмечены как created
+type Report struct {
+	Mode      string      `json:"mode"`
+	DryRun    bool        `json:"dry_run"`
+	Committed bool        `json:"committed"`
+	Created   int         `json:"created"`
+	Skipped   int         `json:"skipped"`
+	Failed    int         `json:"failed"`
+	Rows      []RowResult `json:"rows"`
+}
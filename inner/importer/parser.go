@@ -0,0 +1,142 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"idm/inner/common"
+	"io"
+	"strings"
+)
+
+// columns колонки CSV; обязательны kind и name, порядок любой
+var columns = []string{"kind", "name", "role", "status"}
+
+// Parse разбирает входные данные в строки импорта. Ошибка формата отклоняет весь импорт,
+// содержимое строк проверяется позже и попадает в отчёт
+func Parse(format string, input io.Reader) ([]Row, error) {
+	switch format {
+	case FormatCsv:
+		return parseCsv(input)
+	case FormatJsonl:
+		return parseJsonl(input)
+	default:
+		return nil, invalidInput("format", fmt.Sprintf("must be %s or %s", FormatCsv, FormatJsonl))
+	}
+}
+
+// FormatOf формат по Content-Type или расширению файла; пусто — формат не распознан
+func FormatOf(contentType string) string {
+	switch {
+	case strings.Contains(contentType, "csv"):
+		return FormatCsv
+	case strings.Contains(contentType, "jsonl"), strings.Contains(contentType, "ndjson"):
+		return FormatJsonl
+	}
+	return ""
+}
+
+func parseCsv(input io.Reader) ([]Row, error) {
+	reader := csv.NewReader(input)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return []Row{}, nil
+	}
+	if err != nil {
+		return nil, invalidInput("header", err.Error())
+	}
+	index := make(map[string]int)
+	for i, column := range header {
+		// первая колонка может начинаться с BOM, если файл сохранён в Excel
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		if !contains(columns, column) {
+			return nil, invalidInput("header", fmt.Sprintf("unknown column %q, expected %s", column, strings.Join(columns, ", ")))
+		}
+		index[column] = i
+	}
+	for _, required := range []string{"kind", "name"} {
+		if _, ok := index[required]; !ok {
+			return nil, invalidInput("header", fmt.Sprintf("column %q is required", required))
+		}
+	}
+	value := func(record []string, column string) string {
+		if i, ok := index[column]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	rows := []Row{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, invalidInput("csv", err.Error())
+		}
+		if len(rows) == MaxRows {
+			return nil, tooManyRows()
+		}
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, Row{
+			Line:   line,
+			Kind:   value(record, "kind"),
+			Name:   value(record, "name"),
+			Role:   value(record, "role"),
+			Status: value(record, "status"),
+		})
+	}
+}
+
+func parseJsonl(input io.Reader) ([]Row, error) {
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	rows := []Row{}
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		if len(rows) == MaxRows {
+			return nil, tooManyRows()
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		var row Row
+		if err := decoder.Decode(&row); err != nil {
+			return nil, invalidInput("jsonl", fmt.Sprintf("line %d: %s", line, err.Error()))
+		}
+		row.Line = line
+		row.Kind = strings.TrimSpace(row.Kind)
+		row.Name = strings.TrimSpace(row.Name)
+		row.Role = strings.TrimSpace(row.Role)
+		row.Status = strings.TrimSpace(row.Status)
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, invalidInput("jsonl", err.Error())
+	}
+	return rows, nil
+}
+
+func invalidInput(field string, message string) error {
+	return common.RequestValidationError{FieldErrors: map[string]string{field: message}}
+}
+
+func tooManyRows() error {
+	return invalidInput("rows", fmt.Sprintf("import is limited to %d rows", MaxRows))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
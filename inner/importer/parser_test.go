@@ -0,0 +1,83 @@
+package importer
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"idm/inner/common"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	var a = assert.New(t)
+
+	t.Run("should parse csv with any column order and BOM", func(t *testing.T) {
+		var input = "\ufeffName,Kind,Role\n" +
+			"Admins, role,\n" +
+			"John Doe,employee, Admins\n"
+		var got, err = Parse(FormatCsv, strings.NewReader(input))
+
+		a.Nil(err)
+		a.Equal([]Row{
+			{Line: 2, Kind: KindRole, Name: "Admins"},
+			{Line: 3, Kind: KindEmployee, Name: "John Doe", Role: "Admins"},
+		}, got)
+	})
+
+	t.Run("should reject csv without required column", func(t *testing.T) {
+		var _, err = Parse(FormatCsv, strings.NewReader("name,role\nJohn Doe,Admins\n"))
+
+		var validationErr common.RequestValidationError
+		a.True(errors.As(err, &validationErr))
+		a.Contains(validationErr.FieldErrors["header"], "kind")
+	})
+
+	t.Run("should reject csv with unknown column", func(t *testing.T) {
+		var _, err = Parse(FormatCsv, strings.NewReader("kind,name,salary\n"))
+
+		a.ErrorContains(err, "salary")
+	})
+
+	t.Run("should reject csv with wrong number of fields", func(t *testing.T) {
+		var _, err = Parse(FormatCsv, strings.NewReader("kind,name\nrole,Admins,extra\n"))
+
+		a.True(errors.As(err, &common.RequestValidationError{}))
+	})
+
+	t.Run("should parse jsonl skipping blank lines", func(t *testing.T) {
+		var input = `{"kind":"role","name":"Admins"}` + "\n\n" +
+			`{"kind":"employee","name":"John Doe","role":"Admins","status":"pending"}` + "\n"
+		var got, err = Parse(FormatJsonl, strings.NewReader(input))
+
+		a.Nil(err)
+		a.Equal([]Row{
+			{Line: 1, Kind: KindRole, Name: "Admins"},
+			{Line: 3, Kind: KindEmployee, Name: "John Doe", Role: "Admins", Status: "pending"},
+		}, got)
+	})
+
+	t.Run("should reject jsonl with unknown field", func(t *testing.T) {
+		var _, err = Parse(FormatJsonl, strings.NewReader(`{"kind":"role","name":"Admins","id":1}`))
+
+		a.ErrorContains(err, "line 1")
+	})
+
+	t.Run("should reject unknown format", func(t *testing.T) {
+		var _, err = Parse("xml", strings.NewReader(""))
+
+		a.True(errors.As(err, &common.RequestValidationError{}))
+	})
+
+	t.Run("should limit number of rows", func(t *testing.T) {
+		var input = strings.Repeat(`{"kind":"role","name":"Admins"}`+"\n", MaxRows+1)
+		var _, err = Parse(FormatJsonl, strings.NewReader(input))
+
+		a.ErrorContains(err, "limited")
+	})
+
+	t.Run("should detect format by content type", func(t *testing.T) {
+		a.Equal(FormatCsv, FormatOf("text/csv; charset=utf-8"))
+		a.Equal(FormatJsonl, FormatOf("application/x-ndjson"))
+		a.Equal("", FormatOf("application/json"))
+	})
+}
@@ -0,0 +1,39 @@
+package importer
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+type Repository struct {
+	db *sqlx.DB
+}
+
+func NewImportRepository(dataBase *sqlx.DB) *Repository {
+	return &Repository{db: dataBase}
+}
+
+func (repo *Repository) BeginTransaction() (tx *sqlx.Tx, err error) {
+	return repo.db.Beginx()
+}
+
+// FindRoleIdByNameTx идентификатор действующей роли по названию, в том числе созданной ранее в этой же транзакции
+func (repo *Repository) FindRoleIdByNameTx(tx *sqlx.Tx, name string) (id int64, err error) {
+	err = tx.Get(&id, "select id from role where name = $1 and deleted_at is null", name)
+	return id, err
+}
+
+// SavepointTx точка сохранения перед строкой импорта: ошибка строки откатывается только до неё
+func (repo *Repository) SavepointTx(tx *sqlx.Tx) error {
+	_, err := tx.Exec("savepoint import_row")
+	return err
+}
+
+func (repo *Repository) RollbackToSavepointTx(tx *sqlx.Tx) error {
+	_, err := tx.Exec("rollback to savepoint import_row")
+	return err
+}
+
+func (repo *Repository) ReleaseSavepointTx(tx *sqlx.Tx) error {
+	_, err := tx.Exec("release savepoint import_row")
+	return err
+}
@@ -0,0 +1,152 @@
+package importer
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"idm/inner/audit"
+	"idm/inner/common"
+	"idm/inner/employee"
+	"io"
+)
+
+type Service struct {
+	repo      Repo
+	employees EmployeeCreator
+	roles     RoleCreator
+	validator Validator
+}
+
+func NewService(repo Repo, employees EmployeeCreator, roles RoleCreator, validator Validator) *Service {
+	return &Service{
+		repo:      repo,
+		employees: employees,
+		roles:     roles,
+		validator: validator,
+	}
+}
+
+type Validator interface {
+	Validate(request any) error
+}
+
+type Repo interface {
+	BeginTransaction() (tx *sqlx.Tx, err error)
+	FindRoleIdByNameTx(tx *sqlx.Tx, name string) (id int64, err error)
+	SavepointTx(tx *sqlx.Tx) error
+	RollbackToSavepointTx(tx *sqlx.Tx) error
+	ReleaseSavepointTx(tx *sqlx.Tx) error
+}
+
+// EmployeeCreator создание сотрудника в общей транзакции импорта, реализуется employee.Service
+type EmployeeCreator interface {
+	CreateTx(tx *sqlx.Tx, actor audit.Actor, entity employee.Entity) (int64, error)
+}
+
+// RoleCreator создание роли в общей транзакции импорта, реализуется role.Service
+type RoleCreator interface {
+	CreateTx(tx *sqlx.Tx, actor audit.Actor, name string, parentIds []int64) (int64, error)
+}
+
+// Import разбирает входные данные и создаёт сотрудников и роли построчно в одной транзакции.
+// Строка с уже существующим именем пропускается, ошибка строки попадает в отчёт. Транзакция
+// фиксируется, если это не dry_run и в режиме atomic нет ни одной ошибки
+func (service *Service) Import(actor audit.Actor, request Request, input io.Reader) (report Report, err error) {
+	if err = service.validator.Validate(request); err != nil {
+		return Report{}, err
+	}
+	rows, err := Parse(request.Format, input)
+	if err != nil {
+		return Report{}, err
+	}
+	report = Report{Mode: request.Mode, DryRun: request.DryRun, Rows: make([]RowResult, 0, len(rows))}
+	if report.Mode == "" {
+		report.Mode = ModeAtomic
+	}
+
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil || !report.Committed {
+				_ = tx.Rollback()
+			} else if err = tx.Commit(); err != nil {
+				report = Report{}
+				err = fmt.Errorf("error import: error committing transaction: %w", err)
+			}
+		}
+	}()
+	if err != nil {
+		return Report{}, fmt.Errorf("error import: error creating transaction: %w", err)
+	}
+
+	for _, row := range rows {
+		var result RowResult
+		result, err = service.importRowTx(tx, actor, row)
+		if err != nil {
+			return Report{}, err
+		}
+		report.Rows = append(report.Rows, result)
+		switch result.Result {
+		case RowCreated:
+			report.Created++
+		case RowSkipped:
+			report.Skipped++
+		case RowFailed:
+			report.Failed++
+		}
+	}
+	report.Committed = !request.DryRun && (report.Failed == 0 || report.Mode == ModePartial)
+	return report, nil
+}
+
+// importRowTx создаёт запись строки после точки сохранения; при ошибке строки транзакция
+// откатывается до неё, чтобы продолжить со следующей строки. Ошибка возвращается, только если
+// продолжать импорт нельзя
+func (service *Service) importRowTx(tx *sqlx.Tx, actor audit.Actor, row Row) (RowResult, error) {
+	result := RowResult{Line: row.Line, Kind: row.Kind, Name: row.Name}
+	if err := service.validator.Validate(row); err != nil {
+		return failed(result, err), nil
+	}
+	if err := service.repo.SavepointTx(tx); err != nil {
+		return RowResult{}, fmt.Errorf("error import line %d: %w", row.Line, err)
+	}
+	id, err := service.createTx(tx, actor, row)
+	if err != nil {
+		if rollbackErr := service.repo.RollbackToSavepointTx(tx); rollbackErr != nil {
+			return RowResult{}, fmt.Errorf("error import line %d: %w", row.Line, rollbackErr)
+		}
+		if errors.As(err, &common.AlreadyExistsError{}) {
+			result.Result = RowSkipped
+			result.Error = err.Error()
+			return result, nil
+		}
+		return failed(result, err), nil
+	}
+	if err = service.repo.ReleaseSavepointTx(tx); err != nil {
+		return RowResult{}, fmt.Errorf("error import line %d: %w", row.Line, err)
+	}
+	result.Result = RowCreated
+	result.Id = id
+	return result, nil
+}
+
+func (service *Service) createTx(tx *sqlx.Tx, actor audit.Actor, row Row) (int64, error) {
+	if row.Kind == KindRole {
+		return service.roles.CreateTx(tx, actor, row.Name, nil)
+	}
+	roleId, err := service.repo.FindRoleIdByNameTx(tx, row.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, common.NotFoundError{Resource: "role", ID: row.Role}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error finding role by name: %s, %w", row.Role, err)
+	}
+	return service.employees.CreateTx(tx, actor, employee.Entity{Name: row.Name, RoleID: &roleId, Status: row.Status})
+}
+
+func failed(result RowResult, err error) RowResult {
+	result.Result = RowFailed
+	result.Error = err.Error()
+	return result
+}
@@ -0,0 +1,149 @@
+package importer
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/audit"
+	"idm/inner/common"
+	"idm/inner/employee"
+	"idm/inner/validator"
+	"strings"
+	"testing"
+)
+
+type MockRepo struct {
+	mock.Mock
+}
+
+func (m *MockRepo) BeginTransaction() (*sqlx.Tx, error) {
+	args := m.Called()
+	return args.Get(0).(*sqlx.Tx), args.Error(1)
+}
+
+func (m *MockRepo) FindRoleIdByNameTx(tx *sqlx.Tx, name string) (int64, error) {
+	args := m.Called(tx, name)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepo) SavepointTx(tx *sqlx.Tx) error {
+	return m.Called(tx).Error(0)
+}
+
+func (m *MockRepo) RollbackToSavepointTx(tx *sqlx.Tx) error {
+	return m.Called(tx).Error(0)
+}
+
+func (m *MockRepo) ReleaseSavepointTx(tx *sqlx.Tx) error {
+	return m.Called(tx).Error(0)
+}
+
+type MockEmployees struct {
+	mock.Mock
+}
+
+func (m *MockEmployees) CreateTx(tx *sqlx.Tx, actor audit.Actor, entity employee.Entity) (int64, error) {
+	args := m.Called(tx, actor, entity)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type MockRoles struct {
+	mock.Mock
+}
+
+func (m *MockRoles) CreateTx(tx *sqlx.Tx, actor audit.Actor, name string, parentIds []int64) (int64, error) {
+	args := m.Called(tx, actor, name, parentIds)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+var actor = audit.Actor{Subject: "42"}
+
+func TestServiceImport(t *testing.T) {
+	var a = assert.New(t)
+	var noTx *sqlx.Tx
+	var roleId = int64(3)
+	var input = "kind,name,role\n" +
+		"role,Admins,\n" +
+		"employee,John Doe,Admins\n" +
+		"employee,Jane Doe,Nobody\n" +
+		"employee,Jack Doe,Admins\n" +
+		"employee,X,Admins\n"
+
+	var setup = func() (*MockRepo, *MockEmployees, *MockRoles, *Service) {
+		var repo = new(MockRepo)
+		var employees = new(MockEmployees)
+		var roles = new(MockRoles)
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("SavepointTx", noTx).Return(nil)
+		repo.On("ReleaseSavepointTx", noTx).Return(nil)
+		repo.On("RollbackToSavepointTx", noTx).Return(nil)
+		repo.On("FindRoleIdByNameTx", noTx, "Admins").Return(roleId, nil)
+		repo.On("FindRoleIdByNameTx", noTx, "Nobody").Return(int64(0), sql.ErrNoRows)
+		roles.On("CreateTx", noTx, actor, "Admins", []int64(nil)).Return(int64(3), nil)
+		employees.On("CreateTx", noTx, actor, employee.Entity{Name: "John Doe", RoleID: &roleId}).Return(int64(10), nil)
+		employees.On("CreateTx", noTx, actor, employee.Entity{Name: "Jack Doe", RoleID: &roleId}).
+			Return(int64(0), common.AlreadyExistsError{Resource: "employee", ID: "Jack Doe"})
+		return repo, employees, roles, NewService(repo, employees, roles, validator.New())
+	}
+
+	t.Run("should report every row and roll back atomic import with failures", func(t *testing.T) {
+		var repo, employees, _, svc = setup()
+		var got, err = svc.Import(actor, Request{Format: FormatCsv}, strings.NewReader(input))
+
+		a.Nil(err)
+		a.Equal(ModeAtomic, got.Mode)
+		a.False(got.Committed)
+		a.Equal(2, got.Created)
+		a.Equal(1, got.Skipped)
+		a.Equal(2, got.Failed)
+		a.Equal(RowResult{Line: 3, Kind: KindEmployee, Name: "John Doe", Result: RowCreated, Id: 10}, got.Rows[1])
+		a.Equal(RowFailed, got.Rows[2].Result)
+		a.Contains(got.Rows[2].Error, "Nobody")
+		a.Equal(RowSkipped, got.Rows[3].Result)
+		// ошибка валидации выявляется до точки сохранения и до обращения к сервисам
+		a.Equal(RowFailed, got.Rows[4].Result)
+		a.True(employees.AssertNotCalled(t, "CreateTx", noTx, actor, employee.Entity{Name: "X", RoleID: &roleId}))
+		repo.AssertNumberOfCalls(t, "SavepointTx", 4)
+		repo.AssertNumberOfCalls(t, "RollbackToSavepointTx", 2)
+	})
+
+	t.Run("should commit partial import with failures", func(t *testing.T) {
+		var _, _, _, svc = setup()
+		var got, err = svc.Import(actor, Request{Format: FormatCsv, Mode: ModePartial}, strings.NewReader(input))
+
+		a.Nil(err)
+		a.True(got.Committed)
+		a.Equal(2, got.Failed)
+	})
+
+	t.Run("should not commit dry run", func(t *testing.T) {
+		var _, _, _, svc = setup()
+		var got, err = svc.Import(actor, Request{Format: FormatCsv, Mode: ModePartial, DryRun: true}, strings.NewReader(input))
+
+		a.Nil(err)
+		a.True(got.DryRun)
+		a.False(got.Committed)
+		a.Equal(2, got.Created)
+	})
+
+	t.Run("should reject invalid request before starting transaction", func(t *testing.T) {
+		var repo, _, _, svc = setup()
+		var _, err = svc.Import(actor, Request{Format: FormatCsv, Mode: "best-effort"}, strings.NewReader(input))
+
+		a.True(errors.As(err, &common.RequestValidationError{}))
+		repo.AssertNotCalled(t, "BeginTransaction")
+	})
+
+	t.Run("should abort on savepoint error", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, new(MockEmployees), new(MockRoles), validator.New())
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("SavepointTx", noTx).Return(errors.New("connection lost"))
+		var got, err = svc.Import(actor, Request{Format: FormatJsonl}, strings.NewReader(`{"kind":"role","name":"Admins"}`))
+
+		a.ErrorContains(err, "line 1")
+		a.Equal(Report{}, got)
+	})
+}
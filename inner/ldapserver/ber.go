@@ -0,0 +1,66 @@
+package ldapserver
+
+import (
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"strings"
+)
+
+// message конверт LDAPMessage с идентификатором запроса, на который это ответ
+func message(id int64, op *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	packet.AppendChild(op)
+	return packet
+}
+
+// result LDAPResult ответа на операцию с тегом tag
+func result(tag ber.Tag, code uint16, matchedDn string, diagnostic string) *ber.Packet {
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, ldap.ApplicationMap[uint8(tag)])
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	packet.AppendChild(octetString(matchedDn))
+	packet.AppendChild(octetString(diagnostic))
+	return packet
+}
+
+// searchEntry SearchResultEntry с выбранными атрибутами; typesOnly — только имена атрибутов
+func searchEntry(dn string, attributes []Attribute, typesOnly bool) *ber.Packet {
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	packet.AppendChild(octetString(dn))
+	list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for _, attribute := range attributes {
+		item := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		item.AppendChild(octetString(attribute.Name))
+		values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "values")
+		if !typesOnly {
+			for _, value := range attribute.Values {
+				values.AppendChild(octetString(value))
+			}
+		}
+		item.AppendChild(values)
+		list.AppendChild(item)
+	}
+	packet.AppendChild(list)
+	return packet
+}
+
+func octetString(value string) *ber.Packet {
+	return ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "")
+}
+
+// selectAttributes атрибуты, запрошенные в поиске: пустой список и "*" — все, "1.1" — никаких
+func selectAttributes(attributes []Attribute, requested []string) []Attribute {
+	if len(requested) == 0 {
+		return attributes
+	}
+	selected := []Attribute{}
+	for _, attribute := range attributes {
+		for _, name := range requested {
+			if name == "*" || strings.EqualFold(name, attribute.Name) {
+				selected = append(selected, attribute)
+				break
+			}
+		}
+	}
+	return selected
+}
@@ -0,0 +1,137 @@
+package ldapserver
+
+import (
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"idm/inner/employee"
+	"idm/inner/role"
+	"strconv"
+	"strings"
+)
+
+// Employees сотрудники, реализуется employee.Repository
+type Employees interface {
+	FindAll() ([]employee.Entity, error)
+	FindById(id int64) (employee.Entity, error)
+}
+
+// Roles роли и их участники, реализуется role.Repository
+type Roles interface {
+	FindAll() ([]role.Entity, error)
+	FindActiveMemberships() ([]role.MembershipEntity, error)
+}
+
+// Directory дерево каталога из сотрудников и ролей: сотрудники — inetOrgPerson в ou=people,
+// роли — groupOfNames в ou=groups; удалённые не публикуются. Участники групп — только активные
+// сотрудники, у остальных роли не действуют
+type Directory struct {
+	baseDn    string
+	employees Employees
+	roles     Roles
+}
+
+func NewDirectory(baseDn string, employees Employees, roles Roles) *Directory {
+	return &Directory{baseDn: baseDn, employees: employees, roles: roles}
+}
+
+// PersonDn DN сотрудника; uid — идентификатор сотрудника, он не меняется при переименовании
+func (directory *Directory) PersonDn(id int64) string {
+	return fmt.Sprintf("uid=%d,ou=%s,%s", id, PeopleOu, directory.baseDn)
+}
+
+func (directory *Directory) groupDn(name string) string {
+	return fmt.Sprintf("cn=%s,ou=%s,%s", ldap.EscapeDN(name), GroupsOu, directory.baseDn)
+}
+
+// Entries все записи каталога: база, ветки, сотрудники и роли
+func (directory *Directory) Entries() ([]Entry, error) {
+	employees, err := directory.employees.FindAll()
+	if err != nil {
+		return nil, fmt.Errorf("error finding employees: %w", err)
+	}
+	roles, err := directory.roles.FindAll()
+	if err != nil {
+		return nil, fmt.Errorf("error finding roles: %w", err)
+	}
+	memberships, err := directory.roles.FindActiveMemberships()
+	if err != nil {
+		return nil, fmt.Errorf("error finding role memberships: %w", err)
+	}
+	members := map[int64][]int64{}
+	for _, membership := range memberships {
+		members[membership.RoleId] = append(members[membership.RoleId], membership.EmployeeId)
+	}
+	memberOf := map[int64][]string{}
+	entries := []Entry{
+		directory.base(),
+		organizationalUnit(PeopleOu, directory.baseDn),
+		organizationalUnit(GroupsOu, directory.baseDn),
+	}
+	for _, entity := range roles {
+		dn := directory.groupDn(entity.Name)
+		memberDns := make([]string, 0, len(members[entity.Id]))
+		for _, employeeId := range members[entity.Id] {
+			memberDns = append(memberDns, directory.PersonDn(employeeId))
+			memberOf[employeeId] = append(memberOf[employeeId], dn)
+		}
+		attributes := []Attribute{
+			{Name: "objectClass", Values: []string{"top", "groupOfNames"}},
+			{Name: "cn", Values: []string{entity.Name}},
+		}
+		if len(memberDns) > 0 {
+			attributes = append(attributes, Attribute{Name: "member", Values: memberDns})
+		}
+		entries = append(entries, Entry{Dn: dn, Attributes: attributes, permission: PermissionRoles})
+	}
+	for _, entity := range employees {
+		id := strconv.FormatInt(entity.Id, 10)
+		attributes := []Attribute{
+			{Name: "objectClass", Values: []string{"top", "person", "organizationalPerson", "inetOrgPerson"}},
+			{Name: "uid", Values: []string{id}},
+			{Name: "cn", Values: []string{entity.Name}},
+			{Name: "sn", Values: []string{entity.Name}},
+			{Name: "displayName", Values: []string{entity.Name}},
+			{Name: "employeeNumber", Values: []string{id}},
+			{Name: "employeeType", Values: []string{entity.Status}},
+		}
+		if entity.RoleName != nil {
+			attributes = append(attributes, Attribute{Name: "title", Values: []string{*entity.RoleName}})
+		}
+		if len(memberOf[entity.Id]) > 0 {
+			attributes = append(attributes, Attribute{Name: "memberOf", Values: memberOf[entity.Id]})
+		}
+		entries = append(entries, Entry{Dn: directory.PersonDn(entity.Id), Attributes: attributes, permission: PermissionEmployees})
+	}
+	return entries, nil
+}
+
+func (directory *Directory) base() Entry {
+	attributes := []Attribute{{Name: "objectClass", Values: []string{"top"}}}
+	if dn, err := ldap.ParseDN(directory.baseDn); err == nil && len(dn.RDNs) > 0 {
+		first := dn.RDNs[0].Attributes[0]
+		attributes[0].Values = append(attributes[0].Values, baseObjectClass(first.Type))
+		attributes = append(attributes, Attribute{Name: first.Type, Values: []string{first.Value}})
+	}
+	return Entry{Dn: directory.baseDn, Attributes: attributes}
+}
+
+// baseObjectClass структурный класс базовой записи по атрибуту её RDN: dc=example — domain, o=example — organization
+func baseObjectClass(attributeType string) string {
+	switch strings.ToLower(attributeType) {
+	case "o":
+		return "organization"
+	case "ou":
+		return "organizationalUnit"
+	}
+	return "domain"
+}
+
+func organizationalUnit(name string, baseDn string) Entry {
+	return Entry{
+		Dn: fmt.Sprintf("ou=%s,%s", name, baseDn),
+		Attributes: []Attribute{
+			{Name: "objectClass", Values: []string{"top", "organizationalUnit"}},
+			{Name: "ou", Values: []string{name}},
+		},
+	}
+}
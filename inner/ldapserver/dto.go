@@ -0,0 +1,43 @@
+package ldapserver
+
+import "strings"
+
+// ветки каталога под базовым DN
+const (
+	PeopleOu   = "people"
+	GroupsOu   = "groups"
+	ServicesOu = "services"
+)
+
+// права, которые нужны привязанному API-ключу для чтения веток
+const (
+	PermissionEmployees = "employees:read"
+	PermissionRoles     = "roles:read"
+)
+
+// Attribute атрибут записи; имя хранится в каноническом написании, сравнивается без учёта регистра
+type Attribute struct {
+	Name   string
+	Values []string
+}
+
+// Entry запись каталога
+type Entry struct {
+	Dn         string
+	Attributes []Attribute
+	// permission право, без которого запись не видна; пусто — видна любому привязанному API-ключу
+	permission string
+}
+
+// Values значения атрибута; нет атрибута — nil
+func (entry *Entry) Values(name string) []string {
+	for _, attribute := range entry.Attributes {
+		if strings.EqualFold(attribute.Name, name) {
+			return attribute.Values
+		}
+	}
+	return nil
+}
+
+// dnAttributes атрибуты со значениями-DN: сравниваются после нормализации DN
+var dnAttributes = map[string]bool{"member": true, "memberof": true}
@@ -0,0 +1,131 @@
+package ldapserver
+
+import (
+	"fmt"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"strconv"
+	"strings"
+)
+
+// matches проверка записи фильтром поиска (RFC 4511, раздел 4.5.1.7). Все атрибуты каталога строковые
+// и сравниваются без учёта регистра, атрибуты-DN — после нормализации; extensibleMatch не поддерживается
+// и, как неопределённый результат, запись не выбирает
+func matches(filter *ber.Packet, entry *Entry) (bool, error) {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if ok, err := matches(child, entry); err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if ok, err := matches(child, entry); err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	case ldap.FilterNot:
+		if len(filter.Children) != 1 {
+			return false, errInvalidFilter
+		}
+		ok, err := matches(filter.Children[0], entry)
+		return !ok, err
+	case ldap.FilterPresent:
+		return len(entry.Values(filter.Data.String())) > 0, nil
+	case ldap.FilterEqualityMatch, ldap.FilterApproxMatch, ldap.FilterGreaterOrEqual, ldap.FilterLessOrEqual:
+		if len(filter.Children) != 2 {
+			return false, errInvalidFilter
+		}
+		attribute, assertion := filter.Children[0].Data.String(), filter.Children[1].Data.String()
+		for _, value := range entry.Values(attribute) {
+			if compare(attribute, value, assertion, filter.Tag) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case ldap.FilterSubstrings:
+		if len(filter.Children) != 2 {
+			return false, errInvalidFilter
+		}
+		for _, value := range entry.Values(filter.Children[0].Data.String()) {
+			if substrings(strings.ToLower(value), filter.Children[1].Children) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case ldap.FilterExtensibleMatch:
+		return false, nil
+	}
+	return false, fmt.Errorf("%w: unknown filter choice %d", errInvalidFilter, filter.Tag)
+}
+
+func compare(attribute string, value string, assertion string, tag ber.Tag) bool {
+	if dnAttributes[strings.ToLower(attribute)] {
+		return tag != ldap.FilterGreaterOrEqual && tag != ldap.FilterLessOrEqual && sameDn(value, assertion)
+	}
+	order := strings.Compare(strings.ToLower(value), strings.ToLower(assertion))
+	// идентификаторы сравниваются как числа, чтобы (uid>=10) не выбирал uid=9
+	if left, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if right, err := strconv.ParseInt(assertion, 10, 64); err == nil {
+			order = compareInt(left, right)
+		}
+	}
+	switch tag {
+	case ldap.FilterGreaterOrEqual:
+		return order >= 0
+	case ldap.FilterLessOrEqual:
+		return order <= 0
+	}
+	return order == 0
+}
+
+func compareInt(left int64, right int64) int {
+	switch {
+	case left < right:
+		return -1
+	case left > right:
+		return 1
+	}
+	return 0
+}
+
+// substrings проверка value по частям initial, any и final, идущим по порядку
+func substrings(value string, parts []*ber.Packet) bool {
+	for i, part := range parts {
+		piece := strings.ToLower(part.Data.String())
+		switch part.Tag {
+		case ldap.FilterSubstringsInitial:
+			if i != 0 || !strings.HasPrefix(value, piece) {
+				return false
+			}
+			value = value[len(piece):]
+		case ldap.FilterSubstringsAny:
+			index := strings.Index(value, piece)
+			if index < 0 {
+				return false
+			}
+			value = value[index+len(piece):]
+		case ldap.FilterSubstringsFinal:
+			if i != len(parts)-1 || !strings.HasSuffix(value, piece) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// sameDn DN совпадают без учёта регистра и пробелов
+func sameDn(left string, right string) bool {
+	leftDn, err := ldap.ParseDN(left)
+	if err != nil {
+		return false
+	}
+	rightDn, err := ldap.ParseDN(right)
+	if err != nil {
+		return false
+	}
+	return leftDn.EqualFold(rightDn)
+}
@@ -0,0 +1,50 @@
+package ldapserver
+
+import (
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMatches(t *testing.T) {
+	var a = assert.New(t)
+	var entry = Entry{Dn: "uid=9,ou=people,dc=example,dc=com", Attributes: []Attribute{
+		{Name: "objectClass", Values: []string{"top", "person", "inetOrgPerson"}},
+		{Name: "uid", Values: []string{"9"}},
+		{Name: "cn", Values: []string{"Иван Петров"}},
+		{Name: "memberOf", Values: []string{"cn=Admins,ou=groups,dc=example,dc=com"}},
+	}}
+	var cases = []struct {
+		filter string
+		want   bool
+	}{
+		{"(objectClass=*)", true},
+		{"(mail=*)", false},
+		{"(objectclass=INETORGPERSON)", true},
+		{"(&(objectClass=person)(uid=9))", true},
+		{"(&(objectClass=person)(uid=10))", false},
+		{"(|(uid=10)(cn=иван петров))", true},
+		{"(!(uid=9))", false},
+		{"(uid>=10)", false},
+		{"(uid<=10)", true},
+		{"(cn=Иван*)", true},
+		{"(cn=*пет*)", true},
+		{"(cn=*Петров)", true},
+		{"(cn=Петров*)", false},
+		{"(cn=И*ан*ров)", true},
+		{"(memberOf=CN=admins, OU=groups, DC=example, DC=com)", true},
+		{"(memberOf=cn=users,ou=groups,dc=example,dc=com)", false},
+		{"(cn:caseExactMatch:=Иван Петров)", false},
+	}
+	for _, c := range cases {
+		t.Run(c.filter, func(t *testing.T) {
+			var filter, err = ldap.CompileFilter(c.filter)
+			a.Nil(err)
+
+			var got, matchErr = matches(filter, &entry)
+
+			a.Nil(matchErr)
+			a.Equal(c.want, got)
+		})
+	}
+}
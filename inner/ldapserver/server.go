@@ -0,0 +1,307 @@
+package ldapserver
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"idm/inner/auth"
+	"idm/inner/employee"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// idleTimeout соединение без запросов дольше этого закрывается
+	idleTimeout = 5 * time.Minute
+	// maxMessageSize предел размера одного сообщения; запросы только читают каталог и больше не бывают,
+	// а без предела длина из заголовка сообщения позволяла бы ещё до привязки занять гигабайты памяти
+	maxMessageSize = 4 << 20
+	// maxConnections предел одновременных соединений, следующие ждут освобождения
+	maxConnections = 256
+)
+
+var errInvalidFilter = errors.New("invalid search filter")
+
+// ApiKeys проверка API-ключей, реализуется apikey.Service
+type ApiKeys interface {
+	VerifyApiKey(key string) (auth.ApiKeyPrincipal, error)
+}
+
+// LoginCodes одноразовые коды входа сотрудников, реализуется token.Service
+type LoginCodes interface {
+	UseLoginCode(employeeId int64, code string) error
+}
+
+// Server сервер LDAP только для чтения. Привязка:
+//   - cn=<key id>,ou=services,<base> с API-ключом целиком в качестве пароля — для приложений,
+//     которые ищут сотрудников; видны ветки, на которые у ключа есть права employees:read и roles:read;
+//   - uid=<id>,ou=people,<base> с одноразовым кодом входа — проверка входа активного сотрудника;
+//     такая сессия каталог не читает.
+//
+// Анонимно доступна только корневая запись (rootDSE)
+type Server struct {
+	directory  *Directory
+	baseDn     *ldap.DN
+	employees  Employees
+	apiKeys    ApiKeys
+	loginCodes LoginCodes
+}
+
+func NewServer(directory *Directory, apiKeys ApiKeys, loginCodes LoginCodes) (*Server, error) {
+	baseDn, err := ldap.ParseDN(directory.baseDn)
+	if err != nil || len(baseDn.RDNs) == 0 {
+		return nil, fmt.Errorf("invalid ldap base dn %q", directory.baseDn)
+	}
+	return &Server{
+		directory:  directory,
+		baseDn:     baseDn,
+		employees:  directory.employees,
+		apiKeys:    apiKeys,
+		loginCodes: loginCodes,
+	}, nil
+}
+
+// ListenAndServe приём соединений на address; с tlsConfig — сразу по TLS (ldaps)
+func (server *Server) ListenAndServe(address string, tlsConfig *tls.Config) error {
+	var listener net.Listener
+	var err error
+	if tlsConfig != nil {
+		listener, err = tls.Listen("tcp", address, tlsConfig)
+	} else {
+		listener, err = net.Listen("tcp", address)
+	}
+	if err != nil {
+		return err
+	}
+	return server.Serve(listener)
+}
+
+// Serve обслуживание соединений listener, пока он не закрыт; одновременно не больше maxConnections
+func (server *Server) Serve(listener net.Listener) error {
+	slots := make(chan struct{}, maxConnections)
+	for {
+		slots <- struct{}{}
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer func() { <-slots }()
+			server.serve(conn)
+		}()
+	}
+}
+
+// session состояние соединения после привязки
+type session struct {
+	// permissions права привязанного API-ключа; nil — анонимная сессия или сотрудник
+	permissions []string
+}
+
+func (server *Server) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	current := &session{}
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		packet, err := ber.ReadPacket(io.LimitReader(conn, maxMessageSize))
+		if err != nil {
+			return
+		}
+		if len(packet.Children) < 2 || packet.Children[1].ClassType != ber.ClassApplication {
+			return
+		}
+		id, ok := packet.Children[0].Value.(int64)
+		if !ok {
+			return
+		}
+		op := packet.Children[1]
+		var responses []*ber.Packet
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			responses = []*ber.Packet{server.bind(current, op)}
+		case ldap.ApplicationSearchRequest:
+			responses = server.search(current, op)
+		case ldap.ApplicationUnbindRequest:
+			return
+		case ldap.ApplicationAbandonRequest:
+			continue
+		case ldap.ApplicationExtendedRequest:
+			responses = []*ber.Packet{result(ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError, "",
+				"extended operations are not supported")}
+		default:
+			// изменения отклоняются ответом на ту же операцию: у ответов теги на единицу больше запросов
+			responses = []*ber.Packet{result(op.Tag+1, ldap.LDAPResultUnwillingToPerform, "", "directory is read-only")}
+		}
+		for _, response := range responses {
+			if _, err = conn.Write(message(id, response).Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// bind простая привязка; неудачная привязка оставляет соединение анонимным
+func (server *Server) bind(current *session, op *ber.Packet) *ber.Packet {
+	*current = session{}
+	if len(op.Children) < 3 {
+		return result(ldap.ApplicationBindResponse, ldap.LDAPResultProtocolError, "", "malformed bind request")
+	}
+	if version, _ := op.Children[0].Value.(int64); version != 3 {
+		return result(ldap.ApplicationBindResponse, ldap.LDAPResultProtocolError, "", "only LDAPv3 is supported")
+	}
+	name, credentials := op.Children[1].Data.String(), op.Children[2]
+	if credentials.ClassType != ber.ClassContext || credentials.Tag != 0 {
+		return result(ldap.ApplicationBindResponse, ldap.LDAPResultAuthMethodNotSupported, "", "only simple bind is supported")
+	}
+	password := credentials.Data.String()
+	if name == "" && password == "" {
+		return result(ldap.ApplicationBindResponse, ldap.LDAPResultSuccess, "", "")
+	}
+	if password == "" {
+		// RFC 4513, 5.1.2: привязка с именем без пароля не должна считаться успешной аутентификацией
+		return result(ldap.ApplicationBindResponse, ldap.LDAPResultUnwillingToPerform, "", "unauthenticated bind is not allowed")
+	}
+	permissions, err := server.authenticate(name, password)
+	if errors.Is(err, errInvalidCredentials) {
+		return result(ldap.ApplicationBindResponse, ldap.LDAPResultInvalidCredentials, "", "")
+	}
+	if err != nil {
+		fmt.Printf("ldap bind error: %v\n", err)
+		return result(ldap.ApplicationBindResponse, ldap.LDAPResultOperationsError, "", "")
+	}
+	current.permissions = permissions
+	return result(ldap.ApplicationBindResponse, ldap.LDAPResultSuccess, "", "")
+}
+
+var errInvalidCredentials = errors.New("invalid credentials")
+
+// authenticate проверка имени и пароля; права API-ключа или пустой непустой список для сотрудника
+func (server *Server) authenticate(name string, password string) ([]string, error) {
+	dn, err := ldap.ParseDN(name)
+	if err != nil || len(dn.RDNs) != len(server.baseDn.RDNs)+2 || !server.baseDn.AncestorOfFold(dn) {
+		return nil, errInvalidCredentials
+	}
+	rdn, ou := dn.RDNs[0].Attributes[0], dn.RDNs[1].Attributes[0]
+	switch {
+	case strings.EqualFold(ou.Type, "ou") && strings.EqualFold(ou.Value, ServicesOu) && strings.EqualFold(rdn.Type, "cn"):
+		principal, err := server.apiKeys.VerifyApiKey(password)
+		if errors.Is(err, auth.ErrInvalidApiKey) || (err == nil && principal.KeyId != rdn.Value) {
+			return nil, errInvalidCredentials
+		}
+		if err != nil {
+			return nil, err
+		}
+		return append([]string{}, principal.Permissions...), nil
+	case strings.EqualFold(ou.Type, "ou") && strings.EqualFold(ou.Value, PeopleOu) && strings.EqualFold(rdn.Type, "uid"):
+		id, err := strconv.ParseInt(rdn.Value, 10, 64)
+		if err != nil {
+			return nil, errInvalidCredentials
+		}
+		entity, err := server.employees.FindById(id)
+		if err != nil || entity.Status != employee.StatusActive {
+			return nil, errInvalidCredentials
+		}
+		if err = server.loginCodes.UseLoginCode(id, password); err != nil {
+			return nil, errInvalidCredentials
+		}
+		return nil, nil
+	}
+	return nil, errInvalidCredentials
+}
+
+// search поиск по каталогу; записи строятся заново на каждый запрос, поэтому всегда актуальны
+func (server *Server) search(current *session, op *ber.Packet) []*ber.Packet {
+	if len(op.Children) < 8 {
+		return []*ber.Packet{done(ldap.LDAPResultProtocolError, "", "malformed search request")}
+	}
+	base := op.Children[0].Data.String()
+	scope, _ := op.Children[1].Value.(int64)
+	sizeLimit, _ := op.Children[3].Value.(int64)
+	typesOnly, _ := op.Children[5].Value.(bool)
+	filter := op.Children[6]
+	var requested []string
+	for _, attribute := range op.Children[7].Children {
+		requested = append(requested, attribute.Data.String())
+	}
+
+	if base == "" && scope == ldap.ScopeBaseObject {
+		return []*ber.Packet{searchEntry("", selectAttributes(server.rootDse(), requested), typesOnly), done(ldap.LDAPResultSuccess, "", "")}
+	}
+	if current.permissions == nil {
+		return []*ber.Packet{done(ldap.LDAPResultInsufficientAccessRights, "", "bind with an api key to search")}
+	}
+	baseDn, err := ldap.ParseDN(base)
+	if err != nil {
+		return []*ber.Packet{done(ldap.LDAPResultInvalidDNSyntax, "", err.Error())}
+	}
+	if !server.baseDn.EqualFold(baseDn) && !server.baseDn.AncestorOfFold(baseDn) {
+		return []*ber.Packet{done(ldap.LDAPResultNoSuchObject, "", "")}
+	}
+	entries, err := server.directory.Entries()
+	if err != nil {
+		fmt.Printf("ldap search error: %v\n", err)
+		return []*ber.Packet{done(ldap.LDAPResultOperationsError, "", "")}
+	}
+
+	responses := []*ber.Packet{}
+	found := false
+	for i := range entries {
+		entry := &entries[i]
+		if entry.permission != "" && !slices.Contains(current.permissions, entry.permission) {
+			continue
+		}
+		dn, err := ldap.ParseDN(entry.Dn)
+		if err != nil {
+			continue
+		}
+		found = found || baseDn.EqualFold(dn)
+		if !inScope(baseDn, dn, scope) {
+			continue
+		}
+		ok, err := matches(filter, entry)
+		if err != nil {
+			return []*ber.Packet{done(ldap.LDAPResultProtocolError, "", err.Error())}
+		}
+		if !ok {
+			continue
+		}
+		if sizeLimit > 0 && int64(len(responses)) == sizeLimit {
+			return append(responses, done(ldap.LDAPResultSizeLimitExceeded, "", ""))
+		}
+		responses = append(responses, searchEntry(entry.Dn, selectAttributes(entry.Attributes, requested), typesOnly))
+	}
+	if !found {
+		return []*ber.Packet{done(ldap.LDAPResultNoSuchObject, server.directory.baseDn, "")}
+	}
+	return append(responses, done(ldap.LDAPResultSuccess, "", ""))
+}
+
+func inScope(base *ldap.DN, dn *ldap.DN, scope int64) bool {
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return base.EqualFold(dn)
+	case ldap.ScopeSingleLevel:
+		return base.AncestorOfFold(dn) && len(dn.RDNs) == len(base.RDNs)+1
+	}
+	return base.EqualFold(dn) || base.AncestorOfFold(dn)
+}
+
+// rootDse корневая запись: по ней клиенты узнают базовый DN и версию протокола
+func (server *Server) rootDse() []Attribute {
+	return []Attribute{
+		{Name: "objectClass", Values: []string{"top"}},
+		{Name: "namingContexts", Values: []string{server.directory.baseDn}},
+		{Name: "supportedLDAPVersion", Values: []string{"3"}},
+		{Name: "vendorName", Values: []string{"idm"}},
+	}
+}
+
+func done(code uint16, matchedDn string, diagnostic string) *ber.Packet {
+	return result(ldap.ApplicationSearchResultDone, code, matchedDn, diagnostic)
+}
@@ -0,0 +1,279 @@
+package ldapserver
+
+import (
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/auth"
+	"idm/inner/employee"
+	"idm/inner/role"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type MockEmployees struct {
+	mock.Mock
+}
+
+func (m *MockEmployees) FindAll() ([]employee.Entity, error) {
+	args := m.Called()
+	return args.Get(0).([]employee.Entity), args.Error(1)
+}
+
+func (m *MockEmployees) FindById(id int64) (employee.Entity, error) {
+	args := m.Called(id)
+	return args.Get(0).(employee.Entity), args.Error(1)
+}
+
+type MockRoles struct {
+	mock.Mock
+}
+
+func (m *MockRoles) FindAll() ([]role.Entity, error) {
+	args := m.Called()
+	return args.Get(0).([]role.Entity), args.Error(1)
+}
+
+func (m *MockRoles) FindActiveMemberships() ([]role.MembershipEntity, error) {
+	args := m.Called()
+	return args.Get(0).([]role.MembershipEntity), args.Error(1)
+}
+
+type MockApiKeys struct {
+	mock.Mock
+}
+
+func (m *MockApiKeys) VerifyApiKey(key string) (auth.ApiKeyPrincipal, error) {
+	args := m.Called(key)
+	return args.Get(0).(auth.ApiKeyPrincipal), args.Error(1)
+}
+
+type MockLoginCodes struct {
+	mock.Mock
+}
+
+func (m *MockLoginCodes) UseLoginCode(employeeId int64, code string) error {
+	return m.Called(employeeId, code).Error(0)
+}
+
+const baseDn = "dc=example,dc=com"
+
+func startServer(t *testing.T) string {
+	var manager = "Менеджер"
+	var employees = new(MockEmployees)
+	employees.On("FindAll").Return([]employee.Entity{
+		{Id: 1, Name: "Иван Петров", Status: employee.StatusActive, RoleName: &manager},
+		{Id: 2, Name: "Пётр Сидоров", Status: employee.StatusSuspended},
+	}, nil)
+	employees.On("FindById", int64(1)).Return(employee.Entity{Id: 1, Status: employee.StatusActive}, nil)
+	employees.On("FindById", int64(2)).Return(employee.Entity{Id: 2, Status: employee.StatusSuspended}, nil)
+	var roles = new(MockRoles)
+	roles.On("FindAll").Return([]role.Entity{{Id: 5, Name: "Менеджер"}, {Id: 6, Name: "Аудиторы"}}, nil)
+	roles.On("FindActiveMemberships").Return([]role.MembershipEntity{{RoleId: 5, EmployeeId: 1}}, nil)
+	var apiKeys = new(MockApiKeys)
+	apiKeys.On("VerifyApiKey", "idm_reader.secret").Return(auth.ApiKeyPrincipal{
+		KeyId: "reader", Permissions: []string{PermissionEmployees, PermissionRoles}}, nil)
+	apiKeys.On("VerifyApiKey", "idm_people.secret").Return(auth.ApiKeyPrincipal{
+		KeyId: "people", Permissions: []string{PermissionEmployees}}, nil)
+	apiKeys.On("VerifyApiKey", mock.Anything).Return(auth.ApiKeyPrincipal{}, auth.ErrInvalidApiKey)
+	var loginCodes = new(MockLoginCodes)
+	loginCodes.On("UseLoginCode", int64(1), "code-1").Return(nil)
+	loginCodes.On("UseLoginCode", mock.Anything, mock.Anything).Return(assert.AnError)
+
+	var server, err = NewServer(NewDirectory(baseDn, employees, roles), apiKeys, loginCodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() { _ = server.Serve(listener) }()
+	return "ldap://" + listener.Addr().String()
+}
+
+func connect(t *testing.T, url string, dn string, password string) *ldap.Conn {
+	var conn, err = ldap.DialURL(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	if dn != "" {
+		if err = conn.Bind(dn, password); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return conn
+}
+
+func search(conn *ldap.Conn, base string, scope int, filter string, attributes ...string) (*ldap.SearchResult, error) {
+	return conn.Search(ldap.NewSearchRequest(base, scope, ldap.NeverDerefAliases, 0, 0, false, filter, attributes, nil))
+}
+
+func dns(result *ldap.SearchResult) []string {
+	var list []string
+	for _, entry := range result.Entries {
+		list = append(list, entry.DN)
+	}
+	return list
+}
+
+func TestServerBind(t *testing.T) {
+	var a = assert.New(t)
+	var url = startServer(t)
+	var conn = connect(t, url, "", "")
+
+	t.Run("should bind api key with matching key id", func(t *testing.T) {
+		a.Nil(conn.Bind("cn=reader,ou=services,"+baseDn, "idm_reader.secret"))
+	})
+
+	t.Run("should reject api key of another key id", func(t *testing.T) {
+		a.True(ldap.IsErrorWithCode(conn.Bind("cn=people,ou=services,"+baseDn, "idm_reader.secret"), ldap.LDAPResultInvalidCredentials))
+	})
+
+	t.Run("should reject unknown api key", func(t *testing.T) {
+		a.True(ldap.IsErrorWithCode(conn.Bind("cn=reader,ou=services,"+baseDn, "wrong"), ldap.LDAPResultInvalidCredentials))
+	})
+
+	t.Run("should bind active employee with login code", func(t *testing.T) {
+		a.Nil(conn.Bind("UID=1, OU=people, DC=example, DC=com", "code-1"))
+	})
+
+	t.Run("should reject suspended employee and wrong code", func(t *testing.T) {
+		a.True(ldap.IsErrorWithCode(conn.Bind("uid=2,ou=people,"+baseDn, "code-2"), ldap.LDAPResultInvalidCredentials))
+		a.True(ldap.IsErrorWithCode(conn.Bind("uid=1,ou=people,"+baseDn, "code-2"), ldap.LDAPResultInvalidCredentials))
+	})
+
+	t.Run("should reject dn outside of tree", func(t *testing.T) {
+		a.True(ldap.IsErrorWithCode(conn.Bind("cn=reader,ou=services,dc=other", "idm_reader.secret"), ldap.LDAPResultInvalidCredentials))
+	})
+
+	t.Run("should refuse unauthenticated bind", func(t *testing.T) {
+		a.True(ldap.IsErrorWithCode(conn.UnauthenticatedBind("uid=1,ou=people,"+baseDn), ldap.LDAPResultUnwillingToPerform))
+	})
+}
+
+func TestServerSearch(t *testing.T) {
+	var a = assert.New(t)
+	var url = startServer(t)
+	var reader = connect(t, url, "cn=reader,ou=services,"+baseDn, "idm_reader.secret")
+
+	t.Run("should find person with attributes and memberOf", func(t *testing.T) {
+		var result, err = search(reader, baseDn, ldap.ScopeWholeSubtree, "(&(objectClass=inetOrgPerson)(cn=Иван*))")
+
+		a.Nil(err)
+		a.Equal([]string{"uid=1,ou=people," + baseDn}, dns(result))
+		var entry = result.Entries[0]
+		a.Equal("Иван Петров", entry.GetAttributeValue("cn"))
+		a.Equal("active", entry.GetAttributeValue("employeeType"))
+		a.Equal("Менеджер", entry.GetAttributeValue("title"))
+		a.Equal([]string{"cn=Менеджер,ou=groups," + baseDn}, entry.GetAttributeValues("memberOf"))
+	})
+
+	t.Run("should find groups with members", func(t *testing.T) {
+		var result, err = search(reader, "ou=groups,"+baseDn, ldap.ScopeSingleLevel, "(objectClass=groupOfNames)", "cn", "member")
+
+		a.Nil(err)
+		a.Equal([]string{"cn=Менеджер,ou=groups," + baseDn, "cn=Аудиторы,ou=groups," + baseDn}, dns(result))
+		a.Equal([]string{"uid=1,ou=people," + baseDn}, result.Entries[0].GetAttributeValues("member"))
+		a.Len(result.Entries[0].Attributes, 2)
+	})
+
+	t.Run("should find groups of member", func(t *testing.T) {
+		var result, err = search(reader, baseDn, ldap.ScopeWholeSubtree, "(member=uid=1,ou=people,"+baseDn+")", "1.1")
+
+		a.Nil(err)
+		a.Equal([]string{"cn=Менеджер,ou=groups," + baseDn}, dns(result))
+		a.Empty(result.Entries[0].Attributes)
+	})
+
+	t.Run("should read entry with base scope", func(t *testing.T) {
+		var result, err = search(reader, "uid=2,ou=people,"+baseDn, ldap.ScopeBaseObject, "(objectClass=*)", "employeeType")
+
+		a.Nil(err)
+		a.Equal("suspended", result.Entries[0].GetAttributeValue("employeeType"))
+	})
+
+	t.Run("should list tree levels", func(t *testing.T) {
+		var result, err = search(reader, baseDn, ldap.ScopeSingleLevel, "(objectClass=organizationalUnit)")
+
+		a.Nil(err)
+		a.Equal([]string{"ou=people," + baseDn, "ou=groups," + baseDn}, dns(result))
+	})
+
+	t.Run("should stop at size limit", func(t *testing.T) {
+		var _, err = reader.Search(ldap.NewSearchRequest(baseDn, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 1, 0,
+			false, "(objectClass=*)", nil, nil))
+
+		a.True(ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded))
+	})
+
+	t.Run("should return no such object for missing entry and foreign base", func(t *testing.T) {
+		var _, err = search(reader, "uid=3,ou=people,"+baseDn, ldap.ScopeBaseObject, "(objectClass=*)")
+		a.True(ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject))
+
+		_, err = search(reader, "dc=other", ldap.ScopeWholeSubtree, "(objectClass=*)")
+		a.True(ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject))
+	})
+
+	t.Run("should hide groups without roles permission", func(t *testing.T) {
+		var people = connect(t, url, "cn=people,ou=services,"+baseDn, "idm_people.secret")
+
+		var result, err = search(people, baseDn, ldap.ScopeWholeSubtree, "(|(objectClass=groupOfNames)(uid=1))")
+
+		a.Nil(err)
+		a.Equal([]string{"uid=1,ou=people," + baseDn}, dns(result))
+	})
+
+	t.Run("should refuse search without api key", func(t *testing.T) {
+		var anonymous = connect(t, url, "", "")
+		var employeeConn = connect(t, url, "uid=1,ou=people,"+baseDn, "code-1")
+
+		var _, err = search(anonymous, baseDn, ldap.ScopeWholeSubtree, "(objectClass=*)")
+		a.True(ldap.IsErrorWithCode(err, ldap.LDAPResultInsufficientAccessRights))
+
+		_, err = search(employeeConn, baseDn, ldap.ScopeWholeSubtree, "(objectClass=*)")
+		a.True(ldap.IsErrorWithCode(err, ldap.LDAPResultInsufficientAccessRights))
+	})
+
+	t.Run("should serve root dse anonymously", func(t *testing.T) {
+		var anonymous = connect(t, url, "", "")
+
+		var result, err = search(anonymous, "", ldap.ScopeBaseObject, "(objectClass=*)", "namingContexts")
+
+		a.Nil(err)
+		a.Equal([]string{baseDn}, result.Entries[0].GetAttributeValues("namingContexts"))
+	})
+
+	t.Run("should reject modifications", func(t *testing.T) {
+		var err = reader.Del(ldap.NewDelRequest("uid=1,ou=people,"+baseDn, nil))
+
+		a.True(ldap.IsErrorWithCode(err, ldap.LDAPResultUnwillingToPerform))
+	})
+}
+
+func TestServerMessageSize(t *testing.T) {
+	var a = assert.New(t)
+	var url = startServer(t)
+	var conn, err = net.Dial("tcp", strings.TrimPrefix(url, "ldap://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// сообщение с заявленной длиной почти 2 ГиБ: сервер закрывает соединение, прочитав maxMessageSize
+	go func() {
+		_, _ = conn.Write([]byte{0x30, 0x84, 0x7f, 0xff, 0xff, 0xff, 0x04, 0x84, 0x7f, 0xff, 0xff, 0xf0})
+		_, _ = conn.Write(make([]byte, maxMessageSize+1024))
+	}()
+	_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+
+	// соединение закрыто сервером, а не истекло ожидание
+	a.Error(err)
+	a.False(os.IsTimeout(err))
+}
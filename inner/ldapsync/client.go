@@ -0,0 +1,144 @@
+package ldapsync
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// timeout ограничение на подключение и на каждый запрос к каталогу
+const timeout = 30 * time.Second
+
+// Client чтение пользователей и групп из каталога LDAP; подключение открывается на каждое чтение
+type Client struct {
+	config Config
+}
+
+func NewClient(config Config) *Client {
+	return &Client{config: config}
+}
+
+// Read пользователи и группы каталога; отключённые пользователи отмечаются по DisabledFilter
+func (client *Client) Read() (snapshot Snapshot, err error) {
+	conn, err := client.connect()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	users := client.config.Users
+	entries, err := client.search(conn, users.BaseDn, users.Filter, users.IdAttribute, users.NameAttribute)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("error searching ldap users: %w", err)
+	}
+	disabled := map[string]bool{}
+	if client.config.DisabledFilter != "" {
+		filter := fmt.Sprintf("(&%s%s)", users.Filter, client.config.DisabledFilter)
+		disabledEntries, err := client.search(conn, users.BaseDn, filter, users.IdAttribute)
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("error searching disabled ldap users: %w", err)
+		}
+		for _, entry := range disabledEntries {
+			disabled[attributeValue(entry, users.IdAttribute)] = true
+		}
+	}
+	for _, entry := range entries {
+		id := attributeValue(entry, users.IdAttribute)
+		snapshot.Users = append(snapshot.Users, DirectoryUser{
+			Dn:       entry.DN,
+			Id:       id,
+			Name:     strings.TrimSpace(entry.GetAttributeValue(users.NameAttribute)),
+			Disabled: disabled[id],
+		})
+	}
+	if client.config.SkipGroups {
+		return snapshot, nil
+	}
+
+	groups := client.config.Groups
+	entries, err = client.search(conn, groups.BaseDn, groups.Filter, groups.IdAttribute, groups.NameAttribute,
+		groups.MemberAttribute)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("error searching ldap groups: %w", err)
+	}
+	for _, entry := range entries {
+		snapshot.Groups = append(snapshot.Groups, DirectoryGroup{
+			Dn:      entry.DN,
+			Id:      attributeValue(entry, groups.IdAttribute),
+			Name:    strings.TrimSpace(entry.GetAttributeValue(groups.NameAttribute)),
+			Members: entry.GetAttributeValues(groups.MemberAttribute),
+		})
+	}
+	return snapshot, nil
+}
+
+func (client *Client) connect() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(client.config.Url, ldap.DialWithDialer(&net.Dialer{Timeout: timeout}))
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to ldap: %w", err)
+	}
+	conn.SetTimeout(timeout)
+	if client.config.StartTls {
+		host := client.config.Url
+		if parsed, err := url.Parse(host); err == nil {
+			host = parsed.Hostname()
+		}
+		if err = conn.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("error starting tls with ldap: %w", err)
+		}
+	}
+	if client.config.BindDn != "" {
+		if err = conn.Bind(client.config.BindDn, client.config.BindPassword); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("error binding to ldap as %s: %w", client.config.BindDn, err)
+		}
+	}
+	return conn, nil
+}
+
+// search постраничный поиск в поддереве; атрибут "dn" не запрашивается — это имя самой записи
+func (client *Client) search(conn *ldap.Conn, baseDn string, filter string, attributes ...string) ([]*ldap.Entry, error) {
+	requested := make([]string, 0, len(attributes))
+	for _, attribute := range attributes {
+		if !strings.EqualFold(attribute, "dn") {
+			requested = append(requested, attribute)
+		}
+	}
+	request := ldap.NewSearchRequest(baseDn, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		filter, requested, nil)
+	result, err := conn.SearchWithPaging(request, client.config.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	return result.Entries, nil
+}
+
+// attributeValue значение идентифицирующего атрибута; двоичные значения, например objectGUID в AD,
+// переводятся в hex
+func attributeValue(entry *ldap.Entry, attribute string) string {
+	if strings.EqualFold(attribute, "dn") {
+		return entry.DN
+	}
+	raw := entry.GetRawAttributeValue(attribute)
+	if utf8.Valid(raw) && strings.IndexFunc(string(raw), func(r rune) bool { return !unicode.IsPrint(r) }) < 0 {
+		return string(raw)
+	}
+	return hex.EncodeToString(raw)
+}
+
+// normalizeDn DN для сравнения: значения member в группах могут отличаться от DN записи регистром и пробелами
+func normalizeDn(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return strings.ToLower(dn)
+	}
+	return strings.ToLower(parsed.String())
+}
@@ -0,0 +1,88 @@
+package ldapsync
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var testEntries = []testEntry{
+	{dn: "uid=alice,ou=people,dc=example,dc=com", attributes: map[string][]string{
+		"objectClass": {"person"}, "entryUUID": {"u-alice"}, "cn": {"Alice Smith"}}},
+	{dn: "uid=bob,ou=people,dc=example,dc=com", attributes: map[string][]string{
+		"objectClass": {"person"}, "entryUUID": {"u-bob"}, "cn": {"Bob Jones"}, "nsAccountLock": {"TRUE"}}},
+	{dn: "cn=admins,ou=groups,dc=example,dc=com", attributes: map[string][]string{
+		"objectClass": {"groupOfNames"}, "entryUUID": {"g-admins"}, "cn": {"Admins"},
+		"member": {"UID=alice, OU=people, DC=example, DC=com"}}},
+	{dn: "cn=printer,ou=devices,dc=example,dc=com", attributes: map[string][]string{
+		"objectClass": {"device"}, "cn": {"printer"}}},
+}
+
+func testConfig(url string) Config {
+	return Config{
+		Url:            url,
+		BindDn:         "cn=sync,dc=example,dc=com",
+		BindPassword:   "secret",
+		BaseDn:         "dc=example,dc=com",
+		Users:          Search{}.withDefaults(defaultUsers, "ou=people,dc=example,dc=com"),
+		Groups:         Search{}.withDefaults(defaultGroups, "dc=example,dc=com"),
+		DisabledFilter: "(nsAccountLock=TRUE)",
+		MissingUsers:   MissingSuspend,
+		MissingGroups:  MissingKeep,
+		PageSize:       DefaultPageSize,
+	}
+}
+
+func TestClientRead(t *testing.T) {
+	var a = assert.New(t)
+	var server = newLdapServer(t, "cn=sync,dc=example,dc=com", "secret", testEntries...)
+
+	t.Run("should read users with disabled flag and groups with members", func(t *testing.T) {
+		var snapshot, err = NewClient(testConfig(server.url())).Read()
+
+		a.Nil(err)
+		a.Equal([]DirectoryUser{
+			{Dn: "uid=alice,ou=people,dc=example,dc=com", Id: "u-alice", Name: "Alice Smith"},
+			{Dn: "uid=bob,ou=people,dc=example,dc=com", Id: "u-bob", Name: "Bob Jones", Disabled: true},
+		}, snapshot.Users)
+		a.Equal([]DirectoryGroup{{Dn: "cn=admins,ou=groups,dc=example,dc=com", Id: "g-admins", Name: "Admins",
+			Members: []string{"UID=alice, OU=people, DC=example, DC=com"}}}, snapshot.Groups)
+		a.Equal(normalizeDn(snapshot.Users[0].Dn), normalizeDn(snapshot.Groups[0].Members[0]))
+	})
+
+	t.Run("should use dn as id and skip groups", func(t *testing.T) {
+		var config = testConfig(server.url())
+		config.Users.IdAttribute = "dn"
+		config.SkipGroups = true
+
+		var snapshot, err = NewClient(config).Read()
+
+		a.Nil(err)
+		a.Equal("uid=alice,ou=people,dc=example,dc=com", snapshot.Users[0].Id)
+		a.Empty(snapshot.Groups)
+	})
+
+	t.Run("should fail on wrong credentials", func(t *testing.T) {
+		var config = testConfig(server.url())
+		config.BindPassword = "wrong"
+
+		var _, err = NewClient(config).Read()
+
+		a.ErrorContains(err, "error binding to ldap")
+	})
+}
+
+func TestAttributeValue(t *testing.T) {
+	var a = assert.New(t)
+	var server = newLdapServer(t, "", "", testEntry{dn: "cn=carol,dc=example,dc=com", attributes: map[string][]string{
+		"objectClass": {"person"}, "objectGUID": {"\x01\x02\xff\x10"}, "cn": {"Carol"}}})
+	var config = testConfig(server.url())
+	config.BindDn, config.BindPassword = "", ""
+	config.Users.BaseDn = "dc=example,dc=com"
+	config.Users.IdAttribute = "objectGUID"
+	config.SkipGroups = true
+
+	var snapshot, err = NewClient(config).Read()
+
+	a.Nil(err)
+	a.Equal("0102ff10", snapshot.Users[0].Id)
+}
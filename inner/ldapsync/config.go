@@ -0,0 +1,115 @@
+package ldapsync
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Config подключение к каталогу и правила переноса пользователей и групп
+type Config struct {
+	// Url адрес сервера: ldap://host:389 или ldaps://host:636
+	Url string `json:"url" validate:"required,url"`
+	// StartTls перейти на TLS после подключения по ldap://
+	StartTls bool   `json:"start_tls"`
+	BindDn   string `json:"bind_dn"`
+	// BindPassword пароль; вида ${NAME} — берётся из переменной окружения
+	BindPassword string `json:"bind_password" validate:"required_with=BindDn"`
+	BaseDn       string `json:"base_dn" validate:"required"`
+	Users        Search `json:"users"`
+	Groups       Search `json:"groups"`
+	// SkipGroups не переносить группы; выданные сотрудникам роли тогда не меняются
+	SkipGroups bool `json:"skip_groups"`
+	// DisabledFilter фильтр отключённых пользователей, например для AD
+	// "(userAccountControl:1.2.840.113556.1.4.803:=2)"; такие сотрудники переводятся в suspended
+	DisabledFilter string `json:"disabled_filter"`
+	// MissingUsers что делать с сотрудниками, пропавшими из каталога: keep, suspend или delete
+	MissingUsers string `json:"missing_users" validate:"omitempty,oneof=keep suspend delete"`
+	// MissingGroups что делать с ролями, пропавшими из каталога: keep или delete
+	MissingGroups string `json:"missing_groups" validate:"omitempty,oneof=keep delete"`
+	// PageSize размер страницы постраничного поиска
+	PageSize uint32 `json:"page_size" validate:"max=10000"`
+}
+
+// Search где и как искать записи одного вида; пустые поля заполняются значениями по умолчанию
+type Search struct {
+	// BaseDn поддерево поиска; пусто — Config.BaseDn
+	BaseDn string `json:"base_dn"`
+	Filter string `json:"filter"`
+	// IdAttribute неизменяемый идентификатор записи: entryUUID, objectGUID или "dn"
+	IdAttribute   string `json:"id_attribute"`
+	NameAttribute string `json:"name_attribute"`
+	// MemberAttribute атрибут группы с DN участников
+	MemberAttribute string `json:"member_attribute"`
+}
+
+var defaultUsers = Search{
+	Filter:        "(objectClass=person)",
+	IdAttribute:   "entryUUID",
+	NameAttribute: "cn",
+}
+
+var defaultGroups = Search{
+	Filter:          "(|(objectClass=groupOfNames)(objectClass=group))",
+	IdAttribute:     "entryUUID",
+	NameAttribute:   "cn",
+	MemberAttribute: "member",
+}
+
+// DefaultPageSize размер страницы поиска, если он не задан; AD по умолчанию отдаёт не больше 1000 записей
+const DefaultPageSize = 500
+
+// Validator проверка структур по тегам validate, реализуется validator.Validator
+type Validator interface {
+	Validate(request any) error
+}
+
+// LoadConfig читает настройки синхронизации из JSON-файла; пустой путь — синхронизация выключена
+func LoadConfig(path string, validator Validator) (*Config, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading ldap sync file %s: %w", path, err)
+	}
+	var config Config
+	if err = json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing ldap sync file %s: %w", path, err)
+	}
+	if err = validator.Validate(config); err != nil {
+		return nil, fmt.Errorf("invalid ldap sync config: %w", err)
+	}
+	config.BindPassword = os.ExpandEnv(config.BindPassword)
+	config.Users = config.Users.withDefaults(defaultUsers, config.BaseDn)
+	config.Groups = config.Groups.withDefaults(defaultGroups, config.BaseDn)
+	if config.MissingUsers == "" {
+		config.MissingUsers = MissingSuspend
+	}
+	if config.MissingGroups == "" {
+		config.MissingGroups = MissingKeep
+	}
+	if config.PageSize == 0 {
+		config.PageSize = DefaultPageSize
+	}
+	return &config, nil
+}
+
+func (search Search) withDefaults(defaults Search, baseDn string) Search {
+	if search.BaseDn == "" {
+		search.BaseDn = baseDn
+	}
+	if search.Filter == "" {
+		search.Filter = defaults.Filter
+	}
+	if search.IdAttribute == "" {
+		search.IdAttribute = defaults.IdAttribute
+	}
+	if search.NameAttribute == "" {
+		search.NameAttribute = defaults.NameAttribute
+	}
+	if search.MemberAttribute == "" {
+		search.MemberAttribute = defaults.MemberAttribute
+	}
+	return search
+}
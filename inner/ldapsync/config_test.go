@@ -0,0 +1,49 @@
+package ldapsync
+
+import (
+	"github.com/stretchr/testify/assert"
+	"idm/inner/validator"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	var a = assert.New(t)
+
+	t.Run("should fill defaults and expand password", func(t *testing.T) {
+		t.Setenv("LDAP_PASSWORD", "secret")
+		var path = filepath.Join(t.TempDir(), "ldap.json")
+		a.Nil(os.WriteFile(path, []byte(`{"url": "ldaps://ldap.example.com", "bind_dn": "cn=sync,dc=example,dc=com",
+			"bind_password": "${LDAP_PASSWORD}", "base_dn": "dc=example,dc=com",
+			"users": {"base_dn": "ou=people,dc=example,dc=com", "id_attribute": "objectGUID"}}`), 0o600))
+
+		var config, err = LoadConfig(path, validator.New())
+
+		a.Nil(err)
+		a.Equal("secret", config.BindPassword)
+		a.Equal(Search{BaseDn: "ou=people,dc=example,dc=com", Filter: "(objectClass=person)", IdAttribute: "objectGUID",
+			NameAttribute: "cn"}, config.Users)
+		a.Equal("dc=example,dc=com", config.Groups.BaseDn)
+		a.Equal("member", config.Groups.MemberAttribute)
+		a.Equal(MissingSuspend, config.MissingUsers)
+		a.Equal(MissingKeep, config.MissingGroups)
+		a.Equal(uint32(DefaultPageSize), config.PageSize)
+	})
+
+	t.Run("should reject unknown missing policy", func(t *testing.T) {
+		var path = filepath.Join(t.TempDir(), "ldap.json")
+		a.Nil(os.WriteFile(path, []byte(`{"url": "ldap://ldap", "base_dn": "dc=example", "missing_groups": "suspend"}`), 0o600))
+
+		var _, err = LoadConfig(path, validator.New())
+
+		a.NotNil(err)
+	})
+
+	t.Run("should be disabled without file", func(t *testing.T) {
+		var config, err = LoadConfig("", validator.New())
+
+		a.Nil(err)
+		a.Nil(config)
+	})
+}
@@ -0,0 +1,56 @@
+package ldapsync
+
+import (
+	"errors"
+	"github.com/gofiber/fiber"
+	"idm/inner/common"
+	"idm/inner/web"
+)
+
+type Controller struct {
+	server          *web.Server
+	ldapSyncService Svc
+}
+
+// интерфейс сервиса ldapsync.Service
+type Svc interface {
+	Sync(request Request) (Report, error)
+}
+
+func NewController(server *web.Server, ldapSyncService Svc) *Controller {
+	return &Controller{
+		server:          server,
+		ldapSyncService: ldapSyncService,
+	}
+}
+
+// функция для регистрации маршрутов
+func (c *Controller) RegisterRoutes() {
+	// полный путь будет "/internal/ldap/sync" — для запуска по расписанию и просмотра изменений с dry_run=true
+	c.server.GroupInternal.Post("/ldap/sync", c.Sync)
+}
+
+// функция-хендлер для POST запроса по маршруту "/internal/ldap/sync"
+func (c *Controller) Sync(ctx *fiber.Ctx) {
+	var request Request
+	if err := ctx.QueryParser(&request); err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := c.ldapSyncService.Sync(request)
+	if errors.Is(err, ErrRunning) {
+		_ = common.ErrResponse(ctx, fiber.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = common.OkResponse(ctx, report)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning ldap sync report")
+		return
+	}
+}
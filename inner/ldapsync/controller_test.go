@@ -0,0 +1,52 @@
+package ldapsync
+
+import (
+	"encoding/json"
+	"github.com/gofiber/fiber"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/common"
+	"idm/inner/web"
+	"net/http/httptest"
+	"testing"
+)
+
+type MockService struct {
+	mock.Mock
+}
+
+func (m *MockService) Sync(request Request) (Report, error) {
+	args := m.Called(request)
+	return args.Get(0).(Report), args.Error(1)
+}
+
+func TestController(t *testing.T) {
+	var a = assert.New(t)
+
+	t.Run("should run dry sync", func(t *testing.T) {
+		var svc = new(MockService)
+		var server = web.NewServer()
+		NewController(server, svc).RegisterRoutes()
+		svc.On("Sync", Request{DryRun: true}).
+			Return(Report{DryRun: true, Changes: []Change{{Kind: KindRole, Action: ActionCreate, Name: "Admins"}}}, nil)
+
+		var resp, err = server.App.Test(httptest.NewRequest(fiber.MethodPost, "/internal/ldap/sync?dry_run=true", nil))
+		a.Nil(err)
+
+		var response common.Response[Report]
+		a.Nil(json.NewDecoder(resp.Body).Decode(&response))
+		a.Equal(fiber.StatusOK, resp.StatusCode)
+		a.Len(response.Data.Changes, 1)
+	})
+
+	t.Run("should return 409 when sync is running", func(t *testing.T) {
+		var svc = new(MockService)
+		var server = web.NewServer()
+		NewController(server, svc).RegisterRoutes()
+		svc.On("Sync", Request{}).Return(Report{}, ErrRunning)
+
+		var resp, err = server.App.Test(httptest.NewRequest(fiber.MethodPost, "/internal/ldap/sync", nil))
+		a.Nil(err)
+		a.Equal(fiber.StatusConflict, resp.StatusCode)
+	})
+}
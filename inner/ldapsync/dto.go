@@ -0,0 +1,115 @@
+package ldapsync
+
+import (
+	"github.com/lib/pq"
+	"time"
+)
+
+// виды связей записей каталога
+const (
+	KindEmployee = "employee"
+	KindRole     = "role"
+)
+
+// действия синхронизации в отчёте
+const (
+	ActionCreate     = "create"
+	ActionLink       = "link"
+	ActionRename     = "rename"
+	ActionRestore    = "restore"
+	ActionSuspend    = "suspend"
+	ActionActivate   = "activate"
+	ActionDelete     = "delete"
+	ActionAddRole    = "add_role"
+	ActionRemoveRole = "remove_role"
+	// ActionSkip запись каталога не может быть перенесена, причина — в Error
+	ActionSkip = "skip"
+)
+
+// правила для сотрудников и ролей, которых больше нет в каталоге
+const (
+	MissingKeep    = "keep"
+	MissingSuspend = "suspend"
+	MissingDelete  = "delete"
+)
+
+// DirectoryUser пользователь каталога; Name проверяется по тем же правилам, что и имя сотрудника в API
+type DirectoryUser struct {
+	Dn       string
+	Id       string
+	Name     string `validate:"required,min=2,max=155"`
+	Disabled bool
+}
+
+// DirectoryGroup группа каталога; Members — DN участников
+type DirectoryGroup struct {
+	Dn      string
+	Id      string
+	Name    string `validate:"required,min=2,max=155"`
+	Members []string
+}
+
+// Snapshot пользователи и группы, прочитанные из каталога за один проход
+type Snapshot struct {
+	Users  []DirectoryUser
+	Groups []DirectoryGroup
+}
+
+// LinkEntity запись каталога, сопоставленная сотруднику или роли
+type LinkEntity struct {
+	Kind       string `db:"kind"`
+	ExternalId string `db:"external_id"`
+	LocalId    int64  `db:"local_id"`
+	Dn         string `db:"dn"`
+}
+
+// EmployeeEntity сотрудник, включая мягко удалённых, с выданными ролями
+type EmployeeEntity struct {
+	Id        int64         `db:"id"`
+	Name      string        `db:"name"`
+	Status    string        `db:"status"`
+	DeletedAt *time.Time    `db:"deleted_at"`
+	RoleIds   pq.Int64Array `db:"role_ids"`
+}
+
+// RoleEntity роль, включая мягко удалённые
+type RoleEntity struct {
+	Id        int64      `db:"id"`
+	Name      string     `db:"name"`
+	DeletedAt *time.Time `db:"deleted_at"`
+}
+
+// Change одно изменение синхронизации. Сотрудник и роль указываются по идентификатору записи каталога:
+// при создании локальный Id становится известен только после применения
+type Change struct {
+	Kind       string `json:"kind"`
+	Action     string `json:"action"`
+	ExternalId string `json:"external_id,omitempty"`
+	Dn         string `json:"dn,omitempty"`
+	Id         int64  `json:"id,omitempty"`
+	Name       string `json:"name,omitempty"`
+	// Status состояние создаваемого сотрудника
+	Status string `json:"status,omitempty"`
+	// Group идентификатор группы каталога для add_role и remove_role
+	Group    string `json:"group,omitempty"`
+	RoleId   int64  `json:"role_id,omitempty"`
+	RoleName string `json:"role_name,omitempty"`
+	// Missing записи больше нет в каталоге, изменение сделано по правилу для пропавших
+	Missing bool   `json:"missing,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Report итог синхронизации; при DryRun изменения только перечислены
+type Report struct {
+	DryRun  bool     `json:"dry_run"`
+	Users   int      `json:"users"`
+	Groups  int      `json:"groups"`
+	Applied int      `json:"applied"`
+	Failed  int      `json:"failed"`
+	Changes []Change `json:"changes"`
+}
+
+// Request параметры запуска синхронизации
+type Request struct {
+	DryRun bool `query:"dry_run"`
+}
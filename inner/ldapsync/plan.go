@@ -0,0 +1,315 @@
+package ldapsync
+
+import (
+	"idm/inner/employee"
+	"slices"
+	"strings"
+)
+
+// state сотрудники, роли и связи с каталогом на момент синхронизации
+type state struct {
+	employees map[int64]EmployeeEntity
+	roles     map[int64]RoleEntity
+	// links связи по виду и идентификатору записи каталога
+	links map[string]map[string]LinkEntity
+}
+
+func newState(employees []EmployeeEntity, roles []RoleEntity, links []LinkEntity) state {
+	s := state{
+		employees: make(map[int64]EmployeeEntity, len(employees)),
+		roles:     make(map[int64]RoleEntity, len(roles)),
+		links:     map[string]map[string]LinkEntity{KindEmployee: {}, KindRole: {}},
+	}
+	for _, entity := range employees {
+		s.employees[entity.Id] = entity
+	}
+	for _, entity := range roles {
+		s.roles[entity.Id] = entity
+	}
+	for _, link := range links {
+		s.links[link.Kind][link.ExternalId] = link
+	}
+	return s
+}
+
+// planner строит список изменений, приводящих сотрудников и роли к состоянию каталога; сам ничего не меняет.
+// Роли идут раньше сотрудников, выдача ролей — в конце, когда и те и другие уже созданы
+type planner struct {
+	config    Config
+	state     state
+	validator Validator
+	changes   []Change
+	// groupRoles локальная роль для каждой переносимой группы каталога; 0 — будет создана
+	groupRoles map[string]int64
+	// roleGroups группа каталога для каждой связанной или связываемой роли
+	roleGroups map[int64]string
+	// employeeIds локальный сотрудник для записи каталога; 0 — будет создан
+	employeeIds map[string]int64
+}
+
+func plan(config Config, snapshot Snapshot, current state, validator Validator) []Change {
+	p := &planner{
+		config:      config,
+		state:       current,
+		validator:   validator,
+		changes:     []Change{},
+		groupRoles:  map[string]int64{},
+		roleGroups:  map[int64]string{},
+		employeeIds: map[string]int64{},
+	}
+	if !config.SkipGroups {
+		p.planRoles(snapshot.Groups)
+	}
+	p.planEmployees(snapshot.Users)
+	if !config.SkipGroups {
+		p.planMemberships(snapshot.Users, snapshot.Groups)
+	}
+	return p.changes
+}
+
+// planRoles запись каталога, которую нельзя перенести, остаётся в нём, поэтому её роль не считается пропавшей
+func (p *planner) planRoles(groups []DirectoryGroup) {
+	present := map[string]bool{}
+	for _, group := range groups {
+		present[group.Id] = true
+	}
+	adoptable := p.adoptableRoles(present)
+	for _, group := range groups {
+		change := Change{Kind: KindRole, ExternalId: group.Id, Dn: group.Dn, Name: group.Name}
+		if reason := p.invalid(group.Id, group); reason != "" {
+			change.Action, change.Error = ActionSkip, reason
+			p.changes = append(p.changes, change)
+			continue
+		}
+		if link, ok := p.state.links[KindRole][group.Id]; ok {
+			if entity, exists := p.state.roles[link.LocalId]; exists {
+				p.linkRole(group.Id, entity.Id)
+				change.Id = entity.Id
+				if entity.DeletedAt != nil {
+					p.add(change, ActionRestore)
+				}
+				if entity.Name != group.Name {
+					p.add(change, ActionRename)
+				}
+				continue
+			}
+		}
+		key := strings.ToLower(group.Name)
+		if entity, ok := adoptable[key]; ok {
+			delete(adoptable, key)
+			p.linkRole(group.Id, entity.Id)
+			change.Id = entity.Id
+			p.add(change, ActionLink)
+			continue
+		}
+		p.groupRoles[group.Id] = 0
+		p.add(change, ActionCreate)
+	}
+	if p.config.MissingGroups != MissingDelete {
+		return
+	}
+	for _, link := range p.missing(KindRole, present) {
+		entity, exists := p.state.roles[link.LocalId]
+		if _, relinked := p.roleGroups[link.LocalId]; !exists || relinked || entity.DeletedAt != nil {
+			continue
+		}
+		p.add(Change{Kind: KindRole, ExternalId: link.ExternalId, Dn: link.Dn, Id: entity.Id, Name: entity.Name,
+			Missing: true}, ActionDelete)
+	}
+}
+
+func (p *planner) planEmployees(users []DirectoryUser) {
+	present := map[string]bool{}
+	for _, user := range users {
+		present[user.Id] = true
+	}
+	adoptable := p.adoptableEmployees(present)
+	linked := map[int64]bool{}
+	for _, user := range users {
+		change := Change{Kind: KindEmployee, ExternalId: user.Id, Dn: user.Dn, Name: user.Name}
+		if reason := p.invalid(user.Id, user); reason != "" {
+			change.Action, change.Error = ActionSkip, reason
+			p.changes = append(p.changes, change)
+			continue
+		}
+		if link, ok := p.state.links[KindEmployee][user.Id]; ok {
+			if entity, exists := p.state.employees[link.LocalId]; exists {
+				p.employeeIds[user.Id], linked[entity.Id] = entity.Id, true
+				change.Id = entity.Id
+				if entity.DeletedAt != nil {
+					p.add(change, ActionRestore)
+				}
+				if entity.Name != user.Name {
+					p.add(change, ActionRename)
+				}
+				p.planStatus(change, entity.Status, user.Disabled)
+				continue
+			}
+		}
+		key := strings.ToLower(user.Name)
+		if entity, ok := adoptable[key]; ok {
+			delete(adoptable, key)
+			p.employeeIds[user.Id], linked[entity.Id] = entity.Id, true
+			change.Id = entity.Id
+			p.add(change, ActionLink)
+			p.planStatus(change, entity.Status, user.Disabled)
+			continue
+		}
+		p.employeeIds[user.Id] = 0
+		// отключённый в каталоге сотрудник создаётся сразу приостановленным
+		change.Status = employee.StatusActive
+		if user.Disabled {
+			change.Status = employee.StatusSuspended
+		}
+		p.add(change, ActionCreate)
+	}
+	if p.config.MissingUsers == MissingKeep {
+		return
+	}
+	for _, link := range p.missing(KindEmployee, present) {
+		entity, exists := p.state.employees[link.LocalId]
+		if !exists || linked[entity.Id] || entity.DeletedAt != nil {
+			continue
+		}
+		change := Change{Kind: KindEmployee, ExternalId: link.ExternalId, Dn: link.Dn, Id: entity.Id, Name: entity.Name,
+			Missing: true}
+		if p.config.MissingUsers == MissingDelete {
+			p.add(change, ActionDelete)
+		} else if entity.Status == employee.StatusActive {
+			p.add(change, ActionSuspend)
+		}
+	}
+}
+
+// planStatus приостановка отключённых в каталоге и возврат включённых обратно; ожидающих выхода
+// и уволенных сотрудников каталог не меняет
+func (p *planner) planStatus(change Change, status string, disabled bool) {
+	if disabled && status == employee.StatusActive {
+		p.add(change, ActionSuspend)
+	}
+	if !disabled && status == employee.StatusSuspended {
+		p.add(change, ActionActivate)
+	}
+}
+
+// planMemberships выдача сотрудникам ролей групп, в которых они состоят, и отзыв ролей групп,
+// из которых их исключили; роли, не связанные с каталогом, не затрагиваются
+func (p *planner) planMemberships(users []DirectoryUser, groups []DirectoryGroup) {
+	userIds := map[string]string{}
+	for _, user := range users {
+		if _, ok := p.employeeIds[user.Id]; ok {
+			userIds[normalizeDn(user.Dn)] = user.Id
+		}
+	}
+	desired := map[string][]DirectoryGroup{}
+	for _, group := range groups {
+		if _, ok := p.groupRoles[group.Id]; !ok {
+			continue
+		}
+		for _, member := range group.Members {
+			if userId, ok := userIds[normalizeDn(member)]; ok {
+				desired[userId] = append(desired[userId], group)
+			}
+		}
+	}
+	for _, user := range users {
+		employeeId, ok := p.employeeIds[user.Id]
+		if !ok {
+			continue
+		}
+		entity := p.state.employees[employeeId]
+		if entity.Status == employee.StatusTerminated {
+			continue
+		}
+		current := map[string]bool{}
+		for _, roleId := range entity.RoleIds {
+			if groupId, managed := p.roleGroups[roleId]; managed {
+				current[groupId] = true
+			}
+		}
+		change := Change{Kind: KindEmployee, ExternalId: user.Id, Dn: user.Dn, Id: employeeId, Name: user.Name}
+		for _, group := range desired[user.Id] {
+			if current[group.Id] {
+				delete(current, group.Id)
+				continue
+			}
+			change.Group, change.RoleId, change.RoleName = group.Id, p.groupRoles[group.Id], group.Name
+			p.add(change, ActionAddRole)
+		}
+		for _, roleId := range entity.RoleIds {
+			groupId, managed := p.roleGroups[roleId]
+			if managed && current[groupId] {
+				change.Group, change.RoleId, change.RoleName = groupId, roleId, p.state.roles[roleId].Name
+				p.add(change, ActionRemoveRole)
+			}
+		}
+	}
+}
+
+func (p *planner) linkRole(groupId string, roleId int64) {
+	p.groupRoles[groupId] = roleId
+	p.roleGroups[roleId] = groupId
+}
+
+// adoptableRoles роли, которые можно связать с группой каталога по названию: не удалённые и не связанные
+// с другой записью каталога, которая в нём ещё есть
+func (p *planner) adoptableRoles(present map[string]bool) map[string]RoleEntity {
+	taken := p.taken(KindRole, present)
+	adoptable := map[string]RoleEntity{}
+	for _, entity := range p.state.roles {
+		if entity.DeletedAt == nil && !taken[entity.Id] {
+			adoptable[strings.ToLower(entity.Name)] = entity
+		}
+	}
+	return adoptable
+}
+
+// adoptableEmployees сотрудники, которых можно связать с пользователем каталога по имени
+func (p *planner) adoptableEmployees(present map[string]bool) map[string]EmployeeEntity {
+	taken := p.taken(KindEmployee, present)
+	adoptable := map[string]EmployeeEntity{}
+	for _, entity := range p.state.employees {
+		if entity.DeletedAt == nil && !taken[entity.Id] {
+			adoptable[strings.ToLower(entity.Name)] = entity
+		}
+	}
+	return adoptable
+}
+
+func (p *planner) taken(kind string, present map[string]bool) map[int64]bool {
+	taken := map[int64]bool{}
+	for externalId, link := range p.state.links[kind] {
+		if present[externalId] {
+			taken[link.LocalId] = true
+		}
+	}
+	return taken
+}
+
+// missing связи с записями, которых больше нет в каталоге, по порядку идентификаторов
+func (p *planner) missing(kind string, present map[string]bool) []LinkEntity {
+	var links []LinkEntity
+	for externalId, link := range p.state.links[kind] {
+		if !present[externalId] {
+			links = append(links, link)
+		}
+	}
+	slices.SortFunc(links, func(a, b LinkEntity) int { return strings.Compare(a.ExternalId, b.ExternalId) })
+	return links
+}
+
+// invalid причина, по которой запись каталога не переносится, или пустая строка
+func (p *planner) invalid(id string, entry any) string {
+	if id == "" {
+		return "entry has no id attribute"
+	}
+	if err := p.validator.Validate(entry); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func (p *planner) add(change Change, action string) {
+	change.Action = action
+	p.changes = append(p.changes, change)
+}
@@ -0,0 +1,122 @@
+package ldapsync
+
+import (
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"idm/inner/employee"
+	"idm/inner/validator"
+	"testing"
+	"time"
+)
+
+func TestPlan(t *testing.T) {
+	var a = assert.New(t)
+	var config = testConfig("ldap://localhost")
+	var deletedAt = time.Now()
+	var alice = DirectoryUser{Dn: "uid=alice,ou=people,dc=example,dc=com", Id: "u-alice", Name: "Alice Smith"}
+	var admins = DirectoryGroup{Dn: "cn=admins,dc=example,dc=com", Id: "g-admins", Name: "Admins",
+		Members: []string{"uid=alice,ou=people,dc=example,dc=com"}}
+
+	t.Run("should create missing roles and employees and grant roles", func(t *testing.T) {
+		var changes = plan(config, Snapshot{Users: []DirectoryUser{alice}, Groups: []DirectoryGroup{admins}},
+			newState(nil, nil, nil), validator.New())
+
+		a.Equal([]Change{
+			{Kind: KindRole, Action: ActionCreate, ExternalId: "g-admins", Dn: admins.Dn, Name: "Admins"},
+			{Kind: KindEmployee, Action: ActionCreate, ExternalId: "u-alice", Dn: alice.Dn, Name: "Alice Smith",
+				Status: employee.StatusActive},
+			{Kind: KindEmployee, Action: ActionAddRole, ExternalId: "u-alice", Dn: alice.Dn, Name: "Alice Smith",
+				Group: "g-admins", RoleName: "Admins"},
+		}, changes)
+	})
+
+	t.Run("should link existing employee and role by name", func(t *testing.T) {
+		var state = newState(
+			[]EmployeeEntity{{Id: 7, Name: "alice smith", Status: employee.StatusActive, RoleIds: pq.Int64Array{3}}},
+			[]RoleEntity{{Id: 3, Name: "ADMINS"}}, nil)
+
+		var changes = plan(config, Snapshot{Users: []DirectoryUser{alice}, Groups: []DirectoryGroup{admins}}, state, validator.New())
+
+		a.Equal([]Change{
+			{Kind: KindRole, Action: ActionLink, ExternalId: "g-admins", Dn: admins.Dn, Id: 3, Name: "Admins"},
+			{Kind: KindEmployee, Action: ActionLink, ExternalId: "u-alice", Dn: alice.Dn, Id: 7, Name: "Alice Smith"},
+		}, changes)
+	})
+
+	t.Run("should rename, restore and suspend linked employee", func(t *testing.T) {
+		var disabled = alice
+		disabled.Disabled = true
+		var state = newState(
+			[]EmployeeEntity{{Id: 7, Name: "Alice Brown", Status: employee.StatusActive, DeletedAt: &deletedAt}}, nil,
+			[]LinkEntity{{Kind: KindEmployee, ExternalId: "u-alice", LocalId: 7}})
+
+		var changes = plan(config, Snapshot{Users: []DirectoryUser{disabled}}, state, validator.New())
+
+		var actions []string
+		for _, change := range changes {
+			actions = append(actions, change.Action)
+		}
+		a.Equal([]string{ActionRestore, ActionRename, ActionSuspend}, actions)
+	})
+
+	t.Run("should apply policy to employees missing from directory", func(t *testing.T) {
+		var state = newState(
+			[]EmployeeEntity{{Id: 7, Name: "Alice Smith", Status: employee.StatusActive},
+				{Id: 8, Name: "Bob Jones", Status: employee.StatusActive},
+				{Id: 9, Name: "Carol White", Status: employee.StatusTerminated}}, nil,
+			[]LinkEntity{{Kind: KindEmployee, ExternalId: "u-alice", LocalId: 7},
+				{Kind: KindEmployee, ExternalId: "u-bob", LocalId: 8},
+				{Kind: KindEmployee, ExternalId: "u-carol", LocalId: 9}})
+		var snapshot = Snapshot{Users: []DirectoryUser{alice}}
+
+		a.Equal([]Change{{Kind: KindEmployee, Action: ActionSuspend, ExternalId: "u-bob", Id: 8, Name: "Bob Jones", Missing: true}},
+			plan(config, snapshot, state, validator.New()))
+
+		var deleting = config
+		deleting.MissingUsers = MissingDelete
+		var changes = plan(deleting, snapshot, state, validator.New())
+		a.Len(changes, 2)
+		a.Equal(ActionDelete, changes[0].Action)
+		a.Equal(int64(9), changes[1].Id)
+
+		var keeping = config
+		keeping.MissingUsers = MissingKeep
+		a.Empty(plan(keeping, snapshot, state, validator.New()))
+	})
+
+	t.Run("should relink employee when directory entry was recreated", func(t *testing.T) {
+		var state = newState([]EmployeeEntity{{Id: 7, Name: "Alice Smith", Status: employee.StatusActive}}, nil,
+			[]LinkEntity{{Kind: KindEmployee, ExternalId: "u-old", LocalId: 7}})
+
+		var changes = plan(config, Snapshot{Users: []DirectoryUser{alice}}, state, validator.New())
+
+		a.Equal([]Change{{Kind: KindEmployee, Action: ActionLink, ExternalId: "u-alice", Dn: alice.Dn, Id: 7, Name: "Alice Smith"}}, changes)
+	})
+
+	t.Run("should revoke only roles of directory groups", func(t *testing.T) {
+		var state = newState(
+			[]EmployeeEntity{{Id: 7, Name: "Alice Smith", Status: employee.StatusActive, RoleIds: pq.Int64Array{3, 4, 5}}},
+			[]RoleEntity{{Id: 3, Name: "Admins"}, {Id: 4, Name: "Developers"}, {Id: 5, Name: "Local"}},
+			[]LinkEntity{{Kind: KindEmployee, ExternalId: "u-alice", LocalId: 7},
+				{Kind: KindRole, ExternalId: "g-admins", LocalId: 3},
+				{Kind: KindRole, ExternalId: "g-developers", LocalId: 4}})
+		var developers = DirectoryGroup{Id: "g-developers", Name: "Developers"}
+
+		var changes = plan(config, Snapshot{Users: []DirectoryUser{alice}, Groups: []DirectoryGroup{admins, developers}},
+			state, validator.New())
+
+		a.Equal([]Change{{Kind: KindEmployee, Action: ActionRemoveRole, ExternalId: "u-alice", Dn: alice.Dn, Id: 7,
+			Name: "Alice Smith", Group: "g-developers", RoleId: 4, RoleName: "Developers"}}, changes)
+	})
+
+	t.Run("should skip entries without id or with invalid name", func(t *testing.T) {
+		var changes = plan(config, Snapshot{Users: []DirectoryUser{{Dn: "uid=x", Name: "X"}, {Dn: "uid=y", Id: "u-y", Name: "Y"}}},
+			newState(nil, nil, nil), validator.New())
+
+		a.Len(changes, 2)
+		a.Equal(ActionSkip, changes[0].Action)
+		a.Equal("entry has no id attribute", changes[0].Error)
+		a.Equal(ActionSkip, changes[1].Action)
+		a.NotEmpty(changes[1].Error)
+	})
+}
@@ -0,0 +1,60 @@
+package ldapsync
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+type Repository struct {
+	db *sqlx.DB
+}
+
+func NewLdapSyncRepository(dataBase *sqlx.DB) *Repository {
+	return &Repository{db: dataBase}
+}
+
+func (repo *Repository) FindLinks() (links []LinkEntity, err error) {
+	links = []LinkEntity{}
+	err = repo.db.Select(&links, "SELECT kind, external_id, local_id, dn FROM ldap_link ORDER BY kind, external_id")
+	return links, err
+}
+
+// SaveLink связь записи каталога с сотрудником или ролью; прежняя связь этого сотрудника или роли
+// с другой записью удаляется — например, когда пользователя пересоздали в каталоге
+func (repo *Repository) SaveLink(link LinkEntity) (err error) {
+	tx, err := repo.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+	_, err = tx.Exec("DELETE FROM ldap_link WHERE kind = $1 AND local_id = $2 AND external_id <> $3",
+		link.Kind, link.LocalId, link.ExternalId)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO ldap_link (kind, external_id, local_id, dn) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (kind, external_id) DO UPDATE SET local_id = excluded.local_id, dn = excluded.dn, updated_at = now()`,
+		link.Kind, link.ExternalId, link.LocalId, link.Dn)
+	return err
+}
+
+// FindEmployees все сотрудники, включая мягко удалённых, с выданными ролями по порядку id
+func (repo *Repository) FindEmployees() (employees []EmployeeEntity, err error) {
+	employees = []EmployeeEntity{}
+	err = repo.db.Select(&employees, `SELECT e.id, e.name, e.status, e.deleted_at,
+			array(SELECT er.role_id FROM employee_role er WHERE er.employee_id = e.id ORDER BY er.role_id) AS role_ids
+		FROM employee e ORDER BY e.id`)
+	return employees, err
+}
+
+// FindRoles все роли, включая мягко удалённые
+func (repo *Repository) FindRoles() (roles []RoleEntity, err error) {
+	roles = []RoleEntity{}
+	err = repo.db.Select(&roles, "SELECT id, name, deleted_at FROM role ORDER BY id")
+	return roles, err
+}
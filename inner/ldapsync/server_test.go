@@ -0,0 +1,154 @@
+package ldapsync
+
+import (
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"net"
+	"strings"
+	"testing"
+)
+
+// testEntry запись каталога в памяти
+type testEntry struct {
+	dn         string
+	attributes map[string][]string
+}
+
+// ldapServer заменитель сервера LDAP для тестов: простая привязка, поиск в поддереве с фильтрами
+// and, or, not, равенства и присутствия; постраничный поиск не поддерживает и отдаёт всё сразу
+type ldapServer struct {
+	listener net.Listener
+	bindDn   string
+	password string
+	entries  []testEntry
+}
+
+func newLdapServer(t *testing.T, bindDn string, password string, entries ...testEntry) *ldapServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &ldapServer{listener: listener, bindDn: bindDn, password: password, entries: entries}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *ldapServer) url() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *ldapServer) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			code := ldap.LDAPResultSuccess
+			if op.Children[1].Data.String() != s.bindDn || op.Children[2].Data.String() != s.password {
+				code = ldap.LDAPResultInvalidCredentials
+			}
+			_, _ = conn.Write(message(id, result(ldap.ApplicationBindResponse, code)).Bytes())
+		case ldap.ApplicationSearchRequest:
+			base := strings.ToLower(op.Children[0].Data.String())
+			var attributes []string
+			for _, attribute := range op.Children[7].Children {
+				attributes = append(attributes, attribute.Data.String())
+			}
+			for _, entry := range s.entries {
+				if strings.HasSuffix(strings.ToLower(entry.dn), base) && matches(op.Children[6], entry) {
+					_, _ = conn.Write(message(id, searchEntry(entry, attributes)).Bytes())
+				}
+			}
+			_, _ = conn.Write(message(id, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess)).Bytes())
+		default:
+			return
+		}
+	}
+}
+
+func matches(filter *ber.Packet, entry testEntry) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !matches(child, entry) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if matches(child, entry) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !matches(filter.Children[0], entry)
+	case ldap.FilterEqualityMatch:
+		for _, value := range values(entry, filter.Children[0].Data.String()) {
+			if strings.EqualFold(value, filter.Children[1].Data.String()) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterPresent:
+		return len(values(entry, filter.Data.String())) > 0
+	}
+	return false
+}
+
+func values(entry testEntry, attribute string) []string {
+	for name, values := range entry.attributes {
+		if strings.EqualFold(name, attribute) {
+			return values
+		}
+	}
+	return nil
+}
+
+func message(id int64, op *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+	packet.AppendChild(op)
+	return packet
+}
+
+func result(tag ber.Tag, code int) *ber.Packet {
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), ""))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return packet
+}
+
+func searchEntry(entry testEntry, attributes []string) *ber.Packet {
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, ""))
+	list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	for _, name := range attributes {
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+		for _, value := range values(entry, name) {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, ""))
+		}
+		attribute.AppendChild(set)
+		list.AppendChild(attribute)
+	}
+	packet.AppendChild(list)
+	return packet
+}
@@ -0,0 +1,243 @@
+package ldapsync
+
+import (
+	"errors"
+	"fmt"
+	"idm/inner/audit"
+	"idm/inner/employee"
+	"idm/inner/role"
+	"sync"
+	"time"
+)
+
+// actor от чьего имени синхронизация пишет изменения в журнал аудита
+var actor = audit.Actor{Subject: "ldap-sync"}
+
+// причины смены состояния сотрудника в истории
+const (
+	reasonDisabled = "disabled in LDAP"
+	reasonEnabled  = "enabled in LDAP"
+	reasonMissing  = "removed from LDAP"
+)
+
+// ErrRunning синхронизация уже выполняется
+var ErrRunning = errors.New("ldap sync is already running")
+
+type Service struct {
+	repo      Repo
+	directory Directory
+	employees Employees
+	roles     Roles
+	validator Validator
+	config    Config
+	running   sync.Mutex
+}
+
+func NewService(repo Repo, directory Directory, employees Employees, roles Roles, validator Validator,
+	config Config) *Service {
+	return &Service{
+		repo:      repo,
+		directory: directory,
+		employees: employees,
+		roles:     roles,
+		validator: validator,
+		config:    config,
+	}
+}
+
+type Repo interface {
+	FindLinks() ([]LinkEntity, error)
+	SaveLink(link LinkEntity) error
+	FindEmployees() ([]EmployeeEntity, error)
+	FindRoles() ([]RoleEntity, error)
+}
+
+// Directory источник пользователей и групп, реализуется Client
+type Directory interface {
+	Read() (Snapshot, error)
+}
+
+// Employees изменения сотрудников, реализуется employee.Service: проверки, история состояний и аудит общие с API
+type Employees interface {
+	SaveTx(actor audit.Actor, entity employee.Entity) (int64, error)
+	PatchEmployee(actor audit.Actor, id int64, request employee.PatchRequest) (employee.Response, error)
+	ChangeStatus(actor audit.Actor, id int64, request employee.StatusRequest) (employee.Response, error)
+	Delete(actor audit.Actor, id int64) error
+	Restore(actor audit.Actor, id int64) (employee.Response, error)
+	AddRole(actor audit.Actor, id int64, roleId int64) error
+	RemoveRole(actor audit.Actor, id int64, roleId int64) error
+}
+
+// Roles изменения ролей, реализуется role.Service
+type Roles interface {
+	SaveTx(actor audit.Actor, name string, parentIds []int64) (int64, error)
+	UpdateRole(actor audit.Actor, id int64, request role.UpdateRequest) (role.Response, error)
+	Delete(actor audit.Actor, id int64) error
+	Restore(actor audit.Actor, id int64) (role.Response, error)
+}
+
+// Sync приводит сотрудников и роли к состоянию каталога. Изменения применяются по одному через сервисы
+// сотрудников и ролей; ошибка одного изменения записывается в отчёт и не останавливает остальные
+func (service *Service) Sync(request Request) (report Report, err error) {
+	if !service.running.TryLock() {
+		return Report{}, ErrRunning
+	}
+	defer service.running.Unlock()
+
+	snapshot, err := service.directory.Read()
+	if err != nil {
+		return Report{}, err
+	}
+	links, err := service.repo.FindLinks()
+	if err != nil {
+		return Report{}, fmt.Errorf("error finding ldap links: %w", err)
+	}
+	if err = service.checkSnapshot(snapshot, links); err != nil {
+		return Report{}, err
+	}
+	employees, err := service.repo.FindEmployees()
+	if err != nil {
+		return Report{}, fmt.Errorf("error finding employees: %w", err)
+	}
+	roles, err := service.repo.FindRoles()
+	if err != nil {
+		return Report{}, fmt.Errorf("error finding roles: %w", err)
+	}
+
+	report = Report{
+		DryRun:  request.DryRun,
+		Users:   len(snapshot.Users),
+		Groups:  len(snapshot.Groups),
+		Changes: plan(service.config, snapshot, newState(employees, roles, links), service.validator),
+	}
+	if request.DryRun {
+		return report, nil
+	}
+	ids := map[string]map[string]int64{KindEmployee: {}, KindRole: {}}
+	for _, link := range links {
+		ids[link.Kind][link.ExternalId] = link.LocalId
+	}
+	for i := range report.Changes {
+		change := &report.Changes[i]
+		if change.Action == ActionSkip {
+			continue
+		}
+		if err := service.apply(change, ids); err != nil {
+			change.Error = err.Error()
+			report.Failed++
+			continue
+		}
+		report.Applied++
+	}
+	return report, nil
+}
+
+// Run синхронизация каждые interval, пока не закрыт stop
+func (service *Service) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		report, err := service.Sync(Request{})
+		if err != nil {
+			fmt.Printf("ldap sync error: %v\n", err)
+		} else if report.Failed > 0 {
+			fmt.Printf("ldap sync: %d of %d changes failed\n", report.Failed, report.Applied+report.Failed)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkSnapshot пустой ответ каталога при уже связанных записях — скорее ошибка фильтра или прав,
+// чем увольнение всех сразу, поэтому правило для пропавших записей в этом случае не применяется
+func (service *Service) checkSnapshot(snapshot Snapshot, links []LinkEntity) error {
+	for _, link := range links {
+		if link.Kind == KindEmployee && len(snapshot.Users) == 0 && service.config.MissingUsers != MissingKeep {
+			return errors.New("ldap returned no users while employees are linked; check users filter")
+		}
+		if link.Kind == KindRole && len(snapshot.Groups) == 0 && !service.config.SkipGroups &&
+			service.config.MissingGroups != MissingKeep {
+			return errors.New("ldap returned no groups while roles are linked; check groups filter")
+		}
+	}
+	return nil
+}
+
+// apply применение одного изменения; созданные сотрудники и роли сразу связываются с записями каталога,
+// чтобы следующие изменения и следующий запуск находили их по связи
+func (service *Service) apply(change *Change, ids map[string]map[string]int64) (err error) {
+	if change.Id == 0 {
+		change.Id = ids[change.Kind][change.ExternalId]
+	}
+	if change.Kind == KindRole {
+		return service.applyRole(change, ids)
+	}
+	switch change.Action {
+	case ActionCreate:
+		change.Id, err = service.employees.SaveTx(actor, employee.Entity{Name: change.Name, Status: change.Status})
+		if err == nil {
+			err = service.link(change, ids)
+		}
+	case ActionLink:
+		err = service.link(change, ids)
+	case ActionRename:
+		_, err = service.employees.PatchEmployee(actor, change.Id, employee.PatchRequest{Name: &change.Name})
+	case ActionRestore:
+		_, err = service.employees.Restore(actor, change.Id)
+	case ActionSuspend:
+		reason := reasonDisabled
+		if change.Missing {
+			reason = reasonMissing
+		}
+		_, err = service.employees.ChangeStatus(actor, change.Id,
+			employee.StatusRequest{Status: employee.StatusSuspended, Reason: reason})
+	case ActionActivate:
+		_, err = service.employees.ChangeStatus(actor, change.Id,
+			employee.StatusRequest{Status: employee.StatusActive, Reason: reasonEnabled})
+	case ActionDelete:
+		err = service.employees.Delete(actor, change.Id)
+	case ActionAddRole, ActionRemoveRole:
+		if change.RoleId == 0 {
+			change.RoleId = ids[KindRole][change.Group]
+		}
+		if change.Id == 0 || change.RoleId == 0 {
+			return errors.New("employee or role was not created")
+		}
+		if change.Action == ActionAddRole {
+			return service.employees.AddRole(actor, change.Id, change.RoleId)
+		}
+		return service.employees.RemoveRole(actor, change.Id, change.RoleId)
+	}
+	return err
+}
+
+func (service *Service) applyRole(change *Change, ids map[string]map[string]int64) (err error) {
+	switch change.Action {
+	case ActionCreate:
+		change.Id, err = service.roles.SaveTx(actor, change.Name, nil)
+		if err == nil {
+			err = service.link(change, ids)
+		}
+	case ActionLink:
+		err = service.link(change, ids)
+	case ActionRename:
+		_, err = service.roles.UpdateRole(actor, change.Id, role.UpdateRequest{Name: change.Name})
+	case ActionRestore:
+		_, err = service.roles.Restore(actor, change.Id)
+	case ActionDelete:
+		err = service.roles.Delete(actor, change.Id)
+	}
+	return err
+}
+
+func (service *Service) link(change *Change, ids map[string]map[string]int64) error {
+	err := service.repo.SaveLink(LinkEntity{Kind: change.Kind, ExternalId: change.ExternalId, LocalId: change.Id, Dn: change.Dn})
+	if err != nil {
+		return fmt.Errorf("error saving ldap link: %w", err)
+	}
+	ids[change.Kind][change.ExternalId] = change.Id
+	return nil
+}
@@ -0,0 +1,196 @@
+package ldapsync
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/audit"
+	"idm/inner/common"
+	"idm/inner/employee"
+	"idm/inner/role"
+	"idm/inner/validator"
+	"testing"
+)
+
+type MockRepo struct {
+	mock.Mock
+}
+
+func (m *MockRepo) FindLinks() ([]LinkEntity, error) {
+	args := m.Called()
+	return args.Get(0).([]LinkEntity), args.Error(1)
+}
+
+func (m *MockRepo) SaveLink(link LinkEntity) error {
+	return m.Called(link).Error(0)
+}
+
+func (m *MockRepo) FindEmployees() ([]EmployeeEntity, error) {
+	args := m.Called()
+	return args.Get(0).([]EmployeeEntity), args.Error(1)
+}
+
+func (m *MockRepo) FindRoles() ([]RoleEntity, error) {
+	args := m.Called()
+	return args.Get(0).([]RoleEntity), args.Error(1)
+}
+
+type MockEmployees struct {
+	mock.Mock
+}
+
+func (m *MockEmployees) SaveTx(actor audit.Actor, entity employee.Entity) (int64, error) {
+	args := m.Called(actor, entity)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockEmployees) PatchEmployee(actor audit.Actor, id int64, request employee.PatchRequest) (employee.Response, error) {
+	args := m.Called(actor, id, request)
+	return args.Get(0).(employee.Response), args.Error(1)
+}
+
+func (m *MockEmployees) ChangeStatus(actor audit.Actor, id int64, request employee.StatusRequest) (employee.Response, error) {
+	args := m.Called(actor, id, request)
+	return args.Get(0).(employee.Response), args.Error(1)
+}
+
+func (m *MockEmployees) Delete(actor audit.Actor, id int64) error {
+	return m.Called(actor, id).Error(0)
+}
+
+func (m *MockEmployees) Restore(actor audit.Actor, id int64) (employee.Response, error) {
+	args := m.Called(actor, id)
+	return args.Get(0).(employee.Response), args.Error(1)
+}
+
+func (m *MockEmployees) AddRole(actor audit.Actor, id int64, roleId int64) error {
+	return m.Called(actor, id, roleId).Error(0)
+}
+
+func (m *MockEmployees) RemoveRole(actor audit.Actor, id int64, roleId int64) error {
+	return m.Called(actor, id, roleId).Error(0)
+}
+
+type MockRoles struct {
+	mock.Mock
+}
+
+func (m *MockRoles) SaveTx(actor audit.Actor, name string, parentIds []int64) (int64, error) {
+	args := m.Called(actor, name, parentIds)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRoles) UpdateRole(actor audit.Actor, id int64, request role.UpdateRequest) (role.Response, error) {
+	args := m.Called(actor, id, request)
+	return args.Get(0).(role.Response), args.Error(1)
+}
+
+func (m *MockRoles) Delete(actor audit.Actor, id int64) error {
+	return m.Called(actor, id).Error(0)
+}
+
+func (m *MockRoles) Restore(actor audit.Actor, id int64) (role.Response, error) {
+	args := m.Called(actor, id)
+	return args.Get(0).(role.Response), args.Error(1)
+}
+
+func TestServiceSync(t *testing.T) {
+	var a = assert.New(t)
+	var server = newLdapServer(t, "cn=sync,dc=example,dc=com", "secret", testEntries...)
+	var config = testConfig(server.url())
+	var newService = func(repo *MockRepo, employees *MockEmployees, roles *MockRoles) *Service {
+		return NewService(repo, NewClient(config), employees, roles, validator.New(), config)
+	}
+
+	t.Run("should list changes without applying on dry run", func(t *testing.T) {
+		var repo, employees, roles = new(MockRepo), new(MockEmployees), new(MockRoles)
+		repo.On("FindLinks").Return([]LinkEntity{}, nil)
+		repo.On("FindEmployees").Return([]EmployeeEntity{}, nil)
+		repo.On("FindRoles").Return([]RoleEntity{}, nil)
+
+		var report, err = newService(repo, employees, roles).Sync(Request{DryRun: true})
+
+		a.Nil(err)
+		a.True(report.DryRun)
+		a.Equal(2, report.Users)
+		a.Equal(1, report.Groups)
+		a.Len(report.Changes, 4)
+		a.Equal(0, report.Applied)
+		employees.AssertNotCalled(t, "SaveTx", mock.Anything, mock.Anything)
+		roles.AssertNotCalled(t, "SaveTx", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("should create linked records and grant roles of created groups", func(t *testing.T) {
+		var repo, employees, roles = new(MockRepo), new(MockEmployees), new(MockRoles)
+		repo.On("FindLinks").Return([]LinkEntity{}, nil)
+		repo.On("FindEmployees").Return([]EmployeeEntity{}, nil)
+		repo.On("FindRoles").Return([]RoleEntity{}, nil)
+		roles.On("SaveTx", actor, "Admins", []int64(nil)).Return(int64(3), nil)
+		repo.On("SaveLink", LinkEntity{Kind: KindRole, ExternalId: "g-admins", LocalId: 3, Dn: "cn=admins,ou=groups,dc=example,dc=com"}).Return(nil)
+		employees.On("SaveTx", actor, employee.Entity{Name: "Alice Smith", Status: employee.StatusActive}).Return(int64(7), nil)
+		repo.On("SaveLink", LinkEntity{Kind: KindEmployee, ExternalId: "u-alice", LocalId: 7, Dn: "uid=alice,ou=people,dc=example,dc=com"}).Return(nil)
+		employees.On("SaveTx", actor, employee.Entity{Name: "Bob Jones", Status: employee.StatusSuspended}).
+			Return(int64(0), common.AlreadyExistsError{Resource: "employee", ID: "Bob Jones"})
+		employees.On("AddRole", actor, int64(7), int64(3)).Return(nil)
+
+		var report, err = newService(repo, employees, roles).Sync(Request{})
+
+		a.Nil(err)
+		a.Equal(3, report.Applied)
+		a.Equal(1, report.Failed)
+		a.Equal(int64(7), report.Changes[3].Id)
+		a.Equal(int64(3), report.Changes[3].RoleId)
+		a.NotEmpty(report.Changes[2].Error)
+		repo.AssertExpectations(t)
+		employees.AssertExpectations(t)
+	})
+
+	t.Run("should refuse to apply missing policy when directory returns no users", func(t *testing.T) {
+		var repo, employees, roles = new(MockRepo), new(MockEmployees), new(MockRoles)
+		var empty = config
+		empty.Users.Filter = "(objectClass=nobody)"
+		var service = NewService(repo, NewClient(empty), employees, roles, validator.New(), empty)
+		repo.On("FindLinks").Return([]LinkEntity{{Kind: KindEmployee, ExternalId: "u-alice", LocalId: 7}}, nil)
+
+		var _, err = service.Sync(Request{})
+
+		a.ErrorContains(err, "ldap returned no users")
+		employees.AssertNotCalled(t, "ChangeStatus", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("should suspend missing employee with reason", func(t *testing.T) {
+		var repo, employees, roles = new(MockRepo), new(MockEmployees), new(MockRoles)
+		var withoutGroups = config
+		withoutGroups.SkipGroups = true
+		var service = NewService(repo, NewClient(withoutGroups), employees, roles, validator.New(), withoutGroups)
+		repo.On("FindLinks").Return([]LinkEntity{
+			{Kind: KindEmployee, ExternalId: "u-alice", LocalId: 7},
+			{Kind: KindEmployee, ExternalId: "u-bob", LocalId: 8},
+			{Kind: KindEmployee, ExternalId: "u-gone", LocalId: 9},
+		}, nil)
+		repo.On("FindEmployees").Return([]EmployeeEntity{
+			{Id: 7, Name: "Alice Smith", Status: employee.StatusActive},
+			{Id: 8, Name: "Bob Jones", Status: employee.StatusSuspended},
+			{Id: 9, Name: "Gone Away", Status: employee.StatusActive},
+		}, nil)
+		repo.On("FindRoles").Return([]RoleEntity{}, nil)
+		employees.On("ChangeStatus", actor, int64(9), employee.StatusRequest{Status: employee.StatusSuspended, Reason: reasonMissing}).
+			Return(employee.Response{}, nil)
+
+		var report, err = service.Sync(Request{})
+
+		a.Nil(err)
+		a.Equal(1, report.Applied)
+		employees.AssertExpectations(t)
+	})
+
+	t.Run("should not run twice at once", func(t *testing.T) {
+		var service = newService(new(MockRepo), new(MockEmployees), new(MockRoles))
+		service.running.Lock()
+		defer service.running.Unlock()
+
+		var _, err = service.Sync(Request{})
+
+		a.True(errors.Is(err, ErrRunning))
+	})
+}
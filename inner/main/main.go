@@ -1,15 +1,30 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
 	"github.com/jmoiron/sqlx"
+	"idm/inner/apikey"
+	"idm/inner/audit"
+	"idm/inner/auth"
+	"idm/inner/authz"
 	"idm/inner/common"
 	"idm/inner/database"
 	"idm/inner/employee"
+	"idm/inner/importer"
 	"idm/inner/info"
+	"idm/inner/ldapserver"
+	"idm/inner/ldapsync"
+	"idm/inner/outbox"
+	"idm/inner/permission"
+	"idm/inner/provisioning"
+	"idm/inner/recorders"
 	"idm/inner/role"
+	"idm/inner/scim"
+	"idm/inner/token"
 	"idm/inner/validator"
 	"idm/inner/web"
+	"idm/inner/webhook"
 )
 
 var cfg = common.GetConfig(".env")
@@ -24,6 +39,14 @@ func main() {
 		}
 	}()
 	var server = build(dbWithCfg)
+	if server.InternalApp != nil {
+		// /internal слушает свой адрес, недоступный через публичный ingress
+		go func() {
+			if err := server.InternalApp.Listen(server.InternalAddress); err != nil {
+				panic(fmt.Sprintf("internal http server error: %s", err))
+			}
+		}()
+	}
 	var err = server.App.Listen(":8080")
 	if err != nil {
 		panic(fmt.Sprintf("http server error: %s", err))
@@ -31,20 +54,133 @@ func main() {
 }
 
 func build(db *sqlx.DB) *web.Server {
-	server := web.NewServer()
+	server, err := web.NewServerWithConfig(cfg)
+	if err != nil {
+		panic(fmt.Sprintf("internal routes configuration error: %s", err))
+	}
+	tokenRepo := token.NewTokenRepository(db)
+	keyStore := token.NewKeyStore(tokenRepo, cfg.JwtTokenTtl, cfg.JwtKeyRotation)
 	validate := validator.New()
+	apiKeyRepo := apikey.NewApiKeyRepository(db)
+	apiKeyService := apikey.NewService(apiKeyRepo, validate)
+	// аутентификация ставится на группу до регистрации маршрутов, иначе маршруты её обойдут;
+	// кроме внешних токенов принимаются токены, выданные самим сервисом, и API-ключи
+	authenticator, err := auth.NewAuthenticator(cfg, keyStore, apiKeyService)
+	if err != nil {
+		panic(fmt.Sprintf("auth configuration error: %s", err))
+	}
+	server.GroupApiV1.Use(authenticator.Middleware())
+	server.GroupScim.Use(authenticator.Middleware())
 	employeeRepo := employee.NewEmployeeRepository(db)
-	employeeService := employee.NewService(employeeRepo, validate)
+	roleRepo := role.NewRoleRepository(db)
+	// права на маршрутах проверяются по ролям вызывающего, включая унаследованные
+	authzService := authz.NewService(employeeRepo, roleRepo, tokenRepo, validate)
+	server.Authorizer = auth.NewGuard(authzService)
+
+	// изменения сотрудников, ролей и прав в той же транзакции пишутся в журнал аудита, ставятся в очередь
+	// передачи во внешние SCIM-системы, сохраняются для веб-хуков и записываются в outbox
+	changes, err := recorders.NewServices(db, cfg, validate)
+	if err != nil {
+		panic(err.Error())
+	}
+	auditor := changes.Recorders()
+	employeeService := employee.NewService(employeeRepo, roleRepo, validate, auditor, cfg.PurgeRetention)
 	employeeController := employee.NewController(server, employeeService)
 	employeeController.RegisterRoutes()
 
 	connectionService := info.NewConnectionService()
-	roleRepo := role.NewRoleRepository(db)
-	roleService := role.NewService(roleRepo, validate)
+	roleService := role.NewService(roleRepo, validate, auditor, cfg.PurgeRetention)
 	roleController := role.NewController(server, roleService)
 	roleController.RegisterRoutes()
 
+	// импорт создаёт записи через сервисы сотрудников и ролей, поэтому проверки и аудит у них общие
+	importService := importer.NewService(importer.NewImportRepository(db), employeeService, roleService, validate)
+	importController := importer.NewController(server, importService)
+	importController.RegisterRoutes()
+
+	// каталог LDAP переносится через те же сервисы, поэтому изменения попадают в аудит и исходящую синхронизацию
+	ldapConfig, err := ldapsync.LoadConfig(cfg.LdapSyncFile, validate)
+	if err != nil {
+		panic(fmt.Sprintf("ldap sync configuration error: %s", err))
+	}
+	if ldapConfig != nil {
+		ldapSyncService := ldapsync.NewService(ldapsync.NewLdapSyncRepository(db), ldapsync.NewClient(*ldapConfig),
+			employeeService, roleService, validate, *ldapConfig)
+		ldapSyncController := ldapsync.NewController(server, ldapSyncService)
+		ldapSyncController.RegisterRoutes()
+		if cfg.LdapSyncInterval > 0 {
+			go ldapSyncService.Run(cfg.LdapSyncInterval, nil)
+		}
+	}
+
+	// SCIM 2.0: пользователи — сотрудники, группы — роли, членство в группе — выдача роли
+	scimService := scim.NewService(scim.NewScimRepository(db), employeeService, roleService, validate)
+	scimController := scim.NewController(server, scimService)
+	scimController.RegisterRoutes()
+
+	provisioningController := provisioning.NewController(server, changes.Provisioning)
+	provisioningController.RegisterRoutes()
+	if len(changes.Targets) > 0 && cfg.ProvisioningInterval > 0 {
+		go changes.Provisioning.Run(cfg.ProvisioningInterval, nil)
+	}
+
+	webhookController := webhook.NewController(server, changes.Webhook)
+	webhookController.RegisterRoutes()
+	if cfg.WebhookInterval > 0 {
+		go changes.Webhook.Run(cfg.WebhookInterval, nil)
+	}
+
+	outboxController := outbox.NewController(server, changes.Outbox)
+	outboxController.RegisterRoutes()
+	if len(changes.Sinks) > 0 && cfg.OutboxInterval > 0 {
+		go changes.Outbox.Run(cfg.OutboxInterval, nil)
+	}
+
+	permissionRepo := permission.NewPermissionRepository(db)
+	permissionService := permission.NewService(permissionRepo, validate, auditor)
+	permissionController := permission.NewController(server, permissionService)
+	permissionController.RegisterRoutes()
+
+	authzController := authz.NewController(server, authzService)
+	authzController.RegisterRoutes()
+
+	auditController := audit.NewController(server, changes.Audit)
+	auditController.RegisterRoutes()
+
+	apiKeyController := apikey.NewController(server, apiKeyService)
+	apiKeyController.RegisterRoutes()
+
+	tokenService := token.NewService(tokenRepo, employeeRepo, roleRepo, keyStore, validate, cfg)
+	tokenController := token.NewController(server, tokenService)
+	tokenController.RegisterRoutes()
+
+	// LDAP для приложений, которые умеют искать и проверять пользователей только так
+	if cfg.LdapAddress != "" {
+		startLdapServer(ldapserver.NewDirectory(cfg.LdapBaseDn, employeeRepo, roleRepo), apiKeyService, tokenService)
+	}
+
 	infoController := info.NewController(server, cfg, connectionService)
 	infoController.RegisterRoutes()
 	return server
 }
+
+// startLdapServer запуск LDAP-сервера на cfg.LdapAddress; с сертификатом — только ldaps
+func startLdapServer(directory *ldapserver.Directory, apiKeys ldapserver.ApiKeys, loginCodes ldapserver.LoginCodes) {
+	ldapServer, err := ldapserver.NewServer(directory, apiKeys, loginCodes)
+	if err != nil {
+		panic(fmt.Sprintf("ldap server configuration error: %s", err))
+	}
+	var tlsConfig *tls.Config
+	if cfg.LdapTlsCertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(cfg.LdapTlsCertFile, cfg.LdapTlsKeyFile)
+		if err != nil {
+			panic(fmt.Sprintf("ldap server configuration error: %s", err))
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12}
+	}
+	go func() {
+		if err := ldapServer.ListenAndServe(cfg.LdapAddress, tlsConfig); err != nil {
+			panic(fmt.Sprintf("ldap server error: %s", err))
+		}
+	}()
+}
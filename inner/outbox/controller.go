@@ -0,0 +1,79 @@
+package outbox
+
+import (
+	"github.com/gofiber/fiber"
+	"idm/inner/common"
+	"idm/inner/web"
+)
+
+type Controller struct {
+	server        *web.Server
+	outboxService Svc
+}
+
+// интерфейс сервиса outbox.Service
+type Svc interface {
+	Relay(limit int) (Report, error)
+	Retry() (RetryResponse, error)
+	Status() (StatusResponse, error)
+}
+
+func NewController(server *web.Server, outboxService Svc) *Controller {
+	return &Controller{
+		server:        server,
+		outboxService: outboxService,
+	}
+}
+
+// функция для регистрации маршрутов
+func (c *Controller) RegisterRoutes() {
+	// полные пути "/internal/outbox/..." — для публикации по расписанию, возврата событий в очередь и наблюдения за ней
+	c.server.GroupInternal.Post("/outbox/relay", c.Relay)
+	c.server.GroupInternal.Post("/outbox/retry", c.Retry)
+	c.server.GroupInternal.Get("/outbox/status", c.Status)
+}
+
+// функция-хендлер для POST запроса по маршруту "/internal/outbox/relay"
+func (c *Controller) Relay(ctx *fiber.Ctx) {
+	report, err := c.outboxService.Relay(DefaultBatch)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = common.OkResponse(ctx, report)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning outbox report")
+		return
+	}
+}
+
+// функция-хендлер для POST запроса по маршруту "/internal/outbox/retry"
+func (c *Controller) Retry(ctx *fiber.Ctx) {
+	retried, err := c.outboxService.Retry()
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = common.OkResponse(ctx, retried)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning outbox retry result")
+		return
+	}
+}
+
+// функция-хендлер для GET запроса по маршруту "/internal/outbox/status"
+func (c *Controller) Status(ctx *fiber.Ctx) {
+	status, err := c.outboxService.Status()
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = common.OkResponse(ctx, status)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning outbox status")
+		return
+	}
+}
@@ -0,0 +1,77 @@
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gofiber/fiber"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/common"
+	"idm/inner/web"
+	"net/http/httptest"
+	"testing"
+)
+
+type MockService struct {
+	mock.Mock
+}
+
+func (m *MockService) Relay(limit int) (Report, error) {
+	args := m.Called(limit)
+	return args.Get(0).(Report), args.Error(1)
+}
+
+func (m *MockService) Retry() (RetryResponse, error) {
+	args := m.Called()
+	return args.Get(0).(RetryResponse), args.Error(1)
+}
+
+func (m *MockService) Status() (StatusResponse, error) {
+	args := m.Called()
+	return args.Get(0).(StatusResponse), args.Error(1)
+}
+
+func TestController(t *testing.T) {
+	var a = assert.New(t)
+
+	t.Run("should relay outbox", func(t *testing.T) {
+		var svc = new(MockService)
+		var server = web.NewServer()
+		NewController(server, svc).RegisterRoutes()
+		svc.On("Relay", DefaultBatch).Return(Report{Published: 3}, nil)
+
+		var resp, err = server.App.Test(httptest.NewRequest(fiber.MethodPost, "/internal/outbox/relay", nil))
+		a.Nil(err)
+
+		var response common.Response[Report]
+		a.Nil(json.NewDecoder(resp.Body).Decode(&response))
+		a.Equal(fiber.StatusOK, resp.StatusCode)
+		a.Equal(Report{Published: 3}, response.Data)
+	})
+
+	t.Run("should retry dead events", func(t *testing.T) {
+		var svc = new(MockService)
+		var server = web.NewServer()
+		NewController(server, svc).RegisterRoutes()
+		svc.On("Retry").Return(RetryResponse{Retried: 2}, nil)
+
+		var resp, err = server.App.Test(httptest.NewRequest(fiber.MethodPost, "/internal/outbox/retry", nil))
+		a.Nil(err)
+
+		var response common.Response[RetryResponse]
+		a.Nil(json.NewDecoder(resp.Body).Decode(&response))
+		a.Equal(fiber.StatusOK, resp.StatusCode)
+		a.Equal(RetryResponse{Retried: 2}, response.Data)
+	})
+
+	t.Run("should return status", func(t *testing.T) {
+		var svc = new(MockService)
+		var server = web.NewServer()
+		NewController(server, svc).RegisterRoutes()
+		svc.On("Status").Return(StatusResponse{}, errors.New("database is down"))
+
+		var resp, err = server.App.Test(httptest.NewRequest(fiber.MethodGet, "/internal/outbox/status", nil))
+		a.Nil(err)
+		a.Equal(fiber.StatusInternalServerError, resp.StatusCode)
+	})
+}
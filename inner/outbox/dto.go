@@ -0,0 +1,105 @@
+package outbox
+
+import (
+	"encoding/json"
+	"github.com/lib/pq"
+	"time"
+)
+
+// DefaultBatch количество событий, публикуемых за один проход
+const DefaultBatch = 100
+
+// DefaultRetention сколько опубликованные события хранятся, если срок не задан
+const DefaultRetention = 7 * 24 * time.Hour
+
+// MaxAttempts сколько раз публикуется событие, которое не принимает приёмник; затем оно переходит в dead_at,
+// чтобы не задерживать следующие события этого приёмника, и возвращается в очередь только через retry
+const MaxAttempts = 10
+
+// типы приёмников, которые настраиваются файлом
+const (
+	SinkStdout  = "stdout"
+	SinkWebhook = "webhook"
+)
+
+// SinkConfig приёмник из файла настроек
+type SinkConfig struct {
+	Name string `json:"name" validate:"required,max=100"`
+	Type string `json:"type" validate:"required,oneof=stdout webhook"`
+	// Url адрес, на который webhook отправляет каждое событие POST-запросом
+	Url string `json:"url" validate:"required_if=Type webhook,omitempty,url,startswith=http"`
+	// Secret секрет подписи webhook, как у веб-хуков; вида ${NAME} — берётся из переменной окружения
+	Secret string `json:"secret" validate:"required_if=Type webhook"`
+}
+
+type EventEntity struct {
+	Id             int64           `db:"id"`
+	DedupKey       string          `db:"dedup_key"`
+	Event          string          `db:"event"`
+	EntityType     string          `db:"entity_type"`
+	EntityId       int64           `db:"entity_id"`
+	Payload        json.RawMessage `db:"payload"`
+	Attempts       int             `db:"attempts"`
+	LastError      string          `db:"last_error"`
+	CreatedAt      time.Time       `db:"created_at"`
+	ClaimedUntil   *time.Time      `db:"claimed_until"`
+	PublishedSinks pq.StringArray  `db:"published_sinks"`
+	PublishedAt    *time.Time      `db:"published_at"`
+	DeadAt         *time.Time      `db:"dead_at"`
+}
+
+func (e *EventEntity) toEvent() Event {
+	return Event{
+		Sequence:   e.Id,
+		DedupKey:   e.DedupKey,
+		Type:       e.Event,
+		EntityType: e.EntityType,
+		EntityId:   e.EntityId,
+		Payload:    e.Payload,
+	}
+}
+
+// Event событие, передаваемое приёмнику. Payload — то же тело, что получают веб-хуки;
+// DedupKey совпадает с его id и не меняется при повторной публикации. Sequence — id в outbox:
+// растёт с изменениями одной записи, но между записями не совпадает с порядком коммитов
+type Event struct {
+	Sequence   int64
+	DedupKey   string
+	Type       string
+	EntityType string
+	EntityId   int64
+	Payload    json.RawMessage
+}
+
+// StatusEntity состояние очереди неопубликованных событий
+type StatusEntity struct {
+	Pending         int64      `db:"pending"`
+	OldestPendingAt *time.Time `db:"oldest_pending_at"`
+	Dead            int64      `db:"dead"`
+	Attempts        int        `db:"attempts"`
+	LastError       string     `db:"last_error"`
+}
+
+type StatusResponse struct {
+	Sinks           []string   `json:"sinks"`
+	Pending         int64      `json:"pending"`
+	OldestPendingAt *time.Time `json:"oldest_pending_at"`
+	// Dead события, исчерпавшие попытки публикации
+	Dead int64 `json:"dead"`
+	// Attempts и LastError — неудачные попытки публикации первого в очереди события, которое не принял приёмник
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error"`
+}
+
+// Report итог прохода ретранслятора: Published — события, которые приняли все приёмники; Failed — события,
+// которые не принял хотя бы один приёмник; Dead — события, исчерпавшие при этом попытки
+type Report struct {
+	Published int `json:"published"`
+	Failed    int `json:"failed"`
+	Dead      int `json:"dead"`
+}
+
+// RetryResponse сколько исчерпавших попытки событий возвращено в очередь
+type RetryResponse struct {
+	Retried int64 `json:"retried"`
+}
@@ -0,0 +1,120 @@
+package outbox
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"time"
+)
+
+type Repository struct {
+	db *sqlx.DB
+}
+
+func NewOutboxRepository(dataBase *sqlx.DB) *Repository {
+	return &Repository{db: dataBase}
+}
+
+func (repo *Repository) BeginTransaction() (tx *sqlx.Tx, err error) {
+	return repo.db.Beginx()
+}
+
+// SaveTx запись события в транзакции изменения; тело передаётся строкой: []byte драйвер отправил бы как bytea
+func (repo *Repository) SaveTx(tx *sqlx.Tx, entity EventEntity) error {
+	_, err := tx.Exec(`INSERT INTO outbox_event (dedup_key, event, entity_type, entity_id, payload)
+		VALUES ($1, $2, $3, $4, $5)`,
+		entity.DedupKey, entity.Event, entity.EntityType, entity.EntityId, string(entity.Payload))
+	return err
+}
+
+// TryLockTx блокировка выборки до конца транзакции: пачку берёт один процесс за раз, иначе двое могли бы
+// взять соседние пачки и публиковать их параллельно; false — блокировку держит другой
+func (repo *Repository) TryLockTx(tx *sqlx.Tx) (locked bool, err error) {
+	err = tx.Get(&locked, "SELECT pg_try_advisory_xact_lock(hashtext('outbox_relay'))")
+	return locked, err
+}
+
+// ClaimTx берёт для каждого из sinks не более limit событий по порядку id, которые этот приёмник ещё
+// не принял, и откладывает их на lease: пока взятая пачка не освобождена и lease не истёк, новая
+// не выбирается, а при падении процесса пачка берётся снова. Пусто — очередь пуста или пачку публикует
+// другой процесс. События, которые уже приняли все приёмники, например после удаления приёмника
+// из настроек, сразу отмечаются опубликованными
+func (repo *Repository) ClaimTx(tx *sqlx.Tx, sinks []string, limit int, lease time.Duration) (items []EventEntity, err error) {
+	_, err = tx.Exec(`UPDATE outbox_event SET published_at = now()
+		WHERE published_at IS NULL AND dead_at IS NULL AND published_sinks @> $1`,
+		pq.Array(sinks))
+	if err != nil {
+		return nil, err
+	}
+	items = []EventEntity{}
+	err = tx.Select(&items, `WITH claimed AS (
+			UPDATE outbox_event SET claimed_until = now() + make_interval(secs => $3)
+			WHERE id IN (SELECT pending.id FROM unnest($1::text[]) AS sink(name)
+					CROSS JOIN LATERAL (SELECT id FROM outbox_event
+						WHERE published_at IS NULL AND dead_at IS NULL AND NOT (sink.name = ANY (published_sinks))
+						ORDER BY id LIMIT $2) AS pending)
+				AND NOT EXISTS (SELECT 1 FROM outbox_event WHERE published_at IS NULL AND claimed_until > now())
+			RETURNING *)
+		SELECT * FROM claimed ORDER BY id`,
+		pq.Array(sinks), limit, lease.Seconds())
+	return items, err
+}
+
+// MarkPublished отмечает, что приёмник sink принял события ids
+func (repo *Repository) MarkPublished(ids []int64, sink string) error {
+	_, err := repo.db.Exec(`UPDATE outbox_event SET published_sinks = array_append(published_sinks, $2)
+		WHERE id = ANY($1) AND NOT ($2 = ANY (published_sinks))`,
+		pq.Array(ids), sink)
+	return err
+}
+
+// MarkFailed записывает неудачную попытку публикации события id; на попытке maxAttempts событие
+// переходит в dead_at и больше не выбирается. true — событие перешло в dead_at
+func (repo *Repository) MarkFailed(id int64, lastError string, maxAttempts int) (dead bool, err error) {
+	err = repo.db.Get(&dead, `UPDATE outbox_event SET attempts = attempts + 1, last_error = $2,
+			dead_at = CASE WHEN attempts + 1 >= $3 THEN now() END
+		WHERE id = $1
+		RETURNING dead_at IS NOT NULL`,
+		id, lastError, maxAttempts)
+	return dead, err
+}
+
+// Release освобождает взятую пачку; события, которые приняли все sinks, отмечаются опубликованными
+func (repo *Repository) Release(ids []int64, sinks []string) error {
+	_, err := repo.db.Exec(`UPDATE outbox_event SET claimed_until = NULL,
+			published_at = CASE WHEN dead_at IS NULL AND published_sinks @> $2 THEN now() END
+		WHERE id = ANY($1)`,
+		pq.Array(ids), pq.Array(sinks))
+	return err
+}
+
+// Retry возвращает в очередь события, исчерпавшие попытки публикации; счётчик попыток обнуляется
+func (repo *Repository) Retry() (count int64, err error) {
+	result, err := repo.db.Exec("UPDATE outbox_event SET dead_at = NULL, attempts = 0 WHERE dead_at IS NOT NULL")
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeletePublished удаление событий, опубликованных раньше before
+func (repo *Repository) DeletePublished(before time.Time) (count int64, err error) {
+	result, err := repo.db.Exec("DELETE FROM outbox_event WHERE published_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// FindStatus очередь неопубликованных событий; попытки и ошибка — первого в очереди события с неудачными
+// попытками, а если в очереди таких нет — первого из исчерпавших попытки
+func (repo *Repository) FindStatus() (status StatusEntity, err error) {
+	err = repo.db.Get(&status, `SELECT count(*) FILTER (WHERE dead_at IS NULL) AS pending,
+			min(created_at) FILTER (WHERE dead_at IS NULL) AS oldest_pending_at,
+			count(*) FILTER (WHERE dead_at IS NOT NULL) AS dead,
+			coalesce((SELECT attempts FROM outbox_event WHERE published_at IS NULL AND attempts > 0
+				ORDER BY dead_at IS NOT NULL, id LIMIT 1), 0) AS attempts,
+			coalesce((SELECT last_error FROM outbox_event WHERE published_at IS NULL AND attempts > 0
+				ORDER BY dead_at IS NOT NULL, id LIMIT 1), '') AS last_error
+		FROM outbox_event WHERE published_at IS NULL`)
+	return status, err
+}
@@ -0,0 +1,264 @@
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"idm/inner/audit"
+	"idm/inner/webhook"
+	"slices"
+	"time"
+)
+
+// lease на сколько откладывается взятая пачка: за это время её нужно опубликовать во все приёмники,
+// иначе её возьмёт следующий проход
+const lease = 5 * time.Minute
+
+type Service struct {
+	repo      Repo
+	sinks     []Sink
+	retention time.Duration
+	now       func() time.Time
+}
+
+type Repo interface {
+	BeginTransaction() (*sqlx.Tx, error)
+	SaveTx(tx *sqlx.Tx, entity EventEntity) error
+	TryLockTx(tx *sqlx.Tx) (bool, error)
+	ClaimTx(tx *sqlx.Tx, sinks []string, limit int, lease time.Duration) ([]EventEntity, error)
+	MarkPublished(ids []int64, sink string) error
+	MarkFailed(id int64, lastError string, maxAttempts int) (bool, error)
+	Release(ids []int64, sinks []string) error
+	Retry() (int64, error)
+	DeletePublished(before time.Time) (int64, error)
+	FindStatus() (StatusEntity, error)
+}
+
+func NewService(repo Repo, sinks []Sink, retention time.Duration) *Service {
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	return &Service{
+		repo:      repo,
+		sinks:     sinks,
+		retention: retention,
+		now:       time.Now,
+	}
+}
+
+// RecordTx записывает событие об изменении в outbox в транзакции самого изменения: событие
+// публикуется, только если изменение сохранено, и не теряется при падении процесса после коммита;
+// реализует audit.Recorder. Без приёмников события не записываются
+func (service *Service) RecordTx(tx *sqlx.Tx, actor audit.Actor, record audit.Record) error {
+	if len(service.sinks) == 0 {
+		return nil
+	}
+	payload, err := webhook.NewPayload(actor, record, service.now())
+	if err != nil || payload.Event == "" {
+		return err
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error serializing %s event: %w", payload.Event, err)
+	}
+	err = service.repo.SaveTx(tx, EventEntity{
+		DedupKey:   payload.Id,
+		Event:      payload.Event,
+		EntityType: record.EntityType,
+		EntityId:   record.EntityId,
+		Payload:    body,
+	})
+	if err != nil {
+		return fmt.Errorf("error saving %s event of %s %d to outbox: %w", payload.Event, record.EntityType, record.EntityId, err)
+	}
+	return nil
+}
+
+// Relay публикация событий по порядку id: каждому приёмнику — не более limit событий, которые он ещё
+// не принял. Пачка берётся в короткой транзакции и публикуется вне её, поэтому запросы к приёмникам
+// не держат ни транзакцию, ни блокировку. Успех каждого приёмника записывается отдельно: приёмник,
+// который не принял событие, получит его и следующие за ним снова, а остальные повторов не получат
+// и продолжают со следующих событий. Событие отмечается опубликованным, когда его приняли все приёмники,
+// — доставка «хотя бы один раз». Событие, которое приёмник не принял MaxAttempts раз, переходит в dead_at
+// и больше не задерживает этот приёмник.
+// Порядок гарантируется только для событий одной записи: её изменения сериализуются блокировкой строки,
+// и событие следующего изменения получает больший id. Общего порядка между записями нет: событие
+// транзакции, которая завершилась позже, может получить меньший id и быть опубликовано после событий
+// с большими. Пока пачку публикует другой процесс, этот ничего не делает
+func (service *Service) Relay(limit int) (report Report, err error) {
+	if len(service.sinks) == 0 {
+		return report, nil
+	}
+	names := service.sinkNames()
+	items, err := service.claim(names, limit)
+	if err != nil || len(items) == 0 {
+		return report, err
+	}
+	for _, sink := range service.sinks {
+		pending := pendingFor(items, sink.Name(), limit)
+		if len(pending) == 0 {
+			continue
+		}
+		events := make([]Event, len(pending))
+		for i := range pending {
+			events[i] = pending[i].toEvent()
+		}
+		published, publishErr := sink.Publish(events)
+		published = min(max(published, 0), len(pending))
+		if published > 0 {
+			ids := make([]int64, published)
+			for i := range ids {
+				ids[i] = pending[i].Id
+				pending[i].PublishedSinks = append(pending[i].PublishedSinks, sink.Name())
+			}
+			if err = service.repo.MarkPublished(ids, sink.Name()); err != nil {
+				return report, fmt.Errorf("error marking outbox events published to %s: %w", sink.Name(), err)
+			}
+		}
+		if publishErr != nil && published < len(pending) {
+			failed := pending[published]
+			dead, err := service.repo.MarkFailed(failed.Id, sink.Name()+": "+publishErr.Error(), MaxAttempts)
+			if err != nil {
+				return report, fmt.Errorf("error saving outbox failure: %w", err)
+			}
+			if dead {
+				now := service.now()
+				failed.DeadAt = &now
+			}
+		}
+	}
+	ids := make([]int64, len(items))
+	for i := range items {
+		ids[i] = items[i].Id
+		switch {
+		case items[i].DeadAt != nil:
+			report.Dead++
+		case publishedToAll(items[i], names):
+			report.Published++
+		default:
+			report.Failed++
+		}
+	}
+	if err = service.repo.Release(ids, names); err != nil {
+		return report, fmt.Errorf("error releasing outbox events: %w", err)
+	}
+	return report, nil
+}
+
+// pendingFor не более limit событий пачки по порядку, которые приёмник sink ещё не принял
+func pendingFor(items []EventEntity, sink string, limit int) []*EventEntity {
+	var pending []*EventEntity
+	for i := range items {
+		if len(pending) == limit {
+			break
+		}
+		if items[i].DeadAt == nil && !slices.Contains(items[i].PublishedSinks, sink) {
+			pending = append(pending, &items[i])
+		}
+	}
+	return pending
+}
+
+func publishedToAll(item EventEntity, sinks []string) bool {
+	for _, sink := range sinks {
+		if !slices.Contains(item.PublishedSinks, sink) {
+			return false
+		}
+	}
+	return true
+}
+
+func (service *Service) sinkNames() []string {
+	names := make([]string, len(service.sinks))
+	for i, sink := range service.sinks {
+		names[i] = sink.Name()
+	}
+	return names
+}
+
+// claim выборка пачки для публикации под блокировкой ретранслятора; блокировка снимается коммитом
+func (service *Service) claim(sinks []string, limit int) (items []EventEntity, err error) {
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return nil, fmt.Errorf("error relay outbox: error creating transaction: %w", err)
+	}
+	locked, err := service.repo.TryLockTx(tx)
+	if err != nil || !locked {
+		return nil, err
+	}
+	items, err = service.repo.ClaimTx(tx, sinks, limit, lease)
+	if err != nil {
+		return nil, fmt.Errorf("error claiming outbox events: %w", err)
+	}
+	return items, nil
+}
+
+// Retry возвращает в очередь события, исчерпавшие попытки публикации, например после исправления приёмника
+func (service *Service) Retry() (RetryResponse, error) {
+	count, err := service.repo.Retry()
+	if err != nil {
+		return RetryResponse{}, fmt.Errorf("error retrying dead outbox events: %w", err)
+	}
+	return RetryResponse{Retried: count}, nil
+}
+
+// Purge удаление опубликованных событий старше срока хранения
+func (service *Service) Purge() (int64, error) {
+	count, err := service.repo.DeletePublished(service.now().Add(-service.retention))
+	if err != nil {
+		return 0, fmt.Errorf("error purging published outbox events: %w", err)
+	}
+	return count, nil
+}
+
+// Status очередь неопубликованных событий: сколько их, с какого времени и почему публикация стоит
+func (service *Service) Status() (StatusResponse, error) {
+	status, err := service.repo.FindStatus()
+	if err != nil {
+		return StatusResponse{}, fmt.Errorf("error finding outbox status: %w", err)
+	}
+	return StatusResponse{
+		Sinks:           service.sinkNames(),
+		Pending:         status.Pending,
+		OldestPendingAt: status.OldestPendingAt,
+		Dead:            status.Dead,
+		Attempts:        status.Attempts,
+		LastError:       status.LastError,
+	}, nil
+}
+
+// Run публикация каждые interval, пока не закрыт stop: за проход очередь выбирается до конца
+// или до первой ошибки, затем удаляются старые опубликованные события
+func (service *Service) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for {
+			report, err := service.Relay(DefaultBatch)
+			if err != nil {
+				fmt.Printf("outbox relay error: %v\n", err)
+				break
+			}
+			if report.Failed > 0 || report.Published < DefaultBatch {
+				break
+			}
+		}
+		if _, err := service.Purge(); err != nil {
+			fmt.Printf("outbox purge error: %v\n", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
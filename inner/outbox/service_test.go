@@ -0,0 +1,267 @@
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/audit"
+	"idm/inner/webhook"
+	"testing"
+	"time"
+)
+
+type MockRepo struct {
+	mock.Mock
+}
+
+func (m *MockRepo) BeginTransaction() (*sqlx.Tx, error) {
+	args := m.Called()
+	return args.Get(0).(*sqlx.Tx), args.Error(1)
+}
+
+func (m *MockRepo) SaveTx(tx *sqlx.Tx, entity EventEntity) error {
+	return m.Called(tx, entity).Error(0)
+}
+
+func (m *MockRepo) TryLockTx(tx *sqlx.Tx) (bool, error) {
+	args := m.Called(tx)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepo) ClaimTx(tx *sqlx.Tx, sinks []string, limit int, lease time.Duration) ([]EventEntity, error) {
+	args := m.Called(tx, sinks, limit, lease)
+	return args.Get(0).([]EventEntity), args.Error(1)
+}
+
+func (m *MockRepo) MarkPublished(ids []int64, sink string) error {
+	return m.Called(ids, sink).Error(0)
+}
+
+func (m *MockRepo) MarkFailed(id int64, lastError string, maxAttempts int) (bool, error) {
+	args := m.Called(id, lastError, maxAttempts)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepo) Release(ids []int64, sinks []string) error {
+	return m.Called(ids, sinks).Error(0)
+}
+
+func (m *MockRepo) Retry() (int64, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepo) DeletePublished(before time.Time) (int64, error) {
+	args := m.Called(before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepo) FindStatus() (StatusEntity, error) {
+	args := m.Called()
+	return args.Get(0).(StatusEntity), args.Error(1)
+}
+
+// recordingSink запоминает переданные события; err — ошибка каждой публикации после accepted принятых событий
+type recordingSink struct {
+	name      string
+	err       error
+	accepted  int
+	published [][]Event
+}
+
+func (sink *recordingSink) Name() string {
+	return sink.name
+}
+
+func (sink *recordingSink) Publish(events []Event) (int, error) {
+	sink.published = append(sink.published, events)
+	if sink.err != nil {
+		return min(sink.accepted, len(events)), sink.err
+	}
+	return len(events), nil
+}
+
+var noTx *sqlx.Tx
+
+func TestRecordTx(t *testing.T) {
+	var a = assert.New(t)
+	var actor = audit.Actor{Subject: "42"}
+
+	t.Run("should save event in change transaction", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, []Sink{&recordingSink{name: "log"}}, 0)
+		var saved EventEntity
+		repo.On("SaveTx", noTx, mock.Anything).Run(func(args mock.Arguments) {
+			saved = args.Get(1).(EventEntity)
+		}).Return(nil)
+
+		var err = svc.RecordTx(noTx, actor, audit.Record{Action: audit.ActionAddRole, EntityType: audit.EntityEmployee,
+			EntityId: 7, After: map[string]int64{"role_id": 3}})
+
+		a.Nil(err)
+		a.Equal(webhook.EventRoleAssigned, saved.Event)
+		a.Equal(audit.EntityEmployee, saved.EntityType)
+		a.Equal(int64(7), saved.EntityId)
+		var payload webhook.Payload
+		a.Nil(json.Unmarshal(saved.Payload, &payload))
+		a.Equal(saved.DedupKey, payload.Id)
+		a.Equal("42", payload.Actor)
+	})
+
+	t.Run("should not record without sinks", func(t *testing.T) {
+		var repo = new(MockRepo)
+
+		var err = NewService(repo, nil, 0).RecordTx(noTx, actor, audit.Record{Action: audit.ActionCreate, EntityType: audit.EntityRole})
+
+		a.Nil(err)
+		repo.AssertNotCalled(t, "SaveTx", mock.Anything, mock.Anything)
+	})
+
+	t.Run("should fail change when event is not saved", func(t *testing.T) {
+		var repo = new(MockRepo)
+		repo.On("SaveTx", noTx, mock.Anything).Return(errors.New("database is down"))
+
+		var err = NewService(repo, []Sink{&recordingSink{name: "log"}}, 0).
+			RecordTx(noTx, actor, audit.Record{Action: audit.ActionCreate, EntityType: audit.EntityRole})
+
+		a.ErrorContains(err, "database is down")
+	})
+}
+
+func TestRelay(t *testing.T) {
+	var a = assert.New(t)
+	var names = []string{"log", "crm"}
+	// claimed новая пачка на каждый проход: ретранслятор записывает в неё, какие приёмники приняли события
+	var claimed = func() []EventEntity {
+		return []EventEntity{
+			{Id: 1, DedupKey: "a", Event: webhook.EventEmployeeCreated, EntityType: audit.EntityEmployee, EntityId: 7},
+			{Id: 2, DedupKey: "b", Event: webhook.EventRoleAssigned, EntityType: audit.EntityEmployee, EntityId: 7},
+		}
+	}
+	var items = claimed()
+
+	t.Run("should publish events in order to all sinks", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var first, second = &recordingSink{name: "log"}, &recordingSink{name: "crm"}
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("TryLockTx", noTx).Return(true, nil)
+		repo.On("ClaimTx", noTx, names, DefaultBatch, lease).Return(claimed(), nil)
+		repo.On("MarkPublished", []int64{1, 2}, "log").Return(nil)
+		repo.On("MarkPublished", []int64{1, 2}, "crm").Return(nil)
+		repo.On("Release", []int64{1, 2}, names).Return(nil)
+
+		var report, err = NewService(repo, []Sink{first, second}, 0).Relay(DefaultBatch)
+
+		a.Nil(err)
+		a.Equal(Report{Published: 2}, report)
+		a.Equal([][]Event{{items[0].toEvent(), items[1].toEvent()}}, first.published)
+		a.Equal(first.published, second.published)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("should keep progress of each sink when one fails", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var healthy, failing = &recordingSink{name: "log"}, &recordingSink{name: "crm", err: errors.New("timeout"), accepted: 1}
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("TryLockTx", noTx).Return(true, nil)
+		repo.On("ClaimTx", noTx, names, DefaultBatch, lease).Return(claimed(), nil)
+		repo.On("MarkPublished", []int64{1, 2}, "log").Return(nil)
+		repo.On("MarkPublished", []int64{1}, "crm").Return(nil)
+		repo.On("MarkFailed", int64(2), "crm: timeout", MaxAttempts).Return(false, nil)
+		repo.On("Release", []int64{1, 2}, names).Return(nil)
+
+		var report, err = NewService(repo, []Sink{healthy, failing}, 0).Relay(DefaultBatch)
+
+		a.Nil(err)
+		a.Equal(Report{Published: 1, Failed: 1}, report)
+		a.Equal([][]Event{{items[0].toEvent(), items[1].toEvent()}}, healthy.published)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("should not pass events again to sink that accepted them", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var first, second = &recordingSink{name: "log"}, &recordingSink{name: "crm"}
+		var batch = claimed()
+		batch[0].PublishedSinks = []string{"log"}
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("TryLockTx", noTx).Return(true, nil)
+		repo.On("ClaimTx", noTx, names, DefaultBatch, lease).Return(batch, nil)
+		repo.On("MarkPublished", []int64{2}, "log").Return(nil)
+		repo.On("MarkPublished", []int64{1, 2}, "crm").Return(nil)
+		repo.On("Release", []int64{1, 2}, names).Return(nil)
+
+		var report, err = NewService(repo, []Sink{first, second}, 0).Relay(DefaultBatch)
+
+		a.Nil(err)
+		a.Equal(Report{Published: 2}, report)
+		a.Equal([][]Event{{items[1].toEvent()}}, first.published)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("should move event out of the queue after max attempts", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var failing = &recordingSink{name: "crm", err: errors.New("bad request")}
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("TryLockTx", noTx).Return(true, nil)
+		repo.On("ClaimTx", noTx, []string{"crm"}, DefaultBatch, lease).Return(claimed(), nil)
+		repo.On("MarkFailed", int64(1), "crm: bad request", MaxAttempts).Return(true, nil)
+		repo.On("Release", []int64{1, 2}, []string{"crm"}).Return(nil)
+
+		var report, err = NewService(repo, []Sink{failing}, 0).Relay(DefaultBatch)
+
+		a.Nil(err)
+		a.Equal(Report{Failed: 1, Dead: 1}, report)
+		repo.AssertNotCalled(t, "MarkPublished", mock.Anything, mock.Anything)
+	})
+
+	t.Run("should skip while another relay holds the lock", func(t *testing.T) {
+		var repo = new(MockRepo)
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("TryLockTx", noTx).Return(false, nil)
+
+		var report, err = NewService(repo, []Sink{&recordingSink{name: "log"}}, 0).Relay(DefaultBatch)
+
+		a.Nil(err)
+		a.Equal(Report{}, report)
+		repo.AssertNotCalled(t, "ClaimTx", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("should do nothing while another relay publishes its batch", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var sink = &recordingSink{name: "log"}
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("TryLockTx", noTx).Return(true, nil)
+		repo.On("ClaimTx", noTx, []string{"log"}, DefaultBatch, lease).Return([]EventEntity{}, nil)
+
+		var report, err = NewService(repo, []Sink{sink}, 0).Relay(DefaultBatch)
+
+		a.Nil(err)
+		a.Equal(Report{}, report)
+		a.Empty(sink.published)
+	})
+}
+
+func TestPurgeStatusAndRetry(t *testing.T) {
+	var a = assert.New(t)
+	var now = time.Date(2025, 3, 8, 12, 0, 0, 0, time.UTC)
+	var repo = new(MockRepo)
+	var svc = NewService(repo, []Sink{&recordingSink{name: "log"}}, 0)
+	svc.now = func() time.Time { return now }
+	repo.On("DeletePublished", now.Add(-DefaultRetention)).Return(int64(3), nil)
+	repo.On("FindStatus").Return(StatusEntity{Pending: 2, Dead: 1, Attempts: 1, LastError: "crm: timeout"}, nil)
+	repo.On("Retry").Return(int64(1), nil)
+
+	var purged, err = svc.Purge()
+	a.Nil(err)
+	a.Equal(int64(3), purged)
+
+	status, err := svc.Status()
+	a.Nil(err)
+	a.Equal(StatusResponse{Sinks: []string{"log"}, Pending: 2, Dead: 1, Attempts: 1, LastError: "crm: timeout"}, status)
+
+	retried, err := svc.Retry()
+	a.Nil(err)
+	a.Equal(RetryResponse{Retried: 1}, retried)
+}
@@ -0,0 +1,179 @@
+package outbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"idm/inner/webhook"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Sink приёмник событий. Publish получает события по порядку и возвращает, сколько из них принято подряд
+// с начала; ошибка относится к следующему событию, с него приёмник получит события снова. Принятое
+// событие может быть передано повторно, например если процесс упал до записи итога, поэтому потребители
+// отбрасывают повторы по DedupKey
+type Sink interface {
+	Name() string
+	Publish(events []Event) (int, error)
+}
+
+// Validator проверка структур по тегам validate, реализуется validator.Validator
+type Validator interface {
+	Validate(request any) error
+}
+
+// LoadSinks читает JSON-массив приёмников из файла; пустой путь — приёмников нет и события не записываются
+func LoadSinks(path string, validator Validator, httpClient *http.Client) ([]Sink, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading outbox sinks file %s: %w", path, err)
+	}
+	var configs []SinkConfig
+	if err = json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("error parsing outbox sinks file %s: %w", path, err)
+	}
+	names := make(map[string]bool, len(configs))
+	sinks := make([]Sink, 0, len(configs))
+	for _, config := range configs {
+		if err = validator.Validate(config); err != nil {
+			return nil, fmt.Errorf("invalid outbox sink %q: %w", config.Name, err)
+		}
+		if names[config.Name] {
+			return nil, fmt.Errorf("duplicate outbox sink %q", config.Name)
+		}
+		names[config.Name] = true
+		switch config.Type {
+		case SinkStdout:
+			sinks = append(sinks, NewStdoutSink(config.Name, os.Stdout))
+		case SinkWebhook:
+			sinks = append(sinks, NewWebhookSink(config.Name, config.Url, os.ExpandEnv(config.Secret), httpClient))
+		}
+	}
+	return sinks, nil
+}
+
+// StdoutSink пишет тело каждого события отдельной строкой JSON, например для сборщика логов
+type StdoutSink struct {
+	name   string
+	writer io.Writer
+	mutex  sync.Mutex
+}
+
+func NewStdoutSink(name string, writer io.Writer) *StdoutSink {
+	return &StdoutSink{name: name, writer: writer}
+}
+
+func (sink *StdoutSink) Name() string {
+	return sink.name
+}
+
+func (sink *StdoutSink) Publish(events []Event) (int, error) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	for i, event := range events {
+		var line bytes.Buffer
+		if err := json.Compact(&line, event.Payload); err != nil {
+			return i, fmt.Errorf("error writing event %s: %w", event.DedupKey, err)
+		}
+		line.WriteByte('\n')
+		if _, err := sink.writer.Write(line.Bytes()); err != nil {
+			return i, fmt.Errorf("error writing event %s: %w", event.DedupKey, err)
+		}
+	}
+	return len(events), nil
+}
+
+// WebhookSink отправляет каждое событие отправителем веб-хуков, поэтому получатель веб-хуков принимает
+// и его; X-Idm-Delivery — порядковый номер события в outbox
+type WebhookSink struct {
+	name   string
+	url    string
+	secret string
+	sender *webhook.Sender
+}
+
+func NewWebhookSink(name string, url string, secret string, httpClient *http.Client) *WebhookSink {
+	return &WebhookSink{name: name, url: url, secret: secret, sender: webhook.NewSender(httpClient, "idm-outbox")}
+}
+
+func (sink *WebhookSink) Name() string {
+	return sink.name
+}
+
+func (sink *WebhookSink) Publish(events []Event) (int, error) {
+	for i, event := range events {
+		_, err := sink.sender.Send(webhook.Message{
+			Url:      sink.url,
+			Secret:   sink.secret,
+			Event:    event.Type,
+			EventId:  event.DedupKey,
+			Delivery: event.Sequence,
+			Payload:  event.Payload,
+		})
+		if err != nil {
+			return i, fmt.Errorf("error sending event %s: %w", event.DedupKey, err)
+		}
+	}
+	return len(events), nil
+}
+
+// Message сообщение для брокера
+type Message struct {
+	// Subject тема NATS или топик Kafka: префикс приёмника и тип события, например "idm.employee.created"
+	Subject string
+	// DedupKey для заголовка Nats-Msg-Id в JetStream или идемпотентной обработки у потребителя Kafka
+	DedupKey string
+	// OrderingKey "<тип сущности>:<id>": ключ сообщения Kafka, чтобы события одной сущности попадали
+	// в одну партицию и читались по порядку
+	OrderingKey string
+	Payload     []byte
+}
+
+// Publisher клиент брокера сообщений, например NATS JetStream или продюсер Kafka; Publish возвращает
+// управление, когда брокер подтвердил приём
+type Publisher interface {
+	Publish(message Message) error
+}
+
+// BrokerSink публикует события в брокер через Publisher. Клиентов брокеров в сервисе нет, приёмник
+// подключается в коде: outbox.NewBrokerSink("events", "idm", publisher)
+type BrokerSink struct {
+	name      string
+	prefix    string
+	publisher Publisher
+}
+
+func NewBrokerSink(name string, prefix string, publisher Publisher) *BrokerSink {
+	return &BrokerSink{name: name, prefix: strings.TrimSuffix(prefix, "."), publisher: publisher}
+}
+
+func (sink *BrokerSink) Name() string {
+	return sink.name
+}
+
+func (sink *BrokerSink) Publish(events []Event) (int, error) {
+	for i, event := range events {
+		subject := event.Type
+		if sink.prefix != "" {
+			subject = sink.prefix + "." + event.Type
+		}
+		err := sink.publisher.Publish(Message{
+			Subject:     subject,
+			DedupKey:    event.DedupKey,
+			OrderingKey: event.EntityType + ":" + strconv.FormatInt(event.EntityId, 10),
+			Payload:     event.Payload,
+		})
+		if err != nil {
+			return i, fmt.Errorf("error publishing event %s: %w", event.DedupKey, err)
+		}
+	}
+	return len(events), nil
+}
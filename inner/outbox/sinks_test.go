@@ -0,0 +1,139 @@
+package outbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"idm/inner/validator"
+	"idm/inner/webhook"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func writeSinks(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "sinks.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+var event = Event{Sequence: 12, DedupKey: "evt-1", Type: webhook.EventEmployeeCreated, EntityType: "employee",
+	EntityId: 7, Payload: json.RawMessage(`{"id": "evt-1", "event": "employee.created"}`)}
+
+func TestLoadSinks(t *testing.T) {
+	var a = assert.New(t)
+
+	t.Run("should build sinks and expand secret", func(t *testing.T) {
+		t.Setenv("CRM_WEBHOOK_SECRET", "secret")
+		var path = writeSinks(t, `[{"name": "log", "type": "stdout"},
+			{"name": "crm", "type": "webhook", "url": "https://crm.example.com/events", "secret": "${CRM_WEBHOOK_SECRET}"}]`)
+
+		var sinks, err = LoadSinks(path, validator.New(), http.DefaultClient)
+
+		a.Nil(err)
+		a.Len(sinks, 2)
+		a.Equal("log", sinks[0].Name())
+		a.Equal("secret", sinks[1].(*WebhookSink).secret)
+	})
+
+	t.Run("should return nothing without file", func(t *testing.T) {
+		var sinks, err = LoadSinks("", validator.New(), http.DefaultClient)
+
+		a.Nil(err)
+		a.Nil(sinks)
+	})
+
+	t.Run("should reject webhook without url and duplicate names", func(t *testing.T) {
+		var _, err = LoadSinks(writeSinks(t, `[{"name": "crm", "type": "webhook", "secret": "s"}]`), validator.New(), http.DefaultClient)
+		a.ErrorContains(err, `invalid outbox sink "crm"`)
+
+		_, err = LoadSinks(writeSinks(t, `[{"name": "log", "type": "stdout"}, {"name": "log", "type": "stdout"}]`),
+			validator.New(), http.DefaultClient)
+		a.ErrorContains(err, `duplicate outbox sink "log"`)
+	})
+}
+
+func TestStdoutSink(t *testing.T) {
+	var a = assert.New(t)
+	var out bytes.Buffer
+
+	var published, err = NewStdoutSink("log", &out).Publish([]Event{event, event})
+
+	a.Nil(err)
+	a.Equal(2, published)
+	a.Equal(strings.Repeat(`{"id":"evt-1","event":"employee.created"}`+"\n", 2), out.String())
+}
+
+func TestWebhookSink(t *testing.T) {
+	var a = assert.New(t)
+
+	t.Run("should send signed event", func(t *testing.T) {
+		var received *http.Request
+		var body []byte
+		var receiver = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = r
+			body, _ = io.ReadAll(r.Body)
+		}))
+		defer receiver.Close()
+
+		var published, err = NewWebhookSink("crm", receiver.URL, "secret", http.DefaultClient).Publish([]Event{event})
+
+		a.Nil(err)
+		a.Equal(1, published)
+		a.Equal([]byte(event.Payload), body)
+		a.Equal("evt-1", received.Header.Get(webhook.HeaderEventId))
+		a.Equal("12", received.Header.Get(webhook.HeaderDelivery))
+		var timestamp int64
+		var signature string
+		_, err = fmt.Sscanf(strings.Replace(received.Header.Get(webhook.HeaderSignature), ",v1=", " ", 1), "t=%d %s", &timestamp, &signature)
+		a.Nil(err)
+		a.Equal(webhook.Sign("secret", timestamp, event.Payload), signature)
+	})
+
+	t.Run("should fail on error status and report accepted events", func(t *testing.T) {
+		var requests int
+		var receiver = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests > 1 {
+				w.WriteHeader(http.StatusBadGateway)
+			}
+		}))
+		defer receiver.Close()
+
+		var published, err = NewWebhookSink("crm", receiver.URL, "secret", http.DefaultClient).Publish([]Event{event, event, event})
+
+		a.ErrorContains(err, "unexpected response status "+strconv.Itoa(http.StatusBadGateway))
+		a.Equal(1, published)
+		a.Equal(2, requests)
+	})
+}
+
+type publisherFunc func(message Message) error
+
+func (f publisherFunc) Publish(message Message) error {
+	return f(message)
+}
+
+func TestBrokerSink(t *testing.T) {
+	var a = assert.New(t)
+	var messages []Message
+	var sink = NewBrokerSink("events", "idm.", publisherFunc(func(message Message) error {
+		messages = append(messages, message)
+		return nil
+	}))
+
+	var published, err = sink.Publish([]Event{event})
+
+	a.Nil(err)
+	a.Equal(1, published)
+	a.Equal([]Message{{Subject: "idm.employee.created", DedupKey: "evt-1", OrderingKey: "employee:7",
+		Payload: event.Payload}}, messages)
+}
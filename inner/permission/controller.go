@@ -0,0 +1,292 @@
+package permission
+
+import (
+	"errors"
+	"github.com/gofiber/fiber"
+	"idm/inner/audit"
+	"idm/inner/common"
+	"idm/inner/validator"
+	"idm/inner/web"
+)
+
+type Controller struct {
+	server            *web.Server
+	permissionService Svc
+	validate          *validator.Validator
+}
+
+// интерфейс сервиса permission.Service
+type Svc interface {
+	FindById(id int64) (Response, error)
+	FindAll() ([]Response, error)
+	CreatePermission(actor audit.Actor, request CreateRequest) (int64, error)
+	UpdatePermission(actor audit.Actor, id int64, request UpdateRequest) (Response, error)
+	Delete(actor audit.Actor, id int64) error
+	FindByRoleId(roleId int64) ([]Response, error)
+	FindByEmployeeId(employeeId int64) ([]Response, error)
+	GrantToRole(actor audit.Actor, roleId int64, permissionId int64) error
+	RevokeFromRole(actor audit.Actor, roleId int64, permissionId int64) error
+}
+
+func NewController(server *web.Server, permissionService Svc) *Controller {
+	return &Controller{
+		server:            server,
+		permissionService: permissionService,
+		validate:          validator.New(),
+	}
+}
+
+// функция для регистрации маршрутов
+func (c *Controller) RegisterRoutes() {
+
+	read := c.server.Require("permissions:read")
+	write := c.server.Require("permissions:write")
+
+	// полный маршрут получится "/api/v1/permissions"
+	c.server.GroupApiV1.Post("/permissions", write, c.CreatePermission)
+	c.server.GroupApiV1.Get("/permissions", read, c.FindAll)
+	c.server.GroupApiV1.Get("/permissions/:id", read, c.FindById)
+	c.server.GroupApiV1.Put("/permissions/:id", write, c.UpdatePermission)
+	c.server.GroupApiV1.Delete("/permissions/:id", write, c.DeletePermission)
+
+	// права, выданные роли
+	c.server.GroupApiV1.Get("/roles/:id/permissions", read, c.FindByRoleId)
+	c.server.GroupApiV1.Put("/roles/:id/permissions/:permissionId", write, c.GrantToRole)
+	c.server.GroupApiV1.Delete("/roles/:id/permissions/:permissionId", write, c.RevokeFromRole)
+
+	// эффективный набор прав сотрудника через все его роли
+	c.server.GroupApiV1.Get("/employees/:id/permissions", read, c.FindByEmployeeId)
+}
+
+// функция-хендлер для POST запроса по маршруту "/api/v1/permissions"
+func (c *Controller) CreatePermission(ctx *fiber.Ctx) {
+	var request CreateRequest
+	if err := ctx.BodyParser(&request); err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := c.validate.Validate(request); err != nil {
+		var reqErr common.RequestValidationError
+		if errors.As(err, &reqErr) {
+			_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+			return
+		}
+
+		// Если ошибка не RequestValidationError — InternalServerError и т.п.
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "internal validation error")
+		return
+	}
+
+	var newPermissionId, err = c.permissionService.CreatePermission(audit.ActorFrom(c.server, ctx), request)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, newPermissionId)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning created permission id")
+		return
+	}
+}
+
+// функция-хендлер для GET запроса по маршруту "/api/v1/permissions"
+func (c *Controller) FindAll(ctx *fiber.Ctx) {
+	permissions, err := c.permissionService.FindAll()
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, permissions)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning permissions")
+		return
+	}
+}
+
+// функция-хендлер для GET запроса по маршруту "/api/v1/permissions/:id"
+func (c *Controller) FindById(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	permission, err := c.permissionService.FindById(id)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, permission)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning permission")
+		return
+	}
+}
+
+// функция-хендлер для PUT запроса по маршруту "/api/v1/permissions/:id"
+func (c *Controller) UpdatePermission(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	var request UpdateRequest
+	if err := ctx.BodyParser(&request); err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	permission, err := c.permissionService.UpdatePermission(audit.ActorFrom(c.server, ctx), id, request)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, permission)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning updated permission")
+		return
+	}
+}
+
+// функция-хендлер для DELETE запроса по маршруту "/api/v1/permissions/:id"
+func (c *Controller) DeletePermission(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = c.permissionService.Delete(audit.ActorFrom(c.server, ctx), id); err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, id)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning deleted permission id")
+		return
+	}
+}
+
+// функция-хендлер для GET запроса по маршруту "/api/v1/roles/:id/permissions"
+func (c *Controller) FindByRoleId(ctx *fiber.Ctx) {
+	roleId, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	permissions, err := c.permissionService.FindByRoleId(roleId)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, permissions)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning role permissions")
+		return
+	}
+}
+
+// функция-хендлер для PUT запроса по маршруту "/api/v1/roles/:id/permissions/:permissionId"
+func (c *Controller) GrantToRole(ctx *fiber.Ctx) {
+	roleId, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+	permissionId, err := common.ParseId(ctx.Params("permissionId"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = c.permissionService.GrantToRole(audit.ActorFrom(c.server, ctx), roleId, permissionId); err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	// в ответ отдаём актуальный список прав роли
+	permissions, err := c.permissionService.FindByRoleId(roleId)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, permissions)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning role permissions")
+		return
+	}
+}
+
+// функция-хендлер для DELETE запроса по маршруту "/api/v1/roles/:id/permissions/:permissionId"
+func (c *Controller) RevokeFromRole(ctx *fiber.Ctx) {
+	roleId, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+	permissionId, err := common.ParseId(ctx.Params("permissionId"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = c.permissionService.RevokeFromRole(audit.ActorFrom(c.server, ctx), roleId, permissionId); err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, permissionId)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning revoked permission id")
+		return
+	}
+}
+
+// функция-хендлер для GET запроса по маршруту "/api/v1/employees/:id/permissions"
+func (c *Controller) FindByEmployeeId(ctx *fiber.Ctx) {
+	employeeId, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	permissions, err := c.permissionService.FindByEmployeeId(employeeId)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, permissions)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning employee permissions")
+		return
+	}
+}
+
+// errResponse сопоставляет ошибку сервиса с кодом ответа:
+// 400 — ошибки валидации, 403 — выдача права, которого нет у вызывающего, 404 — ресурс не найден,
+// 409 — такое право уже есть, 500 — всё остальное
+func errResponse(ctx *fiber.Ctx, err error) {
+	switch {
+	case errors.As(err, &common.RequestValidationError{}):
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+	case errors.As(err, &common.NotFoundError{}):
+		_ = common.ErrResponse(ctx, fiber.StatusNotFound, err.Error())
+	case errors.As(err, &common.AlreadyExistsError{}):
+		_ = common.ErrResponse(ctx, fiber.StatusConflict, err.Error())
+	case errors.As(err, &common.PermissionDeniedError{}):
+		_ = common.ErrResponse(ctx, fiber.StatusForbidden, err.Error())
+	default:
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+	}
+}
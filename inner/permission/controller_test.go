@@ -0,0 +1,175 @@
+package permission
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gofiber/fiber"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/audit"
+	"idm/inner/common"
+	"idm/inner/web"
+	"net/http/httptest"
+	"testing"
+)
+
+// Объявляем структуру мока сервиса permission.Service
+type MockService struct {
+	mock.Mock
+}
+
+// Реализуем функции мок-сервиса
+func (svc *MockService) FindById(id int64) (Response, error) {
+	args := svc.Called(id)
+	return args.Get(0).(Response), args.Error(1)
+}
+
+func (svc *MockService) FindAll() ([]Response, error) {
+	args := svc.Called()
+	return args.Get(0).([]Response), args.Error(1)
+}
+
+func (svc *MockService) CreatePermission(_ audit.Actor, request CreateRequest) (int64, error) {
+	args := svc.Called(request)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (svc *MockService) UpdatePermission(_ audit.Actor, id int64, request UpdateRequest) (Response, error) {
+	args := svc.Called(id, request)
+	return args.Get(0).(Response), args.Error(1)
+}
+
+func (svc *MockService) Delete(_ audit.Actor, id int64) error {
+	args := svc.Called(id)
+	return args.Error(0)
+}
+
+func (svc *MockService) FindByRoleId(roleId int64) ([]Response, error) {
+	args := svc.Called(roleId)
+	return args.Get(0).([]Response), args.Error(1)
+}
+
+func (svc *MockService) FindByEmployeeId(employeeId int64) ([]Response, error) {
+	args := svc.Called(employeeId)
+	return args.Get(0).([]Response), args.Error(1)
+}
+
+func (svc *MockService) GrantToRole(_ audit.Actor, roleId int64, permissionId int64) error {
+	args := svc.Called(roleId, permissionId)
+	return args.Error(0)
+}
+
+func (svc *MockService) RevokeFromRole(_ audit.Actor, roleId int64, permissionId int64) error {
+	args := svc.Called(roleId, permissionId)
+	return args.Error(0)
+}
+
+func getTestRequestBody(req any) *bytes.Buffer {
+	body, _ := json.Marshal(req)
+	return bytes.NewBuffer(body)
+}
+
+func TestController(t *testing.T) {
+	mockService := new(MockService)
+	server := web.NewServer()
+	controller := NewController(server, mockService)
+	controller.RegisterRoutes()
+
+	t.Run("CreateSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		req := CreateRequest{Resource: "invoice", Action: "approve"}
+		request := httptest.NewRequest(fiber.MethodPost, "/api/v1/permissions", getTestRequestBody(req))
+		request.Header.Set("Content-Type", "application/json")
+		mockService.On("CreatePermission", req).Return(int64(7), nil)
+
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+
+		var response common.Response[int64]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, int64(7), response.Data)
+	})
+
+	t.Run("CreateValidationFailed", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		req := CreateRequest{Resource: "invoice"}
+		request := httptest.NewRequest(fiber.MethodPost, "/api/v1/permissions", getTestRequestBody(req))
+		request.Header.Set("Content-Type", "application/json")
+
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+
+		var response common.Response[any]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+		assert.Contains(t, response.Message, "Action: is required")
+		mockService.AssertNotCalled(t, "CreatePermission", req)
+	})
+
+	t.Run("CreateConflict", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		req := CreateRequest{Resource: "roles", Action: "write"}
+		request := httptest.NewRequest(fiber.MethodPost, "/api/v1/permissions", getTestRequestBody(req))
+		request.Header.Set("Content-Type", "application/json")
+		mockService.On("CreatePermission", req).Return(int64(0), common.AlreadyExistsError{Resource: "permission", ID: "roles:write"})
+
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusConflict, resp.StatusCode)
+	})
+
+	t.Run("FindByIdNotFound", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("FindById", int64(9)).Return(Response{}, common.NotFoundError{Resource: "permission", ID: 9})
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/permissions/9", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("GrantToRoleSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("GrantToRole", int64(2), int64(4)).Return(nil)
+		mockService.On("FindByRoleId", int64(2)).Return([]Response{{Id: 4, Name: "roles:write"}}, nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodPut, "/api/v1/roles/2/permissions/4", nil))
+		assert.NoError(t, err)
+
+		var response common.Response[[]Response]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, "roles:write", response.Data[0].Name)
+	})
+
+	t.Run("RevokeFromRoleNotFound", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("RevokeFromRole", int64(2), int64(4)).Return(common.NotFoundError{Resource: "permission of role 2", ID: 4})
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodDelete, "/api/v1/roles/2/permissions/4", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("EmployeePermissionsSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		permissions := []Response{{Id: 1, Name: "employees:read"}, {Id: 3, Name: "roles:read"}}
+		mockService.On("FindByEmployeeId", int64(3)).Return(permissions, nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/employees/3/permissions", nil))
+		assert.NoError(t, err)
+
+		var response common.Response[[]Response]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, permissions, response.Data)
+	})
+}
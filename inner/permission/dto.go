@@ -0,0 +1,73 @@
+package permission
+
+import "time"
+
+type Entity struct {
+	Id        int64     `db:"id"`
+	Resource  string    `db:"resource"`
+	Action    string    `db:"action"`
+	System    bool      `db:"system"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// Name право в виде пары "resource:action", например "roles:write"
+func (e *Entity) Name() string {
+	return e.Resource + ":" + e.Action
+}
+
+func (e *Entity) toResponse() Response {
+	return Response{
+		Id:        e.Id,
+		Name:      e.Name(),
+		Resource:  e.Resource,
+		Action:    e.Action,
+		System:    e.System,
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.UpdatedAt,
+	}
+}
+
+func toSliceResponse(e []Entity) []Response {
+	responses := make([]Response, len(e))
+	for i := range e {
+		responses[i] = e[i].toResponse()
+	}
+	return responses
+}
+
+type Response struct {
+	Id       int64  `json:"id"`
+	Name     string `json:"name"`
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+	// System право проверяется маршрутами самого сервиса, поэтому его нельзя переименовать или удалить
+	System    bool      `json:"system"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type CreateRequest struct {
+	Resource string `json:"resource" validate:"required,min=2,max=100,excludesall=: "`
+	Action   string `json:"action" validate:"required,min=2,max=100,excludesall=: "`
+}
+
+func (req *CreateRequest) ToEntity() Entity {
+	return Entity{
+		Resource: req.Resource,
+		Action:   req.Action,
+	}
+}
+
+type UpdateRequest struct {
+	Resource string `json:"resource" validate:"required,min=2,max=100,excludesall=: "`
+	Action   string `json:"action" validate:"required,min=2,max=100,excludesall=: "`
+}
+
+func (req *UpdateRequest) ToEntity(id int64) Entity {
+	return Entity{
+		Id:       id,
+		Resource: req.Resource,
+		Action:   req.Action,
+	}
+}
@@ -0,0 +1,159 @@
+package permission
+
+import (
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+)
+
+type Repository struct {
+	db *sqlx.DB
+}
+
+func NewPermissionRepository(dataBase *sqlx.DB) *Repository {
+	return &Repository{db: dataBase}
+}
+
+func (repo *Repository) FindById(id int64) (entity Entity, err error) {
+	err = repo.db.Get(&entity, "SELECT * FROM permission WHERE id=$1", id)
+	return entity, err
+}
+
+func (repo *Repository) FindAll() (listEntity []Entity, err error) {
+	listEntity = []Entity{}
+	err = repo.db.Select(&listEntity, "SELECT * FROM permission ORDER BY resource, action")
+	return listEntity, err
+}
+
+func (repo *Repository) FindByIdTx(tx *sqlx.Tx, id int64) (entity Entity, err error) {
+	err = tx.Get(&entity, "SELECT * FROM permission WHERE id=$1", id)
+	return entity, err
+}
+
+func (repo *Repository) DeleteTx(tx *sqlx.Tx, id int64) error {
+	result, err := tx.Exec("delete from permission where id=$1", id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (repo *Repository) BeginTransaction() (tx *sqlx.Tx, err error) {
+	return repo.db.Beginx()
+}
+
+func (repo *Repository) FindByNameTx(tx *sqlx.Tx, resource string, action string, excludeId int64) (isExists bool, err error) {
+	err = tx.Get(
+		&isExists,
+		"select exists(select 1 from permission where resource = $1 and action = $2 and id <> $3)",
+		resource,
+		action,
+		excludeId,
+	)
+	return isExists, err
+}
+
+func (repo *Repository) SaveTx(tx *sqlx.Tx, permission Entity) (permissionId int64, err error) {
+	err = tx.Get(
+		&permissionId,
+		"insert into permission (resource, action) values ($1, $2) returning id",
+		permission.Resource,
+		permission.Action,
+	)
+	return permissionId, err
+}
+
+func (repo *Repository) UpdateTx(tx *sqlx.Tx, permission Entity) (updated Entity, err error) {
+	err = tx.Get(
+		&updated,
+		"update permission set resource = $1, action = $2, updated_at = now() where id = $3 returning *",
+		permission.Resource,
+		permission.Action,
+		permission.Id,
+	)
+	return updated, err
+}
+
+func (repo *Repository) ExistsRoleById(roleId int64) (isExists bool, err error) {
+	err = repo.db.Get(&isExists, "select exists(select 1 from role where id = $1 and deleted_at is null)", roleId)
+	return isExists, err
+}
+
+func (repo *Repository) ExistsEmployeeById(employeeId int64) (isExists bool, err error) {
+	err = repo.db.Get(&isExists, "select exists(select 1 from employee where id = $1 and deleted_at is null)", employeeId)
+	return isExists, err
+}
+
+// FindAllByRoleId права, выданные роли напрямую
+func (repo *Repository) FindAllByRoleId(roleId int64) (listEntity []Entity, err error) {
+	listEntity = []Entity{}
+	err = repo.db.Select(
+		&listEntity,
+		`select p.* from role_permission rp join permission p on p.id = rp.permission_id
+		where rp.role_id = $1
+		order by p.resource, p.action`,
+		roleId,
+	)
+	return listEntity, err
+}
+
+// FindAllByEmployeeId эффективный набор прав сотрудника — объединение прав всех его ролей
+// и ролей, от которых они наследуются; удалённые роли прав не дают, неактивный сотрудник прав не имеет
+func (repo *Repository) FindAllByEmployeeId(employeeId int64) (listEntity []Entity, err error) {
+	listEntity = []Entity{}
+	err = repo.db.Select(
+		&listEntity,
+		`with recursive lineage(role_id, path) as (
+			select er.role_id, array[er.role_id]
+			from employee_role er
+			join role r on r.id = er.role_id and r.deleted_at is null
+			join employee e on e.id = er.employee_id and e.status = 'active'
+			where er.employee_id = $1
+			union all
+			select rp.parent_id, l.path || rp.parent_id
+			from lineage l
+			join role_parent rp on rp.role_id = l.role_id
+			join role p on p.id = rp.parent_id and p.deleted_at is null
+			where rp.parent_id <> all(l.path)
+		)
+		select distinct p.* from lineage l
+		join role_permission rp on rp.role_id = l.role_id
+		join permission p on p.id = rp.permission_id
+		order by p.resource, p.action`,
+		employeeId,
+	)
+	return listEntity, err
+}
+
+// GrantToRoleTx выдаёт роли право; false — право у роли уже было
+func (repo *Repository) GrantToRoleTx(tx *sqlx.Tx, roleId int64, permissionId int64) (isGranted bool, err error) {
+	result, err := tx.Exec(
+		"insert into role_permission (role_id, permission_id) values ($1, $2) on conflict do nothing",
+		roleId,
+		permissionId,
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (repo *Repository) RevokeFromRoleTx(tx *sqlx.Tx, roleId int64, permissionId int64) (isRevoked bool, err error) {
+	result, err := tx.Exec(
+		"delete from role_permission where role_id = $1 and permission_id = $2",
+		roleId,
+		permissionId,
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
@@ -0,0 +1,52 @@
+package permission
+
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCreateRequestValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  CreateRequest
+		wantErr  bool
+		errField string
+	}{
+		{
+			name:    "valid request",
+			request: CreateRequest{Resource: "invoice", Action: "approve"},
+			wantErr: false,
+		},
+		{
+			name:     "empty resource",
+			request:  CreateRequest{Resource: "", Action: "approve"},
+			wantErr:  true,
+			errField: "Resource",
+		},
+		{
+			name:     "resource with colon",
+			request:  CreateRequest{Resource: "invoice:approve", Action: "read"},
+			wantErr:  true,
+			errField: "Resource",
+		},
+		{
+			name:     "action with space",
+			request:  CreateRequest{Resource: "invoice", Action: "approve all"},
+			wantErr:  true,
+			errField: "Action",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validator.New().Struct(tt.request)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errField)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
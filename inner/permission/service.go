@@ -0,0 +1,314 @@
+package permission
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"idm/inner/audit"
+	"idm/inner/common"
+)
+
+type Service struct {
+	repo      Repo
+	validator Validator
+	auditor   Auditor
+}
+
+func NewService(repo Repo, validator Validator, auditor Auditor) *Service {
+	return &Service{
+		repo:      repo,
+		validator: validator,
+		auditor:   auditor,
+	}
+}
+
+type Validator interface {
+	Validate(request any) error
+}
+
+// Auditor журнал изменений, реализуется audit.Service; запись делается в транзакции изменения
+type Auditor interface {
+	RecordTx(tx *sqlx.Tx, actor audit.Actor, record audit.Record) error
+}
+
+type Repo interface {
+	FindById(id int64) (Entity, error)
+	FindAll() (listEntity []Entity, err error)
+	BeginTransaction() (tx *sqlx.Tx, err error)
+	FindByIdTx(tx *sqlx.Tx, id int64) (entity Entity, err error)
+	DeleteTx(tx *sqlx.Tx, id int64) error
+	FindByNameTx(tx *sqlx.Tx, resource string, action string, excludeId int64) (isExists bool, err error)
+	SaveTx(tx *sqlx.Tx, permission Entity) (permissionId int64, err error)
+	UpdateTx(tx *sqlx.Tx, permission Entity) (updated Entity, err error)
+	ExistsRoleById(roleId int64) (isExists bool, err error)
+	ExistsEmployeeById(employeeId int64) (isExists bool, err error)
+	FindAllByRoleId(roleId int64) (listEntity []Entity, err error)
+	FindAllByEmployeeId(employeeId int64) (listEntity []Entity, err error)
+	GrantToRoleTx(tx *sqlx.Tx, roleId int64, permissionId int64) (isGranted bool, err error)
+	RevokeFromRoleTx(tx *sqlx.Tx, roleId int64, permissionId int64) (isRevoked bool, err error)
+}
+
+func (service *Service) FindById(id int64) (Response, error) {
+	var entity, err = service.repo.FindById(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Response{}, common.NotFoundError{Resource: "permission", ID: id}
+	}
+	if err != nil {
+		return Response{}, fmt.Errorf("error finding permission with id %d: %w", id, err)
+	}
+
+	return entity.toResponse(), nil
+}
+
+func (service *Service) FindAll() ([]Response, error) {
+	var entity, err = service.repo.FindAll()
+	if err != nil {
+		return []Response{}, fmt.Errorf("error finding permissions: %w", err)
+	}
+
+	return toSliceResponse(entity), nil
+}
+
+// Delete удаляет право вместе с его выдачами ролям; системное право удалить нельзя
+func (service *Service) Delete(actor audit.Actor, id int64) (err error) {
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return fmt.Errorf("error delete permission: error creating transaction: %w", err)
+	}
+	current, err := service.findByIdTx(tx, id)
+	if err != nil {
+		return err
+	}
+	if current.System {
+		return common.RequestValidationError{FieldErrors: map[string]string{
+			"id": fmt.Sprintf("permission %s is required by the service and cannot be deleted", current.Name()),
+		}}
+	}
+	if err = service.repo.DeleteTx(tx, id); err != nil {
+		return fmt.Errorf("error delete permission by id: %d: %w", id, err)
+	}
+	return service.recordTx(tx, actor, audit.ActionDelete, id, current.toResponse(), nil)
+}
+
+func (service *Service) CreatePermission(actor audit.Actor, request CreateRequest) (id int64, err error) {
+	if err = service.validator.Validate(request); err != nil {
+		return 0, err
+	}
+	entity := request.ToEntity()
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return 0, fmt.Errorf("error save permission: error creating transaction: %w", err)
+	}
+	isExist, err := service.repo.FindByNameTx(tx, entity.Resource, entity.Action, 0)
+	if err != nil {
+		return 0, fmt.Errorf("error finding permission by name: %s, %w", entity.Name(), err)
+	}
+	if isExist {
+		return 0, common.AlreadyExistsError{Resource: "permission", ID: entity.Name()}
+	}
+	id, err = service.repo.SaveTx(tx, entity)
+	if err != nil {
+		return 0, fmt.Errorf("error creating permission with name: %s %w", entity.Name(), err)
+	}
+	created, err := service.findByIdTx(tx, id)
+	if err != nil {
+		return 0, err
+	}
+	if err = service.recordTx(tx, actor, audit.ActionCreate, id, nil, created.toResponse()); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// UpdatePermission переименовывает право; системное право переименовать нельзя —
+// маршруты сервиса проверяют его по имени и стали бы недоступны
+func (service *Service) UpdatePermission(actor audit.Actor, id int64, request UpdateRequest) (response Response, err error) {
+	if err = service.validator.Validate(request); err != nil {
+		return Response{}, err
+	}
+	entity := request.ToEntity(id)
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return Response{}, fmt.Errorf("error update permission: error creating transaction: %w", err)
+	}
+	current, err := service.findByIdTx(tx, id)
+	if err != nil {
+		return Response{}, err
+	}
+	if current.System && current.Name() != entity.Name() {
+		return Response{}, common.RequestValidationError{FieldErrors: map[string]string{
+			"resource": fmt.Sprintf("permission %s is required by the service and cannot be renamed", current.Name()),
+		}}
+	}
+	isExist, err := service.repo.FindByNameTx(tx, entity.Resource, entity.Action, id)
+	if err != nil {
+		return Response{}, fmt.Errorf("error finding permission by name: %s, %w", entity.Name(), err)
+	}
+	if isExist {
+		return Response{}, common.AlreadyExistsError{Resource: "permission", ID: entity.Name()}
+	}
+	updated, err := service.repo.UpdateTx(tx, entity)
+	if err != nil {
+		return Response{}, fmt.Errorf("error updating permission with id: %d %w", id, err)
+	}
+	if err = service.recordTx(tx, actor, audit.ActionUpdate, id, current.toResponse(), updated.toResponse()); err != nil {
+		return Response{}, err
+	}
+	return updated.toResponse(), nil
+}
+
+// FindByRoleId права, выданные роли
+func (service *Service) FindByRoleId(roleId int64) ([]Response, error) {
+	if err := service.checkRole(roleId); err != nil {
+		return []Response{}, err
+	}
+	entities, err := service.repo.FindAllByRoleId(roleId)
+	if err != nil {
+		return []Response{}, fmt.Errorf("error finding permissions of role with id %d: %w", roleId, err)
+	}
+	return toSliceResponse(entities), nil
+}
+
+// FindByEmployeeId эффективный набор прав сотрудника, полученный через все его роли
+func (service *Service) FindByEmployeeId(employeeId int64) ([]Response, error) {
+	isExist, err := service.repo.ExistsEmployeeById(employeeId)
+	if err != nil {
+		return []Response{}, fmt.Errorf("error finding employee with id %d: %w", employeeId, err)
+	}
+	if !isExist {
+		return []Response{}, common.NotFoundError{Resource: "employee", ID: employeeId}
+	}
+	entities, err := service.repo.FindAllByEmployeeId(employeeId)
+	if err != nil {
+		return []Response{}, fmt.Errorf("error finding permissions of employee with id %d: %w", employeeId, err)
+	}
+	return toSliceResponse(entities), nil
+}
+
+// GrantToRole выдаёт роли право; повторная выдача ничего не меняет. Выдать можно только право,
+// которое есть у самого вызывающего: иначе он выдал бы его роли, которую держит сам
+func (service *Service) GrantToRole(actor audit.Actor, roleId int64, permissionId int64) (err error) {
+	if err = service.checkRole(roleId); err != nil {
+		return err
+	}
+	permission, err := service.FindById(permissionId)
+	if err != nil {
+		return err
+	}
+	if actor.Caller != nil {
+		if err = common.RequireGrantable(actor.Caller, []string{permission.Name}); err != nil {
+			return err
+		}
+	}
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return fmt.Errorf("error granting permission: error creating transaction: %w", err)
+	}
+	isGranted, err := service.repo.GrantToRoleTx(tx, roleId, permissionId)
+	if err != nil {
+		return fmt.Errorf("error granting permission %d to role %d: %w", permissionId, roleId, err)
+	}
+	if !isGranted {
+		return nil
+	}
+	return service.recordTx(tx, actor, audit.ActionGrantToRole, permissionId, nil, roleGrant{RoleId: roleId})
+}
+
+// RevokeFromRole забирает у роли право
+func (service *Service) RevokeFromRole(actor audit.Actor, roleId int64, permissionId int64) (err error) {
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return fmt.Errorf("error revoking permission: error creating transaction: %w", err)
+	}
+	isRevoked, err := service.repo.RevokeFromRoleTx(tx, roleId, permissionId)
+	if err != nil {
+		return fmt.Errorf("error revoking permission %d from role %d: %w", permissionId, roleId, err)
+	}
+	if !isRevoked {
+		return common.NotFoundError{Resource: fmt.Sprintf("permission of role %d", roleId), ID: permissionId}
+	}
+	return service.recordTx(tx, actor, audit.ActionRevokeFromRole, permissionId, roleGrant{RoleId: roleId}, nil)
+}
+
+func (service *Service) checkRole(roleId int64) error {
+	isExist, err := service.repo.ExistsRoleById(roleId)
+	if err != nil {
+		return fmt.Errorf("error finding role with id %d: %w", roleId, err)
+	}
+	if !isExist {
+		return common.NotFoundError{Resource: "role", ID: roleId}
+	}
+	return nil
+}
+
+func (service *Service) findByIdTx(tx *sqlx.Tx, id int64) (Entity, error) {
+	entity, err := service.repo.FindByIdTx(tx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Entity{}, common.NotFoundError{Resource: "permission", ID: id}
+	}
+	if err != nil {
+		return Entity{}, fmt.Errorf("error finding permission with id %d: %w", id, err)
+	}
+	return entity, nil
+}
+
+// roleGrant выдача права роли в журнале аудита
+type roleGrant struct {
+	RoleId int64 `json:"role_id"`
+}
+
+func (service *Service) recordTx(tx *sqlx.Tx, actor audit.Actor, action string, id int64, before any, after any) error {
+	return service.auditor.RecordTx(tx, actor, audit.Record{
+		Action:     action,
+		EntityType: audit.EntityPermission,
+		EntityId:   id,
+		Before:     before,
+		After:      after,
+	})
+}
@@ -0,0 +1,362 @@
+package permission
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/audit"
+	"idm/inner/common"
+	"idm/inner/validator"
+	"slices"
+	"testing"
+	"time"
+)
+
+type MockRepo struct {
+	mock.Mock
+}
+
+func (m *MockRepo) FindById(id int64) (Entity, error) {
+	args := m.Called(id)
+	return args.Get(0).(Entity), args.Error(1)
+}
+
+func (m *MockRepo) FindAll() ([]Entity, error) {
+	args := m.Called()
+	return args.Get(0).([]Entity), args.Error(1)
+}
+
+func (m *MockRepo) BeginTransaction() (*sqlx.Tx, error) {
+	args := m.Called()
+	return args.Get(0).(*sqlx.Tx), args.Error(1)
+}
+
+func (m *MockRepo) FindByIdTx(tx *sqlx.Tx, id int64) (Entity, error) {
+	args := m.Called(tx, id)
+	return args.Get(0).(Entity), args.Error(1)
+}
+
+func (m *MockRepo) DeleteTx(tx *sqlx.Tx, id int64) error {
+	args := m.Called(tx, id)
+	return args.Error(0)
+}
+
+func (m *MockRepo) FindByNameTx(tx *sqlx.Tx, resource string, action string, excludeId int64) (bool, error) {
+	args := m.Called(tx, resource, action, excludeId)
+	return args.Get(0).(bool), args.Error(1)
+}
+
+func (m *MockRepo) SaveTx(tx *sqlx.Tx, entity Entity) (int64, error) {
+	args := m.Called(tx, entity)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepo) UpdateTx(tx *sqlx.Tx, entity Entity) (Entity, error) {
+	args := m.Called(tx, entity)
+	return args.Get(0).(Entity), args.Error(1)
+}
+
+func (m *MockRepo) ExistsRoleById(roleId int64) (bool, error) {
+	args := m.Called(roleId)
+	return args.Get(0).(bool), args.Error(1)
+}
+
+func (m *MockRepo) ExistsEmployeeById(employeeId int64) (bool, error) {
+	args := m.Called(employeeId)
+	return args.Get(0).(bool), args.Error(1)
+}
+
+func (m *MockRepo) FindAllByRoleId(roleId int64) ([]Entity, error) {
+	args := m.Called(roleId)
+	return args.Get(0).([]Entity), args.Error(1)
+}
+
+func (m *MockRepo) FindAllByEmployeeId(employeeId int64) ([]Entity, error) {
+	args := m.Called(employeeId)
+	return args.Get(0).([]Entity), args.Error(1)
+}
+
+func (m *MockRepo) GrantToRoleTx(tx *sqlx.Tx, roleId int64, permissionId int64) (bool, error) {
+	args := m.Called(tx, roleId, permissionId)
+	return args.Get(0).(bool), args.Error(1)
+}
+
+func (m *MockRepo) RevokeFromRoleTx(tx *sqlx.Tx, roleId int64, permissionId int64) (bool, error) {
+	args := m.Called(tx, roleId, permissionId)
+	return args.Get(0).(bool), args.Error(1)
+}
+
+// auditRecorder запоминает записи журнала аудита вместо записи в базу
+type auditRecorder struct {
+	records []audit.Record
+}
+
+func (r *auditRecorder) RecordTx(_ *sqlx.Tx, _ audit.Actor, record audit.Record) error {
+	r.records = append(r.records, record)
+	return nil
+}
+
+var val = validator.New()
+
+func TestServices(t *testing.T) {
+	var a = assert.New(t)
+	var noTx *sqlx.Tx
+
+	t.Run("should return found permission by id", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder))
+		var entity = Entity{Id: 1, Resource: "roles", Action: "write", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+
+		repo.On("FindById", int64(1)).Return(entity, nil)
+		var got, err = svc.FindById(1)
+
+		a.Nil(err)
+		a.Equal(entity.toResponse(), got)
+		a.Equal("roles:write", got.Name)
+	})
+
+	t.Run("should return not found by id", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder))
+
+		repo.On("FindById", int64(9)).Return(Entity{}, sql.ErrNoRows)
+		var _, err = svc.FindById(9)
+
+		a.ErrorAs(err, &common.NotFoundError{})
+	})
+
+	t.Run("should create permission", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var recorder = new(auditRecorder)
+		var svc = NewService(repo, val, recorder)
+		var request = CreateRequest{Resource: "invoice", Action: "approve"}
+		var created = Entity{Id: 7, Resource: "invoice", Action: "approve"}
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByNameTx", noTx, "invoice", "approve", int64(0)).Return(false, nil)
+		repo.On("SaveTx", noTx, request.ToEntity()).Return(int64(7), nil)
+		repo.On("FindByIdTx", noTx, int64(7)).Return(created, nil)
+		var got, err = svc.CreatePermission(audit.Actor{}, request)
+
+		a.Nil(err)
+		a.Equal(int64(7), got)
+		a.Equal([]audit.Record{{
+			Action: audit.ActionCreate, EntityType: audit.EntityPermission, EntityId: 7, After: created.toResponse(),
+		}}, recorder.records)
+	})
+
+	t.Run("should return already exists on duplicate permission", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder))
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByNameTx", noTx, "roles", "write", int64(0)).Return(true, nil)
+		var _, err = svc.CreatePermission(audit.Actor{}, CreateRequest{Resource: "roles", Action: "write"})
+
+		a.ErrorAs(err, &common.AlreadyExistsError{})
+		a.Contains(err.Error(), "roles:write")
+		a.True(repo.AssertNotCalled(t, "SaveTx"))
+	})
+
+	t.Run("should return validation error on invalid permission", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder))
+
+		var _, err = svc.CreatePermission(audit.Actor{}, CreateRequest{Resource: "roles:all", Action: "write"})
+
+		a.ErrorAs(err, &common.RequestValidationError{})
+	})
+
+	t.Run("should update permission", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var recorder = new(auditRecorder)
+		var svc = NewService(repo, val, recorder)
+		var request = UpdateRequest{Resource: "invoice", Action: "reject"}
+		var current = Entity{Id: 7, Resource: "invoice", Action: "approve"}
+		var updated = Entity{Id: 7, Resource: "invoice", Action: "reject"}
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(7)).Return(current, nil)
+		repo.On("FindByNameTx", noTx, "invoice", "reject", int64(7)).Return(false, nil)
+		repo.On("UpdateTx", noTx, request.ToEntity(7)).Return(updated, nil)
+		var got, err = svc.UpdatePermission(audit.Actor{}, 7, request)
+
+		a.Nil(err)
+		a.Equal("invoice:reject", got.Name)
+		a.Equal([]audit.Record{{
+			Action: audit.ActionUpdate, EntityType: audit.EntityPermission, EntityId: 7,
+			Before: current.toResponse(), After: updated.toResponse(),
+		}}, recorder.records)
+	})
+
+	t.Run("should not rename system permission", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var recorder = new(auditRecorder)
+		var svc = NewService(repo, val, recorder)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(4)).Return(Entity{Id: 4, Resource: "roles", Action: "write", System: true}, nil)
+		var _, err = svc.UpdatePermission(audit.Actor{}, 4, UpdateRequest{Resource: "roles", Action: "manage"})
+
+		a.ErrorAs(err, &common.RequestValidationError{})
+		a.Contains(err.Error(), "roles:write")
+		a.True(repo.AssertNotCalled(t, "UpdateTx"))
+		a.Empty(recorder.records)
+	})
+
+	t.Run("should delete permission", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var recorder = new(auditRecorder)
+		var svc = NewService(repo, val, recorder)
+		var current = Entity{Id: 7, Resource: "invoice", Action: "approve"}
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(7)).Return(current, nil)
+		repo.On("DeleteTx", noTx, int64(7)).Return(nil)
+		var err = svc.Delete(audit.Actor{}, 7)
+
+		a.Nil(err)
+		a.Equal([]audit.Record{{
+			Action: audit.ActionDelete, EntityType: audit.EntityPermission, EntityId: 7, Before: current.toResponse(),
+		}}, recorder.records)
+	})
+
+	t.Run("should not delete system permission", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder))
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(4)).Return(Entity{Id: 4, Resource: "roles", Action: "write", System: true}, nil)
+		var err = svc.Delete(audit.Actor{}, 4)
+
+		a.ErrorAs(err, &common.RequestValidationError{})
+		a.True(repo.AssertNotCalled(t, "DeleteTx", noTx, int64(4)))
+	})
+
+	t.Run("should return effective permissions of employee", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder))
+		var entities = []Entity{{Id: 1, Resource: "employees", Action: "read"}, {Id: 3, Resource: "roles", Action: "read"}}
+
+		repo.On("ExistsEmployeeById", int64(3)).Return(true, nil)
+		repo.On("FindAllByEmployeeId", int64(3)).Return(entities, nil)
+		var got, err = svc.FindByEmployeeId(3)
+
+		a.Nil(err)
+		a.Equal(toSliceResponse(entities), got)
+	})
+
+	t.Run("should return not found for permissions of missing employee", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder))
+
+		repo.On("ExistsEmployeeById", int64(9)).Return(false, nil)
+		var _, err = svc.FindByEmployeeId(9)
+
+		a.ErrorAs(err, &common.NotFoundError{})
+		a.True(repo.AssertNotCalled(t, "FindAllByEmployeeId", int64(9)))
+	})
+
+	t.Run("should grant permission to role", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var recorder = new(auditRecorder)
+		var svc = NewService(repo, val, recorder)
+
+		repo.On("ExistsRoleById", int64(2)).Return(true, nil)
+		repo.On("FindById", int64(4)).Return(Entity{Id: 4, Resource: "roles", Action: "write"}, nil)
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("GrantToRoleTx", noTx, int64(2), int64(4)).Return(true, nil)
+		var err = svc.GrantToRole(audit.Actor{}, 2, 4)
+
+		a.Nil(err)
+		a.True(repo.AssertNumberOfCalls(t, "GrantToRoleTx", 1))
+		a.Equal([]audit.Record{{
+			Action: audit.ActionGrantToRole, EntityType: audit.EntityPermission, EntityId: 4, After: roleGrant{RoleId: 2},
+		}}, recorder.records)
+	})
+
+	t.Run("should not record repeated grant", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var recorder = new(auditRecorder)
+		var svc = NewService(repo, val, recorder)
+
+		repo.On("ExistsRoleById", int64(2)).Return(true, nil)
+		repo.On("FindById", int64(4)).Return(Entity{Id: 4, Resource: "roles", Action: "write"}, nil)
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("GrantToRoleTx", noTx, int64(2), int64(4)).Return(false, nil)
+		var err = svc.GrantToRole(audit.Actor{}, 2, 4)
+
+		a.Nil(err)
+		a.Empty(recorder.records)
+	})
+
+	t.Run("should not grant permission the caller does not hold", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder))
+		var actor = audit.Actor{Subject: "7", Caller: grantedPermissions{"permissions:write"}}
+
+		repo.On("ExistsRoleById", int64(2)).Return(true, nil)
+		repo.On("FindById", int64(4)).Return(Entity{Id: 4, Resource: "roles", Action: "write"}, nil)
+		var err = svc.GrantToRole(actor, 2, 4)
+
+		a.Equal(common.PermissionDeniedError{Permissions: []string{"roles:write"}}, err)
+		a.True(repo.AssertNotCalled(t, "BeginTransaction"))
+	})
+
+	t.Run("should not grant permission to missing role", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder))
+
+		repo.On("ExistsRoleById", int64(9)).Return(false, nil)
+		var err = svc.GrantToRole(audit.Actor{}, 9, 4)
+
+		a.ErrorAs(err, &common.NotFoundError{})
+		a.True(repo.AssertNotCalled(t, "BeginTransaction"))
+	})
+
+	t.Run("should return not found when permission was not granted", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder))
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("RevokeFromRoleTx", noTx, int64(2), int64(4)).Return(false, nil)
+		var err = svc.RevokeFromRole(audit.Actor{}, 2, 4)
+
+		a.ErrorAs(err, &common.NotFoundError{})
+	})
+
+	t.Run("should revoke permission from role", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var recorder = new(auditRecorder)
+		var svc = NewService(repo, val, recorder)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("RevokeFromRoleTx", noTx, int64(2), int64(4)).Return(true, nil)
+		var err = svc.RevokeFromRole(audit.Actor{}, 2, 4)
+
+		a.Nil(err)
+		a.Equal([]audit.Record{{
+			Action: audit.ActionRevokeFromRole, EntityType: audit.EntityPermission, EntityId: 4, Before: roleGrant{RoleId: 2},
+		}}, recorder.records)
+	})
+
+	t.Run("should wrap repository error", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder))
+		var err = errors.New("connection refused")
+
+		repo.On("FindAll").Return([]Entity{}, err)
+		var _, got = svc.FindAll()
+
+		a.ErrorIs(got, err)
+	})
+}
+
+// grantedPermissions вызывающий с заданным набором прав
+type grantedPermissions []string
+
+func (permissions grantedPermissions) HasPermission(permission string) (bool, error) {
+	return slices.Contains(permissions, permission), nil
+}
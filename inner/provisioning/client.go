@@ -0,0 +1,149 @@
+package provisioning
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"idm/inner/scim"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RemoteError ответ внешней системы с кодом ошибки
+type RemoteError struct {
+	Status int
+	Detail string
+}
+
+func (err RemoteError) Error() string {
+	return fmt.Sprintf("scim server responded %d: %s", err.Status, err.Detail)
+}
+
+// isNotFound ресурса нет во внешней системе: удалён там вручную или ещё не создан
+func isNotFound(err error) bool {
+	var remoteErr RemoteError
+	return errors.As(err, &remoteErr) && remoteErr.Status == http.StatusNotFound
+}
+
+// Client клиент SCIM 2.0 одной внешней системы
+type Client struct {
+	target Target
+	http   *http.Client
+}
+
+func NewClient(target Target, httpClient *http.Client) *Client {
+	return &Client{target: target, http: httpClient}
+}
+
+// resource ресурс SCIM, из которого нужен только идентификатор
+type resource struct {
+	Id string `json:"id"`
+}
+
+// FindUser идентификатор пользователя по userName; found false — такого нет
+func (client *Client) FindUser(userName string) (id string, found bool, err error) {
+	return client.find("/Users", "userName", userName)
+}
+
+// FindGroup идентификатор группы по displayName; found false — такой нет
+func (client *Client) FindGroup(displayName string) (id string, found bool, err error) {
+	return client.find("/Groups", "displayName", displayName)
+}
+
+func (client *Client) CreateUser(user map[string]any) (id string, err error) {
+	var created resource
+	err = client.do(http.MethodPost, "/Users", user, &created)
+	return created.Id, err
+}
+
+func (client *Client) ReplaceUser(id string, user map[string]any) error {
+	return client.do(http.MethodPut, "/Users/"+url.PathEscape(id), user, nil)
+}
+
+// DeleteUser удаление пользователя; уже отсутствующий пользователь не считается ошибкой
+func (client *Client) DeleteUser(id string) error {
+	err := client.do(http.MethodDelete, "/Users/"+url.PathEscape(id), nil, nil)
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (client *Client) CreateGroup(displayName string) (id string, err error) {
+	group := map[string]any{"schemas": []string{scim.SchemaGroup}, "displayName": displayName}
+	var created resource
+	err = client.do(http.MethodPost, "/Groups", group, &created)
+	return created.Id, err
+}
+
+// AddMember добавление пользователя в группу
+func (client *Client) AddMember(groupId string, userId string) error {
+	value, err := json.Marshal([]scim.Ref{{Value: userId}})
+	if err != nil {
+		return err
+	}
+	return client.patchGroup(groupId, scim.Operation{Op: scim.OpAdd, Path: "members", Value: value})
+}
+
+// RemoveMember исключение пользователя из группы
+func (client *Client) RemoveMember(groupId string, userId string) error {
+	path := fmt.Sprintf("members[value eq %q]", userId)
+	return client.patchGroup(groupId, scim.Operation{Op: scim.OpRemove, Path: path})
+}
+
+func (client *Client) patchGroup(groupId string, operation scim.Operation) error {
+	request := scim.PatchRequest{Schemas: []string{scim.SchemaPatchOp}, Operations: []scim.Operation{operation}}
+	return client.do(http.MethodPatch, "/Groups/"+url.PathEscape(groupId), request, nil)
+}
+
+func (client *Client) find(path string, attribute string, value string) (id string, found bool, err error) {
+	filter := fmt.Sprintf("%s eq %q", attribute, value)
+	var list scim.ListResponse[resource]
+	err = client.do(http.MethodGet, path+"?filter="+url.QueryEscape(filter), nil, &list)
+	if err != nil || len(list.Resources) == 0 {
+		return "", false, err
+	}
+	return list.Resources[0].Id, true, nil
+}
+
+// do запрос к системе; ответ вне 2xx возвращается как RemoteError с detail из тела SCIM-ошибки
+func (client *Client) do(method string, path string, body any, result any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	request, err := http.NewRequest(method, client.target.Url+path, reader)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+client.target.Token)
+	request.Header.Set("Accept", scim.ContentType)
+	if body != nil {
+		request.Header.Set("Content-Type", scim.ContentType)
+	}
+	response, err := client.http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = response.Body.Close() }()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		data, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		var scimErr scim.ErrorResponse
+		detail := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &scimErr) == nil && scimErr.Detail != "" {
+			detail = scimErr.Detail
+		}
+		return RemoteError{Status: response.StatusCode, Detail: detail}
+	}
+	if result == nil || response.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
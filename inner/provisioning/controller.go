@@ -0,0 +1,79 @@
+package provisioning
+
+import (
+	"github.com/gofiber/fiber"
+	"idm/inner/common"
+	"idm/inner/web"
+)
+
+type Controller struct {
+	server              *web.Server
+	provisioningService Svc
+}
+
+// интерфейс сервиса provisioning.Service
+type Svc interface {
+	Deliver(limit int) (Report, error)
+	Reconcile() (Report, error)
+	FindFailed() ([]QueueResponse, error)
+}
+
+func NewController(server *web.Server, provisioningService Svc) *Controller {
+	return &Controller{
+		server:              server,
+		provisioningService: provisioningService,
+	}
+}
+
+// функция для регистрации маршрутов
+func (c *Controller) RegisterRoutes() {
+	// полные пути "/internal/provisioning/..." — для запуска доставки и сверки по расписанию
+	c.server.GroupInternal.Post("/provisioning/deliver", c.Deliver)
+	c.server.GroupInternal.Post("/provisioning/reconcile", c.Reconcile)
+	c.server.GroupInternal.Get("/provisioning/failed", c.FindFailed)
+}
+
+// функция-хендлер для POST запроса по маршруту "/internal/provisioning/deliver"
+func (c *Controller) Deliver(ctx *fiber.Ctx) {
+	report, err := c.provisioningService.Deliver(DefaultBatch)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = common.OkResponse(ctx, report)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning provisioning report")
+		return
+	}
+}
+
+// функция-хендлер для POST запроса по маршруту "/internal/provisioning/reconcile"
+func (c *Controller) Reconcile(ctx *fiber.Ctx) {
+	report, err := c.provisioningService.Reconcile()
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = common.OkResponse(ctx, report)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning provisioning report")
+		return
+	}
+}
+
+// функция-хендлер для GET запроса по маршруту "/internal/provisioning/failed"
+func (c *Controller) FindFailed(ctx *fiber.Ctx) {
+	items, err := c.provisioningService.FindFailed()
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = common.OkResponse(ctx, items)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning failed provisioning")
+		return
+	}
+}
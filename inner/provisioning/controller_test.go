@@ -0,0 +1,77 @@
+package provisioning
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gofiber/fiber"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/common"
+	"idm/inner/web"
+	"net/http/httptest"
+	"testing"
+)
+
+type MockService struct {
+	mock.Mock
+}
+
+func (m *MockService) Deliver(limit int) (Report, error) {
+	args := m.Called(limit)
+	return args.Get(0).(Report), args.Error(1)
+}
+
+func (m *MockService) Reconcile() (Report, error) {
+	args := m.Called()
+	return args.Get(0).(Report), args.Error(1)
+}
+
+func (m *MockService) FindFailed() ([]QueueResponse, error) {
+	args := m.Called()
+	return args.Get(0).([]QueueResponse), args.Error(1)
+}
+
+func TestController(t *testing.T) {
+	var a = assert.New(t)
+
+	t.Run("should deliver queue", func(t *testing.T) {
+		var svc = new(MockService)
+		var server = web.NewServer()
+		NewController(server, svc).RegisterRoutes()
+		svc.On("Deliver", DefaultBatch).Return(Report{Delivered: 2, Failed: 1}, nil)
+
+		var resp, err = server.App.Test(httptest.NewRequest(fiber.MethodPost, "/internal/provisioning/deliver", nil))
+		a.Nil(err)
+
+		var response common.Response[Report]
+		a.Nil(json.NewDecoder(resp.Body).Decode(&response))
+		a.Equal(fiber.StatusOK, resp.StatusCode)
+		a.Equal(Report{Delivered: 2, Failed: 1}, response.Data)
+	})
+
+	t.Run("should reconcile", func(t *testing.T) {
+		var svc = new(MockService)
+		var server = web.NewServer()
+		NewController(server, svc).RegisterRoutes()
+		svc.On("Reconcile").Return(Report{}, errors.New("database is down"))
+
+		var resp, err = server.App.Test(httptest.NewRequest(fiber.MethodPost, "/internal/provisioning/reconcile", nil))
+		a.Nil(err)
+		a.Equal(fiber.StatusInternalServerError, resp.StatusCode)
+	})
+
+	t.Run("should list failed deliveries", func(t *testing.T) {
+		var svc = new(MockService)
+		var server = web.NewServer()
+		NewController(server, svc).RegisterRoutes()
+		svc.On("FindFailed").Return([]QueueResponse{{Id: 1, Target: "crm", EmployeeId: 7, Attempts: 3}}, nil)
+
+		var resp, err = server.App.Test(httptest.NewRequest(fiber.MethodGet, "/internal/provisioning/failed", nil))
+		a.Nil(err)
+
+		var response common.Response[[]QueueResponse]
+		a.Nil(json.NewDecoder(resp.Body).Decode(&response))
+		a.Equal(fiber.StatusOK, resp.StatusCode)
+		a.Len(response.Data, 1)
+	})
+}
@@ -0,0 +1,112 @@
+package provisioning
+
+import (
+	"github.com/lib/pq"
+	"time"
+)
+
+// поля сотрудника, которые можно передавать во внешнюю систему
+const (
+	FieldId     = "id"
+	FieldName   = "name"
+	FieldStatus = "status"
+	// FieldActive true у активного и не удалённого сотрудника
+	FieldActive = "active"
+	// FieldRole название основной роли сотрудника
+	FieldRole = "role"
+)
+
+// DefaultMapping соответствие атрибутов, если у системы оно не задано
+var DefaultMapping = map[string]string{
+	"userName":    FieldName,
+	"displayName": FieldName,
+	"active":      FieldActive,
+	"externalId":  FieldId,
+}
+
+// MaxAttempts после стольких неудачных попыток запись очереди больше не доставляется
+// до следующей сверки или нового изменения сотрудника
+const MaxAttempts = 10
+
+// DefaultBatch количество записей очереди, доставляемых за один проход
+const DefaultBatch = 100
+
+// Target внешняя SCIM-система, в которую передаются изменения сотрудников
+type Target struct {
+	// Name имя системы в очереди и связях; после переименования сотрудники заводятся в ней заново
+	Name string `json:"name" validate:"required,max=100"`
+	// Url базовый адрес SCIM, например https://example.com/scim/v2
+	Url string `json:"url" validate:"required,url"`
+	// Token bearer-токен; вида ${NAME} — берётся из переменной окружения
+	Token string `json:"token" validate:"required"`
+	// Mapping атрибуты пользователя SCIM → поля сотрудника (id, name, status, active, role);
+	// вложенные атрибуты — через точку, например "name.formatted", атрибуты расширений — после URN схемы
+	// через двоеточие. Пусто — DefaultMapping
+	Mapping map[string]string `json:"mapping" validate:"max=50,dive,keys,required,max=100,endkeys,oneof=id name status active role"`
+	// Groups передавать выданные роли как участие в группах с названием роли
+	Groups bool `json:"groups"`
+}
+
+// QueueEntity запись очереди: сотрудника нужно передать в систему Target
+type QueueEntity struct {
+	Id            int64     `db:"id"`
+	Target        string    `db:"target"`
+	EmployeeId    int64     `db:"employee_id"`
+	Action        string    `db:"action"`
+	Version       int       `db:"version"`
+	Attempts      int       `db:"attempts"`
+	NextAttemptAt time.Time `db:"next_attempt_at"`
+	LastError     string    `db:"last_error"`
+	CreatedAt     time.Time `db:"created_at"`
+}
+
+// EmployeeEntity текущее состояние сотрудника для передачи, в том числе мягко удалённого
+type EmployeeEntity struct {
+	Id        int64          `db:"id"`
+	Name      string         `db:"name"`
+	Status    string         `db:"status"`
+	RoleName  *string        `db:"role_name"`
+	DeletedAt *time.Time     `db:"deleted_at"`
+	RoleIds   pq.Int64Array  `db:"role_ids"`
+	RoleNames pq.StringArray `db:"role_names"`
+}
+
+// LinkEntity сотрудник во внешней системе: его идентификатор там и роли, переданные как группы
+type LinkEntity struct {
+	Target     string        `db:"target"`
+	EmployeeId int64         `db:"employee_id"`
+	RemoteId   string        `db:"remote_id"`
+	RoleIds    pq.Int64Array `db:"role_ids"`
+}
+
+// Report итог прохода по очереди или сверки
+type Report struct {
+	Queued    int64 `json:"queued"`
+	Delivered int   `json:"delivered"`
+	Failed    int   `json:"failed"`
+}
+
+// QueueResponse запись очереди в ответе API
+type QueueResponse struct {
+	Id            int64     `json:"id"`
+	Target        string    `json:"target"`
+	EmployeeId    int64     `json:"employee_id"`
+	Action        string    `json:"action"`
+	Attempts      int       `json:"attempts"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	LastError     string    `json:"last_error"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func (e *QueueEntity) toResponse() QueueResponse {
+	return QueueResponse{
+		Id:            e.Id,
+		Target:        e.Target,
+		EmployeeId:    e.EmployeeId,
+		Action:        e.Action,
+		Attempts:      e.Attempts,
+		NextAttemptAt: e.NextAttemptAt,
+		LastError:     e.LastError,
+		CreatedAt:     e.CreatedAt,
+	}
+}
@@ -0,0 +1,134 @@
+package provisioning
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"time"
+)
+
+type Repository struct {
+	db *sqlx.DB
+}
+
+func NewProvisioningRepository(dataBase *sqlx.DB) *Repository {
+	return &Repository{db: dataBase}
+}
+
+// enqueueConflict повторное изменение сотрудника, ещё не доставленного в систему, не добавляет запись,
+// а обновляет существующую: передаётся всегда текущее состояние, и новая версия сразу готова к отправке
+const enqueueConflict = ` ON CONFLICT (target, employee_id) DO UPDATE SET action = excluded.action,
+		version = provisioning_queue.version + 1, attempts = 0, next_attempt_at = now(), last_error = ''`
+
+// EnqueueTx постановка сотрудника в очередь системы в транзакции его изменения
+func (repo *Repository) EnqueueTx(tx *sqlx.Tx, target string, employeeId int64, action string) error {
+	_, err := tx.Exec("INSERT INTO provisioning_queue (target, employee_id, action) VALUES ($1, $2, $3)"+enqueueConflict,
+		target, employeeId, action)
+	return err
+}
+
+// EnqueueRoleTx постановка в очередь системы всех, кому выдана роль, и всех, кто уже передан в её группу,
+// в транзакции изменения роли: после окончательного удаления роли выдач уже нет, а из группы исключить нужно
+func (repo *Repository) EnqueueRoleTx(tx *sqlx.Tx, target string, roleId int64, action string) error {
+	_, err := tx.Exec(`INSERT INTO provisioning_queue (target, employee_id, action)
+		SELECT $1, employee_id, $2 FROM employee_role WHERE role_id = $3
+		UNION SELECT $1, employee_id, $2 FROM provisioning_link WHERE target = $1 AND $3 = ANY(role_ids)`+enqueueConflict,
+		target, action, roleId)
+	return err
+}
+
+// EnqueueAll постановка в очередь системы всех сотрудников, включая удалённых, и всех, кто уже был
+// передан в неё раньше — в том числе окончательно удалённых, чтобы удалить их и там
+func (repo *Repository) EnqueueAll(target string, action string) (count int64, err error) {
+	result, err := repo.db.Exec(`INSERT INTO provisioning_queue (target, employee_id, action)
+		SELECT $1, id, $2 FROM employee
+		UNION SELECT $1, employee_id, $2 FROM provisioning_link WHERE target = $1`+enqueueConflict,
+		target, action)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ClaimDue выборка записей, которым пора доставляться; выбранные откладываются на lease,
+// чтобы параллельный проход их не взял, а при падении процесса они доставились повторно
+func (repo *Repository) ClaimDue(limit int, lease time.Duration) (items []QueueEntity, err error) {
+	items = []QueueEntity{}
+	err = repo.db.Select(&items, `UPDATE provisioning_queue SET next_attempt_at = now() + make_interval(secs => $2)
+		WHERE id IN (SELECT id FROM provisioning_queue WHERE next_attempt_at <= now()
+			ORDER BY next_attempt_at, id LIMIT $1 FOR UPDATE SKIP LOCKED)
+		RETURNING id, target, employee_id, action, version, attempts, next_attempt_at, last_error, created_at`,
+		limit, lease.Seconds())
+	return items, err
+}
+
+// Delivered удаление доставленной записи; если за время доставки сотрудник изменился снова,
+// версия не совпадёт и запись останется для следующего прохода
+func (repo *Repository) Delivered(id int64, version int) error {
+	_, err := repo.db.Exec("DELETE FROM provisioning_queue WHERE id = $1 AND version = $2", id, version)
+	return err
+}
+
+// Failed запись ошибки доставки; nextAttemptAt nil — больше не повторять до нового изменения или сверки
+func (repo *Repository) Failed(id int64, version int, attempts int, nextAttemptAt *time.Time, lastError string) error {
+	_, err := repo.db.Exec(`UPDATE provisioning_queue
+		SET attempts = $3, next_attempt_at = coalesce($4, 'infinity'::timestamptz), last_error = $5
+		WHERE id = $1 AND version = $2`,
+		id, version, attempts, nextAttemptAt, lastError)
+	return err
+}
+
+// FindFailed записи, доставка которых завершилась ошибкой, по порядку id
+func (repo *Repository) FindFailed() (items []QueueEntity, err error) {
+	items = []QueueEntity{}
+	err = repo.db.Select(&items, `SELECT id, target, employee_id, action, version, attempts, next_attempt_at,
+		last_error, created_at FROM provisioning_queue WHERE attempts > 0 ORDER BY id`)
+	return items, err
+}
+
+// FindEmployee сотрудник с ролями, упорядоченными по id; мягко удалённый тоже возвращается,
+// окончательно удалённого нет — sql.ErrNoRows
+func (repo *Repository) FindEmployee(id int64) (employee EmployeeEntity, err error) {
+	err = repo.db.Get(&employee, `SELECT e.id, e.name, e.status, e.deleted_at, r.name AS role_name,
+			array(SELECT g.id FROM employee_role er JOIN role g ON g.id = er.role_id
+				WHERE er.employee_id = e.id AND g.deleted_at IS NULL ORDER BY g.id) AS role_ids,
+			array(SELECT g.name FROM employee_role er JOIN role g ON g.id = er.role_id
+				WHERE er.employee_id = e.id AND g.deleted_at IS NULL ORDER BY g.id) AS role_names
+		FROM employee e LEFT JOIN role r ON r.id = e.role_id AND r.deleted_at IS NULL
+		WHERE e.id = $1`, id)
+	return employee, err
+}
+
+// FindLink связь сотрудника с пользователем системы; нет связи — sql.ErrNoRows
+func (repo *Repository) FindLink(target string, employeeId int64) (link LinkEntity, err error) {
+	err = repo.db.Get(&link, `SELECT target, employee_id, remote_id, role_ids FROM provisioning_link
+		WHERE target = $1 AND employee_id = $2`, target, employeeId)
+	return link, err
+}
+
+func (repo *Repository) SaveLink(link LinkEntity) error {
+	_, err := repo.db.Exec(`INSERT INTO provisioning_link (target, employee_id, remote_id, role_ids)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (target, employee_id) DO UPDATE SET remote_id = excluded.remote_id,
+			role_ids = excluded.role_ids, updated_at = now()`,
+		link.Target, link.EmployeeId, link.RemoteId, pq.Array([]int64(link.RoleIds)))
+	return err
+}
+
+func (repo *Repository) DeleteLink(target string, employeeId int64) error {
+	_, err := repo.db.Exec("DELETE FROM provisioning_link WHERE target = $1 AND employee_id = $2", target, employeeId)
+	return err
+}
+
+// FindGroupLink идентификатор группы системы, соответствующей роли; нет связи — sql.ErrNoRows
+func (repo *Repository) FindGroupLink(target string, roleId int64) (remoteId string, err error) {
+	err = repo.db.Get(&remoteId, "SELECT remote_id FROM provisioning_group_link WHERE target = $1 AND role_id = $2",
+		target, roleId)
+	return remoteId, err
+}
+
+func (repo *Repository) SaveGroupLink(target string, roleId int64, remoteId string) error {
+	_, err := repo.db.Exec(`INSERT INTO provisioning_group_link (target, role_id, remote_id) VALUES ($1, $2, $3)
+		ON CONFLICT (target, role_id) DO UPDATE SET remote_id = excluded.remote_id`,
+		target, roleId, remoteId)
+	return err
+}
@@ -0,0 +1,276 @@
+package provisioning
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"idm/inner/audit"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// ActionReconcile действие записи очереди, поставленной сверкой
+const ActionReconcile = "reconcile"
+
+// lease на сколько откладывается запись, взятая в доставку
+const lease = 5 * time.Minute
+
+type Service struct {
+	repo    Repo
+	targets map[string]Target
+	clients map[string]*Client
+	now     func() time.Time
+}
+
+type Repo interface {
+	EnqueueTx(tx *sqlx.Tx, target string, employeeId int64, action string) error
+	EnqueueRoleTx(tx *sqlx.Tx, target string, roleId int64, action string) error
+	EnqueueAll(target string, action string) (int64, error)
+	ClaimDue(limit int, lease time.Duration) ([]QueueEntity, error)
+	Delivered(id int64, version int) error
+	Failed(id int64, version int, attempts int, nextAttemptAt *time.Time, lastError string) error
+	FindFailed() ([]QueueEntity, error)
+	FindEmployee(id int64) (EmployeeEntity, error)
+	FindLink(target string, employeeId int64) (LinkEntity, error)
+	SaveLink(link LinkEntity) error
+	DeleteLink(target string, employeeId int64) error
+	FindGroupLink(target string, roleId int64) (string, error)
+	SaveGroupLink(target string, roleId int64, remoteId string) error
+}
+
+func NewService(repo Repo, targets []Target, httpClient *http.Client) *Service {
+	service := &Service{
+		repo:    repo,
+		targets: make(map[string]Target, len(targets)),
+		clients: make(map[string]*Client, len(targets)),
+		now:     time.Now,
+	}
+	for _, target := range targets {
+		service.targets[target.Name] = target
+		service.clients[target.Name] = NewClient(target, httpClient)
+	}
+	return service
+}
+
+// RecordTx ставит изменённого сотрудника в очередь каждой системы в транзакции изменения,
+// поэтому изменение не теряется, даже если система недоступна; реализует audit.Recorder.
+// При изменении роли в очередь ставятся её участники: у них меняются название основной роли
+// и группы. Название уже созданной группы в системе не меняется
+func (service *Service) RecordTx(tx *sqlx.Tx, _ audit.Actor, record audit.Record) error {
+	switch record.EntityType {
+	case audit.EntityEmployee:
+		for name := range service.targets {
+			if err := service.repo.EnqueueTx(tx, name, record.EntityId, record.Action); err != nil {
+				return fmt.Errorf("error enqueueing employee %d for %s: %w", record.EntityId, name, err)
+			}
+		}
+	case audit.EntityRole:
+		for name := range service.targets {
+			if err := service.repo.EnqueueRoleTx(tx, name, record.EntityId, record.Action); err != nil {
+				return fmt.Errorf("error enqueueing members of role %d for %s: %w", record.EntityId, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Deliver доставка не более limit записей очереди; ошибка доставки одной записи не останавливает
+// остальные, запись повторяется позже с растущей паузой
+func (service *Service) Deliver(limit int) (report Report, err error) {
+	items, err := service.repo.ClaimDue(limit, lease)
+	if err != nil {
+		return report, fmt.Errorf("error claiming provisioning queue: %w", err)
+	}
+	for _, item := range items {
+		if syncErr := service.sync(item.Target, item.EmployeeId); syncErr != nil {
+			report.Failed++
+			attempts := item.Attempts + 1
+			var next *time.Time
+			if attempts < MaxAttempts {
+				at := service.now().Add(backoff(attempts))
+				next = &at
+			}
+			err = service.repo.Failed(item.Id, item.Version, attempts, next, syncErr.Error())
+		} else {
+			report.Delivered++
+			err = service.repo.Delivered(item.Id, item.Version)
+		}
+		if err != nil {
+			return report, fmt.Errorf("error updating provisioning queue item %d: %w", item.Id, err)
+		}
+	}
+	return report, nil
+}
+
+// Reconcile постановка в очереди всех систем всех сотрудников; догоняет правки во внешних системах
+// и записи, исчерпавшие попытки доставки
+func (service *Service) Reconcile() (report Report, err error) {
+	for name := range service.targets {
+		count, err := service.repo.EnqueueAll(name, ActionReconcile)
+		if err != nil {
+			return report, fmt.Errorf("error enqueueing employees for %s: %w", name, err)
+		}
+		report.Queued += count
+	}
+	return report, nil
+}
+
+// FindFailed записи очереди, доставка которых завершилась ошибкой
+func (service *Service) FindFailed() ([]QueueResponse, error) {
+	items, err := service.repo.FindFailed()
+	if err != nil {
+		return []QueueResponse{}, fmt.Errorf("error finding failed provisioning: %w", err)
+	}
+	responses := make([]QueueResponse, 0, len(items))
+	for _, item := range items {
+		responses = append(responses, item.toResponse())
+	}
+	return responses, nil
+}
+
+// Run доставка очереди каждые interval, пока не закрыт stop; за проход очередь выбирается до конца
+func (service *Service) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for {
+			report, err := service.Deliver(DefaultBatch)
+			if err != nil {
+				fmt.Printf("provisioning delivery error: %v\n", err)
+				break
+			}
+			if report.Delivered+report.Failed < DefaultBatch {
+				break
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// backoff пауза перед попыткой attempts: 30 секунд, удваиваясь, но не больше часа
+func backoff(attempts int) time.Duration {
+	pause := 30 * time.Second
+	for i := 1; i < attempts && pause < time.Hour; i++ {
+		pause *= 2
+	}
+	return min(pause, time.Hour)
+}
+
+// sync передача текущего состояния сотрудника в систему
+func (service *Service) sync(name string, employeeId int64) error {
+	target, ok := service.targets[name]
+	if !ok {
+		return fmt.Errorf("unknown provisioning target %q", name)
+	}
+	client := service.clients[name]
+	link, err := service.repo.FindLink(name, employeeId)
+	linked := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	employee, err := service.repo.FindEmployee(employeeId)
+	if errors.Is(err, sql.ErrNoRows) {
+		// сотрудник удалён окончательно — удаляем и пользователя, если он был создан
+		if !linked {
+			return nil
+		}
+		if err = client.DeleteUser(link.RemoteId); err != nil {
+			return err
+		}
+		return service.repo.DeleteLink(name, employeeId)
+	}
+	if err != nil {
+		return err
+	}
+
+	user := target.userResource(employee)
+	remoteId := link.RemoteId
+	if linked {
+		err = client.ReplaceUser(remoteId, user)
+		if isNotFound(err) {
+			// пользователя удалили во внешней системе — создаём заново, группы тоже
+			linked, link.RoleIds = false, nil
+		} else if err != nil {
+			return err
+		}
+	}
+	if !linked {
+		// пользователь мог быть заведён в системе до подключения: ищем по userName, чтобы не создать дубликат
+		var found bool
+		remoteId, found, err = client.FindUser(userName(user))
+		if err != nil {
+			return err
+		}
+		if found {
+			err = client.ReplaceUser(remoteId, user)
+		} else {
+			remoteId, err = client.CreateUser(user)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	roleIds := []int64(link.RoleIds)
+	if target.Groups {
+		roleIds, err = service.syncGroups(target, client, employee, remoteId, roleIds)
+	}
+	// связь сохраняется и после частичной синхронизации групп, чтобы повтор не создал пользователя снова
+	saveErr := service.repo.SaveLink(LinkEntity{Target: name, EmployeeId: employeeId, RemoteId: remoteId, RoleIds: roleIds})
+	return errors.Join(err, saveErr)
+}
+
+// syncGroups добавление пользователя в группы новых ролей и исключение из групп отозванных;
+// возвращает роли, участие в группах которых уже передано
+func (service *Service) syncGroups(target Target, client *Client, employee EmployeeEntity, remoteId string,
+	synced []int64) ([]int64, error) {
+	for i, roleId := range employee.RoleIds {
+		if slices.Contains(synced, roleId) {
+			continue
+		}
+		groupId, err := service.groupId(target, client, roleId, employee.RoleNames[i])
+		if err == nil {
+			err = client.AddMember(groupId, remoteId)
+		}
+		if err != nil {
+			return synced, err
+		}
+		synced = append(synced, roleId)
+	}
+	for _, roleId := range slices.Clone(synced) {
+		if slices.Contains(employee.RoleIds, roleId) {
+			continue
+		}
+		groupId, err := service.repo.FindGroupLink(target.Name, roleId)
+		if err == nil {
+			err = client.RemoveMember(groupId, remoteId)
+		}
+		if err != nil && !errors.Is(err, sql.ErrNoRows) && !isNotFound(err) {
+			return synced, err
+		}
+		synced = slices.DeleteFunc(synced, func(id int64) bool { return id == roleId })
+	}
+	return synced, nil
+}
+
+// groupId группа системы для роли: по сохранённой связи, по displayName или созданная заново
+func (service *Service) groupId(target Target, client *Client, roleId int64, roleName string) (string, error) {
+	remoteId, err := service.repo.FindGroupLink(target.Name, roleId)
+	if err == nil || !errors.Is(err, sql.ErrNoRows) {
+		return remoteId, err
+	}
+	remoteId, found, err := client.FindGroup(roleName)
+	if err == nil && !found {
+		remoteId, err = client.CreateGroup(roleName)
+	}
+	if err != nil {
+		return "", err
+	}
+	return remoteId, service.repo.SaveGroupLink(target.Name, roleId, remoteId)
+}
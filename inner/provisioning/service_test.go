@@ -0,0 +1,342 @@
+package provisioning
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/audit"
+	"idm/inner/employee"
+	"idm/inner/scim"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+type MockRepo struct {
+	mock.Mock
+}
+
+func (m *MockRepo) EnqueueTx(tx *sqlx.Tx, target string, employeeId int64, action string) error {
+	return m.Called(tx, target, employeeId, action).Error(0)
+}
+
+func (m *MockRepo) EnqueueRoleTx(tx *sqlx.Tx, target string, roleId int64, action string) error {
+	return m.Called(tx, target, roleId, action).Error(0)
+}
+
+func (m *MockRepo) EnqueueAll(target string, action string) (int64, error) {
+	args := m.Called(target, action)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepo) ClaimDue(limit int, lease time.Duration) ([]QueueEntity, error) {
+	args := m.Called(limit, lease)
+	return args.Get(0).([]QueueEntity), args.Error(1)
+}
+
+func (m *MockRepo) Delivered(id int64, version int) error {
+	return m.Called(id, version).Error(0)
+}
+
+func (m *MockRepo) Failed(id int64, version int, attempts int, nextAttemptAt *time.Time, lastError string) error {
+	return m.Called(id, version, attempts, nextAttemptAt, lastError).Error(0)
+}
+
+func (m *MockRepo) FindFailed() ([]QueueEntity, error) {
+	args := m.Called()
+	return args.Get(0).([]QueueEntity), args.Error(1)
+}
+
+func (m *MockRepo) FindEmployee(id int64) (EmployeeEntity, error) {
+	args := m.Called(id)
+	return args.Get(0).(EmployeeEntity), args.Error(1)
+}
+
+func (m *MockRepo) FindLink(target string, employeeId int64) (LinkEntity, error) {
+	args := m.Called(target, employeeId)
+	return args.Get(0).(LinkEntity), args.Error(1)
+}
+
+func (m *MockRepo) SaveLink(link LinkEntity) error {
+	return m.Called(link).Error(0)
+}
+
+func (m *MockRepo) DeleteLink(target string, employeeId int64) error {
+	return m.Called(target, employeeId).Error(0)
+}
+
+func (m *MockRepo) FindGroupLink(target string, roleId int64) (string, error) {
+	args := m.Called(target, roleId)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockRepo) SaveGroupLink(target string, roleId int64, remoteId string) error {
+	return m.Called(target, roleId, remoteId).Error(0)
+}
+
+// scimServer внешняя SCIM-система в памяти: хранит пользователей и группы по id
+// и записывает полученные запросы в виде "METHOD /path"
+type scimServer struct {
+	*httptest.Server
+	users    map[string]map[string]any
+	groups   map[string]string
+	requests []string
+	fail     bool
+}
+
+var filterPattern = regexp.MustCompile(`^(\w+) eq "(.*)"$`)
+
+func newScimServer(t *testing.T) *scimServer {
+	server := &scimServer{users: map[string]map[string]any{}, groups: map[string]string{}}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.handle))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *scimServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	w.Header().Set("Content-Type", scim.ContentType)
+	if s.fail || r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(scim.ErrorResponse{Status: "503", Detail: "maintenance"})
+		return
+	}
+	var body map[string]any
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == http.MethodGet:
+		match := filterPattern.FindStringSubmatch(r.URL.Query().Get("filter"))
+		var found []resource
+		if parts[0] == "Users" {
+			for id, user := range s.users {
+				if user["userName"] == match[2] {
+					found = append(found, resource{Id: id})
+				}
+			}
+		} else {
+			for id, name := range s.groups {
+				if name == match[2] {
+					found = append(found, resource{Id: id})
+				}
+			}
+		}
+		_ = json.NewEncoder(w).Encode(scim.ListResponse[resource]{Resources: found})
+	case r.Method == http.MethodPost:
+		id := fmt.Sprintf("%s-%d", strings.ToLower(parts[0][:1]), len(s.users)+len(s.groups)+1)
+		if parts[0] == "Users" {
+			s.users[id] = body
+		} else {
+			s.groups[id] = body["displayName"].(string)
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(resource{Id: id})
+	case parts[0] == "Users" && s.users[parts[1]] == nil, parts[0] == "Groups" && s.groups[parts[1]] == "":
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodPut:
+		s.users[parts[1]] = body
+		_ = json.NewEncoder(w).Encode(resource{Id: parts[1]})
+	case r.Method == http.MethodDelete:
+		delete(s.users, parts[1])
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func newTestService(repo Repo, server *scimServer, groups bool) *Service {
+	target := Target{Name: "crm", Url: server.URL, Token: "token", Mapping: DefaultMapping, Groups: groups}
+	service := NewService(repo, []Target{target}, server.Client())
+	service.now = func() time.Time { return time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC) }
+	return service
+}
+
+func TestServiceRecordTx(t *testing.T) {
+	var a = assert.New(t)
+
+	t.Run("should enqueue employee changes", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var service = newTestService(repo, newScimServer(t), false)
+		repo.On("EnqueueTx", (*sqlx.Tx)(nil), "crm", int64(7), audit.ActionUpdate).Return(nil)
+
+		var err = service.RecordTx(nil, audit.Actor{}, audit.Record{Action: audit.ActionUpdate, EntityType: audit.EntityEmployee, EntityId: 7})
+
+		a.Nil(err)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("should enqueue role members on role changes", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var service = newTestService(repo, newScimServer(t), false)
+		repo.On("EnqueueRoleTx", (*sqlx.Tx)(nil), "crm", int64(3), audit.ActionDelete).Return(nil)
+
+		var err = service.RecordTx(nil, audit.Actor{}, audit.Record{Action: audit.ActionDelete, EntityType: audit.EntityRole, EntityId: 3})
+
+		a.Nil(err)
+		repo.AssertExpectations(t)
+		repo.AssertNotCalled(t, "EnqueueTx", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestServiceDeliver(t *testing.T) {
+	var a = assert.New(t)
+	var item = QueueEntity{Id: 1, Target: "crm", EmployeeId: 7, Action: audit.ActionCreate, Version: 2}
+	var alice = EmployeeEntity{Id: 7, Name: "alice", Status: employee.StatusActive,
+		RoleIds: pq.Int64Array{1}, RoleNames: pq.StringArray{"Admins"}}
+
+	t.Run("should create user and add it to role group", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var server = newScimServer(t)
+		var service = newTestService(repo, server, true)
+		repo.On("ClaimDue", DefaultBatch, lease).Return([]QueueEntity{item}, nil)
+		repo.On("FindLink", "crm", int64(7)).Return(LinkEntity{}, sql.ErrNoRows)
+		repo.On("FindEmployee", int64(7)).Return(alice, nil)
+		repo.On("FindGroupLink", "crm", int64(1)).Return("", sql.ErrNoRows)
+		repo.On("SaveGroupLink", "crm", int64(1), "g-2").Return(nil)
+		repo.On("SaveLink", LinkEntity{Target: "crm", EmployeeId: 7, RemoteId: "u-1", RoleIds: pq.Int64Array{1}}).Return(nil)
+		repo.On("Delivered", int64(1), 2).Return(nil)
+
+		var report, err = service.Deliver(DefaultBatch)
+
+		a.Nil(err)
+		a.Equal(Report{Delivered: 1}, report)
+		a.Equal("alice", server.users["u-1"]["userName"])
+		a.Equal("7", server.users["u-1"]["externalId"])
+		a.Equal("Admins", server.groups["g-2"])
+		a.Equal([]string{"GET /Users", "POST /Users", "GET /Groups", "POST /Groups", "PATCH /Groups/g-2"}, server.requests)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("should link user created before connection by userName", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var server = newScimServer(t)
+		server.users["u-9"] = map[string]any{"userName": "alice"}
+		var service = newTestService(repo, server, false)
+		repo.On("ClaimDue", DefaultBatch, lease).Return([]QueueEntity{item}, nil)
+		repo.On("FindLink", "crm", int64(7)).Return(LinkEntity{}, sql.ErrNoRows)
+		repo.On("FindEmployee", int64(7)).Return(alice, nil)
+		repo.On("SaveLink", LinkEntity{Target: "crm", EmployeeId: 7, RemoteId: "u-9"}).Return(nil)
+		repo.On("Delivered", int64(1), 2).Return(nil)
+
+		var _, err = service.Deliver(DefaultBatch)
+
+		a.Nil(err)
+		a.Equal([]string{"GET /Users", "PUT /Users/u-9"}, server.requests)
+		a.Equal(true, server.users["u-9"]["active"])
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("should recreate user deleted remotely", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var server = newScimServer(t)
+		var service = newTestService(repo, server, false)
+		repo.On("ClaimDue", DefaultBatch, lease).Return([]QueueEntity{item}, nil)
+		repo.On("FindLink", "crm", int64(7)).Return(LinkEntity{Target: "crm", EmployeeId: 7, RemoteId: "gone"}, nil)
+		repo.On("FindEmployee", int64(7)).Return(alice, nil)
+		repo.On("SaveLink", LinkEntity{Target: "crm", EmployeeId: 7, RemoteId: "u-1"}).Return(nil)
+		repo.On("Delivered", int64(1), 2).Return(nil)
+
+		var _, err = service.Deliver(DefaultBatch)
+
+		a.Nil(err)
+		a.Equal([]string{"PUT /Users/gone", "GET /Users", "POST /Users"}, server.requests)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("should remove revoked role and deactivate deleted employee", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var server = newScimServer(t)
+		server.users["u-1"] = map[string]any{"userName": "alice", "active": true}
+		server.groups["g-2"] = "Admins"
+		var service = newTestService(repo, server, true)
+		var deletedAt = time.Now()
+		repo.On("ClaimDue", DefaultBatch, lease).Return([]QueueEntity{item}, nil)
+		repo.On("FindLink", "crm", int64(7)).Return(LinkEntity{Target: "crm", EmployeeId: 7, RemoteId: "u-1", RoleIds: pq.Int64Array{1}}, nil)
+		repo.On("FindEmployee", int64(7)).Return(EmployeeEntity{Id: 7, Name: "alice", Status: employee.StatusActive, DeletedAt: &deletedAt}, nil)
+		repo.On("FindGroupLink", "crm", int64(1)).Return("g-2", nil)
+		repo.On("SaveLink", LinkEntity{Target: "crm", EmployeeId: 7, RemoteId: "u-1", RoleIds: pq.Int64Array{}}).Return(nil)
+		repo.On("Delivered", int64(1), 2).Return(nil)
+
+		var _, err = service.Deliver(DefaultBatch)
+
+		a.Nil(err)
+		a.Equal([]string{"PUT /Users/u-1", "PATCH /Groups/g-2"}, server.requests)
+		a.Equal(false, server.users["u-1"]["active"])
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("should delete purged employee", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var server = newScimServer(t)
+		server.users["u-1"] = map[string]any{"userName": "alice"}
+		var service = newTestService(repo, server, false)
+		repo.On("ClaimDue", DefaultBatch, lease).Return([]QueueEntity{item}, nil)
+		repo.On("FindLink", "crm", int64(7)).Return(LinkEntity{Target: "crm", EmployeeId: 7, RemoteId: "u-1"}, nil)
+		repo.On("FindEmployee", int64(7)).Return(EmployeeEntity{}, sql.ErrNoRows)
+		repo.On("DeleteLink", "crm", int64(7)).Return(nil)
+		repo.On("Delivered", int64(1), 2).Return(nil)
+
+		var _, err = service.Deliver(DefaultBatch)
+
+		a.Nil(err)
+		a.Empty(server.users)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("should retry with backoff when target is down", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var server = newScimServer(t)
+		server.fail = true
+		var service = newTestService(repo, server, false)
+		var next = service.now().Add(2 * time.Minute)
+		repo.On("ClaimDue", DefaultBatch, lease).Return([]QueueEntity{{Id: 1, Target: "crm", EmployeeId: 7, Version: 2, Attempts: 2}}, nil)
+		repo.On("FindLink", "crm", int64(7)).Return(LinkEntity{}, sql.ErrNoRows)
+		repo.On("FindEmployee", int64(7)).Return(alice, nil)
+		repo.On("Failed", int64(1), 2, 3, &next, "scim server responded 503: maintenance").Return(nil)
+
+		var report, err = service.Deliver(DefaultBatch)
+
+		a.Nil(err)
+		a.Equal(Report{Failed: 1}, report)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("should stop retrying after max attempts", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var service = newTestService(repo, newScimServer(t), false)
+		repo.On("ClaimDue", DefaultBatch, lease).
+			Return([]QueueEntity{{Id: 1, Target: "removed", EmployeeId: 7, Version: 1, Attempts: MaxAttempts - 1}}, nil)
+		repo.On("Failed", int64(1), 1, MaxAttempts, (*time.Time)(nil), `unknown provisioning target "removed"`).Return(nil)
+
+		var _, err = service.Deliver(DefaultBatch)
+
+		a.Nil(err)
+		repo.AssertExpectations(t)
+	})
+}
+
+func TestServiceReconcile(t *testing.T) {
+	var a = assert.New(t)
+	var repo = new(MockRepo)
+	var service = newTestService(repo, newScimServer(t), false)
+	repo.On("EnqueueAll", "crm", ActionReconcile).Return(int64(3), nil)
+
+	var report, err = service.Reconcile()
+
+	a.Nil(err)
+	a.Equal(Report{Queued: 3}, report)
+}
+
+func TestBackoff(t *testing.T) {
+	var a = assert.New(t)
+	a.Equal(30*time.Second, backoff(1))
+	a.Equal(2*time.Minute, backoff(3))
+	a.Equal(time.Hour, backoff(MaxAttempts))
+}
@@ -0,0 +1,115 @@
+package provisioning
+
+import (
+	"encoding/json"
+	"fmt"
+	"idm/inner/employee"
+	"idm/inner/scim"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Validator проверка структур по тегам validate, реализуется validator.Validator
+type Validator interface {
+	Validate(request any) error
+}
+
+// LoadTargets читает JSON-массив систем из файла; пустой путь — исходящая синхронизация выключена
+func LoadTargets(path string, validator Validator) ([]Target, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading provisioning targets file %s: %w", path, err)
+	}
+	var targets []Target
+	if err = json.Unmarshal(data, &targets); err != nil {
+		return nil, fmt.Errorf("error parsing provisioning targets file %s: %w", path, err)
+	}
+	names := make(map[string]bool, len(targets))
+	for i := range targets {
+		target := &targets[i]
+		if err = validator.Validate(target); err != nil {
+			return nil, fmt.Errorf("invalid provisioning target %q: %w", target.Name, err)
+		}
+		if names[target.Name] {
+			return nil, fmt.Errorf("duplicate provisioning target %q", target.Name)
+		}
+		names[target.Name] = true
+		if len(target.Mapping) == 0 {
+			target.Mapping = DefaultMapping
+		}
+		if _, ok := target.Mapping["userName"]; !ok {
+			return nil, fmt.Errorf("provisioning target %q: userName must be mapped", target.Name)
+		}
+		target.Url = strings.TrimSuffix(target.Url, "/")
+		target.Token = os.ExpandEnv(target.Token)
+	}
+	return targets, nil
+}
+
+// userResource пользователь SCIM из сотрудника по соответствию атрибутов системы;
+// пустая основная роль не передаётся
+func (target Target) userResource(entity EmployeeEntity) map[string]any {
+	schemas := []string{scim.SchemaUser}
+	resource := map[string]any{}
+	for attribute, field := range target.Mapping {
+		var value any
+		switch field {
+		case FieldId:
+			value = strconv.FormatInt(entity.Id, 10)
+		case FieldName:
+			value = entity.Name
+		case FieldStatus:
+			value = entity.Status
+		case FieldActive:
+			value = entity.Status == employee.StatusActive && entity.DeletedAt == nil
+		case FieldRole:
+			if entity.RoleName == nil {
+				continue
+			}
+			value = *entity.RoleName
+		}
+		path := attributePath(attribute)
+		// расширение схемы перечисляется в schemas, иначе система его атрибуты отбросит
+		if len(path) > 1 && strings.Contains(path[0], ":") && !slices.Contains(schemas, path[0]) {
+			schemas = append(schemas, path[0])
+		}
+		setPath(resource, path, value)
+	}
+	slices.Sort(schemas[1:])
+	resource["schemas"] = schemas
+	return resource
+}
+
+// userName значение userName пользователя, по которому он ищется во внешней системе
+func userName(resource map[string]any) string {
+	name, _ := resource["userName"].(string)
+	return name
+}
+
+// attributePath путь атрибута по RFC 7644: "name.formatted" — вложенный атрибут; атрибут расширения
+// записывается как URN схемы и имя через двоеточие, а в ресурсе лежит в объекте с ключом URN
+func attributePath(attribute string) []string {
+	if strings.HasPrefix(strings.ToLower(attribute), "urn:") {
+		i := strings.LastIndex(attribute, ":")
+		return append([]string{attribute[:i]}, strings.Split(attribute[i+1:], ".")...)
+	}
+	return strings.Split(attribute, ".")
+}
+
+func setPath(resource map[string]any, path []string, value any) {
+	if len(path) == 1 {
+		resource[path[0]] = value
+		return
+	}
+	nested, ok := resource[path[0]].(map[string]any)
+	if !ok {
+		nested = map[string]any{}
+		resource[path[0]] = nested
+	}
+	setPath(nested, path[1:], value)
+}
@@ -0,0 +1,104 @@
+package provisioning
+
+import (
+	"github.com/stretchr/testify/assert"
+	"idm/inner/employee"
+	"idm/inner/scim"
+	"idm/inner/validator"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTargets(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "targets.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadTargets(t *testing.T) {
+	var a = assert.New(t)
+
+	t.Run("should apply default mapping and expand token", func(t *testing.T) {
+		t.Setenv("CRM_SCIM_TOKEN", "secret")
+		var path = writeTargets(t, `[{"name": "crm", "url": "https://crm.example.com/scim/v2/", "token": "${CRM_SCIM_TOKEN}"}]`)
+
+		var targets, err = LoadTargets(path, validator.New())
+
+		a.Nil(err)
+		a.Len(targets, 1)
+		a.Equal("https://crm.example.com/scim/v2", targets[0].Url)
+		a.Equal("secret", targets[0].Token)
+		a.Equal(DefaultMapping, targets[0].Mapping)
+	})
+
+	t.Run("should return nothing without file", func(t *testing.T) {
+		var targets, err = LoadTargets("", validator.New())
+
+		a.Nil(err)
+		a.Empty(targets)
+	})
+
+	t.Run("should reject mapping without userName", func(t *testing.T) {
+		var path = writeTargets(t, `[{"name": "crm", "url": "https://crm.example.com", "token": "t",
+			"mapping": {"displayName": "name"}}]`)
+
+		var _, err = LoadTargets(path, validator.New())
+
+		a.ErrorContains(err, "userName must be mapped")
+	})
+
+	t.Run("should reject unknown employee field", func(t *testing.T) {
+		var path = writeTargets(t, `[{"name": "crm", "url": "https://crm.example.com", "token": "t",
+			"mapping": {"userName": "email"}}]`)
+
+		var _, err = LoadTargets(path, validator.New())
+
+		a.NotNil(err)
+	})
+
+	t.Run("should reject duplicate names", func(t *testing.T) {
+		var path = writeTargets(t, `[{"name": "crm", "url": "https://a.example.com", "token": "t"},
+			{"name": "crm", "url": "https://b.example.com", "token": "t"}]`)
+
+		var _, err = LoadTargets(path, validator.New())
+
+		a.ErrorContains(err, "duplicate")
+	})
+}
+
+func TestUserResource(t *testing.T) {
+	var a = assert.New(t)
+	var role = "Admins"
+	var target = Target{Mapping: map[string]string{
+		"userName":       FieldName,
+		"name.formatted": FieldName,
+		"active":         FieldActive,
+		"externalId":     FieldId,
+		"title":          FieldRole,
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber": FieldId,
+	}}
+
+	t.Run("should map fields to nested attributes", func(t *testing.T) {
+		var user = target.userResource(EmployeeEntity{Id: 7, Name: "alice", Status: employee.StatusActive, RoleName: &role})
+
+		a.Equal("alice", user["userName"])
+		a.Equal(map[string]any{"formatted": "alice"}, user["name"])
+		a.Equal(true, user["active"])
+		a.Equal("7", user["externalId"])
+		a.Equal("Admins", user["title"])
+		a.Equal([]string{scim.SchemaUser, "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"}, user["schemas"])
+		a.Equal(map[string]any{"employeeNumber": "7"}, user["urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"])
+	})
+
+	t.Run("should deactivate deleted employee and skip empty role", func(t *testing.T) {
+		var deletedAt = time.Now()
+		var user = target.userResource(EmployeeEntity{Id: 7, Name: "alice", Status: employee.StatusActive, DeletedAt: &deletedAt})
+
+		a.Equal(false, user["active"])
+		a.NotContains(user, "title")
+	})
+}
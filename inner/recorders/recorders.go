@@ -0,0 +1,52 @@
+package recorders
+
+import (
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"idm/inner/audit"
+	"idm/inner/common"
+	"idm/inner/outbox"
+	"idm/inner/provisioning"
+	"idm/inner/validator"
+	"idm/inner/webhook"
+	"net/http"
+	"time"
+)
+
+// Services получатели изменений сотрудников, ролей и прав в транзакции самого изменения: журнал аудита,
+// очередь передачи во внешние SCIM-системы, веб-хуки и outbox. Сервер и утилиты командной строки
+// собирают их здесь, чтобы изменения из любого источника доходили до всех получателей
+type Services struct {
+	Audit        *audit.Service
+	Provisioning *provisioning.Service
+	Webhook      *webhook.Service
+	Outbox       *outbox.Service
+	// Targets и Sinks — настроенные системы и приёмники; без них доставку запускать незачем
+	Targets []provisioning.Target
+	Sinks   []outbox.Sink
+}
+
+func NewServices(db *sqlx.DB, cfg common.Config, validate *validator.Validator) (*Services, error) {
+	targets, err := provisioning.LoadTargets(cfg.ProvisioningTargetsFile, validate)
+	if err != nil {
+		return nil, fmt.Errorf("provisioning configuration error: %w", err)
+	}
+	sinks, err := outbox.LoadSinks(cfg.OutboxSinksFile, validate, &http.Client{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("outbox configuration error: %w", err)
+	}
+	return &Services{
+		Audit: audit.NewService(audit.NewAuditRepository(db), validate),
+		Provisioning: provisioning.NewService(provisioning.NewProvisioningRepository(db), targets,
+			&http.Client{Timeout: 30 * time.Second}),
+		Webhook: webhook.NewService(webhook.NewWebhookRepository(db), validate, webhook.NewHttpClient(10*time.Second)),
+		Outbox:  outbox.NewService(outbox.NewOutboxRepository(db), sinks, cfg.OutboxRetention),
+		Targets: targets,
+		Sinks:   sinks,
+	}, nil
+}
+
+// Recorders все получатели по очереди, первым — журнал аудита; ошибка любого откатывает изменение
+func (services *Services) Recorders() audit.Recorders {
+	return audit.Recorders{services.Audit, services.Provisioning, services.Webhook, services.Outbox}
+}
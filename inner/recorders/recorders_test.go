@@ -0,0 +1,28 @@
+package recorders
+
+import (
+	"github.com/stretchr/testify/assert"
+	"idm/inner/audit"
+	"idm/inner/common"
+	"idm/inner/validator"
+	"testing"
+)
+
+func TestNewServices(t *testing.T) {
+	var a = assert.New(t)
+
+	t.Run("should pass changes to audit log first and then to every recipient", func(t *testing.T) {
+		services, err := NewServices(nil, common.Config{}, validator.New())
+
+		a.NoError(err)
+		a.Empty(services.Targets)
+		a.Empty(services.Sinks)
+		a.Equal(audit.Recorders{services.Audit, services.Provisioning, services.Webhook, services.Outbox}, services.Recorders())
+	})
+
+	t.Run("should fail on missing provisioning targets file", func(t *testing.T) {
+		_, err := NewServices(nil, common.Config{ProvisioningTargetsFile: "missing.json"}, validator.New())
+
+		a.ErrorContains(err, "provisioning configuration error")
+	})
+}
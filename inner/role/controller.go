@@ -3,6 +3,7 @@ package role
 import (
 	"errors"
 	"github.com/gofiber/fiber"
+	"idm/inner/audit"
 	"idm/inner/common"
 	"idm/inner/validator"
 	"idm/inner/web"
@@ -17,7 +18,19 @@ type Controller struct {
 // интерфейс сервиса role.Service
 type Svc interface {
 	FindById(id int64) (Response, error)
-	CreateRole(request CreateRequest) (int64, error)
+	FindPage(request FindRequest) ([]Response, common.Page, error)
+	FindByIdIncludingDeleted(id int64) (Response, error)
+	FindAllByIds(ids []int64) ([]Response, error)
+	CreateRole(actor audit.Actor, request CreateRequest) (int64, error)
+	UpdateRole(actor audit.Actor, id int64, request UpdateRequest) (Response, error)
+	Delete(actor audit.Actor, id int64) error
+	DeleteAllByIds(actor audit.Actor, ids []int64) error
+	Restore(actor audit.Actor, id int64) (Response, error)
+	Purge(actor audit.Actor) ([]int64, error)
+	FindEmployees(id int64) ([]EmployeeResponse, error)
+	SetParents(actor audit.Actor, id int64, request ParentsRequest) error
+	FindAncestors(id int64) ([]HierarchyResponse, error)
+	FindDescendants(id int64) ([]HierarchyResponse, error)
 }
 
 func NewController(server *web.Server, roleService Svc) *Controller {
@@ -31,11 +44,37 @@ func NewController(server *web.Server, roleService Svc) *Controller {
 // функция для регистрации маршрутов
 func (c *Controller) RegisterRoutes() {
 
-	// полный маршрут получится "/api/v1/role"
-	c.server.GroupApiV1.Post("/role", c.CreateRole)
+	read := c.server.Require("roles:read")
+	write := c.server.Require("roles:write")
+	// удалённые роли видят только те, кто может их восстановить
+	restore := c.server.Require("roles:restore")
+	withDeleted := c.server.RequireIf(common.IncludeDeleted, "roles:restore")
+
+	// полный маршрут получится "/api/v1/roles"
+	c.server.GroupApiV1.Post("/roles", write, c.CreateRole)
+	c.server.GroupApiV1.Get("/roles", read, withDeleted, c.FindAll)
+	// "/roles/batch" регистрируется раньше "/roles/:id", иначе "batch" будет разобран как id
+	c.server.GroupApiV1.Get("/roles/batch", read, c.FindAllByIds)
+	c.server.GroupApiV1.Delete("/roles/batch", write, c.DeleteAllByIds)
+	// окончательное удаление ролей, чей срок хранения после мягкого удаления истёк
+	c.server.GroupApiV1.Post("/roles/purge", c.server.Require("roles:purge"), c.Purge)
+	c.server.GroupApiV1.Get("/roles/:id", read, withDeleted, c.FindById)
+	c.server.GroupApiV1.Put("/roles/:id", write, c.UpdateRole)
+	c.server.GroupApiV1.Delete("/roles/:id", write, c.DeleteRole)
+	c.server.GroupApiV1.Post("/roles/:id/restore", restore, c.Restore)
+	c.server.GroupApiV1.Get("/roles/:id/employees", read, c.FindEmployees)
+	c.server.GroupApiV1.Put("/roles/:id/parents", write, c.SetParents)
+	c.server.GroupApiV1.Get("/roles/:id/ancestors", read, c.FindAncestors)
+	c.server.GroupApiV1.Get("/roles/:id/descendants", read, c.FindDescendants)
+
+	// устаревший маршрут "/api/v1/role" оставлен для совместимости со старыми клиентами
+	c.server.GroupApiV1.Post("/role", write, c.CreateRole)
+
+	// полный путь будет "/internal/roles/purge" — для запуска очистки по расписанию
+	c.server.GroupInternal.Post("/roles/purge", c.Purge)
 }
 
-// функция-хендлер, которая будет вызываться при POST запросе по маршруту "/api/v1/role"
+// функция-хендлер, которая будет вызываться при POST запросе по маршруту "/api/v1/roles"
 func (c *Controller) CreateRole(ctx *fiber.Ctx) {
 
 	// анмаршалим JSON body запроса в структуру CreateRequest
@@ -58,17 +97,9 @@ func (c *Controller) CreateRole(ctx *fiber.Ctx) {
 	}
 
 	// вызываем метод CreateRole сервиса role.Service
-	var newRoleId, err = c.roleService.CreateRole(request)
+	var newRoleId, err = c.roleService.CreateRole(audit.ActorFrom(c.server, ctx), request)
 	if err != nil {
-		switch {
-		// если сервис возвращает ошибку RequestValidationError или AlreadyExistsError,
-		// то мы возвращаем ответ с кодом 400 (BadRequest)
-		case errors.As(err, &common.RequestValidationError{}) || errors.As(err, &common.AlreadyExistsError{}):
-			_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
-		// если сервис возвращает другую ошибку, то мы возвращаем ответ с кодом 500 (InternalServerError)
-		default:
-			_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
-		}
+		errResponse(ctx, err)
 		return
 	}
 
@@ -79,3 +110,286 @@ func (c *Controller) CreateRole(ctx *fiber.Ctx) {
 		return
 	}
 }
+
+// функция-хендлер для GET запроса по маршруту
+// "/api/v1/roles?limit=&cursor=&sort=&name=&created_from=&created_to=&include_deleted="
+func (c *Controller) FindAll(ctx *fiber.Ctx) {
+	var request FindRequest
+	if err := ctx.QueryParser(&request); err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+	request.IncludeDeleted = common.IncludeDeleted(ctx)
+
+	roles, page, err := c.roleService.FindPage(request)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.PageResponse(ctx, roles, page)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning roles")
+		return
+	}
+}
+
+// функция-хендлер для GET запроса по маршруту "/api/v1/roles/:id[?include_deleted=true]"
+func (c *Controller) FindById(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	find := c.roleService.FindById
+	if common.IncludeDeleted(ctx) {
+		find = c.roleService.FindByIdIncludingDeleted
+	}
+	role, err := find(id)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, role)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning role")
+		return
+	}
+}
+
+// функция-хендлер для GET запроса по маршруту "/api/v1/roles/batch?ids=1,2,3"
+func (c *Controller) FindAllByIds(ctx *fiber.Ctx) {
+	ids, err := common.ParseIds(ctx.Query("ids"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	roles, err := c.roleService.FindAllByIds(ids)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, roles)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning roles")
+		return
+	}
+}
+
+// функция-хендлер для PUT запроса по маршруту "/api/v1/roles/:id" (переименование роли)
+func (c *Controller) UpdateRole(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	var request UpdateRequest
+	if err := ctx.BodyParser(&request); err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	role, err := c.roleService.UpdateRole(audit.ActorFrom(c.server, ctx), id, request)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, role)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning updated role")
+		return
+	}
+}
+
+// функция-хендлер для DELETE запроса по маршруту "/api/v1/roles/:id"
+func (c *Controller) DeleteRole(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = c.roleService.Delete(audit.ActorFrom(c.server, ctx), id); err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, id)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning deleted role id")
+		return
+	}
+}
+
+// функция-хендлер для DELETE запроса по маршруту "/api/v1/roles/batch?ids=1,2,3"
+func (c *Controller) DeleteAllByIds(ctx *fiber.Ctx) {
+	ids, err := common.ParseIds(ctx.Query("ids"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = c.roleService.DeleteAllByIds(audit.ActorFrom(c.server, ctx), ids); err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, ids)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning deleted role ids")
+		return
+	}
+}
+
+// функция-хендлер для POST запроса по маршруту "/api/v1/roles/:id/restore"
+func (c *Controller) Restore(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	role, err := c.roleService.Restore(audit.ActorFrom(c.server, ctx), id)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, role)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning restored role")
+		return
+	}
+}
+
+// функция-хендлер для POST запроса по маршрутам "/api/v1/roles/purge" и "/internal/roles/purge"
+func (c *Controller) Purge(ctx *fiber.Ctx) {
+	ids, err := c.roleService.Purge(audit.ActorFrom(c.server, ctx))
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, ids)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning purged role ids")
+		return
+	}
+}
+
+// функция-хендлер для GET запроса по маршруту "/api/v1/roles/:id/employees"
+func (c *Controller) FindEmployees(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	employees, err := c.roleService.FindEmployees(id)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, employees)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning role employees")
+		return
+	}
+}
+
+// функция-хендлер для PUT запроса по маршруту "/api/v1/roles/:id/parents";
+// в ответ возвращаются все предки роли с учётом новых родителей
+func (c *Controller) SetParents(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	var request ParentsRequest
+	if err := ctx.BodyParser(&request); err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = c.roleService.SetParents(audit.ActorFrom(c.server, ctx), id, request); err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	ancestors, err := c.roleService.FindAncestors(id)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, ancestors)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning role ancestors")
+		return
+	}
+}
+
+// функция-хендлер для GET запроса по маршруту "/api/v1/roles/:id/ancestors"
+func (c *Controller) FindAncestors(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	ancestors, err := c.roleService.FindAncestors(id)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, ancestors)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning role ancestors")
+		return
+	}
+}
+
+// функция-хендлер для GET запроса по маршруту "/api/v1/roles/:id/descendants"
+func (c *Controller) FindDescendants(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	descendants, err := c.roleService.FindDescendants(id)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, descendants)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning role descendants")
+		return
+	}
+}
+
+// errResponse сопоставляет ошибку сервиса с кодом ответа:
+// 400 — ошибки валидации, 404 — роль не найдена, 409 — роль с таким именем уже есть, 500 — всё остальное
+func errResponse(ctx *fiber.Ctx, err error) {
+	switch {
+	case errors.As(err, &common.RequestValidationError{}):
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+	case errors.As(err, &common.NotFoundError{}):
+		_ = common.ErrResponse(ctx, fiber.StatusNotFound, err.Error())
+	case errors.As(err, &common.AlreadyExistsError{}):
+		_ = common.ErrResponse(ctx, fiber.StatusConflict, err.Error())
+	default:
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+	}
+}
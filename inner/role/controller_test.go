@@ -6,6 +6,7 @@ import (
 	"github.com/gofiber/fiber"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"idm/inner/audit"
 	"idm/inner/common"
 	"idm/inner/web"
 	"net/http/httptest"
@@ -23,11 +24,71 @@ func (svc *MockService) FindById(id int64) (Response, error) {
 	return args.Get(0).(Response), args.Error(1)
 }
 
-func (svc *MockService) CreateRole(request CreateRequest) (int64, error) {
+func (svc *MockService) FindPage(request FindRequest) ([]Response, common.Page, error) {
 	args := svc.Called(request)
+	return args.Get(0).([]Response), args.Get(1).(common.Page), args.Error(2)
+}
+
+func (svc *MockService) FindAllByIds(ids []int64) ([]Response, error) {
+	args := svc.Called(ids)
+	return args.Get(0).([]Response), args.Error(1)
+}
+
+func (svc *MockService) CreateRole(actor audit.Actor, request CreateRequest) (int64, error) {
+	args := svc.Called(actor, request)
 	return args.Get(0).(int64), args.Error(1)
 }
 
+func (svc *MockService) UpdateRole(actor audit.Actor, id int64, request UpdateRequest) (Response, error) {
+	args := svc.Called(actor, id, request)
+	return args.Get(0).(Response), args.Error(1)
+}
+
+func (svc *MockService) Delete(actor audit.Actor, id int64) error {
+	args := svc.Called(actor, id)
+	return args.Error(0)
+}
+
+func (svc *MockService) DeleteAllByIds(actor audit.Actor, ids []int64) error {
+	args := svc.Called(actor, ids)
+	return args.Error(0)
+}
+
+func (svc *MockService) FindEmployees(id int64) ([]EmployeeResponse, error) {
+	args := svc.Called(id)
+	return args.Get(0).([]EmployeeResponse), args.Error(1)
+}
+
+func (svc *MockService) SetParents(actor audit.Actor, id int64, request ParentsRequest) error {
+	args := svc.Called(actor, id, request)
+	return args.Error(0)
+}
+
+func (svc *MockService) FindAncestors(id int64) ([]HierarchyResponse, error) {
+	args := svc.Called(id)
+	return args.Get(0).([]HierarchyResponse), args.Error(1)
+}
+
+func (svc *MockService) FindDescendants(id int64) ([]HierarchyResponse, error) {
+	args := svc.Called(id)
+	return args.Get(0).([]HierarchyResponse), args.Error(1)
+}
+
+func (svc *MockService) FindByIdIncludingDeleted(id int64) (Response, error) {
+	args := svc.Called(id)
+	return args.Get(0).(Response), args.Error(1)
+}
+
+func (svc *MockService) Restore(actor audit.Actor, id int64) (Response, error) {
+	args := svc.Called(actor, id)
+	return args.Get(0).(Response), args.Error(1)
+}
+
+func (svc *MockService) Purge(actor audit.Actor) ([]int64, error) {
+	args := svc.Called(actor)
+	return args.Get(0).([]int64), args.Error(1)
+}
+
 func getTestRequestBody(req CreateRequest) *bytes.Buffer {
 	body, _ := json.Marshal(req)
 	return bytes.NewBuffer(body)
@@ -44,10 +105,10 @@ func TestController(t *testing.T) {
 			Name: "John Doe",
 		}
 		body := getTestRequestBody(req)
-		request := httptest.NewRequest(fiber.MethodPost, "/api/v1/role", body)
+		request := httptest.NewRequest(fiber.MethodPost, "/api/v1/roles", body)
 		request.Header.Set("Content-Type", "application/json")
 
-		mockService.On("CreateRole", req).Return(int64(123), nil)
+		mockService.On("CreateRole", mock.Anything, req).Return(int64(123), nil)
 		actualResp, err := server.App.Test(request)
 		assert.NoError(t, err)
 
@@ -67,10 +128,10 @@ func TestController(t *testing.T) {
 		}
 
 		body := getTestRequestBody(req)
-		request := httptest.NewRequest(fiber.MethodPost, "/api/v1/role", body)
+		request := httptest.NewRequest(fiber.MethodPost, "/api/v1/roles", body)
 		request.Header.Set("Content-Type", "application/json")
 
-		mockService.On("CreateRole", req).Return(int64(123), nil)
+		mockService.On("CreateRole", mock.Anything, req).Return(int64(123), nil)
 		resp, err := server.App.Test(request)
 		assert.NoError(t, err)
 
@@ -90,10 +151,10 @@ func TestController(t *testing.T) {
 		}
 
 		body := getTestRequestBody(req)
-		request := httptest.NewRequest(fiber.MethodPost, "/api/v1/role", body)
+		request := httptest.NewRequest(fiber.MethodPost, "/api/v1/roles", body)
 		request.Header.Set("Content-Type", "application/json")
 
-		mockService.On("CreateRole", req).Return(int64(2), common.AlreadyExistsError{})
+		mockService.On("CreateRole", mock.Anything, req).Return(int64(2), common.AlreadyExistsError{})
 		resp, err := server.App.Test(request)
 
 		assert.NoError(t, err)
@@ -102,7 +163,7 @@ func TestController(t *testing.T) {
 		err = json.NewDecoder(resp.Body).Decode(&response)
 		assert.NoError(t, err)
 
-		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, fiber.StatusConflict, resp.StatusCode)
 		assert.False(t, response.Success)
 		assert.Contains(t, response.Message, "already exists")
 
@@ -115,10 +176,10 @@ func TestController(t *testing.T) {
 		}
 
 		body := getTestRequestBody(req)
-		request := httptest.NewRequest(fiber.MethodPost, "/api/v1/role", body)
+		request := httptest.NewRequest(fiber.MethodPost, "/api/v1/roles", body)
 		request.Header.Set("Content-Type", "application/json")
 
-		mockService.On("CreateRole", req).Return(int64(1), &common.InternalServerError{})
+		mockService.On("CreateRole", mock.Anything, req).Return(int64(1), &common.InternalServerError{})
 
 		resp, err := server.App.Test(request)
 		assert.NoError(t, err)
@@ -132,3 +193,309 @@ func TestController(t *testing.T) {
 		assert.Contains(t, response.Message, "Internal server error")
 	})
 }
+
+func TestControllerCrud(t *testing.T) {
+	mockService := new(MockService)
+	server := web.NewServer()
+	controller := NewController(server, mockService)
+	controller.RegisterRoutes()
+
+	t.Run("CreateOnLegacyRoute", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		req := CreateRequest{Name: "Аналитик"}
+		request := httptest.NewRequest(fiber.MethodPost, "/api/v1/role", getTestRequestBody(req))
+		request.Header.Set("Content-Type", "application/json")
+		mockService.On("CreateRole", mock.Anything, req).Return(int64(4), nil)
+
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("FindAllSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("FindPage", FindRequest{}).
+			Return([]Response{{Id: 1, Name: "Администратор"}, {Id: 2, Name: "Менеджер"}}, common.Page{Total: 3, NextCursor: "next"}, nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/roles", nil))
+		assert.NoError(t, err)
+
+		var response common.Response[[]map[string]any]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Len(t, response.Data, 2)
+		assert.Equal(t, float64(1), response.Data[0]["id"])
+		assert.Equal(t, "Администратор", response.Data[0]["name"])
+		assert.Equal(t, int64(3), response.Page.Total)
+		assert.Equal(t, "next", response.Page.NextCursor)
+	})
+
+	t.Run("FindPageWithFilters", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		request := FindRequest{PageRequest: common.PageRequest{Limit: 10, Sort: "-name"}, Name: "Мен"}
+		mockService.On("FindPage", request).Return([]Response{{Id: 2, Name: "Менеджер"}}, common.Page{Total: 1}, nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/roles?limit=10&sort=-name&name=%D0%9C%D0%B5%D0%BD", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("FindByIdNotFound", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("FindById", int64(5)).Return(Response{}, common.NotFoundError{Resource: "role", ID: 5})
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/roles/5", nil))
+		assert.NoError(t, err)
+
+		var response common.Response[any]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+		assert.Contains(t, response.Message, "not found")
+	})
+
+	t.Run("FindAllByIdsSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("FindAllByIds", []int64{1, 3}).Return([]Response{{Id: 1}, {Id: 3}}, nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/roles/batch?ids=1,3", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("RenameSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		req := UpdateRequest{Name: "Ведущий разработчик"}
+		body, _ := json.Marshal(req)
+		request := httptest.NewRequest(fiber.MethodPut, "/api/v1/roles/3", bytes.NewBuffer(body))
+		request.Header.Set("Content-Type", "application/json")
+		mockService.On("UpdateRole", mock.Anything, int64(3), req).Return(Response{Id: 3, Name: req.Name}, nil)
+
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+
+		var response common.Response[Response]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, req.Name, response.Data.Name)
+	})
+
+	t.Run("RenameConflict", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		req := UpdateRequest{Name: "Менеджер"}
+		body, _ := json.Marshal(req)
+		request := httptest.NewRequest(fiber.MethodPut, "/api/v1/roles/3", bytes.NewBuffer(body))
+		request.Header.Set("Content-Type", "application/json")
+		mockService.On("UpdateRole", mock.Anything, int64(3), req).Return(Response{}, common.AlreadyExistsError{Resource: "role", ID: req.Name})
+
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusConflict, resp.StatusCode)
+	})
+
+	t.Run("DeleteNotFound", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("Delete", mock.Anything, int64(9)).Return(common.NotFoundError{Resource: "role", ID: 9})
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodDelete, "/api/v1/roles/9", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("DeleteAllByIdsSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("DeleteAllByIds", mock.Anything, []int64{1, 2}).Return(nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodDelete, "/api/v1/roles/batch?ids=1,2", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("FindEmployeesSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		employees := []EmployeeResponse{{Id: 3, Name: "Петров Алексей"}}
+		mockService.On("FindEmployees", int64(3)).Return(employees, nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/roles/3/employees", nil))
+		assert.NoError(t, err)
+
+		var response common.Response[[]EmployeeResponse]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, employees, response.Data)
+	})
+
+	t.Run("SetParentsSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		req := ParentsRequest{ParentIds: []int64{3}}
+		body, _ := json.Marshal(req)
+		request := httptest.NewRequest(fiber.MethodPut, "/api/v1/roles/4/parents", bytes.NewBuffer(body))
+		request.Header.Set("Content-Type", "application/json")
+		ancestors := []HierarchyResponse{{Id: 3, Name: "Разработчик", Depth: 1}}
+		mockService.On("SetParents", mock.Anything, int64(4), req).Return(nil)
+		mockService.On("FindAncestors", int64(4)).Return(ancestors, nil)
+
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+
+		var response common.Response[[]HierarchyResponse]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, ancestors, response.Data)
+	})
+
+	t.Run("SetParentsCycle", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		req := ParentsRequest{ParentIds: []int64{4}}
+		body, _ := json.Marshal(req)
+		request := httptest.NewRequest(fiber.MethodPut, "/api/v1/roles/3/parents", bytes.NewBuffer(body))
+		request.Header.Set("Content-Type", "application/json")
+		mockService.On("SetParents", mock.Anything, int64(3), req).
+			Return(common.RequestValidationError{FieldErrors: map[string]string{"parent_ids": "cycle"}})
+
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+		assert.True(t, mockService.AssertNotCalled(t, "FindAncestors", int64(3)))
+	})
+
+	t.Run("FindDescendantsSuccess", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		descendants := []HierarchyResponse{{Id: 4, Name: "Старший разработчик", Depth: 1}}
+		mockService.On("FindDescendants", int64(3)).Return(descendants, nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/roles/3/descendants", nil))
+		assert.NoError(t, err)
+
+		var response common.Response[[]HierarchyResponse]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, descendants, response.Data)
+	})
+
+	t.Run("FindAncestorsNotFound", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("FindAncestors", int64(9)).Return([]HierarchyResponse{}, common.NotFoundError{Resource: "role", ID: 9})
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/roles/9/ancestors", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	})
+}
+
+// denyAuthorizer отказывает во всех правах, кроме перечисленных
+type denyAuthorizer struct {
+	allowed map[string]bool
+}
+
+func (a denyAuthorizer) Authorize(ctx *fiber.Ctx, permission string) {
+	if !a.allowed[permission] {
+		_ = common.ErrResponse(ctx, fiber.StatusForbidden, "permission "+permission+" is required")
+		return
+	}
+	ctx.Next()
+}
+
+func (a denyAuthorizer) HasPermission(_ *fiber.Ctx, permission string) (bool, error) {
+	return a.allowed[permission], nil
+}
+
+func TestControllerPermissions(t *testing.T) {
+	mockService := new(MockService)
+	server := web.NewServer()
+	server.Authorizer = denyAuthorizer{allowed: map[string]bool{"roles:read": true}}
+	controller := NewController(server, mockService)
+	controller.RegisterRoutes()
+
+	t.Run("WriteForbidden", func(t *testing.T) {
+		request := httptest.NewRequest(fiber.MethodPost, "/api/v1/roles", getTestRequestBody(CreateRequest{Name: "Директор"}))
+		request.Header.Set("Content-Type", "application/json")
+
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+
+		var response common.Response[any]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+		assert.False(t, response.Success)
+		assert.Equal(t, "permission roles:write is required", response.Message)
+		assert.True(t, mockService.AssertNotCalled(t, "CreateRole", mock.Anything, mock.Anything))
+	})
+
+	t.Run("DeletedRolesForbidden", func(t *testing.T) {
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/roles/3?include_deleted=true", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+		assert.True(t, mockService.AssertNotCalled(t, "FindByIdIncludingDeleted", int64(3)))
+	})
+
+	t.Run("RestoreForbidden", func(t *testing.T) {
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodPost, "/api/v1/roles/3/restore", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("ReadAllowed", func(t *testing.T) {
+		mockService.On("FindAncestors", int64(3)).Return([]HierarchyResponse{}, nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/roles/3/ancestors", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestControllerSoftDelete(t *testing.T) {
+	mockService := new(MockService)
+	server := web.NewServer()
+	controller := NewController(server, mockService)
+	controller.RegisterRoutes()
+
+	t.Run("FindAllIncludingDeleted", func(t *testing.T) {
+		mockService.On("FindPage", FindRequest{IncludeDeleted: true}).Return([]Response{{Id: 1}, {Id: 4}}, common.Page{Total: 2}, nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/roles?include_deleted=true", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("RestoreNameTaken", func(t *testing.T) {
+		mockService.On("Restore", mock.Anything, int64(4)).Return(Response{}, common.AlreadyExistsError{Resource: "role", ID: "Менеджер"})
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodPost, "/api/v1/roles/4/restore", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusConflict, resp.StatusCode)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		mockService.On("Purge", mock.Anything).Return([]int64{4}, nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodPost, "/api/v1/roles/purge", nil))
+		assert.NoError(t, err)
+
+		var response common.Response[[]int64]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, []int64{4}, response.Data)
+	})
+}
@@ -1,12 +1,16 @@
 package role
 
-import "time"
+import (
+	"idm/inner/common"
+	"time"
+)
 
 type Entity struct {
-	Id        int64     `db:"id"`
-	Name      string    `db:"name"`
-	CreatedAt time.Time `db:"created_at"`
-	UpdatedAt time.Time `db:"updated_at"`
+	Id        int64      `db:"id"`
+	Name      string     `db:"name"`
+	CreatedAt time.Time  `db:"created_at"`
+	UpdatedAt time.Time  `db:"updated_at"`
+	DeletedAt *time.Time `db:"deleted_at"`
 }
 
 func (e *Entity) toResponse() Response {
@@ -15,6 +19,7 @@ func (e *Entity) toResponse() Response {
 		Name:      e.Name,
 		CreatedAt: e.CreatedAt,
 		UpdatedAt: e.UpdatedAt,
+		DeletedAt: e.DeletedAt,
 	}
 }
 
@@ -27,16 +32,130 @@ func toSliceResponse(e []Entity) []Response {
 }
 
 type Response struct {
-	Id        int64     `*json:"id"`
-	Name      string    `*json:"name"`
+	Id        int64     `json:"id"`
+	Name      string    `json:"name"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// DeletedAt заполнено только у мягко удалённых ролей, которые видны с include_deleted=true
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// FindRequest постраничный список ролей с фильтрами из query-параметров;
+// sort — name, created_at или updated_at, время в формате RFC 3339, границы включительно
+type FindRequest struct {
+	common.PageRequest
+	Name        string `query:"name" validate:"omitempty,max=155"`
+	CreatedFrom string `query:"created_from" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	CreatedTo   string `query:"created_to" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	// IncludeDeleted задаётся контроллером по include_deleted после проверки права на удалённые
+	IncludeDeleted bool `query:"-"`
+}
+
+// Filter разобранный FindRequest для репозитория; пустые поля не ограничивают выборку
+type Filter struct {
+	NamePrefix     string
+	CreatedFrom    *time.Time
+	CreatedTo      *time.Time
+	IncludeDeleted bool
+	Sort           common.Sort
+	After          *common.Cursor
+	Limit          int
 }
 
 type CreateRequest struct {
-	Name string `json:"name" validate:"required,min=2,max=155"`
+	Name      string  `json:"name" validate:"required,min=2,max=155"`
+	ParentIds []int64 `json:"parent_ids" validate:"omitempty,max=50,unique,dive,min=1"`
 }
 
 func (req *CreateRequest) ToEntity() Entity {
 	return Entity{Name: req.Name}
 }
+
+type UpdateRequest struct {
+	Name string `json:"name" validate:"required,min=2,max=155"`
+}
+
+func (req *UpdateRequest) ToEntity(id int64) Entity {
+	return Entity{
+		Id:   id,
+		Name: req.Name,
+	}
+}
+
+// MembershipEntity выдача роли сотруднику
+type MembershipEntity struct {
+	RoleId     int64 `db:"role_id"`
+	EmployeeId int64 `db:"employee_id"`
+}
+
+// EmployeeEntity сотрудник, которому выдана роль
+type EmployeeEntity struct {
+	Id        int64     `db:"id"`
+	Name      string    `db:"name"`
+	GrantedAt time.Time `db:"granted_at"`
+}
+
+func (e *EmployeeEntity) toResponse() EmployeeResponse {
+	return EmployeeResponse{
+		Id:        e.Id,
+		Name:      e.Name,
+		GrantedAt: e.GrantedAt,
+	}
+}
+
+func toSliceEmployeeResponse(e []EmployeeEntity) []EmployeeResponse {
+	responses := make([]EmployeeResponse, len(e))
+	for i := range e {
+		responses[i] = e[i].toResponse()
+	}
+	return responses
+}
+
+type EmployeeResponse struct {
+	Id        int64     `json:"id"`
+	Name      string    `json:"name"`
+	GrantedAt time.Time `json:"granted_at"`
+}
+
+// PermissionEntity право, выданное роли напрямую или унаследованное от родительских ролей,
+// в паре с идентификатором роли, через которую оно получено
+type PermissionEntity struct {
+	RoleId   int64  `db:"role_id"`
+	RoleName string `db:"role_name"`
+	Resource string `db:"resource"`
+	Action   string `db:"action"`
+}
+
+// ParentsRequest полный список родительских ролей; пустой список убирает всех родителей
+type ParentsRequest struct {
+	ParentIds []int64 `json:"parent_ids" validate:"required,max=50,unique,dive,min=1"`
+}
+
+// HierarchyEntity роль-предок или роль-потомок; Depth — расстояние до исходной роли
+type HierarchyEntity struct {
+	Id    int64  `db:"id"`
+	Name  string `db:"name"`
+	Depth int64  `db:"depth"`
+}
+
+func (e *HierarchyEntity) toResponse() HierarchyResponse {
+	return HierarchyResponse{
+		Id:    e.Id,
+		Name:  e.Name,
+		Depth: e.Depth,
+	}
+}
+
+func toSliceHierarchyResponse(e []HierarchyEntity) []HierarchyResponse {
+	responses := make([]HierarchyResponse, len(e))
+	for i := range e {
+		responses[i] = e[i].toResponse()
+	}
+	return responses
+}
+
+type HierarchyResponse struct {
+	Id    int64  `json:"id"`
+	Name  string `json:"name"`
+	Depth int64  `json:"depth"`
+}
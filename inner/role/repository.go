@@ -1,8 +1,13 @@
 package role
 
 import (
+	"database/sql"
 	"fmt"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"idm/inner/common"
+	"strings"
+	"time"
 )
 
 type Repository struct {
@@ -14,6 +19,12 @@ func NewRoleRepository(dataBase *sqlx.DB) *Repository {
 }
 
 func (repo *Repository) FindById(id int64) (entity Entity, err error) {
+	err = repo.db.Get(&entity, "SELECT * FROM role WHERE id=$1 AND deleted_at IS NULL", id)
+	return entity, err
+}
+
+// FindByIdIncludingDeleted роль по идентификатору, даже если она мягко удалена
+func (repo *Repository) FindByIdIncludingDeleted(id int64) (entity Entity, err error) {
 	err = repo.db.Get(&entity, "SELECT * FROM role WHERE id=$1", id)
 	return entity, err
 }
@@ -24,15 +35,93 @@ func (repo *Repository) Save(entity Entity) (id int64, err error) {
 }
 
 func (repo *Repository) FindAll() (listEntity []Entity, err error) {
+	err = repo.db.Select(&listEntity, "SELECT * FROM role WHERE deleted_at IS NULL")
+	return listEntity, err
+}
+
+// FindAllIncludingDeleted все роли вместе с мягко удалёнными
+func (repo *Repository) FindAllIncludingDeleted() (listEntity []Entity, err error) {
 	err = repo.db.Select(&listEntity, "SELECT * FROM role")
 	return listEntity, err
 }
 
+// sortColumns поля сортировки списка и их тип для сравнения со значением из курсора
+var sortColumns = map[string]string{
+	"name":       "text",
+	"created_at": "timestamptz",
+	"updated_at": "timestamptz",
+}
+
+// FindPage страница ролей по фильтру; записи после курсора в порядке сортировки, не больше Limit
+func (repo *Repository) FindPage(filter Filter) (listEntity []Entity, err error) {
+	conditions, args := filterConditions(filter)
+	direction, compare := "asc", ">"
+	if filter.Sort.Desc {
+		direction, compare = "desc", "<"
+	}
+	if filter.After != nil {
+		if filter.Sort.Field == "id" {
+			args = append(args, filter.After.Id)
+			conditions = append(conditions, fmt.Sprintf("id %s $%d", compare, len(args)))
+		} else {
+			args = append(args, filter.After.Value, filter.After.Id)
+			conditions = append(conditions, fmt.Sprintf("(%s, id) %s ($%d::%s, $%d)",
+				filter.Sort.Field, compare, len(args)-1, sortColumns[filter.Sort.Field], len(args)))
+		}
+	}
+	query := "SELECT * FROM role" + where(conditions)
+	if filter.Sort.Field == "id" {
+		query += fmt.Sprintf(" ORDER BY id %s", direction)
+	} else {
+		query += fmt.Sprintf(" ORDER BY %s %s, id %s", filter.Sort.Field, direction, direction)
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(" LIMIT $%d", len(args))
+
+	listEntity = []Entity{}
+	err = repo.db.Select(&listEntity, query, args...)
+	return listEntity, err
+}
+
+// Count количество ролей по фильтру без учёта курсора и размера страницы
+func (repo *Repository) Count(filter Filter) (count int64, err error) {
+	conditions, args := filterConditions(filter)
+	err = repo.db.Get(&count, "SELECT count(*) FROM role"+where(conditions), args...)
+	return count, err
+}
+
+func filterConditions(filter Filter) (conditions []string, args []any) {
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if !filter.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+	if filter.NamePrefix != "" {
+		add("name ILIKE $%d", common.LikePrefix(filter.NamePrefix))
+	}
+	if filter.CreatedFrom != nil {
+		add("created_at >= $%d", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		add("created_at <= $%d", *filter.CreatedTo)
+	}
+	return conditions, args
+}
+
+func where(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
 func (repo *Repository) FindAllByIds(ids []int64) (listEntity []Entity, err error) {
 	if len(ids) == 0 {
 		return []Entity{}, nil
 	}
-	query, args, err := sqlx.In("SELECT * FROM role WHERE id IN (?)", ids)
+	query, args, err := sqlx.In("SELECT * FROM role WHERE id IN (?) AND deleted_at IS NULL", ids)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build IN query: %w", err)
 	}
@@ -41,16 +130,27 @@ func (repo *Repository) FindAllByIds(ids []int64) (listEntity []Entity, err erro
 	return listEntity, err
 }
 
+// Delete мягко удаляет роль; уже удалённая считается отсутствующей
 func (repo *Repository) Delete(id int64) error {
-	_, err := repo.db.Exec("delete from role where id=$1", id)
-	return err
+	result, err := repo.db.Exec("update role set deleted_at = now() where id = $1 and deleted_at is null", id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
 func (repo *Repository) DeleteAllByIds(ids []int64) error {
 	if len(ids) == 0 {
 		return nil
 	}
-	query, args, err := sqlx.In("DELETE  FROM role  WHERE ID IN (?)", ids)
+	query, args, err := sqlx.In("UPDATE role SET deleted_at = now() WHERE id IN (?) AND deleted_at IS NULL", ids)
 	if err != nil {
 		return fmt.Errorf("failed to build IN query: %w", err)
 	}
@@ -66,7 +166,7 @@ func (repo *Repository) BeginTransaction() (tx *sqlx.Tx, err error) {
 func (repo *Repository) FindByNameTx(tx *sqlx.Tx, name string) (isExists bool, err error) {
 	err = tx.Get(
 		&isExists,
-		"select exists(select 1 from role where name = $1)",
+		"select exists(select 1 from role where name = $1 and deleted_at is null)",
 		name,
 	)
 	return isExists, err
@@ -80,3 +180,265 @@ func (repo *Repository) SaveTx(tx *sqlx.Tx, role Entity) (roleId int64, err erro
 	)
 	return roleId, err
 }
+
+func (repo *Repository) FindByIdTx(tx *sqlx.Tx, id int64) (entity Entity, err error) {
+	err = tx.Get(&entity, "SELECT * FROM role WHERE id=$1 AND deleted_at IS NULL", id)
+	return entity, err
+}
+
+// DeleteTx мягко удаляет роль и возвращает её последнее состояние. Выдачи роли сотрудникам и
+// клиентам сохраняются, но перестают действовать, пока роль не восстановят
+func (repo *Repository) DeleteTx(tx *sqlx.Tx, id int64) (deleted Entity, err error) {
+	err = tx.Get(&deleted, "update role set deleted_at = now() where id = $1 and deleted_at is null returning *", id)
+	return deleted, err
+}
+
+// DeleteAllByIdsTx мягко удаляет роли и возвращает удалённые; несуществующие и уже удалённые
+// идентификаторы пропускаются
+func (repo *Repository) DeleteAllByIdsTx(tx *sqlx.Tx, ids []int64) (deleted []Entity, err error) {
+	deleted = []Entity{}
+	err = tx.Select(
+		&deleted,
+		`with deleted as (
+			update role set deleted_at = now() where id = any($1) and deleted_at is null returning *
+		)
+		select * from deleted order by id`,
+		pq.Array(ids),
+	)
+	return deleted, err
+}
+
+// RestoreTx снимает отметку об удалении; для неудалённой роли возвращает sql.ErrNoRows
+func (repo *Repository) RestoreTx(tx *sqlx.Tx, id int64) (restored Entity, err error) {
+	err = tx.Get(
+		&restored,
+		"update role set deleted_at = null, updated_at = now() where id = $1 and deleted_at is not null returning *",
+		id,
+	)
+	return restored, err
+}
+
+// PurgeTx окончательно удаляет роли, мягко удалённые раньше deletedBefore, и возвращает их;
+// выдачи и связи иерархии удаляются каскадно, у сотрудников с такой основной ролью она очищается
+func (repo *Repository) PurgeTx(tx *sqlx.Tx, deletedBefore time.Time) (purged []Entity, err error) {
+	purged = []Entity{}
+	err = tx.Select(
+		&purged,
+		"with purged as (delete from role where deleted_at < $1 returning *) select * from purged order by id",
+		deletedBefore,
+	)
+	return purged, err
+}
+
+// FindParentIdsTx идентификаторы непосредственных родителей роли
+func (repo *Repository) FindParentIdsTx(tx *sqlx.Tx, id int64) (ids []int64, err error) {
+	ids = []int64{}
+	err = tx.Select(&ids, "select parent_id from role_parent where role_id = $1 order by parent_id", id)
+	return ids, err
+}
+
+func (repo *Repository) FindByNameAndNotIdTx(tx *sqlx.Tx, name string, id int64) (isExists bool, err error) {
+	err = tx.Get(
+		&isExists,
+		"select exists(select 1 from role where name = $1 and id <> $2 and deleted_at is null)",
+		name,
+		id,
+	)
+	return isExists, err
+}
+
+func (repo *Repository) UpdateTx(tx *sqlx.Tx, role Entity) (updated Entity, err error) {
+	err = tx.Get(
+		&updated,
+		"update role set name = $1, updated_at = now() where id = $2 and deleted_at is null returning *",
+		role.Name,
+		role.Id,
+	)
+	return updated, err
+}
+
+// FindEmployeesByRoleId все сотрудники, которым выдана роль через таблицу employee_role
+func (repo *Repository) FindEmployeesByRoleId(id int64) (employees []EmployeeEntity, err error) {
+	employees = []EmployeeEntity{}
+	err = repo.db.Select(
+		&employees,
+		`select e.id, e.name, er.created_at as granted_at
+		from employee_role er join employee e on e.id = er.employee_id and e.deleted_at is null
+		where er.role_id = $1
+		order by e.id`,
+		id,
+	)
+	return employees, err
+}
+
+// FindActiveMemberships все действующие выдачи ролей одним запросом: без удалённых ролей и сотрудников
+// и только активным сотрудникам, как и роли сотрудника в employee.Repository
+func (repo *Repository) FindActiveMemberships() (memberships []MembershipEntity, err error) {
+	memberships = []MembershipEntity{}
+	err = repo.db.Select(
+		&memberships,
+		`select er.role_id, er.employee_id
+		from employee_role er
+		join role r on r.id = er.role_id and r.deleted_at is null
+		join employee e on e.id = er.employee_id and e.deleted_at is null and e.status = 'active'
+		order by er.role_id, er.employee_id`,
+	)
+	return memberships, err
+}
+
+// FindPermissionsByRoleIds права всех переданных ролей одним запросом, включая права,
+// унаследованные от родительских ролей. Прямые права идут раньше унаследованных;
+// удалённые роли прав не дают и не передают их по наследству
+func (repo *Repository) FindPermissionsByRoleIds(ids []int64) (permissions []PermissionEntity, err error) {
+	permissions = []PermissionEntity{}
+	if len(ids) == 0 {
+		return permissions, nil
+	}
+	query, args, err := sqlx.In(
+		`with recursive lineage(role_id, ancestor_id, depth, path) as (
+			select r.id, r.id, 0, array[r.id] from role r where r.id in (?) and r.deleted_at is null
+			union all
+			select l.role_id, rp.parent_id, l.depth + 1, l.path || rp.parent_id
+			from lineage l
+			join role_parent rp on rp.role_id = l.ancestor_id
+			join role p on p.id = rp.parent_id and p.deleted_at is null
+			where rp.parent_id <> all(l.path)
+		)
+		select r.id as role_id, r.name as role_name, p.resource, p.action
+		from lineage l
+		join role r on r.id = l.role_id
+		join role_permission rp on rp.role_id = l.ancestor_id
+		join permission p on p.id = rp.permission_id
+		order by l.depth, r.id, p.resource, p.action`,
+		ids,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build IN query: %w", err)
+	}
+	query = repo.db.Rebind(query)
+	err = repo.db.Select(&permissions, query, args...)
+	return permissions, err
+}
+
+// FindIdsByNames идентификаторы неудалённых ролей с переданными названиями; неизвестные названия пропускаются
+func (repo *Repository) FindIdsByNames(names []string) (ids []int64, err error) {
+	ids = []int64{}
+	if len(names) == 0 {
+		return ids, nil
+	}
+	query, args, err := sqlx.In("select id from role where name in (?) and deleted_at is null order by id", names)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build IN query: %w", err)
+	}
+	query = repo.db.Rebind(query)
+	err = repo.db.Select(&ids, query, args...)
+	return ids, err
+}
+
+// FindAncestors все роли, от которых роль наследует права, с расстоянием до неё; удалённая роль
+// прерывает цепочку наследования
+func (repo *Repository) FindAncestors(id int64) (roles []HierarchyEntity, err error) {
+	roles = []HierarchyEntity{}
+	err = repo.db.Select(
+		&roles,
+		`with recursive ancestors(id, depth, path) as (
+			select rp.parent_id, 1, array[rp.role_id, rp.parent_id]
+			from role_parent rp join role p on p.id = rp.parent_id and p.deleted_at is null
+			where rp.role_id = $1
+			union all
+			select rp.parent_id, a.depth + 1, a.path || rp.parent_id
+			from ancestors a
+			join role_parent rp on rp.role_id = a.id
+			join role p on p.id = rp.parent_id and p.deleted_at is null
+			where rp.parent_id <> all(a.path)
+		)
+		select r.id, r.name, min(a.depth) as depth
+		from ancestors a join role r on r.id = a.id
+		group by r.id, r.name
+		order by depth, r.id`,
+		id,
+	)
+	return roles, err
+}
+
+// FindDescendants все роли, которые наследуют права роли, с расстоянием до неё; удалённая роль
+// прерывает цепочку наследования
+func (repo *Repository) FindDescendants(id int64) (roles []HierarchyEntity, err error) {
+	roles = []HierarchyEntity{}
+	err = repo.db.Select(
+		&roles,
+		`with recursive descendants(id, depth, path) as (
+			select rp.role_id, 1, array[rp.parent_id, rp.role_id]
+			from role_parent rp join role c on c.id = rp.role_id and c.deleted_at is null
+			where rp.parent_id = $1
+			union all
+			select rp.role_id, d.depth + 1, d.path || rp.role_id
+			from descendants d
+			join role_parent rp on rp.parent_id = d.id
+			join role c on c.id = rp.role_id and c.deleted_at is null
+			where rp.role_id <> all(d.path)
+		)
+		select r.id, r.name, min(d.depth) as depth
+		from descendants d join role r on r.id = d.id
+		group by r.id, r.name
+		order by depth, r.id`,
+		id,
+	)
+	return roles, err
+}
+
+// LockHierarchyTx блокирует изменение иерархии до конца транзакции, чтобы две
+// параллельные правки не образовали цикл, который каждая по отдельности не видит
+func (repo *Repository) LockHierarchyTx(tx *sqlx.Tx) error {
+	_, err := tx.Exec("lock table role_parent in share row exclusive mode")
+	return err
+}
+
+// CountByIdsTx количество существующих неудалённых ролей среди переданных идентификаторов
+func (repo *Repository) CountByIdsTx(tx *sqlx.Tx, ids []int64) (count int64, err error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	query, args, err := sqlx.In("select count(*) from role where id in (?) and deleted_at is null", ids)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build IN query: %w", err)
+	}
+	query = tx.Rebind(query)
+	err = tx.Get(&count, query, args...)
+	return count, err
+}
+
+// FindDescendantIdsTx идентификаторы всех ролей-потомков внутри транзакции. Удалённые роли тоже
+// учитываются: после их восстановления в иерархии не должно оказаться цикла
+func (repo *Repository) FindDescendantIdsTx(tx *sqlx.Tx, id int64) (ids []int64, err error) {
+	ids = []int64{}
+	err = tx.Select(
+		&ids,
+		`with recursive descendants(id, path) as (
+			select rp.role_id, array[rp.parent_id, rp.role_id] from role_parent rp where rp.parent_id = $1
+			union all
+			select rp.role_id, d.path || rp.role_id
+			from descendants d join role_parent rp on rp.parent_id = d.id
+			where rp.role_id <> all(d.path)
+		)
+		select distinct id from descendants`,
+		id,
+	)
+	return ids, err
+}
+
+// ReplaceParentsTx заменяет список родительских ролей роли
+func (repo *Repository) ReplaceParentsTx(tx *sqlx.Tx, id int64, parentIds []int64) error {
+	if _, err := tx.Exec("delete from role_parent where role_id = $1", id); err != nil {
+		return err
+	}
+	if len(parentIds) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(
+		"insert into role_parent (role_id, parent_id) select $1, unnest($2::bigint[])",
+		id,
+		pq.Array(parentIds),
+	)
+	return err
+}
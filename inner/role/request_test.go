@@ -54,3 +54,29 @@ func TestCreateRequestValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestParentsRequestValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		request ParentsRequest
+		wantErr bool
+	}{
+		{name: "valid parents", request: ParentsRequest{ParentIds: []int64{1, 2}}, wantErr: false},
+		{name: "empty list clears parents", request: ParentsRequest{ParentIds: []int64{}}, wantErr: false},
+		{name: "missing list", request: ParentsRequest{}, wantErr: true},
+		{name: "duplicate parents", request: ParentsRequest{ParentIds: []int64{2, 2}}, wantErr: true},
+		{name: "non-positive parent", request: ParentsRequest{ParentIds: []int64{0}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validator.New().Struct(tt.request)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), "ParentIds")
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -1,21 +1,33 @@
 package role
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
-	"github.com/go-playground/validator/v10"
 	"github.com/jmoiron/sqlx"
+	"idm/inner/audit"
 	"idm/inner/common"
+	"slices"
+	"time"
 )
 
 type Service struct {
 	repo      Repo
 	validator Validator
+	auditor   Auditor
+	retention time.Duration
 }
 
-func NewService(repo Repo, validator Validator) *Service {
+// NewService retention — срок хранения мягко удалённых ролей до окончательного удаления
+func NewService(repo Repo, validator Validator, auditor Auditor, retention time.Duration) *Service {
+	if retention <= 0 {
+		retention = common.DefaultPurgeRetention
+	}
 	return &Service{
 		repo:      repo,
 		validator: validator,
+		auditor:   auditor,
+		retention: retention,
 	}
 }
 
@@ -23,20 +35,44 @@ type Validator interface {
 	Validate(request any) error
 }
 
+// Auditor журнал изменений, реализуется audit.Service; запись делается в транзакции изменения
+type Auditor interface {
+	RecordTx(tx *sqlx.Tx, actor audit.Actor, record audit.Record) error
+}
+
 type Repo interface {
 	FindAll() (listEntity []Entity, err error)
 	FindById(id int64) (Entity, error)
+	FindAllIncludingDeleted() (listEntity []Entity, err error)
+	FindPage(filter Filter) (listEntity []Entity, err error)
+	Count(filter Filter) (count int64, err error)
+	FindByIdIncludingDeleted(id int64) (Entity, error)
 	FindAllByIds(ids []int64) (listEntity []Entity, err error)
-	Save(entity Entity) (id int64, err error)
-	Delete(id int64) error
-	DeleteAllByIds(ids []int64) error
 	BeginTransaction() (tx *sqlx.Tx, err error)
+	FindByIdTx(tx *sqlx.Tx, id int64) (entity Entity, err error)
+	DeleteTx(tx *sqlx.Tx, id int64) (deleted Entity, err error)
+	DeleteAllByIdsTx(tx *sqlx.Tx, ids []int64) (deleted []Entity, err error)
+	RestoreTx(tx *sqlx.Tx, id int64) (restored Entity, err error)
+	PurgeTx(tx *sqlx.Tx, deletedBefore time.Time) (purged []Entity, err error)
+	FindParentIdsTx(tx *sqlx.Tx, id int64) (ids []int64, err error)
 	FindByNameTx(tx *sqlx.Tx, name string) (isExists bool, err error)
 	SaveTx(tx *sqlx.Tx, role Entity) (roleId int64, err error)
+	FindByNameAndNotIdTx(tx *sqlx.Tx, name string, id int64) (isExists bool, err error)
+	UpdateTx(tx *sqlx.Tx, role Entity) (updated Entity, err error)
+	FindEmployeesByRoleId(id int64) (employees []EmployeeEntity, err error)
+	FindAncestors(id int64) (roles []HierarchyEntity, err error)
+	FindDescendants(id int64) (roles []HierarchyEntity, err error)
+	LockHierarchyTx(tx *sqlx.Tx) error
+	CountByIdsTx(tx *sqlx.Tx, ids []int64) (count int64, err error)
+	FindDescendantIdsTx(tx *sqlx.Tx, id int64) (ids []int64, err error)
+	ReplaceParentsTx(tx *sqlx.Tx, id int64, parentIds []int64) error
 }
 
 func (service *Service) FindById(id int64) (Response, error) {
 	var entity, err = service.repo.FindById(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Response{}, common.NotFoundError{Resource: "role", ID: id}
+	}
 	if err != nil {
 		return Response{}, fmt.Errorf("error finding role with id %d: %w", id, err)
 	}
@@ -53,6 +89,87 @@ func (service *Service) FindAll() ([]Response, error) {
 	return toSliceResponse(entity), nil
 }
 
+// FindByIdIncludingDeleted роль по идентификатору, в том числе мягко удалённая
+func (service *Service) FindByIdIncludingDeleted(id int64) (Response, error) {
+	var entity, err = service.repo.FindByIdIncludingDeleted(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Response{}, common.NotFoundError{Resource: "role", ID: id}
+	}
+	if err != nil {
+		return Response{}, fmt.Errorf("error finding role with id %d: %w", id, err)
+	}
+
+	return entity.toResponse(), nil
+}
+
+// FindAllIncludingDeleted все роли вместе с мягко удалёнными
+func (service *Service) FindAllIncludingDeleted() ([]Response, error) {
+	var entity, err = service.repo.FindAllIncludingDeleted()
+	if err != nil {
+		return []Response{}, fmt.Errorf("error finding roles: %w", err)
+	}
+
+	return toSliceResponse(entity), nil
+}
+
+// FindPage страница ролей по фильтру, сортировке и курсору вместе с общим количеством по фильтру
+func (service *Service) FindPage(request FindRequest) ([]Response, common.Page, error) {
+	if err := service.validator.Validate(request); err != nil {
+		return []Response{}, common.Page{}, err
+	}
+	sort, err := common.ParseSort(request.Sort, "name", "created_at", "updated_at")
+	if err != nil {
+		return []Response{}, common.Page{}, err
+	}
+	after, err := common.DecodeCursor(request.Cursor, sort)
+	if err != nil {
+		return []Response{}, common.Page{}, err
+	}
+	filter := Filter{
+		NamePrefix:     request.Name,
+		CreatedFrom:    common.ParseTime(request.CreatedFrom),
+		CreatedTo:      common.ParseTime(request.CreatedTo),
+		IncludeDeleted: request.IncludeDeleted,
+		Sort:           sort,
+		After:          after,
+		Limit:          request.Limit,
+	}
+	if filter.Limit == 0 {
+		filter.Limit = common.DefaultPageLimit
+	}
+	total, err := service.repo.Count(filter)
+	if err != nil {
+		return []Response{}, common.Page{}, fmt.Errorf("error counting roles: %w", err)
+	}
+	// на одну запись больше страницы: по ней видно, есть ли следующая
+	limit := filter.Limit
+	filter.Limit++
+	entities, err := service.repo.FindPage(filter)
+	if err != nil {
+		return []Response{}, common.Page{}, fmt.Errorf("error finding roles: %w", err)
+	}
+	page := common.Page{Total: total}
+	if len(entities) > limit {
+		entities = entities[:limit]
+		page.NextCursor = cursorAfter(entities[limit-1], sort).Encode()
+	}
+	return toSliceResponse(entities), page, nil
+}
+
+// cursorAfter курсор, указывающий на позицию сразу после роли
+func cursorAfter(entity Entity, sort common.Sort) common.Cursor {
+	cursor := common.Cursor{Sort: sort.String(), Id: entity.Id}
+	switch sort.Field {
+	case "name":
+		cursor.Value = entity.Name
+	case "created_at":
+		cursor.Value = entity.CreatedAt.Format(time.RFC3339Nano)
+	case "updated_at":
+		cursor.Value = entity.UpdatedAt.Format(time.RFC3339Nano)
+	}
+	return cursor
+}
+
 func (service *Service) FindAllByIds(ids []int64) ([]Response, error) {
 	entity, err := service.repo.FindAllByIds(ids)
 	if err != nil {
@@ -62,34 +179,148 @@ func (service *Service) FindAllByIds(ids []int64) ([]Response, error) {
 	return toSliceResponse(entity), nil
 }
 
-func (service *Service) Save(entity Entity) (int64, error) {
-	var id, err = service.repo.Save(entity)
+func (service *Service) Save(actor audit.Actor, entity Entity) (id int64, err error) {
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return 0, fmt.Errorf("error save role: error creating transaction: %w", err)
+	}
+	id, err = service.repo.SaveTx(tx, entity)
 	if err != nil {
 		return 0, fmt.Errorf("error saving role name: %s: %w", entity.Name, err)
 	}
-
+	if err = service.recordCreatedTx(tx, actor, id); err != nil {
+		return 0, err
+	}
 	return id, nil
 }
 
-func (service *Service) Delete(id int64) error {
-	err := service.repo.Delete(id)
+func (service *Service) Delete(actor audit.Actor, id int64) (err error) {
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return fmt.Errorf("error delete role: error creating transaction: %w", err)
+	}
+	deleted, err := service.repo.DeleteTx(tx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = common.NotFoundError{Resource: "role", ID: id}
+		return err
+	}
 	if err != nil {
 		return fmt.Errorf("error delete role by id: %d: %w", id, err)
 	}
+	return service.recordTx(tx, actor, audit.ActionDelete, id, deleted.toResponse(), nil)
+}
 
+func (service *Service) DeleteAllByIds(actor audit.Actor, ids []int64) (err error) {
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return fmt.Errorf("error delete roles: error creating transaction: %w", err)
+	}
+	deleted, err := service.repo.DeleteAllByIdsTx(tx, ids)
+	if err != nil {
+		return fmt.Errorf("error delete roles by ids: %d: %w", ids, err)
+	}
+	for i := range deleted {
+		if err = service.recordTx(tx, actor, audit.ActionDelete, deleted[i].Id, deleted[i].toResponse(), nil); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (service *Service) DeleteAllByIds(ids []int64) error {
-	err := service.repo.DeleteAllByIds(ids)
+// Restore возвращает мягко удалённую роль вместе с её выдачами; если имя уже занято, восстановление отклоняется
+func (service *Service) Restore(actor audit.Actor, id int64) (response Response, err error) {
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
 	if err != nil {
-		return fmt.Errorf("error delete roles by ids: %d: %w", ids, err)
+		return Response{}, fmt.Errorf("error restore role: error creating transaction: %w", err)
+	}
+	restored, err := service.repo.RestoreTx(tx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = common.NotFoundError{Resource: "deleted role", ID: id}
+		return Response{}, err
+	}
+	if err != nil {
+		return Response{}, fmt.Errorf("error restoring role with id %d: %w", id, err)
+	}
+	isExist, err := service.repo.FindByNameAndNotIdTx(tx, restored.Name, id)
+	if err != nil {
+		return Response{}, fmt.Errorf("error finding role by name: %s, %w", restored.Name, err)
+	}
+	if isExist {
+		err = common.AlreadyExistsError{Resource: "role", ID: restored.Name}
+		return Response{}, err
+	}
+	if err = service.recordTx(tx, actor, audit.ActionRestore, id, nil, restored.toResponse()); err != nil {
+		return Response{}, err
 	}
+	return restored.toResponse(), nil
+}
 
-	return nil
+// Purge окончательно удаляет роли, мягко удалённые дольше срока хранения, и возвращает их идентификаторы
+func (service *Service) Purge(actor audit.Actor) (ids []int64, err error) {
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return []int64{}, fmt.Errorf("error purge roles: error creating transaction: %w", err)
+	}
+	purged, err := service.repo.PurgeTx(tx, time.Now().Add(-service.retention))
+	if err != nil {
+		return []int64{}, fmt.Errorf("error purging deleted roles: %w", err)
+	}
+	ids = make([]int64, len(purged))
+	for i := range purged {
+		ids[i] = purged[i].Id
+		if err = service.recordTx(tx, actor, audit.ActionPurge, purged[i].Id, purged[i].toResponse(), nil); err != nil {
+			return []int64{}, err
+		}
+	}
+	return ids, nil
 }
 
-func (service *Service) SaveTx(name string) (int64, error) {
+func (service *Service) SaveTx(actor audit.Actor, name string, parentIds []int64) (newRoleId int64, err error) {
 	tx, err := service.repo.BeginTransaction()
 	defer func() {
 		if tx != nil {
@@ -103,12 +334,22 @@ func (service *Service) SaveTx(name string) (int64, error) {
 	if err != nil {
 		return 0, fmt.Errorf("error save role: error creating transaction: %w", err)
 	}
+	return service.CreateTx(tx, actor, name, parentIds)
+}
+
+// CreateTx создаёт роль в транзакции вызывающего, например массового импорта;
+// фиксацию и откат транзакции выполняет вызывающий
+func (service *Service) CreateTx(tx *sqlx.Tx, actor audit.Actor, name string, parentIds []int64) (int64, error) {
 	isExist, err := service.repo.FindByNameTx(tx, name)
 	if err != nil {
 		return 0, fmt.Errorf("error finding role by name: %s, %w", name, err)
 	}
 	if isExist {
-		return 0, fmt.Errorf("role with name %s already exists", name)
+		return 0, common.AlreadyExistsError{Resource: "role", ID: name}
+	}
+	// у новой роли ещё нет потомков, поэтому цикл невозможен — достаточно проверить родителей
+	if err = service.checkParentsTx(tx, parentIds); err != nil {
+		return 0, err
 	}
 	entity := Entity{
 		Name: name,
@@ -116,17 +357,244 @@ func (service *Service) SaveTx(name string) (int64, error) {
 
 	newRoleId, err := service.repo.SaveTx(tx, entity)
 	if err != nil {
-		err = fmt.Errorf("error creating role with name: %s %v", name, err)
+		return 0, fmt.Errorf("error creating role with name: %s %v", name, err)
+	}
+	if err = service.recordCreatedTx(tx, actor, newRoleId); err != nil {
+		return 0, err
 	}
-	return newRoleId, err
+	if len(parentIds) > 0 {
+		if err = service.repo.ReplaceParentsTx(tx, newRoleId, parentIds); err != nil {
+			return 0, fmt.Errorf("error setting parents of role with id %d: %w", newRoleId, err)
+		}
+		err = service.recordTx(tx, actor, audit.ActionSetParents, newRoleId, nil, parents{ParentIds: parentIds})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return newRoleId, nil
 }
 
-func (service *Service) CreateRole(request CreateRequest) (int64, error) {
+func (service *Service) CreateRole(actor audit.Actor, request CreateRequest) (int64, error) {
 	if err := service.validator.Validate(request); err != nil {
-		return 0, &common.RequestValidationError{
-			FieldErrors: common.MapValidationErrors(err.(validator.ValidationErrors)).FieldErrors,
-		}
+		return 0, err
 	}
 	entity := request.ToEntity()
-	return service.SaveTx(entity.Name)
+	return service.SaveTx(actor, entity.Name, request.ParentIds)
+}
+
+// UpdateRole переименовывает роль
+func (service *Service) UpdateRole(actor audit.Actor, id int64, request UpdateRequest) (response Response, err error) {
+	if err = service.validator.Validate(request); err != nil {
+		return Response{}, err
+	}
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return Response{}, fmt.Errorf("error update role: error creating transaction: %w", err)
+	}
+	return service.UpdateRoleTx(tx, actor, id, request)
+}
+
+// UpdateRoleTx переименовывает роль в транзакции вызывающего; запрос проверяет, а транзакцию фиксирует
+// и откатывает вызывающий
+func (service *Service) UpdateRoleTx(tx *sqlx.Tx, actor audit.Actor, id int64, request UpdateRequest) (Response, error) {
+	current, err := service.repo.FindByIdTx(tx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Response{}, common.NotFoundError{Resource: "role", ID: id}
+	}
+	if err != nil {
+		return Response{}, fmt.Errorf("error finding role with id %d: %w", id, err)
+	}
+	isExist, err := service.repo.FindByNameAndNotIdTx(tx, request.Name, id)
+	if err != nil {
+		return Response{}, fmt.Errorf("error finding role by name: %s, %w", request.Name, err)
+	}
+	if isExist {
+		return Response{}, common.AlreadyExistsError{Resource: "role", ID: request.Name}
+	}
+	updated, err := service.repo.UpdateTx(tx, request.ToEntity(id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Response{}, common.NotFoundError{Resource: "role", ID: id}
+	}
+	if err != nil {
+		return Response{}, fmt.Errorf("error updating role with id: %d %w", id, err)
+	}
+	if err = service.recordTx(tx, actor, audit.ActionUpdate, id, current.toResponse(), updated.toResponse()); err != nil {
+		return Response{}, err
+	}
+	return updated.toResponse(), nil
+}
+
+// FindEmployees все сотрудники, которым выдана роль
+func (service *Service) FindEmployees(id int64) ([]EmployeeResponse, error) {
+	if _, err := service.FindById(id); err != nil {
+		return []EmployeeResponse{}, err
+	}
+	employees, err := service.repo.FindEmployeesByRoleId(id)
+	if err != nil {
+		return []EmployeeResponse{}, fmt.Errorf("error finding employees with role id %d: %w", id, err)
+	}
+	return toSliceEmployeeResponse(employees), nil
+}
+
+// SetParents заменяет родительские роли; отклоняет изменения, после которых в иерархии появится цикл
+func (service *Service) SetParents(actor audit.Actor, id int64, request ParentsRequest) (err error) {
+	if err = service.validator.Validate(request); err != nil {
+		return err
+	}
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return fmt.Errorf("error set role parents: error creating transaction: %w", err)
+	}
+	if err = service.repo.LockHierarchyTx(tx); err != nil {
+		return fmt.Errorf("error locking role hierarchy: %w", err)
+	}
+	count, err := service.repo.CountByIdsTx(tx, []int64{id})
+	if err != nil {
+		return fmt.Errorf("error finding role with id %d: %w", id, err)
+	}
+	if count == 0 {
+		err = common.NotFoundError{Resource: "role", ID: id}
+		return err
+	}
+	if err = service.checkParentsTx(tx, request.ParentIds); err != nil {
+		return err
+	}
+	descendants, err := service.repo.FindDescendantIdsTx(tx, id)
+	if err != nil {
+		return fmt.Errorf("error finding descendants of role with id %d: %w", id, err)
+	}
+	if err = checkCycle(id, request.ParentIds, descendants); err != nil {
+		return err
+	}
+	previous, err := service.repo.FindParentIdsTx(tx, id)
+	if err != nil {
+		return fmt.Errorf("error finding parents of role with id %d: %w", id, err)
+	}
+	if err = service.repo.ReplaceParentsTx(tx, id, request.ParentIds); err != nil {
+		return fmt.Errorf("error setting parents of role with id %d: %w", id, err)
+	}
+	return service.recordTx(tx, actor, audit.ActionSetParents, id, parents{ParentIds: previous}, parents{ParentIds: request.ParentIds})
+}
+
+// FindAncestors роли, от которых роль наследует права, ближайшие — первыми
+func (service *Service) FindAncestors(id int64) ([]HierarchyResponse, error) {
+	if _, err := service.FindById(id); err != nil {
+		return []HierarchyResponse{}, err
+	}
+	roles, err := service.repo.FindAncestors(id)
+	if err != nil {
+		return []HierarchyResponse{}, fmt.Errorf("error finding ancestors of role with id %d: %w", id, err)
+	}
+	return toSliceHierarchyResponse(roles), nil
+}
+
+// FindDescendants роли, которые наследуют права роли, ближайшие — первыми
+func (service *Service) FindDescendants(id int64) ([]HierarchyResponse, error) {
+	if _, err := service.FindById(id); err != nil {
+		return []HierarchyResponse{}, err
+	}
+	roles, err := service.repo.FindDescendants(id)
+	if err != nil {
+		return []HierarchyResponse{}, fmt.Errorf("error finding descendants of role with id %d: %w", id, err)
+	}
+	return toSliceHierarchyResponse(roles), nil
+}
+
+// checkParentsTx проверяет, что все родительские роли существуют
+func (service *Service) checkParentsTx(tx *sqlx.Tx, parentIds []int64) error {
+	if len(parentIds) == 0 {
+		return nil
+	}
+	count, err := service.repo.CountByIdsTx(tx, parentIds)
+	if err != nil {
+		return fmt.Errorf("error finding parent roles %d: %w", parentIds, err)
+	}
+	if count != int64(len(parentIds)) {
+		return common.NotFoundError{Resource: "parent role", ID: parentIds}
+	}
+	return nil
+}
+
+// checkCycle роль не может быть родителем самой себе или своему предку
+func checkCycle(id int64, parentIds []int64, descendants []int64) error {
+	forbidden := make(map[int64]struct{}, len(descendants))
+	for _, descendant := range descendants {
+		forbidden[descendant] = struct{}{}
+	}
+	for _, parentId := range parentIds {
+		if parentId == id {
+			return common.RequestValidationError{FieldErrors: map[string]string{
+				"parent_ids": "role cannot be its own parent",
+			}}
+		}
+		if _, ok := forbidden[parentId]; ok {
+			return common.RequestValidationError{FieldErrors: map[string]string{
+				"parent_ids": fmt.Sprintf("role %d inherits from role %d, making it a parent would create a cycle", parentId, id),
+			}}
+		}
+	}
+	return nil
+}
+
+// parents состояние родительских ролей в журнале аудита
+type parents struct {
+	ParentIds []int64 `json:"parent_ids"`
+}
+
+func (service *Service) recordCreatedTx(tx *sqlx.Tx, actor audit.Actor, id int64) error {
+	created, err := service.repo.FindByIdTx(tx, id)
+	if err != nil {
+		return fmt.Errorf("error finding role with id %d: %w", id, err)
+	}
+	return service.recordTx(tx, actor, audit.ActionCreate, id, nil, created.toResponse())
+}
+
+func (service *Service) recordTx(tx *sqlx.Tx, actor audit.Actor, action string, id int64, before any, after any) error {
+	return service.auditor.RecordTx(tx, actor, audit.Record{
+		Action:     action,
+		EntityType: audit.EntityRole,
+		EntityId:   id,
+		Before:     before,
+		After:      after,
+	})
+}
+
+// PermissionFinder права ролей вместе с унаследованными, реализуется Repository
+type PermissionFinder interface {
+	FindPermissionsByRoleIds(ids []int64) (permissions []PermissionEntity, err error)
+}
+
+// RequireGrantable выдать роли может только тот, у кого есть все их права, включая унаследованные,
+// иначе право на выдачу ролей стало бы правом на любое действие
+func RequireGrantable(finder PermissionFinder, caller common.Caller, roleIds []int64) error {
+	grants, err := finder.FindPermissionsByRoleIds(roleIds)
+	if err != nil {
+		return fmt.Errorf("error finding permissions of roles %d: %w", roleIds, err)
+	}
+	permissions := make([]string, 0, len(grants))
+	for _, grant := range grants {
+		permission := grant.Resource + ":" + grant.Action
+		if !slices.Contains(permissions, permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+	return common.RequireGrantable(caller, permissions)
 }
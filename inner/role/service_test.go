@@ -1,12 +1,15 @@
 package role
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/78bits/go-sqlmock-sqlx"
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"idm/inner/audit"
+	"idm/inner/common"
 	"idm/inner/validator"
 	"testing"
 	"time"
@@ -63,8 +66,117 @@ func (m *MockRepo) SaveTx(tx *sqlx.Tx, entity Entity) (int64, error) {
 	return args.Get(0).(int64), args.Error(1)
 }
 
+func (m *MockRepo) FindByNameAndNotIdTx(tx *sqlx.Tx, name string, id int64) (bool, error) {
+	args := m.Called(tx, name, id)
+	return args.Get(0).(bool), args.Error(1)
+}
+
+func (m *MockRepo) UpdateTx(tx *sqlx.Tx, entity Entity) (Entity, error) {
+	args := m.Called(tx, entity)
+	return args.Get(0).(Entity), args.Error(1)
+}
+
+func (m *MockRepo) FindEmployeesByRoleId(id int64) ([]EmployeeEntity, error) {
+	args := m.Called(id)
+	return args.Get(0).([]EmployeeEntity), args.Error(1)
+}
+
+func (m *MockRepo) FindAncestors(id int64) ([]HierarchyEntity, error) {
+	args := m.Called(id)
+	return args.Get(0).([]HierarchyEntity), args.Error(1)
+}
+
+func (m *MockRepo) FindDescendants(id int64) ([]HierarchyEntity, error) {
+	args := m.Called(id)
+	return args.Get(0).([]HierarchyEntity), args.Error(1)
+}
+
+func (m *MockRepo) LockHierarchyTx(tx *sqlx.Tx) error {
+	args := m.Called(tx)
+	return args.Error(0)
+}
+
+func (m *MockRepo) CountByIdsTx(tx *sqlx.Tx, ids []int64) (int64, error) {
+	args := m.Called(tx, ids)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepo) FindDescendantIdsTx(tx *sqlx.Tx, id int64) ([]int64, error) {
+	args := m.Called(tx, id)
+	return args.Get(0).([]int64), args.Error(1)
+}
+
+func (m *MockRepo) ReplaceParentsTx(tx *sqlx.Tx, id int64, parentIds []int64) error {
+	args := m.Called(tx, id, parentIds)
+	return args.Error(0)
+}
+
 var val = validator.New()
 
+func (m *MockRepo) FindByIdTx(tx *sqlx.Tx, id int64) (Entity, error) {
+	args := m.Called(tx, id)
+	return args.Get(0).(Entity), args.Error(1)
+}
+
+func (m *MockRepo) FindParentIdsTx(tx *sqlx.Tx, id int64) ([]int64, error) {
+	args := m.Called(tx, id)
+	return args.Get(0).([]int64), args.Error(1)
+}
+
+func (m *MockRepo) DeleteTx(tx *sqlx.Tx, id int64) (Entity, error) {
+	args := m.Called(tx, id)
+	return args.Get(0).(Entity), args.Error(1)
+}
+
+func (m *MockRepo) DeleteAllByIdsTx(tx *sqlx.Tx, ids []int64) ([]Entity, error) {
+	args := m.Called(tx, ids)
+	return args.Get(0).([]Entity), args.Error(1)
+}
+
+func (m *MockRepo) FindAllIncludingDeleted() ([]Entity, error) {
+	args := m.Called()
+	return args.Get(0).([]Entity), args.Error(1)
+}
+
+func (m *MockRepo) FindByIdIncludingDeleted(id int64) (Entity, error) {
+	args := m.Called(id)
+	return args.Get(0).(Entity), args.Error(1)
+}
+
+func (m *MockRepo) RestoreTx(tx *sqlx.Tx, id int64) (Entity, error) {
+	args := m.Called(tx, id)
+	return args.Get(0).(Entity), args.Error(1)
+}
+
+func (m *MockRepo) PurgeTx(tx *sqlx.Tx, deletedBefore time.Time) ([]Entity, error) {
+	args := m.Called(tx, deletedBefore)
+	return args.Get(0).([]Entity), args.Error(1)
+}
+
+func (m *MockRepo) FindPage(filter Filter) ([]Entity, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]Entity), args.Error(1)
+}
+
+func (m *MockRepo) Count(filter Filter) (int64, error) {
+	args := m.Called(filter)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// auditRecorder запоминает записи журнала аудита вместо записи в базу
+type auditRecorder struct {
+	actors  []audit.Actor
+	records []audit.Record
+}
+
+func (r *auditRecorder) RecordTx(_ *sqlx.Tx, actor audit.Actor, record audit.Record) error {
+	r.actors = append(r.actors, actor)
+	r.records = append(r.records, record)
+	return nil
+}
+
+var actor = audit.Actor{Subject: "42", RequestId: "request-1"}
+
 func TestServiceSaveTxSuccess(t *testing.T) {
 	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	if err != nil {
@@ -80,7 +192,7 @@ func TestServiceSaveTxSuccess(t *testing.T) {
 	mock.ExpectBegin()
 
 	rows := sqlmock.NewRows([]string{"exists"}).AddRow(false)
-	mock.ExpectQuery("select exists(select 1 from role where name = $1)").
+	mock.ExpectQuery("select exists(select 1 from role where name = $1 and deleted_at is null)").
 		WithArgs("test").
 		WillReturnRows(rows)
 
@@ -89,10 +201,15 @@ func TestServiceSaveTxSuccess(t *testing.T) {
 		WithArgs("test").
 		WillReturnRows(insertRows)
 
+	createdRows := sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "test")
+	mock.ExpectQuery("SELECT * FROM role WHERE id=$1 AND deleted_at IS NULL").
+		WithArgs(1).
+		WillReturnRows(createdRows)
+
 	repo := &Repository{db: sqlxDB}
-	service := NewService(repo, val)
+	service := NewService(repo, val, new(auditRecorder), 0)
 
-	id, err := service.SaveTx("test")
+	id, err := service.SaveTx(actor, "test", nil)
 	mock.ExpectCommit()
 
 	assert.NoError(t, err)
@@ -108,11 +225,11 @@ func TestServiceSaveTxBeginTxError(t *testing.T) {
 	sqlxDB := sqlx.NewDb(db, "postgres")
 
 	repo := &Repository{db: sqlxDB}
-	service := NewService(repo, val)
+	service := NewService(repo, val, new(auditRecorder), 0)
 
 	mock.ExpectBegin().WillReturnError(fmt.Errorf("tx begin error"))
 
-	id, err := service.SaveTx("test")
+	id, err := service.SaveTx(actor, "test", nil)
 	assert.Error(t, err)
 	assert.Zero(t, id)
 	assert.Contains(t, err.Error(), "error creating transaction")
@@ -127,17 +244,17 @@ func TestServiceSaveTxFindByNameError(t *testing.T) {
 	sqlxDB := sqlx.NewDb(db, "postgres")
 
 	repo := &Repository{db: sqlxDB}
-	service := NewService(repo, val)
+	service := NewService(repo, val, new(auditRecorder), 0)
 
 	mock.ExpectBegin()
 
-	mock.ExpectQuery("select exists(select 1 from role where name = $1)").
+	mock.ExpectQuery("select exists(select 1 from role where name = $1 and deleted_at is null)").
 		WithArgs("test").
 		WillReturnError(fmt.Errorf("find by name error"))
 
 	mock.ExpectRollback()
 
-	id, err := service.SaveTx("test")
+	id, err := service.SaveTx(actor, "test", nil)
 	assert.Error(t, err)
 	assert.Zero(t, id)
 	assert.Contains(t, err.Error(), "error finding role by name")
@@ -152,17 +269,17 @@ func TestServiceSaveTxroleAlreadyExists(t *testing.T) {
 	sqlxDB := sqlx.NewDb(db, "postgres")
 
 	repo := &Repository{db: sqlxDB}
-	service := NewService(repo, val)
+	service := NewService(repo, val, new(auditRecorder), 0)
 
 	mock.ExpectBegin()
 
-	mock.ExpectQuery("select exists(select 1 from role where name = $1)").
+	mock.ExpectQuery("select exists(select 1 from role where name = $1 and deleted_at is null)").
 		WithArgs("test").
 		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
 
 	mock.ExpectRollback()
 
-	id, err := service.SaveTx("test")
+	id, err := service.SaveTx(actor, "test", nil)
 	assert.Error(t, err)
 	assert.Zero(t, id)
 	assert.Contains(t, err.Error(), "already exists")
@@ -177,11 +294,11 @@ func TestServiceSaveTxSaveError(t *testing.T) {
 	sqlxDB := sqlx.NewDb(db, "postgres")
 
 	repo := &Repository{db: sqlxDB}
-	service := NewService(repo, val)
+	service := NewService(repo, val, new(auditRecorder), 0)
 
 	mock.ExpectBegin()
 
-	mock.ExpectQuery("select exists(select 1 from role where name = $1)").
+	mock.ExpectQuery("select exists(select 1 from role where name = $1 and deleted_at is null)").
 		WithArgs("test").
 		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
 
@@ -191,7 +308,7 @@ func TestServiceSaveTxSaveError(t *testing.T) {
 
 	mock.ExpectRollback()
 
-	id, err := service.SaveTx("test")
+	id, err := service.SaveTx(actor, "test", nil)
 	assert.Error(t, err)
 	assert.Zero(t, id)
 	assert.Contains(t, err.Error(), "error creating role")
@@ -199,9 +316,10 @@ func TestServiceSaveTxSaveError(t *testing.T) {
 
 func TestServices(t *testing.T) {
 	var a = assert.New(t)
+	var noTx *sqlx.Tx
 	t.Run("should return found role by id", func(t *testing.T) {
 		var repo = new(MockRepo)
-		var svc = NewService(repo, val)
+		var svc = NewService(repo, val, new(auditRecorder), 0)
 		var entity = Entity{
 			Id:        1,
 			Name:      "Разработчик",
@@ -220,7 +338,7 @@ func TestServices(t *testing.T) {
 
 	t.Run("should return an error when not found by id", func(t *testing.T) {
 		var repo = new(MockRepo)
-		var svc = NewService(repo, val)
+		var svc = NewService(repo, val, new(auditRecorder), 0)
 		var entity = Entity{}
 		var err = errors.New("user not found")
 		var want = fmt.Errorf("error finding role with id 1: %w", err)
@@ -236,7 +354,7 @@ func TestServices(t *testing.T) {
 
 	t.Run("should return all found roles by ids", func(t *testing.T) {
 		var repo = new(MockRepo)
-		var svc = NewService(repo, val)
+		var svc = NewService(repo, val, new(auditRecorder), 0)
 		var entityes = []Entity{
 			{
 				Id:        1,
@@ -263,7 +381,7 @@ func TestServices(t *testing.T) {
 
 	t.Run("should return an error when not found by ids", func(t *testing.T) {
 		var repo = new(MockRepo)
-		var svc = NewService(repo, val)
+		var svc = NewService(repo, val, new(auditRecorder), 0)
 		var entity = []Entity{{
 			Id:        1,
 			Name:      "Разработчик",
@@ -284,7 +402,7 @@ func TestServices(t *testing.T) {
 
 	t.Run("should return all roles", func(t *testing.T) {
 		var repo = new(MockRepo)
-		var svc = NewService(repo, val)
+		var svc = NewService(repo, val, new(auditRecorder), 0)
 		var entityes = []Entity{
 			{
 				Name:      "Разработчик",
@@ -309,58 +427,489 @@ func TestServices(t *testing.T) {
 
 	t.Run("should delete all roles by ids", func(t *testing.T) {
 		var repo = new(MockRepo)
-		var svc = NewService(repo, val)
+		var svc = NewService(repo, val, new(auditRecorder), 0)
 
-		repo.On("DeleteAllByIds", []int64{1, 2}).Return(nil)
-		err := svc.DeleteAllByIds([]int64{1, 2})
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("DeleteAllByIdsTx", noTx, []int64{1, 2}).Return([]Entity{{Id: 1}, {Id: 2}}, nil)
+		err := svc.DeleteAllByIds(actor, []int64{1, 2})
 
 		a.Nil(err)
-		a.True(repo.AssertNumberOfCalls(t, "DeleteAllByIds", 1))
+		a.True(repo.AssertNumberOfCalls(t, "DeleteAllByIdsTx", 1))
 	})
 
 	t.Run("should delete by id", func(t *testing.T) {
 		var repo = new(MockRepo)
-		var svc = NewService(repo, val)
+		var svc = NewService(repo, val, new(auditRecorder), 0)
 
-		repo.On("Delete", valueId).Return(nil)
-		err := svc.Delete(1)
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("DeleteTx", noTx, valueId).Return(Entity{Id: 1, Name: "User"}, nil)
+		err := svc.Delete(actor, 1)
 
 		a.Nil(err)
-		a.True(repo.AssertNumberOfCalls(t, "Delete", 1))
+		a.True(repo.AssertNumberOfCalls(t, "DeleteTx", 1))
 	})
 
 	t.Run("should return saved role", func(t *testing.T) {
 		var repo = new(MockRepo)
-		var svc = NewService(repo, val)
+		var svc = NewService(repo, val, new(auditRecorder), 0)
 		var entity = Entity{
 			Name:      "User",
 			CreatedAt: time.Now(),
 			UpdatedAt: time.Now(),
 		}
 
-		repo.On("Save", entity).Return(valueId, nil)
-		var got, err = svc.Save(entity)
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("SaveTx", noTx, entity).Return(valueId, nil)
+		repo.On("FindByIdTx", noTx, valueId).Return(Entity{Id: 1, Name: "User"}, nil)
+		var got, err = svc.Save(actor, entity)
 
 		a.Nil(err)
 		a.Equal(valueId, got)
-		a.True(repo.AssertNumberOfCalls(t, "Save", 1))
+		a.True(repo.AssertNumberOfCalls(t, "SaveTx", 1))
 	})
 
 	t.Run("should return error while save role", func(t *testing.T) {
 		var repo = new(MockRepo)
-		var svc = NewService(repo, val)
+		var svc = NewService(repo, val, new(auditRecorder), 0)
 		var entity = Entity{
 			Name: "",
 		}
 		var err = errors.New("user not saved")
 		var want = fmt.Errorf("error saving role name: %s: %w", entity.Name, err)
 
-		repo.On("Save", entity).Return(int64(0), err)
-		var result, got = svc.Save(entity)
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("SaveTx", noTx, entity).Return(int64(0), err)
+		var result, got = svc.Save(actor, entity)
 
 		a.Equal(int64(0), result)
 		a.NotNil(got)
 		a.Equal(want, got)
-		a.True(repo.AssertNumberOfCalls(t, "Save", 1))
+		a.True(repo.AssertNumberOfCalls(t, "SaveTx", 1))
+	})
+}
+
+func TestServiceUpdate(t *testing.T) {
+	var a = assert.New(t)
+	var noTx *sqlx.Tx
+
+	t.Run("should rename role", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder), 0)
+		var request = UpdateRequest{Name: "Ведущий разработчик"}
+		var updated = Entity{Id: 3, Name: request.Name, UpdatedAt: time.Now()}
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(3)).Return(Entity{Id: 3, Name: "Разработчик"}, nil)
+		repo.On("FindByNameAndNotIdTx", noTx, request.Name, int64(3)).Return(false, nil)
+		repo.On("UpdateTx", noTx, request.ToEntity(3)).Return(updated, nil)
+		var got, err = svc.UpdateRole(actor, 3, request)
+
+		a.Nil(err)
+		a.Equal(updated.toResponse(), got)
+	})
+
+	t.Run("should return already exists when name is taken", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder), 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(3)).Return(Entity{Id: 3, Name: "Разработчик"}, nil)
+		repo.On("FindByNameAndNotIdTx", noTx, "Менеджер", int64(3)).Return(true, nil)
+		var _, err = svc.UpdateRole(actor, 3, UpdateRequest{Name: "Менеджер"})
+
+		a.ErrorAs(err, &common.AlreadyExistsError{})
+		a.True(repo.AssertNotCalled(t, "UpdateTx"))
+	})
+
+	t.Run("should return not found when renaming missing role", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder), 0)
+		var request = UpdateRequest{Name: "Аналитик"}
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(9)).Return(Entity{}, sql.ErrNoRows)
+		var _, err = svc.UpdateRole(actor, 9, request)
+
+		a.ErrorAs(err, &common.NotFoundError{})
+		a.True(repo.AssertNotCalled(t, "UpdateTx"))
+	})
+
+	t.Run("should return validation error on empty name", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder), 0)
+
+		var _, err = svc.UpdateRole(actor, 3, UpdateRequest{})
+
+		a.ErrorAs(err, &common.RequestValidationError{})
+	})
+
+	t.Run("should return not found when role is missing", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder), 0)
+
+		repo.On("FindById", int64(9)).Return(Entity{}, sql.ErrNoRows)
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("DeleteTx", noTx, int64(9)).Return(Entity{}, sql.ErrNoRows)
+		var _, findErr = svc.FindById(9)
+		var deleteErr = svc.Delete(actor, 9)
+
+		a.ErrorAs(findErr, &common.NotFoundError{})
+		a.ErrorAs(deleteErr, &common.NotFoundError{})
+	})
+
+	t.Run("should return employees with role", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder), 0)
+		var employees = []EmployeeEntity{{Id: 3, Name: "Петров Алексей"}, {Id: 4, Name: "Козлова Елена"}}
+
+		repo.On("FindById", int64(3)).Return(Entity{Id: 3}, nil)
+		repo.On("FindEmployeesByRoleId", int64(3)).Return(employees, nil)
+		var got, err = svc.FindEmployees(3)
+
+		a.Nil(err)
+		a.Equal(toSliceEmployeeResponse(employees), got)
+	})
+
+	t.Run("should return not found for employees of missing role", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder), 0)
+
+		repo.On("FindById", int64(9)).Return(Entity{}, sql.ErrNoRows)
+		var _, err = svc.FindEmployees(9)
+
+		a.ErrorAs(err, &common.NotFoundError{})
+	})
+}
+
+func TestServiceHierarchy(t *testing.T) {
+	var a = assert.New(t)
+	var noTx *sqlx.Tx
+
+	t.Run("should create role with parents", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder), 0)
+		var request = CreateRequest{Name: "Старший разработчик", ParentIds: []int64{3}}
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByNameTx", noTx, request.Name).Return(false, nil)
+		repo.On("CountByIdsTx", noTx, []int64{3}).Return(int64(1), nil)
+		repo.On("SaveTx", noTx, Entity{Name: request.Name}).Return(int64(4), nil)
+		repo.On("FindByIdTx", noTx, int64(4)).Return(Entity{Id: 4, Name: request.Name}, nil)
+		repo.On("ReplaceParentsTx", noTx, int64(4), []int64{3}).Return(nil)
+		var got, err = svc.CreateRole(actor, request)
+
+		a.Nil(err)
+		a.Equal(int64(4), got)
+	})
+
+	t.Run("should not create role with missing parent", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder), 0)
+		var request = CreateRequest{Name: "Старший разработчик", ParentIds: []int64{3, 9}}
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByNameTx", noTx, request.Name).Return(false, nil)
+		repo.On("CountByIdsTx", noTx, []int64{3, 9}).Return(int64(1), nil)
+		var _, err = svc.CreateRole(actor, request)
+
+		a.ErrorAs(err, &common.NotFoundError{})
+		a.True(repo.AssertNotCalled(t, "SaveTx", noTx, mock.Anything))
+	})
+
+	t.Run("should replace parents", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder), 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("LockHierarchyTx", noTx).Return(nil)
+		repo.On("CountByIdsTx", noTx, []int64{4}).Return(int64(1), nil)
+		repo.On("CountByIdsTx", noTx, []int64{2, 3}).Return(int64(2), nil)
+		repo.On("FindDescendantIdsTx", noTx, int64(4)).Return([]int64{5}, nil)
+		repo.On("FindParentIdsTx", noTx, int64(4)).Return([]int64{1}, nil)
+		repo.On("ReplaceParentsTx", noTx, int64(4), []int64{2, 3}).Return(nil)
+		var err = svc.SetParents(actor, 4, ParentsRequest{ParentIds: []int64{2, 3}})
+
+		a.Nil(err)
+		a.True(repo.AssertNumberOfCalls(t, "ReplaceParentsTx", 1))
+	})
+
+	t.Run("should reject descendant as parent", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder), 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("LockHierarchyTx", noTx).Return(nil)
+		repo.On("CountByIdsTx", noTx, []int64{3}).Return(int64(1), nil)
+		repo.On("CountByIdsTx", noTx, []int64{5}).Return(int64(1), nil)
+		repo.On("FindDescendantIdsTx", noTx, int64(3)).Return([]int64{4, 5}, nil)
+		var err = svc.SetParents(actor, 3, ParentsRequest{ParentIds: []int64{5}})
+
+		a.ErrorAs(err, &common.RequestValidationError{})
+		a.Contains(err.Error(), "cycle")
+		a.True(repo.AssertNotCalled(t, "ReplaceParentsTx", noTx, int64(3), []int64{5}))
+	})
+
+	t.Run("should reject role as its own parent", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder), 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("LockHierarchyTx", noTx).Return(nil)
+		repo.On("CountByIdsTx", noTx, []int64{3}).Return(int64(1), nil)
+		repo.On("FindDescendantIdsTx", noTx, int64(3)).Return([]int64{}, nil)
+		var err = svc.SetParents(actor, 3, ParentsRequest{ParentIds: []int64{3}})
+
+		a.ErrorAs(err, &common.RequestValidationError{})
+	})
+
+	t.Run("should clear parents with empty list", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder), 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("LockHierarchyTx", noTx).Return(nil)
+		repo.On("CountByIdsTx", noTx, []int64{4}).Return(int64(1), nil)
+		repo.On("FindDescendantIdsTx", noTx, int64(4)).Return([]int64{}, nil)
+		repo.On("FindParentIdsTx", noTx, int64(4)).Return([]int64{3}, nil)
+		repo.On("ReplaceParentsTx", noTx, int64(4), []int64{}).Return(nil)
+		var err = svc.SetParents(actor, 4, ParentsRequest{ParentIds: []int64{}})
+
+		a.Nil(err)
+	})
+
+	t.Run("should return not found when setting parents of missing role", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder), 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("LockHierarchyTx", noTx).Return(nil)
+		repo.On("CountByIdsTx", noTx, []int64{9}).Return(int64(0), nil)
+		var err = svc.SetParents(actor, 9, ParentsRequest{ParentIds: []int64{3}})
+
+		a.ErrorAs(err, &common.NotFoundError{})
+	})
+
+	t.Run("should return ancestors and descendants", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, val, new(auditRecorder), 0)
+		var ancestors = []HierarchyEntity{{Id: 3, Name: "Разработчик", Depth: 1}}
+		var descendants = []HierarchyEntity{{Id: 5, Name: "Ведущий разработчик", Depth: 1}}
+
+		repo.On("FindById", int64(4)).Return(Entity{Id: 4}, nil)
+		repo.On("FindAncestors", int64(4)).Return(ancestors, nil)
+		repo.On("FindDescendants", int64(4)).Return(descendants, nil)
+		var gotAncestors, ancestorsErr = svc.FindAncestors(4)
+		var gotDescendants, descendantsErr = svc.FindDescendants(4)
+
+		a.Nil(ancestorsErr)
+		a.Nil(descendantsErr)
+		a.Equal(toSliceHierarchyResponse(ancestors), gotAncestors)
+		a.Equal(toSliceHierarchyResponse(descendants), gotDescendants)
+	})
+}
+
+func TestServiceAudit(t *testing.T) {
+	var a = assert.New(t)
+	var noTx *sqlx.Tx
+
+	t.Run("should record created role and its parents", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var auditor = new(auditRecorder)
+		var svc = NewService(repo, val, auditor, 0)
+		var request = CreateRequest{Name: "Старший разработчик", ParentIds: []int64{3}}
+		var created = Entity{Id: 4, Name: request.Name}
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByNameTx", noTx, request.Name).Return(false, nil)
+		repo.On("CountByIdsTx", noTx, []int64{3}).Return(int64(1), nil)
+		repo.On("SaveTx", noTx, Entity{Name: request.Name}).Return(int64(4), nil)
+		repo.On("FindByIdTx", noTx, int64(4)).Return(created, nil)
+		repo.On("ReplaceParentsTx", noTx, int64(4), []int64{3}).Return(nil)
+		var _, err = svc.CreateRole(actor, request)
+
+		a.Nil(err)
+		a.Equal([]audit.Actor{actor, actor}, auditor.actors)
+		a.Equal([]audit.Record{
+			{Action: audit.ActionCreate, EntityType: audit.EntityRole, EntityId: 4, After: created.toResponse()},
+			{Action: audit.ActionSetParents, EntityType: audit.EntityRole, EntityId: 4, After: parents{ParentIds: []int64{3}}},
+		}, auditor.records)
+	})
+
+	t.Run("should record parents before and after replace", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var auditor = new(auditRecorder)
+		var svc = NewService(repo, val, auditor, 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("LockHierarchyTx", noTx).Return(nil)
+		repo.On("CountByIdsTx", noTx, []int64{4}).Return(int64(1), nil)
+		repo.On("CountByIdsTx", noTx, []int64{2}).Return(int64(1), nil)
+		repo.On("FindDescendantIdsTx", noTx, int64(4)).Return([]int64{}, nil)
+		repo.On("FindParentIdsTx", noTx, int64(4)).Return([]int64{3}, nil)
+		repo.On("ReplaceParentsTx", noTx, int64(4), []int64{2}).Return(nil)
+		var err = svc.SetParents(actor, 4, ParentsRequest{ParentIds: []int64{2}})
+
+		a.Nil(err)
+		a.Len(auditor.records, 1)
+		a.Equal(parents{ParentIds: []int64{3}}, auditor.records[0].Before)
+		a.Equal(parents{ParentIds: []int64{2}}, auditor.records[0].After)
+	})
+
+	t.Run("should not record rejected rename", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var auditor = new(auditRecorder)
+		var svc = NewService(repo, val, auditor, 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("FindByIdTx", noTx, int64(3)).Return(Entity{Id: 3, Name: "Разработчик"}, nil)
+		repo.On("FindByNameAndNotIdTx", noTx, "Менеджер", int64(3)).Return(true, nil)
+		var _, err = svc.UpdateRole(actor, 3, UpdateRequest{Name: "Менеджер"})
+
+		a.ErrorAs(err, &common.AlreadyExistsError{})
+		a.Empty(auditor.records)
 	})
 }
+
+func TestServiceSoftDelete(t *testing.T) {
+	var a = assert.New(t)
+	var noTx *sqlx.Tx
+
+	t.Run("should restore deleted role", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var auditor = new(auditRecorder)
+		var svc = NewService(repo, validator.New(), auditor, 0)
+		var restored = Entity{Id: 5, Name: "Иванов Петр"}
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("RestoreTx", noTx, int64(5)).Return(restored, nil)
+		repo.On("FindByNameAndNotIdTx", noTx, restored.Name, int64(5)).Return(false, nil)
+		var got, err = svc.Restore(actor, 5)
+
+		a.Nil(err)
+		a.Equal(restored.toResponse(), got)
+		a.Len(auditor.records, 1)
+		a.Equal(audit.ActionRestore, auditor.records[0].Action)
+	})
+
+	t.Run("should return not found when role is not deleted", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, validator.New(), new(auditRecorder), 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("RestoreTx", noTx, int64(1)).Return(Entity{}, sql.ErrNoRows)
+		var _, err = svc.Restore(actor, 1)
+
+		a.ErrorAs(err, &common.NotFoundError{})
+	})
+
+	t.Run("should not restore role when name is taken", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var auditor = new(auditRecorder)
+		var svc = NewService(repo, validator.New(), auditor, 0)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("RestoreTx", noTx, int64(5)).Return(Entity{Id: 5, Name: "Иванов Петр"}, nil)
+		repo.On("FindByNameAndNotIdTx", noTx, "Иванов Петр", int64(5)).Return(true, nil)
+		var _, err = svc.Restore(actor, 5)
+
+		a.ErrorAs(err, &common.AlreadyExistsError{})
+		a.Empty(auditor.records)
+	})
+
+	t.Run("should purge roles deleted before retention period", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var auditor = new(auditRecorder)
+		var retention = 7 * 24 * time.Hour
+		var svc = NewService(repo, validator.New(), auditor, retention)
+		var purged = []Entity{{Id: 3}, {Id: 4}}
+		var deletedBefore = mock.MatchedBy(func(deletedBefore time.Time) bool {
+			return time.Since(deletedBefore) >= retention && time.Since(deletedBefore) < retention+time.Minute
+		})
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("PurgeTx", noTx, deletedBefore).Return(purged, nil)
+		var ids, err = svc.Purge(actor)
+
+		a.Nil(err)
+		a.Equal([]int64{3, 4}, ids)
+		a.Len(auditor.records, 2)
+		a.Equal(audit.ActionPurge, auditor.records[1].Action)
+		a.Nil(auditor.records[1].After)
+	})
+
+	t.Run("should use default retention", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, validator.New(), new(auditRecorder), 0)
+		var deletedBefore = mock.MatchedBy(func(deletedBefore time.Time) bool {
+			return time.Since(deletedBefore) >= common.DefaultPurgeRetention
+		})
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("PurgeTx", noTx, deletedBefore).Return([]Entity{}, nil)
+		var ids, err = svc.Purge(actor)
+
+		a.Nil(err)
+		a.Empty(ids)
+	})
+}
+
+func TestServiceFindPage(t *testing.T) {
+	var a = assert.New(t)
+	var anyFilter = mock.AnythingOfType("role.Filter")
+
+	t.Run("should return page sorted by name with next cursor", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, validator.New(), new(auditRecorder), 0)
+		var pageFilter = mock.MatchedBy(func(filter Filter) bool {
+			return filter.Limit == 2 && filter.Sort == common.Sort{Field: "name"} &&
+				filter.NamePrefix == "Р" && filter.IncludeDeleted
+		})
+
+		repo.On("Count", anyFilter).Return(int64(3), nil)
+		repo.On("FindPage", pageFilter).Return([]Entity{{Id: 3, Name: "Разработчик"}, {Id: 5, Name: "Ревьюер"}}, nil)
+		var got, page, err = svc.FindPage(FindRequest{
+			PageRequest:    common.PageRequest{Limit: 1, Sort: "name"},
+			Name:           "Р",
+			IncludeDeleted: true,
+		})
+
+		a.Nil(err)
+		a.Len(got, 1)
+		a.Equal(int64(3), page.Total)
+		after, err := common.DecodeCursor(page.NextCursor, common.Sort{Field: "name"})
+		a.Nil(err)
+		a.Equal(common.Cursor{Sort: "name", Value: "Разработчик", Id: 3}, *after)
+	})
+
+	t.Run("should reject unknown sort field", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, validator.New(), new(auditRecorder), 0)
+
+		var _, _, err = svc.FindPage(FindRequest{PageRequest: common.PageRequest{Sort: "role_id"}})
+
+		a.ErrorAs(err, &common.RequestValidationError{})
+		a.True(repo.AssertNotCalled(t, "Count", anyFilter))
+	})
+}
+
+func TestRepositoryFindPage(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("failed to create mock database")
+	}
+	defer func() { _ = db.Close() }()
+	repo := &Repository{db: sqlx.NewDb(db, "postgres")}
+
+	sqlMock.ExpectQuery("SELECT * FROM role WHERE deleted_at IS NULL AND id > $1 ORDER BY id asc LIMIT $2").
+		WithArgs(2, 101).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(3, "Разработчик"))
+
+	listEntity, err := repo.FindPage(Filter{
+		Sort:  common.Sort{Field: "id"},
+		After: &common.Cursor{Sort: "id", Id: 2},
+		Limit: 101,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, listEntity, 1)
+	assert.NoError(t, sqlMock.ExpectationsWereMet())
+}
@@ -0,0 +1,352 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gofiber/fiber"
+	"idm/inner/audit"
+	"idm/inner/common"
+	"idm/inner/web"
+	"strconv"
+)
+
+type Controller struct {
+	server      *web.Server
+	scimService Svc
+}
+
+// интерфейс сервиса scim.Service
+type Svc interface {
+	ListUsers(request ListRequest) (ListResponse[User], error)
+	GetUser(id string) (User, error)
+	CreateUser(actor audit.Actor, user User) (User, error)
+	ReplaceUser(actor audit.Actor, id string, user User) (User, error)
+	PatchUser(actor audit.Actor, id string, request PatchRequest) (User, error)
+	DeleteUser(actor audit.Actor, id string) error
+	ListGroups(request ListRequest) (ListResponse[Group], error)
+	GetGroup(id string) (Group, error)
+	CreateGroup(actor audit.Actor, group Group) (Group, error)
+	ReplaceGroup(actor audit.Actor, id string, group Group) (Group, error)
+	PatchGroup(actor audit.Actor, id string, request PatchRequest) (Group, error)
+	DeleteGroup(actor audit.Actor, id string) error
+}
+
+func NewController(server *web.Server, scimService Svc) *Controller {
+	return &Controller{
+		server:      server,
+		scimService: scimService,
+	}
+}
+
+// функция для регистрации маршрутов
+func (c *Controller) RegisterRoutes() {
+	readUsers := c.server.Require("employees:read")
+	writeUsers := c.server.Require("employees:write")
+	readGroups := c.server.Require("roles:read")
+	// состав группы — это выдача ролей, поэтому изменение групп требует права на запись ролей
+	writeGroups := c.server.Require("roles:write")
+
+	// полные маршруты получатся "/scim/v2/..."
+	c.server.GroupScim.Get("/ServiceProviderConfig", c.ServiceProviderConfig)
+	c.server.GroupScim.Get("/ResourceTypes", c.ResourceTypes)
+	c.server.GroupScim.Get("/ResourceTypes/:id", c.ResourceType)
+	c.server.GroupScim.Get("/Schemas", c.Schemas)
+	c.server.GroupScim.Get("/Schemas/:id", c.Schema)
+
+	c.server.GroupScim.Get("/Users", readUsers, c.ListUsers)
+	c.server.GroupScim.Post("/Users", writeUsers, c.CreateUser)
+	c.server.GroupScim.Get("/Users/:id", readUsers, c.GetUser)
+	c.server.GroupScim.Put("/Users/:id", writeUsers, c.ReplaceUser)
+	c.server.GroupScim.Patch("/Users/:id", writeUsers, c.PatchUser)
+	c.server.GroupScim.Delete("/Users/:id", writeUsers, c.DeleteUser)
+
+	c.server.GroupScim.Get("/Groups", readGroups, c.ListGroups)
+	c.server.GroupScim.Post("/Groups", writeGroups, c.CreateGroup)
+	c.server.GroupScim.Get("/Groups/:id", readGroups, c.GetGroup)
+	c.server.GroupScim.Put("/Groups/:id", writeGroups, c.ReplaceGroup)
+	c.server.GroupScim.Patch("/Groups/:id", writeGroups, c.PatchGroup)
+	c.server.GroupScim.Delete("/Groups/:id", writeGroups, c.DeleteGroup)
+}
+
+// функция-хендлер для GET запроса по маршруту "/scim/v2/ServiceProviderConfig"
+func (c *Controller) ServiceProviderConfig(ctx *fiber.Ctx) {
+	config := serviceProviderConfig
+	config.Meta = &Meta{ResourceType: "ServiceProviderConfig", Location: location(ctx, "ServiceProviderConfig")}
+	respond(ctx, fiber.StatusOK, config)
+}
+
+// функция-хендлер для GET запроса по маршруту "/scim/v2/ResourceTypes"
+func (c *Controller) ResourceTypes(ctx *fiber.Ctx) {
+	types := make([]ResourceType, len(resourceTypes))
+	for i, resourceType := range resourceTypes {
+		types[i] = withResourceTypeMeta(ctx, resourceType)
+	}
+	respond(ctx, fiber.StatusOK, newListResponse(types, int64(len(types)), 1))
+}
+
+// функция-хендлер для GET запроса по маршруту "/scim/v2/ResourceTypes/:id"
+func (c *Controller) ResourceType(ctx *fiber.Ctx) {
+	for _, resourceType := range resourceTypes {
+		if resourceType.Id == ctx.Params("id") {
+			respond(ctx, fiber.StatusOK, withResourceTypeMeta(ctx, resourceType))
+			return
+		}
+	}
+	errResponse(ctx, Error{Status: fiber.StatusNotFound, Detail: "ResourceType " + ctx.Params("id") + " not found"})
+}
+
+// функция-хендлер для GET запроса по маршруту "/scim/v2/Schemas"
+func (c *Controller) Schemas(ctx *fiber.Ctx) {
+	list := make([]Schema, len(schemas))
+	for i, schema := range schemas {
+		list[i] = withSchemaMeta(ctx, schema)
+	}
+	respond(ctx, fiber.StatusOK, newListResponse(list, int64(len(list)), 1))
+}
+
+// функция-хендлер для GET запроса по маршруту "/scim/v2/Schemas/:id", id — URN схемы
+func (c *Controller) Schema(ctx *fiber.Ctx) {
+	for _, schema := range schemas {
+		if schema.Id == ctx.Params("id") {
+			respond(ctx, fiber.StatusOK, withSchemaMeta(ctx, schema))
+			return
+		}
+	}
+	errResponse(ctx, Error{Status: fiber.StatusNotFound, Detail: "Schema " + ctx.Params("id") + " not found"})
+}
+
+// функция-хендлер для GET запроса по маршруту "/scim/v2/Users?filter=userName eq "..."&startIndex=&count="
+func (c *Controller) ListUsers(ctx *fiber.Ctx) {
+	var request ListRequest
+	if err := ctx.QueryParser(&request); err != nil {
+		errResponse(ctx, invalidValue(err.Error()))
+		return
+	}
+	users, err := c.scimService.ListUsers(request)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+	for i := range users.Resources {
+		users.Resources[i] = withUserLocation(ctx, users.Resources[i])
+	}
+	respond(ctx, fiber.StatusOK, users)
+}
+
+// функция-хендлер для GET запроса по маршруту "/scim/v2/Users/:id"
+func (c *Controller) GetUser(ctx *fiber.Ctx) {
+	user, err := c.scimService.GetUser(ctx.Params("id"))
+	c.userResponse(ctx, fiber.StatusOK, user, err)
+}
+
+// функция-хендлер для POST запроса по маршруту "/scim/v2/Users"
+func (c *Controller) CreateUser(ctx *fiber.Ctx) {
+	var request User
+	if !parseBody(ctx, &request) {
+		return
+	}
+	user, err := c.scimService.CreateUser(audit.ActorFrom(c.server, ctx), request)
+	c.userResponse(ctx, fiber.StatusCreated, user, err)
+}
+
+// функция-хендлер для PUT запроса по маршруту "/scim/v2/Users/:id"
+func (c *Controller) ReplaceUser(ctx *fiber.Ctx) {
+	var request User
+	if !parseBody(ctx, &request) {
+		return
+	}
+	user, err := c.scimService.ReplaceUser(audit.ActorFrom(c.server, ctx), ctx.Params("id"), request)
+	c.userResponse(ctx, fiber.StatusOK, user, err)
+}
+
+// функция-хендлер для PATCH запроса по маршруту "/scim/v2/Users/:id"
+func (c *Controller) PatchUser(ctx *fiber.Ctx) {
+	var request PatchRequest
+	if !parseBody(ctx, &request) {
+		return
+	}
+	user, err := c.scimService.PatchUser(audit.ActorFrom(c.server, ctx), ctx.Params("id"), request)
+	c.userResponse(ctx, fiber.StatusOK, user, err)
+}
+
+// функция-хендлер для DELETE запроса по маршруту "/scim/v2/Users/:id"; сотрудник удаляется мягко
+func (c *Controller) DeleteUser(ctx *fiber.Ctx) {
+	if err := c.scimService.DeleteUser(audit.ActorFrom(c.server, ctx), ctx.Params("id")); err != nil {
+		errResponse(ctx, err)
+		return
+	}
+	ctx.Status(fiber.StatusNoContent)
+}
+
+// функция-хендлер для GET запроса по маршруту "/scim/v2/Groups?filter=displayName eq "..."&startIndex=&count="
+func (c *Controller) ListGroups(ctx *fiber.Ctx) {
+	var request ListRequest
+	if err := ctx.QueryParser(&request); err != nil {
+		errResponse(ctx, invalidValue(err.Error()))
+		return
+	}
+	groups, err := c.scimService.ListGroups(request)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+	for i := range groups.Resources {
+		groups.Resources[i] = withGroupLocation(ctx, groups.Resources[i])
+	}
+	respond(ctx, fiber.StatusOK, groups)
+}
+
+// функция-хендлер для GET запроса по маршруту "/scim/v2/Groups/:id"
+func (c *Controller) GetGroup(ctx *fiber.Ctx) {
+	group, err := c.scimService.GetGroup(ctx.Params("id"))
+	c.groupResponse(ctx, fiber.StatusOK, group, err)
+}
+
+// функция-хендлер для POST запроса по маршруту "/scim/v2/Groups"
+func (c *Controller) CreateGroup(ctx *fiber.Ctx) {
+	var request Group
+	if !parseBody(ctx, &request) {
+		return
+	}
+	group, err := c.scimService.CreateGroup(audit.ActorFrom(c.server, ctx), request)
+	c.groupResponse(ctx, fiber.StatusCreated, group, err)
+}
+
+// функция-хендлер для PUT запроса по маршруту "/scim/v2/Groups/:id"
+func (c *Controller) ReplaceGroup(ctx *fiber.Ctx) {
+	var request Group
+	if !parseBody(ctx, &request) {
+		return
+	}
+	group, err := c.scimService.ReplaceGroup(audit.ActorFrom(c.server, ctx), ctx.Params("id"), request)
+	c.groupResponse(ctx, fiber.StatusOK, group, err)
+}
+
+// функция-хендлер для PATCH запроса по маршруту "/scim/v2/Groups/:id"
+func (c *Controller) PatchGroup(ctx *fiber.Ctx) {
+	var request PatchRequest
+	if !parseBody(ctx, &request) {
+		return
+	}
+	group, err := c.scimService.PatchGroup(audit.ActorFrom(c.server, ctx), ctx.Params("id"), request)
+	c.groupResponse(ctx, fiber.StatusOK, group, err)
+}
+
+// функция-хендлер для DELETE запроса по маршруту "/scim/v2/Groups/:id"; роль удаляется мягко
+func (c *Controller) DeleteGroup(ctx *fiber.Ctx) {
+	if err := c.scimService.DeleteGroup(audit.ActorFrom(c.server, ctx), ctx.Params("id")); err != nil {
+		errResponse(ctx, err)
+		return
+	}
+	ctx.Status(fiber.StatusNoContent)
+}
+
+func (c *Controller) userResponse(ctx *fiber.Ctx, status int, user User, err error) {
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+	user = withUserLocation(ctx, user)
+	if status == fiber.StatusCreated {
+		ctx.Set(fiber.HeaderLocation, user.Meta.Location)
+	}
+	respond(ctx, status, user)
+}
+
+func (c *Controller) groupResponse(ctx *fiber.Ctx, status int, group Group, err error) {
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+	group = withGroupLocation(ctx, group)
+	if status == fiber.StatusCreated {
+		ctx.Set(fiber.HeaderLocation, group.Meta.Location)
+	}
+	respond(ctx, status, group)
+}
+
+// parseBody разбирает тело запроса как JSON независимо от Content-Type: провайдеры присылают
+// и application/scim+json, и application/json
+func parseBody(ctx *fiber.Ctx, request any) bool {
+	if err := json.Unmarshal([]byte(ctx.Body()), request); err != nil {
+		errResponse(ctx, invalidSyntax(err.Error()))
+		return false
+	}
+	return true
+}
+
+// location абсолютный адрес ресурса SCIM на этом сервере
+func location(ctx *fiber.Ctx, path string) string {
+	return ctx.BaseURL() + web.ScimPath + "/" + path
+}
+
+func withUserLocation(ctx *fiber.Ctx, user User) User {
+	if user.Meta != nil {
+		meta := *user.Meta
+		meta.Location = location(ctx, "Users/"+user.Id)
+		user.Meta = &meta
+	}
+	for i := range user.Groups {
+		user.Groups[i].Ref = location(ctx, "Groups/"+user.Groups[i].Value)
+	}
+	return user
+}
+
+func withGroupLocation(ctx *fiber.Ctx, group Group) Group {
+	if group.Meta != nil {
+		meta := *group.Meta
+		meta.Location = location(ctx, "Groups/"+group.Id)
+		group.Meta = &meta
+	}
+	for i := range group.Members {
+		group.Members[i].Ref = location(ctx, "Users/"+group.Members[i].Value)
+	}
+	return group
+}
+
+func withResourceTypeMeta(ctx *fiber.Ctx, resourceType ResourceType) ResourceType {
+	resourceType.Meta = &Meta{ResourceType: "ResourceType", Location: location(ctx, "ResourceTypes/"+resourceType.Id)}
+	return resourceType
+}
+
+func withSchemaMeta(ctx *fiber.Ctx, schema Schema) Schema {
+	schema.Meta = &Meta{ResourceType: "Schema", Location: location(ctx, "Schemas/"+schema.Id)}
+	return schema
+}
+
+// respond ответ SCIM: JSON с типом содержимого application/scim+json
+func respond(ctx *fiber.Ctx, status int, body any) {
+	ctx.Status(status)
+	if err := ctx.JSON(body); err != nil {
+		errResponse(ctx, err)
+		return
+	}
+	ctx.Set(fiber.HeaderContentType, ContentType)
+}
+
+// errResponse ответ с ошибкой в формате SCIM: ошибки валидации — 400 invalidValue,
+// существующее имя — 409 uniqueness, отсутствующий ресурс — 404, всё остальное — 500
+func errResponse(ctx *fiber.Ctx, err error) {
+	var scimErr Error
+	switch {
+	case errors.As(err, &scimErr):
+	case errors.As(err, &common.RequestValidationError{}):
+		scimErr = invalidValue(err.Error()).(Error)
+	case errors.As(err, &common.AlreadyExistsError{}):
+		scimErr = Error{Status: fiber.StatusConflict, ScimType: "uniqueness", Detail: err.Error()}
+	case errors.As(err, &common.NotFoundError{}):
+		scimErr = Error{Status: fiber.StatusNotFound, Detail: err.Error()}
+	case errors.As(err, &common.PermissionDeniedError{}):
+		scimErr = Error{Status: fiber.StatusForbidden, Detail: err.Error()}
+	default:
+		scimErr = Error{Status: fiber.StatusInternalServerError, Detail: err.Error()}
+	}
+	ctx.Status(scimErr.Status)
+	_ = ctx.JSON(ErrorResponse{
+		Schemas:  []string{SchemaError},
+		Status:   strconv.Itoa(scimErr.Status),
+		ScimType: scimErr.ScimType,
+		Detail:   scimErr.Detail,
+	})
+	ctx.Set(fiber.HeaderContentType, ContentType)
+}
@@ -0,0 +1,182 @@
+package scim
+
+import (
+	"encoding/json"
+	"github.com/gofiber/fiber"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/audit"
+	"idm/inner/common"
+	"idm/inner/web"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type MockService struct {
+	mock.Mock
+}
+
+func (m *MockService) ListUsers(request ListRequest) (ListResponse[User], error) {
+	args := m.Called(request)
+	return args.Get(0).(ListResponse[User]), args.Error(1)
+}
+
+func (m *MockService) GetUser(id string) (User, error) {
+	args := m.Called(id)
+	return args.Get(0).(User), args.Error(1)
+}
+
+func (m *MockService) CreateUser(actor audit.Actor, user User) (User, error) {
+	args := m.Called(user)
+	return args.Get(0).(User), args.Error(1)
+}
+
+func (m *MockService) ReplaceUser(actor audit.Actor, id string, user User) (User, error) {
+	args := m.Called(id, user)
+	return args.Get(0).(User), args.Error(1)
+}
+
+func (m *MockService) PatchUser(actor audit.Actor, id string, request PatchRequest) (User, error) {
+	args := m.Called(id, request)
+	return args.Get(0).(User), args.Error(1)
+}
+
+func (m *MockService) DeleteUser(actor audit.Actor, id string) error {
+	return m.Called(id).Error(0)
+}
+
+func (m *MockService) ListGroups(request ListRequest) (ListResponse[Group], error) {
+	args := m.Called(request)
+	return args.Get(0).(ListResponse[Group]), args.Error(1)
+}
+
+func (m *MockService) GetGroup(id string) (Group, error) {
+	args := m.Called(id)
+	return args.Get(0).(Group), args.Error(1)
+}
+
+func (m *MockService) CreateGroup(actor audit.Actor, group Group) (Group, error) {
+	args := m.Called(group)
+	return args.Get(0).(Group), args.Error(1)
+}
+
+func (m *MockService) ReplaceGroup(actor audit.Actor, id string, group Group) (Group, error) {
+	args := m.Called(id, group)
+	return args.Get(0).(Group), args.Error(1)
+}
+
+func (m *MockService) PatchGroup(actor audit.Actor, id string, request PatchRequest) (Group, error) {
+	args := m.Called(id, request)
+	return args.Get(0).(Group), args.Error(1)
+}
+
+func (m *MockService) DeleteGroup(actor audit.Actor, id string) error {
+	return m.Called(id).Error(0)
+}
+
+func TestController(t *testing.T) {
+	mockService := new(MockService)
+	server := web.NewServer()
+	controller := NewController(server, mockService)
+	controller.RegisterRoutes()
+
+	t.Run("ListUsersWithFilter", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		user := User{Schemas: []string{SchemaUser}, Id: "7", UserName: "John Doe", Meta: &Meta{ResourceType: "User"},
+			Groups: []Ref{{Value: "3", Display: "Admins"}}}
+		mockService.On("ListUsers", ListRequest{Filter: `userName eq "John Doe"`}).
+			Return(newListResponse([]User{user}, 1, 1), nil)
+
+		query := url.Values{"filter": {`userName eq "John Doe"`}}.Encode()
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/scim/v2/Users?"+query, nil))
+		assert.NoError(t, err)
+
+		var response ListResponse[User]
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, ContentType, resp.Header.Get(fiber.HeaderContentType))
+		assert.Equal(t, []string{SchemaListResponse}, response.Schemas)
+		assert.True(t, strings.HasSuffix(response.Resources[0].Meta.Location, "/scim/v2/Users/7"))
+		assert.True(t, strings.HasSuffix(response.Resources[0].Groups[0].Ref, "/scim/v2/Groups/3"))
+	})
+
+	t.Run("CreateUserFromScimJson", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		request := User{Schemas: []string{SchemaUser}, UserName: "Jane Doe"}
+		mockService.On("CreateUser", request).
+			Return(User{Schemas: []string{SchemaUser}, Id: "8", UserName: "Jane Doe", Meta: &Meta{ResourceType: "User"}}, nil)
+
+		body := `{"schemas":["` + SchemaUser + `"],"userName":"Jane Doe","name":{"givenName":"Jane"}}`
+		req := httptest.NewRequest(fiber.MethodPost, "/scim/v2/Users", strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, ContentType)
+		resp, err := server.App.Test(req)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusCreated, resp.StatusCode)
+		assert.True(t, strings.HasSuffix(resp.Header.Get(fiber.HeaderLocation), "/scim/v2/Users/8"))
+	})
+
+	t.Run("ConflictAsScimError", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("CreateGroup", mock.Anything).Return(Group{}, common.AlreadyExistsError{Resource: "role", ID: "Admins"})
+
+		body := `{"schemas":["` + SchemaGroup + `"],"displayName":"Admins"}`
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodPost, "/scim/v2/Groups", strings.NewReader(body)))
+		assert.NoError(t, err)
+
+		var response ErrorResponse
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+		assert.Equal(t, fiber.StatusConflict, resp.StatusCode)
+		assert.Equal(t, ErrorResponse{Schemas: []string{SchemaError}, Status: "409", ScimType: "uniqueness",
+			Detail: common.AlreadyExistsError{Resource: "role", ID: "Admins"}.Error()}, response)
+	})
+
+	t.Run("InvalidJson", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodPatch, "/scim/v2/Groups/3", strings.NewReader("{")))
+		assert.NoError(t, err)
+
+		var response ErrorResponse
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, "invalidSyntax", response.ScimType)
+		assert.True(t, mockService.AssertNotCalled(t, "PatchGroup", mock.Anything, mock.Anything))
+	})
+
+	t.Run("DeleteUser", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("DeleteUser", "7").Return(nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodDelete, "/scim/v2/Users/7", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusNoContent, resp.StatusCode)
+	})
+
+	t.Run("Discovery", func(t *testing.T) {
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/scim/v2/ServiceProviderConfig", nil))
+		assert.NoError(t, err)
+		var config ServiceProviderConfig
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&config))
+		assert.True(t, config.Patch.Supported)
+		assert.Equal(t, MaxResults, config.Filter.MaxResults)
+
+		resp, err = server.App.Test(httptest.NewRequest(fiber.MethodGet, "/scim/v2/ResourceTypes", nil))
+		assert.NoError(t, err)
+		var types ListResponse[ResourceType]
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&types))
+		assert.Equal(t, int64(2), types.TotalResults)
+
+		resp, err = server.App.Test(httptest.NewRequest(fiber.MethodGet, "/scim/v2/Schemas/"+SchemaGroup, nil))
+		assert.NoError(t, err)
+		var schema Schema
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&schema))
+		assert.Equal(t, "Group", schema.Name)
+
+		resp, err = server.App.Test(httptest.NewRequest(fiber.MethodGet, "/scim/v2/Schemas/unknown", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	})
+}
@@ -0,0 +1,116 @@
+package scim
+
+// описание возможностей сервера для эндпоинтов обнаружения (RFC 7644, раздел 4)
+
+type supported struct {
+	Supported bool `json:"supported"`
+}
+
+type filterConfig struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+type bulkConfig struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+type authenticationScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Primary     bool   `json:"primary"`
+}
+
+// ServiceProviderConfig поддерживаемые возможности: PATCH и фильтр eq есть, bulk, сортировки,
+// смены пароля и ETag нет
+type ServiceProviderConfig struct {
+	Schemas               []string               `json:"schemas"`
+	Patch                 supported              `json:"patch"`
+	Bulk                  bulkConfig             `json:"bulk"`
+	Filter                filterConfig           `json:"filter"`
+	ChangePassword        supported              `json:"changePassword"`
+	Sort                  supported              `json:"sort"`
+	Etag                  supported              `json:"etag"`
+	AuthenticationSchemes []authenticationScheme `json:"authenticationSchemes"`
+	Meta                  *Meta                  `json:"meta,omitempty"`
+}
+
+var serviceProviderConfig = ServiceProviderConfig{
+	Schemas: []string{SchemaServiceProviderConfig},
+	Patch:   supported{Supported: true},
+	Filter:  filterConfig{Supported: true, MaxResults: MaxResults},
+	AuthenticationSchemes: []authenticationScheme{{
+		Type:        "oauthbearertoken",
+		Name:        "OAuth Bearer Token",
+		Description: "Bearer token issued by idm or its identity provider, or an idm API key",
+		Primary:     true,
+	}},
+}
+
+// ResourceType описание типа ресурса: адрес и схема
+type ResourceType struct {
+	Schemas  []string `json:"schemas"`
+	Id       string   `json:"id"`
+	Name     string   `json:"name"`
+	Endpoint string   `json:"endpoint"`
+	Schema   string   `json:"schema"`
+	Meta     *Meta    `json:"meta,omitempty"`
+}
+
+var resourceTypes = []ResourceType{
+	{Schemas: []string{SchemaResourceType}, Id: "User", Name: "User", Endpoint: "/Users", Schema: SchemaUser},
+	{Schemas: []string{SchemaResourceType}, Id: "Group", Name: "Group", Endpoint: "/Groups", Schema: SchemaGroup},
+}
+
+// Attribute описание атрибута схемы; перечислены только атрибуты, которые хранит idm
+type Attribute struct {
+	Name          string      `json:"name"`
+	Type          string      `json:"type"`
+	MultiValued   bool        `json:"multiValued"`
+	Required      bool        `json:"required"`
+	CaseExact     bool        `json:"caseExact"`
+	Mutability    string      `json:"mutability"`
+	Returned      string      `json:"returned"`
+	Uniqueness    string      `json:"uniqueness"`
+	SubAttributes []Attribute `json:"subAttributes,omitempty"`
+}
+
+// Schema описание схемы ресурса
+type Schema struct {
+	Schemas     []string    `json:"schemas"`
+	Id          string      `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Attributes  []Attribute `json:"attributes"`
+	Meta        *Meta       `json:"meta,omitempty"`
+}
+
+// refAttributes податрибуты ссылок groups и members
+var refAttributes = []Attribute{
+	{Name: "value", Type: "string", Mutability: "immutable", Returned: "default", Uniqueness: "none"},
+	{Name: "display", Type: "string", Mutability: "readOnly", Returned: "default", Uniqueness: "none"},
+}
+
+var schemas = []Schema{
+	{
+		Schemas: []string{SchemaSchema}, Id: SchemaUser, Name: "User", Description: "Employee",
+		Attributes: []Attribute{
+			{Name: "userName", Type: "string", Required: true, Mutability: "readWrite", Returned: "default", Uniqueness: "server"},
+			{Name: "displayName", Type: "string", Mutability: "readOnly", Returned: "default", Uniqueness: "none"},
+			{Name: "active", Type: "boolean", Mutability: "readWrite", Returned: "default", Uniqueness: "none"},
+			{Name: "groups", Type: "complex", MultiValued: true, Mutability: "readOnly", Returned: "default", Uniqueness: "none",
+				SubAttributes: refAttributes},
+		},
+	},
+	{
+		Schemas: []string{SchemaSchema}, Id: SchemaGroup, Name: "Group", Description: "Role",
+		Attributes: []Attribute{
+			{Name: "displayName", Type: "string", Required: true, Mutability: "readWrite", Returned: "default", Uniqueness: "server"},
+			{Name: "members", Type: "complex", MultiValued: true, Mutability: "readWrite", Returned: "default", Uniqueness: "none",
+				SubAttributes: refAttributes},
+		},
+	},
+}
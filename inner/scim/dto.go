@@ -0,0 +1,200 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+	"strconv"
+	"time"
+)
+
+// идентификаторы схем SCIM 2.0 (RFC 7643, RFC 7644)
+const (
+	SchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	SchemaSchema                = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+)
+
+// ContentType тип содержимого запросов и ответов SCIM
+const ContentType = "application/scim+json"
+
+// MaxResults наибольшее количество ресурсов в одном ответе списка; объявлено в ServiceProviderConfig
+const MaxResults = 100
+
+// UserEntity сотрудник вместе с ролями, выданными ему через employee_role
+type UserEntity struct {
+	Id         int64          `db:"id"`
+	Name       string         `db:"name"`
+	Status     string         `db:"status"`
+	CreatedAt  time.Time      `db:"created_at"`
+	UpdatedAt  time.Time      `db:"updated_at"`
+	GroupIds   pq.Int64Array  `db:"group_ids"`
+	GroupNames pq.StringArray `db:"group_names"`
+}
+
+// GroupEntity роль вместе с сотрудниками, которым она выдана
+type GroupEntity struct {
+	Id          int64          `db:"id"`
+	Name        string         `db:"name"`
+	CreatedAt   time.Time      `db:"created_at"`
+	UpdatedAt   time.Time      `db:"updated_at"`
+	MemberIds   pq.Int64Array  `db:"member_ids"`
+	MemberNames pq.StringArray `db:"member_names"`
+}
+
+// User ресурс SCIM User; userName и displayName — имя сотрудника, active — сотрудник в состоянии active.
+// groups только для чтения: членство меняется через Groups
+type User struct {
+	Schemas     []string `json:"schemas"`
+	Id          string   `json:"id,omitempty"`
+	UserName    string   `json:"userName" validate:"required,min=2,max=155"`
+	DisplayName string   `json:"displayName,omitempty"`
+	Active      *bool    `json:"active,omitempty"`
+	Groups      []Ref    `json:"groups,omitempty"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+// Group ресурс SCIM Group; displayName — название роли, members — сотрудники, которым она выдана
+type Group struct {
+	Schemas     []string `json:"schemas"`
+	Id          string   `json:"id,omitempty"`
+	DisplayName string   `json:"displayName" validate:"required,min=2,max=155"`
+	Members     []Ref    `json:"members,omitempty" validate:"max=1000,dive"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+// Ref ссылка на другой ресурс: участника группы или группу пользователя
+type Ref struct {
+	Value   string `json:"value" validate:"required,numeric"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// Meta служебные атрибуты ресурса; Location заполняет контроллер, ему известен адрес сервера
+type Meta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location,omitempty"`
+}
+
+func (e *UserEntity) toUser() User {
+	active := e.Status == "active"
+	groups := make([]Ref, len(e.GroupIds))
+	for i := range e.GroupIds {
+		groups[i] = Ref{Value: strconv.FormatInt(e.GroupIds[i], 10), Display: e.GroupNames[i]}
+	}
+	return User{
+		Schemas:     []string{SchemaUser},
+		Id:          strconv.FormatInt(e.Id, 10),
+		UserName:    e.Name,
+		DisplayName: e.Name,
+		Active:      &active,
+		Groups:      groups,
+		Meta:        &Meta{ResourceType: "User", Created: e.CreatedAt, LastModified: e.UpdatedAt},
+	}
+}
+
+func (e *GroupEntity) toGroup() Group {
+	members := make([]Ref, len(e.MemberIds))
+	for i := range e.MemberIds {
+		members[i] = Ref{Value: strconv.FormatInt(e.MemberIds[i], 10), Display: e.MemberNames[i]}
+	}
+	return Group{
+		Schemas:     []string{SchemaGroup},
+		Id:          strconv.FormatInt(e.Id, 10),
+		DisplayName: e.Name,
+		Members:     members,
+		Meta:        &Meta{ResourceType: "Group", Created: e.CreatedAt, LastModified: e.UpdatedAt},
+	}
+}
+
+// ListRequest параметры списка: фильтр вида `userName eq "..."` и постраничный вывод по номеру,
+// startIndex считается с 1
+type ListRequest struct {
+	Filter     string `query:"filter" validate:"max=500"`
+	StartIndex int    `query:"startIndex" validate:"omitempty,min=1"`
+	Count      *int   `query:"count" validate:"omitempty,min=0"`
+}
+
+// ListResponse страница ресурсов в формате SCIM
+type ListResponse[T any] struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int64    `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []T      `json:"Resources"`
+}
+
+func newListResponse[T any](resources []T, total int64, startIndex int) ListResponse[T] {
+	return ListResponse[T]{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}
+}
+
+// операции PATCH; провайдеры присылают их в любом регистре, например "Replace"
+const (
+	OpAdd     = "add"
+	OpRemove  = "remove"
+	OpReplace = "replace"
+)
+
+// PatchRequest запрос PATCH: операции применяются по порядку к одному ресурсу
+type PatchRequest struct {
+	Schemas    []string    `json:"schemas" validate:"required"`
+	Operations []Operation `json:"Operations" validate:"required,min=1,max=100,dive"`
+}
+
+// Operation операция PATCH; без Path значение — объект с заменяемыми атрибутами
+type Operation struct {
+	Op    string          `json:"op" validate:"required"`
+	Path  string          `json:"path" validate:"max=200"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Error ошибка в формате SCIM; ScimType уточняет причину ошибок 400 и 409
+type Error struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+func (err Error) Error() string {
+	if err.ScimType == "" {
+		return err.Detail
+	}
+	return fmt.Sprintf("%s: %s", err.ScimType, err.Detail)
+}
+
+// ErrorResponse тело ответа с ошибкой; status по RFC 7644 — строка
+type ErrorResponse struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+func invalidFilter(detail string) error {
+	return Error{Status: 400, ScimType: "invalidFilter", Detail: detail}
+}
+
+func invalidPath(detail string) error {
+	return Error{Status: 400, ScimType: "invalidPath", Detail: detail}
+}
+
+func invalidValue(detail string) error {
+	return Error{Status: 400, ScimType: "invalidValue", Detail: detail}
+}
+
+func invalidSyntax(detail string) error {
+	return Error{Status: 400, ScimType: "invalidSyntax", Detail: detail}
+}
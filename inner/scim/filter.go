@@ -0,0 +1,45 @@
+package scim
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// filterPattern единственная поддерживаемая форма фильтра: сравнение атрибута со строкой через eq
+var filterPattern = regexp.MustCompile(`^\s*([A-Za-z][\w.]*)\s+(?i:eq)\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+// memberPathPattern путь к одному участнику группы: members[value eq "42"]
+var memberPathPattern = regexp.MustCompile(`^(?i:members)\[\s*(?i:value)\s+(?i:eq)\s+"(\d+)"\s*\]$`)
+
+// parseFilter разбирает фильтр `attribute eq "value"`; атрибут — один из allowed, регистр имени не важен.
+// Пустой фильтр — пустой атрибут
+func parseFilter(filter string, allowed ...string) (attribute string, value string, err error) {
+	if strings.TrimSpace(filter) == "" {
+		return "", "", nil
+	}
+	match := filterPattern.FindStringSubmatch(filter)
+	if match == nil {
+		return "", "", invalidFilter(fmt.Sprintf("unsupported filter %q, expected attribute eq \"value\"", filter))
+	}
+	for _, name := range allowed {
+		if strings.EqualFold(name, match[1]) {
+			value, err = strconv.Unquote(`"` + match[2] + `"`)
+			if err != nil {
+				return "", "", invalidFilter(fmt.Sprintf("invalid string in filter %q", filter))
+			}
+			return name, value, nil
+		}
+	}
+	return "", "", invalidFilter(fmt.Sprintf("filtering by %s is not supported, supported: %s", match[1], strings.Join(allowed, ", ")))
+}
+
+// parseId идентификатор ресурса из URL или ссылки; нечисловой идентификатор — несуществующий ресурс
+func parseId(resource string, value string) (int64, error) {
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, Error{Status: 404, Detail: fmt.Sprintf("%s %s not found", resource, value)}
+	}
+	return id, nil
+}
@@ -0,0 +1,78 @@
+package scim
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type Repository struct {
+	db *sqlx.DB
+}
+
+func NewScimRepository(dataBase *sqlx.DB) *Repository {
+	return &Repository{db: dataBase}
+}
+
+func (repo *Repository) BeginTransaction() (tx *sqlx.Tx, err error) {
+	return repo.db.Beginx()
+}
+
+// selectUser сотрудник с ролями из employee_role, упорядоченными по id, чтобы идентификаторы и названия совпадали по позициям
+const selectUser = `SELECT e.id, e.name, e.status, e.created_at, e.updated_at,
+		array(SELECT r.id FROM employee_role er JOIN role r ON r.id = er.role_id
+			WHERE er.employee_id = e.id AND r.deleted_at IS NULL ORDER BY r.id) AS group_ids,
+		array(SELECT r.name FROM employee_role er JOIN role r ON r.id = er.role_id
+			WHERE er.employee_id = e.id AND r.deleted_at IS NULL ORDER BY r.id) AS group_names
+	FROM employee e WHERE e.deleted_at IS NULL`
+
+// selectGroup роль с сотрудниками из employee_role, упорядоченными по id
+const selectGroup = `SELECT r.id, r.name, r.created_at, r.updated_at,
+		array(SELECT e.id FROM employee_role er JOIN employee e ON e.id = er.employee_id
+			WHERE er.role_id = r.id AND e.deleted_at IS NULL ORDER BY e.id) AS member_ids,
+		array(SELECT e.name FROM employee_role er JOIN employee e ON e.id = er.employee_id
+			WHERE er.role_id = r.id AND e.deleted_at IS NULL ORDER BY e.id) AS member_names
+	FROM role r WHERE r.deleted_at IS NULL`
+
+// FindUsers страница сотрудников по порядку id; userName в SCIM сравнивается без учёта регистра,
+// пустое имя не ограничивает выборку
+func (repo *Repository) FindUsers(name string, offset int, limit int) (users []UserEntity, err error) {
+	users = []UserEntity{}
+	err = repo.db.Select(&users, selectUser+" AND ($1 = '' OR lower(e.name) = lower($1)) ORDER BY e.id OFFSET $2 LIMIT $3",
+		name, offset, limit)
+	return users, err
+}
+
+func (repo *Repository) CountUsers(name string) (count int64, err error) {
+	err = repo.db.Get(&count, "SELECT count(*) FROM employee e WHERE e.deleted_at IS NULL AND ($1 = '' OR lower(e.name) = lower($1))", name)
+	return count, err
+}
+
+func (repo *Repository) FindUserById(id int64) (user UserEntity, err error) {
+	err = repo.db.Get(&user, selectUser+" AND e.id = $1", id)
+	return user, err
+}
+
+// FindGroups страница ролей по порядку id; displayName сравнивается без учёта регистра
+func (repo *Repository) FindGroups(name string, offset int, limit int) (groups []GroupEntity, err error) {
+	groups = []GroupEntity{}
+	err = repo.db.Select(&groups, selectGroup+" AND ($1 = '' OR lower(r.name) = lower($1)) ORDER BY r.id OFFSET $2 LIMIT $3",
+		name, offset, limit)
+	return groups, err
+}
+
+func (repo *Repository) CountGroups(name string) (count int64, err error) {
+	err = repo.db.Get(&count, "SELECT count(*) FROM role r WHERE r.deleted_at IS NULL AND ($1 = '' OR lower(r.name) = lower($1))", name)
+	return count, err
+}
+
+func (repo *Repository) FindGroupById(id int64) (group GroupEntity, err error) {
+	err = repo.db.Get(&group, selectGroup+" AND r.id = $1", id)
+	return group, err
+}
+
+// FindUsersByIds сотрудники из списка; отсутствующие и удалённые не возвращаются
+func (repo *Repository) FindUsersByIds(ids []int64) (users []UserEntity, err error) {
+	users = []UserEntity{}
+	err = repo.db.Select(&users, selectUser+" AND e.id = any($1) ORDER BY e.id", pq.Array(ids))
+	return users, err
+}
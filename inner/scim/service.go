@@ -0,0 +1,604 @@
+package scim
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"idm/inner/audit"
+	"idm/inner/employee"
+	"idm/inner/role"
+	"strconv"
+	"strings"
+)
+
+// statusReason причина смены состояния сотрудника, записываемая в историю при изменении active
+const statusReason = "changed via SCIM"
+
+type Service struct {
+	repo      Repo
+	employees Employees
+	roles     Roles
+	validator Validator
+}
+
+func NewService(repo Repo, employees Employees, roles Roles, validator Validator) *Service {
+	return &Service{
+		repo:      repo,
+		employees: employees,
+		roles:     roles,
+		validator: validator,
+	}
+}
+
+type Validator interface {
+	Validate(request any) error
+}
+
+type Repo interface {
+	BeginTransaction() (tx *sqlx.Tx, err error)
+	FindUsers(name string, offset int, limit int) (users []UserEntity, err error)
+	CountUsers(name string) (count int64, err error)
+	FindUserById(id int64) (user UserEntity, err error)
+	FindUsersByIds(ids []int64) (users []UserEntity, err error)
+	FindGroups(name string, offset int, limit int) (groups []GroupEntity, err error)
+	CountGroups(name string) (count int64, err error)
+	FindGroupById(id int64) (group GroupEntity, err error)
+}
+
+// Employees изменения сотрудников, реализуется employee.Service: проверки, история состояний и аудит общие с API.
+// Изменения из нескольких шагов применяются методами *Tx в одной транзакции: запрос SCIM выполняется
+// целиком или не выполняется вовсе (RFC 7644, раздел 3.5.2)
+type Employees interface {
+	SaveTx(actor audit.Actor, entity employee.Entity) (int64, error)
+	PatchTx(tx *sqlx.Tx, actor audit.Actor, id int64, request employee.PatchRequest) (employee.Response, error)
+	ChangeStatusTx(tx *sqlx.Tx, actor audit.Actor, id int64, request employee.StatusRequest) (employee.Response, error)
+	Delete(actor audit.Actor, id int64) error
+	AddRoleTx(tx *sqlx.Tx, actor audit.Actor, id int64, roleId int64) error
+	RemoveRoleTx(tx *sqlx.Tx, actor audit.Actor, id int64, roleId int64) error
+}
+
+// Roles изменения ролей, реализуется role.Service
+type Roles interface {
+	CreateTx(tx *sqlx.Tx, actor audit.Actor, name string, parentIds []int64) (int64, error)
+	UpdateRoleTx(tx *sqlx.Tx, actor audit.Actor, id int64, request role.UpdateRequest) (role.Response, error)
+	Delete(actor audit.Actor, id int64) error
+}
+
+// ListUsers страница пользователей; поддерживается фильтр userName eq "..."
+func (service *Service) ListUsers(request ListRequest) (ListResponse[User], error) {
+	if err := service.validator.Validate(request); err != nil {
+		return ListResponse[User]{}, err
+	}
+	_, name, err := parseFilter(request.Filter, "userName")
+	if err != nil {
+		return ListResponse[User]{}, err
+	}
+	startIndex, count := page(request)
+	total, err := service.repo.CountUsers(name)
+	if err != nil {
+		return ListResponse[User]{}, fmt.Errorf("error counting scim users: %w", err)
+	}
+	entities, err := service.repo.FindUsers(name, startIndex-1, count)
+	if err != nil {
+		return ListResponse[User]{}, fmt.Errorf("error finding scim users: %w", err)
+	}
+	users := make([]User, len(entities))
+	for i := range entities {
+		users[i] = entities[i].toUser()
+	}
+	return newListResponse(users, total, startIndex), nil
+}
+
+func (service *Service) GetUser(id string) (User, error) {
+	entity, err := service.findUser(id)
+	if err != nil {
+		return User{}, err
+	}
+	return entity.toUser(), nil
+}
+
+// CreateUser создаёт сотрудника без роли: active=false — ещё не вышедший (pending)
+func (service *Service) CreateUser(actor audit.Actor, user User) (User, error) {
+	if err := service.checkResource(user, user.Schemas, SchemaUser); err != nil {
+		return User{}, err
+	}
+	status := employee.StatusActive
+	if user.Active != nil && !*user.Active {
+		status = employee.StatusPending
+	}
+	id, err := service.employees.SaveTx(actor, employee.Entity{Name: strings.TrimSpace(user.UserName), Status: status})
+	if err != nil {
+		return User{}, err
+	}
+	return service.GetUser(strconv.FormatInt(id, 10))
+}
+
+// ReplaceUser замена пользователя (PUT); без active состояние сотрудника не меняется
+func (service *Service) ReplaceUser(actor audit.Actor, id string, user User) (User, error) {
+	if err := service.checkResource(user, user.Schemas, SchemaUser); err != nil {
+		return User{}, err
+	}
+	current, err := service.findUser(id)
+	if err != nil {
+		return User{}, err
+	}
+	active := current.Status == employee.StatusActive
+	if user.Active != nil {
+		active = *user.Active
+	}
+	if err = service.applyUser(actor, current, strings.TrimSpace(user.UserName), active); err != nil {
+		return User{}, err
+	}
+	return service.GetUser(id)
+}
+
+// PatchUser применяет операции PATCH к userName и active
+func (service *Service) PatchUser(actor audit.Actor, id string, request PatchRequest) (User, error) {
+	if err := service.checkResource(request, request.Schemas, SchemaPatchOp); err != nil {
+		return User{}, err
+	}
+	current, err := service.findUser(id)
+	if err != nil {
+		return User{}, err
+	}
+	name, active := current.Name, current.Status == employee.StatusActive
+	for _, operation := range request.Operations {
+		op := strings.ToLower(operation.Op)
+		if op != OpAdd && op != OpReplace && op != OpRemove {
+			return User{}, invalidSyntax(fmt.Sprintf("unsupported operation %q", operation.Op))
+		}
+		attributes, err := operationAttributes(operation)
+		if err != nil {
+			return User{}, err
+		}
+		for attribute, value := range attributes {
+			switch strings.ToLower(attribute) {
+			case "username":
+				if op == OpRemove {
+					return User{}, Error{Status: 400, ScimType: "mutability", Detail: "userName is required"}
+				}
+				if name, err = decodeString(attribute, value); err != nil {
+					return User{}, err
+				}
+			case "active":
+				if op == OpRemove {
+					return User{}, Error{Status: 400, ScimType: "mutability", Detail: "active cannot be removed"}
+				}
+				if active, err = decodeBool(attribute, value); err != nil {
+					return User{}, err
+				}
+			default:
+				return User{}, invalidPath(fmt.Sprintf("attribute %s is not supported", attribute))
+			}
+		}
+	}
+	if err = service.validator.Validate(User{UserName: name}); err != nil {
+		return User{}, err
+	}
+	if err = service.applyUser(actor, current, name, active); err != nil {
+		return User{}, err
+	}
+	return service.GetUser(id)
+}
+
+func (service *Service) DeleteUser(actor audit.Actor, id string) error {
+	employeeId, err := parseId("User", id)
+	if err != nil {
+		return err
+	}
+	return service.employees.Delete(actor, employeeId)
+}
+
+// applyUser приводит сотрудника к заданным имени и активности в одной транзакции: active=true — переход
+// в active, false — приостановка активного сотрудника; неактивные сотрудники остаются в своём состоянии
+func (service *Service) applyUser(actor audit.Actor, current UserEntity, name string, active bool) (err error) {
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return fmt.Errorf("error apply scim user: error creating transaction: %w", err)
+	}
+	if name != current.Name {
+		if _, err = service.employees.PatchTx(tx, actor, current.Id, employee.PatchRequest{Name: &name}); err != nil {
+			return err
+		}
+	}
+	if active != (current.Status == employee.StatusActive) {
+		status := employee.StatusSuspended
+		if active {
+			status = employee.StatusActive
+		}
+		request := employee.StatusRequest{Status: status, Reason: statusReason}
+		if _, err = service.employees.ChangeStatusTx(tx, actor, current.Id, request); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (service *Service) findUser(id string) (UserEntity, error) {
+	employeeId, err := parseId("User", id)
+	if err != nil {
+		return UserEntity{}, err
+	}
+	entity, err := service.repo.FindUserById(employeeId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return UserEntity{}, Error{Status: 404, Detail: fmt.Sprintf("User %s not found", id)}
+	}
+	if err != nil {
+		return UserEntity{}, fmt.Errorf("error finding scim user %s: %w", id, err)
+	}
+	return entity, nil
+}
+
+// ListGroups страница групп; поддерживается фильтр displayName eq "..."
+func (service *Service) ListGroups(request ListRequest) (ListResponse[Group], error) {
+	if err := service.validator.Validate(request); err != nil {
+		return ListResponse[Group]{}, err
+	}
+	_, name, err := parseFilter(request.Filter, "displayName")
+	if err != nil {
+		return ListResponse[Group]{}, err
+	}
+	startIndex, count := page(request)
+	total, err := service.repo.CountGroups(name)
+	if err != nil {
+		return ListResponse[Group]{}, fmt.Errorf("error counting scim groups: %w", err)
+	}
+	entities, err := service.repo.FindGroups(name, startIndex-1, count)
+	if err != nil {
+		return ListResponse[Group]{}, fmt.Errorf("error finding scim groups: %w", err)
+	}
+	groups := make([]Group, len(entities))
+	for i := range entities {
+		groups[i] = entities[i].toGroup()
+	}
+	return newListResponse(groups, total, startIndex), nil
+}
+
+func (service *Service) GetGroup(id string) (Group, error) {
+	entity, err := service.findGroup(id)
+	if err != nil {
+		return Group{}, err
+	}
+	return entity.toGroup(), nil
+}
+
+// CreateGroup создаёт роль и выдаёт её участникам группы в одной транзакции
+func (service *Service) CreateGroup(actor audit.Actor, group Group) (Group, error) {
+	if err := service.checkResource(group, group.Schemas, SchemaGroup); err != nil {
+		return Group{}, err
+	}
+	members, err := memberIds(group.Members)
+	if err != nil {
+		return Group{}, err
+	}
+	if err = service.checkMembers(members); err != nil {
+		return Group{}, err
+	}
+	id, err := service.createGroup(actor, strings.TrimSpace(group.DisplayName), members)
+	if err != nil {
+		return Group{}, err
+	}
+	return service.GetGroup(strconv.FormatInt(id, 10))
+}
+
+func (service *Service) createGroup(actor audit.Actor, name string, members []int64) (id int64, err error) {
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return 0, fmt.Errorf("error create scim group: error creating transaction: %w", err)
+	}
+	if id, err = service.roles.CreateTx(tx, actor, name, nil); err != nil {
+		return 0, err
+	}
+	return id, service.applyGroupTx(tx, actor, GroupEntity{Id: id, Name: name}, name, members)
+}
+
+// ReplaceGroup замена группы (PUT): название и полный состав участников
+func (service *Service) ReplaceGroup(actor audit.Actor, id string, group Group) (Group, error) {
+	if err := service.checkResource(group, group.Schemas, SchemaGroup); err != nil {
+		return Group{}, err
+	}
+	members, err := memberIds(group.Members)
+	if err != nil {
+		return Group{}, err
+	}
+	current, err := service.findGroup(id)
+	if err != nil {
+		return Group{}, err
+	}
+	if err = service.applyGroup(actor, current, strings.TrimSpace(group.DisplayName), members); err != nil {
+		return Group{}, err
+	}
+	return service.GetGroup(id)
+}
+
+// PatchGroup применяет операции PATCH к displayName и members, в том числе к members[value eq "..."]
+func (service *Service) PatchGroup(actor audit.Actor, id string, request PatchRequest) (Group, error) {
+	if err := service.checkResource(request, request.Schemas, SchemaPatchOp); err != nil {
+		return Group{}, err
+	}
+	current, err := service.findGroup(id)
+	if err != nil {
+		return Group{}, err
+	}
+	name, members := current.Name, []int64(current.MemberIds)
+	for _, operation := range request.Operations {
+		op := strings.ToLower(operation.Op)
+		if op != OpAdd && op != OpReplace && op != OpRemove {
+			return Group{}, invalidSyntax(fmt.Sprintf("unsupported operation %q", operation.Op))
+		}
+		if match := memberPathPattern.FindStringSubmatch(operation.Path); match != nil {
+			if op != OpRemove {
+				return Group{}, invalidPath(fmt.Sprintf("%s is supported only for remove", operation.Path))
+			}
+			memberId, _ := strconv.ParseInt(match[1], 10, 64)
+			members = without(members, []int64{memberId})
+			continue
+		}
+		attributes, err := operationAttributes(operation)
+		if err != nil {
+			return Group{}, err
+		}
+		for attribute, value := range attributes {
+			switch strings.ToLower(attribute) {
+			case "displayname":
+				if op == OpRemove {
+					return Group{}, Error{Status: 400, ScimType: "mutability", Detail: "displayName is required"}
+				}
+				if name, err = decodeString(attribute, value); err != nil {
+					return Group{}, err
+				}
+			case "members":
+				var refs []int64
+				if len(value) > 0 {
+					if refs, err = decodeMembers(value); err != nil {
+						return Group{}, err
+					}
+				}
+				switch {
+				case op == OpAdd:
+					members = union(members, refs)
+				case op == OpReplace:
+					members = union(nil, refs)
+				case len(value) == 0:
+					members = nil
+				default:
+					members = without(members, refs)
+				}
+			default:
+				return Group{}, invalidPath(fmt.Sprintf("attribute %s is not supported", attribute))
+			}
+		}
+	}
+	if err = service.validator.Validate(Group{DisplayName: name}); err != nil {
+		return Group{}, err
+	}
+	if err = service.applyGroup(actor, current, name, members); err != nil {
+		return Group{}, err
+	}
+	return service.GetGroup(id)
+}
+
+func (service *Service) DeleteGroup(actor audit.Actor, id string) error {
+	roleId, err := parseId("Group", id)
+	if err != nil {
+		return err
+	}
+	return service.roles.Delete(actor, roleId)
+}
+
+// applyGroup переименовывает роль и выдаёт или забирает её так, чтобы участниками стали ровно members;
+// все изменения применяются в одной транзакции
+func (service *Service) applyGroup(actor audit.Actor, current GroupEntity, name string, members []int64) (err error) {
+	if err = service.checkMembers(without(members, current.MemberIds)); err != nil {
+		return err
+	}
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return fmt.Errorf("error apply scim group: error creating transaction: %w", err)
+	}
+	return service.applyGroupTx(tx, actor, current, name, members)
+}
+
+// applyGroupTx изменения группы в транзакции tx; каждое пишется в аудит отдельной записью тем же сервисом,
+// что и в API
+func (service *Service) applyGroupTx(tx *sqlx.Tx, actor audit.Actor, current GroupEntity, name string, members []int64) error {
+	if name != current.Name {
+		if _, err := service.roles.UpdateRoleTx(tx, actor, current.Id, role.UpdateRequest{Name: name}); err != nil {
+			return err
+		}
+	}
+	for _, memberId := range without(members, current.MemberIds) {
+		if err := service.employees.AddRoleTx(tx, actor, memberId, current.Id); err != nil {
+			return err
+		}
+	}
+	for _, memberId := range without(current.MemberIds, members) {
+		if err := service.employees.RemoveRoleTx(tx, actor, memberId, current.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMembers участниками могут стать только существующие сотрудники, которые не уволены
+func (service *Service) checkMembers(ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	users, err := service.repo.FindUsersByIds(ids)
+	if err != nil {
+		return fmt.Errorf("error finding scim group members: %w", err)
+	}
+	found := make(map[int64]bool, len(users))
+	for _, user := range users {
+		if user.Status == employee.StatusTerminated {
+			return invalidValue(fmt.Sprintf("User %d is terminated and cannot be a member", user.Id))
+		}
+		found[user.Id] = true
+	}
+	for _, id := range ids {
+		if !found[id] {
+			return invalidValue(fmt.Sprintf("member User %d not found", id))
+		}
+	}
+	return nil
+}
+
+func (service *Service) findGroup(id string) (GroupEntity, error) {
+	roleId, err := parseId("Group", id)
+	if err != nil {
+		return GroupEntity{}, err
+	}
+	entity, err := service.repo.FindGroupById(roleId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return GroupEntity{}, Error{Status: 404, Detail: fmt.Sprintf("Group %s not found", id)}
+	}
+	if err != nil {
+		return GroupEntity{}, fmt.Errorf("error finding scim group %s: %w", id, err)
+	}
+	return entity, nil
+}
+
+// checkResource проверяет поля ресурса и наличие его схемы в schemas
+func (service *Service) checkResource(resource any, schemas []string, schema string) error {
+	found := false
+	for _, s := range schemas {
+		found = found || s == schema
+	}
+	if !found {
+		return invalidSyntax(fmt.Sprintf("schemas must contain %s", schema))
+	}
+	return service.validator.Validate(resource)
+}
+
+// page номер первого ресурса и размер страницы; count больше MaxResults урезается
+func page(request ListRequest) (startIndex int, count int) {
+	startIndex, count = request.StartIndex, MaxResults
+	if startIndex == 0 {
+		startIndex = 1
+	}
+	if request.Count != nil && *request.Count < count {
+		count = *request.Count
+	}
+	return startIndex, count
+}
+
+// operationAttributes заменяемые атрибуты операции: атрибут из path или, без path, поля объекта value
+func operationAttributes(operation Operation) (map[string]json.RawMessage, error) {
+	if operation.Path != "" {
+		return map[string]json.RawMessage{operation.Path: operation.Value}, nil
+	}
+	if strings.ToLower(operation.Op) == OpRemove {
+		return nil, Error{Status: 400, ScimType: "noTarget", Detail: "remove requires path"}
+	}
+	var attributes map[string]json.RawMessage
+	if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+		return nil, invalidValue("value without path must be an object")
+	}
+	return attributes, nil
+}
+
+func decodeString(attribute string, value json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return "", invalidValue(fmt.Sprintf("%s must be a string", attribute))
+	}
+	return strings.TrimSpace(s), nil
+}
+
+// decodeBool принимает и строки "True"/"False": так active присылают некоторые провайдеры
+func decodeBool(attribute string, value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		if b, err = strconv.ParseBool(strings.ToLower(s)); err == nil {
+			return b, nil
+		}
+	}
+	return false, invalidValue(fmt.Sprintf("%s must be a boolean", attribute))
+}
+
+// decodeMembers участники из value: массив ссылок или одна ссылка
+func decodeMembers(value json.RawMessage) ([]int64, error) {
+	var refs []Ref
+	if err := json.Unmarshal(value, &refs); err != nil {
+		var ref Ref
+		if err = json.Unmarshal(value, &ref); err != nil {
+			return nil, invalidValue("members must be an array of {\"value\": \"<User id>\"}")
+		}
+		refs = []Ref{ref}
+	}
+	return memberIds(refs)
+}
+
+func memberIds(refs []Ref) ([]int64, error) {
+	ids := make([]int64, 0, len(refs))
+	for _, ref := range refs {
+		id, err := strconv.ParseInt(ref.Value, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, invalidValue(fmt.Sprintf("member value %q is not a User id", ref.Value))
+		}
+		ids = append(ids, id)
+	}
+	return union(nil, ids), nil
+}
+
+// union ids из a и b без повторов в порядке первого появления
+func union(a []int64, b []int64) []int64 {
+	seen := make(map[int64]bool, len(a)+len(b))
+	result := make([]int64, 0, len(a)+len(b))
+	for _, id := range append(append([]int64{}, a...), b...) {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// without ids из a, которых нет в b
+func without(a []int64, b []int64) []int64 {
+	excluded := make(map[int64]bool, len(b))
+	for _, id := range b {
+		excluded[id] = true
+	}
+	result := make([]int64, 0, len(a))
+	for _, id := range a {
+		if !excluded[id] {
+			result = append(result, id)
+		}
+	}
+	return result
+}
@@ -0,0 +1,362 @@
+package scim
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/78bits/go-sqlmock-sqlx"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/audit"
+	"idm/inner/common"
+	"idm/inner/employee"
+	"idm/inner/role"
+	"idm/inner/validator"
+	"testing"
+)
+
+type MockRepo struct {
+	mock.Mock
+}
+
+func (m *MockRepo) BeginTransaction() (*sqlx.Tx, error) {
+	args := m.Called()
+	return args.Get(0).(*sqlx.Tx), args.Error(1)
+}
+
+func (m *MockRepo) FindUsers(name string, offset int, limit int) ([]UserEntity, error) {
+	args := m.Called(name, offset, limit)
+	return args.Get(0).([]UserEntity), args.Error(1)
+}
+
+func (m *MockRepo) CountUsers(name string) (int64, error) {
+	args := m.Called(name)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepo) FindUserById(id int64) (UserEntity, error) {
+	args := m.Called(id)
+	return args.Get(0).(UserEntity), args.Error(1)
+}
+
+func (m *MockRepo) FindUsersByIds(ids []int64) ([]UserEntity, error) {
+	args := m.Called(ids)
+	return args.Get(0).([]UserEntity), args.Error(1)
+}
+
+func (m *MockRepo) FindGroups(name string, offset int, limit int) ([]GroupEntity, error) {
+	args := m.Called(name, offset, limit)
+	return args.Get(0).([]GroupEntity), args.Error(1)
+}
+
+func (m *MockRepo) CountGroups(name string) (int64, error) {
+	args := m.Called(name)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepo) FindGroupById(id int64) (GroupEntity, error) {
+	args := m.Called(id)
+	return args.Get(0).(GroupEntity), args.Error(1)
+}
+
+type MockEmployees struct {
+	mock.Mock
+}
+
+func (m *MockEmployees) SaveTx(actor audit.Actor, entity employee.Entity) (int64, error) {
+	args := m.Called(actor, entity)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockEmployees) PatchTx(tx *sqlx.Tx, actor audit.Actor, id int64, request employee.PatchRequest) (employee.Response, error) {
+	args := m.Called(tx, actor, id, request)
+	return args.Get(0).(employee.Response), args.Error(1)
+}
+
+func (m *MockEmployees) ChangeStatusTx(tx *sqlx.Tx, actor audit.Actor, id int64, request employee.StatusRequest) (employee.Response, error) {
+	args := m.Called(tx, actor, id, request)
+	return args.Get(0).(employee.Response), args.Error(1)
+}
+
+func (m *MockEmployees) Delete(actor audit.Actor, id int64) error {
+	return m.Called(actor, id).Error(0)
+}
+
+func (m *MockEmployees) AddRoleTx(tx *sqlx.Tx, actor audit.Actor, id int64, roleId int64) error {
+	return m.Called(tx, actor, id, roleId).Error(0)
+}
+
+func (m *MockEmployees) RemoveRoleTx(tx *sqlx.Tx, actor audit.Actor, id int64, roleId int64) error {
+	return m.Called(tx, actor, id, roleId).Error(0)
+}
+
+type MockRoles struct {
+	mock.Mock
+}
+
+func (m *MockRoles) CreateTx(tx *sqlx.Tx, actor audit.Actor, name string, parentIds []int64) (int64, error) {
+	args := m.Called(tx, actor, name, parentIds)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRoles) UpdateRoleTx(tx *sqlx.Tx, actor audit.Actor, id int64, request role.UpdateRequest) (role.Response, error) {
+	args := m.Called(tx, actor, id, request)
+	return args.Get(0).(role.Response), args.Error(1)
+}
+
+func (m *MockRoles) Delete(actor audit.Actor, id int64) error {
+	return m.Called(actor, id).Error(0)
+}
+
+var actor = audit.Actor{Subject: "okta"}
+
+var noTx *sqlx.Tx
+
+func newTestService() (*MockRepo, *MockEmployees, *MockRoles, *Service) {
+	var repo = new(MockRepo)
+	var employees = new(MockEmployees)
+	var roles = new(MockRoles)
+	repo.On("BeginTransaction").Return(noTx, nil)
+	return repo, employees, roles, NewService(repo, employees, roles, validator.New())
+}
+
+func patch(operations ...Operation) PatchRequest {
+	return PatchRequest{Schemas: []string{SchemaPatchOp}, Operations: operations}
+}
+
+func TestParseFilter(t *testing.T) {
+	var a = assert.New(t)
+
+	var attribute, value, err = parseFilter(`UserName EQ "john \"jd\" doe"`, "userName")
+	a.Nil(err)
+	a.Equal("userName", attribute)
+	a.Equal(`john "jd" doe`, value)
+
+	_, _, err = parseFilter(`userName sw "jo"`, "userName")
+	a.Equal("invalidFilter", err.(Error).ScimType)
+
+	_, _, err = parseFilter(`emails eq "a@b.c"`, "userName")
+	a.ErrorContains(err, "emails")
+
+	attribute, _, err = parseFilter(" ", "userName")
+	a.Nil(err)
+	a.Equal("", attribute)
+}
+
+func TestServiceUsers(t *testing.T) {
+	var a = assert.New(t)
+	var john = UserEntity{Id: 7, Name: "John Doe", Status: employee.StatusActive, GroupIds: []int64{3}, GroupNames: []string{"Admins"}}
+
+	t.Run("should list users by userName with page", func(t *testing.T) {
+		var repo, _, _, svc = newTestService()
+		var count = 10
+		repo.On("CountUsers", "John Doe").Return(int64(1), nil)
+		repo.On("FindUsers", "John Doe", 4, 10).Return([]UserEntity{john}, nil)
+
+		var got, err = svc.ListUsers(ListRequest{Filter: `userName eq "John Doe"`, StartIndex: 5, Count: &count})
+
+		a.Nil(err)
+		a.Equal(int64(1), got.TotalResults)
+		a.Equal(5, got.StartIndex)
+		a.Equal(1, got.ItemsPerPage)
+		a.Equal("7", got.Resources[0].Id)
+		a.Equal([]Ref{{Value: "3", Display: "Admins"}}, got.Resources[0].Groups)
+		a.True(*got.Resources[0].Active)
+	})
+
+	t.Run("should cap page size", func(t *testing.T) {
+		var repo, _, _, svc = newTestService()
+		var count = 1000
+		repo.On("CountUsers", "").Return(int64(0), nil)
+		repo.On("FindUsers", "", 0, MaxResults).Return([]UserEntity{}, nil)
+
+		var got, err = svc.ListUsers(ListRequest{Count: &count})
+
+		a.Nil(err)
+		a.Equal(1, got.StartIndex)
+		a.Empty(got.Resources)
+	})
+
+	t.Run("should create inactive user as pending", func(t *testing.T) {
+		var repo, employees, _, svc = newTestService()
+		var inactive = false
+		employees.On("SaveTx", actor, employee.Entity{Name: "Jane Doe", Status: employee.StatusPending}).Return(int64(8), nil)
+		repo.On("FindUserById", int64(8)).Return(UserEntity{Id: 8, Name: "Jane Doe", Status: employee.StatusPending}, nil)
+
+		var got, err = svc.CreateUser(actor, User{Schemas: []string{SchemaUser}, UserName: " Jane Doe ", Active: &inactive})
+
+		a.Nil(err)
+		a.Equal("8", got.Id)
+		a.False(*got.Active)
+	})
+
+	t.Run("should require user schema", func(t *testing.T) {
+		var _, employees, _, svc = newTestService()
+
+		var _, err = svc.CreateUser(actor, User{UserName: "Jane Doe"})
+
+		a.Equal("invalidSyntax", err.(Error).ScimType)
+		a.True(employees.AssertNotCalled(t, "SaveTx", mock.Anything, mock.Anything))
+	})
+
+	t.Run("should rename and suspend user with patch", func(t *testing.T) {
+		var repo, employees, _, svc = newTestService()
+		var name = "John Smith"
+		repo.On("FindUserById", int64(7)).Return(john, nil)
+		employees.On("PatchTx", noTx, actor, int64(7), employee.PatchRequest{Name: &name}).Return(employee.Response{}, nil)
+		employees.On("ChangeStatusTx", noTx, actor, int64(7), employee.StatusRequest{Status: employee.StatusSuspended, Reason: statusReason}).
+			Return(employee.Response{}, nil)
+
+		var _, err = svc.PatchUser(actor, "7", patch(
+			Operation{Op: "Replace", Path: "userName", Value: json.RawMessage(`"John Smith"`)},
+			Operation{Op: "replace", Value: json.RawMessage(`{"active": "False"}`)},
+		))
+
+		a.Nil(err)
+		employees.AssertExpectations(t)
+	})
+
+	t.Run("should reject unsupported patch path", func(t *testing.T) {
+		var repo, _, _, svc = newTestService()
+		repo.On("FindUserById", int64(7)).Return(john, nil)
+
+		var _, err = svc.PatchUser(actor, "7", patch(Operation{Op: "add", Path: "emails", Value: json.RawMessage(`[]`)}))
+
+		a.Equal("invalidPath", err.(Error).ScimType)
+	})
+
+	t.Run("should not change status when active is unchanged", func(t *testing.T) {
+		var repo, employees, _, svc = newTestService()
+		repo.On("FindUserById", int64(7)).Return(john, nil)
+		var active = true
+
+		var _, err = svc.ReplaceUser(actor, "7", User{Schemas: []string{SchemaUser}, UserName: "John Doe", Active: &active})
+
+		a.Nil(err)
+		a.True(employees.AssertNotCalled(t, "ChangeStatusTx", mock.Anything, mock.Anything, mock.Anything, mock.Anything))
+		a.True(employees.AssertNotCalled(t, "PatchTx", mock.Anything, mock.Anything, mock.Anything, mock.Anything))
+	})
+
+	t.Run("should return 404 for unknown user", func(t *testing.T) {
+		var repo, _, _, svc = newTestService()
+		repo.On("FindUserById", int64(9)).Return(UserEntity{}, sql.ErrNoRows)
+
+		var _, err = svc.GetUser("9")
+		a.Equal(404, err.(Error).Status)
+
+		_, err = svc.GetUser("abc")
+		a.Equal(404, err.(Error).Status)
+	})
+}
+
+func TestServiceGroups(t *testing.T) {
+	var a = assert.New(t)
+	var admins = GroupEntity{Id: 3, Name: "Admins", MemberIds: []int64{1, 2}, MemberNames: []string{"Ann", "Bob"}}
+
+	t.Run("should create group with members", func(t *testing.T) {
+		var repo, employees, roles, svc = newTestService()
+		repo.On("FindUsersByIds", []int64{1}).Return([]UserEntity{{Id: 1, Status: employee.StatusActive}}, nil)
+		roles.On("CreateTx", noTx, actor, "Ops", []int64(nil)).Return(int64(4), nil)
+		employees.On("AddRoleTx", noTx, actor, int64(1), int64(4)).Return(nil)
+		repo.On("FindGroupById", int64(4)).Return(GroupEntity{Id: 4, Name: "Ops", MemberIds: []int64{1}, MemberNames: []string{"Ann"}}, nil)
+
+		var got, err = svc.CreateGroup(actor, Group{Schemas: []string{SchemaGroup}, DisplayName: "Ops", Members: []Ref{{Value: "1"}}})
+
+		a.Nil(err)
+		a.Equal("4", got.Id)
+		a.Equal([]Ref{{Value: "1", Display: "Ann"}}, got.Members)
+	})
+
+	t.Run("should not create group with unknown member", func(t *testing.T) {
+		var repo, _, roles, svc = newTestService()
+		repo.On("FindUsersByIds", []int64{5}).Return([]UserEntity{}, nil)
+
+		var _, err = svc.CreateGroup(actor, Group{Schemas: []string{SchemaGroup}, DisplayName: "Ops", Members: []Ref{{Value: "5"}}})
+
+		a.Equal("invalidValue", err.(Error).ScimType)
+		a.True(roles.AssertNotCalled(t, "CreateTx", mock.Anything, mock.Anything, mock.Anything, mock.Anything))
+	})
+
+	t.Run("should add and remove members with patch", func(t *testing.T) {
+		var repo, employees, _, svc = newTestService()
+		repo.On("FindGroupById", int64(3)).Return(admins, nil)
+		repo.On("FindUsersByIds", []int64{5}).Return([]UserEntity{{Id: 5, Status: employee.StatusPending}}, nil)
+		employees.On("AddRoleTx", noTx, actor, int64(5), int64(3)).Return(nil)
+		employees.On("RemoveRoleTx", noTx, actor, int64(1), int64(3)).Return(nil)
+		employees.On("RemoveRoleTx", noTx, actor, int64(2), int64(3)).Return(nil)
+
+		var _, err = svc.PatchGroup(actor, "3", patch(
+			Operation{Op: "add", Path: "members", Value: json.RawMessage(`[{"value": "5"}, {"value": "1"}]`)},
+			Operation{Op: "remove", Path: `members[value eq "1"]`},
+			Operation{Op: "remove", Path: "members", Value: json.RawMessage(`[{"value": "2"}]`)},
+		))
+
+		a.Nil(err)
+		employees.AssertExpectations(t)
+	})
+
+	t.Run("should replace members and rename with patch", func(t *testing.T) {
+		var repo, employees, roles, svc = newTestService()
+		repo.On("FindGroupById", int64(3)).Return(admins, nil)
+		roles.On("UpdateRoleTx", noTx, actor, int64(3), role.UpdateRequest{Name: "Administrators"}).Return(role.Response{}, nil)
+		employees.On("RemoveRoleTx", noTx, actor, int64(1), int64(3)).Return(nil)
+
+		var _, err = svc.PatchGroup(actor, "3", patch(
+			Operation{Op: "replace", Value: json.RawMessage(`{"displayName": "Administrators", "members": [{"value": "2"}]}`)},
+		))
+
+		a.Nil(err)
+		roles.AssertExpectations(t)
+		employees.AssertExpectations(t)
+		a.True(repo.AssertNotCalled(t, "FindUsersByIds", mock.Anything))
+	})
+
+	t.Run("should reject terminated member", func(t *testing.T) {
+		var repo, employees, _, svc = newTestService()
+		repo.On("FindGroupById", int64(3)).Return(admins, nil)
+		repo.On("FindUsersByIds", []int64{6}).Return([]UserEntity{{Id: 6, Status: employee.StatusTerminated}}, nil)
+
+		var _, err = svc.ReplaceGroup(actor, "3", Group{Schemas: []string{SchemaGroup}, DisplayName: "Admins",
+			Members: []Ref{{Value: "1"}, {Value: "2"}, {Value: "6"}}})
+
+		a.ErrorContains(err, "terminated")
+		a.True(employees.AssertNotCalled(t, "AddRoleTx", mock.Anything, mock.Anything, mock.Anything, mock.Anything))
+	})
+
+	t.Run("should roll back earlier changes when a later one fails", func(t *testing.T) {
+		db, dbMock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = db.Close() }()
+		dbMock.ExpectBegin()
+		dbMock.ExpectRollback()
+		tx, err := sqlx.NewDb(db, "postgres").Beginx()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var repo, employees, roles = new(MockRepo), new(MockEmployees), new(MockRoles)
+		var svc = NewService(repo, employees, roles, validator.New())
+		repo.On("BeginTransaction").Return(tx, nil)
+		repo.On("FindGroupById", int64(3)).Return(admins, nil)
+		roles.On("UpdateRoleTx", tx, actor, int64(3), role.UpdateRequest{Name: "Administrators"}).Return(role.Response{}, nil)
+		employees.On("RemoveRoleTx", tx, actor, int64(1), int64(3)).Return(errors.New("database is down"))
+
+		_, err = svc.PatchGroup(actor, "3", patch(
+			Operation{Op: "replace", Value: json.RawMessage(`{"displayName": "Administrators", "members": [{"value": "2"}]}`)},
+		))
+
+		a.ErrorContains(err, "database is down")
+		a.Nil(dbMock.ExpectationsWereMet())
+	})
+
+	t.Run("should pass conflict from role service", func(t *testing.T) {
+		var _, _, roles, svc = newTestService()
+		roles.On("CreateTx", noTx, actor, "Admins", []int64(nil)).Return(int64(0), common.AlreadyExistsError{Resource: "role", ID: "Admins"})
+
+		var _, err = svc.CreateGroup(actor, Group{Schemas: []string{SchemaGroup}, DisplayName: "Admins"})
+
+		a.ErrorAs(err, &common.AlreadyExistsError{})
+	})
+}
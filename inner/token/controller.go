@@ -0,0 +1,249 @@
+package token
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/gofiber/fiber"
+	"idm/inner/common"
+	"idm/inner/web"
+	"net/url"
+	"strings"
+)
+
+type Controller struct {
+	server       *web.Server
+	tokenService Svc
+}
+
+// интерфейс сервиса token.Service
+type Svc interface {
+	Token(request TokenRequest) (TokenResponse, error)
+	CreateLoginCode(caller common.Caller, employeeId int64) (LoginCodeResponse, error)
+	CreateClient(caller common.Caller, request CreateClientRequest) (CreatedClientResponse, error)
+	FindAllClients() ([]ClientResponse, error)
+	DeleteClient(id int64) error
+	Jwks() (Jwks, error)
+	RotateKeys() (string, error)
+}
+
+func NewController(server *web.Server, tokenService Svc) *Controller {
+	return &Controller{
+		server:       server,
+		tokenService: tokenService,
+	}
+}
+
+// функция для регистрации маршрутов
+func (c *Controller) RegisterRoutes() {
+
+	// токен-эндпоинт и JWKS публичные: через них клиенты и получают доступ к "/api/v1"
+	c.server.App.Post("/oauth/token", c.Token)
+	c.server.App.Get("/.well-known/jwks.json", c.Jwks)
+
+	// управление сервисными клиентами
+	c.server.GroupApiV1.Post("/oauth/clients", c.server.Require("clients:write"), c.CreateClient)
+	c.server.GroupApiV1.Get("/oauth/clients", c.server.Require("clients:read"), c.FindAllClients)
+	c.server.GroupApiV1.Delete("/oauth/clients/:id", c.server.Require("clients:write"), c.DeleteClient)
+
+	// одноразовый код входа сотрудника для grant_type=one_time_code; код даёт войти от имени
+	// сотрудника, поэтому выпуск требует отдельного права
+	c.server.GroupApiV1.Post("/employees/:id/login-code", c.server.Require("login_codes:write"), c.CreateLoginCode)
+
+	// полный путь будет "/internal/keys/rotate"; на незащищённом /internal ротацию мог бы вызвать кто угодно.
+	// Первый код входа администратора выпускается утилитой cmd/logincode, а не через HTTP
+	if c.server.InternalProtected {
+		c.server.GroupInternal.Post("/keys/rotate", c.RotateKeys)
+	}
+}
+
+// функция-хендлер для POST запроса по маршруту "/oauth/token".
+// Ответы и ошибки в формате RFC 6749, чтобы подходили стандартные OAuth2-клиенты
+func (c *Controller) Token(ctx *fiber.Ctx) {
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+	ctx.Set("Pragma", "no-cache")
+
+	var request TokenRequest
+	if err := ctx.BodyParser(&request); err != nil {
+		oauthErrResponse(ctx, OAuthError{Code: "invalid_request", Description: err.Error()})
+		return
+	}
+	// client_secret_basic имеет приоритет над client_secret_post
+	if clientId, clientSecret, ok := basicCredentials(ctx.Get(fiber.HeaderAuthorization)); ok {
+		request.ClientId = clientId
+		request.ClientSecret = clientSecret
+	}
+
+	response, err := c.tokenService.Token(request)
+	if err != nil {
+		oauthErrResponse(ctx, err)
+		return
+	}
+
+	if err = ctx.JSON(response); err != nil {
+		oauthErrResponse(ctx, err)
+		return
+	}
+}
+
+// функция-хендлер для GET запроса по маршруту "/.well-known/jwks.json"
+func (c *Controller) Jwks(ctx *fiber.Ctx) {
+	jwks, err := c.tokenService.Jwks()
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// JWKS отдаётся как есть, без обёртки common.Response
+	if err = ctx.JSON(jwks); err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning jwks")
+		return
+	}
+}
+
+// функция-хендлер для POST запроса по маршруту "/api/v1/oauth/clients"
+func (c *Controller) CreateClient(ctx *fiber.Ctx) {
+	var request CreateClientRequest
+	if err := ctx.BodyParser(&request); err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	client, err := c.tokenService.CreateClient(c.server.Caller(ctx), request)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, client)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning created client")
+		return
+	}
+}
+
+// функция-хендлер для GET запроса по маршруту "/api/v1/oauth/clients"
+func (c *Controller) FindAllClients(ctx *fiber.Ctx) {
+	clients, err := c.tokenService.FindAllClients()
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, clients)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning clients")
+		return
+	}
+}
+
+// функция-хендлер для DELETE запроса по маршруту "/api/v1/oauth/clients/:id"
+func (c *Controller) DeleteClient(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = c.tokenService.DeleteClient(id); err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, id)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning deleted client id")
+		return
+	}
+}
+
+// функция-хендлер для POST запроса по маршруту "/api/v1/employees/:id/login-code"
+func (c *Controller) CreateLoginCode(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	code, err := c.tokenService.CreateLoginCode(c.server.Caller(ctx), id)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+	err = common.OkResponse(ctx, code)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning login code")
+		return
+	}
+}
+
+// функция-хендлер для POST запроса по маршруту "/internal/keys/rotate"
+func (c *Controller) RotateKeys(ctx *fiber.Ctx) {
+	kid, err := c.tokenService.RotateKeys()
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, kid)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning signing key id")
+		return
+	}
+}
+
+// basicCredentials client_id и секрет из заголовка Authorization: Basic (RFC 6749, раздел 2.3.1)
+func basicCredentials(header string) (string, string, bool) {
+	scheme, encoded, found := strings.Cut(strings.TrimSpace(header), " ")
+	if !found || !strings.EqualFold(scheme, "Basic") {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", "", false
+	}
+	rawId, rawSecret, found := strings.Cut(string(decoded), ":")
+	if !found {
+		return "", "", false
+	}
+	clientId, errId := url.QueryUnescape(rawId)
+	clientSecret, errSecret := url.QueryUnescape(rawSecret)
+	if errId != nil || errSecret != nil {
+		return "", "", false
+	}
+	return clientId, clientSecret, true
+}
+
+// oauthErrResponse ошибка токен-эндпоинта: 401 — неверный клиент, 400 — прочие ошибки запроса, 500 — всё остальное
+func oauthErrResponse(ctx *fiber.Ctx, err error) {
+	var oauthErr OAuthError
+	if !errors.As(err, &oauthErr) {
+		_ = ctx.Status(fiber.StatusInternalServerError).JSON(OAuthError{Code: "server_error"})
+		return
+	}
+	status := fiber.StatusBadRequest
+	if oauthErr.Code == "invalid_client" {
+		status = fiber.StatusUnauthorized
+		ctx.Set(fiber.HeaderWWWAuthenticate, `Basic realm="idm"`)
+	}
+	_ = ctx.Status(status).JSON(oauthErr)
+}
+
+// errResponse сопоставляет ошибку сервиса с кодом ответа:
+// 400 — ошибки валидации, 403 — выдача прав, которых нет у вызывающего, 404 — не найдено,
+// 409 — клиент уже существует, 500 — всё остальное
+func errResponse(ctx *fiber.Ctx, err error) {
+	switch {
+	case errors.As(err, &common.RequestValidationError{}):
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+	case errors.As(err, &common.PermissionDeniedError{}):
+		_ = common.ErrResponse(ctx, fiber.StatusForbidden, err.Error())
+	case errors.As(err, &common.NotFoundError{}):
+		_ = common.ErrResponse(ctx, fiber.StatusNotFound, err.Error())
+	case errors.As(err, &common.AlreadyExistsError{}):
+		_ = common.ErrResponse(ctx, fiber.StatusConflict, err.Error())
+	default:
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+	}
+}
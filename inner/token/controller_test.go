@@ -0,0 +1,199 @@
+package token
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/gofiber/fiber"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/common"
+	"idm/inner/web"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Объявляем структуру мока сервиса token.Service
+type MockService struct {
+	mock.Mock
+}
+
+func (svc *MockService) Token(request TokenRequest) (TokenResponse, error) {
+	args := svc.Called(request)
+	return args.Get(0).(TokenResponse), args.Error(1)
+}
+
+func (svc *MockService) CreateLoginCode(_ common.Caller, employeeId int64) (LoginCodeResponse, error) {
+	args := svc.Called(employeeId)
+	return args.Get(0).(LoginCodeResponse), args.Error(1)
+}
+
+func (svc *MockService) CreateClient(caller common.Caller, request CreateClientRequest) (CreatedClientResponse, error) {
+	args := svc.Called(caller, request)
+	return args.Get(0).(CreatedClientResponse), args.Error(1)
+}
+
+func (svc *MockService) FindAllClients() ([]ClientResponse, error) {
+	args := svc.Called()
+	return args.Get(0).([]ClientResponse), args.Error(1)
+}
+
+func (svc *MockService) DeleteClient(id int64) error {
+	args := svc.Called(id)
+	return args.Error(0)
+}
+
+func (svc *MockService) Jwks() (Jwks, error) {
+	args := svc.Called()
+	return args.Get(0).(Jwks), args.Error(1)
+}
+
+func (svc *MockService) RotateKeys() (string, error) {
+	args := svc.Called()
+	return args.String(0), args.Error(1)
+}
+
+func TestController(t *testing.T) {
+	mockService := new(MockService)
+	server := web.NewServer()
+	server.InternalProtected = true
+	controller := NewController(server, mockService)
+	controller.RegisterRoutes()
+
+	t.Run("TokenWithFormBody", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		body := strings.NewReader("grant_type=client_credentials&client_id=billing&client_secret=s3cret")
+		request := httptest.NewRequest(fiber.MethodPost, "/oauth/token", body)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		want := TokenResponse{AccessToken: "signed.jwt", TokenType: "Bearer", ExpiresIn: 900}
+		mockService.On("Token", TokenRequest{GrantType: "client_credentials", ClientId: "billing", ClientSecret: "s3cret"}).
+			Return(want, nil)
+
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+
+		var response TokenResponse
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+		assert.Equal(t, want, response)
+	})
+
+	t.Run("TokenWithBasicAuth", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		request := httptest.NewRequest(fiber.MethodPost, "/oauth/token", strings.NewReader("grant_type=client_credentials"))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("billing:s%3Acret")))
+		mockService.On("Token", TokenRequest{GrantType: "client_credentials", ClientId: "billing", ClientSecret: "s:cret"}).
+			Return(TokenResponse{AccessToken: "signed.jwt"}, nil)
+
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("TokenInvalidClient", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		request := httptest.NewRequest(fiber.MethodPost, "/oauth/token", strings.NewReader("grant_type=client_credentials"))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		mockService.On("Token", mock.Anything).
+			Return(TokenResponse{}, OAuthError{Code: "invalid_client", Description: "client authentication failed"})
+
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+
+		var response OAuthError
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+		assert.Equal(t, "invalid_client", response.Code)
+	})
+
+	t.Run("TokenInvalidGrant", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		request := httptest.NewRequest(fiber.MethodPost, "/oauth/token", strings.NewReader("grant_type=one_time_code&code=used"))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		mockService.On("Token", TokenRequest{GrantType: "one_time_code", Code: "used"}).
+			Return(TokenResponse{}, OAuthError{Code: "invalid_grant"})
+
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Jwks", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		want := Jwks{Keys: []Jwk{{Kty: "RSA", Kid: "k1", Use: "sig", Alg: "RS256", N: "n", E: "AQAB"}}}
+		mockService.On("Jwks").Return(want, nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/.well-known/jwks.json", nil))
+		assert.NoError(t, err)
+
+		var response Jwks
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, want, response)
+	})
+
+	t.Run("CreateClientConflict", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		req := CreateClientRequest{ClientId: "billing", Name: "Биллинг"}
+		body, _ := json.Marshal(req)
+		request := httptest.NewRequest(fiber.MethodPost, "/api/v1/oauth/clients", bytes.NewBuffer(body))
+		request.Header.Set("Content-Type", "application/json")
+		mockService.On("CreateClient", mock.Anything, req).Return(CreatedClientResponse{}, common.AlreadyExistsError{Resource: "client", ID: "billing"})
+
+		resp, err := server.App.Test(request)
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusConflict, resp.StatusCode)
+	})
+
+	t.Run("CreateLoginCode", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("CreateLoginCode", int64(42)).Return(LoginCodeResponse{Code: "code-1"}, nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodPost, "/api/v1/employees/42/login-code", nil))
+		assert.NoError(t, err)
+
+		var response common.Response[LoginCodeResponse]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, "code-1", response.Data.Code)
+	})
+
+	t.Run("RotateKeys", func(t *testing.T) {
+		mockService.ExpectedCalls = nil
+		mockService.On("RotateKeys").Return("k2", nil)
+
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodPost, "/internal/keys/rotate", nil))
+		assert.NoError(t, err)
+
+		var response common.Response[string]
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, "k2", response.Data)
+	})
+
+	t.Run("RotateKeysUnprotectedInternal", func(t *testing.T) {
+		unprotected := web.NewServer()
+		NewController(unprotected, mockService).RegisterRoutes()
+
+		resp, err := unprotected.App.Test(httptest.NewRequest(fiber.MethodPost, "/internal/keys/rotate", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+
+		resp, err = unprotected.App.Test(httptest.NewRequest(fiber.MethodPost, "/internal/employees/42/login-code", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	})
+}
@@ -0,0 +1,108 @@
+package token
+
+import "time"
+
+// поддерживаемые grant_type токен-эндпоинта
+const (
+	GrantClientCredentials = "client_credentials"
+	// GrantOneTimeCode обмен одноразового кода сотрудника на токен
+	GrantOneTimeCode = "one_time_code"
+)
+
+// TokenRequest запрос к токен-эндпоинту; принимается как form-urlencoded (RFC 6749) или JSON
+type TokenRequest struct {
+	GrantType    string `form:"grant_type" json:"grant_type"`
+	ClientId     string `form:"client_id" json:"client_id"`
+	ClientSecret string `form:"client_secret" json:"client_secret"`
+	Code         string `form:"code" json:"code"`
+}
+
+// TokenResponse ответ токен-эндпоинта в формате RFC 6749, без общей обёртки common.Response
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// OAuthError ошибка токен-эндпоинта в формате RFC 6749 (раздел 5.2)
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+type ClientEntity struct {
+	Id         int64     `db:"id"`
+	ClientId   string    `db:"client_id"`
+	Name       string    `db:"name"`
+	SecretHash string    `db:"secret_hash"`
+	CreatedAt  time.Time `db:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at"`
+}
+
+func (e *ClientEntity) toResponse() ClientResponse {
+	return ClientResponse{
+		Id:        e.Id,
+		ClientId:  e.ClientId,
+		Name:      e.Name,
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.UpdatedAt,
+	}
+}
+
+func toSliceClientResponse(e []ClientEntity) []ClientResponse {
+	responses := make([]ClientResponse, len(e))
+	for i := range e {
+		responses[i] = e[i].toResponse()
+	}
+	return responses
+}
+
+type ClientResponse struct {
+	Id        int64     `json:"id"`
+	ClientId  string    `json:"client_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CreatedClientResponse секрет клиента возвращается только один раз — при создании
+type CreatedClientResponse struct {
+	ClientResponse
+	ClientSecret string `json:"client_secret"`
+}
+
+type CreateClientRequest struct {
+	ClientId string  `json:"client_id" validate:"required,min=3,max=100,excludesall=: "`
+	Name     string  `json:"name" validate:"required,min=2,max=155"`
+	RoleIds  []int64 `json:"role_ids" validate:"omitempty,max=50,unique,dive,min=1"`
+}
+
+// LoginCodeResponse одноразовый код входа; сам код больше нигде не хранится
+type LoginCodeResponse struct {
+	Code      string    `json:"code"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type SigningKeyEntity struct {
+	Kid        string    `db:"kid"`
+	PrivateKey string    `db:"private_key"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+// Jwks набор открытых ключей в формате RFC 7517
+type Jwks struct {
+	Keys []Jwk `json:"keys"`
+}
+
+type Jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
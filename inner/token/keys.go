@@ -0,0 +1,215 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"sync"
+	"time"
+)
+
+const (
+	keyBits = 2048
+	// reloadInterval как часто ключи перечитываются из базы: так экземпляры сервиса
+	// узнают о ротации, выполненной другим экземпляром
+	reloadInterval = 30 * time.Second
+)
+
+type KeyRepo interface {
+	FindSigningKeys() (keys []SigningKeyEntity, err error)
+	SaveSigningKey(key SigningKeyEntity) (saved SigningKeyEntity, err error)
+}
+
+// KeyStore ключи подписи выдаваемых токенов с кешем в памяти.
+// Подписывает всегда самый новый ключ; предыдущие остаются в JWKS, пока не истекут
+// подписанные ими токены, поэтому ротация не ломает уже выданные токены
+type KeyStore struct {
+	repo     KeyRepo
+	ttl      time.Duration
+	rotation time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	keys     []signingKey
+	loadedAt time.Time
+}
+
+type signingKey struct {
+	kid       string
+	private   *rsa.PrivateKey
+	createdAt time.Time
+}
+
+// NewKeyStore ttl — время жизни выдаваемых токенов, rotation — период автоматической
+// ротации (0 — только ручная ротация)
+func NewKeyStore(repo KeyRepo, ttl time.Duration, rotation time.Duration) *KeyStore {
+	if ttl <= 0 {
+		ttl = DefaultTokenTtl
+	}
+	return &KeyStore{
+		repo:     repo,
+		ttl:      ttl,
+		rotation: rotation,
+		now:      time.Now,
+	}
+}
+
+// Sign подписывает claims текущим ключом; первый ключ создаётся при первой подписи
+func (s *KeyStore) Sign(claims jwt.MapClaims) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refreshLocked(); err != nil {
+		return "", err
+	}
+	if len(s.keys) == 0 || (s.rotation > 0 && s.now().Sub(s.keys[0].createdAt) >= s.rotation) {
+		if err := s.rotateLocked(); err != nil {
+			return "", err
+		}
+	}
+	key := s.keys[0]
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
+}
+
+// Rotate создаёт новый ключ подписи и возвращает его kid
+func (s *KeyStore) Rotate() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.rotateLocked(); err != nil {
+		return "", err
+	}
+	return s.keys[0].kid, nil
+}
+
+// Jwks опубликованные открытые ключи
+func (s *KeyStore) Jwks() (Jwks, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refreshLocked(); err != nil {
+		return Jwks{}, err
+	}
+	published := s.publishedLocked()
+	set := Jwks{Keys: make([]Jwk, len(published))}
+	for i, key := range published {
+		set.Keys[i] = toJwk(key)
+	}
+	return set, nil
+}
+
+// PublicKey открытый ключ по kid для проверки токенов, выданных этим сервисом
+func (s *KeyStore) PublicKey(kid string) (*rsa.PublicKey, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refreshLocked(); err != nil {
+		return nil, false
+	}
+	for _, key := range s.publishedLocked() {
+		if key.kid == kid {
+			return &key.private.PublicKey, true
+		}
+	}
+	return nil, false
+}
+
+// publishedLocked самый новый ключ и те предыдущие, которыми ещё могут быть подписаны
+// действующие токены: ключ подписывал, пока в кеше не появился его преемник
+func (s *KeyStore) publishedLocked() []signingKey {
+	if len(s.keys) == 0 {
+		return nil
+	}
+	published := []signingKey{s.keys[0]}
+	for i := 1; i < len(s.keys); i++ {
+		successorCreatedAt := s.keys[i-1].createdAt
+		if s.now().Before(successorCreatedAt.Add(reloadInterval + s.ttl)) {
+			published = append(published, s.keys[i])
+		}
+	}
+	return published
+}
+
+func (s *KeyStore) refreshLocked() error {
+	if s.keys != nil && s.now().Sub(s.loadedAt) < reloadInterval {
+		return nil
+	}
+	return s.loadLocked()
+}
+
+func (s *KeyStore) loadLocked() error {
+	entities, err := s.repo.FindSigningKeys()
+	if err != nil {
+		return fmt.Errorf("error loading signing keys: %w", err)
+	}
+	keys := make([]signingKey, 0, len(entities))
+	for _, entity := range entities {
+		private, err := parsePrivateKey(entity.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("error parsing signing key %s: %w", entity.Kid, err)
+		}
+		keys = append(keys, signingKey{kid: entity.Kid, private: private, createdAt: entity.CreatedAt})
+	}
+	s.keys = keys
+	s.loadedAt = s.now()
+	return nil
+}
+
+func (s *KeyStore) rotateLocked() error {
+	private, err := rsa.GenerateKey(rand.Reader, keyBits)
+	if err != nil {
+		return fmt.Errorf("error generating signing key: %w", err)
+	}
+	_, err = s.repo.SaveSigningKey(SigningKeyEntity{
+		Kid: thumbprint(&private.PublicKey),
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(private),
+		})),
+	})
+	if err != nil {
+		return fmt.Errorf("error saving signing key: %w", err)
+	}
+	// перечитываем все ключи: параллельно ротацию мог выполнить другой экземпляр
+	return s.loadLocked()
+}
+
+func parsePrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+func toJwk(key signingKey) Jwk {
+	return Jwk{
+		Kty: "RSA",
+		Kid: key.kid,
+		Use: "sig",
+		Alg: jwt.SigningMethodRS256.Alg(),
+		N:   base64.RawURLEncoding.EncodeToString(key.private.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.private.E)).Bytes()),
+	}
+}
+
+// thumbprint kid ключа по RFC 7638
+func thumbprint(key *rsa.PublicKey) string {
+	canonical, _ := json.Marshal(struct {
+		E   string `json:"e"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+	}{
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		Kty: "RSA",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+	})
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
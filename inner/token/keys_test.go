@@ -0,0 +1,121 @@
+package token
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// memoryKeyRepo хранилище ключей в памяти, имитирующее таблицу signing_key
+type memoryKeyRepo struct {
+	keys []SigningKeyEntity
+	now  func() time.Time
+}
+
+func (r *memoryKeyRepo) FindSigningKeys() ([]SigningKeyEntity, error) {
+	keys := make([]SigningKeyEntity, len(r.keys))
+	for i := range r.keys {
+		keys[len(r.keys)-1-i] = r.keys[i]
+	}
+	return keys, nil
+}
+
+func (r *memoryKeyRepo) SaveSigningKey(key SigningKeyEntity) (SigningKeyEntity, error) {
+	key.CreatedAt = r.now()
+	r.keys = append(r.keys, key)
+	return key, nil
+}
+
+func TestKeyStore(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+	newStore := func(rotation time.Duration) (*KeyStore, *memoryKeyRepo) {
+		repo := &memoryKeyRepo{now: clock}
+		store := NewKeyStore(repo, time.Hour, rotation)
+		store.now = clock
+		return store, repo
+	}
+	parse := func(store *KeyStore, signed string) (*jwt.Token, error) {
+		return jwt.Parse(signed, func(token *jwt.Token) (any, error) {
+			key, ok := store.PublicKey(token.Header["kid"].(string))
+			if !ok {
+				return nil, jwt.ErrTokenUnverifiable
+			}
+			return key, nil
+		})
+	}
+
+	t.Run("first signature creates a key", func(t *testing.T) {
+		store, repo := newStore(0)
+
+		signed, err := store.Sign(jwt.MapClaims{"sub": "42"})
+
+		assert.NoError(t, err)
+		assert.Len(t, repo.keys, 1)
+		token, err := parse(store, signed)
+		assert.NoError(t, err)
+		assert.Equal(t, repo.keys[0].Kid, token.Header["kid"])
+	})
+
+	t.Run("rotation keeps previous key published until its tokens expire", func(t *testing.T) {
+		store, repo := newStore(0)
+		oldToken, err := store.Sign(jwt.MapClaims{"sub": "42"})
+		assert.NoError(t, err)
+
+		kid, err := store.Rotate()
+		assert.NoError(t, err)
+		newToken, err := store.Sign(jwt.MapClaims{"sub": "42"})
+		assert.NoError(t, err)
+
+		parsedNew, err := parse(store, newToken)
+		assert.NoError(t, err)
+		assert.Equal(t, kid, parsedNew.Header["kid"])
+		_, err = parse(store, oldToken)
+		assert.NoError(t, err)
+		jwks, err := store.Jwks()
+		assert.NoError(t, err)
+		assert.Len(t, jwks.Keys, 2)
+		assert.Equal(t, kid, jwks.Keys[0].Kid)
+
+		// после ttl и интервала перечитывания старый ключ больше не публикуется
+		now = now.Add(time.Hour + reloadInterval + time.Second)
+		jwks, err = store.Jwks()
+		assert.NoError(t, err)
+		assert.Len(t, jwks.Keys, 1)
+		_, ok := store.PublicKey(repo.keys[0].Kid)
+		assert.False(t, ok)
+	})
+
+	t.Run("automatic rotation by period", func(t *testing.T) {
+		store, repo := newStore(24 * time.Hour)
+		_, err := store.Sign(jwt.MapClaims{"sub": "42"})
+		assert.NoError(t, err)
+
+		now = now.Add(25 * time.Hour)
+		_, err = store.Sign(jwt.MapClaims{"sub": "42"})
+
+		assert.NoError(t, err)
+		assert.Len(t, repo.keys, 2)
+	})
+
+	t.Run("rotation by another instance is picked up", func(t *testing.T) {
+		repo := &memoryKeyRepo{now: clock}
+		first := NewKeyStore(repo, time.Hour, 0)
+		first.now = clock
+		second := NewKeyStore(repo, time.Hour, 0)
+		second.now = clock
+		_, err := first.Sign(jwt.MapClaims{"sub": "42"})
+		assert.NoError(t, err)
+
+		kid, err := second.Rotate()
+		assert.NoError(t, err)
+		now = now.Add(reloadInterval)
+		signed, err := first.Sign(jwt.MapClaims{"sub": "42"})
+		assert.NoError(t, err)
+
+		token, err := parse(second, signed)
+		assert.NoError(t, err)
+		assert.Equal(t, kid, token.Header["kid"])
+	})
+}
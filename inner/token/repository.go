@@ -0,0 +1,155 @@
+package token
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"time"
+)
+
+type Repository struct {
+	db *sqlx.DB
+}
+
+func NewTokenRepository(dataBase *sqlx.DB) *Repository {
+	return &Repository{db: dataBase}
+}
+
+func (repo *Repository) FindClientByClientId(clientId string) (entity ClientEntity, err error) {
+	err = repo.db.Get(&entity, "select * from oauth_client where client_id = $1", clientId)
+	return entity, err
+}
+
+func (repo *Repository) FindAllClients() (listEntity []ClientEntity, err error) {
+	listEntity = []ClientEntity{}
+	err = repo.db.Select(&listEntity, "select * from oauth_client order by id")
+	return listEntity, err
+}
+
+// FindClientRoleNames имена ролей, выданных сервисному клиенту
+func (repo *Repository) FindClientRoleNames(id int64) (names []string, err error) {
+	names = []string{}
+	err = repo.db.Select(
+		&names,
+		`select r.name from oauth_client_role cr join role r on r.id = cr.role_id and r.deleted_at is null
+		where cr.oauth_client_id = $1
+		order by r.id`,
+		id,
+	)
+	return names, err
+}
+
+// FindRoleIdsByClientId роли сервисного клиента по его client_id
+func (repo *Repository) FindRoleIdsByClientId(clientId string) (ids []int64, err error) {
+	ids = []int64{}
+	err = repo.db.Select(
+		&ids,
+		`select cr.role_id from oauth_client_role cr join oauth_client c on c.id = cr.oauth_client_id
+		where c.client_id = $1
+		order by cr.role_id`,
+		clientId,
+	)
+	return ids, err
+}
+
+func (repo *Repository) DeleteClient(id int64) error {
+	result, err := repo.db.Exec("delete from oauth_client where id = $1", id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (repo *Repository) BeginTransaction() (tx *sqlx.Tx, err error) {
+	return repo.db.Beginx()
+}
+
+func (repo *Repository) ExistsClientByClientIdTx(tx *sqlx.Tx, clientId string) (isExists bool, err error) {
+	err = tx.Get(&isExists, "select exists(select 1 from oauth_client where client_id = $1)", clientId)
+	return isExists, err
+}
+
+// CountRolesByIdsTx количество существующих неудалённых ролей среди переданных идентификаторов
+func (repo *Repository) CountRolesByIdsTx(tx *sqlx.Tx, ids []int64) (count int64, err error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	query, args, err := sqlx.In("select count(*) from role where id in (?) and deleted_at is null", ids)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build IN query: %w", err)
+	}
+	query = tx.Rebind(query)
+	err = tx.Get(&count, query, args...)
+	return count, err
+}
+
+func (repo *Repository) SaveClientTx(tx *sqlx.Tx, client ClientEntity) (saved ClientEntity, err error) {
+	err = tx.Get(
+		&saved,
+		"insert into oauth_client (client_id, name, secret_hash) values ($1, $2, $3) returning *",
+		client.ClientId,
+		client.Name,
+		client.SecretHash,
+	)
+	return saved, err
+}
+
+func (repo *Repository) GrantClientRolesTx(tx *sqlx.Tx, id int64, roleIds []int64) error {
+	if len(roleIds) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(
+		"insert into oauth_client_role (oauth_client_id, role_id) select $1, unnest($2::bigint[]) on conflict do nothing",
+		id,
+		pq.Array(roleIds),
+	)
+	return err
+}
+
+func (repo *Repository) SaveLoginCode(codeHash string, employeeId int64, expiresAt time.Time) error {
+	_, err := repo.db.Exec(
+		"insert into login_code (code_hash, employee_id, expires_at) values ($1, $2, $3)",
+		codeHash,
+		employeeId,
+		expiresAt,
+	)
+	return err
+}
+
+// UseLoginCode помечает код использованным и возвращает сотрудника; использованный
+// или просроченный код даёт sql.ErrNoRows, поэтому код нельзя обменять дважды
+func (repo *Repository) UseLoginCode(codeHash string) (employeeId int64, err error) {
+	err = repo.db.Get(
+		&employeeId,
+		`update login_code set used_at = now()
+		where code_hash = $1 and used_at is null and expires_at > now()
+		returning employee_id`,
+		codeHash,
+	)
+	return employeeId, err
+}
+
+// FindSigningKeys все ключи подписи, самые новые — первыми
+func (repo *Repository) FindSigningKeys() (keys []SigningKeyEntity, err error) {
+	keys = []SigningKeyEntity{}
+	err = repo.db.Select(&keys, "select * from signing_key order by created_at desc, kid")
+	return keys, err
+}
+
+func (repo *Repository) SaveSigningKey(key SigningKeyEntity) (saved SigningKeyEntity, err error) {
+	err = repo.db.Get(
+		&saved,
+		"insert into signing_key (kid, private_key) values ($1, $2) returning *",
+		key.Kid,
+		key.PrivateKey,
+	)
+	return saved, err
+}
@@ -0,0 +1,371 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/crypto/bcrypt"
+	"idm/inner/auth"
+	"idm/inner/common"
+	"idm/inner/employee"
+	"idm/inner/role"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultTokenTtl время жизни токена, если JWT_TOKEN_TTL не задан
+	DefaultTokenTtl = 15 * time.Minute
+	loginCodeTtl    = 5 * time.Minute
+)
+
+// ErrInvalidLoginCode код входа не найден, истёк, уже использован или выдан другому сотруднику
+var ErrInvalidLoginCode = errors.New("login code is invalid")
+
+// dummyHash сравнивается с секретом неизвестного клиента, чтобы время ответа
+// не выдавало, существует ли client_id
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("unknown client"), bcrypt.DefaultCost)
+
+type Service struct {
+	repo         Repo
+	employeeRepo EmployeeRepo
+	roleRepo     RoleRepo
+	keys         Keys
+	validator    Validator
+	issuer       string
+	audience     string
+	ttl          time.Duration
+}
+
+func NewService(repo Repo, employeeRepo EmployeeRepo, roleRepo RoleRepo, keys Keys, validator Validator, cfg common.Config) *Service {
+	ttl := cfg.JwtTokenTtl
+	if ttl <= 0 {
+		ttl = DefaultTokenTtl
+	}
+	return &Service{
+		repo:         repo,
+		employeeRepo: employeeRepo,
+		roleRepo:     roleRepo,
+		keys:         keys,
+		validator:    validator,
+		issuer:       cfg.JwtIssuer,
+		audience:     cfg.JwtAudience,
+		ttl:          ttl,
+	}
+}
+
+type Validator interface {
+	Validate(request any) error
+}
+
+type Repo interface {
+	FindClientByClientId(clientId string) (ClientEntity, error)
+	FindAllClients() (listEntity []ClientEntity, err error)
+	FindClientRoleNames(id int64) (names []string, err error)
+	DeleteClient(id int64) error
+	BeginTransaction() (tx *sqlx.Tx, err error)
+	ExistsClientByClientIdTx(tx *sqlx.Tx, clientId string) (isExists bool, err error)
+	CountRolesByIdsTx(tx *sqlx.Tx, ids []int64) (count int64, err error)
+	SaveClientTx(tx *sqlx.Tx, client ClientEntity) (saved ClientEntity, err error)
+	GrantClientRolesTx(tx *sqlx.Tx, id int64, roleIds []int64) error
+	SaveLoginCode(codeHash string, employeeId int64, expiresAt time.Time) error
+	UseLoginCode(codeHash string) (employeeId int64, err error)
+}
+
+type EmployeeRepo interface {
+	FindById(id int64) (employee.Entity, error)
+	FindEffectiveRolesByEmployeeId(id int64) (roles []employee.RoleEntity, err error)
+}
+
+// RoleRepo права ролей вместе с унаследованными, реализуется role.Repository
+type RoleRepo interface {
+	FindPermissionsByRoleIds(ids []int64) (permissions []role.PermissionEntity, err error)
+}
+
+// Keys подпись токенов и публикация открытых ключей, реализуется KeyStore
+type Keys interface {
+	Sign(claims jwt.MapClaims) (string, error)
+	Jwks() (Jwks, error)
+	Rotate() (string, error)
+}
+
+// Token выдаёт токен доступа по запросу к токен-эндпоинту
+func (service *Service) Token(request TokenRequest) (TokenResponse, error) {
+	var claims jwt.MapClaims
+	var err error
+	switch request.GrantType {
+	case GrantClientCredentials:
+		claims, err = service.clientClaims(request)
+	case GrantOneTimeCode:
+		claims, err = service.employeeClaims(request)
+	case "":
+		err = OAuthError{Code: "invalid_request", Description: "grant_type is required"}
+	default:
+		err = OAuthError{Code: "unsupported_grant_type", Description: "grant_type " + request.GrantType + " is not supported"}
+	}
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	now := time.Now()
+	claims["iss"] = service.issuer
+	claims["aud"] = service.audience
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = now.Add(service.ttl).Unix()
+	claims["jti"] = randomString(16)
+	signed, err := service.keys.Sign(claims)
+	if err != nil {
+		return TokenResponse{}, fmt.Errorf("error signing token: %w", err)
+	}
+	return TokenResponse{
+		AccessToken: signed,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(service.ttl.Seconds()),
+	}, nil
+}
+
+// clientClaims аутентифицирует сервисного клиента по client_id и секрету
+func (service *Service) clientClaims(request TokenRequest) (jwt.MapClaims, error) {
+	if request.ClientId == "" || request.ClientSecret == "" {
+		return nil, OAuthError{Code: "invalid_client", Description: "client authentication failed"}
+	}
+	client, err := service.repo.FindClientByClientId(request.ClientId)
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(request.ClientSecret))
+		return nil, OAuthError{Code: "invalid_client", Description: "client authentication failed"}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding client %s: %w", request.ClientId, err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(client.SecretHash), []byte(request.ClientSecret)) != nil {
+		return nil, OAuthError{Code: "invalid_client", Description: "client authentication failed"}
+	}
+	roles, err := service.repo.FindClientRoleNames(client.Id)
+	if err != nil {
+		return nil, fmt.Errorf("error finding roles of client %s: %w", client.ClientId, err)
+	}
+	return jwt.MapClaims{
+		"sub":       auth.ClientSubjectPrefix + client.ClientId,
+		"client_id": client.ClientId,
+		"roles":     roles,
+	}, nil
+}
+
+// employeeClaims обменивает одноразовый код на claims сотрудника
+func (service *Service) employeeClaims(request TokenRequest) (jwt.MapClaims, error) {
+	if request.Code == "" {
+		return nil, OAuthError{Code: "invalid_request", Description: "code is required"}
+	}
+	employeeId, err := service.repo.UseLoginCode(hashCode(request.Code))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, OAuthError{Code: "invalid_grant", Description: "code is invalid, expired or already used"}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error using login code: %w", err)
+	}
+	// код выпущен раньше, чем сотрудника отстранили или уволили, — войти он уже не может
+	active, err := service.isActive(employeeId)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, OAuthError{Code: "invalid_grant", Description: "employee is not active"}
+	}
+	roles, err := service.employeeRepo.FindEffectiveRolesByEmployeeId(employeeId)
+	if err != nil {
+		return nil, fmt.Errorf("error finding roles of employee with id %d: %w", employeeId, err)
+	}
+	roleNames := make([]string, len(roles))
+	for i := range roles {
+		roleNames[i] = roles[i].Name
+	}
+	return jwt.MapClaims{
+		"sub":         strconv.FormatInt(employeeId, 10),
+		"employee_id": employeeId,
+		"roles":       roleNames,
+	}, nil
+}
+
+// CreateLoginCode выпускает одноразовый код, который сотрудник обменяет на токен;
+// войти может только активный сотрудник. Код даёт все права сотрудника, поэтому вызывающему нужны
+// все права его ролей; caller nil только у утилиты cmd/logincode, которую запускает администратор сервера
+func (service *Service) CreateLoginCode(caller common.Caller, employeeId int64) (LoginCodeResponse, error) {
+	found, err := service.employeeRepo.FindById(employeeId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return LoginCodeResponse{}, common.NotFoundError{Resource: "employee", ID: employeeId}
+	}
+	if err != nil {
+		return LoginCodeResponse{}, fmt.Errorf("error finding employee with id %d: %w", employeeId, err)
+	}
+	if found.Status != employee.StatusActive {
+		return LoginCodeResponse{}, common.RequestValidationError{FieldErrors: map[string]string{
+			"status": fmt.Sprintf("employee with status %s cannot log in", found.Status),
+		}}
+	}
+	if caller != nil {
+		roles, err := service.employeeRepo.FindEffectiveRolesByEmployeeId(employeeId)
+		if err != nil {
+			return LoginCodeResponse{}, fmt.Errorf("error finding roles of employee with id %d: %w", employeeId, err)
+		}
+		roleIds := make([]int64, len(roles))
+		for i := range roles {
+			roleIds[i] = roles[i].Id
+		}
+		if err = role.RequireGrantable(service.roleRepo, caller, roleIds); err != nil {
+			return LoginCodeResponse{}, err
+		}
+	}
+	code := randomString(32)
+	expiresAt := time.Now().Add(loginCodeTtl).UTC()
+	if err = service.repo.SaveLoginCode(hashCode(code), employeeId, expiresAt); err != nil {
+		return LoginCodeResponse{}, fmt.Errorf("error saving login code for employee with id %d: %w", employeeId, err)
+	}
+	return LoginCodeResponse{Code: code, ExpiresAt: expiresAt}, nil
+}
+
+// UseLoginCode гасит одноразовый код входа сотрудника employeeId без выдачи токена;
+// так вход проверяют протоколы без токенов, например привязка LDAP
+func (service *Service) UseLoginCode(employeeId int64, code string) error {
+	if code == "" {
+		return ErrInvalidLoginCode
+	}
+	owner, err := service.repo.UseLoginCode(hashCode(code))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidLoginCode
+	}
+	if err != nil {
+		return fmt.Errorf("error using login code: %w", err)
+	}
+	if owner != employeeId {
+		return ErrInvalidLoginCode
+	}
+	active, err := service.isActive(employeeId)
+	if err != nil {
+		return err
+	}
+	if !active {
+		return ErrInvalidLoginCode
+	}
+	return nil
+}
+
+// isActive сотрудник существует, не удалён и находится в состоянии active
+func (service *Service) isActive(employeeId int64) (bool, error) {
+	found, err := service.employeeRepo.FindById(employeeId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error finding employee with id %d: %w", employeeId, err)
+	}
+	return found.Status == employee.StatusActive, nil
+}
+
+// CreateClient регистрирует сервисного клиента; секрет генерируется и возвращается один раз.
+// Клиенту можно выдать только роли, все права которых есть у самого вызывающего
+func (service *Service) CreateClient(caller common.Caller, request CreateClientRequest) (response CreatedClientResponse, err error) {
+	if err = service.validator.Validate(request); err != nil {
+		return CreatedClientResponse{}, err
+	}
+	secret := randomString(32)
+	secretHash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return CreatedClientResponse{}, fmt.Errorf("error hashing client secret: %w", err)
+	}
+	tx, err := service.repo.BeginTransaction()
+	defer func() {
+		if tx != nil {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				_ = tx.Commit()
+			}
+		}
+	}()
+	if err != nil {
+		return CreatedClientResponse{}, fmt.Errorf("error create client: error creating transaction: %w", err)
+	}
+	isExist, err := service.repo.ExistsClientByClientIdTx(tx, request.ClientId)
+	if err != nil {
+		return CreatedClientResponse{}, fmt.Errorf("error finding client %s: %w", request.ClientId, err)
+	}
+	if isExist {
+		err = common.AlreadyExistsError{Resource: "client", ID: request.ClientId}
+		return CreatedClientResponse{}, err
+	}
+	if len(request.RoleIds) > 0 {
+		count, err := service.repo.CountRolesByIdsTx(tx, request.RoleIds)
+		if err != nil {
+			return CreatedClientResponse{}, fmt.Errorf("error finding roles %d: %w", request.RoleIds, err)
+		}
+		if count != int64(len(request.RoleIds)) {
+			return CreatedClientResponse{}, common.NotFoundError{Resource: "role", ID: request.RoleIds}
+		}
+		if err = role.RequireGrantable(service.roleRepo, caller, request.RoleIds); err != nil {
+			return CreatedClientResponse{}, err
+		}
+	}
+	saved, err := service.repo.SaveClientTx(tx, ClientEntity{
+		ClientId:   request.ClientId,
+		Name:       request.Name,
+		SecretHash: string(secretHash),
+	})
+	if err != nil {
+		return CreatedClientResponse{}, fmt.Errorf("error saving client %s: %w", request.ClientId, err)
+	}
+	if err = service.repo.GrantClientRolesTx(tx, saved.Id, request.RoleIds); err != nil {
+		return CreatedClientResponse{}, fmt.Errorf("error granting roles to client %s: %w", request.ClientId, err)
+	}
+	return CreatedClientResponse{ClientResponse: saved.toResponse(), ClientSecret: secret}, nil
+}
+
+func (service *Service) FindAllClients() ([]ClientResponse, error) {
+	clients, err := service.repo.FindAllClients()
+	if err != nil {
+		return []ClientResponse{}, fmt.Errorf("error finding clients: %w", err)
+	}
+	return toSliceClientResponse(clients), nil
+}
+
+func (service *Service) DeleteClient(id int64) error {
+	err := service.repo.DeleteClient(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return common.NotFoundError{Resource: "client", ID: id}
+	}
+	if err != nil {
+		return fmt.Errorf("error delete client by id: %d: %w", id, err)
+	}
+	return nil
+}
+
+func (service *Service) Jwks() (Jwks, error) {
+	return service.keys.Jwks()
+}
+
+// RotateKeys создаёт новый ключ подписи; уже выданные токены остаются действительными
+func (service *Service) RotateKeys() (string, error) {
+	kid, err := service.keys.Rotate()
+	if err != nil {
+		return "", fmt.Errorf("error rotating signing keys: %w", err)
+	}
+	return kid, nil
+}
+
+// hashCode одноразовые коды случайны и длинны, поэтому для хранения достаточно sha256
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(size int) string {
+	buf := make([]byte, size)
+	_, _ = rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
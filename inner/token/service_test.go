@@ -0,0 +1,375 @@
+package token
+
+import (
+	"database/sql"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
+	"idm/inner/common"
+	"idm/inner/employee"
+	"idm/inner/role"
+	"idm/inner/validator"
+	"slices"
+	"testing"
+	"time"
+)
+
+type MockRepo struct {
+	mock.Mock
+}
+
+func (m *MockRepo) FindClientByClientId(clientId string) (ClientEntity, error) {
+	args := m.Called(clientId)
+	return args.Get(0).(ClientEntity), args.Error(1)
+}
+
+func (m *MockRepo) FindAllClients() ([]ClientEntity, error) {
+	args := m.Called()
+	return args.Get(0).([]ClientEntity), args.Error(1)
+}
+
+func (m *MockRepo) FindClientRoleNames(id int64) ([]string, error) {
+	args := m.Called(id)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockRepo) DeleteClient(id int64) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockRepo) BeginTransaction() (*sqlx.Tx, error) {
+	args := m.Called()
+	return args.Get(0).(*sqlx.Tx), args.Error(1)
+}
+
+func (m *MockRepo) ExistsClientByClientIdTx(tx *sqlx.Tx, clientId string) (bool, error) {
+	args := m.Called(tx, clientId)
+	return args.Get(0).(bool), args.Error(1)
+}
+
+func (m *MockRepo) CountRolesByIdsTx(tx *sqlx.Tx, ids []int64) (int64, error) {
+	args := m.Called(tx, ids)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepo) SaveClientTx(tx *sqlx.Tx, client ClientEntity) (ClientEntity, error) {
+	args := m.Called(tx, client)
+	return args.Get(0).(ClientEntity), args.Error(1)
+}
+
+func (m *MockRepo) GrantClientRolesTx(tx *sqlx.Tx, id int64, roleIds []int64) error {
+	args := m.Called(tx, id, roleIds)
+	return args.Error(0)
+}
+
+func (m *MockRepo) SaveLoginCode(codeHash string, employeeId int64, expiresAt time.Time) error {
+	args := m.Called(codeHash, employeeId, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockRepo) UseLoginCode(codeHash string) (int64, error) {
+	args := m.Called(codeHash)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type MockEmployeeRepo struct {
+	mock.Mock
+}
+
+func (m *MockEmployeeRepo) FindById(id int64) (employee.Entity, error) {
+	args := m.Called(id)
+	return args.Get(0).(employee.Entity), args.Error(1)
+}
+
+func (m *MockEmployeeRepo) FindEffectiveRolesByEmployeeId(id int64) ([]employee.RoleEntity, error) {
+	args := m.Called(id)
+	return args.Get(0).([]employee.RoleEntity), args.Error(1)
+}
+
+type MockKeys struct {
+	mock.Mock
+}
+
+func (m *MockKeys) Sign(claims jwt.MapClaims) (string, error) {
+	args := m.Called(claims)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockKeys) Jwks() (Jwks, error) {
+	args := m.Called()
+	return args.Get(0).(Jwks), args.Error(1)
+}
+
+func (m *MockKeys) Rotate() (string, error) {
+	args := m.Called()
+	return args.String(0), args.Error(1)
+}
+
+var val = validator.New()
+
+var cfg = common.Config{JwtIssuer: "idm", JwtAudience: "idm-api", JwtTokenTtl: 10 * time.Minute}
+
+func TestServiceToken(t *testing.T) {
+	var a = assert.New(t)
+	secretHash, _ := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	var client = ClientEntity{Id: 7, ClientId: "billing", SecretHash: string(secretHash)}
+
+	t.Run("should issue token for client credentials", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var keys = new(MockKeys)
+		var svc = NewService(repo, new(MockEmployeeRepo), new(MockRoleRepo), keys, val, cfg)
+		var signed jwt.MapClaims
+
+		repo.On("FindClientByClientId", "billing").Return(client, nil)
+		repo.On("FindClientRoleNames", int64(7)).Return([]string{"Менеджер"}, nil)
+		keys.On("Sign", mock.Anything).Run(func(args mock.Arguments) {
+			signed = args.Get(0).(jwt.MapClaims)
+		}).Return("signed.jwt", nil)
+		var got, err = svc.Token(TokenRequest{GrantType: GrantClientCredentials, ClientId: "billing", ClientSecret: "s3cret"})
+
+		a.Nil(err)
+		a.Equal(TokenResponse{AccessToken: "signed.jwt", TokenType: "Bearer", ExpiresIn: 600}, got)
+		a.Equal("client:billing", signed["sub"])
+		a.Equal([]string{"Менеджер"}, signed["roles"])
+		a.Equal("idm", signed["iss"])
+		a.Equal("idm-api", signed["aud"])
+		a.NotEmpty(signed["jti"])
+	})
+
+	t.Run("should reject wrong client secret", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var keys = new(MockKeys)
+		var svc = NewService(repo, new(MockEmployeeRepo), new(MockRoleRepo), keys, val, cfg)
+
+		repo.On("FindClientByClientId", "billing").Return(client, nil)
+		var _, err = svc.Token(TokenRequest{GrantType: GrantClientCredentials, ClientId: "billing", ClientSecret: "wrong"})
+
+		a.Equal(OAuthError{Code: "invalid_client", Description: "client authentication failed"}, err)
+		a.True(keys.AssertNotCalled(t, "Sign", mock.Anything))
+	})
+
+	t.Run("should reject unknown client", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, new(MockEmployeeRepo), new(MockRoleRepo), new(MockKeys), val, cfg)
+
+		repo.On("FindClientByClientId", "nobody").Return(ClientEntity{}, sql.ErrNoRows)
+		var _, err = svc.Token(TokenRequest{GrantType: GrantClientCredentials, ClientId: "nobody", ClientSecret: "x"})
+
+		a.ErrorAs(err, &OAuthError{})
+		a.Equal("invalid_client", err.(OAuthError).Code)
+	})
+
+	t.Run("should issue token for one-time code", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var employeeRepo = new(MockEmployeeRepo)
+		var keys = new(MockKeys)
+		var svc = NewService(repo, employeeRepo, new(MockRoleRepo), keys, val, cfg)
+		var signed jwt.MapClaims
+
+		repo.On("UseLoginCode", hashCode("code-1")).Return(int64(42), nil)
+		employeeRepo.On("FindById", int64(42)).Return(employee.Entity{Id: 42, Status: employee.StatusActive}, nil)
+		employeeRepo.On("FindEffectiveRolesByEmployeeId", int64(42)).
+			Return([]employee.RoleEntity{{Id: 2, Name: "Менеджер"}, {Id: 3, Name: "Разработчик"}}, nil)
+		keys.On("Sign", mock.Anything).Run(func(args mock.Arguments) {
+			signed = args.Get(0).(jwt.MapClaims)
+		}).Return("signed.jwt", nil)
+		var _, err = svc.Token(TokenRequest{GrantType: GrantOneTimeCode, Code: "code-1"})
+
+		a.Nil(err)
+		a.Equal("42", signed["sub"])
+		a.Equal(int64(42), signed["employee_id"])
+		a.Equal([]string{"Менеджер", "Разработчик"}, signed["roles"])
+	})
+
+	t.Run("should reject code of inactive employee", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var employeeRepo = new(MockEmployeeRepo)
+		var svc = NewService(repo, employeeRepo, new(MockRoleRepo), new(MockKeys), val, cfg)
+
+		repo.On("UseLoginCode", hashCode("code-1")).Return(int64(42), nil)
+		employeeRepo.On("FindById", int64(42)).Return(employee.Entity{Id: 42, Status: employee.StatusSuspended}, nil)
+		var _, err = svc.Token(TokenRequest{GrantType: GrantOneTimeCode, Code: "code-1"})
+
+		a.Equal("invalid_grant", err.(OAuthError).Code)
+		a.True(employeeRepo.AssertNotCalled(t, "FindEffectiveRolesByEmployeeId", mock.Anything))
+	})
+
+	t.Run("should reject used or expired code", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, new(MockEmployeeRepo), new(MockRoleRepo), new(MockKeys), val, cfg)
+
+		repo.On("UseLoginCode", hashCode("used")).Return(int64(0), sql.ErrNoRows)
+		var _, err = svc.Token(TokenRequest{GrantType: GrantOneTimeCode, Code: "used"})
+
+		a.Equal("invalid_grant", err.(OAuthError).Code)
+	})
+
+	t.Run("should reject unsupported grant type", func(t *testing.T) {
+		var svc = NewService(new(MockRepo), new(MockEmployeeRepo), new(MockRoleRepo), new(MockKeys), val, cfg)
+
+		var _, err = svc.Token(TokenRequest{GrantType: "password"})
+
+		a.Equal("unsupported_grant_type", err.(OAuthError).Code)
+	})
+}
+
+// grantedPermissions права вызывающего в тестах
+type grantedPermissions []string
+
+func (p grantedPermissions) HasPermission(permission string) (bool, error) {
+	return p == nil || slices.Contains(p, permission), nil
+}
+
+// allowAll вызывающий со всеми правами
+var allowAll grantedPermissions
+
+type MockRoleRepo struct {
+	mock.Mock
+}
+
+func (m *MockRoleRepo) FindPermissionsByRoleIds(ids []int64) ([]role.PermissionEntity, error) {
+	args := m.Called(ids)
+	return args.Get(0).([]role.PermissionEntity), args.Error(1)
+}
+
+func TestServiceClientsAndCodes(t *testing.T) {
+	var a = assert.New(t)
+	var noTx *sqlx.Tx
+	var grants = []role.PermissionEntity{{RoleId: 2, RoleName: "Менеджер", Resource: "employees", Action: "read"}}
+
+	t.Run("should create client with generated secret", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var roleRepo = new(MockRoleRepo)
+		var svc = NewService(repo, new(MockEmployeeRepo), roleRepo, new(MockKeys), val, cfg)
+		var request = CreateClientRequest{ClientId: "billing", Name: "Биллинг", RoleIds: []int64{2}}
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("ExistsClientByClientIdTx", noTx, "billing").Return(false, nil)
+		repo.On("CountRolesByIdsTx", noTx, []int64{2}).Return(int64(1), nil)
+		roleRepo.On("FindPermissionsByRoleIds", []int64{2}).Return(grants, nil)
+		repo.On("SaveClientTx", noTx, mock.MatchedBy(func(c ClientEntity) bool {
+			return c.ClientId == "billing" && c.SecretHash != ""
+		})).Return(ClientEntity{Id: 7, ClientId: "billing", Name: "Биллинг"}, nil)
+		repo.On("GrantClientRolesTx", noTx, int64(7), []int64{2}).Return(nil)
+		var got, err = svc.CreateClient(grantedPermissions{"employees:read"}, request)
+
+		a.Nil(err)
+		a.Equal(int64(7), got.Id)
+		a.NotEmpty(got.ClientSecret)
+		saved := repo.Calls[3].Arguments.Get(1).(ClientEntity)
+		a.NoError(bcrypt.CompareHashAndPassword([]byte(saved.SecretHash), []byte(got.ClientSecret)))
+	})
+
+	t.Run("should reject roles with permissions the caller does not have", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var roleRepo = new(MockRoleRepo)
+		var svc = NewService(repo, new(MockEmployeeRepo), roleRepo, new(MockKeys), val, cfg)
+		var admin = []role.PermissionEntity{
+			{RoleId: 1, RoleName: "Администратор", Resource: "employees", Action: "read"},
+			{RoleId: 1, RoleName: "Администратор", Resource: "clients", Action: "write"},
+		}
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("ExistsClientByClientIdTx", noTx, "billing").Return(false, nil)
+		repo.On("CountRolesByIdsTx", noTx, []int64{1}).Return(int64(1), nil)
+		roleRepo.On("FindPermissionsByRoleIds", []int64{1}).Return(admin, nil)
+		var _, err = svc.CreateClient(grantedPermissions{"employees:read"},
+			CreateClientRequest{ClientId: "billing", Name: "Биллинг", RoleIds: []int64{1}})
+
+		var denied common.PermissionDeniedError
+		a.ErrorAs(err, &denied)
+		a.Equal([]string{"clients:write"}, denied.Permissions)
+		a.True(repo.AssertNotCalled(t, "SaveClientTx", noTx, mock.Anything))
+	})
+
+	t.Run("should return already exists for duplicate client", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var svc = NewService(repo, new(MockEmployeeRepo), new(MockRoleRepo), new(MockKeys), val, cfg)
+
+		repo.On("BeginTransaction").Return(noTx, nil)
+		repo.On("ExistsClientByClientIdTx", noTx, "billing").Return(true, nil)
+		var _, err = svc.CreateClient(allowAll, CreateClientRequest{ClientId: "billing", Name: "Биллинг"})
+
+		a.ErrorAs(err, &common.AlreadyExistsError{})
+	})
+
+	t.Run("should create login code for existing employee", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var employeeRepo = new(MockEmployeeRepo)
+		var roleRepo = new(MockRoleRepo)
+		var svc = NewService(repo, employeeRepo, roleRepo, new(MockKeys), val, cfg)
+
+		employeeRepo.On("FindById", int64(42)).Return(employee.Entity{Id: 42, Status: employee.StatusActive}, nil)
+		employeeRepo.On("FindEffectiveRolesByEmployeeId", int64(42)).Return([]employee.RoleEntity{{Id: 2, Name: "Менеджер"}}, nil)
+		roleRepo.On("FindPermissionsByRoleIds", []int64{2}).Return(grants, nil)
+		repo.On("SaveLoginCode", mock.Anything, int64(42), mock.Anything).Return(nil)
+		var got, err = svc.CreateLoginCode(grantedPermissions{"employees:read", "login_codes:write"}, 42)
+
+		a.Nil(err)
+		a.NotEmpty(got.Code)
+		a.True(got.ExpiresAt.After(time.Now()))
+		a.Equal(hashCode(got.Code), repo.Calls[0].Arguments.String(0))
+	})
+
+	t.Run("should not create login code for employee with permissions the caller does not have", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var employeeRepo = new(MockEmployeeRepo)
+		var roleRepo = new(MockRoleRepo)
+		var svc = NewService(repo, employeeRepo, roleRepo, new(MockKeys), val, cfg)
+		var admin = []role.PermissionEntity{{RoleId: 1, RoleName: "Администратор", Resource: "roles", Action: "write"}}
+
+		employeeRepo.On("FindById", int64(42)).Return(employee.Entity{Id: 42, Status: employee.StatusActive}, nil)
+		employeeRepo.On("FindEffectiveRolesByEmployeeId", int64(42)).Return([]employee.RoleEntity{{Id: 1, Name: "Администратор"}}, nil)
+		roleRepo.On("FindPermissionsByRoleIds", []int64{1}).Return(admin, nil)
+		var _, err = svc.CreateLoginCode(grantedPermissions{"login_codes:write"}, 42)
+
+		a.Equal(common.PermissionDeniedError{Permissions: []string{"roles:write"}}, err)
+		a.True(repo.AssertNotCalled(t, "SaveLoginCode", mock.Anything, mock.Anything, mock.Anything))
+	})
+
+	t.Run("should return not found for login code of missing employee", func(t *testing.T) {
+		var employeeRepo = new(MockEmployeeRepo)
+		var svc = NewService(new(MockRepo), employeeRepo, new(MockRoleRepo), new(MockKeys), val, cfg)
+
+		employeeRepo.On("FindById", int64(9)).Return(employee.Entity{}, sql.ErrNoRows)
+		var _, err = svc.CreateLoginCode(allowAll, 9)
+
+		a.ErrorAs(err, &common.NotFoundError{})
+	})
+
+	t.Run("should not create login code for inactive employee", func(t *testing.T) {
+		for _, status := range []string{employee.StatusPending, employee.StatusSuspended, employee.StatusTerminated} {
+			var repo = new(MockRepo)
+			var employeeRepo = new(MockEmployeeRepo)
+			var svc = NewService(repo, employeeRepo, new(MockRoleRepo), new(MockKeys), val, cfg)
+
+			employeeRepo.On("FindById", int64(42)).Return(employee.Entity{Id: 42, Status: status}, nil)
+			var _, err = svc.CreateLoginCode(allowAll, 42)
+
+			a.ErrorAs(err, &common.RequestValidationError{}, status)
+			a.True(repo.AssertNotCalled(t, "SaveLoginCode", mock.Anything, mock.Anything, mock.Anything))
+		}
+	})
+
+	t.Run("should use login code only for its active employee", func(t *testing.T) {
+		var repo = new(MockRepo)
+		var employeeRepo = new(MockEmployeeRepo)
+		var svc = NewService(repo, employeeRepo, new(MockRoleRepo), new(MockKeys), val, cfg)
+
+		employeeRepo.On("FindById", int64(42)).Return(employee.Entity{Id: 42, Status: employee.StatusActive}, nil).Once()
+		employeeRepo.On("FindById", int64(42)).Return(employee.Entity{Id: 42, Status: employee.StatusTerminated}, nil)
+		repo.On("UseLoginCode", hashCode("code-1")).Return(int64(42), nil)
+		repo.On("UseLoginCode", hashCode("code-3")).Return(int64(42), nil)
+		repo.On("UseLoginCode", hashCode("code-2")).Return(int64(43), nil)
+		repo.On("UseLoginCode", hashCode("used")).Return(int64(0), sql.ErrNoRows)
+
+		a.Nil(svc.UseLoginCode(42, "code-1"))
+		a.ErrorIs(svc.UseLoginCode(42, "code-2"), ErrInvalidLoginCode)
+		a.ErrorIs(svc.UseLoginCode(42, "used"), ErrInvalidLoginCode)
+		a.ErrorIs(svc.UseLoginCode(42, ""), ErrInvalidLoginCode)
+		a.ErrorIs(svc.UseLoginCode(42, "code-3"), ErrInvalidLoginCode)
+	})
+}
@@ -0,0 +1,98 @@
+package web
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"github.com/gofiber/fiber"
+	"github.com/gofiber/fiber/middleware"
+	"idm/inner/common"
+	"net"
+	"strings"
+)
+
+// InternalSecretHeader заголовок с общим секретом для маршрутов /internal
+const InternalSecretHeader = "X-Internal-Secret"
+
+// DefaultInternalAddress адрес /internal, если не задана ни одна защита: маршруты доступны только с той же машины
+const DefaultInternalAddress = "127.0.0.1:8081"
+
+// NewServerWithConfig сервер с защитой /internal согласно конфигурации:
+// отдельный fiber.App под InternalAddress, общий секрет и список разрешённых адресов.
+// Без защиты /internal не открывается на публичном адресе, а слушает DefaultInternalAddress.
+// Проверки ставятся на группу до регистрации маршрутов, поэтому их не обойти
+func NewServerWithConfig(cfg common.Config) (*Server, error) {
+	server := NewServer()
+	server.InternalProtected = true
+	server.InternalAddress = cfg.InternalAddress
+	if server.InternalAddress == "" && cfg.InternalSecret == "" && len(cfg.InternalAllowedIps) == 0 {
+		server.InternalAddress = DefaultInternalAddress
+	}
+	if server.InternalAddress != "" {
+		// маршруты /internal не регистрируются в публичном приложении вовсе
+		server.InternalApp = fiber.New()
+		server.InternalApp.Use(middleware.RequestID())
+		server.GroupInternal = server.InternalApp.Group("/internal")
+	}
+	if len(cfg.InternalAllowedIps) > 0 {
+		networks, err := parseNetworks(cfg.InternalAllowedIps)
+		if err != nil {
+			return nil, err
+		}
+		server.GroupInternal.Use(allowIps(networks))
+	}
+	if cfg.InternalSecret != "" {
+		server.GroupInternal.Use(requireSecret(cfg.InternalSecret))
+	}
+	return server, nil
+}
+
+// allowIps пропускает только запросы с адресов из списка. Берётся адрес соединения,
+// а не X-Forwarded-For: заголовок может подставить сам вызывающий
+func allowIps(networks []*net.IPNet) fiber.Handler {
+	return func(ctx *fiber.Ctx) {
+		ip := net.ParseIP(ctx.IP())
+		for _, network := range networks {
+			if ip != nil && network.Contains(ip) {
+				ctx.Next()
+				return
+			}
+		}
+		_ = common.ErrResponse(ctx, fiber.StatusForbidden, "address is not allowed")
+	}
+}
+
+func requireSecret(secret string) fiber.Handler {
+	return func(ctx *fiber.Ctx) {
+		given := ctx.Get(InternalSecretHeader)
+		if subtle.ConstantTimeCompare([]byte(given), []byte(secret)) != 1 {
+			_ = common.ErrResponse(ctx, fiber.StatusUnauthorized, "invalid internal secret")
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// parseNetworks одиночный адрес превращается в подсеть из одного адреса
+func parseNetworks(items []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(items))
+	for _, item := range items {
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid internal allowed ip %q", item)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid internal allowed network %q: %w", item, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
@@ -0,0 +1,75 @@
+package web
+
+import (
+	"github.com/gofiber/fiber"
+	"github.com/stretchr/testify/assert"
+	"idm/inner/common"
+	"net/http/httptest"
+	"testing"
+)
+
+const testSecret = "internal-test-secret-0123456789ab"
+
+func newInternalServer(t *testing.T, cfg common.Config) *Server {
+	server, err := NewServerWithConfig(cfg)
+	assert.NoError(t, err)
+	server.GroupInternal.Get("/health", func(ctx *fiber.Ctx) {
+		_ = common.OkResponse(ctx, "ok")
+	})
+	return server
+}
+
+func doInternal(t *testing.T, app *fiber.App, secret string) int {
+	request := httptest.NewRequest(fiber.MethodGet, "/internal/health", nil)
+	if secret != "" {
+		request.Header.Set(InternalSecretHeader, secret)
+	}
+	resp, err := app.Test(request)
+	assert.NoError(t, err)
+	return resp.StatusCode
+}
+
+func TestInternalRoutes(t *testing.T) {
+
+	t.Run("LoopbackByDefault", func(t *testing.T) {
+		server := newInternalServer(t, common.Config{})
+
+		assert.NotNil(t, server.InternalApp)
+		assert.True(t, server.InternalProtected)
+		assert.Equal(t, DefaultInternalAddress, server.InternalAddress)
+		assert.Equal(t, fiber.StatusOK, doInternal(t, server.InternalApp, ""))
+		assert.Equal(t, fiber.StatusNotFound, doInternal(t, server.App, ""))
+	})
+
+	t.Run("SeparateAddress", func(t *testing.T) {
+		server := newInternalServer(t, common.Config{InternalAddress: "127.0.0.1:8081"})
+
+		assert.NotNil(t, server.InternalApp)
+		assert.Equal(t, fiber.StatusOK, doInternal(t, server.InternalApp, ""))
+		assert.Equal(t, fiber.StatusNotFound, doInternal(t, server.App, ""))
+	})
+
+	t.Run("SharedSecret", func(t *testing.T) {
+		server := newInternalServer(t, common.Config{InternalSecret: testSecret})
+		assert.True(t, server.InternalProtected)
+
+		assert.Equal(t, fiber.StatusUnauthorized, doInternal(t, server.App, ""))
+		assert.Equal(t, fiber.StatusUnauthorized, doInternal(t, server.App, "wrong"))
+		assert.Equal(t, fiber.StatusOK, doInternal(t, server.App, testSecret))
+	})
+
+	t.Run("AllowedIps", func(t *testing.T) {
+		// тестовое соединение fiber приходит с адреса 0.0.0.0
+		allowed := newInternalServer(t, common.Config{InternalAllowedIps: []string{"10.0.0.0/8", "0.0.0.0"}})
+		denied := newInternalServer(t, common.Config{InternalAllowedIps: []string{"10.0.0.0/8"}})
+
+		assert.Equal(t, fiber.StatusOK, doInternal(t, allowed.App, ""))
+		assert.Equal(t, fiber.StatusForbidden, doInternal(t, denied.App, ""))
+	})
+
+	t.Run("InvalidNetwork", func(t *testing.T) {
+		_, err := NewServerWithConfig(common.Config{InternalAllowedIps: []string{"10.0.0.0/99"}})
+
+		assert.Error(t, err)
+	})
+}
@@ -1,26 +1,107 @@
 package web
 
-import "github.com/gofiber/fiber"
+import (
+	"github.com/gofiber/fiber"
+	"github.com/gofiber/fiber/middleware"
+	"idm/inner/common"
+)
 
 // структуа веб-сервера
 type Server struct {
 	App           *fiber.App
 	GroupApiV1    fiber.Router
 	GroupInternal fiber.Router
+	// GroupScim маршруты SCIM 2.0 по адресу ScimPath
+	GroupScim fiber.Router
+	// InternalApp отдельное приложение для /internal, если задан InternalAddress; иначе nil
+	// и /internal обслуживается приложением App
+	InternalApp *fiber.App
+	// InternalAddress адрес, который слушает InternalApp
+	InternalAddress string
+	// InternalProtected /internal закрыт отдельным адресом, секретом или списком адресов;
+	// маршруты, дающие доступ к учётным данным, регистрируются только тогда
+	InternalProtected bool
+	// Authorizer проверяет права вызывающего на маршрутах, объявленных через Require;
+	// если не задан (например, в тестах контроллеров), проверка пропускается
+	Authorizer Authorizer
 }
 
+// Authorizer пропускает запрос дальше (ctx.Next) или отвечает отказом; реализуется auth.Guard
+type Authorizer interface {
+	Authorize(ctx *fiber.Ctx, permission string)
+	HasPermission(ctx *fiber.Ctx, permission string) (bool, error)
+}
+
+// ScimPath адрес SCIM 2.0; провайдерам он передаётся как базовый URL вместе с адресом сервера
+const ScimPath = "/scim/v2"
+
 // функция-конструктор
 func NewServer() *Server {
 	// создаём новый веб-вервер
 	app := fiber.New()
+	// идентификатор запроса берётся из X-Request-ID или генерируется и возвращается в ответе
+	app.Use(middleware.RequestID())
 	// создаём группу "/api"
 	groupApi := app.Group("/api")
 	groupInternal := app.Group("/internal")
+	groupScim := app.Group(ScimPath)
 	// создаём подгруппу "api/v1"
 	groupApiV1 := groupApi.Group("/v1")
 	return &Server{
 		App:           app,
 		GroupApiV1:    groupApiV1,
 		GroupInternal: groupInternal,
+		GroupScim:     groupScim,
+	}
+}
+
+// Require middleware маршрута, требующий у вызывающего право вида "resource:action":
+//
+//	c.server.GroupApiV1.Post("/roles", c.server.Require("roles:write"), c.CreateRole)
+//
+// Authorizer берётся в момент запроса, поэтому порядок настройки сервера и регистрации маршрутов не важен
+func (s *Server) Require(permission string) fiber.Handler {
+	return func(ctx *fiber.Ctx) {
+		if s.Authorizer == nil {
+			ctx.Next()
+			return
+		}
+		s.Authorizer.Authorize(ctx, permission)
+	}
+}
+
+// RequireIf как Require, но право проверяется только у запросов, для которых condition истинно,
+// например, только при ?include_deleted=true; остальные запросы проходят дальше без проверки
+func (s *Server) RequireIf(condition func(ctx *fiber.Ctx) bool, permission string) fiber.Handler {
+	require := s.Require(permission)
+	return func(ctx *fiber.Ctx) {
+		if !condition(ctx) {
+			ctx.Next()
+			return
+		}
+		require(ctx)
 	}
 }
+
+// Caller права вызывающего для сервисов, которые выдают права другим; без Authorizer разрешено всё,
+// как и в Require
+func (s *Server) Caller(ctx *fiber.Ctx) common.Caller {
+	return caller{authorizer: s.Authorizer, ctx: ctx}
+}
+
+type caller struct {
+	authorizer Authorizer
+	ctx        *fiber.Ctx
+}
+
+func (c caller) HasPermission(permission string) (bool, error) {
+	if c.authorizer == nil {
+		return true, nil
+	}
+	return c.authorizer.HasPermission(c.ctx, permission)
+}
+
+// RequestId идентификатор текущего запроса, выставленный middleware.RequestID
+func RequestId(ctx *fiber.Ctx) string {
+	return string(ctx.Fasthttp.Response.Header.Peek(fiber.HeaderXRequestID))
+}
@@ -0,0 +1,64 @@
+package webhook
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress адрес получателя не публичный: на самом сервере или во внутренней сети
+var ErrForbiddenAddress = errors.New("webhook receiver address is not public")
+
+// publicAddress веб-хуки отправляются только на публичные адреса, иначе через адрес получателя
+// можно обращаться к самому idm, метаданным облака и сервисам внутренней сети (SSRF)
+func publicAddress(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast()
+}
+
+// checkUrl адрес получателя при регистрации: имя не должно указывать на непубличные адреса.
+// Имя, которое не разрешается, принимается — при отправке адрес всё равно проверяется
+func checkUrl(rawUrl string, lookupIP func(host string) ([]net.IP, error)) error {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return err
+	}
+	ips := []net.IP{net.ParseIP(parsed.Hostname())}
+	if ips[0] == nil {
+		if ips, err = lookupIP(parsed.Hostname()); err != nil {
+			return nil
+		}
+	}
+	for _, ip := range ips {
+		if !publicAddress(ip) {
+			return ErrForbiddenAddress
+		}
+	}
+	return nil
+}
+
+// NewHttpClient клиент отправки веб-хуков: соединения устанавливаются только с публичными адресами,
+// в том числе при перенаправлениях и если имя получателя стало разрешаться во внутренний адрес
+// после регистрации. Прокси из окружения не используется, он сам может быть во внутренней сети
+func NewHttpClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicAddress(ip) {
+				return ErrForbiddenAddress
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
@@ -0,0 +1,182 @@
+package webhook
+
+import (
+	"errors"
+	"github.com/gofiber/fiber"
+	"idm/inner/common"
+	"idm/inner/web"
+)
+
+type Controller struct {
+	server         *web.Server
+	webhookService Svc
+}
+
+// интерфейс сервиса webhook.Service
+type Svc interface {
+	CreateEndpoint(request CreateEndpointRequest) (CreatedEndpointResponse, error)
+	FindEndpoints() ([]EndpointResponse, error)
+	DeleteEndpoint(id int64) error
+	FindDeliveries(endpointId int64, request DeliveriesRequest) ([]DeliveryResponse, error)
+	Redeliver(endpointId int64, id int64) (DeliveryResponse, error)
+	Deliver(limit int) (Report, error)
+}
+
+func NewController(server *web.Server, webhookService Svc) *Controller {
+	return &Controller{
+		server:         server,
+		webhookService: webhookService,
+	}
+}
+
+// функция для регистрации маршрутов
+func (c *Controller) RegisterRoutes() {
+	read := c.server.Require("webhooks:read")
+	write := c.server.Require("webhooks:write")
+
+	// полный путь будет "/api/v1/webhooks"
+	c.server.GroupApiV1.Post("/webhooks", write, c.CreateEndpoint)
+	c.server.GroupApiV1.Get("/webhooks", read, c.FindEndpoints)
+	c.server.GroupApiV1.Delete("/webhooks/:id", write, c.DeleteEndpoint)
+	c.server.GroupApiV1.Get("/webhooks/:id/deliveries", read, c.FindDeliveries)
+	c.server.GroupApiV1.Post("/webhooks/:id/deliveries/:deliveryId/redeliver", write, c.Redeliver)
+	// полный путь "/internal/webhooks/deliver" — для отправки по расписанию
+	c.server.GroupInternal.Post("/webhooks/deliver", c.Deliver)
+}
+
+// функция-хендлер для POST запроса по маршруту "/api/v1/webhooks"
+func (c *Controller) CreateEndpoint(ctx *fiber.Ctx) {
+	var request CreateEndpointRequest
+	if err := ctx.BodyParser(&request); err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	created, err := c.webhookService.CreateEndpoint(request)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+	err = common.OkResponse(ctx, created)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning created webhook")
+		return
+	}
+}
+
+// функция-хендлер для GET запроса по маршруту "/api/v1/webhooks"
+func (c *Controller) FindEndpoints(ctx *fiber.Ctx) {
+	endpoints, err := c.webhookService.FindEndpoints()
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, endpoints)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning webhooks")
+		return
+	}
+}
+
+// функция-хендлер для DELETE запроса по маршруту "/api/v1/webhooks/:id"
+func (c *Controller) DeleteEndpoint(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = c.webhookService.DeleteEndpoint(id); err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, id)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning deleted webhook id")
+		return
+	}
+}
+
+// функция-хендлер для GET запроса по маршруту "/api/v1/webhooks/:id/deliveries"
+func (c *Controller) FindDeliveries(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+	var request DeliveriesRequest
+	if err = ctx.QueryParser(&request); err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	deliveries, err := c.webhookService.FindDeliveries(id, request)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, deliveries)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning webhook deliveries")
+		return
+	}
+}
+
+// функция-хендлер для POST запроса по маршруту "/api/v1/webhooks/:id/deliveries/:deliveryId/redeliver"
+func (c *Controller) Redeliver(ctx *fiber.Ctx) {
+	id, err := common.ParseId(ctx.Params("id"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+	deliveryId, err := common.ParseId(ctx.Params("deliveryId"))
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		return
+	}
+
+	delivery, err := c.webhookService.Redeliver(id, deliveryId)
+	if err != nil {
+		errResponse(ctx, err)
+		return
+	}
+
+	err = common.OkResponse(ctx, delivery)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning webhook delivery")
+		return
+	}
+}
+
+// функция-хендлер для POST запроса по маршруту "/internal/webhooks/deliver"
+func (c *Controller) Deliver(ctx *fiber.Ctx) {
+	report, err := c.webhookService.Deliver(DefaultBatch)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = common.OkResponse(ctx, report)
+	if err != nil {
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning webhook report")
+		return
+	}
+}
+
+// errResponse сопоставляет ошибку сервиса с кодом ответа:
+// 400 — ошибки валидации, 404 — получатель или доставка не найдены, 500 — всё остальное
+func errResponse(ctx *fiber.Ctx, err error) {
+	switch {
+	case errors.As(err, &common.RequestValidationError{}):
+		_ = common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+	case errors.As(err, &common.NotFoundError{}):
+		_ = common.ErrResponse(ctx, fiber.StatusNotFound, err.Error())
+	default:
+		_ = common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+	}
+}
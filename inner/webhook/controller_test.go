@@ -0,0 +1,137 @@
+package webhook
+
+import (
+	"encoding/json"
+	"github.com/gofiber/fiber"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/common"
+	"idm/inner/web"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type MockService struct {
+	mock.Mock
+}
+
+func (m *MockService) CreateEndpoint(request CreateEndpointRequest) (CreatedEndpointResponse, error) {
+	args := m.Called(request)
+	return args.Get(0).(CreatedEndpointResponse), args.Error(1)
+}
+
+func (m *MockService) FindEndpoints() ([]EndpointResponse, error) {
+	args := m.Called()
+	return args.Get(0).([]EndpointResponse), args.Error(1)
+}
+
+func (m *MockService) DeleteEndpoint(id int64) error {
+	return m.Called(id).Error(0)
+}
+
+func (m *MockService) FindDeliveries(endpointId int64, request DeliveriesRequest) ([]DeliveryResponse, error) {
+	args := m.Called(endpointId, request)
+	return args.Get(0).([]DeliveryResponse), args.Error(1)
+}
+
+func (m *MockService) Redeliver(endpointId int64, id int64) (DeliveryResponse, error) {
+	args := m.Called(endpointId, id)
+	return args.Get(0).(DeliveryResponse), args.Error(1)
+}
+
+func (m *MockService) Deliver(limit int) (Report, error) {
+	args := m.Called(limit)
+	return args.Get(0).(Report), args.Error(1)
+}
+
+func TestController(t *testing.T) {
+	var a = assert.New(t)
+
+	t.Run("should create webhook", func(t *testing.T) {
+		var svc = new(MockService)
+		var server = web.NewServer()
+		NewController(server, svc).RegisterRoutes()
+		var request = CreateEndpointRequest{Url: "https://crm.example.com/hooks", Events: []string{EventEmployeeCreated}}
+		svc.On("CreateEndpoint", request).Return(CreatedEndpointResponse{
+			EndpointResponse: EndpointResponse{Id: 1, Url: request.Url, Events: request.Events}, Secret: "whsec_x"}, nil)
+
+		var req = httptest.NewRequest(fiber.MethodPost, "/api/v1/webhooks",
+			strings.NewReader(`{"url":"https://crm.example.com/hooks","events":["employee.created"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		var resp, err = server.App.Test(req)
+		a.Nil(err)
+
+		var response common.Response[CreatedEndpointResponse]
+		a.Nil(json.NewDecoder(resp.Body).Decode(&response))
+		a.Equal(fiber.StatusOK, resp.StatusCode)
+		a.Equal("no-store", resp.Header.Get(fiber.HeaderCacheControl))
+		a.Equal("whsec_x", response.Data.Secret)
+	})
+
+	t.Run("should return bad request for invalid webhook", func(t *testing.T) {
+		var svc = new(MockService)
+		var server = web.NewServer()
+		NewController(server, svc).RegisterRoutes()
+		svc.On("CreateEndpoint", mock.Anything).Return(CreatedEndpointResponse{},
+			common.RequestValidationError{FieldErrors: map[string]string{"events": "unknown event x"}})
+
+		var req = httptest.NewRequest(fiber.MethodPost, "/api/v1/webhooks", strings.NewReader(`{"url":"https://x","events":["x"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		var resp, err = server.App.Test(req)
+		a.Nil(err)
+		a.Equal(fiber.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("should list deliveries with filter", func(t *testing.T) {
+		var svc = new(MockService)
+		var server = web.NewServer()
+		NewController(server, svc).RegisterRoutes()
+		svc.On("FindDeliveries", int64(1), DeliveriesRequest{Status: StatusFailed, Limit: 10}).
+			Return([]DeliveryResponse{{Id: 5, EndpointId: 1, Status: StatusFailed}}, nil)
+
+		var resp, err = server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/webhooks/1/deliveries?status=failed&limit=10", nil))
+		a.Nil(err)
+
+		var response common.Response[[]DeliveryResponse]
+		a.Nil(json.NewDecoder(resp.Body).Decode(&response))
+		a.Equal(fiber.StatusOK, resp.StatusCode)
+		a.Equal(int64(5), response.Data[0].Id)
+	})
+
+	t.Run("should redeliver", func(t *testing.T) {
+		var svc = new(MockService)
+		var server = web.NewServer()
+		NewController(server, svc).RegisterRoutes()
+		svc.On("Redeliver", int64(1), int64(5)).Return(DeliveryResponse{}, common.NotFoundError{Resource: "webhook delivery", ID: int64(5)})
+
+		var resp, err = server.App.Test(httptest.NewRequest(fiber.MethodPost, "/api/v1/webhooks/1/deliveries/5/redeliver", nil))
+		a.Nil(err)
+		a.Equal(fiber.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("should delete webhook", func(t *testing.T) {
+		var svc = new(MockService)
+		var server = web.NewServer()
+		NewController(server, svc).RegisterRoutes()
+		svc.On("DeleteEndpoint", int64(1)).Return(nil)
+
+		var resp, err = server.App.Test(httptest.NewRequest(fiber.MethodDelete, "/api/v1/webhooks/1", nil))
+		a.Nil(err)
+		a.Equal(fiber.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("should deliver queue", func(t *testing.T) {
+		var svc = new(MockService)
+		var server = web.NewServer()
+		NewController(server, svc).RegisterRoutes()
+		svc.On("Deliver", DefaultBatch).Return(Report{Delivered: 2}, nil)
+
+		var resp, err = server.App.Test(httptest.NewRequest(fiber.MethodPost, "/internal/webhooks/deliver", nil))
+		a.Nil(err)
+
+		var response common.Response[Report]
+		a.Nil(json.NewDecoder(resp.Body).Decode(&response))
+		a.Equal(Report{Delivered: 2}, response.Data)
+	})
+}
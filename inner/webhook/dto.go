@@ -0,0 +1,184 @@
+package webhook
+
+import (
+	"encoding/json"
+	"github.com/lib/pq"
+	"time"
+)
+
+// события, на которые можно подписаться; "*" — все события, "employee.*" и "role.*" — все события сущности
+const (
+	EventEmployeeCreated    = "employee.created"
+	EventEmployeeUpdated    = "employee.updated"
+	EventEmployeeDeleted    = "employee.deleted"
+	EventEmployeeRestored   = "employee.restored"
+	EventEmployeePurged     = "employee.purged"
+	EventEmployeeActivated  = "employee.activated"
+	EventEmployeeSuspended  = "employee.suspended"
+	EventEmployeeTerminated = "employee.terminated"
+	// EventEmployeeStatusChanged переход в состояние, для которого нет отдельного события
+	EventEmployeeStatusChanged = "employee.status_changed"
+	// EventRoleAssigned и EventRoleUnassigned выдача роли сотруднику и её отзыв
+	EventRoleAssigned       = "role.assigned"
+	EventRoleUnassigned     = "role.unassigned"
+	EventRoleCreated        = "role.created"
+	EventRoleUpdated        = "role.updated"
+	EventRoleDeleted        = "role.deleted"
+	EventRoleRestored       = "role.restored"
+	EventRolePurged         = "role.purged"
+	EventRoleParentsChanged = "role.parents_changed"
+)
+
+// Events все события, на которые можно подписаться
+var Events = []string{
+	EventEmployeeCreated, EventEmployeeUpdated, EventEmployeeDeleted, EventEmployeeRestored, EventEmployeePurged,
+	EventEmployeeActivated, EventEmployeeSuspended, EventEmployeeTerminated, EventEmployeeStatusChanged,
+	EventRoleAssigned, EventRoleUnassigned, EventRoleCreated, EventRoleUpdated, EventRoleDeleted,
+	EventRoleRestored, EventRolePurged, EventRoleParentsChanged,
+}
+
+// состояния доставки
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// MaxAttempts после стольких неудачных попыток доставка помечается failed и повторяется только вручную
+const MaxAttempts = 10
+
+// DefaultBatch количество доставок, отправляемых за один проход
+const DefaultBatch = 100
+
+// DefaultLimit количество доставок в журнале, если limit не задан
+const DefaultLimit = 100
+
+// заголовки запроса доставки
+const (
+	HeaderEvent     = "X-Idm-Event"
+	HeaderEventId   = "X-Idm-Event-Id"
+	HeaderDelivery  = "X-Idm-Delivery"
+	HeaderSignature = "X-Idm-Signature"
+)
+
+type EndpointEntity struct {
+	Id        int64          `db:"id"`
+	Url       string         `db:"url"`
+	Events    pq.StringArray `db:"events"`
+	Secret    string         `db:"secret"`
+	CreatedAt time.Time      `db:"created_at"`
+}
+
+func (e *EndpointEntity) toResponse() EndpointResponse {
+	return EndpointResponse{
+		Id:        e.Id,
+		Url:       e.Url,
+		Events:    e.Events,
+		CreatedAt: e.CreatedAt,
+	}
+}
+
+// DeliveryEntity доставка события получателю; Url и Secret — получателя, заполняются при выборке на отправку
+type DeliveryEntity struct {
+	Id             int64           `db:"id"`
+	EndpointId     int64           `db:"endpoint_id"`
+	EventId        string          `db:"event_id"`
+	Event          string          `db:"event"`
+	Payload        json.RawMessage `db:"payload"`
+	Status         string          `db:"status"`
+	Attempts       int             `db:"attempts"`
+	NextAttemptAt  time.Time       `db:"next_attempt_at"`
+	ResponseStatus *int            `db:"response_status"`
+	LastError      string          `db:"last_error"`
+	DeliveredAt    *time.Time      `db:"delivered_at"`
+	CreatedAt      time.Time       `db:"created_at"`
+	Url            string          `db:"url"`
+	Secret         string          `db:"secret"`
+}
+
+func (e *DeliveryEntity) toResponse() DeliveryResponse {
+	response := DeliveryResponse{
+		Id:             e.Id,
+		EndpointId:     e.EndpointId,
+		EventId:        e.EventId,
+		Event:          e.Event,
+		Payload:        e.Payload,
+		Status:         e.Status,
+		Attempts:       e.Attempts,
+		ResponseStatus: e.ResponseStatus,
+		LastError:      e.LastError,
+		DeliveredAt:    e.DeliveredAt,
+		CreatedAt:      e.CreatedAt,
+	}
+	if e.Status == StatusPending {
+		response.NextAttemptAt = &e.NextAttemptAt
+	}
+	return response
+}
+
+// Payload тело доставки. Id общий у доставок одного события всем получателям и не меняется при повторах,
+// по нему получатель отбрасывает дубликаты
+type Payload struct {
+	Id         string      `json:"id"`
+	Event      string      `json:"event"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Actor      string      `json:"actor"`
+	RequestId  string      `json:"request_id,omitempty"`
+	Data       PayloadData `json:"data"`
+}
+
+// PayloadData изменённая сущность: состояние до и после изменения, как в журнале аудита
+type PayloadData struct {
+	EntityType string           `json:"entity_type"`
+	EntityId   int64            `json:"entity_id"`
+	Before     *json.RawMessage `json:"before"`
+	After      *json.RawMessage `json:"after"`
+}
+
+type EndpointResponse struct {
+	Id        int64     `json:"id"`
+	Url       string    `json:"url"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreatedEndpointResponse секрет подписи возвращается только один раз — при регистрации
+type CreatedEndpointResponse struct {
+	EndpointResponse
+	Secret string `json:"secret"`
+}
+
+type DeliveryResponse struct {
+	Id             int64           `json:"id"`
+	EndpointId     int64           `json:"endpoint_id"`
+	EventId        string          `json:"event_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"`
+	ResponseStatus *int            `json:"response_status"`
+	LastError      string          `json:"last_error"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// CreateEndpointRequest события перечисляются из Events или шаблонами "*", "employee.*", "role.*";
+// Url только https и только на публичный адрес
+type CreateEndpointRequest struct {
+	Url    string   `json:"url" validate:"required,url,startswith=https://,max=2000"`
+	Events []string `json:"events" validate:"required,min=1,max=50,unique,dive,required,max=100"`
+}
+
+// DeliveriesRequest фильтр журнала доставок; BeforeId — для постраничного просмотра от новых к старым
+type DeliveriesRequest struct {
+	Status   string `query:"status" validate:"omitempty,oneof=pending delivered failed"`
+	BeforeId int64  `query:"before_id" validate:"min=0"`
+	Limit    int    `query:"limit" validate:"min=0,max=1000"`
+}
+
+// Report итог прохода доставки
+type Report struct {
+	Delivered int `json:"delivered"`
+	Failed    int `json:"failed"`
+}
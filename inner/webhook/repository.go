@@ -0,0 +1,104 @@
+package webhook
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"time"
+)
+
+type Repository struct {
+	db *sqlx.DB
+}
+
+func NewWebhookRepository(dataBase *sqlx.DB) *Repository {
+	return &Repository{db: dataBase}
+}
+
+func (repo *Repository) SaveEndpoint(entity EndpointEntity) (saved EndpointEntity, err error) {
+	err = repo.db.Get(&saved, `INSERT INTO webhook_endpoint (url, events, secret) VALUES ($1, $2, $3)
+		RETURNING id, url, events, secret, created_at`,
+		entity.Url, pq.Array([]string(entity.Events)), entity.Secret)
+	return saved, err
+}
+
+func (repo *Repository) FindEndpoints() (listEntity []EndpointEntity, err error) {
+	listEntity = []EndpointEntity{}
+	err = repo.db.Select(&listEntity, "SELECT id, url, events, secret, created_at FROM webhook_endpoint ORDER BY id")
+	return listEntity, err
+}
+
+// DeleteEndpoint удаление получателя вместе с журналом его доставок; нет получателя — sql.ErrNoRows
+func (repo *Repository) DeleteEndpoint(id int64) error {
+	var deleted int64
+	return repo.db.Get(&deleted, "DELETE FROM webhook_endpoint WHERE id = $1 RETURNING id", id)
+}
+
+func (repo *Repository) ExistsEndpoint(id int64) (isExists bool, err error) {
+	err = repo.db.Get(&isExists, "SELECT exists(SELECT 1 FROM webhook_endpoint WHERE id = $1)", id)
+	return isExists, err
+}
+
+// EnqueueTx доставки события всем получателям, подписанным на него, в транзакции изменения;
+// подписка совпадает с событием точно, шаблоном сущности "employee.*" или шаблоном "*".
+// Тело передаётся строкой: []byte драйвер отправил бы как bytea
+func (repo *Repository) EnqueueTx(tx *sqlx.Tx, eventId string, event string, payload []byte) error {
+	_, err := tx.Exec(`INSERT INTO webhook_delivery (endpoint_id, event_id, event, payload)
+		SELECT id, $1, $2, $3 FROM webhook_endpoint
+		WHERE events && ARRAY[$2, split_part($2, '.', 1) || '.*', '*']`,
+		eventId, event, string(payload))
+	return err
+}
+
+// ClaimDue выборка доставок, которым пора отправляться, вместе с адресом и секретом получателя;
+// выбранные откладываются на lease, чтобы параллельный проход их не взял, а при падении процесса
+// они отправились повторно
+func (repo *Repository) ClaimDue(limit int, lease time.Duration) (items []DeliveryEntity, err error) {
+	items = []DeliveryEntity{}
+	err = repo.db.Select(&items, `WITH claimed AS (
+			UPDATE webhook_delivery SET next_attempt_at = now() + make_interval(secs => $2)
+			WHERE id IN (SELECT id FROM webhook_delivery WHERE status = 'pending' AND next_attempt_at <= now()
+				ORDER BY next_attempt_at, id LIMIT $1 FOR UPDATE SKIP LOCKED)
+			RETURNING *)
+		SELECT c.*, e.url, e.secret FROM claimed c JOIN webhook_endpoint e ON e.id = c.endpoint_id
+		ORDER BY c.id`,
+		limit, lease.Seconds())
+	return items, err
+}
+
+// Delivered отметка успешной доставки
+func (repo *Repository) Delivered(id int64, attempts int, responseStatus int) error {
+	_, err := repo.db.Exec(`UPDATE webhook_delivery SET status = 'delivered', attempts = $2, response_status = $3,
+		last_error = '', delivered_at = now() WHERE id = $1`,
+		id, attempts, responseStatus)
+	return err
+}
+
+// Failed запись неудачной попытки; nextAttemptAt nil — попытки исчерпаны, доставка помечается failed
+func (repo *Repository) Failed(id int64, attempts int, nextAttemptAt *time.Time, responseStatus *int, lastError string) error {
+	_, err := repo.db.Exec(`UPDATE webhook_delivery
+		SET status = CASE WHEN $3::timestamptz IS NULL THEN 'failed' ELSE 'pending' END,
+			attempts = $2, next_attempt_at = coalesce($3, next_attempt_at), response_status = $4, last_error = $5
+		WHERE id = $1`,
+		id, attempts, nextAttemptAt, responseStatus, lastError)
+	return err
+}
+
+// FindDeliveries журнал доставок получателя от новых к старым
+func (repo *Repository) FindDeliveries(endpointId int64, status string, beforeId int64, limit int) (items []DeliveryEntity, err error) {
+	items = []DeliveryEntity{}
+	err = repo.db.Select(&items, `SELECT d.*, '' AS url, '' AS secret FROM webhook_delivery d
+		WHERE d.endpoint_id = $1 AND ($2 = '' OR d.status = $2) AND ($3 = 0 OR d.id < $3)
+		ORDER BY d.id DESC LIMIT $4`,
+		endpointId, status, beforeId, limit)
+	return items, err
+}
+
+// Redeliver новая доставка того же события получателю; прежняя остаётся в журнале как есть.
+// Нет доставки — sql.ErrNoRows
+func (repo *Repository) Redeliver(endpointId int64, id int64) (item DeliveryEntity, err error) {
+	err = repo.db.Get(&item, `INSERT INTO webhook_delivery (endpoint_id, event_id, event, payload)
+		SELECT endpoint_id, event_id, event, payload FROM webhook_delivery WHERE id = $1 AND endpoint_id = $2
+		RETURNING *, '' AS url, '' AS secret`,
+		id, endpointId)
+	return item, err
+}
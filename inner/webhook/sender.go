@@ -0,0 +1,70 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Sender отправка события POST-запросом с заголовками и подписью веб-хуков; ею же отправляет события
+// приёмник webhook в outbox, поэтому получатель веб-хуков принимает и его
+type Sender struct {
+	httpClient *http.Client
+	userAgent  string
+	now        func() time.Time
+}
+
+func NewSender(httpClient *http.Client, userAgent string) *Sender {
+	return &Sender{httpClient: httpClient, userAgent: userAgent, now: time.Now}
+}
+
+// Message отправляемое событие; Delivery — номер доставки для X-Idm-Delivery
+type Message struct {
+	Url      string
+	Secret   string
+	Event    string
+	EventId  string
+	Delivery int64
+	Payload  []byte
+}
+
+// Send успех — ответ 2xx. Возвращает код ответа, 0 — ответа не было
+func (sender *Sender) Send(message Message) (int, error) {
+	request, err := http.NewRequest(http.MethodPost, message.Url, bytes.NewReader(message.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := sender.now().Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", sender.userAgent)
+	request.Header.Set(HeaderEvent, message.Event)
+	request.Header.Set(HeaderEventId, message.EventId)
+	request.Header.Set(HeaderDelivery, strconv.FormatInt(message.Delivery, 10))
+	request.Header.Set(HeaderSignature, fmt.Sprintf("t=%d,v1=%s", timestamp, Sign(message.Secret, timestamp, message.Payload)))
+	response, err := sender.httpClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = response.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("unexpected response status %d", response.StatusCode)
+	}
+	return response.StatusCode, nil
+}
+
+// Sign подпись доставки: HMAC-SHA256 секретом получателя от "<timestamp>.<тело>" в hex.
+// Получатель вычисляет её сам, сравнивает с v1 из X-Idm-Signature и отклоняет запросы со старым t,
+// чтобы перехваченную доставку нельзя было повторить
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,352 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"idm/inner/audit"
+	"idm/inner/common"
+	"idm/inner/employee"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// lease на сколько откладывается доставка, взятая в отправку
+const lease = 5 * time.Minute
+
+// secretPrefix начало секрета подписи, по нему секрет легко найти в конфигурации получателя
+const secretPrefix = "whsec_"
+
+type Service struct {
+	repo      Repo
+	validator Validator
+	sender    *Sender
+	now       func() time.Time
+	lookupIP  func(host string) ([]net.IP, error)
+}
+
+type Validator interface {
+	Validate(request any) error
+}
+
+type Repo interface {
+	SaveEndpoint(entity EndpointEntity) (EndpointEntity, error)
+	FindEndpoints() ([]EndpointEntity, error)
+	DeleteEndpoint(id int64) error
+	ExistsEndpoint(id int64) (bool, error)
+	EnqueueTx(tx *sqlx.Tx, eventId string, event string, payload []byte) error
+	ClaimDue(limit int, lease time.Duration) ([]DeliveryEntity, error)
+	Delivered(id int64, attempts int, responseStatus int) error
+	Failed(id int64, attempts int, nextAttemptAt *time.Time, responseStatus *int, lastError string) error
+	FindDeliveries(endpointId int64, status string, beforeId int64, limit int) ([]DeliveryEntity, error)
+	Redeliver(endpointId int64, id int64) (DeliveryEntity, error)
+}
+
+func NewService(repo Repo, validator Validator, httpClient *http.Client) *Service {
+	return &Service{
+		repo:      repo,
+		validator: validator,
+		sender:    NewSender(httpClient, "idm-webhook"),
+		now:       time.Now,
+		lookupIP:  net.LookupIP,
+	}
+}
+
+// RecordTx создаёт доставки события об изменении в транзакции самого изменения, поэтому событие
+// не теряется и не отправляется, если изменение откатилось; реализует audit.Recorder
+func (service *Service) RecordTx(tx *sqlx.Tx, actor audit.Actor, record audit.Record) error {
+	payload, err := NewPayload(actor, record, service.now())
+	if err != nil || payload.Event == "" {
+		return err
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error serializing %s event: %w", payload.Event, err)
+	}
+	if err = service.repo.EnqueueTx(tx, payload.Id, payload.Event, body); err != nil {
+		return fmt.Errorf("error enqueueing %s event of %s %d: %w", payload.Event, record.EntityType, record.EntityId, err)
+	}
+	return nil
+}
+
+// NewPayload событие об изменении с новым идентификатором; пустой Event — изменение не публикуется.
+// Тот же формат получают приёмники транзакционного outbox
+func NewPayload(actor audit.Actor, record audit.Record, occurredAt time.Time) (Payload, error) {
+	before, err := marshal(record.Before)
+	if err != nil {
+		return Payload{}, fmt.Errorf("error serializing %s %d before %s: %w", record.EntityType, record.EntityId, record.Action, err)
+	}
+	after, err := marshal(record.After)
+	if err != nil {
+		return Payload{}, fmt.Errorf("error serializing %s %d after %s: %w", record.EntityType, record.EntityId, record.Action, err)
+	}
+	event := eventOf(record, after)
+	if event == "" {
+		return Payload{}, nil
+	}
+	return Payload{
+		Id:         randomString(16),
+		Event:      event,
+		OccurredAt: occurredAt.UTC(),
+		Actor:      actor.Subject,
+		RequestId:  actor.RequestId,
+		Data: PayloadData{
+			EntityType: record.EntityType,
+			EntityId:   record.EntityId,
+			Before:     before,
+			After:      after,
+		},
+	}, nil
+}
+
+// eventOf событие по записи журнала; пусто — изменение не публикуется
+func eventOf(record audit.Record, after *json.RawMessage) string {
+	switch record.EntityType {
+	case audit.EntityEmployee:
+		switch record.Action {
+		case audit.ActionCreate:
+			return EventEmployeeCreated
+		case audit.ActionUpdate:
+			return EventEmployeeUpdated
+		case audit.ActionDelete:
+			return EventEmployeeDeleted
+		case audit.ActionRestore:
+			return EventEmployeeRestored
+		case audit.ActionPurge:
+			return EventEmployeePurged
+		case audit.ActionAddRole:
+			return EventRoleAssigned
+		case audit.ActionRemoveRole:
+			return EventRoleUnassigned
+		case audit.ActionChangeStatus:
+			return statusEvent(after)
+		}
+	case audit.EntityRole:
+		switch record.Action {
+		case audit.ActionCreate:
+			return EventRoleCreated
+		case audit.ActionUpdate:
+			return EventRoleUpdated
+		case audit.ActionDelete:
+			return EventRoleDeleted
+		case audit.ActionRestore:
+			return EventRoleRestored
+		case audit.ActionPurge:
+			return EventRolePurged
+		case audit.ActionSetParents:
+			return EventRoleParentsChanged
+		}
+	}
+	return ""
+}
+
+// statusEvent событие перехода сотрудника по его новому состоянию
+func statusEvent(after *json.RawMessage) string {
+	var state struct {
+		Status string `json:"status"`
+	}
+	if after != nil {
+		_ = json.Unmarshal(*after, &state)
+	}
+	switch state.Status {
+	case employee.StatusActive:
+		return EventEmployeeActivated
+	case employee.StatusSuspended:
+		return EventEmployeeSuspended
+	case employee.StatusTerminated:
+		return EventEmployeeTerminated
+	}
+	return EventEmployeeStatusChanged
+}
+
+// CreateEndpoint регистрация получателя; секрет подписи генерируется и возвращается один раз
+func (service *Service) CreateEndpoint(request CreateEndpointRequest) (CreatedEndpointResponse, error) {
+	if err := service.validator.Validate(request); err != nil {
+		return CreatedEndpointResponse{}, err
+	}
+	for _, event := range request.Events {
+		if !knownEvent(event) {
+			return CreatedEndpointResponse{}, common.RequestValidationError{
+				FieldErrors: map[string]string{"events": "unknown event " + event},
+			}
+		}
+	}
+	if err := checkUrl(request.Url, service.lookupIP); err != nil {
+		return CreatedEndpointResponse{}, common.RequestValidationError{
+			FieldErrors: map[string]string{"url": err.Error()},
+		}
+	}
+	saved, err := service.repo.SaveEndpoint(EndpointEntity{
+		Url:    request.Url,
+		Events: request.Events,
+		Secret: secretPrefix + randomString(32),
+	})
+	if err != nil {
+		return CreatedEndpointResponse{}, fmt.Errorf("error saving webhook %s: %w", request.Url, err)
+	}
+	return CreatedEndpointResponse{EndpointResponse: saved.toResponse(), Secret: saved.Secret}, nil
+}
+
+func knownEvent(event string) bool {
+	return event == "*" || event == "employee.*" || event == "role.*" || slices.Contains(Events, event)
+}
+
+func (service *Service) FindEndpoints() ([]EndpointResponse, error) {
+	endpoints, err := service.repo.FindEndpoints()
+	if err != nil {
+		return []EndpointResponse{}, fmt.Errorf("error finding webhooks: %w", err)
+	}
+	responses := make([]EndpointResponse, len(endpoints))
+	for i := range endpoints {
+		responses[i] = endpoints[i].toResponse()
+	}
+	return responses, nil
+}
+
+// DeleteEndpoint удаление получателя; недоставленные ему события больше не отправляются
+func (service *Service) DeleteEndpoint(id int64) error {
+	err := service.repo.DeleteEndpoint(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return common.NotFoundError{Resource: "webhook", ID: id}
+	}
+	if err != nil {
+		return fmt.Errorf("error delete webhook by id: %d: %w", id, err)
+	}
+	return nil
+}
+
+// FindDeliveries журнал доставок получателя от новых к старым
+func (service *Service) FindDeliveries(endpointId int64, request DeliveriesRequest) ([]DeliveryResponse, error) {
+	if err := service.validator.Validate(request); err != nil {
+		return []DeliveryResponse{}, err
+	}
+	exists, err := service.repo.ExistsEndpoint(endpointId)
+	if err != nil {
+		return []DeliveryResponse{}, fmt.Errorf("error finding webhook with id %d: %w", endpointId, err)
+	}
+	if !exists {
+		return []DeliveryResponse{}, common.NotFoundError{Resource: "webhook", ID: endpointId}
+	}
+	limit := request.Limit
+	if limit == 0 {
+		limit = DefaultLimit
+	}
+	items, err := service.repo.FindDeliveries(endpointId, request.Status, request.BeforeId, limit)
+	if err != nil {
+		return []DeliveryResponse{}, fmt.Errorf("error finding deliveries of webhook %d: %w", endpointId, err)
+	}
+	responses := make([]DeliveryResponse, len(items))
+	for i := range items {
+		responses[i] = items[i].toResponse()
+	}
+	return responses, nil
+}
+
+// Redeliver повторная отправка события получателю новой доставкой, например после исправления
+// ошибки на его стороне; идентификатор события прежний
+func (service *Service) Redeliver(endpointId int64, id int64) (DeliveryResponse, error) {
+	item, err := service.repo.Redeliver(endpointId, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DeliveryResponse{}, common.NotFoundError{Resource: "webhook delivery", ID: id}
+	}
+	if err != nil {
+		return DeliveryResponse{}, fmt.Errorf("error redelivering webhook delivery %d: %w", id, err)
+	}
+	return item.toResponse(), nil
+}
+
+// Deliver отправка не более limit доставок; ошибка одной не останавливает остальные,
+// доставка повторяется позже с растущей паузой
+func (service *Service) Deliver(limit int) (report Report, err error) {
+	items, err := service.repo.ClaimDue(limit, lease)
+	if err != nil {
+		return report, fmt.Errorf("error claiming webhook deliveries: %w", err)
+	}
+	for _, item := range items {
+		attempts := item.Attempts + 1
+		status, sendErr := service.sender.Send(Message{
+			Url:      item.Url,
+			Secret:   item.Secret,
+			Event:    item.Event,
+			EventId:  item.EventId,
+			Delivery: item.Id,
+			Payload:  item.Payload,
+		})
+		if sendErr != nil {
+			report.Failed++
+			var next *time.Time
+			if attempts < MaxAttempts {
+				at := service.now().Add(backoff(attempts))
+				next = &at
+			}
+			var responseStatus *int
+			if status != 0 {
+				responseStatus = &status
+			}
+			err = service.repo.Failed(item.Id, attempts, next, responseStatus, sendErr.Error())
+		} else {
+			report.Delivered++
+			err = service.repo.Delivered(item.Id, attempts, status)
+		}
+		if err != nil {
+			return report, fmt.Errorf("error updating webhook delivery %d: %w", item.Id, err)
+		}
+	}
+	return report, nil
+}
+
+// Run отправка доставок каждые interval, пока не закрыт stop; за проход очередь выбирается до конца
+func (service *Service) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for {
+			report, err := service.Deliver(DefaultBatch)
+			if err != nil {
+				fmt.Printf("webhook delivery error: %v\n", err)
+				break
+			}
+			if report.Delivered+report.Failed < DefaultBatch {
+				break
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// backoff пауза перед попыткой attempts: 30 секунд, удваиваясь, но не больше часа
+func backoff(attempts int) time.Duration {
+	pause := 30 * time.Second
+	for i := 1; i < attempts && pause < time.Hour; i++ {
+		pause *= 2
+	}
+	return min(pause, time.Hour)
+}
+
+func marshal(state any) (*json.RawMessage, error) {
+	if state == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	raw := json.RawMessage(data)
+	return &raw, nil
+}
+
+func randomString(size int) string {
+	buf := make([]byte, size)
+	_, _ = rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
@@ -0,0 +1,323 @@
+package webhook
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/audit"
+	"idm/inner/common"
+	"idm/inner/validator"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type MockRepo struct {
+	mock.Mock
+}
+
+func (m *MockRepo) SaveEndpoint(entity EndpointEntity) (EndpointEntity, error) {
+	args := m.Called(entity)
+	return args.Get(0).(EndpointEntity), args.Error(1)
+}
+
+func (m *MockRepo) FindEndpoints() ([]EndpointEntity, error) {
+	args := m.Called()
+	return args.Get(0).([]EndpointEntity), args.Error(1)
+}
+
+func (m *MockRepo) DeleteEndpoint(id int64) error {
+	return m.Called(id).Error(0)
+}
+
+func (m *MockRepo) ExistsEndpoint(id int64) (bool, error) {
+	args := m.Called(id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepo) EnqueueTx(tx *sqlx.Tx, eventId string, event string, payload []byte) error {
+	return m.Called(tx, eventId, event, payload).Error(0)
+}
+
+func (m *MockRepo) ClaimDue(limit int, lease time.Duration) ([]DeliveryEntity, error) {
+	args := m.Called(limit, lease)
+	return args.Get(0).([]DeliveryEntity), args.Error(1)
+}
+
+func (m *MockRepo) Delivered(id int64, attempts int, responseStatus int) error {
+	return m.Called(id, attempts, responseStatus).Error(0)
+}
+
+func (m *MockRepo) Failed(id int64, attempts int, nextAttemptAt *time.Time, responseStatus *int, lastError string) error {
+	return m.Called(id, attempts, nextAttemptAt, responseStatus, lastError).Error(0)
+}
+
+func (m *MockRepo) FindDeliveries(endpointId int64, status string, beforeId int64, limit int) ([]DeliveryEntity, error) {
+	args := m.Called(endpointId, status, beforeId, limit)
+	return args.Get(0).([]DeliveryEntity), args.Error(1)
+}
+
+func (m *MockRepo) Redeliver(endpointId int64, id int64) (DeliveryEntity, error) {
+	args := m.Called(endpointId, id)
+	return args.Get(0).(DeliveryEntity), args.Error(1)
+}
+
+var now = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func newService(repo Repo) *Service {
+	service := NewService(repo, validator.New(), http.DefaultClient)
+	service.now = func() time.Time { return now }
+	service.sender.now = service.now
+	service.lookupIP = func(host string) ([]net.IP, error) {
+		if host == "localhost" {
+			return []net.IP{net.IPv4(127, 0, 0, 1)}, nil
+		}
+		return []net.IP{net.IPv4(93, 184, 215, 14)}, nil
+	}
+	return service
+}
+
+func TestRecordTx(t *testing.T) {
+	var a = assert.New(t)
+	var noTx *sqlx.Tx
+	var actor = audit.Actor{Subject: "42", RequestId: "req-1"}
+
+	var cases = []struct {
+		record audit.Record
+		event  string
+	}{
+		{audit.Record{Action: audit.ActionCreate, EntityType: audit.EntityEmployee, EntityId: 7,
+			After: map[string]any{"id": 7, "status": "active"}}, EventEmployeeCreated},
+		{audit.Record{Action: audit.ActionChangeStatus, EntityType: audit.EntityEmployee, EntityId: 7,
+			Before: map[string]any{"status": "active"}, After: map[string]any{"status": "terminated"}}, EventEmployeeTerminated},
+		{audit.Record{Action: audit.ActionChangeStatus, EntityType: audit.EntityEmployee, EntityId: 7,
+			After: map[string]any{"status": "pending"}}, EventEmployeeStatusChanged},
+		{audit.Record{Action: audit.ActionAddRole, EntityType: audit.EntityEmployee, EntityId: 7,
+			After: map[string]any{"role_id": 3}}, EventRoleAssigned},
+		{audit.Record{Action: audit.ActionRemoveRole, EntityType: audit.EntityEmployee, EntityId: 7,
+			Before: map[string]any{"role_id": 3}}, EventRoleUnassigned},
+		{audit.Record{Action: audit.ActionDelete, EntityType: audit.EntityRole, EntityId: 3,
+			Before: map[string]any{"id": 3}}, EventRoleDeleted},
+		{audit.Record{Action: audit.ActionSetParents, EntityType: audit.EntityRole, EntityId: 3,
+			After: map[string]any{"parent_ids": []int64{1}}}, EventRoleParentsChanged},
+	}
+	for _, c := range cases {
+		t.Run("should enqueue "+c.event, func(t *testing.T) {
+			var repo = new(MockRepo)
+			var svc = newService(repo)
+			var payload Payload
+			repo.On("EnqueueTx", noTx, mock.Anything, c.event, mock.Anything).Run(func(args mock.Arguments) {
+				a.Nil(json.Unmarshal(args.Get(3).([]byte), &payload))
+				a.Equal(args.String(1), payload.Id)
+			}).Return(nil)
+
+			var err = svc.RecordTx(noTx, actor, c.record)
+
+			a.Nil(err)
+			a.Equal(c.event, payload.Event)
+			a.Equal(now, payload.OccurredAt)
+			a.Equal("42", payload.Actor)
+			a.Equal("req-1", payload.RequestId)
+			a.Equal(c.record.EntityType, payload.Data.EntityType)
+			a.Equal(c.record.EntityId, payload.Data.EntityId)
+			a.Equal(c.record.Before == nil, payload.Data.Before == nil)
+			a.Equal(c.record.After == nil, payload.Data.After == nil)
+		})
+	}
+
+	t.Run("should skip changes without event", func(t *testing.T) {
+		var repo = new(MockRepo)
+
+		var err = newService(repo).RecordTx(noTx, actor, audit.Record{Action: "rename", EntityType: audit.EntityRole})
+
+		a.Nil(err)
+		repo.AssertNotCalled(t, "EnqueueTx", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("should fail change when event is not saved", func(t *testing.T) {
+		var repo = new(MockRepo)
+		repo.On("EnqueueTx", noTx, mock.Anything, EventRoleCreated, mock.Anything).Return(errors.New("database is down"))
+
+		var err = newService(repo).RecordTx(noTx, actor, audit.Record{Action: audit.ActionCreate, EntityType: audit.EntityRole})
+
+		a.ErrorContains(err, "database is down")
+	})
+}
+
+func TestDeliver(t *testing.T) {
+	var a = assert.New(t)
+	var payload = json.RawMessage(`{"id":"evt-1","event":"employee.created"}`)
+
+	t.Run("should send signed delivery and mark it delivered", func(t *testing.T) {
+		var received *http.Request
+		var body []byte
+		var receiver = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = r
+			body, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer receiver.Close()
+		var repo = new(MockRepo)
+		repo.On("ClaimDue", DefaultBatch, lease).Return([]DeliveryEntity{{Id: 5, EventId: "evt-1",
+			Event: EventEmployeeCreated, Payload: payload, Attempts: 2, Url: receiver.URL, Secret: "whsec_test"}}, nil)
+		repo.On("Delivered", int64(5), 3, http.StatusNoContent).Return(nil)
+
+		var report, err = newService(repo).Deliver(DefaultBatch)
+
+		a.Nil(err)
+		a.Equal(Report{Delivered: 1}, report)
+		a.Equal([]byte(payload), body)
+		a.Equal(EventEmployeeCreated, received.Header.Get(HeaderEvent))
+		a.Equal("evt-1", received.Header.Get(HeaderEventId))
+		a.Equal("5", received.Header.Get(HeaderDelivery))
+		a.Equal(fmt.Sprintf("t=%d,v1=%s", now.Unix(), Sign("whsec_test", now.Unix(), payload)), received.Header.Get(HeaderSignature))
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("should retry failed delivery with backoff", func(t *testing.T) {
+		var receiver = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer receiver.Close()
+		var repo = new(MockRepo)
+		var next = now.Add(2 * time.Minute)
+		var status = http.StatusServiceUnavailable
+		repo.On("ClaimDue", DefaultBatch, lease).Return([]DeliveryEntity{
+			{Id: 5, Payload: payload, Attempts: 2, Url: receiver.URL},
+			{Id: 6, Payload: payload, Attempts: MaxAttempts - 1, Url: receiver.URL},
+		}, nil)
+		repo.On("Failed", int64(5), 3, &next, &status, "unexpected response status 503").Return(nil)
+		repo.On("Failed", int64(6), MaxAttempts, (*time.Time)(nil), &status, "unexpected response status 503").Return(nil)
+
+		var report, err = newService(repo).Deliver(DefaultBatch)
+
+		a.Nil(err)
+		a.Equal(Report{Failed: 2}, report)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("should record unreachable receiver without status", func(t *testing.T) {
+		var repo = new(MockRepo)
+		repo.On("ClaimDue", DefaultBatch, lease).Return([]DeliveryEntity{{Id: 5, Payload: payload, Url: "http://127.0.0.1:1"}}, nil)
+		repo.On("Failed", int64(5), 1, mock.Anything, (*int)(nil), mock.Anything).Return(nil)
+
+		var report, err = newService(repo).Deliver(DefaultBatch)
+
+		a.Nil(err)
+		a.Equal(Report{Failed: 1}, report)
+		repo.AssertExpectations(t)
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	var a = assert.New(t)
+
+	a.Equal(30*time.Second, backoff(1))
+	a.Equal(4*time.Minute, backoff(4))
+	a.Equal(time.Hour, backoff(MaxAttempts))
+}
+
+func TestEndpoints(t *testing.T) {
+	var a = assert.New(t)
+
+	t.Run("should create endpoint with generated secret", func(t *testing.T) {
+		var repo = new(MockRepo)
+		repo.On("SaveEndpoint", mock.MatchedBy(func(e EndpointEntity) bool {
+			return e.Url == "https://crm.example.com/hooks" && len(e.Secret) > len(secretPrefix)
+		})).Return(EndpointEntity{Id: 1, Url: "https://crm.example.com/hooks", Events: []string{"employee.*"},
+			Secret: "whsec_generated"}, nil)
+
+		var got, err = newService(repo).CreateEndpoint(CreateEndpointRequest{
+			Url: "https://crm.example.com/hooks", Events: []string{"employee.*"}})
+
+		a.Nil(err)
+		a.Equal(int64(1), got.Id)
+		a.Equal("whsec_generated", got.Secret)
+	})
+
+	t.Run("should reject unknown event", func(t *testing.T) {
+		var _, err = newService(new(MockRepo)).CreateEndpoint(CreateEndpointRequest{
+			Url: "https://crm.example.com/hooks", Events: []string{"employee.renamed"}})
+
+		a.ErrorAs(err, &common.RequestValidationError{})
+	})
+
+	t.Run("should reject invalid url", func(t *testing.T) {
+		var _, err = newService(new(MockRepo)).CreateEndpoint(CreateEndpointRequest{
+			Url: "ftp://crm.example.com", Events: []string{"*"}})
+
+		a.ErrorAs(err, &common.RequestValidationError{})
+	})
+
+	t.Run("should reject plain http url", func(t *testing.T) {
+		var _, err = newService(new(MockRepo)).CreateEndpoint(CreateEndpointRequest{
+			Url: "http://crm.example.com/hooks", Events: []string{"*"}})
+
+		a.ErrorAs(err, &common.RequestValidationError{})
+	})
+
+	t.Run("should reject url of non-public address", func(t *testing.T) {
+		for _, url := range []string{
+			"https://127.0.0.1/hooks", "https://localhost:8081/internal", "https://10.0.0.5/hooks",
+			"https://192.168.1.1/hooks", "https://169.254.169.254/latest/meta-data", "https://[::1]/hooks",
+			"https://0.0.0.0/hooks",
+		} {
+			var _, err = newService(new(MockRepo)).CreateEndpoint(CreateEndpointRequest{Url: url, Events: []string{"*"}})
+
+			var validationErr common.RequestValidationError
+			a.ErrorAs(err, &validationErr, url)
+			a.Equal(ErrForbiddenAddress.Error(), validationErr.FieldErrors["url"], url)
+		}
+	})
+
+	t.Run("should return not found for missing endpoint", func(t *testing.T) {
+		var repo = new(MockRepo)
+		repo.On("DeleteEndpoint", int64(9)).Return(sql.ErrNoRows)
+		repo.On("ExistsEndpoint", int64(9)).Return(false, nil)
+		repo.On("Redeliver", int64(9), int64(5)).Return(DeliveryEntity{}, sql.ErrNoRows)
+		var svc = newService(repo)
+
+		a.ErrorAs(svc.DeleteEndpoint(9), &common.NotFoundError{})
+		var _, err = svc.FindDeliveries(9, DeliveriesRequest{})
+		a.ErrorAs(err, &common.NotFoundError{})
+		_, err = svc.Redeliver(9, 5)
+		a.ErrorAs(err, &common.NotFoundError{})
+	})
+
+	t.Run("should find deliveries with default limit", func(t *testing.T) {
+		var repo = new(MockRepo)
+		repo.On("ExistsEndpoint", int64(1)).Return(true, nil)
+		repo.On("FindDeliveries", int64(1), StatusFailed, int64(0), DefaultLimit).
+			Return([]DeliveryEntity{{Id: 5, EndpointId: 1, Status: StatusFailed, Attempts: MaxAttempts}}, nil)
+
+		var got, err = newService(repo).FindDeliveries(1, DeliveriesRequest{Status: StatusFailed})
+
+		a.Nil(err)
+		a.Len(got, 1)
+		a.Nil(got[0].NextAttemptAt)
+	})
+}
+
+func TestHttpClient(t *testing.T) {
+	var a = assert.New(t)
+
+	t.Run("should not connect to non-public address", func(t *testing.T) {
+		var received bool
+		var receiver = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = true
+		}))
+		defer receiver.Close()
+
+		var _, err = NewHttpClient(time.Second).Post(receiver.URL, "application/json", nil)
+
+		a.ErrorIs(err, ErrForbiddenAddress)
+		a.False(received)
+	})
+}
@@ -0,0 +1,47 @@
+-- +goose Up
+-- +goose StatementBegin
+-- удаление сотрудников и ролей мягкое: строка остаётся с отметкой deleted_at и может быть восстановлена,
+-- окончательно её удаляет очистка по истечении срока хранения
+ALTER TABLE employee
+    ADD COLUMN IF NOT EXISTS deleted_at timestamptz;
+ALTER TABLE role
+    ADD COLUMN IF NOT EXISTS deleted_at timestamptz;
+
+CREATE INDEX IF NOT EXISTS employee_deleted_at_idx ON employee (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS role_deleted_at_idx ON role (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- окончательное удаление роли снимает её как основную с сотрудников, а не удаляет их
+ALTER TABLE employee
+    DROP CONSTRAINT IF EXISTS employee_role_id_fkey,
+    ADD CONSTRAINT employee_role_id_fkey FOREIGN KEY (role_id) REFERENCES role (id) ON DELETE SET NULL;
+
+INSERT INTO permission (resource, action, system)
+VALUES ('employees', 'restore', true),
+       ('employees', 'purge', true),
+       ('roles', 'restore', true),
+       ('roles', 'purge', true)
+ON CONFLICT (resource, action) DO UPDATE SET system = true;
+
+INSERT INTO role_permission (role_id, permission_id)
+SELECT r.id, p.id
+FROM role r
+         CROSS JOIN permission p
+WHERE r.name = 'Администратор'
+  AND p.action IN ('restore', 'purge')
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE
+FROM permission
+WHERE (resource, action) IN (('employees', 'restore'), ('employees', 'purge'), ('roles', 'restore'), ('roles', 'purge'));
+ALTER TABLE employee
+    DROP CONSTRAINT IF EXISTS employee_role_id_fkey,
+    ADD CONSTRAINT employee_role_id_fkey FOREIGN KEY (role_id) REFERENCES role (id);
+ALTER TABLE employee
+    DROP COLUMN deleted_at;
+ALTER TABLE role
+    DROP COLUMN deleted_at;
+-- +goose StatementEnd
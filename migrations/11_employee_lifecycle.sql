@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+-- жизненный цикл сотрудника: pending (принят, но ещё не вышел) → active → suspended → terminated;
+-- роли действуют только у активных сотрудников, при увольнении все выдачи ролей снимаются
+ALTER TABLE employee
+    ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'active'
+        CONSTRAINT employee_status_check CHECK (status IN ('pending', 'active', 'suspended', 'terminated'));
+-- уже работающие сотрудники становятся активными, новые начинают с pending
+ALTER TABLE employee
+    ALTER COLUMN status SET DEFAULT 'pending';
+
+-- история переходов; from_status пуст у записи о создании сотрудника
+CREATE TABLE IF NOT EXISTS employee_status_history
+(
+    id          bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    employee_id bigint      NOT NULL REFERENCES employee (id) ON DELETE CASCADE,
+    from_status text,
+    to_status   text        NOT NULL,
+    reason      text        NOT NULL DEFAULT '',
+    actor       text        NOT NULL,
+    created_at  timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS employee_status_history_employee_idx ON employee_status_history (employee_id, created_at);
+-- +goose StatementEnd
+
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE employee_status_history;
+ALTER TABLE employee
+    DROP COLUMN status;
+-- +goose StatementEnd
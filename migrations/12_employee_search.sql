@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+-- поиск сотрудников по имени: полнотекстовый по словам и нечёткий по триграммам
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- employee_search_name приводит имя к виду для поиска: нижний регистр, ё → е.
+-- Кириллица переводится явно, чтобы результат не зависел от локали базы
+CREATE OR REPLACE FUNCTION employee_search_name(name text) RETURNS text
+    LANGUAGE sql
+    IMMUTABLE
+    PARALLEL SAFE
+AS
+$$
+SELECT lower(translate(name,
+                       'АБВГДЕЁЖЗИЙКЛМНОПРСТУФХЦЧШЩЪЫЬЭЮЯё',
+                       'абвгдеежзийклмнопрстуфхцчшщъыьэюяе'))
+$$;
+
+CREATE INDEX IF NOT EXISTS employee_name_trgm_idx ON employee USING gin (employee_search_name(name) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS employee_name_fts_idx ON employee USING gin (to_tsvector('simple', employee_search_name(name)));
+-- +goose StatementEnd
+
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS employee_name_fts_idx;
+DROP INDEX IF EXISTS employee_name_trgm_idx;
+DROP FUNCTION IF EXISTS employee_search_name(text);
+-- +goose StatementEnd
@@ -0,0 +1,50 @@
+-- +goose Up
+-- +goose StatementBegin
+-- очередь исходящей синхронизации сотрудников с внешними SCIM-системами: одна запись на пару
+-- (target, employee_id) — доставка всегда отправляет текущее состояние сотрудника;
+-- version растёт при каждом новом изменении, чтобы доставка не удалила запись, изменённую во время отправки
+CREATE TABLE IF NOT EXISTS provisioning_queue
+(
+    id              bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    target          text        NOT NULL,
+    employee_id     bigint      NOT NULL,
+    action          text        NOT NULL,
+    version         int         NOT NULL DEFAULT 1,
+    attempts        int         NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL DEFAULT now(),
+    last_error      text        NOT NULL DEFAULT '',
+    created_at      timestamptz NOT NULL DEFAULT now(),
+    UNIQUE (target, employee_id)
+);
+
+CREATE INDEX IF NOT EXISTS provisioning_queue_next_attempt_idx ON provisioning_queue (next_attempt_at);
+
+-- идентификаторы сотрудников во внешней системе и роли, переданные туда как участие в группах;
+-- без внешнего ключа: окончательно удалённого сотрудника ещё нужно удалить во внешней системе
+CREATE TABLE IF NOT EXISTS provisioning_link
+(
+    target      text        NOT NULL,
+    employee_id bigint      NOT NULL,
+    remote_id   text        NOT NULL,
+    role_ids    bigint[]    NOT NULL DEFAULT '{}',
+    updated_at  timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (target, employee_id)
+);
+
+-- идентификаторы групп во внешней системе, соответствующих ролям
+CREATE TABLE IF NOT EXISTS provisioning_group_link
+(
+    target    text   NOT NULL,
+    role_id   bigint NOT NULL,
+    remote_id text   NOT NULL,
+    PRIMARY KEY (target, role_id)
+);
+-- +goose StatementEnd
+
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE provisioning_group_link;
+DROP TABLE provisioning_link;
+DROP TABLE provisioning_queue;
+-- +goose StatementEnd
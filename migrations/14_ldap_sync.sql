@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+-- записи каталога LDAP, сопоставленные сотрудникам и ролям: external_id — неизменяемый идентификатор записи
+-- (entryUUID, objectGUID или DN), по нему переименование в каталоге не создаёт нового сотрудника
+CREATE TABLE IF NOT EXISTS ldap_link
+(
+    kind        text        NOT NULL CHECK (kind IN ('employee', 'role')),
+    external_id text        NOT NULL,
+    local_id    bigint      NOT NULL,
+    dn          text        NOT NULL,
+    updated_at  timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (kind, external_id),
+    UNIQUE (kind, local_id)
+);
+-- +goose StatementEnd
+
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE ldap_link;
+-- +goose StatementEnd
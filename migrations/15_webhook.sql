@@ -0,0 +1,57 @@
+-- +goose Up
+-- +goose StatementBegin
+-- получатели событий об изменениях сотрудников и ролей; secret хранится открыто —
+-- им подписывается каждая доставка
+CREATE TABLE IF NOT EXISTS webhook_endpoint
+(
+    id         bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    url        text        NOT NULL,
+    events     text[]      NOT NULL,
+    secret     text        NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- доставки событий получателям: создаются в транзакции изменения, отправляются фоном;
+-- status pending — ждёт отправки, delivered — получатель ответил 2xx, failed — попытки исчерпаны
+CREATE TABLE IF NOT EXISTS webhook_delivery
+(
+    id              bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    endpoint_id     bigint      NOT NULL REFERENCES webhook_endpoint (id) ON DELETE CASCADE,
+    event_id        text        NOT NULL,
+    event           text        NOT NULL,
+    payload         jsonb       NOT NULL,
+    status          text        NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'failed')),
+    attempts        int         NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL DEFAULT now(),
+    response_status int,
+    last_error      text        NOT NULL DEFAULT '',
+    delivered_at    timestamptz,
+    created_at      timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_delivery_due_idx ON webhook_delivery (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_delivery_endpoint_idx ON webhook_delivery (endpoint_id, id);
+
+INSERT INTO permission (resource, action, system)
+VALUES ('webhooks', 'read', true),
+       ('webhooks', 'write', true)
+ON CONFLICT (resource, action) DO UPDATE SET system = true;
+
+INSERT INTO role_permission (role_id, permission_id)
+SELECT r.id, p.id
+FROM role r
+         CROSS JOIN permission p
+WHERE r.name = 'Администратор'
+  AND p.resource = 'webhooks'
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE webhook_delivery;
+DROP TABLE webhook_endpoint;
+DELETE
+FROM permission
+WHERE resource = 'webhooks';
+-- +goose StatementEnd
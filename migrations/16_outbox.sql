@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+-- транзакционный outbox: события об изменениях записываются в транзакции самого изменения,
+-- ретранслятор берёт их пачками по порядку id, публикует в каждый приёмник отдельно и отмечает published_at,
+-- когда событие приняли все; dedup_key передаётся приёмникам, чтобы потребители отбрасывали повторы
+CREATE TABLE IF NOT EXISTS outbox_event
+(
+    id              bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    dedup_key       text        NOT NULL UNIQUE,
+    event           text        NOT NULL,
+    entity_type     text        NOT NULL,
+    entity_id       bigint      NOT NULL,
+    payload         jsonb       NOT NULL,
+    attempts        int         NOT NULL DEFAULT 0,
+    last_error      text        NOT NULL DEFAULT '',
+    created_at      timestamptz NOT NULL DEFAULT now(),
+    -- claimed_until до какого времени пачку публикует взявший её ретранслятор
+    claimed_until   timestamptz,
+    -- published_sinks приёмники, которые уже приняли событие; published_at — когда его приняли все
+    published_sinks text[]      NOT NULL DEFAULT '{}',
+    published_at    timestamptz,
+    -- dead_at когда событие исчерпало попытки публикации и перестало выбираться
+    dead_at         timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS outbox_event_pending_idx ON outbox_event (id) WHERE published_at IS NULL AND dead_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_event_published_idx ON outbox_event (published_at) WHERE published_at IS NOT NULL;
+-- +goose StatementEnd
+
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE outbox_event;
+-- +goose StatementEnd
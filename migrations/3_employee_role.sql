@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS employee_role
+(
+    employee_id bigint      NOT NULL REFERENCES employee (id) ON DELETE CASCADE,
+    role_id     bigint      NOT NULL REFERENCES role (id) ON DELETE CASCADE,
+    created_at  timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (employee_id, role_id)
+);
+
+CREATE INDEX IF NOT EXISTS employee_role_role_id_idx ON employee_role (role_id);
+
+-- переносим уже назначенные через employee.role_id роли в таблицу связей
+INSERT INTO employee_role (employee_id, role_id)
+SELECT id, role_id
+FROM employee
+WHERE role_id IS NOT NULL
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE employee_role;
+-- +goose StatementEnd
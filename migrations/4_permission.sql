@@ -0,0 +1,46 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS permission
+(
+    id         bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    resource   text        NOT NULL,
+    action     text        NOT NULL,
+    -- system право проверяется маршрутами самого сервиса: его нельзя переименовать или удалить
+    system     boolean     NOT NULL DEFAULT false,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now(),
+    UNIQUE (resource, action)
+);
+
+CREATE TABLE IF NOT EXISTS role_permission
+(
+    role_id       bigint      NOT NULL REFERENCES role (id) ON DELETE CASCADE,
+    permission_id bigint      NOT NULL REFERENCES permission (id) ON DELETE CASCADE,
+    created_at    timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE INDEX IF NOT EXISTS role_permission_permission_id_idx ON role_permission (permission_id);
+
+INSERT INTO permission (resource, action, system)
+VALUES ('employees', 'read', true),
+       ('employees', 'write', true),
+       ('roles', 'read', true),
+       ('roles', 'write', true),
+       ('permissions', 'read', true),
+       ('permissions', 'write', true);
+
+-- администратор получает все базовые права
+INSERT INTO role_permission (role_id, permission_id)
+SELECT r.id, p.id
+FROM role r
+         CROSS JOIN permission p
+WHERE r.name = 'Администратор';
+-- +goose StatementEnd
+
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE role_permission;
+DROP TABLE permission;
+-- +goose StatementEnd
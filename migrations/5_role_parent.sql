@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- родительские роли: роль наследует все права своих родителей (и их родителей)
+CREATE TABLE IF NOT EXISTS role_parent
+(
+    role_id    bigint      NOT NULL REFERENCES role (id) ON DELETE CASCADE,
+    parent_id  bigint      NOT NULL REFERENCES role (id) ON DELETE CASCADE,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (role_id, parent_id),
+    CHECK (role_id <> parent_id)
+);
+
+CREATE INDEX IF NOT EXISTS role_parent_parent_id_idx ON role_parent (parent_id);
+-- +goose StatementEnd
+
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE role_parent;
+-- +goose StatementEnd
@@ -0,0 +1,50 @@
+-- +goose Up
+-- +goose StatementBegin
+-- сервисные клиенты, получающие токены по client_credentials
+CREATE TABLE IF NOT EXISTS oauth_client
+(
+    id          bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    client_id   text        NOT NULL UNIQUE,
+    name        text        NOT NULL,
+    secret_hash text        NOT NULL,
+    created_at  timestamptz NOT NULL DEFAULT now(),
+    updated_at  timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS oauth_client_role
+(
+    oauth_client_id bigint      NOT NULL REFERENCES oauth_client (id) ON DELETE CASCADE,
+    role_id         bigint      NOT NULL REFERENCES role (id) ON DELETE CASCADE,
+    created_at      timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (oauth_client_id, role_id)
+);
+
+-- одноразовые коды входа сотрудников; хранится только хеш кода
+CREATE TABLE IF NOT EXISTS login_code
+(
+    code_hash   text PRIMARY KEY,
+    employee_id bigint      NOT NULL REFERENCES employee (id) ON DELETE CASCADE,
+    expires_at  timestamptz NOT NULL,
+    used_at     timestamptz,
+    created_at  timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS login_code_employee_id_idx ON login_code (employee_id);
+
+-- ключи подписи выдаваемых токенов; подписывает самый новый, старые публикуются в JWKS до истечения выданных ими токенов
+CREATE TABLE IF NOT EXISTS signing_key
+(
+    kid         text PRIMARY KEY,
+    private_key text        NOT NULL,
+    created_at  timestamptz NOT NULL DEFAULT now()
+);
+-- +goose StatementEnd
+
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE signing_key;
+DROP TABLE login_code;
+DROP TABLE oauth_client_role;
+DROP TABLE oauth_client;
+-- +goose StatementEnd
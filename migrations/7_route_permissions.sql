@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+-- права, которые требуют маршруты, появившиеся после базового набора из 4_permission.sql
+INSERT INTO permission (resource, action, system)
+VALUES ('authz', 'check', true),
+       ('clients', 'read', true),
+       ('clients', 'write', true),
+       ('login_codes', 'write', true)
+ON CONFLICT (resource, action) DO UPDATE SET system = true;
+
+-- администратор по-прежнему получает все права
+INSERT INTO role_permission (role_id, permission_id)
+SELECT r.id, p.id
+FROM role r
+         CROSS JOIN permission p
+WHERE r.name = 'Администратор'
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE
+FROM permission
+WHERE (resource, action) IN (('authz', 'check'), ('clients', 'read'), ('clients', 'write'), ('login_codes', 'write'));
+-- +goose StatementEnd
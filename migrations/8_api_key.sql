@@ -0,0 +1,50 @@
+-- +goose Up
+-- +goose StatementBegin
+-- API-ключи сервисных учётных записей; хранятся только соль и хеш секрета
+CREATE TABLE IF NOT EXISTS api_key
+(
+    id              bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    key_id          text        NOT NULL UNIQUE,
+    name            text        NOT NULL,
+    service_account text        NOT NULL,
+    salt            text        NOT NULL,
+    secret_hash     text        NOT NULL,
+    created_at      timestamptz NOT NULL DEFAULT now(),
+    last_used_at    timestamptz,
+    revoked_at      timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS api_key_service_account_idx ON api_key (service_account);
+
+-- права ключа задаются явно и не зависят от ролей
+CREATE TABLE IF NOT EXISTS api_key_permission
+(
+    api_key_id    bigint      NOT NULL REFERENCES api_key (id) ON DELETE CASCADE,
+    permission_id bigint      NOT NULL REFERENCES permission (id) ON DELETE CASCADE,
+    created_at    timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (api_key_id, permission_id)
+);
+
+INSERT INTO permission (resource, action, system)
+VALUES ('api_keys', 'read', true),
+       ('api_keys', 'write', true)
+ON CONFLICT (resource, action) DO UPDATE SET system = true;
+
+INSERT INTO role_permission (role_id, permission_id)
+SELECT r.id, p.id
+FROM role r
+         CROSS JOIN permission p
+WHERE r.name = 'Администратор'
+  AND p.resource = 'api_keys'
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE api_key_permission;
+DROP TABLE api_key;
+DELETE
+FROM permission
+WHERE resource = 'api_keys';
+-- +goose StatementEnd
@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose StatementBegin
+-- журнал изменений сотрудников, ролей и прав; before/after — состояние сущности до и после изменения
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id          bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    actor       text        NOT NULL,
+    action      text        NOT NULL,
+    entity_type text        NOT NULL,
+    entity_id   bigint      NOT NULL,
+    before      jsonb,
+    after       jsonb,
+    request_id  text        NOT NULL DEFAULT '',
+    created_at  timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON audit_log (entity_type, entity_id, created_at);
+CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON audit_log (actor, created_at);
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at);
+
+INSERT INTO permission (resource, action, system)
+VALUES ('audit', 'read', true)
+ON CONFLICT (resource, action) DO UPDATE SET system = true;
+
+INSERT INTO role_permission (role_id, permission_id)
+SELECT r.id, p.id
+FROM role r
+         CROSS JOIN permission p
+WHERE r.name = 'Администратор'
+  AND p.resource = 'audit'
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE audit_log;
+DELETE
+FROM permission
+WHERE resource = 'audit';
+-- +goose StatementEnd
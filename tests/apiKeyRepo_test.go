@@ -0,0 +1,52 @@
+package tests
+
+import (
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"idm/inner/apikey"
+	"testing"
+)
+
+func TestRepositoryApiKey(t *testing.T) {
+
+	t.Run("save api key with permissions", func(t *testing.T) {
+		fixture := NewFixture()
+
+		tx, err := fixture.ApiKeyRepo.BeginTransaction()
+		assert.NoError(t, err)
+		ids, err := fixture.ApiKeyRepo.FindPermissionIdsByNamesTx(tx, []string{"employees:read", "roles:read", "unknown:read"})
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{1, 3}, ids)
+		saved, err := fixture.ApiKeyRepo.SaveTx(tx, apikey.Entity{KeyId: "abc", Name: "HR", ServiceAccount: "hr-sync", Salt: "salt", SecretHash: "hash"})
+		assert.NoError(t, err)
+		assert.NoError(t, fixture.ApiKeyRepo.GrantPermissionsTx(tx, saved.Id, ids))
+		assert.NoError(t, tx.Commit())
+
+		found, err := fixture.ApiKeyRepo.FindByKeyId("abc")
+		assert.NoError(t, err)
+		assert.Equal(t, "hr-sync", found.ServiceAccount)
+		assert.Equal(t, []string{"employees:read", "roles:read"}, []string(found.Permissions))
+		assert.Nil(t, found.LastUsedAt)
+	})
+
+	t.Run("touch and revoke api key", func(t *testing.T) {
+		fixture := NewFixture()
+
+		tx, err := fixture.ApiKeyRepo.BeginTransaction()
+		assert.NoError(t, err)
+		saved, err := fixture.ApiKeyRepo.SaveTx(tx, apikey.Entity{KeyId: "abc", Name: "HR", ServiceAccount: "hr-sync", Salt: "salt", SecretHash: "hash"})
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Commit())
+
+		assert.NoError(t, fixture.ApiKeyRepo.TouchLastUsed(saved.Id))
+		assert.NoError(t, fixture.ApiKeyRepo.Revoke(saved.Id))
+		assert.ErrorIs(t, fixture.ApiKeyRepo.Revoke(saved.Id+1), sql.ErrNoRows)
+
+		all, err := fixture.ApiKeyRepo.FindAll()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(all))
+		assert.NotNil(t, all[0].LastUsedAt)
+		assert.NotNil(t, all[0].RevokedAt)
+		assert.Empty(t, all[0].Permissions)
+	})
+}
@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"idm/inner/audit"
+	"testing"
+	"time"
+)
+
+func TestRepositoryAudit(t *testing.T) {
+
+	t.Run("save and find audit records", func(t *testing.T) {
+		fixture := NewFixture()
+		before := json.RawMessage(`{"name": "Иванов Петр"}`)
+		after := json.RawMessage(`{"name": "Иванов Пётр"}`)
+
+		tx, err := fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		assert.NoError(t, fixture.AuditRepo.SaveTx(tx, audit.Entity{
+			Actor: "42", Action: audit.ActionUpdate, EntityType: audit.EntityEmployee, EntityId: 1,
+			Before: &before, After: &after, RequestId: "request-1",
+		}))
+		assert.NoError(t, fixture.AuditRepo.SaveTx(tx, audit.Entity{
+			Actor: "apikey:abc", Action: audit.ActionCreate, EntityType: audit.EntityRole, EntityId: 4, After: &after,
+		}))
+		assert.NoError(t, tx.Commit())
+
+		found, err := fixture.AuditRepo.Find(audit.Filter{EntityType: audit.EntityEmployee, EntityId: 1, Limit: 10})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(found))
+		assert.Equal(t, "42", found[0].Actor)
+		assert.Equal(t, "request-1", found[0].RequestId)
+		assert.JSONEq(t, string(before), string(*found[0].Before))
+
+		found, err = fixture.AuditRepo.Find(audit.Filter{Actor: "apikey:abc", Limit: 10})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(found))
+		assert.Nil(t, found[0].Before)
+
+		future := time.Now().Add(time.Hour)
+		found, err = fixture.AuditRepo.Find(audit.Filter{From: &future, Limit: 10})
+		assert.NoError(t, err)
+		assert.Empty(t, found)
+
+		found, err = fixture.AuditRepo.Find(audit.Filter{Limit: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(4), found[0].EntityId)
+	})
+
+	t.Run("rolled back change leaves no audit record", func(t *testing.T) {
+		fixture := NewFixture()
+
+		tx, err := fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		assert.NoError(t, fixture.AuditRepo.SaveTx(tx, audit.Entity{
+			Actor: "42", Action: audit.ActionDelete, EntityType: audit.EntityEmployee, EntityId: 1,
+		}))
+		assert.NoError(t, tx.Rollback())
+
+		found, err := fixture.AuditRepo.Find(audit.Filter{Limit: 10})
+		assert.NoError(t, err)
+		assert.Empty(t, found)
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"idm/inner/common"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestGetConfig(t *testing.T) {
@@ -43,6 +44,7 @@ func TestGetConfig(t *testing.T) {
 		t.Setenv("DB_DSN", "dsn")
 		t.Setenv("APP_NAME", "idm")
 		t.Setenv("APP_VERSION", "0.0.0")
+		setJwtEnv(t)
 
 		correctCfg := common.GetConfig("test.env")
 
@@ -62,6 +64,7 @@ func TestGetConfig(t *testing.T) {
 		t.Setenv("DB_DSN", "host=127.0.0.1 port=5432 user=postgres password=postgres dbname=postgres sslmode=disable")
 		t.Setenv("APP_NAME", "idm")
 		t.Setenv("APP_VERSION", "0.0.0")
+		setJwtEnv(t)
 
 		cfg := common.GetConfig("test.env")
 
@@ -73,11 +76,17 @@ func TestGetConfig(t *testing.T) {
 	t.Run(".env file exists and required vars no conflicting with env vars", func(t *testing.T) {
 		t.Setenv("DB_DRIVER_NAME", "postgres")
 		t.Setenv("DB_DSN", "host=127.0.0.1 port=5432 user=postgres password=postgres dbname=postgres sslmode=disable")
+		setJwtEnv(t)
 		expectedCfg := common.Config{
 			DbDriverName: "postgres",
 			Dsn:          "host=127.0.0.1 port=5432 user=postgres password=postgres dbname=postgres sslmode=disable",
 			AppName:      "idm",
 			AppVersion:   "0.0.0",
+			JwtAlgorithm: "HS256",
+			JwtSecret:    "tests-secret-tests-secret-tests-secret",
+			JwtIssuer:    "idm",
+			JwtAudience:  "idm-api",
+			JwtClockSkew: 30 * time.Second,
 		}
 
 		actualCfg := common.GetConfig(".env")
@@ -85,3 +94,82 @@ func TestGetConfig(t *testing.T) {
 		assert.Equal(t, expectedCfg, actualCfg)
 	})
 }
+
+// setJwtEnv минимальная конфигурация аутентификации, без которой GetConfig не проходит валидацию
+func setJwtEnv(t *testing.T) {
+	t.Setenv("JWT_ALGORITHM", "HS256")
+	t.Setenv("JWT_SECRET", "tests-secret-tests-secret-tests-secret")
+	t.Setenv("JWT_ISSUER", "idm")
+	t.Setenv("JWT_AUDIENCE", "idm-api")
+	t.Setenv("JWT_CLOCK_SKEW", "30s")
+}
+
+func TestGetConfigJwt(t *testing.T) {
+	t.Setenv("DB_DRIVER_NAME", "postgres")
+	t.Setenv("DB_DSN", "dsn")
+	t.Setenv("APP_NAME", "idm")
+	t.Setenv("APP_VERSION", "0.0.0")
+
+	t.Run("jwt settings are required", func(t *testing.T) {
+		t.Setenv("JWT_ALGORITHM", "")
+
+		assert.Panics(t, func() { common.GetConfig("test.env") })
+	})
+
+	t.Run("rs256 without key file accepts only issued tokens", func(t *testing.T) {
+		setJwtEnv(t)
+		t.Setenv("JWT_ALGORITHM", "RS256")
+		t.Setenv("JWT_KEY_FILE", "")
+
+		assert.NotPanics(t, func() { common.GetConfig("test.env") })
+	})
+
+	t.Run("token ttl and key rotation", func(t *testing.T) {
+		setJwtEnv(t)
+		t.Setenv("JWT_TOKEN_TTL", "10m")
+		t.Setenv("JWT_KEY_ROTATION", "720h")
+
+		cfg := common.GetConfig("test.env")
+
+		assert.Equal(t, 10*time.Minute, cfg.JwtTokenTtl)
+		assert.Equal(t, 720*time.Hour, cfg.JwtKeyRotation)
+	})
+
+	t.Run("invalid clock skew", func(t *testing.T) {
+		setJwtEnv(t)
+		t.Setenv("JWT_CLOCK_SKEW", "soon")
+
+		assert.Panics(t, func() { common.GetConfig("test.env") })
+	})
+}
+
+func TestGetConfigInternal(t *testing.T) {
+	t.Setenv("DB_DRIVER_NAME", "postgres")
+	t.Setenv("DB_DSN", "dsn")
+	t.Setenv("APP_NAME", "idm")
+	t.Setenv("APP_VERSION", "0.0.0")
+	setJwtEnv(t)
+
+	t.Run("internal address, secret and allowed ips", func(t *testing.T) {
+		t.Setenv("INTERNAL_ADDRESS", "127.0.0.1:8081")
+		t.Setenv("INTERNAL_SECRET", "internal-secret-internal-secret-00")
+		t.Setenv("INTERNAL_ALLOWED_IPS", "10.0.0.0/8, 127.0.0.1")
+
+		cfg := common.GetConfig("test.env")
+
+		assert.Equal(t, "127.0.0.1:8081", cfg.InternalAddress)
+		assert.Equal(t, []string{"10.0.0.0/8", "127.0.0.1"}, cfg.InternalAllowedIps)
+	})
+
+	t.Run("invalid allowed ip", func(t *testing.T) {
+		t.Setenv("INTERNAL_ALLOWED_IPS", "10.0.0.0/8,localhost")
+
+		assert.Panics(t, func() { common.GetConfig("test.env") })
+	})
+
+	t.Run("short internal secret", func(t *testing.T) {
+		t.Setenv("INTERNAL_SECRET", "short")
+
+		assert.Panics(t, func() { common.GetConfig("test.env") })
+	})
+}
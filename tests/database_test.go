@@ -32,6 +32,7 @@ func TestConnectionDb(t *testing.T) {
 	t.Run("successful connection to db with correct configs", func(t *testing.T) {
 		t.Setenv("DB_DRIVER_NAME", "postgres")
 		t.Setenv("DB_DSN", "host=127.0.0.1 port=5432 user=postgres password=postgres dbname=postgres sslmode=disable")
+		setJwtEnv(t)
 
 		var user string
 		db, err := database.ConnectDb()
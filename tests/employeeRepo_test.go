@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"database/sql"
 	"github.com/stretchr/testify/assert"
 	"idm/inner/employee"
 	"testing"
@@ -75,6 +76,27 @@ func TestRepositoryEmployee(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, "Иванов Петр", result.Name)
 		assert.Equal(t, int64(1), result.Id)
+		assert.Equal(t, "Администратор", *result.RoleName)
+	})
+
+	t.Run("change and revoke employee role", func(t *testing.T) {
+		fixture := NewFixture()
+		roleId := int64(3)
+
+		tx, err := fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		exists, err := fixture.EmployeesRepo.ExistsRoleByIdTx(tx, roleId)
+		assert.NoError(t, err)
+		assert.True(t, exists)
+		changed, err := fixture.EmployeesRepo.UpdateRoleTx(tx, 1, &roleId)
+		assert.NoError(t, err)
+		revoked, err := fixture.EmployeesRepo.UpdateRoleTx(tx, 2, nil)
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Commit())
+
+		assert.Equal(t, "Разработчик", *changed.RoleName)
+		assert.Nil(t, revoked.RoleID)
+		assert.Nil(t, revoked.RoleName)
 	})
 
 	t.Run("find all employee", func(t *testing.T) {
@@ -115,4 +137,75 @@ func TestRepositoryEmployee(t *testing.T) {
 		assert.NoError(t, errDelete)
 		assert.Error(t, errFind)
 	})
+
+	t.Run("update employee", func(t *testing.T) {
+		fixture := NewFixture()
+		roleId := int64(2)
+
+		tx, err := fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		updated, err := fixture.EmployeesRepo.UpdateTx(tx, employee.Entity{Id: 1, Name: "Иванов Пётр", RoleID: &roleId})
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Commit())
+
+		result, _ := fixture.EmployeesRepo.FindById(1)
+		assert.Equal(t, "Иванов Пётр", updated.Name)
+		assert.Equal(t, "Иванов Пётр", result.Name)
+		assert.Equal(t, roleId, *result.RoleID)
+	})
+
+	t.Run("delete missing employee", func(t *testing.T) {
+		fixture := NewFixture()
+
+		err := fixture.EmployeesRepo.Delete(100)
+
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("grant, list and revoke employee roles", func(t *testing.T) {
+		fixture := NewFixture()
+
+		tx, err := fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		isGranted, err := fixture.EmployeesRepo.GrantRoleTx(tx, 1, 3)
+		assert.NoError(t, err)
+		assert.True(t, isGranted)
+		// повторная выдача той же роли не должна приводить к ошибке
+		isGranted, err = fixture.EmployeesRepo.GrantRoleTx(tx, 1, 3)
+		assert.NoError(t, err)
+		assert.False(t, isGranted)
+		assert.NoError(t, tx.Commit())
+
+		roles, err := fixture.EmployeesRepo.FindRolesByEmployeeId(1)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(roles))
+		assert.Equal(t, "Администратор", roles[0].Name)
+		assert.Equal(t, "Разработчик", roles[1].Name)
+
+		tx, err = fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		revoked, err := fixture.EmployeesRepo.RevokeRoleTx(tx, 1, 1)
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+		revoked, err = fixture.EmployeesRepo.RevokeRoleTx(tx, 1, 2)
+		assert.NoError(t, err)
+		assert.False(t, revoked)
+		assert.NoError(t, tx.Commit())
+
+		// отозванная роль была основной, поэтому employee.role_id очищен
+		result, _ := fixture.EmployeesRepo.FindById(1)
+		assert.Nil(t, result.RoleID)
+	})
+
+	t.Run("save employee grants role", func(t *testing.T) {
+		fixture := NewFixture()
+
+		id, err := fixture.EmployeesRepo.Save(employee.Entity{Name: "Test user"}, "Менеджер")
+		assert.NoError(t, err)
+
+		roles, err := fixture.EmployeesRepo.FindRolesByEmployeeId(id)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(roles))
+		assert.Equal(t, "Менеджер", roles[0].Name)
+	})
 }
@@ -0,0 +1,45 @@
+package tests
+
+import (
+	"github.com/stretchr/testify/assert"
+	"idm/inner/common"
+	"idm/inner/employee"
+	"testing"
+)
+
+func TestEmployeeExport(t *testing.T) {
+
+	t.Run("export streams employees with all granted roles", func(t *testing.T) {
+		fixture := NewFixture()
+		tx, err := fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		_, err = fixture.EmployeesRepo.GrantRoleTx(tx, 2, 1)
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Commit())
+
+		var exported []employee.ExportEntity
+		err = fixture.EmployeesRepo.Export(employee.Filter{Sort: common.Sort{Field: "id"}}, func(entity employee.ExportEntity) error {
+			exported = append(exported, entity)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 4, len(exported))
+		assert.Equal(t, "Сидорова Анна", exported[1].Name)
+		assert.Equal(t, "Менеджер", *exported[1].RoleName)
+		assert.Equal(t, []string{"Администратор", "Менеджер"}, []string(exported[1].Roles))
+	})
+
+	t.Run("export applies list filters", func(t *testing.T) {
+		fixture := NewFixture()
+		assert.NoError(t, fixture.EmployeesRepo.Delete(4))
+
+		var names []string
+		filter := employee.Filter{RoleId: 3, Sort: common.Sort{Field: "name"}}
+		err := fixture.EmployeesRepo.Export(filter, func(entity employee.ExportEntity) error {
+			names = append(names, entity.Name)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Петров Алексей"}, names)
+	})
+}
@@ -3,26 +3,38 @@ package tests
 import (
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
+	"idm/inner/apikey"
+	"idm/inner/audit"
 	"idm/inner/database"
 	"idm/inner/employee"
+	"idm/inner/permission"
 	"idm/inner/role"
+	"idm/inner/token"
 	"log"
 	"os"
 )
 
 type Fixture struct {
-	DB            *sqlx.DB
-	EmployeesRepo *employee.Repository
-	RoleRepo      *role.Repository
+	DB             *sqlx.DB
+	EmployeesRepo  *employee.Repository
+	RoleRepo       *role.Repository
+	PermissionRepo *permission.Repository
+	TokenRepo      *token.Repository
+	ApiKeyRepo     *apikey.Repository
+	AuditRepo      *audit.Repository
 }
 
 func NewFixture() *Fixture {
 	db := SetupDB()
 
 	return &Fixture{
-		DB:            db,
-		EmployeesRepo: employee.NewEmployeeRepository(db),
-		RoleRepo:      role.NewRoleRepository(db),
+		DB:             db,
+		EmployeesRepo:  employee.NewEmployeeRepository(db),
+		RoleRepo:       role.NewRoleRepository(db),
+		PermissionRepo: permission.NewPermissionRepository(db),
+		TokenRepo:      token.NewTokenRepository(db),
+		ApiKeyRepo:     apikey.NewApiKeyRepository(db),
+		AuditRepo:      audit.NewAuditRepository(db),
 	}
 }
 
@@ -38,7 +50,7 @@ func SetupDB() *sqlx.DB {
 }
 
 func resetDB(db *sqlx.DB) {
-	_, err := db.Exec("DROP TABLE IF EXISTS employee, role CASCADE")
+	_, err := db.Exec("DROP TABLE IF EXISTS outbox_event, webhook_delivery, webhook_endpoint, ldap_link, provisioning_group_link, provisioning_link, provisioning_queue, audit_log, api_key_permission, api_key, signing_key, login_code, oauth_client_role, oauth_client, role_permission, permission, role_parent, employee_role, employee_status_history, employee, role CASCADE")
 	if err != nil {
 		log.Fatalln("Failed to drop tables:", err)
 	}
@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"github.com/stretchr/testify/assert"
+	"idm/inner/audit"
+	"idm/inner/employee"
+	"idm/inner/importer"
+	"idm/inner/role"
+	"idm/inner/validator"
+	"strings"
+	"testing"
+)
+
+func newImportService(fixture *Fixture) *importer.Service {
+	validate := validator.New()
+	auditService := audit.NewService(fixture.AuditRepo, validate)
+	employeeService := employee.NewService(fixture.EmployeesRepo, fixture.RoleRepo, validate, auditService, 0)
+	roleService := role.NewService(fixture.RoleRepo, validate, auditService, 0)
+	return importer.NewService(importer.NewImportRepository(fixture.DB), employeeService, roleService, validate)
+}
+
+func TestImport(t *testing.T) {
+	var actor = audit.Actor{Subject: "import-test"}
+	var input = "kind,name,role,status\n" +
+		"role,Аналитик,,\n" +
+		"employee,Смирнов Олег,Аналитик,pending\n" +
+		"employee,Иванов Петр,Менеджер,\n" +
+		"employee,Орлова Вера,Нет такой роли,\n"
+
+	t.Run("atomic import rolls back everything on failure", func(t *testing.T) {
+		fixture := NewFixture()
+
+		report, err := newImportService(fixture).Import(actor, importer.Request{Format: importer.FormatCsv}, strings.NewReader(input))
+		assert.NoError(t, err)
+		assert.False(t, report.Committed)
+		assert.Equal(t, 2, report.Created)
+		assert.Equal(t, 1, report.Skipped)
+		assert.Equal(t, 1, report.Failed)
+
+		found, err := fixture.EmployeesRepo.Search("смирнов", 10)
+		assert.NoError(t, err)
+		assert.Empty(t, found)
+	})
+
+	t.Run("partial import keeps valid rows and role created in the same import", func(t *testing.T) {
+		fixture := NewFixture()
+
+		request := importer.Request{Format: importer.FormatCsv, Mode: importer.ModePartial}
+		report, err := newImportService(fixture).Import(actor, request, strings.NewReader(input))
+		assert.NoError(t, err)
+		assert.True(t, report.Committed)
+
+		created, err := fixture.EmployeesRepo.FindById(report.Rows[1].Id)
+		assert.NoError(t, err)
+		assert.Equal(t, "Смирнов Олег", created.Name)
+		assert.Equal(t, employee.StatusPending, created.Status)
+		assert.Equal(t, "Аналитик", *created.RoleName)
+
+		var records int
+		assert.NoError(t, fixture.DB.Get(&records, "select count(*) from audit_log where actor = $1", actor.Subject))
+		assert.Greater(t, records, 0)
+	})
+
+	t.Run("dry run saves nothing", func(t *testing.T) {
+		fixture := NewFixture()
+
+		request := importer.Request{Format: importer.FormatJsonl, DryRun: true}
+		report, err := newImportService(fixture).Import(actor, request, strings.NewReader(`{"kind":"role","name":"Аналитик"}`))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, report.Created)
+		assert.False(t, report.Committed)
+
+		var count int
+		assert.NoError(t, fixture.DB.Get(&count, "select count(*) from role where name = 'Аналитик'"))
+		assert.Equal(t, 0, count)
+	})
+}
@@ -3,16 +3,55 @@ CREATE TABLE IF NOT EXISTS role
     id         bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
     name       text        NOT NULL,
     created_at timestamptz NOT NULL DEFAULT now(),
-    updated_at timestamptz NOT NULL DEFAULT now()
+    updated_at timestamptz NOT NULL DEFAULT now(),
+    deleted_at timestamptz
 );
 
 CREATE TABLE IF NOT EXISTS employee
 (
     id         bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
     name       text        NOT NULL,
-    role_id bigint REFERENCES role (id) ON DELETE CASCADE,
+    role_id    bigint REFERENCES role (id) ON DELETE SET NULL,
+    status     text        NOT NULL DEFAULT 'pending'
+        CONSTRAINT employee_status_check CHECK (status IN ('pending', 'active', 'suspended', 'terminated')),
     created_at timestamptz NOT NULL DEFAULT now(),
-    updated_at timestamptz NOT NULL DEFAULT now()
+    updated_at timestamptz NOT NULL DEFAULT now(),
+    deleted_at timestamptz
+);
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE OR REPLACE FUNCTION employee_search_name(name text) RETURNS text
+    LANGUAGE sql
+    IMMUTABLE
+    PARALLEL SAFE
+AS
+$$
+SELECT lower(translate(name,
+                       'АБВГДЕЁЖЗИЙКЛМНОПРСТУФХЦЧШЩЪЫЬЭЮЯё',
+                       'абвгдеежзийклмнопрстуфхцчшщъыьэюяе'))
+$$;
+
+CREATE INDEX IF NOT EXISTS employee_name_trgm_idx ON employee USING gin (employee_search_name(name) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS employee_name_fts_idx ON employee USING gin (to_tsvector('simple', employee_search_name(name)));
+
+CREATE TABLE IF NOT EXISTS employee_status_history
+(
+    id          bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    employee_id bigint      NOT NULL REFERENCES employee (id) ON DELETE CASCADE,
+    from_status text,
+    to_status   text        NOT NULL,
+    reason      text        NOT NULL DEFAULT '',
+    actor       text        NOT NULL,
+    created_at  timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS employee_role
+(
+    employee_id bigint      NOT NULL REFERENCES employee (id) ON DELETE CASCADE,
+    role_id     bigint      NOT NULL REFERENCES role (id) ON DELETE CASCADE,
+    created_at  timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (employee_id, role_id)
 );
 
 INSERT INTO role (name)
@@ -20,8 +59,212 @@ VALUES ('Администратор'),
        ('Менеджер'),
        ('Разработчик');
 
-INSERT INTO employee (name, role_id)
-VALUES ('Иванов Петр', 1),
-       ('Сидорова Анна', 2),
-       ('Петров Алексей', 3),
-       ('Козлова Елена', 3)
+INSERT INTO employee (name, role_id, status)
+VALUES ('Иванов Петр', 1, 'active'),
+       ('Сидорова Анна', 2, 'active'),
+       ('Петров Алексей', 3, 'active'),
+       ('Козлова Елена', 3, 'active');
+
+INSERT INTO employee_role (employee_id, role_id)
+SELECT id, role_id
+FROM employee
+WHERE role_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS role_parent
+(
+    role_id    bigint      NOT NULL REFERENCES role (id) ON DELETE CASCADE,
+    parent_id  bigint      NOT NULL REFERENCES role (id) ON DELETE CASCADE,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (role_id, parent_id),
+    CHECK (role_id <> parent_id)
+);
+
+CREATE TABLE IF NOT EXISTS permission
+(
+    id         bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    resource   text        NOT NULL,
+    action     text        NOT NULL,
+    system     boolean     NOT NULL DEFAULT false,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now(),
+    UNIQUE (resource, action)
+);
+
+CREATE TABLE IF NOT EXISTS role_permission
+(
+    role_id       bigint      NOT NULL REFERENCES role (id) ON DELETE CASCADE,
+    permission_id bigint      NOT NULL REFERENCES permission (id) ON DELETE CASCADE,
+    created_at    timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (role_id, permission_id)
+);
+
+INSERT INTO permission (resource, action, system)
+VALUES ('employees', 'read', true),
+       ('employees', 'write', true),
+       ('roles', 'read', true),
+       ('roles', 'write', true);
+
+INSERT INTO role_permission (role_id, permission_id)
+VALUES (1, 1),
+       (1, 2),
+       (1, 3),
+       (1, 4),
+       (2, 1),
+       (3, 1),
+       (3, 3);
+
+CREATE TABLE IF NOT EXISTS oauth_client
+(
+    id          bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    client_id   text        NOT NULL UNIQUE,
+    name        text        NOT NULL,
+    secret_hash text        NOT NULL,
+    created_at  timestamptz NOT NULL DEFAULT now(),
+    updated_at  timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS oauth_client_role
+(
+    oauth_client_id bigint      NOT NULL REFERENCES oauth_client (id) ON DELETE CASCADE,
+    role_id         bigint      NOT NULL REFERENCES role (id) ON DELETE CASCADE,
+    created_at      timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (oauth_client_id, role_id)
+);
+
+CREATE TABLE IF NOT EXISTS login_code
+(
+    code_hash   text PRIMARY KEY,
+    employee_id bigint      NOT NULL REFERENCES employee (id) ON DELETE CASCADE,
+    expires_at  timestamptz NOT NULL,
+    used_at     timestamptz,
+    created_at  timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS signing_key
+(
+    kid         text PRIMARY KEY,
+    private_key text        NOT NULL,
+    created_at  timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS api_key
+(
+    id              bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    key_id          text        NOT NULL UNIQUE,
+    name            text        NOT NULL,
+    service_account text        NOT NULL,
+    salt            text        NOT NULL,
+    secret_hash     text        NOT NULL,
+    created_at      timestamptz NOT NULL DEFAULT now(),
+    last_used_at    timestamptz,
+    revoked_at      timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS api_key_permission
+(
+    api_key_id    bigint      NOT NULL REFERENCES api_key (id) ON DELETE CASCADE,
+    permission_id bigint      NOT NULL REFERENCES permission (id) ON DELETE CASCADE,
+    created_at    timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (api_key_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id          bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    actor       text        NOT NULL,
+    action      text        NOT NULL,
+    entity_type text        NOT NULL,
+    entity_id   bigint      NOT NULL,
+    before      jsonb,
+    after       jsonb,
+    request_id  text        NOT NULL DEFAULT '',
+    created_at  timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS provisioning_queue
+(
+    id              bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    target          text        NOT NULL,
+    employee_id     bigint      NOT NULL,
+    action          text        NOT NULL,
+    version         int         NOT NULL DEFAULT 1,
+    attempts        int         NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL DEFAULT now(),
+    last_error      text        NOT NULL DEFAULT '',
+    created_at      timestamptz NOT NULL DEFAULT now(),
+    UNIQUE (target, employee_id)
+);
+
+CREATE TABLE IF NOT EXISTS provisioning_link
+(
+    target      text        NOT NULL,
+    employee_id bigint      NOT NULL,
+    remote_id   text        NOT NULL,
+    role_ids    bigint[]    NOT NULL DEFAULT '{}',
+    updated_at  timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (target, employee_id)
+);
+
+CREATE TABLE IF NOT EXISTS provisioning_group_link
+(
+    target    text   NOT NULL,
+    role_id   bigint NOT NULL,
+    remote_id text   NOT NULL,
+    PRIMARY KEY (target, role_id)
+);
+
+CREATE TABLE IF NOT EXISTS ldap_link
+(
+    kind        text        NOT NULL CHECK (kind IN ('employee', 'role')),
+    external_id text        NOT NULL,
+    local_id    bigint      NOT NULL,
+    dn          text        NOT NULL,
+    updated_at  timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (kind, external_id),
+    UNIQUE (kind, local_id)
+);
+
+CREATE TABLE IF NOT EXISTS webhook_endpoint
+(
+    id         bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    url        text        NOT NULL,
+    events     text[]      NOT NULL,
+    secret     text        NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS webhook_delivery
+(
+    id              bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    endpoint_id     bigint      NOT NULL REFERENCES webhook_endpoint (id) ON DELETE CASCADE,
+    event_id        text        NOT NULL,
+    event           text        NOT NULL,
+    payload         jsonb       NOT NULL,
+    status          text        NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'failed')),
+    attempts        int         NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL DEFAULT now(),
+    response_status int,
+    last_error      text        NOT NULL DEFAULT '',
+    delivered_at    timestamptz,
+    created_at      timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS outbox_event
+(
+    id              bigint PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    dedup_key       text        NOT NULL UNIQUE,
+    event           text        NOT NULL,
+    entity_type     text        NOT NULL,
+    entity_id       bigint      NOT NULL,
+    payload         jsonb       NOT NULL,
+    attempts        int         NOT NULL DEFAULT 0,
+    last_error      text        NOT NULL DEFAULT '',
+    created_at      timestamptz NOT NULL DEFAULT now(),
+    -- claimed_until до какого времени пачку публикует взявший её ретранслятор
+    claimed_until   timestamptz,
+    -- published_sinks приёмники, которые уже приняли событие; published_at — когда его приняли все
+    published_sinks text[]      NOT NULL DEFAULT '{}',
+    published_at    timestamptz,
+    -- dead_at когда событие исчерпало попытки публикации и перестало выбираться
+    dead_at         timestamptz
+);
@@ -0,0 +1,42 @@
+package tests
+
+import (
+	"github.com/stretchr/testify/assert"
+	"idm/inner/ldapsync"
+	"testing"
+)
+
+func TestLdapSyncRepository(t *testing.T) {
+
+	t.Run("link moves to new directory entry of the same employee", func(t *testing.T) {
+		fixture := NewFixture()
+		repo := ldapsync.NewLdapSyncRepository(fixture.DB)
+		assert.NoError(t, repo.SaveLink(ldapsync.LinkEntity{Kind: ldapsync.KindEmployee, ExternalId: "u-old", LocalId: 1, Dn: "uid=old"}))
+		assert.NoError(t, repo.SaveLink(ldapsync.LinkEntity{Kind: ldapsync.KindRole, ExternalId: "u-old", LocalId: 1, Dn: "cn=admins"}))
+
+		assert.NoError(t, repo.SaveLink(ldapsync.LinkEntity{Kind: ldapsync.KindEmployee, ExternalId: "u-new", LocalId: 1, Dn: "uid=new"}))
+
+		links, err := repo.FindLinks()
+		assert.NoError(t, err)
+		assert.Equal(t, []ldapsync.LinkEntity{
+			{Kind: ldapsync.KindEmployee, ExternalId: "u-new", LocalId: 1, Dn: "uid=new"},
+			{Kind: ldapsync.KindRole, ExternalId: "u-old", LocalId: 1, Dn: "cn=admins"},
+		}, links)
+	})
+
+	t.Run("employees include deleted with granted roles", func(t *testing.T) {
+		fixture := NewFixture()
+		repo := ldapsync.NewLdapSyncRepository(fixture.DB)
+		assert.NoError(t, fixture.EmployeesRepo.Delete(2))
+
+		employees, err := repo.FindEmployees()
+		assert.NoError(t, err)
+		assert.Equal(t, 4, len(employees))
+		assert.NotNil(t, employees[1].DeletedAt)
+		assert.Equal(t, []int64{2}, []int64(employees[1].RoleIds))
+
+		roles, err := repo.FindRoles()
+		assert.NoError(t, err)
+		assert.Equal(t, 3, len(roles))
+	})
+}
@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"github.com/stretchr/testify/assert"
+	"idm/inner/employee"
+	"testing"
+)
+
+func TestEmployeeLifecycle(t *testing.T) {
+
+	t.Run("roles are effective only for active employees", func(t *testing.T) {
+		fixture := NewFixture()
+
+		tx, err := fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		suspended, err := fixture.EmployeesRepo.UpdateStatusTx(tx, 2, employee.StatusSuspended)
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Commit())
+		assert.Equal(t, employee.StatusSuspended, suspended.Status)
+		assert.Equal(t, "Менеджер", *suspended.RoleName)
+
+		roles, err := fixture.EmployeesRepo.FindEffectiveRolesByEmployeeId(2)
+		assert.NoError(t, err)
+		assert.Empty(t, roles)
+		assigned, err := fixture.EmployeesRepo.FindRolesByEmployeeId(2)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(assigned))
+		assert.Equal(t, "Менеджер", assigned[0].Name)
+		permissions, err := fixture.PermissionRepo.FindAllByEmployeeId(2)
+		assert.NoError(t, err)
+		assert.Empty(t, permissions)
+	})
+
+	t.Run("revoke all roles clears primary role", func(t *testing.T) {
+		fixture := NewFixture()
+
+		tx, err := fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		_, err = fixture.EmployeesRepo.GrantRoleTx(tx, 1, 2)
+		assert.NoError(t, err)
+		roleIds, err := fixture.EmployeesRepo.RevokeAllRolesTx(tx, 1)
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Commit())
+
+		assert.ElementsMatch(t, []int64{1, 2}, roleIds)
+		terminated, err := fixture.EmployeesRepo.FindById(1)
+		assert.NoError(t, err)
+		assert.Nil(t, terminated.RoleID)
+	})
+
+	t.Run("status history is ordered", func(t *testing.T) {
+		fixture := NewFixture()
+		active := employee.StatusActive
+
+		tx, err := fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		assert.NoError(t, fixture.EmployeesRepo.SaveStatusHistoryTx(tx, employee.StatusHistoryEntity{
+			EmployeeId: 3, ToStatus: employee.StatusActive, Actor: "1",
+		}))
+		assert.NoError(t, fixture.EmployeesRepo.SaveStatusHistoryTx(tx, employee.StatusHistoryEntity{
+			EmployeeId: 3, FromStatus: &active, ToStatus: employee.StatusSuspended, Reason: "on leave", Actor: "1",
+		}))
+		assert.NoError(t, tx.Commit())
+
+		history, err := fixture.EmployeesRepo.FindStatusHistory(3)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(history))
+		assert.Nil(t, history[0].FromStatus)
+		assert.Equal(t, employee.StatusSuspended, history[1].ToStatus)
+		assert.Equal(t, "on leave", history[1].Reason)
+	})
+
+	t.Run("unknown status is rejected by database", func(t *testing.T) {
+		fixture := NewFixture()
+
+		tx, err := fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		_, err = fixture.EmployeesRepo.UpdateStatusTx(tx, 1, "retired")
+		assert.Error(t, err)
+		assert.NoError(t, tx.Rollback())
+	})
+}
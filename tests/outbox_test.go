@@ -0,0 +1,226 @@
+package tests
+
+import (
+	"github.com/stretchr/testify/assert"
+	"idm/inner/outbox"
+	"idm/inner/webhook"
+	"testing"
+	"time"
+)
+
+func outboxEvent(key string) outbox.EventEntity {
+	return outbox.EventEntity{DedupKey: key, Event: webhook.EventEmployeeCreated, EntityType: "employee", EntityId: 1,
+		Payload: []byte(`{"id":"` + key + `"}`)}
+}
+
+func TestOutboxRepository(t *testing.T) {
+
+	t.Run("events of committed changes are pending in order", func(t *testing.T) {
+		fixture := NewFixture()
+		repo := outbox.NewOutboxRepository(fixture.DB)
+		tx, err := repo.BeginTransaction()
+		assert.NoError(t, err)
+		assert.NoError(t, repo.SaveTx(tx, outboxEvent("a")))
+		assert.NoError(t, repo.SaveTx(tx, outboxEvent("b")))
+		assert.NoError(t, tx.Commit())
+		tx, err = repo.BeginTransaction()
+		assert.NoError(t, err)
+		assert.NoError(t, repo.SaveTx(tx, outboxEvent("c")))
+		assert.NoError(t, tx.Rollback())
+
+		tx, err = repo.BeginTransaction()
+		assert.NoError(t, err)
+		defer func() { _ = tx.Rollback() }()
+		items, err := repo.ClaimTx(tx, []string{"crm"}, 10, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(items))
+		assert.Equal(t, "a", items[0].DedupKey)
+		assert.Equal(t, "b", items[1].DedupKey)
+		assert.JSONEq(t, `{"id":"a"}`, string(items[0].Payload))
+	})
+
+	t.Run("claimed batch blocks the next claim until it is released", func(t *testing.T) {
+		fixture := NewFixture()
+		repo := outbox.NewOutboxRepository(fixture.DB)
+		tx, err := repo.BeginTransaction()
+		assert.NoError(t, err)
+		assert.NoError(t, repo.SaveTx(tx, outboxEvent("a")))
+		assert.NoError(t, repo.SaveTx(tx, outboxEvent("b")))
+		assert.NoError(t, tx.Commit())
+		sinks := []string{"crm"}
+
+		claim := func(limit int) []outbox.EventEntity {
+			tx, err := repo.BeginTransaction()
+			assert.NoError(t, err)
+			items, err := repo.ClaimTx(tx, sinks, limit, time.Minute)
+			assert.NoError(t, err)
+			assert.NoError(t, tx.Commit())
+			return items
+		}
+		first := claim(1)
+		assert.Equal(t, 1, len(first))
+		assert.Empty(t, claim(10))
+
+		assert.NoError(t, repo.Release([]int64{first[0].Id}, sinks))
+		again := claim(1)
+		assert.Equal(t, first[0].Id, again[0].Id)
+
+		assert.NoError(t, repo.MarkPublished([]int64{again[0].Id}, "crm"))
+		assert.NoError(t, repo.Release([]int64{again[0].Id}, sinks))
+		next := claim(10)
+		assert.Equal(t, 1, len(next))
+		assert.Equal(t, "b", next[0].DedupKey)
+	})
+
+	t.Run("each sink claims events it has not accepted", func(t *testing.T) {
+		fixture := NewFixture()
+		repo := outbox.NewOutboxRepository(fixture.DB)
+		tx, err := repo.BeginTransaction()
+		assert.NoError(t, err)
+		assert.NoError(t, repo.SaveTx(tx, outboxEvent("a")))
+		assert.NoError(t, repo.SaveTx(tx, outboxEvent("b")))
+		assert.NoError(t, repo.SaveTx(tx, outboxEvent("c")))
+		assert.NoError(t, tx.Commit())
+		sinks := []string{"log", "crm"}
+
+		claim := func() []outbox.EventEntity {
+			tx, err := repo.BeginTransaction()
+			assert.NoError(t, err)
+			items, err := repo.ClaimTx(tx, sinks, 1, time.Minute)
+			assert.NoError(t, err)
+			assert.NoError(t, tx.Commit())
+			return items
+		}
+		first := claim()
+		assert.Equal(t, 1, len(first))
+		// log принял событие, crm — нет: следующий проход берёт его для crm и следующее — для log
+		assert.NoError(t, repo.MarkPublished([]int64{first[0].Id}, "log"))
+		assert.NoError(t, repo.Release([]int64{first[0].Id}, sinks))
+		second := claim()
+		assert.Equal(t, 2, len(second))
+		assert.Equal(t, "a", second[0].DedupKey)
+		assert.Equal(t, []string{"log"}, []string(second[0].PublishedSinks))
+		assert.Equal(t, "b", second[1].DedupKey)
+
+		assert.NoError(t, repo.MarkPublished([]int64{second[0].Id}, "crm"))
+		assert.NoError(t, repo.Release([]int64{second[0].Id, second[1].Id}, sinks))
+		status, err := repo.FindStatus()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), status.Pending)
+	})
+
+	t.Run("event is moved out of the queue after max attempts and retried", func(t *testing.T) {
+		fixture := NewFixture()
+		repo := outbox.NewOutboxRepository(fixture.DB)
+		tx, err := repo.BeginTransaction()
+		assert.NoError(t, err)
+		assert.NoError(t, repo.SaveTx(tx, outboxEvent("a")))
+		assert.NoError(t, repo.SaveTx(tx, outboxEvent("b")))
+		assert.NoError(t, tx.Commit())
+		sinks := []string{"crm"}
+
+		tx, err = repo.BeginTransaction()
+		assert.NoError(t, err)
+		items, err := repo.ClaimTx(tx, sinks, 1, time.Minute)
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Commit())
+		dead, err := repo.MarkFailed(items[0].Id, "crm: bad request", 2)
+		assert.NoError(t, err)
+		assert.False(t, dead)
+		dead, err = repo.MarkFailed(items[0].Id, "crm: bad request", 2)
+		assert.NoError(t, err)
+		assert.True(t, dead)
+		assert.NoError(t, repo.Release([]int64{items[0].Id}, sinks))
+
+		tx, err = repo.BeginTransaction()
+		assert.NoError(t, err)
+		next, err := repo.ClaimTx(tx, sinks, 1, time.Minute)
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Rollback())
+		assert.Equal(t, "b", next[0].DedupKey)
+		status, err := repo.FindStatus()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), status.Pending)
+		assert.Equal(t, int64(1), status.Dead)
+		assert.Equal(t, 2, status.Attempts)
+		assert.Equal(t, "crm: bad request", status.LastError)
+
+		retried, err := repo.Retry()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), retried)
+		status, err = repo.FindStatus()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), status.Pending)
+		assert.Equal(t, int64(0), status.Dead)
+	})
+
+	t.Run("duplicate dedup key is rejected", func(t *testing.T) {
+		fixture := NewFixture()
+		repo := outbox.NewOutboxRepository(fixture.DB)
+		tx, err := repo.BeginTransaction()
+		assert.NoError(t, err)
+		defer func() { _ = tx.Rollback() }()
+		assert.NoError(t, repo.SaveTx(tx, outboxEvent("a")))
+		assert.Error(t, repo.SaveTx(tx, outboxEvent("a")))
+	})
+
+	t.Run("only one relay holds the lock", func(t *testing.T) {
+		fixture := NewFixture()
+		repo := outbox.NewOutboxRepository(fixture.DB)
+		first, err := repo.BeginTransaction()
+		assert.NoError(t, err)
+		second, err := repo.BeginTransaction()
+		assert.NoError(t, err)
+
+		locked, err := repo.TryLockTx(first)
+		assert.NoError(t, err)
+		assert.True(t, locked)
+		locked, err = repo.TryLockTx(second)
+		assert.NoError(t, err)
+		assert.False(t, locked)
+
+		assert.NoError(t, first.Commit())
+		locked, err = repo.TryLockTx(second)
+		assert.NoError(t, err)
+		assert.True(t, locked)
+		assert.NoError(t, second.Commit())
+	})
+
+	t.Run("failed event is reported and published events are purged", func(t *testing.T) {
+		fixture := NewFixture()
+		repo := outbox.NewOutboxRepository(fixture.DB)
+		tx, err := repo.BeginTransaction()
+		assert.NoError(t, err)
+		assert.NoError(t, repo.SaveTx(tx, outboxEvent("a")))
+		assert.NoError(t, repo.SaveTx(tx, outboxEvent("b")))
+		assert.NoError(t, tx.Commit())
+		sinks := []string{"crm"}
+
+		tx, err = repo.BeginTransaction()
+		assert.NoError(t, err)
+		items, err := repo.ClaimTx(tx, sinks, 10, time.Minute)
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Commit())
+		ids := []int64{items[0].Id, items[1].Id}
+		_, err = repo.MarkFailed(items[0].Id, "crm: timeout", 10)
+		assert.NoError(t, err)
+		assert.NoError(t, repo.Release(ids, sinks))
+
+		status, err := repo.FindStatus()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), status.Pending)
+		assert.Equal(t, 1, status.Attempts)
+		assert.Equal(t, "crm: timeout", status.LastError)
+
+		assert.NoError(t, repo.MarkPublished(ids, "crm"))
+		assert.NoError(t, repo.Release(ids, sinks))
+		status, err = repo.FindStatus()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), status.Pending)
+		assert.Nil(t, status.OldestPendingAt)
+
+		count, err := repo.DeletePublished(time.Now().Add(time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), count)
+	})
+}
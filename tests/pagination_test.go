@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"github.com/stretchr/testify/assert"
+	"idm/inner/common"
+	"idm/inner/employee"
+	"idm/inner/role"
+	"testing"
+	"time"
+)
+
+func TestPagination(t *testing.T) {
+
+	t.Run("employees are walked page by page in name order", func(t *testing.T) {
+		fixture := NewFixture()
+		sort := common.Sort{Field: "name"}
+		filter := employee.Filter{Sort: sort, Limit: 2}
+
+		first, err := fixture.EmployeesRepo.FindPage(filter)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Иванов Петр", "Козлова Елена"}, []string{first[0].Name, first[1].Name})
+
+		filter.After = &common.Cursor{Sort: "name", Value: first[1].Name, Id: first[1].Id}
+		second, err := fixture.EmployeesRepo.FindPage(filter)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Петров Алексей", "Сидорова Анна"}, []string{second[0].Name, second[1].Name})
+
+		filter.After = &common.Cursor{Sort: "name", Value: second[1].Name, Id: second[1].Id}
+		last, err := fixture.EmployeesRepo.FindPage(filter)
+		assert.NoError(t, err)
+		assert.Empty(t, last)
+	})
+
+	t.Run("employees are filtered by role and name prefix", func(t *testing.T) {
+		fixture := NewFixture()
+
+		count, err := fixture.EmployeesRepo.Count(employee.Filter{RoleId: 3})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), count)
+
+		found, err := fixture.EmployeesRepo.FindPage(employee.Filter{
+			NamePrefix: "Петр",
+			RoleId:     3,
+			Sort:       common.Sort{Field: "id"},
+			Limit:      10,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(found))
+		assert.Equal(t, "Разработчик", *found[0].RoleName)
+	})
+
+	t.Run("role filter matches additional roles", func(t *testing.T) {
+		fixture := NewFixture()
+		tx, err := fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		_, err = fixture.EmployeesRepo.GrantRoleTx(tx, 1, 3)
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Commit())
+
+		filter := employee.Filter{RoleId: 3, Sort: common.Sort{Field: "id"}, Limit: 10}
+		count, err := fixture.EmployeesRepo.Count(filter)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), count)
+		found, err := fixture.EmployeesRepo.FindPage(filter)
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{1, 3, 4}, []int64{found[0].Id, found[1].Id, found[2].Id})
+	})
+
+	t.Run("employees are walked by creation time descending", func(t *testing.T) {
+		fixture := NewFixture()
+		_, err := fixture.DB.Exec("update employee set created_at = '2024-01-01T00:00:00Z' where id in (1, 2)")
+		assert.NoError(t, err)
+		sort := common.Sort{Field: "created_at", Desc: true}
+
+		first, err := fixture.EmployeesRepo.FindPage(employee.Filter{Sort: sort, Limit: 3})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), first[2].Id)
+
+		rest, err := fixture.EmployeesRepo.FindPage(employee.Filter{
+			Sort:  sort,
+			After: &common.Cursor{Value: first[2].CreatedAt.Format(time.RFC3339Nano), Id: first[2].Id},
+			Limit: 3,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(rest))
+		assert.Equal(t, int64(1), rest[0].Id)
+	})
+
+	t.Run("deleted roles are counted only when requested", func(t *testing.T) {
+		fixture := NewFixture()
+		assert.NoError(t, fixture.RoleRepo.Delete(2))
+
+		active, err := fixture.RoleRepo.Count(role.Filter{})
+		assert.NoError(t, err)
+		all, err := fixture.RoleRepo.Count(role.Filter{IncludeDeleted: true})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), active)
+		assert.Equal(t, int64(3), all)
+
+		page, err := fixture.RoleRepo.FindPage(role.Filter{Sort: common.Sort{Field: "id", Desc: true}, Limit: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, "Разработчик", page[0].Name)
+	})
+}
@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"github.com/stretchr/testify/assert"
+	"idm/inner/permission"
+	"testing"
+)
+
+func TestRepositoryPermission(t *testing.T) {
+
+	t.Run("save permission", func(t *testing.T) {
+		fixture := NewFixture()
+
+		tx, err := fixture.PermissionRepo.BeginTransaction()
+		assert.NoError(t, err)
+		id, err := fixture.PermissionRepo.SaveTx(tx, permission.Entity{Resource: "invoice", Action: "approve"})
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Commit())
+
+		result, err := fixture.PermissionRepo.FindById(id)
+		assert.NoError(t, err)
+		assert.Equal(t, "invoice:approve", result.Name())
+		assert.False(t, result.System)
+	})
+
+	t.Run("seeded permissions are system", func(t *testing.T) {
+		fixture := NewFixture()
+
+		result, err := fixture.PermissionRepo.FindById(4)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "roles:write", result.Name())
+		assert.True(t, result.System)
+	})
+
+	t.Run("find permissions by role id", func(t *testing.T) {
+		fixture := NewFixture()
+
+		result, err := fixture.PermissionRepo.FindAllByRoleId(1)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 4, len(result))
+	})
+
+	t.Run("find effective permissions of employee", func(t *testing.T) {
+		fixture := NewFixture()
+
+		// сотруднику с ролью "Разработчик" выдаём ещё и роль "Менеджер": общие права не дублируются
+		tx, err := fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		_, err = fixture.EmployeesRepo.GrantRoleTx(tx, 3, 2)
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Commit())
+
+		result, err := fixture.PermissionRepo.FindAllByEmployeeId(3)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(result))
+		assert.Equal(t, "employees:read", result[0].Name())
+		assert.Equal(t, "roles:read", result[1].Name())
+	})
+
+	t.Run("find inherited permissions of employee", func(t *testing.T) {
+		fixture := NewFixture()
+
+		// "Менеджер" наследует "Разработчика" и получает его право roles:read
+		tx, err := fixture.RoleRepo.BeginTransaction()
+		assert.NoError(t, err)
+		assert.NoError(t, fixture.RoleRepo.ReplaceParentsTx(tx, 2, []int64{3}))
+		assert.NoError(t, tx.Commit())
+
+		result, err := fixture.PermissionRepo.FindAllByEmployeeId(2)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(result))
+		assert.Equal(t, "roles:read", result[1].Name())
+	})
+
+	t.Run("grant and revoke permission", func(t *testing.T) {
+		fixture := NewFixture()
+
+		tx, err := fixture.PermissionRepo.BeginTransaction()
+		assert.NoError(t, err)
+		granted, err := fixture.PermissionRepo.GrantToRoleTx(tx, 2, 4)
+		assert.NoError(t, err)
+		assert.True(t, granted)
+		granted, err = fixture.PermissionRepo.GrantToRoleTx(tx, 2, 4)
+		assert.NoError(t, err)
+		assert.False(t, granted)
+		assert.NoError(t, tx.Commit())
+		result, _ := fixture.PermissionRepo.FindAllByRoleId(2)
+		assert.Equal(t, 2, len(result))
+
+		tx, err = fixture.PermissionRepo.BeginTransaction()
+		assert.NoError(t, err)
+		revoked, err := fixture.PermissionRepo.RevokeFromRoleTx(tx, 2, 4)
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+		revoked, err = fixture.PermissionRepo.RevokeFromRoleTx(tx, 2, 4)
+		assert.NoError(t, err)
+		assert.False(t, revoked)
+		assert.NoError(t, tx.Commit())
+	})
+}
@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"github.com/stretchr/testify/assert"
+	"idm/inner/audit"
+	"idm/inner/provisioning"
+	"testing"
+	"time"
+)
+
+func TestProvisioningRepository(t *testing.T) {
+
+	t.Run("repeated change updates queued item instead of adding one", func(t *testing.T) {
+		fixture := NewFixture()
+		repo := provisioning.NewProvisioningRepository(fixture.DB)
+		tx, err := fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		assert.NoError(t, repo.EnqueueTx(tx, "crm", 1, audit.ActionCreate))
+		assert.NoError(t, repo.EnqueueTx(tx, "crm", 1, audit.ActionAddRole))
+		assert.NoError(t, tx.Commit())
+
+		items, err := repo.ClaimDue(10, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(items))
+		assert.Equal(t, audit.ActionAddRole, items[0].Action)
+		assert.Equal(t, 2, items[0].Version)
+
+		// взятая запись отложена и повторно не выбирается
+		again, err := repo.ClaimDue(10, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(again))
+	})
+
+	t.Run("role change enqueues its members and employees already in its group", func(t *testing.T) {
+		fixture := NewFixture()
+		repo := provisioning.NewProvisioningRepository(fixture.DB)
+		// сотруднику 1 роль 3 уже отозвана, но в группе системы он ещё состоит
+		assert.NoError(t, repo.SaveLink(provisioning.LinkEntity{Target: "crm", EmployeeId: 1, RemoteId: "u-1", RoleIds: []int64{1, 3}}))
+		tx, err := fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		assert.NoError(t, repo.EnqueueRoleTx(tx, "crm", 3, audit.ActionDelete))
+		assert.NoError(t, tx.Commit())
+
+		items, err := repo.ClaimDue(10, time.Minute)
+		assert.NoError(t, err)
+		var employeeIds []int64
+		for _, item := range items {
+			employeeIds = append(employeeIds, item.EmployeeId)
+			assert.Equal(t, audit.ActionDelete, item.Action)
+		}
+		assert.ElementsMatch(t, []int64{1, 3, 4}, employeeIds)
+	})
+
+	t.Run("delivered item is kept when employee changed during delivery", func(t *testing.T) {
+		fixture := NewFixture()
+		repo := provisioning.NewProvisioningRepository(fixture.DB)
+		tx, err := fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		assert.NoError(t, repo.EnqueueTx(tx, "crm", 1, audit.ActionCreate))
+		assert.NoError(t, tx.Commit())
+		items, err := repo.ClaimDue(10, 0)
+		assert.NoError(t, err)
+
+		tx, err = fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		assert.NoError(t, repo.EnqueueTx(tx, "crm", 1, audit.ActionUpdate))
+		assert.NoError(t, tx.Commit())
+		assert.NoError(t, repo.Delivered(items[0].Id, items[0].Version))
+
+		due, err := repo.ClaimDue(10, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(due))
+		assert.Equal(t, audit.ActionUpdate, due[0].Action)
+	})
+
+	t.Run("failed item waits for next attempt and is listed", func(t *testing.T) {
+		fixture := NewFixture()
+		repo := provisioning.NewProvisioningRepository(fixture.DB)
+		tx, err := fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		assert.NoError(t, repo.EnqueueTx(tx, "crm", 1, audit.ActionCreate))
+		assert.NoError(t, tx.Commit())
+		items, err := repo.ClaimDue(10, 0)
+		assert.NoError(t, err)
+
+		assert.NoError(t, repo.Failed(items[0].Id, items[0].Version, provisioning.MaxAttempts, nil, "timeout"))
+		due, err := repo.ClaimDue(10, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(due))
+		failed, err := repo.FindFailed()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(failed))
+		assert.Equal(t, "timeout", failed[0].LastError)
+	})
+
+	t.Run("reconcile enqueues every employee and linked purged ones", func(t *testing.T) {
+		fixture := NewFixture()
+		repo := provisioning.NewProvisioningRepository(fixture.DB)
+		assert.NoError(t, repo.SaveLink(provisioning.LinkEntity{Target: "crm", EmployeeId: 99, RemoteId: "u-99"}))
+
+		count, err := repo.EnqueueAll("crm", provisioning.ActionReconcile)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(5), count)
+	})
+
+	t.Run("employee is found with roles and links are saved", func(t *testing.T) {
+		fixture := NewFixture()
+		repo := provisioning.NewProvisioningRepository(fixture.DB)
+		assert.NoError(t, fixture.EmployeesRepo.Delete(2))
+
+		employee, err := repo.FindEmployee(2)
+		assert.NoError(t, err)
+		assert.NotNil(t, employee.DeletedAt)
+		assert.Equal(t, []string{"Менеджер"}, []string(employee.RoleNames))
+
+		assert.NoError(t, repo.SaveLink(provisioning.LinkEntity{Target: "crm", EmployeeId: 2, RemoteId: "u-1", RoleIds: []int64{2}}))
+		link, err := repo.FindLink("crm", 2)
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{2}, []int64(link.RoleIds))
+		assert.NoError(t, repo.SaveGroupLink("crm", 2, "g-1"))
+		groupId, err := repo.FindGroupLink("crm", 2)
+		assert.NoError(t, err)
+		assert.Equal(t, "g-1", groupId)
+	})
+}
@@ -97,6 +97,16 @@ func TestRepositoryRole(t *testing.T) {
 		assert.Equal(t, 2, len(result))
 	})
 
+	t.Run("find ids by names", func(t *testing.T) {
+		fixture := NewFixture()
+		assert.NoError(t, fixture.RoleRepo.Delete(2))
+
+		result, err := fixture.RoleRepo.FindIdsByNames([]string{"Администратор", "Менеджер", "unknown"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{1}, result)
+	})
+
 	t.Run("delete all by ids", func(t *testing.T) {
 		fixture := NewFixture()
 
@@ -116,4 +126,78 @@ func TestRepositoryRole(t *testing.T) {
 		assert.NoError(t, errDelete)
 		assert.Error(t, errFind)
 	})
+
+	t.Run("rename role", func(t *testing.T) {
+		fixture := NewFixture()
+		before, _ := fixture.RoleRepo.FindById(3)
+
+		tx, err := fixture.RoleRepo.BeginTransaction()
+		assert.NoError(t, err)
+		updated, err := fixture.RoleRepo.UpdateTx(tx, role.Entity{Id: 3, Name: "Ведущий разработчик"})
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Commit())
+
+		assert.Equal(t, "Ведущий разработчик", updated.Name)
+		assert.True(t, updated.UpdatedAt.After(before.UpdatedAt))
+	})
+
+	t.Run("find employees by role id", func(t *testing.T) {
+		fixture := NewFixture()
+
+		result, err := fixture.RoleRepo.FindEmployeesByRoleId(3)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(result))
+		assert.Equal(t, "Петров Алексей", result[0].Name)
+	})
+
+	t.Run("find active memberships", func(t *testing.T) {
+		fixture := NewFixture()
+		_, err := fixture.DB.Exec("update employee set status = 'suspended' where id = 4")
+		assert.NoError(t, err)
+
+		result, err := fixture.RoleRepo.FindActiveMemberships()
+
+		assert.NoError(t, err)
+		assert.Equal(t, []role.MembershipEntity{{RoleId: 1, EmployeeId: 1}, {RoleId: 2, EmployeeId: 2}, {RoleId: 3, EmployeeId: 3}}, result)
+	})
+
+	t.Run("find permissions by role ids", func(t *testing.T) {
+		fixture := NewFixture()
+
+		result, err := fixture.RoleRepo.FindPermissionsByRoleIds([]int64{2, 3})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 3, len(result))
+		assert.Equal(t, "Менеджер", result[0].RoleName)
+		assert.Equal(t, "employees", result[0].Resource)
+		assert.Equal(t, "read", result[0].Action)
+	})
+
+	t.Run("role hierarchy", func(t *testing.T) {
+		fixture := NewFixture()
+
+		// "Старший разработчик" наследует "Разработчика", а тот — "Менеджера"
+		tx, err := fixture.RoleRepo.BeginTransaction()
+		assert.NoError(t, err)
+		seniorId, err := fixture.RoleRepo.SaveTx(tx, role.Entity{Name: "Старший разработчик"})
+		assert.NoError(t, err)
+		assert.NoError(t, fixture.RoleRepo.ReplaceParentsTx(tx, seniorId, []int64{3}))
+		assert.NoError(t, fixture.RoleRepo.ReplaceParentsTx(tx, 3, []int64{2}))
+		descendants, err := fixture.RoleRepo.FindDescendantIdsTx(tx, 2)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []int64{3, seniorId}, descendants)
+		assert.NoError(t, tx.Commit())
+
+		ancestors, err := fixture.RoleRepo.FindAncestors(seniorId)
+		assert.NoError(t, err)
+		assert.Equal(t, []role.HierarchyEntity{{Id: 3, Name: "Разработчик", Depth: 1}, {Id: 2, Name: "Менеджер", Depth: 2}}, ancestors)
+
+		inherited, err := fixture.RoleRepo.FindPermissionsByRoleIds([]int64{seniorId})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, len(inherited))
+		for _, permission := range inherited {
+			assert.Equal(t, seniorId, permission.RoleId)
+		}
+	})
 }
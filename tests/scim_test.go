@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"github.com/stretchr/testify/assert"
+	"idm/inner/scim"
+	"testing"
+)
+
+func TestScimRepository(t *testing.T) {
+
+	t.Run("users are found by userName ignoring case with their groups", func(t *testing.T) {
+		fixture := NewFixture()
+		repo := scim.NewScimRepository(fixture.DB)
+		tx, err := fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		_, err = fixture.EmployeesRepo.GrantRoleTx(tx, 2, 1)
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Commit())
+
+		count, err := repo.CountUsers("сидорова анна")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+		users, err := repo.FindUsers("сидорова анна", 0, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(users))
+		assert.Equal(t, []int64{1, 2}, []int64(users[0].GroupIds))
+		assert.Equal(t, []string{"Администратор", "Менеджер"}, []string(users[0].GroupNames))
+	})
+
+	t.Run("users are paged by offset and skip deleted", func(t *testing.T) {
+		fixture := NewFixture()
+		repo := scim.NewScimRepository(fixture.DB)
+		assert.NoError(t, fixture.EmployeesRepo.Delete(2))
+
+		count, err := repo.CountUsers("")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), count)
+		users, err := repo.FindUsers("", 1, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(users))
+		assert.Equal(t, int64(3), users[0].Id)
+
+		found, err := repo.FindUsersByIds([]int64{1, 2, 99})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(found))
+	})
+
+	t.Run("groups list members from granted roles", func(t *testing.T) {
+		fixture := NewFixture()
+		repo := scim.NewScimRepository(fixture.DB)
+
+		group, err := repo.FindGroupById(3)
+		assert.NoError(t, err)
+		assert.Equal(t, "Разработчик", group.Name)
+		assert.Equal(t, []int64{3, 4}, []int64(group.MemberIds))
+
+		groups, err := repo.FindGroups("менеджер", 0, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(groups))
+		assert.Equal(t, []string{"Сидорова Анна"}, []string(groups[0].MemberNames))
+	})
+}
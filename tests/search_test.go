@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEmployeeSearch(t *testing.T) {
+
+	t.Run("search ignores case and ё", func(t *testing.T) {
+		fixture := NewFixture()
+		_, err := fixture.DB.Exec("insert into employee (name, role_id) values ('Королёва Алёна', 2)")
+		assert.NoError(t, err)
+
+		found, err := fixture.EmployeesRepo.Search("КОРОЛЕВА", 10)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(found))
+		assert.Equal(t, "Королёва Алёна", found[0].Name)
+		assert.Equal(t, "Менеджер", *found[0].RoleName)
+	})
+
+	t.Run("search matches word prefixes in any order", func(t *testing.T) {
+		fixture := NewFixture()
+
+		found, err := fixture.EmployeesRepo.Search("анна сид", 10)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(found))
+		assert.Equal(t, int64(2), found[0].Id)
+	})
+
+	t.Run("search tolerates typos and orders by rank", func(t *testing.T) {
+		fixture := NewFixture()
+
+		found, err := fixture.EmployeesRepo.Search("Петрв", 10)
+		assert.NoError(t, err)
+		names := make([]string, len(found))
+		for i := range found {
+			names[i] = found[i].Name
+		}
+		assert.Contains(t, names, "Петров Алексей")
+
+		found, err = fixture.EmployeesRepo.Search("петр", 10)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(found))
+		assert.GreaterOrEqual(t, found[0].Rank, found[1].Rank)
+	})
+
+	t.Run("search skips deleted employees and respects limit", func(t *testing.T) {
+		fixture := NewFixture()
+		assert.NoError(t, fixture.EmployeesRepo.Delete(3))
+
+		found, err := fixture.EmployeesRepo.Search("петров", 10)
+		assert.NoError(t, err)
+		for i := range found {
+			assert.NotEqual(t, int64(3), found[i].Id)
+		}
+
+		found, err = fixture.EmployeesRepo.Search("а", 1)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, len(found), 1)
+	})
+}
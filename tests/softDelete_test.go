@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSoftDelete(t *testing.T) {
+
+	t.Run("deleted employee is hidden and can be restored", func(t *testing.T) {
+		fixture := NewFixture()
+
+		assert.NoError(t, fixture.EmployeesRepo.Delete(2))
+		assert.ErrorIs(t, fixture.EmployeesRepo.Delete(2), sql.ErrNoRows)
+
+		_, err := fixture.EmployeesRepo.FindById(2)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		active, _ := fixture.EmployeesRepo.FindAll()
+		assert.Equal(t, 3, len(active))
+		all, _ := fixture.EmployeesRepo.FindAllIncludingDeleted()
+		assert.Equal(t, 4, len(all))
+		deleted, err := fixture.EmployeesRepo.FindByIdIncludingDeleted(2)
+		assert.NoError(t, err)
+		assert.NotNil(t, deleted.DeletedAt)
+
+		tx, err := fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		restored, err := fixture.EmployeesRepo.RestoreTx(tx, 2)
+		assert.NoError(t, err)
+		_, err = fixture.EmployeesRepo.RestoreTx(tx, 1)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		assert.NoError(t, tx.Rollback())
+		assert.Nil(t, restored.DeletedAt)
+		assert.Equal(t, "Менеджер", *restored.RoleName)
+	})
+
+	t.Run("deleted employee has no roles", func(t *testing.T) {
+		fixture := NewFixture()
+
+		assert.NoError(t, fixture.EmployeesRepo.Delete(1))
+
+		roles, err := fixture.EmployeesRepo.FindRolesByEmployeeId(1)
+		assert.NoError(t, err)
+		assert.Empty(t, roles)
+	})
+
+	t.Run("deleted role grants no permissions and keeps employees", func(t *testing.T) {
+		fixture := NewFixture()
+
+		assert.NoError(t, fixture.RoleRepo.Delete(3))
+
+		_, err := fixture.RoleRepo.FindById(3)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		permissions, err := fixture.RoleRepo.FindPermissionsByRoleIds([]int64{3})
+		assert.NoError(t, err)
+		assert.Empty(t, permissions)
+		developer, err := fixture.EmployeesRepo.FindById(3)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), *developer.RoleID)
+		granted, err := fixture.PermissionRepo.FindAllByEmployeeId(developer.Id)
+		assert.NoError(t, err)
+		assert.Empty(t, granted)
+	})
+
+	t.Run("purge removes only rows deleted before the cutoff", func(t *testing.T) {
+		fixture := NewFixture()
+		assert.NoError(t, fixture.EmployeesRepo.DeleteAllByIds([]int64{3, 4}))
+		_, err := fixture.DB.Exec("update employee set deleted_at = now() - interval '40 days' where id = 3")
+		assert.NoError(t, err)
+
+		tx, err := fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		purged, err := fixture.EmployeesRepo.PurgeTx(tx, time.Now().Add(-30*24*time.Hour))
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Commit())
+
+		assert.Equal(t, 1, len(purged))
+		assert.Equal(t, int64(3), purged[0].Id)
+		all, _ := fixture.EmployeesRepo.FindAllIncludingDeleted()
+		assert.Equal(t, 3, len(all))
+	})
+
+	t.Run("purged role is cleared from employees", func(t *testing.T) {
+		fixture := NewFixture()
+		assert.NoError(t, fixture.RoleRepo.Delete(3))
+
+		tx, err := fixture.RoleRepo.BeginTransaction()
+		assert.NoError(t, err)
+		purged, err := fixture.RoleRepo.PurgeTx(tx, time.Now().Add(time.Minute))
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Commit())
+
+		assert.Equal(t, 1, len(purged))
+		developer, err := fixture.EmployeesRepo.FindById(3)
+		assert.NoError(t, err)
+		assert.Nil(t, developer.RoleID)
+	})
+}
@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"idm/inner/token"
+	"testing"
+	"time"
+)
+
+func TestRepositoryToken(t *testing.T) {
+
+	t.Run("save client with roles", func(t *testing.T) {
+		fixture := NewFixture()
+
+		tx, err := fixture.TokenRepo.BeginTransaction()
+		assert.NoError(t, err)
+		saved, err := fixture.TokenRepo.SaveClientTx(tx, token.ClientEntity{ClientId: "billing", Name: "Биллинг", SecretHash: "hash"})
+		assert.NoError(t, err)
+		assert.NoError(t, fixture.TokenRepo.GrantClientRolesTx(tx, saved.Id, []int64{2, 3}))
+		exists, err := fixture.TokenRepo.ExistsClientByClientIdTx(tx, "billing")
+		assert.NoError(t, err)
+		assert.True(t, exists)
+		assert.NoError(t, tx.Commit())
+
+		found, err := fixture.TokenRepo.FindClientByClientId("billing")
+		assert.NoError(t, err)
+		assert.Equal(t, saved.Id, found.Id)
+		roles, err := fixture.TokenRepo.FindClientRoleNames(saved.Id)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Менеджер", "Разработчик"}, roles)
+		roleIds, err := fixture.TokenRepo.FindRoleIdsByClientId("billing")
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{2, 3}, roleIds)
+	})
+
+	t.Run("login code can be used once", func(t *testing.T) {
+		fixture := NewFixture()
+
+		assert.NoError(t, fixture.TokenRepo.SaveLoginCode("hash-1", 1, time.Now().Add(time.Minute)))
+
+		employeeId, err := fixture.TokenRepo.UseLoginCode("hash-1")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), employeeId)
+
+		_, err = fixture.TokenRepo.UseLoginCode("hash-1")
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("expired login code is rejected", func(t *testing.T) {
+		fixture := NewFixture()
+
+		assert.NoError(t, fixture.TokenRepo.SaveLoginCode("hash-2", 1, time.Now().Add(-time.Minute)))
+
+		_, err := fixture.TokenRepo.UseLoginCode("hash-2")
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("issue and verify token with stored keys", func(t *testing.T) {
+		fixture := NewFixture()
+		keyStore := token.NewKeyStore(fixture.TokenRepo, time.Minute, 0)
+
+		_, err := keyStore.Rotate()
+		assert.NoError(t, err)
+		jwks, err := keyStore.Jwks()
+		assert.NoError(t, err)
+		assert.Len(t, jwks.Keys, 1)
+
+		_, ok := keyStore.PublicKey(jwks.Keys[0].Kid)
+		assert.True(t, ok)
+	})
+}
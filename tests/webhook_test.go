@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"github.com/stretchr/testify/assert"
+	"idm/inner/audit"
+	"idm/inner/employee"
+	"idm/inner/validator"
+	"idm/inner/webhook"
+	"testing"
+	"time"
+)
+
+func TestWebhookRepository(t *testing.T) {
+
+	t.Run("event is enqueued only for subscribed endpoints", func(t *testing.T) {
+		fixture := NewFixture()
+		repo := webhook.NewWebhookRepository(fixture.DB)
+		exact, err := repo.SaveEndpoint(webhook.EndpointEntity{Url: "https://a", Events: []string{webhook.EventEmployeeCreated}, Secret: "s"})
+		assert.NoError(t, err)
+		entity, err := repo.SaveEndpoint(webhook.EndpointEntity{Url: "https://b", Events: []string{"employee.*"}, Secret: "s"})
+		assert.NoError(t, err)
+		all, err := repo.SaveEndpoint(webhook.EndpointEntity{Url: "https://c", Events: []string{"*"}, Secret: "s"})
+		assert.NoError(t, err)
+		roles, err := repo.SaveEndpoint(webhook.EndpointEntity{Url: "https://d", Events: []string{"role.*"}, Secret: "s"})
+		assert.NoError(t, err)
+
+		tx, err := fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		assert.NoError(t, repo.EnqueueTx(tx, "evt-1", webhook.EventEmployeeCreated, []byte(`{"id":"evt-1"}`)))
+		assert.NoError(t, repo.EnqueueTx(tx, "evt-2", webhook.EventEmployeeUpdated, []byte(`{"id":"evt-2"}`)))
+		assert.NoError(t, tx.Commit())
+
+		items, err := repo.ClaimDue(10, time.Minute)
+		assert.NoError(t, err)
+		var got []int64
+		for _, item := range items {
+			got = append(got, item.EndpointId)
+			assert.NotEmpty(t, item.Url)
+		}
+		assert.ElementsMatch(t, []int64{exact.Id, entity.Id, all.Id, entity.Id, all.Id}, got)
+		assert.NotContains(t, got, roles.Id)
+
+		// взятые доставки отложены и повторно не выбираются
+		again, err := repo.ClaimDue(10, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(again))
+	})
+
+	t.Run("rolled back change leaves no deliveries", func(t *testing.T) {
+		fixture := NewFixture()
+		repo := webhook.NewWebhookRepository(fixture.DB)
+		_, err := repo.SaveEndpoint(webhook.EndpointEntity{Url: "https://a", Events: []string{"*"}, Secret: "s"})
+		assert.NoError(t, err)
+		tx, err := fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		assert.NoError(t, repo.EnqueueTx(tx, "evt-1", webhook.EventEmployeeCreated, []byte(`{}`)))
+		assert.NoError(t, tx.Rollback())
+
+		items, err := repo.ClaimDue(10, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(items))
+	})
+
+	t.Run("failed delivery is logged and redelivered as new delivery", func(t *testing.T) {
+		fixture := NewFixture()
+		repo := webhook.NewWebhookRepository(fixture.DB)
+		endpoint, err := repo.SaveEndpoint(webhook.EndpointEntity{Url: "https://a", Events: []string{"*"}, Secret: "s"})
+		assert.NoError(t, err)
+		tx, err := fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		assert.NoError(t, repo.EnqueueTx(tx, "evt-1", webhook.EventEmployeeCreated, []byte(`{"id":"evt-1"}`)))
+		assert.NoError(t, tx.Commit())
+		items, err := repo.ClaimDue(10, 0)
+		assert.NoError(t, err)
+		status := 500
+		assert.NoError(t, repo.Failed(items[0].Id, webhook.MaxAttempts, nil, &status, "unexpected response status 500"))
+
+		failed, err := repo.FindDeliveries(endpoint.Id, webhook.StatusFailed, 0, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(failed))
+		assert.Equal(t, webhook.MaxAttempts, failed[0].Attempts)
+		assert.Equal(t, &status, failed[0].ResponseStatus)
+
+		redelivered, err := repo.Redeliver(endpoint.Id, items[0].Id)
+		assert.NoError(t, err)
+		assert.Equal(t, "evt-1", redelivered.EventId)
+		assert.Equal(t, webhook.StatusPending, redelivered.Status)
+		assert.NoError(t, repo.Delivered(redelivered.Id, 1, 200))
+
+		log, err := repo.FindDeliveries(endpoint.Id, "", 0, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(log))
+		assert.Equal(t, webhook.StatusDelivered, log[0].Status)
+		assert.Equal(t, webhook.StatusFailed, log[1].Status)
+	})
+
+	t.Run("deleting endpoint removes its deliveries", func(t *testing.T) {
+		fixture := NewFixture()
+		repo := webhook.NewWebhookRepository(fixture.DB)
+		endpoint, err := repo.SaveEndpoint(webhook.EndpointEntity{Url: "https://a", Events: []string{"*"}, Secret: "s"})
+		assert.NoError(t, err)
+		tx, err := fixture.EmployeesRepo.BeginTransaction()
+		assert.NoError(t, err)
+		assert.NoError(t, repo.EnqueueTx(tx, "evt-1", webhook.EventRoleCreated, []byte(`{}`)))
+		assert.NoError(t, tx.Commit())
+
+		assert.NoError(t, repo.DeleteEndpoint(endpoint.Id))
+		assert.Error(t, repo.DeleteEndpoint(endpoint.Id))
+		items, err := repo.ClaimDue(10, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(items))
+	})
+
+	t.Run("primary role change is published as unassigned and assigned", func(t *testing.T) {
+		fixture := NewFixture()
+		repo := webhook.NewWebhookRepository(fixture.DB)
+		_, err := repo.SaveEndpoint(webhook.EndpointEntity{Url: "https://a", Events: []string{"role.*"}, Secret: "s"})
+		assert.NoError(t, err)
+		validate := validator.New()
+		webhookService := webhook.NewService(repo, validate, nil)
+		employeeService := employee.NewService(fixture.EmployeesRepo, fixture.RoleRepo, validate, audit.Recorders{webhookService}, 0)
+
+		// то же, что PUT /employees/:id/role
+		_, err = employeeService.AssignRole(audit.Actor{Subject: "webhook-test"}, 1, employee.RoleRequest{RoleId: 2})
+		assert.NoError(t, err)
+
+		items, err := repo.ClaimDue(10, time.Minute)
+		assert.NoError(t, err)
+		var events []string
+		for _, item := range items {
+			events = append(events, item.Event)
+		}
+		assert.ElementsMatch(t, []string{webhook.EventRoleUnassigned, webhook.EventRoleAssigned}, events)
+	})
+}